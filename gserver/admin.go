@@ -0,0 +1,245 @@
+package gserver
+
+import (
+	"context"
+	"expvar"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime/metrics"
+	"time"
+
+	"github.com/effective-security/porto/pkg/transport"
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/restserver/authz"
+	"github.com/effective-security/porto/restserver/opsroutes"
+	"github.com/effective-security/porto/restserver/telemetry"
+	"github.com/effective-security/porto/xhttp/correlation"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/identity"
+	"github.com/effective-security/porto/xhttp/marshal"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	channelzsvc "google.golang.org/grpc/channelz/service"
+)
+
+// Paths of the admin endpoints,
+// in addition to pprof endpoints under opsroutes.DebugPath
+const (
+	// AdminPath is the prefix of the admin HTTP endpoints
+	AdminPath = "/debug"
+	// AdminVarsPath is the path of expvar endpoint
+	AdminVarsPath = "/debug/vars"
+	// AdminRuntimePath is the path of runtime metrics endpoint
+	AdminRuntimePath = "/debug/runtime"
+	// ChannelzService is the name of gRPC channelz service
+	ChannelzService = "/grpc.channelz.v1.Channelz"
+)
+
+// adminServer serves the debug endpoints on the admin listener
+type adminServer struct {
+	addr string
+	http *http.Server
+	grpc *grpc.Server
+}
+
+// serveAdmin starts the admin listener, if enabled
+func (e *Server) serveAdmin() error {
+	cfg := e.cfg.Admin
+	if !cfg.GetEnabled() {
+		return nil
+	}
+
+	u, err := url.Parse(cfg.ListenURL)
+	if err != nil {
+		return errors.WithMessage(err, "invalid admin listen_url")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.Errorf("unsupported admin URL scheme %q", u.Scheme)
+	}
+	var tlsInfo *transport.TLSInfo
+	if u.Scheme == "https" {
+		if tlsInfo, err = serverTLSInfo(e.cfg.ServerTLS); err != nil {
+			return err
+		}
+		if tlsInfo == nil {
+			return errors.Errorf("TLS key/cert must be provided for the admin url %s", cfg.ListenURL)
+		}
+	}
+
+	az, err := authz.New(&authz.Config{LogDenied: true})
+	if err != nil {
+		return err
+	}
+	// the roles are mapped from the identity of the server's IdentityMap,
+	// the guest role is never allowed
+	az.SetRoleMapper(func(r *http.Request) identity.Identity {
+		return identity.FromRequest(r).Identity()
+	})
+	az.SetGRPCRoleMapper(func(ctx context.Context) identity.Identity {
+		return identity.FromContext(ctx).Identity()
+	})
+	az.Allow(AdminPath, cfg.Roles...)
+	az.Allow(ChannelzService, cfg.Roles...)
+	if e.security != nil {
+		az.OnDenied(e.security.authzDenied)
+	}
+
+	gs := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		correlation.NewAuthUnaryInterceptor(),
+		identity.NewAuthUnaryInterceptor(e.identityFromContext),
+		az.NewUnaryInterceptor(),
+	))
+	channelzsvc.RegisterChannelzServiceToServer(gs)
+
+	handler, err := az.NewHandler(adminRouter().Handler())
+	if err != nil {
+		gs.Stop()
+		return err
+	}
+	handler = telemetry.NewRequestLogger(handler, time.Millisecond, logger)
+	handler = identity.NewContextHandler(handler, e.identityFromRequest)
+	handler = correlation.NewHandler(handler)
+	handler = adminHandler(gs, handler)
+
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: e.cfg.GetReadHeaderTimeout(),
+		// no WriteTimeout for the profiles collected over the time
+	}
+
+	l, err := net.Listen("tcp", u.Host)
+	if err != nil {
+		gs.Stop()
+		return errors.WithStack(err)
+	}
+	if tlsInfo != nil {
+		srv.TLSConfig = tlsInfo.Config()
+		if l, err = transport.NewTLSListener(l, tlsInfo); err != nil {
+			gs.Stop()
+			return err
+		}
+	} else {
+		// gRPC with prior knowledge
+		srv.Handler = h2c.NewHandler(handler, &http2.Server{})
+		logger.KV(xlog.WARNING, "reason", "insecure_admin", "service", e.Name(), "address", u.Host)
+	}
+
+	e.admin = &adminServer{
+		addr: l.Addr().String(),
+		http: srv,
+		grpc: gs,
+	}
+
+	logger.KV(xlog.NOTICE, "status", "admin_serving", "service", e.Name(), "address", e.admin.addr, "roles", cfg.Roles)
+
+	errHandler := e.listenerErrHandler(e.admin.addr)
+	go func() { errHandler(srv.Serve(l)) }()
+	return nil
+}
+
+// close stops the admin listener without draining,
+// the profiles in progress are cancelled
+func (a *adminServer) close() {
+	if a == nil {
+		return
+	}
+	_ = a.http.Close()
+	a.grpc.Stop()
+}
+
+func adminRouter() restserver.Router {
+	router := restserver.NewRouter(notFoundHandler)
+	opsroutes.RegisterDebug(router)
+	vars := expvar.Handler()
+	router.GET(AdminVarsPath, func(w http.ResponseWriter, r *http.Request, _ restserver.Params) {
+		vars.ServeHTTP(w, r)
+	})
+	router.GET(AdminRuntimePath, runtimeMetrics)
+	return router
+}
+
+// adminHandler delegates gRPC requests to the channelz server
+func adminHandler(gs *grpc.Server, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && r.Header.Get(header.ContentType) == header.ApplicationGRPC {
+			gs.ServeHTTP(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// HistogramSummary is returned by runtime metrics endpoint for the histograms
+type HistogramSummary struct {
+	Count uint64  `json:"count"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+}
+
+// runtimeMetrics returns the values of runtime/metrics
+func runtimeMetrics(w http.ResponseWriter, r *http.Request, _ restserver.Params) {
+	descs := metrics.All()
+	samples := make([]metrics.Sample, len(descs))
+	for i := range descs {
+		samples[i].Name = descs[i].Name
+	}
+	metrics.Read(samples)
+
+	res := make(map[string]any, len(samples))
+	for _, s := range samples {
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			res[s.Name] = s.Value.Uint64()
+		case metrics.KindFloat64:
+			res[s.Name] = finite(s.Value.Float64())
+		case metrics.KindFloat64Histogram:
+			res[s.Name] = summarizeHistogram(s.Value.Float64Histogram())
+		}
+	}
+	marshal.WriteJSON(w, r, res)
+}
+
+func summarizeHistogram(h *metrics.Float64Histogram) *HistogramSummary {
+	s := &HistogramSummary{}
+	for _, c := range h.Counts {
+		s.Count += c
+	}
+	if s.Count > 0 {
+		s.P50 = percentile(h, s.Count, 0.5)
+		s.P90 = percentile(h, s.Count, 0.9)
+		s.P99 = percentile(h, s.Count, 0.99)
+	}
+	return s
+}
+
+// percentile returns the upper bound of the bucket, that contains the percentile,
+// or the lower bound for the last bucket with the infinite upper bound
+func percentile(h *metrics.Float64Histogram, total uint64, p float64) float64 {
+	target := uint64(math.Ceil(float64(total) * p))
+	var n uint64
+	for i, c := range h.Counts {
+		n += c
+		if n >= target {
+			// Buckets contains len(Counts)+1 boundaries
+			if b := h.Buckets[i+1]; !math.IsInf(b, 0) {
+				return b
+			}
+			return finite(h.Buckets[i])
+		}
+	}
+	return 0
+}
+
+// finite returns zero for the values not supported by JSON
+func finite(v float64) float64 {
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return 0
+	}
+	return v
+}
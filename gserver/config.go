@@ -3,12 +3,17 @@ package gserver
 import (
 	"fmt"
 	"net/url"
+	"slices"
 	"time"
 
 	"github.com/effective-security/porto/gserver/roles"
 	"github.com/effective-security/porto/restserver/authz"
+	"github.com/effective-security/porto/restserver/deprecation"
+	"github.com/effective-security/porto/restserver/opsroutes"
 	"github.com/effective-security/porto/restserver/telemetry"
+	"github.com/effective-security/porto/xhttp/redact"
 	"github.com/effective-security/x/netutil"
+	"github.com/pkg/errors"
 )
 
 // Config contains the configuration of the server
@@ -16,6 +21,10 @@ type Config struct {
 	// DebugLogs allows to add extra debog logs
 	DebugLogs bool `json:"debug_logs" yaml:"debug_logs"`
 
+	// DebugRedaction configures redaction of secrets in debug logs,
+	// enabled by default with redact.Default
+	DebugRedaction *Redaction `json:"debug_redaction,omitempty" yaml:"debug_redaction,omitempty"`
+
 	// Description provides description of the server
 	Description string `json:"description,omitempty" yaml:"description,omitempty"`
 
@@ -35,6 +44,12 @@ type Config struct {
 	// this can be used for /v1/status/node or /metrics
 	SkipLogPaths []telemetry.LoggerSkipPath `json:"logger_skip_paths,omitempty" yaml:"logger_skip_paths,omitempty"`
 
+	// AccessLog contains configuration for the JSON access log
+	AccessLog *AccessLog `json:"access_log,omitempty" yaml:"access_log,omitempty"`
+
+	// Tracing contains configuration for OpenTelemetry tracing
+	Tracing *Tracing `json:"tracing,omitempty" yaml:"tracing,omitempty"`
+
 	// PromGrpc allows to submit gRPC metrics to Prometheus interceptors
 	PromGrpc bool `json:"prom_grpc" yaml:"prom_grpc"`
 
@@ -50,19 +65,137 @@ type Config struct {
 	// CORS contains configuration for CORS.
 	CORS *CORS `json:"cors,omitempty" yaml:"cors,omitempty"`
 
+	// H2C specifies to serve HTTP/2 without TLS on the insecure listeners,
+	// with prior knowledge or Upgrade from HTTP/1.1.
+	// Enables REST and gRPC-Web over HTTP/2 inside of the trusted networks.
+	H2C *bool `json:"h2c,omitempty" yaml:"h2c,omitempty"`
+
+	// ProxyProtocol contains configuration for PROXY protocol headers
+	// sent by the load balancers on TCP listeners
+	ProxyProtocol *ProxyProtocol `json:"proxy_protocol,omitempty" yaml:"proxy_protocol,omitempty"`
+
+	// UnixSocket contains configuration for the socket files
+	// of unix:// and unixs:// listeners
+	UnixSocket *UnixSocket `json:"unix_socket,omitempty" yaml:"unix_socket,omitempty"`
+
+	// MaxRecvMsgSize specifies the maximum size of the message in bytes,
+	// the gRPC server can receive, default 4MB
+	MaxRecvMsgSize int `json:"max_recv_msg_size,omitempty" yaml:"max_recv_msg_size,omitempty"`
+
+	// MaxConcurrentStreams specifies the maximum number of concurrent streams
+	// per HTTP/2 connection, including gRPC calls,
+	// zero for the default of gRPC and HTTP/2 servers
+	MaxConcurrentStreams uint32 `json:"max_concurrent_streams,omitempty" yaml:"max_concurrent_streams,omitempty"`
+
+	// MaxConnections specifies the maximum number of concurrent connections per listener,
+	// the new connections are not accepted and wait in the backlog
+	// until the open ones are closed, zero for no limit
+	MaxConnections int `json:"max_connections,omitempty" yaml:"max_connections,omitempty"`
+
+	// GRPCWeb contains configuration for the gRPC-Web streaming responses
+	GRPCWeb *GRPCWeb `json:"grpc_web,omitempty" yaml:"grpc_web,omitempty"`
+
 	// RateLimit contains configuration for the rate limiter
 	RateLimit *RateLimit `json:"rate_limit,omitempty" yaml:"rate_limit,omitempty"`
 
+	// GRPCRateLimit contains configuration for the rate limiter of gRPC calls
+	GRPCRateLimit *GRPCRateLimit `json:"grpc_rate_limit,omitempty" yaml:"grpc_rate_limit,omitempty"`
+
+	// SecurityEvents contains configuration for the security event hooks
+	SecurityEvents *SecurityEventsCfg `json:"security_events,omitempty" yaml:"security_events,omitempty"`
+
+	// RouteSuggestions specifies the maximum number of the closest registered routes,
+	// included in 404 responses to assist API consumers during integration.
+	// Disabled by default, should not be enabled in production.
+	RouteSuggestions int `json:"route_suggestions,omitempty" yaml:"route_suggestions,omitempty"`
+
+	// Deprecations specifies the deprecated endpoints,
+	// marked with Deprecation and Sunset headers
+	Deprecations []*deprecation.Endpoint `json:"deprecations,omitempty" yaml:"deprecations,omitempty"`
+
+	// Internal contains configuration for the internal endpoints:
+	// health, readiness, metrics and debug, registered in the router and authz
+	Internal *opsroutes.Config `json:"internal,omitempty" yaml:"internal,omitempty"`
+
+	// Admin contains configuration for the admin listener,
+	// serving the debug endpoints on a separate address
+	Admin *Admin `json:"admin,omitempty" yaml:"admin,omitempty"`
+
+	// Health contains configuration for the gRPC health checking service
+	Health *Health `json:"health,omitempty" yaml:"health,omitempty"`
+
+	// Readiness contains configuration for the load aware readiness probes
+	Readiness *Readiness `json:"readiness,omitempty" yaml:"readiness,omitempty"`
+
+	// Shutdown contains configuration for the graceful shutdown
+	Shutdown *Shutdown `json:"shutdown,omitempty" yaml:"shutdown,omitempty"`
+
+	// MaxHeaderBytes specifies the maximum size of the request headers
+	// of HTTP listeners, default is http.DefaultMaxHeaderBytes
+	MaxHeaderBytes int `json:"max_header_bytes,omitempty" yaml:"max_header_bytes,omitempty"`
+
+	// MaxRequestSize specifies the maximum size of HTTP request body,
+	// the larger requests are rejected with 413 status, zero for no limit.
+	// gRPC requests are limited by MaxRecvMsgSize.
+	MaxRequestSize int64 `json:"max_request_size,omitempty" yaml:"max_request_size,omitempty"`
+
 	// Timeout settings
 	Timeout struct {
 		// Request is the timeout for client requests to finish.
 		Request time.Duration `json:"request,omitempty" yaml:"request,omitempty"`
+		// ReadHeader is the timeout to read the request headers, default 10s
+		ReadHeader time.Duration `json:"read_header,omitempty" yaml:"read_header,omitempty"`
+		// Read is the timeout to read the entire request, including the body
+		Read time.Duration `json:"read,omitempty" yaml:"read,omitempty"`
+		// Write is the timeout to write the response,
+		// note that it also limits gRPC streams on TLS listeners
+		Write time.Duration `json:"write,omitempty" yaml:"write,omitempty"`
+		// Idle is the timeout to wait for the next request on keep-alive connections,
+		// default is Read timeout
+		Idle time.Duration `json:"idle,omitempty" yaml:"idle,omitempty"`
 	} `json:"timeout" yaml:"timeout"`
 
 	// KeepAlive settings
 	KeepAlive KeepAliveCfg `json:"keep_alive" yaml:"keep_alive"`
 }
 
+// GetH2C specifies if HTTP/2 without TLS is enabled
+func (c *Config) GetH2C() bool {
+	return c.H2C != nil && *c.H2C
+}
+
+// defaultReadHeaderTimeout prevents the slow clients
+// from holding the connections forever
+const defaultReadHeaderTimeout = 10 * time.Second
+
+// GetReadTimeout returns the timeout to read the entire request
+func (c *Config) GetReadTimeout() time.Duration {
+	return c.Timeout.Read
+}
+
+// GetReadHeaderTimeout returns the timeout to read the request headers, default 10s
+func (c *Config) GetReadHeaderTimeout() time.Duration {
+	if c.Timeout.ReadHeader > 0 {
+		return c.Timeout.ReadHeader
+	}
+	return defaultReadHeaderTimeout
+}
+
+// GetWriteTimeout returns the timeout to write the response
+func (c *Config) GetWriteTimeout() time.Duration {
+	return c.Timeout.Write
+}
+
+// GetIdleTimeout returns the timeout to wait for the next request on keep-alive connections
+func (c *Config) GetIdleTimeout() time.Duration {
+	return c.Timeout.Idle
+}
+
+// GetMaxHeaderBytes returns the maximum size of the request headers
+func (c *Config) GetMaxHeaderBytes() int {
+	return c.MaxHeaderBytes
+}
+
 // KeepAliveCfg settings
 type KeepAliveCfg struct {
 	// MinTime is the minimum interval that a client should wait before pinging server.
@@ -73,6 +206,19 @@ type KeepAliveCfg struct {
 
 	// Timeout is the additional duration of wait before closing a non-responsive connection, use 0 to disable.
 	Timeout time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+	// MaxConnectionIdle is the duration after which an idle gRPC connection is closed, default 5m
+	MaxConnectionIdle time.Duration `json:"max_connection_idle,omitempty" yaml:"max_connection_idle,omitempty"`
+
+	// MaxConnectionAge is the maximum duration of gRPC connection,
+	// after which GOAWAY is sent to the client, use 0 for no limit.
+	// Note that it applies to gRPC served on the insecure listeners,
+	// the gRPC on TLS listeners is served by HTTP/2 server.
+	MaxConnectionAge time.Duration `json:"max_connection_age,omitempty" yaml:"max_connection_age,omitempty"`
+
+	// MaxConnectionAgeGrace is the additional duration after MaxConnectionAge,
+	// to complete the pending calls before the connection is closed, use 0 for no limit.
+	MaxConnectionAgeGrace time.Duration `json:"max_connection_age_grace,omitempty" yaml:"max_connection_age_grace,omitempty"`
 }
 
 // TLSInfo contains configuration info for the TLS
@@ -101,6 +247,12 @@ type TLSInfo struct {
 
 	// ClientCertAuth controls client auth
 	ClientCertAuth *bool `json:"client_cert_auth,omitempty" yaml:"client_cert_auth,omitempty"`
+
+	// RotationDrainPeriod specifies the period to gracefully close
+	// the existing connections, when the cert or the client CA bundle is rotated,
+	// so the clients re-handshake against the new material.
+	// If not set, the existing connections are not closed.
+	RotationDrainPeriod time.Duration `json:"rotation_drain_period,omitempty" yaml:"rotation_drain_period,omitempty"`
 }
 
 // SwaggerCfg specifies the configuration for Swagger
@@ -139,6 +291,10 @@ type CORS struct {
 	// OptionsPassthrough instructs preflight to let other potential next handlers to process the OPTIONS method.
 	OptionsPassthrough *bool `json:"options_pass_through,omitempty" yaml:"options_pass_through,omitempty"`
 
+	// EarlyPreflight instructs to answer the preflight requests before the rate limiter,
+	// identity, authz and logging handlers. OptionsPassthrough is not applied to them.
+	EarlyPreflight *bool `json:"early_preflight,omitempty" yaml:"early_preflight,omitempty"`
+
 	// Debug flag adds additional output to debug server side CORS issues.
 	Debug *bool `json:"debug,omitempty" yaml:"debug,omitempty"`
 }
@@ -186,6 +342,92 @@ func (c *CORS) GetOptionsPassthrough() bool {
 	return c != nil && c.OptionsPassthrough != nil && *c.OptionsPassthrough
 }
 
+// GetEarlyPreflight flag
+func (c *CORS) GetEarlyPreflight() bool {
+	return c != nil && c.EarlyPreflight != nil && *c.EarlyPreflight
+}
+
+// ProxyProtocol contains configuration for PROXY protocol v1 and v2,
+// so the handlers and gRPC peer info get the client address
+// instead of the address of the load balancer.
+type ProxyProtocol struct {
+	// Enabled specifies if PROXY protocol is enabled.
+	Enabled *bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// Required specifies to reject the connections without PROXY header
+	Required bool `json:"required,omitempty" yaml:"required,omitempty"`
+	// TrustedCIDRs specifies the networks of the load balancers,
+	// allowed to send PROXY header, by default all sources are trusted
+	TrustedCIDRs []string `json:"trusted_cidrs,omitempty" yaml:"trusted_cidrs,omitempty"`
+	// HeaderTimeout specifies the timeout to read the header, default 5s
+	HeaderTimeout time.Duration `json:"header_timeout,omitempty" yaml:"header_timeout,omitempty"`
+}
+
+// GetEnabled specifies if PROXY protocol is enabled.
+func (c *ProxyProtocol) GetEnabled() bool {
+	return c != nil && c.Enabled != nil && *c.Enabled
+}
+
+// Admin contains configuration for the admin listener,
+// that serves pprof, expvar, gRPC channelz and runtime metrics,
+// so the debug endpoints are not exposed on the public listeners
+type Admin struct {
+	// Enabled specifies if the admin listener is enabled
+	Enabled *bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// ListenURL specifies the URL of the admin listener, e.g. http://127.0.0.1:6060,
+	// the https scheme uses ServerTLS of the server
+	ListenURL string `json:"listen_url,omitempty" yaml:"listen_url,omitempty"`
+	// Roles specifies the roles allowed to access the admin endpoints,
+	// the roles are mapped by IdentityMap, the guest role is not allowed
+	Roles []string `json:"roles,omitempty" yaml:"roles,omitempty"`
+}
+
+// GetEnabled specifies if the admin listener is enabled
+func (c *Admin) GetEnabled() bool {
+	return c != nil && c.Enabled != nil && *c.Enabled
+}
+
+// Validate returns error if the configuration is not valid
+func (c *Admin) Validate() error {
+	if !c.GetEnabled() {
+		return nil
+	}
+	if c.ListenURL == "" {
+		return errors.New("admin: listen_url is required")
+	}
+	if len(c.Roles) == 0 {
+		return errors.New("admin: roles are required")
+	}
+	if slices.Contains(c.Roles, roles.GuestRoleName) {
+		return errors.New("admin: guest role is not allowed")
+	}
+	return nil
+}
+
+// UnixSocket contains configuration for the socket files of Unix domain listeners
+type UnixSocket struct {
+	// Mode specifies the permissions of the socket file in octal format, e.g. 0660
+	Mode string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	// Owner specifies the user name or UID of the socket file owner
+	Owner string `json:"owner,omitempty" yaml:"owner,omitempty"`
+	// Group specifies the group name or GID of the socket file
+	Group string `json:"group,omitempty" yaml:"group,omitempty"`
+	// RemoveStale specifies to remove the socket file on startup,
+	// if it is left by unclean exit and no process is listening on it
+	RemoveStale *bool `json:"remove_stale,omitempty" yaml:"remove_stale,omitempty"`
+	// Unlink specifies to remove the socket file on shutdown
+	Unlink *bool `json:"unlink,omitempty" yaml:"unlink,omitempty"`
+}
+
+// GetRemoveStale specifies if the stale socket file is removed on startup
+func (c *UnixSocket) GetRemoveStale() bool {
+	return c != nil && c.RemoveStale != nil && *c.RemoveStale
+}
+
+// GetUnlink specifies if the socket file is removed on shutdown
+func (c *UnixSocket) GetUnlink() bool {
+	return c != nil && c.Unlink != nil && *c.Unlink
+}
+
 // RateLimit contains configuration for Rate Limititing.
 type RateLimit struct {
 	// Enabled specifies if the Rate Limititing is enabled.
@@ -204,3 +446,211 @@ type RateLimit struct {
 func (c *RateLimit) GetEnabled() bool {
 	return c != nil && c.Enabled != nil && *c.Enabled
 }
+
+// GRPCRateLimit contains configuration for the rate limiter of gRPC calls,
+// the limits are enforced per method and identity
+type GRPCRateLimit struct {
+	// Enabled specifies if the Rate Limititing is enabled.
+	Enabled *bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// RequestsPerSecond specifies the default limit, zero for no limit.
+	RequestsPerSecond float64 `json:"requests_per_second,omitempty" yaml:"requests_per_second,omitempty"`
+	// Methods specifies the limits per full method `/package.Service/Method`,
+	// or per service `/package.Service`
+	Methods map[string]float64 `json:"methods,omitempty" yaml:"methods,omitempty"`
+	// Roles specifies the limits per role, for the methods without the limits
+	Roles map[string]float64 `json:"roles,omitempty" yaml:"roles,omitempty"`
+	// ByRole specifies to share the limit between the identities of the same role,
+	// by default the limit is per subject, or client IP for anonymous calls
+	ByRole bool `json:"by_role,omitempty" yaml:"by_role,omitempty"`
+	// ExpirationTTL specifies the TTL for token bucket, default 10 mins
+	ExpirationTTL time.Duration `json:"expiration_ttl,omitempty" yaml:"expiration_ttl,omitempty"`
+}
+
+// GetEnabled specifies if the Rate Limititing is enabled.
+func (c *GRPCRateLimit) GetEnabled() bool {
+	return c != nil && c.Enabled != nil && *c.Enabled
+}
+
+// SecurityEventsCfg contains configuration for the security event hooks
+type SecurityEventsCfg struct {
+	// Enabled specifies if the security events are reported,
+	// the events are logged and metered unless WithSecurityEvents option is used.
+	Enabled *bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// AuthFailureThreshold specifies the number of failed authentications
+	// from the same client IP within AuthFailureWindow,
+	// reported as repeated auth failures, default 5
+	AuthFailureThreshold int `json:"auth_failure_threshold,omitempty" yaml:"auth_failure_threshold,omitempty"`
+	// AuthFailureWindow specifies the window to count the failed authentications, default 1m
+	AuthFailureWindow time.Duration `json:"auth_failure_window,omitempty" yaml:"auth_failure_window,omitempty"`
+	// SensitivePaths specifies the prefixes of the paths and gRPC methods,
+	// where the authz denials are reported, by default all denials are reported
+	SensitivePaths []string `json:"sensitive_paths,omitempty" yaml:"sensitive_paths,omitempty"`
+}
+
+// GetEnabled specifies if the security events are reported
+func (c *SecurityEventsCfg) GetEnabled() bool {
+	return c != nil && c.Enabled != nil && *c.Enabled
+}
+
+// Redaction contains configuration for redaction of secrets in debug logs.
+type Redaction struct {
+	// Disabled specifies to log the values as is.
+	Disabled bool `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	// Headers specifies the headers to redact, default is redact.DefaultHeaders
+	Headers []string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// Fields specifies case-insensitive patterns of JSON fields and query parameters
+	// to redact, default is redact.DefaultFields
+	Fields []string `json:"fields,omitempty" yaml:"fields,omitempty"`
+}
+
+// Redactor returns the configured Redactor, or nil if disabled
+func (c *Redaction) Redactor() (*redact.Redactor, error) {
+	if c == nil {
+		return redact.Default, nil
+	}
+	if c.Disabled {
+		return nil, nil
+	}
+	headers := c.Headers
+	if len(headers) == 0 {
+		headers = redact.DefaultHeaders
+	}
+	fields := c.Fields
+	if len(fields) == 0 {
+		fields = redact.DefaultFields
+	}
+	return redact.New(headers, fields)
+}
+
+// Readiness contains configuration for the load aware readiness probes,
+// that report degraded status with 429 and Retry-After,
+// so the load balancers back off before the server is overloaded.
+type Readiness struct {
+	// Enabled specifies if the load monitoring is enabled.
+	Enabled *bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// Paths specifies the probe paths, default is /readyz
+	Paths []string `json:"paths,omitempty" yaml:"paths,omitempty"`
+	// MaxInFlight specifies the maximum number of concurrent requests.
+	MaxInFlight int64 `json:"max_in_flight,omitempty" yaml:"max_in_flight,omitempty"`
+	// MaxLatency specifies the maximum scheduler latency.
+	MaxLatency time.Duration `json:"max_latency,omitempty" yaml:"max_latency,omitempty"`
+	// SampleInterval specifies the interval to sample the scheduler latency, default 100ms
+	SampleInterval time.Duration `json:"sample_interval,omitempty" yaml:"sample_interval,omitempty"`
+	// RetryAfter specifies the delay reported to the load balancers, default 5s
+	RetryAfter time.Duration `json:"retry_after,omitempty" yaml:"retry_after,omitempty"`
+}
+
+// GetEnabled specifies if the load monitoring is enabled.
+func (c *Readiness) GetEnabled() bool {
+	return c != nil && c.Enabled != nil && *c.Enabled
+}
+
+// GetPaths returns the probe paths
+func (c *Readiness) GetPaths() []string {
+	if c == nil || len(c.Paths) == 0 {
+		return []string{"/readyz"}
+	}
+	return c.Paths
+}
+
+// GRPCWeb contains configuration for the gRPC-Web streaming responses,
+// by default the response is buffered until completion.
+type GRPCWeb struct {
+	// FlushMessages specifies to flush the response after each message,
+	// so the browser clients receive the streamed updates promptly.
+	FlushMessages bool `json:"flush_messages,omitempty" yaml:"flush_messages,omitempty"`
+	// WriteTimeout specifies the deadline for each write to the client.
+	WriteTimeout time.Duration `json:"write_timeout,omitempty" yaml:"write_timeout,omitempty"`
+	// MaxTextSize specifies the maximum size in bytes of the decoded
+	// application/grpc-web-text request, default is MaxRecvMsgSize and the message prefix
+	MaxTextSize int64 `json:"max_text_size,omitempty" yaml:"max_text_size,omitempty"`
+}
+
+// AccessLog contains configuration for the JSON access log,
+// written instead of the request logs of the application
+type AccessLog struct {
+	// File specifies the path of the access log file, or `stdout` or `stderr`
+	File string `json:"file,omitempty" yaml:"file,omitempty"`
+}
+
+// Tracing contains configuration for OpenTelemetry tracing
+// of HTTP and gRPC requests.
+type Tracing struct {
+	// Enabled specifies if the tracing is enabled.
+	Enabled *bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// Endpoint specifies host:port of OTLP HTTP exporter,
+	// if not set, the trace context is propagated, but the spans are not exported.
+	Endpoint string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	// Insecure specifies to use HTTP instead of HTTPS for the exporter.
+	Insecure bool `json:"insecure,omitempty" yaml:"insecure,omitempty"`
+	// SamplingRatio specifies the ratio of the sampled traces from 0 to 1, default 1.
+	// The sampling decision of the parent span is respected.
+	SamplingRatio *float64 `json:"sampling_ratio,omitempty" yaml:"sampling_ratio,omitempty"`
+	// Attributes specifies the resource attributes,
+	// service.name is set to the server name by default.
+	Attributes map[string]string `json:"attributes,omitempty" yaml:"attributes,omitempty"`
+}
+
+// GetEnabled specifies if the tracing is enabled.
+func (c *Tracing) GetEnabled() bool {
+	return c != nil && c.Enabled != nil && *c.Enabled
+}
+
+// GetSamplingRatio returns the ratio of the sampled traces
+func (c *Tracing) GetSamplingRatio() float64 {
+	if c == nil || c.SamplingRatio == nil {
+		return 1
+	}
+	return *c.SamplingRatio
+}
+
+// Health contains configuration for the standard gRPC health checking service,
+// that reflects the readiness of the registered services.
+type Health struct {
+	// Disabled specifies to not register the health service.
+	Disabled bool `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	// Interval specifies the interval to update the status of the services, default 5s
+	Interval time.Duration `json:"interval,omitempty" yaml:"interval,omitempty"`
+}
+
+// GetDisabled specifies if the health service is disabled
+func (c *Health) GetDisabled() bool {
+	return c != nil && c.Disabled
+}
+
+// GetInterval returns the interval to update the status of the services
+func (c *Health) GetInterval() time.Duration {
+	if c == nil || c.Interval <= 0 {
+		return 5 * time.Second
+	}
+	return c.Interval
+}
+
+// Shutdown contains configuration for the graceful shutdown:
+// the server reports not ready, stops accepting new connections,
+// drains in-flight HTTP and gRPC requests up to the deadline,
+// and then closes the remaining connections.
+type Shutdown struct {
+	// Delay specifies the period to report not ready before draining,
+	// so the load balancers notice the status change.
+	Delay time.Duration `json:"delay,omitempty" yaml:"delay,omitempty"`
+	// Timeout specifies the deadline to drain in-flight requests,
+	// default is Timeout.Request, or 3s
+	Timeout time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// GetDelay returns the period to report not ready before draining
+func (c *Shutdown) GetDelay() time.Duration {
+	if c == nil {
+		return 0
+	}
+	return c.Delay
+}
+
+// GetTimeout returns the deadline to drain in-flight requests
+func (c *Shutdown) GetTimeout() time.Duration {
+	if c == nil {
+		return 0
+	}
+	return c.Timeout
+}
@@ -1,8 +1,11 @@
 package gserver
 
 import (
+	"net/http"
 	"testing"
+	"time"
 
+	"github.com/effective-security/porto/restserver"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -30,3 +33,49 @@ func TestTLSInfo(t *testing.T) {
 	assert.False(t, i.Empty())
 	assert.Equal(t, "cert=cert.pem, key=key.pem, trusted-ca=cacerts.pem, client-cert-auth=false, crl-file=123.crl", i.String())
 }
+
+func TestRedaction(t *testing.T) {
+	var cfg *Redaction
+	r, err := cfg.Redactor()
+	require.NoError(t, err)
+	assert.True(t, r.IsHeader("Authorization"))
+
+	r, err = (&Redaction{Disabled: true}).Redactor()
+	require.NoError(t, err)
+	assert.Nil(t, r)
+
+	r, err = (&Redaction{Headers: []string{"X-Secret"}, Fields: []string{"pin"}}).Redactor()
+	require.NoError(t, err)
+	assert.True(t, r.IsHeader("x-secret"))
+	assert.False(t, r.IsHeader("Authorization"))
+	assert.True(t, r.IsField("user_pin"))
+	assert.False(t, r.IsField("token"))
+
+	_, err = (&Redaction{Fields: []string{"["}}).Redactor()
+	assert.Error(t, err)
+}
+
+func TestHTTPLimits(t *testing.T) {
+	cfg := &Config{}
+	var _ restserver.HTTPLimitsConfig = cfg
+
+	srv := &http.Server{}
+	restserver.ApplyLimits(srv, cfg)
+	assert.Equal(t, defaultReadHeaderTimeout, srv.ReadHeaderTimeout)
+	assert.Zero(t, srv.ReadTimeout)
+	assert.Zero(t, srv.WriteTimeout)
+	assert.Zero(t, srv.IdleTimeout)
+	assert.Zero(t, srv.MaxHeaderBytes)
+
+	cfg.Timeout.Read = time.Second
+	cfg.Timeout.ReadHeader = 2 * time.Second
+	cfg.Timeout.Write = 3 * time.Second
+	cfg.Timeout.Idle = 4 * time.Second
+	cfg.MaxHeaderBytes = 4096
+	restserver.ApplyLimits(srv, cfg)
+	assert.Equal(t, time.Second, srv.ReadTimeout)
+	assert.Equal(t, 2*time.Second, srv.ReadHeaderTimeout)
+	assert.Equal(t, 3*time.Second, srv.WriteTimeout)
+	assert.Equal(t, 4*time.Second, srv.IdleTimeout)
+	assert.Equal(t, 4096, srv.MaxHeaderBytes)
+}
@@ -0,0 +1,81 @@
+package credentials
+
+import (
+	"context"
+
+	"github.com/effective-security/xpki/jwt/dpop"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	grpccredentials "google.golang.org/grpc/credentials"
+)
+
+// CallCredentials implements "grpccredentials.PerRPCCredentials" interface,
+// that attaches the Bearer or DPoP token of CallerIdentity to each call.
+// The token is refreshed from CallerIdentity before it expires.
+type CallCredentials struct {
+	rc       *perRPCCredential
+	insecure bool
+}
+
+// CallCredentialsOption configures CallCredentials
+type CallCredentialsOption func(*CallCredentials)
+
+// WithCallDPoP option to sign DPoP proof for the calls with DPoP token type
+func WithCallDPoP(signer dpop.Signer) CallCredentialsOption {
+	return func(c *CallCredentials) {
+		c.rc.WithDPoP(signer)
+	}
+}
+
+// WithInsecureTransport option to allow the token be sent
+// over the connection without TLS, should be used only in tests
+func WithInsecureTransport() CallCredentialsOption {
+	return func(c *CallCredentials) {
+		c.insecure = true
+	}
+}
+
+// NewCallCredentials returns PerRPCCredentials for the provider of the tokens
+func NewCallCredentials(provider CallerIdentity, opts ...CallCredentialsOption) *CallCredentials {
+	c := &CallCredentials{
+		rc: newPerRPCCredential(),
+	}
+	c.rc.WithPresignedToken(provider)
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// GetRequestMetadata returns the authorization metadata for the call,
+// the call fails if the connection is not secure
+func (c *CallCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	if !c.insecure {
+		ri, _ := grpccredentials.RequestInfoFromContext(ctx)
+		if err := grpccredentials.CheckSecurityLevel(ri.AuthInfo, grpccredentials.PrivacyAndIntegrity); err != nil {
+			return nil, errors.WithMessagef(err, "unable to transfer CallCredentials")
+		}
+	}
+	return c.rc.GetRequestMetadata(ctx, uri...)
+}
+
+// RequireTransportSecurity returns true, unless WithInsecureTransport is used
+func (c *CallCredentials) RequireTransportSecurity() bool {
+	return !c.insecure
+}
+
+// UpdateAuthToken replaces the current token,
+// the token is refreshed from CallerIdentity after it expires
+func (c *CallCredentials) UpdateAuthToken(token Token) {
+	c.rc.UpdateAuthToken(token)
+}
+
+// CallOption returns grpc.CallOption to attach the credentials to a single call
+func (c *CallCredentials) CallOption() grpc.CallOption {
+	return grpc.PerRPCCredentials(c)
+}
+
+// DialOption returns grpc.DialOption to attach the credentials to all calls of the connection
+func (c *CallCredentials) DialOption() grpc.DialOption {
+	return grpc.WithPerRPCCredentials(c)
+}
@@ -3,6 +3,7 @@ package credentials_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/effective-security/porto/gserver/credentials"
 	"github.com/stretchr/testify/assert"
@@ -35,3 +36,45 @@ func TestBundle(t *testing.T) {
 	err = tc.OverrideServerName("localhost")
 	assert.NoError(t, err)
 }
+
+type callerIdentity struct {
+	calls int
+	ttl   time.Duration
+}
+
+func (c *callerIdentity) GetCallerIdentity(_ context.Context) (*credentials.Token, error) {
+	c.calls++
+	exp := time.Now().Add(c.ttl).UTC()
+	return &credentials.Token{TokenType: "Bearer", AccessToken: "token", Expires: &exp}, nil
+}
+
+func TestCallCredentials(t *testing.T) {
+	provider := &callerIdentity{ttl: time.Hour}
+	cc := credentials.NewCallCredentials(provider)
+	assert.True(t, cc.RequireTransportSecurity())
+	assert.NotNil(t, cc.CallOption())
+	assert.NotNil(t, cc.DialOption())
+
+	_, err := cc.GetRequestMetadata(context.Background())
+	assert.EqualError(t, err, "unable to transfer CallCredentials: AuthInfo is nil")
+	assert.Equal(t, 0, provider.calls)
+
+	cc = credentials.NewCallCredentials(provider, credentials.WithInsecureTransport())
+	assert.False(t, cc.RequireTransportSecurity())
+
+	md, err := cc.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer token", md[credentials.TokenFieldNameGRPC])
+	_, err = cc.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, provider.calls)
+
+	// refreshed before expiration
+	provider.ttl = 30 * time.Second
+	exp := time.Now().Add(time.Second)
+	cc.UpdateAuthToken(credentials.Token{TokenType: "Bearer", AccessToken: "old", Expires: &exp})
+	md, err = cc.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer token", md[credentials.TokenFieldNameGRPC])
+	assert.Equal(t, 2, provider.calls)
+}
@@ -0,0 +1,318 @@
+package gserver
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/effective-security/porto/metricskey"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/x/slices"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// defaultMaxRecvMsgSize is the default limit of the gRPC server
+const defaultMaxRecvMsgSize = 4 << 20
+
+// grpcWebTextLimit returns the maximum size of the decoded grpc-web-text request
+func (c *Config) grpcWebTextLimit() int64 {
+	if c.GRPCWeb != nil && c.GRPCWeb.MaxTextSize > 0 {
+		return c.GRPCWeb.MaxTextSize
+	}
+	size := c.MaxRecvMsgSize
+	if size <= 0 {
+		size = defaultMaxRecvMsgSize
+	}
+	return int64(size) + grpcFrameHeaderLen
+}
+
+// decodeTextRequest replaces the body of grpc-web-text request with
+// the streaming base64 decoder, limited to the size.
+// The request with the larger Content-Length is rejected with ResourceExhausted,
+// and false is returned.
+func decodeTextRequest(w http.ResponseWriter, r *http.Request, limit int64) bool {
+	if r.ContentLength > int64(base64.StdEncoding.EncodedLen(int(limit))) {
+		rejectOversized(r, limit)
+
+		wh := w.Header()
+		wh.Set(header.ContentType, header.ApplicationGRPCWebText)
+		wh.Set("Grpc-Status", strconv.Itoa(int(codes.ResourceExhausted)))
+		wh.Set("Grpc-Message", oversizedMessage(limit))
+		w.WriteHeader(http.StatusOK)
+		return false
+	}
+
+	r.Body = &textBody{
+		body:      r.Body,
+		decoder:   base64.NewDecoder(base64.StdEncoding, r.Body),
+		remaining: limit,
+		limit:     limit,
+		r:         r,
+	}
+	r.ContentLength = -1
+	r.Header.Del(header.ContentLength)
+	return true
+}
+
+func oversizedMessage(limit int64) string {
+	return "grpc-web-text request exceeds " + strconv.FormatInt(limit, 10) + " bytes"
+}
+
+func rejectOversized(r *http.Request, limit int64) {
+	logger.ContextKV(r.Context(), xlog.WARNING,
+		"reason", "oversized",
+		"method", r.URL.Path,
+		"content-length", r.ContentLength,
+		"limit", limit)
+	metricskey.GRPCWebOversized.IncrCounter(1, r.URL.Path)
+}
+
+// textBody decodes base64 encoded body.
+// The errors are returned as HTTP/2 stream errors,
+// which the gRPC server maps to the status codes:
+// ResourceExhausted for the oversized body, and Internal for invalid encoding.
+type textBody struct {
+	body      io.ReadCloser
+	decoder   io.Reader
+	remaining int64
+	limit     int64
+	r         *http.Request
+	err       error
+}
+
+func (b *textBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.remaining <= 0 {
+		// the body must end at the limit
+		var one [1]byte
+		if _, err := io.ReadAtLeast(b.decoder, one[:], 1); err == io.EOF {
+			return 0, io.EOF
+		}
+		rejectOversized(b.r, b.limit)
+		b.err = http2.StreamError{
+			Code:  http2.ErrCodeEnhanceYourCalm,
+			Cause: errors.New(oversizedMessage(b.limit)),
+		}
+		return 0, b.err
+	}
+
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.decoder.Read(p)
+	b.remaining -= int64(n)
+	if err != nil && err != io.EOF {
+		b.err = http2.StreamError{
+			Code:  http2.ErrCodeProtocol,
+			Cause: errors.WithMessage(err, "invalid grpc-web-text request"),
+		}
+		return n, b.err
+	}
+	return n, err
+}
+
+func (b *textBody) Close() error {
+	return b.body.Close()
+}
+
+// textResponseWriter encodes the response of grpc-web-text request in base64,
+// each flushed chunk is encoded separately
+type textResponseWriter struct {
+	http.ResponseWriter
+	encoder     io.WriteCloser
+	wroteHeader bool
+}
+
+// setContentType replaces the Content-Type set by gRPC server,
+// before the headers are sent with WriteHeader, Write or Flush,
+// or with the trailers only response
+func (t *textResponseWriter) setContentType() {
+	if !t.wroteHeader {
+		t.wroteHeader = true
+		t.Header().Set(header.ContentType, header.ApplicationGRPCWebText)
+	}
+}
+
+func (t *textResponseWriter) WriteHeader(statusCode int) {
+	t.setContentType()
+	t.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (t *textResponseWriter) Write(data []byte) (int, error) {
+	t.setContentType()
+	if t.encoder == nil {
+		t.encoder = base64.NewEncoder(base64.StdEncoding, t.ResponseWriter)
+	}
+	return t.encoder.Write(data)
+}
+
+// Flush writes the pending bytes with the padding
+func (t *textResponseWriter) Flush() {
+	t.close()
+	_ = http.NewResponseController(t.ResponseWriter).Flush()
+}
+
+// Unwrap returns the original ResponseWriter for http.ResponseController
+func (t *textResponseWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+func (t *textResponseWriter) close() {
+	t.setContentType()
+	if t.encoder != nil {
+		_ = t.encoder.Close()
+		t.encoder = nil
+	}
+}
+
+// grpcWebRequestHeaders are the request headers, always allowed for grpc-web clients
+var grpcWebRequestHeaders = []string{"content-type", "x-grpc-web", "x-user-agent", "grpc-timeout"}
+
+// grpcWebCORS answers CORS preflight requests of grpc-web clients,
+// and provides the CORS headers of the grpc-web responses
+type grpcWebCORS struct {
+	// origins is the list of the allowed origins, empty allows any origin
+	origins     []string
+	headers     map[string]bool
+	anyHeader   bool
+	exposed     string
+	maxAge      string
+	credentials bool
+	services    map[string]bool
+}
+
+func newGRPCWebCORS(cfg *CORS, grpcServer *grpc.Server) *grpcWebCORS {
+	c := &grpcWebCORS{
+		headers:  map[string]bool{},
+		services: map[string]bool{},
+	}
+	for _, h := range grpcWebRequestHeaders {
+		c.headers[h] = true
+	}
+	for name := range grpcServer.GetServiceInfo() {
+		c.services[name] = true
+	}
+	if cfg != nil {
+		if len(cfg.AllowedOrigins) > 0 && cfg.AllowedOrigins[0] != "*" {
+			c.origins = cfg.AllowedOrigins
+		}
+		for _, h := range cfg.AllowedHeaders {
+			if h == "*" {
+				c.anyHeader = true
+			}
+			c.headers[strings.ToLower(h)] = true
+		}
+		if len(cfg.ExposedHeaders) > 0 {
+			c.exposed = strings.Join(cfg.ExposedHeaders, ",")
+		}
+		if cfg.MaxAge > 0 {
+			c.maxAge = strconv.Itoa(cfg.MaxAge)
+		}
+		c.credentials = cfg.GetAllowCredentials()
+	}
+	return c
+}
+
+// isPreflight returns true for the CORS preflight request of grpc-web client,
+// sent to the registered gRPC service or with grpc-web headers
+func (c *grpcWebCORS) isPreflight(r *http.Request) bool {
+	if r.Method != http.MethodOptions || r.Header.Get(header.AccessControlRequestMethod) == "" {
+		return false
+	}
+	service, _, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if ok && c.services[service] {
+		return true
+	}
+	for _, h := range requestedHeaders(r) {
+		if h == "x-grpc-web" {
+			return true
+		}
+	}
+	return false
+}
+
+// allowOrigin returns false if the origin is not allowed
+func (c *grpcWebCORS) allowOrigin(origin string) bool {
+	return len(c.origins) == 0 || slices.ContainsString(c.origins, origin)
+}
+
+// setOrigin sets Access-Control-Allow-Origin response header
+func (c *grpcWebCORS) setOrigin(wh http.Header, origin string) {
+	if len(c.origins) > 0 || c.credentials {
+		// the wildcard is not accepted with the credentials
+		wh.Set(header.AccessControlAllowOrigin, origin)
+		wh.Add(header.Vary, header.Origin)
+	} else {
+		wh.Set(header.AccessControlAllowOrigin, "*")
+	}
+	if c.credentials {
+		wh.Set(header.AccessControlAllowCredentials, "true")
+	}
+}
+
+// preflight answers the CORS preflight request
+func (c *grpcWebCORS) preflight(w http.ResponseWriter, r *http.Request) {
+	wh := w.Header()
+	wh.Add(header.Vary, header.AccessControlRequestMethod)
+	wh.Add(header.Vary, header.AccessControlRequestHeaders)
+
+	origin := r.Header.Get(header.Origin)
+	method := r.Header.Get(header.AccessControlRequestMethod)
+	requested := requestedHeaders(r)
+
+	reason := ""
+	if origin == "" || !c.allowOrigin(origin) {
+		reason = "cors_not_allowed"
+	} else if method != http.MethodPost {
+		reason = "cors_method_not_allowed"
+	} else if !c.anyHeader {
+		for _, h := range requested {
+			if !c.headers[h] {
+				reason = "cors_header_not_allowed"
+				break
+			}
+		}
+	}
+	if reason != "" {
+		logger.ContextKV(r.Context(), xlog.INFO,
+			"reason", reason,
+			"origin", origin,
+			"method", method,
+			"headers", r.Header.Get(header.AccessControlRequestHeaders),
+			"remote", r.RemoteAddr,
+			"agent", r.UserAgent())
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	c.setOrigin(wh, origin)
+	wh.Set(header.AccessControlAllowMethods, http.MethodPost)
+	if len(requested) > 0 {
+		wh.Set(header.AccessControlAllowHeaders, strings.Join(requested, ", "))
+	}
+	if c.maxAge != "" {
+		wh.Set(header.AccessControlMaxAge, c.maxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requestedHeaders returns the lower case list of Access-Control-Request-Headers
+func requestedHeaders(r *http.Request) []string {
+	var list []string
+	for _, v := range r.Header.Values(header.AccessControlRequestHeaders) {
+		for _, h := range strings.Split(v, ",") {
+			if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+				list = append(list, h)
+			}
+		}
+	}
+	return list
+}
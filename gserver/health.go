@@ -0,0 +1,68 @@
+package gserver
+
+import (
+	"time"
+
+	"github.com/effective-security/xlog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// healthPath is the path of the gRPC health service, allowed in authz
+const healthPath = "/grpc.health.v1.Health"
+
+// startHealth creates the health service, and updates the status
+// of the registered services until the server is closed
+func (e *Server) startHealth() {
+	if e.cfg.Health.GetDisabled() {
+		return
+	}
+	e.health = health.NewServer()
+	e.updateHealth()
+
+	if e.authz != nil {
+		e.authz.AllowAny(healthPath)
+	}
+
+	go func() {
+		ticker := time.NewTicker(e.cfg.Health.GetInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-e.stopc:
+				return
+			case <-ticker.C:
+				e.updateHealth()
+			}
+		}
+	}()
+}
+
+// updateHealth reports the readiness of each service,
+// and the overall status of the server with the empty service name
+func (e *Server) updateHealth() {
+	overall := healthpb.HealthCheckResponse_SERVING
+	for name, svc := range e.services {
+		status := healthpb.HealthCheckResponse_SERVING
+		if !svc.IsReady() {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+			overall = status
+		}
+		e.health.SetServingStatus(name, status)
+	}
+	e.health.SetServingStatus("", overall)
+}
+
+// registerHealth registers the health service,
+// unless it's already provided by one of the services
+func (e *Server) registerHealth(gs *grpc.Server) {
+	if e.health == nil {
+		return
+	}
+	if _, ok := gs.GetServiceInfo()[healthpb.Health_ServiceDesc.ServiceName]; ok {
+		logger.KV(xlog.INFO, "status", "health_already_registered", "server", e.Name())
+		return
+	}
+	healthpb.RegisterHealthServer(gs, e.health)
+}
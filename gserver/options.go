@@ -2,7 +2,9 @@ package gserver
 
 import (
 	"net/http"
+	"time"
 
+	"github.com/effective-security/porto/restserver/telemetry"
 	"google.golang.org/grpc"
 )
 
@@ -36,10 +38,65 @@ func WithStreamServerInterceptor(other grpc.StreamServerInterceptor) Option {
 	})
 }
 
+// WithShutdownTimeout option to provide the deadline to drain
+// in-flight requests on Close, overrides Shutdown.Timeout config
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return newFuncOption(func(o *options) {
+		o.shutdownTimeout = timeout
+	})
+}
+
+// WithGRPCRateLimiter option to provide the limiter of gRPC calls,
+// for example backed by Redis, to share the limits between the instances
+func WithGRPCRateLimiter(l GRPCRateLimiter) Option {
+	return newFuncOption(func(o *options) {
+		o.grpcRateLimiter = l
+	})
+}
+
+// WithAccessLogSink option to provide the sink of the access log,
+// overrides AccessLog config
+func WithAccessLogSink(sink telemetry.AccessLogSink) Option {
+	return newFuncOption(func(o *options) {
+		o.accessLogSink = sink
+	})
+}
+
+// WithShutdownListener option to provide the callback,
+// that receives the report when the server is shut down
+func WithShutdownListener(l func(*ShutdownReport)) Option {
+	return newFuncOption(func(o *options) {
+		o.shutdownListeners = append(o.shutdownListeners, l)
+	})
+}
+
+// WithSecurityEvents option to provide the callbacks for authn/authz anomalies,
+// enables the security events regardless of SecurityEvents config
+func WithSecurityEvents(events SecurityEvents) Option {
+	return newFuncOption(func(o *options) {
+		o.securityEvents = events
+	})
+}
+
+// WithCrashReporter option to provide the callback,
+// that is called when a panic is recovered in HTTP handler
+func WithCrashReporter(f CrashReporter) Option {
+	return newFuncOption(func(o *options) {
+		o.crashReporter = f
+	})
+}
+
 type options struct {
-	handlers []Middleware
-	unary    []grpc.UnaryServerInterceptor
-	stream   []grpc.StreamServerInterceptor
+	handlers        []Middleware
+	unary           []grpc.UnaryServerInterceptor
+	stream          []grpc.StreamServerInterceptor
+	shutdownTimeout time.Duration
+	grpcRateLimiter GRPCRateLimiter
+	accessLogSink   telemetry.AccessLogSink
+
+	shutdownListeners []func(*ShutdownReport)
+	securityEvents    SecurityEvents
+	crashReporter     CrashReporter
 }
 
 type funcOption struct {
@@ -0,0 +1,50 @@
+package gserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// quicScheme is the scheme of the listen URL,
+// to serve HTTP/3 on the UDP port in addition to HTTPS
+const quicScheme = "https+quic"
+
+// serveQUIC starts the experimental HTTP/3 server on the UDP port of the listener address.
+// The REST and gRPC-Web requests are served, the native gRPC requires HTTP/2.
+func (sctx *serveCtx) serveQUIC(s *Server, handler http.Handler, errHandler func(error)) (*http3.Server, net.PacketConn, error) {
+	udp, err := net.ListenPacket("udp", sctx.addr)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	srv := &http3.Server{
+		Handler:        handler,
+		TLSConfig:      http3.ConfigureTLSConfig(sctx.tlsInfo.Config()),
+		MaxHeaderBytes: s.cfg.MaxHeaderBytes,
+	}
+
+	logger.KV(xlog.NOTICE,
+		"status", "listen",
+		"network", "udp",
+		"address", udp.LocalAddr().String(),
+		"proto", "h3")
+
+	go func() { errHandler(srv.Serve(udp)) }()
+	return srv, udp, nil
+}
+
+// altSvcHandler returns the handler,
+// that advertises HTTP/3 on the port with Alt-Svc header
+func altSvcHandler(port int, handler http.Handler) http.Handler {
+	altSvc := fmt.Sprintf(`h3=":%d"; ma=86400`, port)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(header.AltSvc, altSvc)
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,196 @@
+package gserver
+
+import (
+	"context"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/didip/tollbooth/v7"
+	"github.com/didip/tollbooth/v7/limiter"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/porto/xhttp/identity"
+	"github.com/effective-security/xlog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// GRPCRateLimiter limits the rate of gRPC calls per key.
+// The in-memory limiter is used by default,
+// use WithGRPCRateLimiter to share the limits between the instances,
+// for example with Redis.
+type GRPCRateLimiter interface {
+	// Allow returns false and the delay before the retry,
+	// if the number of calls per second for the key exceeds the limit
+	Allow(ctx context.Context, key string, limit float64) (bool, time.Duration, error)
+}
+
+// NewGRPCRateLimiter returns in-memory GRPCRateLimiter,
+// the token buckets expire after ttl, default 10 mins
+func NewGRPCRateLimiter(ttl time.Duration) GRPCRateLimiter {
+	if ttl == 0 {
+		ttl = 10 * time.Minute
+	}
+	return &memoryRateLimiter{
+		ttl:      ttl,
+		limiters: map[float64]*limiter.Limiter{},
+	}
+}
+
+type memoryRateLimiter struct {
+	ttl time.Duration
+
+	lock     sync.Mutex
+	limiters map[float64]*limiter.Limiter
+}
+
+func (l *memoryRateLimiter) Allow(_ context.Context, key string, limit float64) (bool, time.Duration, error) {
+	l.lock.Lock()
+	lmt := l.limiters[limit]
+	if lmt == nil {
+		lmt = tollbooth.NewLimiter(limit, &limiter.ExpirableOptions{
+			DefaultExpirationTTL: l.ttl,
+		})
+		l.limiters[limit] = lmt
+	}
+	l.lock.Unlock()
+
+	if lmt.LimitReached(key) {
+		return false, retryAfter(limit), nil
+	}
+	return true, 0, nil
+}
+
+// retryAfter returns the time until a token is available in the bucket
+func retryAfter(rps float64) time.Duration {
+	if rps > 0 && rps < 1 {
+		return time.Duration(float64(time.Second) / rps)
+	}
+	return time.Second
+}
+
+type grpcRateLimit struct {
+	cfg      *GRPCRateLimit
+	limiter  GRPCRateLimiter
+	security *securityMonitor
+}
+
+func newGRPCRateLimit(cfg *GRPCRateLimit, l GRPCRateLimiter, security *securityMonitor) *grpcRateLimit {
+	if !cfg.GetEnabled() {
+		return nil
+	}
+	logger.KV(xlog.NOTICE, "GRPCRateLimit", "enabled")
+
+	if l == nil {
+		l = NewGRPCRateLimiter(cfg.ExpirationTTL)
+	}
+	return &grpcRateLimit{
+		cfg:      cfg,
+		limiter:  l,
+		security: security,
+	}
+}
+
+// limit returns the limit for the method and role,
+// the limits of the method or its service take precedence over the role
+func (r *grpcRateLimit) limit(method, role string) float64 {
+	if l, ok := r.cfg.Methods[method]; ok {
+		return l
+	}
+	if i := strings.LastIndex(method, "/"); i > 0 {
+		if l, ok := r.cfg.Methods[method[:i]]; ok {
+			return l
+		}
+	}
+	if l, ok := r.cfg.Roles[role]; ok {
+		return l
+	}
+	return r.cfg.RequestsPerSecond
+}
+
+// check returns httperror.CodeRateLimitExceeded error,
+// if the limit for the method and identity is reached
+func (r *grpcRateLimit) check(ctx context.Context, method string, id identity.Identity) error {
+	role := id.Role()
+	limit := r.limit(method, role)
+	if limit <= 0 {
+		return nil
+	}
+
+	key := method + "|" + role
+	if !r.cfg.ByRole {
+		subject := id.Subject()
+		if subject == "" {
+			subject = peerIP(ctx)
+		}
+		key += "|" + subject
+	}
+
+	allowed, delay, err := r.limiter.Allow(ctx, key, limit)
+	if err != nil {
+		// the failure of the limiter must not fail the call
+		logger.ContextKV(ctx, xlog.ERROR,
+			"reason", "rate_limiter",
+			"method", method,
+			"err", err.Error())
+		return nil
+	}
+	if allowed {
+		return nil
+	}
+
+	logger.ContextKV(ctx, xlog.WARNING,
+		"reason", "rate_limit_exceeded",
+		"method", method,
+		"role", role)
+	r.security.rateLimited(ctx, "grpc", method, "", id)
+
+	_ = grpc.SetHeader(ctx, metadata.Pairs(header.RetryAfter,
+		strconv.Itoa(int(math.Ceil(delay.Seconds())))))
+
+	return httperror.RateLimitExceeded("rate limit exceeded").
+		WithContext(ctx).
+		WithRetryAfter(delay)
+}
+
+func (r *grpcRateLimit) unaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := r.check(ctx, info.FullMethod, identity.FromContext(ctx).Identity()); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// streamInterceptor resolves the identity of the stream,
+// as the identity interceptor is applied to the unary calls only
+func (r *grpcRateLimit) streamInterceptor(s *Server) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+		id := identity.FromContext(ctx).Identity()
+		if sid, err := s.identity.IdentityFromContext(ctx, info.FullMethod); err == nil && sid != nil {
+			id = sid
+		}
+		if err := r.check(ctx, info.FullMethod, id); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -0,0 +1,97 @@
+package gserver
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/effective-security/porto/x/safecall"
+	"github.com/effective-security/porto/xhttp/marshal"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+// CrashReporter is called when a panic is recovered in HTTP handler,
+// for example to send the report with the stack to the error tracking service.
+// The callback is called after the response is written, on the request path.
+type CrashReporter func(r *http.Request, pe *safecall.PanicError)
+
+// configureRecovery returns the handler, that recovers a panic in HTTP handlers,
+// logs the stack, and responds with 500 status
+func configureRecovery(s *Server, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoveryWriter{ResponseWriter: w}
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				// the response is aborted intentionally
+				panic(rec)
+			}
+
+			ctx := r.Context()
+			err := safecall.Recovered(ctx, "http", rec)
+			logger.ContextKV(ctx, xlog.ERROR,
+				"reason", "panic",
+				"method", r.Method,
+				"url", s.redactor.URL(r.URL))
+
+			if rw.wroteHeader {
+				// the partial response can not be replaced,
+				// abort the connection so the client does not accept it
+				s.reportCrash(r, err)
+				panic(http.ErrAbortHandler)
+			}
+			marshal.WriteJSON(w, r, err)
+			s.reportCrash(r, err)
+		}()
+		handler.ServeHTTP(rw, r)
+	})
+}
+
+// reportCrash calls CrashReporter, if provided by WithCrashReporter option
+func (s *Server) reportCrash(r *http.Request, err error) {
+	if s.opts.crashReporter == nil {
+		return
+	}
+	var pe *safecall.PanicError
+	if !errors.As(err, &pe) {
+		return
+	}
+	_ = safecall.Call(r.Context(), "crash_reporter", func(context.Context) error {
+		s.opts.crashReporter(r, pe)
+		return nil
+	})
+}
+
+// recoveryWriter tracks if the response is started
+type recoveryWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+// WriteHeader proxy
+func (w *recoveryWriter) WriteHeader(statusCode int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write proxy
+func (w *recoveryWriter) Write(data []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush proxy
+func (w *recoveryWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		f.Flush()
+	}
+}
+
+// Unwrap returns the original writer for http.ResponseController
+func (w *recoveryWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,108 @@
+package roles
+
+import (
+	"context"
+	"crypto/sha256"
+	"time"
+
+	"github.com/effective-security/porto/metricskey"
+	"github.com/effective-security/porto/x/clock"
+	"github.com/effective-security/porto/xhttp/identity"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultIdentityCacheSize specifies the default number of cached identities
+	DefaultIdentityCacheSize = 10000
+	// DefaultIdentityCacheClockSkew specifies the default time before the token expiry,
+	// when the cached identity is evicted
+	DefaultIdentityCacheClockSkew = 30 * time.Second
+)
+
+type cachedIdentity struct {
+	id        identity.Identity
+	expiresAt time.Time
+}
+
+// identityCache caches the identities of the verified JWT,
+// keyed by the token hash, until the token expiry
+type identityCache struct {
+	cache     *lru.Cache[[sha256.Size]byte, *cachedIdentity]
+	clockSkew time.Duration
+	clock     clock.Clock
+}
+
+func newIdentityCache(cfg *IdentityCacheConfig, clk clock.Clock) (*identityCache, error) {
+	size := cfg.Size
+	if size <= 0 {
+		size = DefaultIdentityCacheSize
+	}
+	skew := cfg.ClockSkew
+	if skew <= 0 {
+		skew = DefaultIdentityCacheClockSkew
+	}
+	cache, err := lru.New[[sha256.Size]byte, *cachedIdentity](size)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &identityCache{
+		cache:     cache,
+		clockSkew: skew,
+		clock:     clk,
+	}, nil
+}
+
+func identityCacheKey(auth, tokenType string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(tokenType + " " + auth))
+}
+
+// get returns the cached identity, if not expired
+func (c *identityCache) get(key [sha256.Size]byte) identity.Identity {
+	e, ok := c.cache.Get(key)
+	if ok && c.clock.Now().Before(e.expiresAt) {
+		metricskey.IdentityCache.IncrCounter(1, "hit")
+		return e.id
+	}
+	if ok {
+		c.cache.Remove(key)
+	}
+	metricskey.IdentityCache.IncrCounter(1, "miss")
+	return nil
+}
+
+// add caches the identity until the token expiry,
+// the tokens without expiry are not cached
+func (c *identityCache) add(key [sha256.Size]byte, id identity.Identity) {
+	exp := id.Claims().Time("exp")
+	if exp == nil {
+		return
+	}
+	expiresAt := exp.Add(-c.clockSkew)
+	if !c.clock.Now().Before(expiresAt) {
+		return
+	}
+	c.cache.Add(key, &cachedIdentity{id: id, expiresAt: expiresAt})
+}
+
+// cachedJWTIdentity returns the cached JWT identity,
+// the token revocation is validated on each call
+func (p *provider) cachedJWTIdentity(ctx context.Context, auth, tokenType string) (identity.Identity, error) {
+	key := identityCacheKey(auth, tokenType)
+	if id := p.idCache.get(key); id != nil {
+		if rev := p.jwt.GetRevocation(); rev != nil {
+			if err := rev.Validate(ctx, auth, id.Claims()); err != nil {
+				p.idCache.cache.Remove(key)
+				return nil, errors.WithMessage(err, "unable to parse JWT token")
+			}
+		}
+		return id, nil
+	}
+
+	id, err := p.jwtIdentity(ctx, auth, tokenType)
+	if err != nil {
+		return nil, err
+	}
+	p.idCache.add(key, id)
+	return id, nil
+}
@@ -0,0 +1,117 @@
+package roles_test
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/gserver/roles"
+	"github.com/effective-security/porto/tests/testutils"
+	"github.com/effective-security/xpki/jwt"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingJWT struct {
+	claims     jwt.MapClaims
+	parsed     atomic.Int32
+	revocation jwt.Revocation
+}
+
+func (m *countingJWT) GetRevocation() jwt.Revocation {
+	return m.revocation
+}
+
+func (m *countingJWT) SetRevocation(r jwt.Revocation) {
+	m.revocation = r
+}
+
+func (m *countingJWT) ParseToken(_ context.Context, _ string, _ *jwt.VerifyConfig) (jwt.MapClaims, error) {
+	m.parsed.Add(1)
+	return m.claims, nil
+}
+
+type revoked struct {
+	token string
+}
+
+func (r *revoked) Validate(_ context.Context, token string, _ jwt.MapClaims) error {
+	if token == r.token {
+		return errors.New("token revoked")
+	}
+	return nil
+}
+
+func (r *revoked) Revoke(_ context.Context, token string, _ jwt.MapClaims) error {
+	r.token = token
+	return nil
+}
+
+func TestJWTIdentityCache(t *testing.T) {
+	now := time.Now()
+	clk := testutils.NewClock(now)
+
+	mock := &countingJWT{
+		claims: jwt.MapClaims{
+			"sub":   "12234",
+			"email": "denis@trusty.com",
+			"exp":   now.Add(time.Minute).Unix(),
+		},
+	}
+	p, err := roles.New(&roles.IdentityMap{
+		Strict: true,
+		JWT: roles.JWTIdentityMap{
+			Enabled:                  true,
+			DefaultAuthenticatedRole: "jwt_authenticated",
+		},
+		JWTCache: &roles.IdentityCacheConfig{
+			Size:      10,
+			ClockSkew: 10 * time.Second,
+		},
+	}, mock, roles.WithClock(clk))
+	require.NoError(t, err)
+
+	identityFor := func(token string) error {
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		setAuthorizationHeader(r, token)
+		id, err := p.IdentityFromRequest(r)
+		if err != nil {
+			return err
+		}
+		assert.Equal(t, "jwt_authenticated", id.Role())
+		assert.Equal(t, "12234", id.Subject())
+		return nil
+	}
+
+	require.NoError(t, identityFor("token1"))
+	require.NoError(t, identityFor("token1"))
+	assert.Equal(t, int32(1), mock.parsed.Load(), "cached")
+
+	require.NoError(t, identityFor("token2"))
+	assert.Equal(t, int32(2), mock.parsed.Load(), "different token")
+
+	// evicted before the expiry with the clock skew
+	clk.Advance(50 * time.Second)
+	require.NoError(t, identityFor("token1"))
+	assert.Equal(t, int32(3), mock.parsed.Load(), "expired")
+
+	// revocation is validated for the cached identity
+	clk.Set(now)
+	require.NoError(t, identityFor("token3"))
+	rev := &revoked{}
+	mock.SetRevocation(rev)
+	require.NoError(t, rev.Revoke(context.Background(), "token3", nil))
+	err = identityFor("token3")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "token revoked")
+
+	// tokens without expiry are not cached
+	delete(mock.claims, "exp")
+	parsed := mock.parsed.Load()
+	require.NoError(t, identityFor("token4"))
+	require.NoError(t, identityFor("token4"))
+	assert.Equal(t, parsed+2, mock.parsed.Load())
+}
@@ -1,5 +1,7 @@
 package roles
 
+import "time"
+
 // IdentityMap contains configuration for the roles
 type IdentityMap struct {
 	// DebugLogs allows to add extra debog logs
@@ -16,6 +18,22 @@ type IdentityMap struct {
 	DPoP JWTIdentityMap `json:"jwt_dpop" yaml:"jwt_dpop"`
 	// AWS identity map
 	AWS AWSIdentityMap `json:"aws" yaml:"aws"`
+	// Introspection identity map for opaque tokens
+	Introspection IntrospectionIdentityMap `json:"introspection" yaml:"introspection"`
+	// JWTCache allows to cache the identities of verified JWT,
+	// if not set, each token is verified on every request
+	JWTCache *IdentityCacheConfig `json:"jwt_cache,omitempty" yaml:"jwt_cache,omitempty"`
+}
+
+// IdentityCacheConfig provides configuration for the identity cache
+type IdentityCacheConfig struct {
+	// Size specifies the maximum number of cached identities,
+	// default is DefaultIdentityCacheSize
+	Size int `json:"size,omitempty" yaml:"size,omitempty"`
+	// ClockSkew specifies the time before the token expiry,
+	// when the cached identity is evicted,
+	// default is DefaultIdentityCacheClockSkew
+	ClockSkew time.Duration `json:"clock_skew,omitempty" yaml:"clock_skew,omitempty"`
 }
 
 // GenericIdentityMap provides roles mapping
@@ -63,3 +81,44 @@ type JWTIdentityMap struct {
 	// Roles is a map of role to JWT identity
 	Roles map[string][]string `json:"roles" yaml:"roles"`
 }
+
+// IntrospectionIdentityMap provides configuration for identities of opaque tokens,
+// validated by RFC 7662 introspection endpoint
+type IntrospectionIdentityMap struct {
+	// DefaultAuthenticatedRole specifies role name for identity, if not found in maps
+	DefaultAuthenticatedRole string `json:"default_authenticated_role" yaml:"default_authenticated_role"`
+	// Enable introspection identities
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// URL of the introspection endpoint
+	URL string `json:"url" yaml:"url"`
+	// ClientID and ClientSecret are used for Basic auth to the introspection endpoint
+	ClientID     string `json:"client_id,omitempty" yaml:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty" yaml:"client_secret,omitempty"`
+	// ActiveTTL specifies the cache TTL for active tokens,
+	// limited by the token expiry, default is DefaultIntrospectionActiveTTL
+	ActiveTTL time.Duration `json:"active_ttl,omitempty" yaml:"active_ttl,omitempty"`
+	// InactiveTTL specifies the cache TTL for inactive tokens,
+	// default is DefaultIntrospectionInactiveTTL
+	InactiveTTL time.Duration `json:"inactive_ttl,omitempty" yaml:"inactive_ttl,omitempty"`
+	// CacheSize specifies the maximum number of cached tokens,
+	// default is DefaultIntrospectionCacheSize
+	CacheSize int `json:"cache_size,omitempty" yaml:"cache_size,omitempty"`
+	// FailOpen allows to fall back to other methods, or guest,
+	// when the introspection endpoint is unavailable,
+	// by default the request is rejected
+	FailOpen bool `json:"fail_open,omitempty" yaml:"fail_open,omitempty"`
+	// SubjectClaim specifies claim name to be used as Subject,
+	// by default it's `sub`
+	SubjectClaim string `json:"subject_claim" yaml:"subject_claim"`
+	// RoleClaim specifies claim name to be used for role mapping,
+	// by default it's `email`
+	RoleClaim string `json:"role_claim" yaml:"role_claim"`
+	// TenantClaim specifies claim name to be used for tenant mapping,
+	// by default it's `tenant`
+	TenantClaim string `json:"tenant_claim" yaml:"tenant_claim"`
+	// Roles is a map of role to RoleClaim values
+	Roles map[string][]string `json:"roles" yaml:"roles"`
+	// ScopeRoles is a map of role to scopes,
+	// used if RoleClaim is not mapped
+	ScopeRoles map[string][]string `json:"scope_roles" yaml:"scope_roles"`
+}
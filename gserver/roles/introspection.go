@@ -0,0 +1,222 @@
+package roles
+
+import (
+	"context"
+	"crypto/sha256"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/effective-security/porto/metricskey"
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/x/clock"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/identity"
+	"github.com/effective-security/x/values"
+	"github.com/effective-security/xlog"
+	"github.com/effective-security/xpki/jwt"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultIntrospectionActiveTTL specifies the default TTL for active tokens
+	DefaultIntrospectionActiveTTL = 5 * time.Minute
+	// DefaultIntrospectionInactiveTTL specifies the default TTL for inactive tokens
+	DefaultIntrospectionInactiveTTL = time.Minute
+	// DefaultIntrospectionCacheSize specifies the default number of cached tokens
+	DefaultIntrospectionCacheSize = 10000
+)
+
+// ErrIntrospectionUnavailable is returned when the introspection endpoint
+// can not be reached, or responds with server error
+var ErrIntrospectionUnavailable = errors.New("token introspection is unavailable")
+
+// introspector validates opaque tokens with RFC 7662 introspection endpoint
+type introspector struct {
+	cfg    IntrospectionIdentityMap
+	client *retriable.Client
+	roles  map[string]string
+	scopes map[string]string
+	cache  *lru.Cache[[sha256.Size]byte, *cachedIdentity]
+	clock  clock.Clock
+}
+
+func newIntrospector(cfg IntrospectionIdentityMap, clk clock.Clock) (*introspector, error) {
+	if cfg.URL == "" {
+		return nil, errors.Errorf("introspection: URL is required")
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, errors.Errorf("introspection: invalid URL: %q", cfg.URL)
+	}
+
+	cfg.SubjectClaim = values.StringsCoalesce(cfg.SubjectClaim, DefaultSubjectClaim)
+	cfg.RoleClaim = values.StringsCoalesce(cfg.RoleClaim, DefaultRoleClaim)
+	cfg.TenantClaim = values.StringsCoalesce(cfg.TenantClaim, DefaultTenantClaim)
+	if cfg.ActiveTTL <= 0 {
+		cfg.ActiveTTL = DefaultIntrospectionActiveTTL
+	}
+	if cfg.InactiveTTL <= 0 {
+		cfg.InactiveTTL = DefaultIntrospectionInactiveTTL
+	}
+	size := cfg.CacheSize
+	if size <= 0 {
+		size = DefaultIntrospectionCacheSize
+	}
+
+	// the identity is resolved in the request path, limit the retries
+	client, err := retriable.New(retriable.ClientConfig{Host: u.Scheme + "://" + u.Host},
+		retriable.WithName("introspection"),
+		retriable.WithClock(clk),
+		retriable.WithPolicy(retriable.Policy{
+			TotalRetryLimit: 1,
+			RequestTimeout:  5 * time.Second,
+			Retries: map[int]retriable.ShouldRetry{
+				0:                             retriable.DefaultShouldRetryFactory(1, 100*time.Millisecond, "connection"),
+				http.StatusServiceUnavailable: retriable.DefaultShouldRetryFactory(1, 100*time.Millisecond, "unavailable"),
+			},
+			NonRetriableErrors: retriable.DefaultNonRetriableErrors,
+		}))
+	if err != nil {
+		return nil, err
+	}
+	cache, err := lru.New[[sha256.Size]byte, *cachedIdentity](size)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	in := &introspector{
+		cfg:    cfg,
+		client: client,
+		roles:  make(map[string]string),
+		scopes: make(map[string]string),
+		cache:  cache,
+		clock:  clk,
+	}
+	for role, users := range cfg.Roles {
+		for _, user := range users {
+			in.roles[user] = role
+		}
+	}
+	for role, scopes := range cfg.ScopeRoles {
+		for _, scope := range scopes {
+			in.scopes[scope] = role
+		}
+	}
+	return in, nil
+}
+
+// identity returns the identity of the token,
+// the active and inactive results are cached
+func (in *introspector) identity(ctx context.Context, token, tokenType string) (identity.Identity, error) {
+	key := sha256.Sum256([]byte(token))
+	if e, ok := in.cache.Get(key); ok {
+		if in.clock.Now().Before(e.expiresAt) {
+			metricskey.IdentityCache.IncrCounter(1, "hit")
+			if e.id == nil {
+				return nil, errors.New("token is not active")
+			}
+			return e.id, nil
+		}
+		in.cache.Remove(key)
+	}
+	metricskey.IdentityCache.IncrCounter(1, "miss")
+
+	claims, err := in.introspect(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	now := in.clock.Now()
+	if !claims.Bool("active") {
+		in.cache.Add(key, &cachedIdentity{expiresAt: now.Add(in.cfg.InactiveTTL)})
+		return nil, errors.New("token is not active")
+	}
+
+	expiresAt := now.Add(in.cfg.ActiveTTL)
+	if exp := claims.Time("exp"); exp != nil {
+		if !now.Before(*exp) {
+			return nil, errors.New("token has expired")
+		}
+		if exp.Before(expiresAt) {
+			expiresAt = *exp
+		}
+	}
+
+	id := in.mapIdentity(claims, token, tokenType)
+	in.cache.Add(key, &cachedIdentity{id: id, expiresAt: expiresAt})
+	return id, nil
+}
+
+func (in *introspector) introspect(ctx context.Context, token string) (jwt.MapClaims, error) {
+	form := url.Values{
+		"token":           {token},
+		"token_type_hint": {"access_token"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, in.cfg.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set(header.ContentType, header.ApplicationFormURLEncoded)
+	req.Header.Set(header.Accept, header.ApplicationJSON)
+	if in.cfg.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(in.cfg.ClientID), url.QueryEscape(in.cfg.ClientSecret))
+	}
+
+	resp, err := in.client.Do(req)
+	if err != nil {
+		logger.ContextKV(ctx, xlog.ERROR, "reason", "introspection", "err", err.Error())
+		return nil, errors.WithMessage(ErrIntrospectionUnavailable, err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		logger.ContextKV(ctx, xlog.ERROR, "reason", "introspection", "status", resp.StatusCode)
+		return nil, errors.WithMessagef(ErrIntrospectionUnavailable, "status %d", resp.StatusCode)
+	}
+
+	var claims jwt.MapClaims
+	if _, _, err = in.client.DecodeResponse(resp, &claims); err != nil {
+		return nil, errors.WithMessage(err, "unable to introspect token")
+	}
+	return claims, nil
+}
+
+func (in *introspector) mapIdentity(claims jwt.MapClaims, token, tokenType string) identity.Identity {
+	subj := claims.String(in.cfg.SubjectClaim)
+	tenant := claims.String(in.cfg.TenantClaim)
+	role := in.roles[claims.String(in.cfg.RoleClaim)]
+	if role == "" {
+		for _, scope := range strings.Fields(claims.String("scope")) {
+			if role = in.scopes[scope]; role != "" {
+				break
+			}
+		}
+	}
+	role = values.StringsCoalesce(role, in.cfg.DefaultAuthenticatedRole)
+
+	logger.KV(xlog.DEBUG,
+		"role", role,
+		"tenant", tenant,
+		"subject", subj,
+		"type", tokenType)
+	return identity.NewIdentity(role, subj, tenant, claims, token, tokenType)
+}
+
+// introspectionIdentity returns the identity of the opaque token,
+// the second value is true if the error must not fall back to other methods
+func (p *provider) introspectionIdentity(ctx context.Context, token, tokenType string) (identity.Identity, bool, error) {
+	id, err := p.introspector.identity(ctx, token, tokenType)
+	if err != nil {
+		failClosed := !p.config.Introspection.FailOpen && errors.Is(err, ErrIntrospectionUnavailable)
+		return nil, failClosed, err
+	}
+	return id, false, nil
+}
+
+// isJWT returns true if the token has JWT format
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
@@ -0,0 +1,153 @@
+package roles_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/gserver/roles"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+type introspectionServer struct {
+	calls  atomic.Int32
+	status atomic.Int32
+}
+
+func (s *introspectionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.calls.Add(1)
+	if status := s.status.Load(); status != 0 {
+		w.WriteHeader(int(status))
+		return
+	}
+	user, pass, _ := r.BasicAuth()
+	if user != "client" || pass != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var res map[string]any
+	switch r.PostFormValue("token") {
+	case "admin-token":
+		res = map[string]any{
+			"active": true,
+			"sub":    "admin@trusty.com",
+			"email":  "admin@trusty.com",
+			"tenant": "t1",
+			"exp":    time.Now().Add(time.Hour).Unix(),
+		}
+	case "scoped-token":
+		res = map[string]any{
+			"active": true,
+			"sub":    "svc",
+			"scope":  "read write",
+		}
+	default:
+		res = map[string]any{"active": false}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func TestIntrospection(t *testing.T) {
+	srv := &introspectionServer{}
+	server := httptest.NewServer(srv)
+	defer server.Close()
+
+	cfg := &roles.IdentityMap{
+		Introspection: roles.IntrospectionIdentityMap{
+			Enabled:                  true,
+			URL:                      server.URL + "/oauth2/introspect",
+			ClientID:                 "client",
+			ClientSecret:             "secret",
+			DefaultAuthenticatedRole: "introspected",
+			Roles: map[string][]string{
+				"admin": {"admin@trusty.com"},
+			},
+			ScopeRoles: map[string][]string{
+				"writer": {"write"},
+			},
+		},
+	}
+
+	_, err := roles.New(&roles.IdentityMap{
+		Introspection: roles.IntrospectionIdentityMap{Enabled: true},
+	}, nil)
+	assert.EqualError(t, err, "introspection: URL is required")
+
+	p, err := roles.New(cfg, nil)
+	require.NoError(t, err)
+
+	identityFor := func(token string) (string, error) {
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		setAuthorizationHeader(r, token)
+		require.True(t, p.ApplicableForRequest(r))
+		id, err := p.IdentityFromRequest(r)
+		if err != nil {
+			return "", err
+		}
+		return id.Role(), nil
+	}
+
+	role, err := identityFor("admin-token")
+	require.NoError(t, err)
+	assert.Equal(t, "admin", role)
+
+	role, err = identityFor("admin-token")
+	require.NoError(t, err)
+	assert.Equal(t, "admin", role)
+	assert.Equal(t, int32(1), srv.calls.Load(), "active token is cached")
+
+	role, err = identityFor("scoped-token")
+	require.NoError(t, err)
+	assert.Equal(t, "writer", role)
+
+	// inactive token falls back to guest in non-strict mode
+	role, err = identityFor("revoked-token")
+	require.NoError(t, err)
+	assert.Equal(t, roles.GuestRoleName, role)
+	calls := srv.calls.Load()
+	_, _ = identityFor("revoked-token")
+	assert.Equal(t, calls, srv.calls.Load(), "inactive token is cached")
+
+	// gRPC
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer scoped-token"))
+	require.True(t, p.ApplicableForContext(ctx))
+	id, err := p.IdentityFromContext(ctx, "/test")
+	require.NoError(t, err)
+	assert.Equal(t, "writer", id.Role())
+	assert.Equal(t, "svc", id.Subject())
+
+	// unavailable: fail closed
+	srv.status.Store(http.StatusInternalServerError)
+	_, err = identityFor("new-token")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), roles.ErrIntrospectionUnavailable.Error())
+
+	// cached tokens are still served
+	role, err = identityFor("admin-token")
+	require.NoError(t, err)
+	assert.Equal(t, "admin", role)
+
+	// unavailable: fail open
+	cfg.Introspection.FailOpen = true
+	p, err = roles.New(cfg, nil)
+	require.NoError(t, err)
+	role, err = identityFor("new-token")
+	require.NoError(t, err)
+	assert.Equal(t, roles.GuestRoleName, role)
+
+	// strict mode rejects inactive tokens
+	srv.status.Store(0)
+	cfg.Strict = true
+	p, err = roles.New(cfg, nil)
+	require.NoError(t, err)
+	_, err = identityFor("revoked-token")
+	assert.EqualError(t, err, "token is not active")
+}
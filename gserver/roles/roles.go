@@ -13,6 +13,7 @@ import (
 	"time"
 
 	tcredentials "github.com/effective-security/porto/gserver/credentials"
+	"github.com/effective-security/porto/x/clock"
 	"github.com/effective-security/porto/xhttp/header"
 	"github.com/effective-security/porto/xhttp/identity"
 	"github.com/effective-security/x/slices"
@@ -58,19 +59,28 @@ const (
 	awsTokenType = "AWS4"
 )
 
-// IdentityProvider interface to extract identity from requests
-type IdentityProvider interface {
+// RequestIdentityProvider interface to extract identity from HTTP requests
+type RequestIdentityProvider interface {
 	// ApplicableForRequest returns true if the provider is applicable for the request
 	ApplicableForRequest(*http.Request) bool
 	// IdentityFromRequest returns identity from the request
 	IdentityFromRequest(*http.Request) (identity.Identity, error)
+}
 
+// ContextIdentityProvider interface to extract identity from gRPC context
+type ContextIdentityProvider interface {
 	// ApplicableForContext returns true if the provider is applicable for the request
 	ApplicableForContext(ctx context.Context) bool
 	// IdentityFromContext returns identity from the request
 	IdentityFromContext(ctx context.Context, uri string) (identity.Identity, error)
 }
 
+// IdentityProvider interface to extract identity from requests
+type IdentityProvider interface {
+	RequestIdentityProvider
+	ContextIdentityProvider
+}
+
 // Provider for identity
 type provider struct {
 	config    IdentityMap
@@ -81,10 +91,40 @@ type provider struct {
 	jwt       jwt.Parser
 
 	awsCache *expirable.LRU[string, *CallerIdentity]
+	idCache  *identityCache
+
+	introspector *introspector
+	clock        clock.Clock
+}
+
+// Option configures the identity provider
+type Option interface {
+	apply(*provider)
+}
+
+type funcOption struct {
+	f func(*provider)
+}
+
+func (fo *funcOption) apply(p *provider) {
+	fo.f(p)
+}
+
+func newFuncOption(f func(*provider)) *funcOption {
+	return &funcOption{
+		f: f,
+	}
+}
+
+// WithClock specifies the time source of the token expiry checks
+func WithClock(c clock.Clock) Option {
+	return newFuncOption(func(p *provider) {
+		p.clock = clock.OrSystem(c)
+	})
 }
 
 // New returns Authz provider instance
-func New(config *IdentityMap, jwt jwt.Parser) (IdentityProvider, error) {
+func New(config *IdentityMap, jwt jwt.Parser, ops ...Option) (IdentityProvider, error) {
 	prov := &provider{
 		config:    *config,
 		dpopRoles: make(map[string]string),
@@ -93,6 +133,10 @@ func New(config *IdentityMap, jwt jwt.Parser) (IdentityProvider, error) {
 		awsRoles:  make(map[string]string),
 		jwt:       jwt,
 		awsCache:  expirable.NewLRU[string, *CallerIdentity](100, nil, tcredentials.CacheTTL),
+		clock:     clock.System,
+	}
+	for _, op := range ops {
+		op.apply(prov)
 	}
 
 	if config.AWS.Enabled {
@@ -130,6 +174,21 @@ func New(config *IdentityMap, jwt jwt.Parser) (IdentityProvider, error) {
 				prov.jwtRoles[user] = role
 			}
 		}
+
+		if config.JWTCache != nil {
+			cache, err := newIdentityCache(config.JWTCache, prov.clock)
+			if err != nil {
+				return nil, err
+			}
+			prov.idCache = cache
+		}
+	}
+	if config.Introspection.Enabled {
+		in, err := newIntrospector(config.Introspection, prov.clock)
+		if err != nil {
+			return nil, err
+		}
+		prov.introspector = in
 	}
 	if config.TLS.Enabled {
 		for role, users := range config.TLS.Roles {
@@ -144,7 +203,7 @@ func New(config *IdentityMap, jwt jwt.Parser) (IdentityProvider, error) {
 
 // ApplicableForRequest returns true if the provider is applicable for the request
 func (p *provider) ApplicableForRequest(r *http.Request) bool {
-	if (p.config.AWS.Enabled || p.config.DPoP.Enabled || p.config.JWT.Enabled) &&
+	if (p.config.AWS.Enabled || p.config.DPoP.Enabled || p.config.JWT.Enabled || p.config.Introspection.Enabled) &&
 		r.Header.Get(header.Authorization) != "" {
 		return true
 	}
@@ -160,7 +219,7 @@ func (p *provider) ApplicableForContext(ctx context.Context) bool {
 	md, ok := metadata.FromIncomingContext(ctx)
 	authorization := ok && len(md["authorization"]) > 0
 
-	if authorization && (p.config.AWS.Enabled || p.config.DPoP.Enabled || p.config.JWT.Enabled) {
+	if authorization && (p.config.AWS.Enabled || p.config.DPoP.Enabled || p.config.JWT.Enabled || p.config.Introspection.Enabled) {
 		return true
 	}
 
@@ -236,8 +295,9 @@ func (p *provider) IdentityFromRequest(r *http.Request) (identity.Identity, erro
 		logger.ContextKV(ctx, xlog.DEBUG, "reason", "dpopIdentity", "err", err.Error())
 	}
 
-	if p.config.JWT.Enabled && strings.EqualFold(typ, "Bearer") {
-		id, err = p.jwtIdentity(r.Context(), token, typ)
+	if p.config.JWT.Enabled && strings.EqualFold(typ, "Bearer") &&
+		(p.introspector == nil || isJWT(token)) {
+		id, err = p.jwtIdentityFor(r.Context(), token, typ)
 		if err == nil {
 			return id, nil
 		} else if p.config.Strict {
@@ -246,6 +306,17 @@ func (p *provider) IdentityFromRequest(r *http.Request) (identity.Identity, erro
 		logger.ContextKV(ctx, xlog.DEBUG, "reason", "jwtIdentity", "err", err.Error())
 	}
 
+	if p.introspector != nil && strings.EqualFold(typ, "Bearer") {
+		var failClosed bool
+		id, failClosed, err = p.introspectionIdentity(ctx, token, typ)
+		if err == nil {
+			return id, nil
+		} else if p.config.Strict || failClosed {
+			return nil, err
+		}
+		logger.ContextKV(ctx, xlog.DEBUG, "reason", "introspectionIdentity", "err", err.Error())
+	}
+
 	if p.config.TLS.Enabled && peers > 0 {
 		id, err = p.tlsIdentity(r.TLS)
 		if err == nil {
@@ -315,8 +386,9 @@ func (p *provider) IdentityFromContext(ctx context.Context, uri string) (identit
 			logger.ContextKV(ctx, xlog.DEBUG, "reason", "dpopIdentity", "err", err.Error())
 		}
 
-		if p.config.JWT.Enabled && typ != "" {
-			id, err := p.jwtIdentity(ctx, token, typ)
+		if p.config.JWT.Enabled && typ != "" &&
+			(p.introspector == nil || isJWT(token)) {
+			id, err := p.jwtIdentityFor(ctx, token, typ)
 			if err == nil {
 				return id, nil
 			} else if p.config.Strict {
@@ -324,6 +396,16 @@ func (p *provider) IdentityFromContext(ctx context.Context, uri string) (identit
 			}
 			logger.ContextKV(ctx, xlog.DEBUG, "reason", "jwtIdentity", "err", err.Error())
 		}
+
+		if p.introspector != nil && strings.EqualFold(typ, "Bearer") {
+			id, failClosed, err := p.introspectionIdentity(ctx, token, typ)
+			if err == nil {
+				return id, nil
+			} else if p.config.Strict || failClosed {
+				return nil, err
+			}
+			logger.ContextKV(ctx, xlog.DEBUG, "reason", "introspectionIdentity", "err", err.Error())
+		}
 		logger.ContextKV(ctx, xlog.DEBUG, "reason", "no_token_found")
 	} else {
 		logger.ContextKV(ctx, xlog.DEBUG, "reason", "no_metadata_incoming")
@@ -395,7 +477,7 @@ func (p *provider) dpopIdentity(ctx context.Context, phdr, method, uri string, a
 }
 
 func (p *provider) awsIdentity(ctx context.Context, auth, tokenType string) (identity.Identity, error) {
-	now := time.Now().UTC()
+	now := p.clock.Now().UTC()
 	u, err := base64.RawURLEncoding.DecodeString(auth)
 	if err != nil {
 		return nil, errors.WithMessage(err, "invalid AWS4 token")
@@ -445,7 +527,7 @@ func (p *provider) awsIdentity(ctx context.Context, auth, tokenType string) (ide
 		p.awsCache.Add(url, ci)
 	}
 
-	if ci.Expires.Before(time.Now().UTC()) {
+	if ci.Expires.Before(now) {
 		return nil, errors.Errorf("AWS4 token has expired on %s, now %s", ci.Expires.Format("20060102T150405Z"), now.Format("20060102T150405Z"))
 	}
 
@@ -531,6 +613,14 @@ type CallerIdentity struct {
 	Expires time.Time `json:"-"`
 }
 
+// jwtIdentityFor returns JWT identity, from the cache if enabled
+func (p *provider) jwtIdentityFor(ctx context.Context, auth, tokenType string) (identity.Identity, error) {
+	if p.idCache != nil {
+		return p.cachedJWTIdentity(ctx, auth, tokenType)
+	}
+	return p.jwtIdentity(ctx, auth, tokenType)
+}
+
 func (p *provider) jwtIdentity(ctx context.Context, auth, tokenType string) (identity.Identity, error) {
 	var claims jwt.MapClaims
 	var err error
@@ -575,6 +665,9 @@ func (p *provider) tlsIdentity(TLS *tls.ConnectionState) (identity.Identity, err
 		if len(peer.EmailAddresses) > 0 {
 			claims["email"] = peer.EmailAddresses[0]
 		}
+		if err := addCertClaims(claims, TLS); err != nil {
+			return nil, err
+		}
 		logger.KV(xlog.DEBUG, "spiffe", spiffe, "role", role)
 		return identity.NewIdentity(role, peer.Subject.CommonName, "", claims, "", ""), nil
 	}
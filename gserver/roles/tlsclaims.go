@@ -0,0 +1,127 @@
+package roles
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// AttestationParser parses the value of a custom certificate extension,
+// the returned value is added to the identity claims
+type AttestationParser func(value []byte) (any, error)
+
+type attestation struct {
+	name   string
+	parser AttestationParser
+}
+
+var (
+	attestationsLock sync.RWMutex
+	attestations     = map[string]attestation{}
+)
+
+// RegisterAttestationParser registers the parser for the certificate extension,
+// the parsed value is added to "attestations" claim of TLS identity with the name key
+func RegisterAttestationParser(oid asn1.ObjectIdentifier, name string, parser AttestationParser) {
+	attestationsLock.Lock()
+	defer attestationsLock.Unlock()
+	attestations[oid.String()] = attestation{name: name, parser: parser}
+}
+
+// addCertClaims adds the peer certificate, the issuer chain
+// and the registered attestations to the claims
+func addCertClaims(claims map[string]any, state *tls.ConnectionState) error {
+	peer := state.PeerCertificates[0]
+
+	if peer.SerialNumber != nil {
+		claims["serial"] = peer.SerialNumber.String()
+	}
+	claims["not_before"] = peer.NotBefore.Unix()
+	claims["not_after"] = peer.NotAfter.Unix()
+	if san := sanClaims(peer); len(san) > 0 {
+		claims["san"] = san
+	}
+
+	// use the verified chain if available, the peer chain otherwise
+	chain := state.PeerCertificates
+	if len(state.VerifiedChains) > 0 {
+		chain = state.VerifiedChains[0]
+	}
+	if len(chain) > 1 {
+		issuers := make([]map[string]any, 0, len(chain)-1)
+		for _, c := range chain[1:] {
+			issuer := map[string]any{
+				"sub":       c.Subject.String(),
+				"iss":       c.Issuer.String(),
+				"skid":      hex.EncodeToString(c.SubjectKeyId),
+				"not_after": c.NotAfter.Unix(),
+			}
+			if c.SerialNumber != nil {
+				issuer["serial"] = c.SerialNumber.String()
+			}
+			issuers = append(issuers, issuer)
+		}
+		claims["chain"] = issuers
+	}
+
+	att, err := attestationClaims(peer)
+	if err != nil {
+		return err
+	}
+	if len(att) > 0 {
+		claims["attestations"] = att
+	}
+	return nil
+}
+
+func sanClaims(c *x509.Certificate) map[string]any {
+	san := map[string]any{}
+	if len(c.DNSNames) > 0 {
+		san["dns"] = c.DNSNames
+	}
+	if len(c.EmailAddresses) > 0 {
+		san["email"] = c.EmailAddresses
+	}
+	if len(c.IPAddresses) > 0 {
+		ips := make([]string, len(c.IPAddresses))
+		for i, ip := range c.IPAddresses {
+			ips[i] = ip.String()
+		}
+		san["ip"] = ips
+	}
+	if len(c.URIs) > 0 {
+		uris := make([]string, len(c.URIs))
+		for i, u := range c.URIs {
+			uris[i] = u.String()
+		}
+		san["uri"] = uris
+	}
+	return san
+}
+
+func attestationClaims(c *x509.Certificate) (map[string]any, error) {
+	attestationsLock.RLock()
+	defer attestationsLock.RUnlock()
+
+	if len(attestations) == 0 {
+		return nil, nil
+	}
+
+	res := map[string]any{}
+	for _, ext := range c.Extensions {
+		a, ok := attestations[ext.Id.String()]
+		if !ok {
+			continue
+		}
+		val, err := a.parser(ext.Value)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "unable to parse attestation %q", a.name)
+		}
+		res[a.name] = val
+	}
+	return res, nil
+}
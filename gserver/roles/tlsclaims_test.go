@@ -0,0 +1,147 @@
+package roles_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/gserver/roles"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSChainClaims(t *testing.T) {
+	oid := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+	badOID := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 2}
+	roles.RegisterAttestationParser(oid, "device", func(value []byte) (any, error) {
+		var s string
+		if _, err := asn1.Unmarshal(value, &s); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return s, nil
+	})
+	roles.RegisterAttestationParser(badOID, "broken", func(value []byte) (any, error) {
+		return nil, errors.New("invalid value")
+	})
+
+	p, err := roles.New(&roles.IdentityMap{
+		TLS: roles.GenericIdentityMap{
+			Enabled: true,
+			Roles: map[string][]string{
+				"trusty-client": {"spiffe://trusty/client"},
+			},
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	device, err := asn1.Marshal("tpm-1234")
+	require.NoError(t, err)
+
+	notAfter := time.Now().Add(30 * 24 * time.Hour).Truncate(time.Second)
+	u, _ := url.Parse("spiffe://trusty/client")
+	leaf := &x509.Certificate{
+		SerialNumber:   big.NewInt(101),
+		Subject:        pkix.Name{CommonName: "client"},
+		Issuer:         pkix.Name{CommonName: "issuing-ca"},
+		NotAfter:       notAfter,
+		URIs:           []*url.URL{u},
+		DNSNames:       []string{"client.trusty.com"},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+		EmailAddresses: []string{"client@trusty.com"},
+		Extensions: []pkix.Extension{
+			{Id: oid, Value: device},
+			{Id: asn1.ObjectIdentifier{1, 2, 3}, Value: []byte{0}},
+		},
+	}
+	intermediate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "issuing-ca"},
+		Issuer:       pkix.Name{CommonName: "root-ca"},
+		SubjectKeyId: []byte{1, 2, 3},
+		NotAfter:     notAfter.Add(time.Hour),
+	}
+	root := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "root-ca"},
+		Issuer:       pkix.Name{CommonName: "root-ca"},
+	}
+
+	t.Run("verified_chain", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		r.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{leaf, intermediate},
+			VerifiedChains:   [][]*x509.Certificate{{leaf, intermediate, root}},
+		}
+
+		id, err := p.IdentityFromRequest(r)
+		require.NoError(t, err)
+		assert.Equal(t, "trusty-client", id.Role())
+
+		claims := id.Claims()
+		assert.Equal(t, "101", claims["serial"])
+		assert.Equal(t, notAfter.Unix(), claims["not_after"])
+		assert.Equal(t, map[string]any{
+			"dns":   []string{"client.trusty.com"},
+			"email": []string{"client@trusty.com"},
+			"ip":    []string{"10.0.0.1"},
+			"uri":   []string{"spiffe://trusty/client"},
+		}, claims["san"])
+		assert.Equal(t, map[string]any{"device": "tpm-1234"}, claims["attestations"])
+
+		chain, ok := claims["chain"].([]map[string]any)
+		require.True(t, ok)
+		require.Len(t, chain, 2)
+		assert.Equal(t, "CN=issuing-ca", chain[0]["sub"])
+		assert.Equal(t, "CN=root-ca", chain[0]["iss"])
+		assert.Equal(t, "010203", chain[0]["skid"])
+		assert.Equal(t, notAfter.Add(time.Hour).Unix(), chain[0]["not_after"])
+		assert.Equal(t, "CN=root-ca", chain[1]["sub"])
+
+		ctx := createPeerContext(context.Background(), r.TLS)
+		id, err = p.IdentityFromContext(ctx, "/test")
+		require.NoError(t, err)
+		assert.Equal(t, claims, id.Claims())
+	})
+
+	t.Run("peer_chain", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		r.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{leaf, intermediate},
+		}
+
+		id, err := p.IdentityFromRequest(r)
+		require.NoError(t, err)
+		chain, ok := id.Claims()["chain"].([]map[string]any)
+		require.True(t, ok)
+		require.Len(t, chain, 1)
+		assert.Equal(t, "CN=issuing-ca", chain[0]["sub"])
+	})
+
+	t.Run("invalid_attestation", func(t *testing.T) {
+		bad := *leaf
+		bad.Extensions = []pkix.Extension{{Id: badOID, Value: []byte{0}}}
+		state := &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{&bad},
+		}
+
+		sp, err := roles.New(&roles.IdentityMap{
+			Strict: true,
+			TLS:    roles.GenericIdentityMap{Enabled: true},
+		}, nil)
+		require.NoError(t, err)
+
+		ctx := createPeerContext(context.Background(), state)
+		_, err = sp.IdentityFromContext(ctx, "/test")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `unable to parse attestation "broken": invalid value`)
+	})
+}
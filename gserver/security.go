@@ -0,0 +1,274 @@
+package gserver
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/effective-security/porto/metricskey"
+	"github.com/effective-security/porto/xhttp/identity"
+	"github.com/effective-security/xlog"
+	"google.golang.org/grpc"
+)
+
+// Security events
+const (
+	// EventAuthFailures is reported when the number of failed authentications
+	// from the client reached the threshold
+	EventAuthFailures = "auth_failures"
+	// EventInvalidToken is reported when the identity of the request can not be validated
+	EventInvalidToken = "invalid_token"
+	// EventAuthzDenied is reported when the access is denied by authz
+	EventAuthzDenied = "authz_denied"
+	// EventRateLimited is reported when the request is rejected by the rate limiter
+	EventRateLimited = "rate_limited"
+)
+
+const (
+	defaultAuthFailureThreshold = 5
+	defaultAuthFailureWindow    = time.Minute
+	// maxTrackedClients limits the number of the clients
+	// with the failed authentications before the expired ones are removed
+	maxTrackedClients = 10000
+)
+
+// SecurityEvent describes the authn/authz anomaly
+type SecurityEvent struct {
+	Server string `json:"server"`
+	// Event is one of auth_failures, invalid_token, authz_denied or rate_limited
+	Event string `json:"event"`
+	// Protocol is http or grpc
+	Protocol string `json:"protocol"`
+	// Path is the URL path or gRPC method
+	Path     string `json:"path,omitempty"`
+	ClientIP string `json:"client_ip,omitempty"`
+	Role     string `json:"role,omitempty"`
+	Subject  string `json:"subject,omitempty"`
+	// Reason provides the error of the validation
+	Reason string `json:"reason,omitempty"`
+	// Count is the number of the failed authentications within the window
+	Count int `json:"count,omitempty"`
+}
+
+// SecurityEvents provides callbacks for authn/authz anomalies,
+// for example to forward them to SIEM.
+// The callbacks are called on the request path and must not block.
+type SecurityEvents interface {
+	// OnRepeatedAuthFailures is called when the number of failed authentications
+	// from the client IP reached the threshold within the window
+	OnRepeatedAuthFailures(ctx context.Context, ev *SecurityEvent)
+	// OnTokenInvalid is called when the identity of the request can not be validated
+	OnTokenInvalid(ctx context.Context, ev *SecurityEvent)
+	// OnAuthzDenied is called when the access to the sensitive path is denied
+	OnAuthzDenied(ctx context.Context, ev *SecurityEvent)
+	// OnRateLimited is called when the request is rejected by the rate limiter
+	OnRateLimited(ctx context.Context, ev *SecurityEvent)
+}
+
+// NewSecurityEventsLogger returns SecurityEvents,
+// that logs the events and emits security_events metric
+func NewSecurityEventsLogger() SecurityEvents {
+	return securityEventsLogger{}
+}
+
+type securityEventsLogger struct{}
+
+func (l securityEventsLogger) OnRepeatedAuthFailures(ctx context.Context, ev *SecurityEvent) {
+	l.report(ctx, ev)
+}
+
+func (l securityEventsLogger) OnTokenInvalid(ctx context.Context, ev *SecurityEvent) {
+	l.report(ctx, ev)
+}
+
+func (l securityEventsLogger) OnAuthzDenied(ctx context.Context, ev *SecurityEvent) {
+	l.report(ctx, ev)
+}
+
+func (l securityEventsLogger) OnRateLimited(ctx context.Context, ev *SecurityEvent) {
+	l.report(ctx, ev)
+}
+
+func (l securityEventsLogger) report(ctx context.Context, ev *SecurityEvent) {
+	sv := xlog.WARNING
+	if ev.Event == EventAuthFailures {
+		sv = xlog.ERROR
+	}
+	metricskey.SecurityEvents.IncrCounter(1, ev.Event, ev.Protocol)
+	logger.ContextKV(ctx, sv,
+		"type", "SECURITY_EVENT",
+		"event", ev.Event,
+		"server", ev.Server,
+		"protocol", ev.Protocol,
+		"path", ev.Path,
+		"ip", ev.ClientIP,
+		"role", ev.Role,
+		"subject", ev.Subject,
+		"reason", ev.Reason,
+		"count", ev.Count)
+}
+
+// securityMonitor reports the security events,
+// the methods are no-op on nil monitor
+type securityMonitor struct {
+	server    string
+	threshold int
+	window    time.Duration
+	sensitive []string
+	events    SecurityEvents
+
+	lock     sync.Mutex
+	failures map[string]*authFailures
+}
+
+type authFailures struct {
+	count int
+	since time.Time
+}
+
+// newSecurityMonitor returns nil, if the security events are not enabled
+// and not provided by WithSecurityEvents option
+func newSecurityMonitor(server string, cfg *SecurityEventsCfg, events SecurityEvents) *securityMonitor {
+	if events == nil {
+		if !cfg.GetEnabled() {
+			return nil
+		}
+		events = NewSecurityEventsLogger()
+	}
+
+	m := &securityMonitor{
+		server:    server,
+		threshold: defaultAuthFailureThreshold,
+		window:    defaultAuthFailureWindow,
+		events:    events,
+		failures:  map[string]*authFailures{},
+	}
+	if cfg != nil {
+		if cfg.AuthFailureThreshold > 0 {
+			m.threshold = cfg.AuthFailureThreshold
+		}
+		if cfg.AuthFailureWindow > 0 {
+			m.window = cfg.AuthFailureWindow
+		}
+		m.sensitive = cfg.SensitivePaths
+	}
+	return m
+}
+
+// authFailed reports invalid token, and repeated failures
+// when the threshold is reached for the client IP
+func (m *securityMonitor) authFailed(ctx context.Context, protocol, path, clientIP string, err error) {
+	if m == nil {
+		return
+	}
+	ev := m.newEvent(ctx, EventInvalidToken, protocol, path, clientIP, nil)
+	ev.Reason = err.Error()
+	m.events.OnTokenInvalid(ctx, ev)
+
+	if count := m.countFailure(clientIP); count == m.threshold {
+		rev := *ev
+		rev.Event = EventAuthFailures
+		rev.Count = count
+		m.events.OnRepeatedAuthFailures(ctx, &rev)
+	}
+}
+
+// countFailure returns the number of the failures of the client within the window
+func (m *securityMonitor) countFailure(clientIP string) int {
+	now := time.Now()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if len(m.failures) >= maxTrackedClients {
+		for ip, f := range m.failures {
+			if now.Sub(f.since) > m.window {
+				delete(m.failures, ip)
+			}
+		}
+	}
+
+	f := m.failures[clientIP]
+	if f == nil || now.Sub(f.since) > m.window {
+		f = &authFailures{since: now}
+		m.failures[clientIP] = f
+	}
+	f.count++
+	return f.count
+}
+
+// authzDenied reports the denial on the sensitive path
+func (m *securityMonitor) authzDenied(ctx context.Context, path string, idn identity.Identity) {
+	if m == nil || !m.isSensitive(path) {
+		return
+	}
+	protocol := "http"
+	if _, ok := grpc.Method(ctx); ok {
+		protocol = "grpc"
+	}
+	m.events.OnAuthzDenied(ctx, m.newEvent(ctx, EventAuthzDenied, protocol, path, "", idn))
+}
+
+// rateLimited reports the request rejected by the rate limiter
+func (m *securityMonitor) rateLimited(ctx context.Context, protocol, path, clientIP string, idn identity.Identity) {
+	if m == nil {
+		return
+	}
+	m.events.OnRateLimited(ctx, m.newEvent(ctx, EventRateLimited, protocol, path, clientIP, idn))
+}
+
+func (m *securityMonitor) isSensitive(path string) bool {
+	if len(m.sensitive) == 0 {
+		return true
+	}
+	for _, prefix := range m.sensitive {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *securityMonitor) newEvent(ctx context.Context, event, protocol, path, clientIP string, idn identity.Identity) *SecurityEvent {
+	if clientIP == "" {
+		clientIP = identity.FromContext(ctx).ClientIP()
+	}
+	if clientIP == "" {
+		clientIP = peerIP(ctx)
+	}
+
+	ev := &SecurityEvent{
+		Server:   m.server,
+		Event:    event,
+		Protocol: protocol,
+		Path:     path,
+		ClientIP: clientIP,
+	}
+	if idn != nil {
+		ev.Role = idn.Role()
+		ev.Subject = idn.Subject()
+	}
+	return ev
+}
+
+// identityFromRequest returns the identity of HTTP request,
+// and reports the validation errors
+func (e *Server) identityFromRequest(r *http.Request) (identity.Identity, error) {
+	idn, err := e.identity.IdentityFromRequest(r)
+	if err != nil {
+		e.security.authFailed(r.Context(), "http", r.URL.Path, identity.ClientIPFromRequest(r), err)
+	}
+	return idn, err
+}
+
+// identityFromContext returns the identity of gRPC call,
+// and reports the validation errors
+func (e *Server) identityFromContext(ctx context.Context, uri string) (identity.Identity, error) {
+	idn, err := e.identity.IdentityFromContext(ctx, uri)
+	if err != nil {
+		e.security.authFailed(ctx, "grpc", uri, peerIP(ctx), err)
+	}
+	return idn, err
+}
@@ -3,6 +3,7 @@ package gserver
 import (
 	"context"
 	"crypto/tls"
+	"encoding/binary"
 	"net"
 	"net/http"
 	"strings"
@@ -13,6 +14,7 @@ import (
 	"github.com/effective-security/porto/gserver/credentials"
 	"github.com/effective-security/porto/pkg/transport"
 	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/restserver/deprecation"
 	"github.com/effective-security/porto/restserver/ready"
 	"github.com/effective-security/porto/restserver/telemetry"
 	"github.com/effective-security/porto/xhttp/correlation"
@@ -20,13 +22,17 @@ import (
 	"github.com/effective-security/porto/xhttp/httperror"
 	"github.com/effective-security/porto/xhttp/identity"
 	"github.com/effective-security/porto/xhttp/marshal"
-	"github.com/effective-security/x/slices"
+	"github.com/effective-security/porto/xhttp/redact"
 	"github.com/effective-security/xlog"
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"github.com/pkg/errors"
+	"github.com/quic-go/quic-go/http3"
 	"github.com/rs/cors"
 	"github.com/soheilhy/cmux"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/net/netutil"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/keepalive"
 )
@@ -37,6 +43,8 @@ type serveCtx struct {
 	network  string
 	secure   bool
 	insecure bool
+	// quic specifies to serve HTTP/3 on UDP port, in addition to HTTPS
+	quic bool
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -50,9 +58,12 @@ type serveCtx struct {
 }
 
 type servers struct {
-	secure bool
-	grpc   *grpc.Server
-	http   *http.Server
+	secure  bool
+	grpc    *grpc.Server
+	http    *http.Server
+	drainer *transport.ConnDrainer
+	h3      *http3.Server
+	udp     net.PacketConn
 }
 
 func configureListeners(cfg *Config) (sctxs map[string]*serveCtx, err error) {
@@ -61,27 +72,9 @@ func configureListeners(cfg *Config) (sctxs map[string]*serveCtx, err error) {
 		return nil, err
 	}
 
-	var tlsInfo *transport.TLSInfo
-	if !cfg.ServerTLS.Empty() {
-		from := cfg.ServerTLS
-		clientauthType := tls.VerifyClientCertIfGiven
-		if from.GetClientCertAuth() {
-			clientauthType = tls.RequireAndVerifyClientCert
-		}
-		tlsInfo = &transport.TLSInfo{
-			CertFile:       from.CertFile,
-			KeyFile:        from.KeyFile,
-			TrustedCAFile:  from.TrustedCAFile,
-			ClientCAFile:   from.ClientCAFile,
-			ClientAuthType: clientauthType,
-			CipherSuites:   from.CipherSuites,
-			// CRLVerifier : TODO
-		}
-
-		_, err = tlsInfo.ServerTLSWithReloader()
-		if err != nil {
-			return nil, err
-		}
+	tlsInfo, err := serverTLSInfo(cfg.ServerTLS)
+	if err != nil {
+		return nil, err
 	}
 
 	gopts := []grpc.ServerOption{}
@@ -92,8 +85,17 @@ func configureListeners(cfg *Config) (sctxs map[string]*serveCtx, err error) {
 		}))
 	}
 
+	if cfg.MaxConcurrentStreams > 0 {
+		gopts = append(gopts, grpc.MaxConcurrentStreams(cfg.MaxConcurrentStreams))
+	}
+
 	ka := keepalive.ServerParameters{
-		MaxConnectionIdle: 5 * time.Minute,
+		MaxConnectionIdle:     5 * time.Minute,
+		MaxConnectionAge:      cfg.KeepAlive.MaxConnectionAge,
+		MaxConnectionAgeGrace: cfg.KeepAlive.MaxConnectionAgeGrace,
+	}
+	if cfg.KeepAlive.MaxConnectionIdle > 0 {
+		ka.MaxConnectionIdle = cfg.KeepAlive.MaxConnectionIdle
 	}
 	if cfg.KeepAlive.Interval > 0 &&
 		cfg.KeepAlive.Timeout > 0 {
@@ -121,6 +123,10 @@ func configureListeners(cfg *Config) (sctxs map[string]*serveCtx, err error) {
 	}()
 
 	for _, u := range urls {
+		quic := u.Scheme == quicScheme
+		if quic {
+			u.Scheme = "https"
+		}
 		if u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "unix" && u.Scheme != "unixs" {
 			return nil, errors.Errorf("unsupported URL scheme %q", u.Scheme)
 		}
@@ -139,6 +145,7 @@ func configureListeners(cfg *Config) (sctxs map[string]*serveCtx, err error) {
 		sctx := &serveCtx{
 			network:  "tcp",
 			secure:   u.Scheme == "https" || u.Scheme == "unixs",
+			quic:     quic,
 			addr:     u.Host,
 			ctx:      ctx,
 			cancel:   cancel,
@@ -161,6 +168,7 @@ func configureListeners(cfg *Config) (sctxs map[string]*serveCtx, err error) {
 			// use existing listener
 			oldctx.secure = oldctx.secure || sctx.secure
 			oldctx.insecure = oldctx.insecure || sctx.insecure
+			oldctx.quic = oldctx.quic || sctx.quic
 			continue
 		}
 
@@ -169,7 +177,11 @@ func configureListeners(cfg *Config) (sctxs map[string]*serveCtx, err error) {
 			"network", sctx.network,
 			"address", sctx.addr)
 
-		if sctx.listener, err = net.Listen(sctx.network, sctx.addr); err != nil {
+		if sctx.network == "unix" {
+			if sctx.listener, err = listenUnix(sctx.addr, cfg.UnixSocket); err != nil {
+				return nil, err
+			}
+		} else if sctx.listener, err = net.Listen(sctx.network, sctx.addr); err != nil {
 			return nil, errors.WithStack(err)
 		}
 
@@ -177,6 +189,22 @@ func configureListeners(cfg *Config) (sctxs map[string]*serveCtx, err error) {
 			if sctx.listener, err = transport.NewKeepAliveListener(sctx.listener, sctx.network, nil); err != nil {
 				return nil, err
 			}
+			if cfg.ProxyProtocol.GetEnabled() {
+				trusted, err := transport.ParseCIDRs(cfg.ProxyProtocol.TrustedCIDRs)
+				if err != nil {
+					sctx.listener.Close()
+					return nil, errors.WithMessage(err, "invalid PROXY protocol config")
+				}
+				sctx.listener = transport.NewProxyListener(sctx.listener, transport.ProxyConfig{
+					Required:      cfg.ProxyProtocol.Required,
+					Trusted:       trusted,
+					HeaderTimeout: cfg.ProxyProtocol.HeaderTimeout,
+				})
+			}
+		}
+		if cfg.MaxConnections > 0 {
+			// backpressure: Accept blocks until the open connections are closed
+			sctx.listener = netutil.LimitListener(sctx.listener, cfg.MaxConnections)
 		}
 		// TODO: register profiler, tracer, etc
 
@@ -186,6 +214,31 @@ func configureListeners(cfg *Config) (sctxs map[string]*serveCtx, err error) {
 	return sctxs, nil
 }
 
+// serverTLSInfo returns nil, if TLS is not configured
+func serverTLSInfo(from *TLSInfo) (*transport.TLSInfo, error) {
+	if from.Empty() {
+		return nil, nil
+	}
+	clientauthType := tls.VerifyClientCertIfGiven
+	if from.GetClientCertAuth() {
+		clientauthType = tls.RequireAndVerifyClientCert
+	}
+	tlsInfo := &transport.TLSInfo{
+		CertFile:       from.CertFile,
+		KeyFile:        from.KeyFile,
+		TrustedCAFile:  from.TrustedCAFile,
+		ClientCAFile:   from.ClientCAFile,
+		ClientAuthType: clientauthType,
+		CipherSuites:   from.CipherSuites,
+		// CRLVerifier : TODO
+	}
+
+	if _, err := tlsInfo.ServerTLSWithReloader(); err != nil {
+		return nil, err
+	}
+	return tlsInfo, nil
+}
+
 // serve accepts incoming connections on the listener l,
 // creating a new service goroutine for each. The service goroutines
 // read requests and then call handler to reply to them.
@@ -215,20 +268,44 @@ func (sctx *serveCtx) serve(s *Server, errHandler func(error)) (err error) {
 
 	if sctx.insecure {
 		gsInsecure = grpcServer(s, nil, sctx.gopts...)
-		grpcL := m.Match(cmux.HTTP2())
+		useH2C := s.cfg.GetH2C()
+
+		var grpcL net.Listener
+		if useH2C {
+			// only gRPC requests are served by gRPC server,
+			// the settings are sent for the clients waiting for them before the headers
+			grpcL = m.MatchWithWriters(
+				cmux.HTTP2MatchHeaderFieldSendSettings("content-type", header.ApplicationGRPC),
+				cmux.HTTP2MatchHeaderFieldSendSettings("content-type", header.ApplicationGRPC+"+proto"),
+			)
+		} else {
+			grpcL = m.Match(cmux.HTTP2())
+		}
 		go func() { errHandler(gsInsecure.Serve(grpcL)) }()
 
 		handler := router.Handler()
 		handler = configureHandlers(s, handler)
+		if useH2C {
+			// mux between http and grpc-web
+			handler = sctx.grpcHandlerFunc(gsInsecure, handler, s.redactor)
+		}
 		// rate limit will be first
-		handler = configureRateLimiter(s.cfg.RateLimit, handler)
+		handler = configureRateLimiter(s, handler)
+		handler = configureLoadMonitor(s, handler)
+		handler = configurePreflight(s, handler)
 
-		srv := &http.Server{
-			Handler: handler,
-			//ErrorLog: logger, // do not log user error
-		}
+		srv := s.httpServer(handler)
 
 		httpL := m.Match(cmux.HTTP1())
+		if useH2C {
+			// HTTP/2 with prior knowledge, or Upgrade from HTTP/1.1
+			srv.Handler = h2c.NewHandler(srv.Handler, &http2.Server{
+				IdleTimeout:          srv.IdleTimeout,
+				MaxConcurrentStreams: s.cfg.MaxConcurrentStreams,
+			})
+			h2cL := m.Match(cmux.HTTP2())
+			go func() { errHandler(srv.Serve(h2cL)) }()
+		}
 		go func() { errHandler(srv.Serve(httpL)) }()
 
 		sctx.serversC <- &servers{grpc: gsInsecure, http: srv}
@@ -242,22 +319,53 @@ func (sctx *serveCtx) serve(s *Server, errHandler func(error)) (err error) {
 		handler = configureHandlers(s, handler)
 
 		// mux between http and grpc
-		handler = sctx.grpcHandlerFunc(gsSecure, handler)
+		handler = sctx.grpcHandlerFunc(gsSecure, handler, s.redactor)
 		// rate limit will be first
-		handler = configureRateLimiter(s.cfg.RateLimit, handler)
+		handler = configureRateLimiter(s, handler)
+		handler = configureLoadMonitor(s, handler)
+		handler = configurePreflight(s, handler)
+
+		var h3 *http3.Server
+		var udp net.PacketConn
+		if sctx.quic {
+			h3, udp, err = sctx.serveQUIC(s, handler, errHandler)
+			if err != nil {
+				return err
+			}
+			handler = altSvcHandler(udp.LocalAddr().(*net.UDPAddr).Port, handler)
+		}
 
-		srv := &http.Server{
-			Handler:   handler,
-			TLSConfig: sctx.tlsInfo.Config(),
-			//ErrorLog:  logger, // do not log user error
+		var drainer *transport.ConnDrainer
+		if period := s.cfg.ServerTLS.RotationDrainPeriod; period > 0 {
+			drainer = transport.NewConnDrainer(period)
+			handler = drainer.Handler(handler)
 		}
+
+		srv := s.httpServer(handler)
+		srv.TLSConfig = sctx.tlsInfo.Config()
+		if n := s.cfg.MaxConcurrentStreams; n > 0 {
+			// gRPC on TLS listener is served by HTTP/2 server
+			err = http2.ConfigureServer(srv, &http2.Server{
+				IdleTimeout:          srv.IdleTimeout,
+				MaxConcurrentStreams: n,
+			})
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		if drainer != nil {
+			srv.ConnState = drainer.ConnState
+			srv.ConnContext = drainer.ConnContext
+			sctx.tlsInfo.OnRotation(drainer.Drain)
+		}
+
 		grpcL, err := transport.NewTLSListener(m.Match(cmux.Any()), sctx.tlsInfo)
 		if err != nil {
 			return err
 		}
 		go func() { errHandler(srv.Serve(grpcL)) }()
 
-		sctx.serversC <- &servers{secure: true, grpc: gsSecure, http: srv}
+		sctx.serversC <- &servers{secure: true, grpc: gsSecure, http: srv, drainer: drainer, h3: h3, udp: udp}
 	}
 
 	logger.KV(xlog.INFO, "status", "serving", "service", s.Name(), "address", sctx.listener.Addr().String(), "secure", sctx.secure, "insecure", sctx.insecure)
@@ -269,7 +377,39 @@ func (sctx *serveCtx) serve(s *Server, errHandler func(error)) (err error) {
 	return m.Serve()
 }
 
-func configureRateLimiter(cfg *RateLimit, handler http.Handler) http.Handler {
+// httpServer returns http.Server with the configured limits and timeouts
+func (s *Server) httpServer(handler http.Handler) *http.Server {
+	srv := &http.Server{
+		Handler: handler,
+		//ErrorLog: logger, // do not log user error
+	}
+	restserver.ApplyLimits(srv, &s.cfg)
+	return srv
+}
+
+// configureBodyLimit returns the handler, that rejects the requests
+// with the body larger than limit with 413 status
+func configureBodyLimit(limit int64, handler http.Handler) http.Handler {
+	if limit <= 0 {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > limit {
+			marshal.WriteJSON(w, r, httperror.New(http.StatusRequestEntityTooLarge, httperror.CodeRequestTooLarge,
+				"request body exceeds %d bytes", limit).
+				WithContext(r.Context()))
+			return
+		}
+		if r.Body != nil && r.Body != http.NoBody {
+			// the streamed body fails to read after the limit
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func configureRateLimiter(s *Server, handler http.Handler) http.Handler {
+	cfg := s.cfg.RateLimit
 	if !cfg.GetEnabled() {
 		return handler
 	}
@@ -291,7 +431,47 @@ func configureRateLimiter(cfg *RateLimit, handler http.Handler) http.Handler {
 		lmt.SetMethods(cfg.Metods)
 	}
 
-	return tollbooth.LimitHandler(lmt, handler)
+	return rateLimitHandler(lmt, s.security, handler)
+}
+
+// rateLimitHandler returns the handler, that emits X-RateLimit-* headers,
+// and rejects the request with httperror.CodeRateLimitExceeded and Retry-After
+// when the limit is reached
+func rateLimitHandler(lmt *limiter.Limiter, security *securityMonitor, handler http.Handler) http.Handler {
+	delay := retryAfter(lmt.GetMax())
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpError := tollbooth.LimitByRequest(lmt, w, r)
+
+		hdr := w.Header()
+		hdr.Set(header.XRateLimitLimit, hdr.Get("RateLimit-Limit"))
+		hdr.Set(header.XRateLimitRemaining, hdr.Get("RateLimit-Remaining"))
+		hdr.Set(header.XRateLimitReset, hdr.Get("RateLimit-Reset"))
+
+		if httpError != nil {
+			lmt.ExecOnLimitReached(w, r)
+			security.rateLimited(r.Context(), "http", r.URL.Path, identity.ClientIPFromRequest(r), nil)
+			marshal.WriteJSON(w, r, httperror.RateLimitExceeded("rate limit exceeded").
+				WithContext(r.Context()).
+				WithRetryAfter(delay))
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// configureLoadMonitor returns the handler, that tracks requests in flight,
+// and reports degraded status on the readiness probes
+func configureLoadMonitor(s *Server, handler http.Handler) http.Handler {
+	if s.load == nil {
+		return handler
+	}
+	paths := s.cfg.Readiness.GetPaths()
+	if len(s.cfg.Readiness.Paths) == 0 && s.cfg.Internal.GetEnabled() {
+		paths = []string{s.cfg.Internal.GetReadyPath()}
+	}
+	handler = ready.NewLoadStatusVerifier(s.load, paths, handler)
+	return s.load.Handler(handler)
 }
 
 func configureHandlers(s *Server, handler http.Handler) http.Handler {
@@ -313,44 +493,93 @@ func configureHandlers(s *Server, handler http.Handler) http.Handler {
 		}
 	}
 
+	// panics are logged and counted by the logging wrapper as 500
+	handler = configureRecovery(s, handler)
+
 	// logging wrapper
 	var opts []telemetry.Option
 	if len(s.cfg.SkipLogPaths) > 0 {
 		opts = append(opts, telemetry.WithLoggerSkipPaths(s.cfg.SkipLogPaths))
 	}
+	if s.accessLog != nil {
+		opts = append(opts, telemetry.WithAccessLogSink(s.accessLog))
+	}
 	handler = telemetry.NewRequestLogger(handler, time.Millisecond, logger, opts...)
 
 	// metrics wrapper
 	handler = telemetry.NewRequestMetrics(handler)
 
+	if len(s.cfg.Deprecations) > 0 {
+		handler = deprecation.NewHandler(s.cfg.Deprecations, handler)
+	}
+
 	// role/contextID wrapper
-	handler = identity.NewContextHandler(handler, s.identity.IdentityFromRequest)
+	handler = identity.NewContextHandler(handler, s.identityFromRequest)
 
 	if s.cfg.CORS.GetEnabled() {
 		logger.KV(xlog.NOTICE, "server", s.name, "CORS", "enabled")
-		co := cors.New(cors.Options{
-			AllowedOrigins: s.cfg.CORS.AllowedOrigins,
-			//AllowOriginFunc:        s.cfg.CORS.AllowOriginFunc,
-			//AllowOriginRequestFunc: s.cfg.CORS.AllowOriginRequestFunc,
-			AllowedMethods:     s.cfg.CORS.AllowedMethods,
-			AllowedHeaders:     s.cfg.CORS.AllowedHeaders,
-			ExposedHeaders:     s.cfg.CORS.ExposedHeaders,
-			MaxAge:             s.cfg.CORS.MaxAge,
-			AllowCredentials:   s.cfg.CORS.GetAllowCredentials(),
-			OptionsPassthrough: s.cfg.CORS.GetOptionsPassthrough(),
-			Debug:              s.cfg.CORS.GetDebug(),
-		})
-		handler = co.Handler(handler)
+		handler = newCORS(s.cfg.CORS).Handler(handler)
 	}
 
+	handler = configureBodyLimit(s.cfg.MaxRequestSize, handler)
+
 	// Add correlationID
 	handler = correlation.NewHandler(handler)
 
+	// OpenTelemetry span, before the correlationID
+	handler = s.tracing.handler(s.name, handler)
+
+	// in-flight requests for the shutdown report
+	handler = s.trackInFlight(handler)
+
 	return handler
 }
 
+// servingStatus reports not ready while the server is draining,
+// so the load balancers remove the instance before the shutdown
+type servingStatus struct {
+	s *Server
+}
+
+func (st servingStatus) IsReady() bool {
+	return !st.s.IsDraining() && st.s.IsReady()
+}
+
+func newCORS(cfg *CORS) *cors.Cors {
+	return cors.New(cors.Options{
+		AllowedOrigins: cfg.AllowedOrigins,
+		//AllowOriginFunc:        cfg.AllowOriginFunc,
+		//AllowOriginRequestFunc: cfg.AllowOriginRequestFunc,
+		AllowedMethods:     cfg.AllowedMethods,
+		AllowedHeaders:     cfg.AllowedHeaders,
+		ExposedHeaders:     cfg.ExposedHeaders,
+		MaxAge:             cfg.MaxAge,
+		AllowCredentials:   cfg.GetAllowCredentials(),
+		OptionsPassthrough: cfg.GetOptionsPassthrough(),
+		Debug:              cfg.GetDebug(),
+	})
+}
+
+// configurePreflight returns the handler, that answers CORS preflight requests
+// before the rate limiter, identity, authz and logging handlers
+func configurePreflight(s *Server, handler http.Handler) http.Handler {
+	if !s.cfg.CORS.GetEnabled() || !s.cfg.CORS.GetEarlyPreflight() {
+		return handler
+	}
+	co := newCORS(s.cfg.CORS)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions && r.Header.Get(header.AccessControlRequestMethod) != "" {
+			co.HandlerFunc(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
 func restRouter(s *Server) restserver.Router {
-	router := restserver.NewRouter(notFoundHandler)
+	router := restserver.NewRouter(notFoundHandler,
+		restserver.WithRouteSuggestions(s.cfg.RouteSuggestions))
+	s.cfg.Internal.Register(router, servingStatus{s})
 
 	for name, svc := range s.services {
 		if registrator, ok := svc.(RouteRegistrator); ok {
@@ -374,11 +603,28 @@ func grpcServer(s *Server, tls *tls.Config, gopts ...grpc.ServerOption) *grpc.Se
 		opts = append(opts, grpc.Creds(bundle.TransportCredentials()))
 	}
 
+	if s.cfg.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(s.cfg.MaxRecvMsgSize))
+	}
+
 	chainUnaryInterceptors := []grpc.UnaryServerInterceptor{
+		s.inFlightUnaryInterceptor(),
+	}
+	if s.tracing != nil {
+		opts = append(opts, s.tracing.serverOption())
+		chainUnaryInterceptors = append(chainUnaryInterceptors, s.tracing.unaryInterceptor())
+	}
+	chainUnaryInterceptors = append(chainUnaryInterceptors,
 		correlation.NewAuthUnaryInterceptor(),
 		s.newLogUnaryInterceptor(),
-		identity.NewAuthUnaryInterceptor(s.identity.IdentityFromContext),
-		s.authz.NewUnaryInterceptor(),
+		identity.NewAuthUnaryInterceptor(s.identityFromContext),
+	)
+	rl := newGRPCRateLimit(s.cfg.GRPCRateLimit, s.opts.grpcRateLimiter, s.security)
+	if rl != nil {
+		chainUnaryInterceptors = append(chainUnaryInterceptors, rl.unaryInterceptor())
+	}
+	if s.authz != nil {
+		chainUnaryInterceptors = append(chainUnaryInterceptors, s.authz.NewUnaryInterceptor())
 	}
 	if s.cfg.PromGrpc {
 		chainUnaryInterceptors = append(chainUnaryInterceptors, grpc_prometheus.UnaryServerInterceptor)
@@ -388,8 +634,12 @@ func grpcServer(s *Server, tls *tls.Config, gopts ...grpc.ServerOption) *grpc.Se
 	}
 
 	chainStreamInterceptors := []grpc.StreamServerInterceptor{
+		s.inFlightStreamInterceptor(),
 		newStreamInterceptor(s),
 	}
+	if rl != nil {
+		chainStreamInterceptors = append(chainStreamInterceptors, rl.streamInterceptor(s))
+	}
 	if s.cfg.PromGrpc {
 		chainStreamInterceptors = append(chainStreamInterceptors, grpc_prometheus.StreamServerInterceptor)
 	}
@@ -411,35 +661,34 @@ func grpcServer(s *Server, tls *tls.Config, gopts ...grpc.ServerOption) *grpc.Se
 			logger.KV(xlog.INFO, "status", "not_supported_RegisterGRPC", "server", s.Name(), "service", name)
 		}
 	}
+	s.registerHealth(grpcServer)
 
 	return grpcServer
 }
 
 // grpcHandlerFunc returns an http.Handler that delegates to grpcServer on incoming gRPC
 // connections or otherHandler otherwise. Given in gRPC docs.
-func (sctx *serveCtx) grpcHandlerFunc(grpcServer *grpc.Server, otherHandler http.Handler) http.Handler {
+func (sctx *serveCtx) grpcHandlerFunc(grpcServer *grpc.Server, otherHandler http.Handler, redactor *redact.Redactor) http.Handler {
 	if otherHandler == nil {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			grpcServer.ServeHTTP(w, r)
 		})
 	}
 
-	var allowedOrigins []string
-	exposedHeaders := ""
-	if sctx.cfg.CORS != nil {
-		if len(sctx.cfg.CORS.AllowedOrigins) > 0 && sctx.cfg.CORS.AllowedOrigins[0] != "*" {
-			allowedOrigins = sctx.cfg.CORS.AllowedOrigins
-		}
-		if len(sctx.cfg.CORS.ExposedHeaders) > 0 {
-			exposedHeaders = strings.Join(sctx.cfg.CORS.ExposedHeaders, ",")
-		}
-	}
+	webCORS := newGRPCWebCORS(sctx.cfg.CORS, grpcServer)
+	textLimit := sctx.cfg.grpcWebTextLimit()
 
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if webCORS.isPreflight(r) {
+			webCORS.preflight(w, r)
+			return
+		}
+
 		ct := r.Header.Get(header.ContentType)
 		if strings.HasPrefix(ct, header.ApplicationGRPC) {
-			origin := r.Header.Get("Origin")
-			grpcWeb := ct == header.ApplicationGRPCWebProto
+			origin := r.Header.Get(header.Origin)
+			grpcWebText := ct == header.ApplicationGRPCWebText
+			grpcWeb := grpcWebText || ct == header.ApplicationGRPCWebProto
 			wh := w.Header()
 			if grpcWeb {
 				if r.ProtoMajor != 2 {
@@ -454,7 +703,7 @@ func (sctx *serveCtx) grpcHandlerFunc(grpcServer *grpc.Server, otherHandler http
 
 				r.Header.Set(header.ContentType, header.ApplicationGRPC)
 				if origin != "" {
-					if len(allowedOrigins) > 0 && !slices.ContainsString(allowedOrigins, origin) {
+					if !webCORS.allowOrigin(origin) {
 						logger.ContextKV(r.Context(), xlog.INFO,
 							"reason", "cors_not_allowed",
 							"method", r.Method,
@@ -463,23 +712,28 @@ func (sctx *serveCtx) grpcHandlerFunc(grpcServer *grpc.Server, otherHandler http
 							"agent", r.UserAgent(),
 							"content-type", r.Header.Get(header.ContentType),
 							"accept", r.Header.Get(header.Accept),
-							"url", r.URL.String())
+							"url", redactor.URL(r.URL))
 						return
 					}
-					if len(allowedOrigins) > 0 {
-						wh.Set("Access-Control-Allow-Origin", origin)
-					} else {
-						wh.Set("Access-Control-Allow-Origin", "*")
-					}
+					webCORS.setOrigin(wh, origin)
 				}
-				if exposedHeaders != "" {
-					wh.Set("Access-Control-Expose-Headers", exposedHeaders)
+				if webCORS.exposed != "" {
+					wh.Set(header.AccessControlExposeHeaders, webCORS.exposed)
 				}
 				wh.Set(header.ContentType, header.ApplicationGRPC)
 
-				w = &proxyWriter{
-					rw: w,
+				if grpcWebText {
+					if !decodeTextRequest(w, r, textLimit) {
+						return
+					}
+					tw := &textResponseWriter{ResponseWriter: w}
+					defer tw.close()
+					w = tw
 				}
+
+				pw := newProxyWriter(w, sctx.cfg.GRPCWeb)
+				defer pw.close()
+				w = pw
 			}
 			if sctx.cfg.DebugLogs {
 				logger.ContextKV(r.Context(), xlog.DEBUG,
@@ -492,13 +746,13 @@ func (sctx *serveCtx) grpcHandlerFunc(grpcServer *grpc.Server, otherHandler http
 					"content-length", r.ContentLength,
 					"proto_ver_minor", r.ProtoMinor,
 					"proto_ver_major", r.ProtoMajor,
-					"url", r.URL.String())
+					"url", redactor.URL(r.URL))
 			}
 			grpcServer.ServeHTTP(w, r)
 			if grpcWeb && sctx.cfg.DebugLogs {
 				logger.ContextKV(r.Context(), xlog.DEBUG,
 					"method", r.Method,
-					"headers", wh)
+					"headers", redactor.Header(wh))
 			}
 		} else {
 			if sctx.cfg.DebugLogs && r.URL.Path != "/healthz" {
@@ -511,7 +765,7 @@ func (sctx *serveCtx) grpcHandlerFunc(grpcServer *grpc.Server, otherHandler http
 					"accept", r.Header.Get(header.Accept),
 					"content-length", r.ContentLength,
 					"method", r.Method,
-					"url", r.URL.String(),
+					"url", redactor.URL(r.URL),
 					"proto_ver_minor", r.ProtoMinor,
 					"proto_ver_major", r.ProtoMajor)
 			}
@@ -526,9 +780,35 @@ func notFoundHandler(w http.ResponseWriter, r *http.Request) {
 	marshal.WriteJSON(w, r, httperror.NotFound("%s", r.URL.Path))
 }
 
-// the proxy is a workaround to disable premature Flush for Grpc-Web
+// grpcFrameHeaderLen is the length of the gRPC message prefix:
+// 1 byte of the flags, and 4 bytes of the message length
+const grpcFrameHeaderLen = 5
+
+// the proxy is a workaround to disable premature Flush for Grpc-Web,
+// it also provides flush after message and write deadlines
+// for the streaming responses
 type proxyWriter struct {
-	rw http.ResponseWriter
+	rw  http.ResponseWriter
+	rc  *http.ResponseController
+	cfg *GRPCWeb
+
+	// unflushed is set when a complete message was written after the last flush
+	unflushed bool
+	// framing state of the written data
+	hdr       [grpcFrameHeaderLen]byte
+	hdrLen    int
+	remaining uint32
+}
+
+func newProxyWriter(rw http.ResponseWriter, cfg *GRPCWeb) *proxyWriter {
+	if cfg == nil {
+		cfg = &GRPCWeb{}
+	}
+	return &proxyWriter{
+		rw:  rw,
+		rc:  http.NewResponseController(rw),
+		cfg: cfg,
+	}
 }
 
 // Header proxy
@@ -538,7 +818,15 @@ func (p *proxyWriter) Header() http.Header {
 
 // Write proxy
 func (p *proxyWriter) Write(data []byte) (int, error) {
-	return p.rw.Write(data)
+	p.setWriteDeadline()
+	n, err := p.rw.Write(data)
+	if n > 0 {
+		p.track(data[:n])
+		if p.betweenFrames() {
+			p.unflushed = true
+		}
+	}
+	return n, err
 }
 
 // WriteHeader proxy
@@ -548,8 +836,65 @@ func (p *proxyWriter) WriteHeader(statusCode int) {
 
 // Flush proxy
 func (p *proxyWriter) Flush() {
-	// do nothing
-	// Looks like a bug in
-	// func (ht *serverHandlerTransport) WriteStatus(s *Stream, st *status.Status)
-	logger.KV(xlog.DEBUG, "reason", "not_supported")
+	if !p.cfg.FlushMessages {
+		// do nothing
+		// Looks like a bug in
+		// func (ht *serverHandlerTransport) WriteStatus(s *Stream, st *status.Status)
+		logger.KV(xlog.DEBUG, "reason", "not_supported")
+		return
+	}
+
+	// the premature Flush is ignored, unless a complete message was written
+	if p.unflushed && p.betweenFrames() {
+		p.flush()
+	}
+}
+
+func (p *proxyWriter) flush() {
+	p.unflushed = false
+	if err := p.rc.Flush(); err != nil {
+		logger.KV(xlog.DEBUG, "reason", "flush", "err", err.Error())
+	}
+}
+
+func (p *proxyWriter) setWriteDeadline() {
+	if p.cfg.WriteTimeout > 0 {
+		_ = p.rc.SetWriteDeadline(time.Now().Add(p.cfg.WriteTimeout))
+	}
+}
+
+// track follows the gRPC message framing of the written data
+func (p *proxyWriter) track(data []byte) {
+	for len(data) > 0 {
+		if p.remaining > 0 {
+			n := len(data)
+			if uint64(n) > uint64(p.remaining) {
+				n = int(p.remaining)
+			}
+			p.remaining -= uint32(n)
+			data = data[n:]
+			continue
+		}
+
+		n := copy(p.hdr[p.hdrLen:], data)
+		p.hdrLen += n
+		data = data[n:]
+		if p.hdrLen == grpcFrameHeaderLen {
+			p.remaining = binary.BigEndian.Uint32(p.hdr[1:])
+			p.hdrLen = 0
+		}
+	}
+}
+
+// betweenFrames returns true if no message is partially written
+func (p *proxyWriter) betweenFrames() bool {
+	return p.hdrLen == 0 && p.remaining == 0
+}
+
+// close resets the write deadline,
+// the writer must not be used after the handler returns
+func (p *proxyWriter) close() {
+	if p.cfg.WriteTimeout > 0 {
+		_ = p.rc.SetWriteDeadline(time.Time{})
+	}
 }
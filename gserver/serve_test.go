@@ -0,0 +1,436 @@
+package gserver
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/x/safecall"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/identity"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestProxyWriterFlush(t *testing.T) {
+	msg := []byte{0, 0, 0, 0, 2, 'h', 'i'}
+
+	rec := httptest.NewRecorder()
+	p := newProxyWriter(rec, nil)
+	defer p.close()
+
+	_, err := p.Write(msg)
+	require.NoError(t, err)
+	p.Flush()
+	assert.False(t, rec.Flushed, "flush is disabled by default")
+
+	rec = httptest.NewRecorder()
+	p = newProxyWriter(rec, &GRPCWeb{FlushMessages: true, WriteTimeout: time.Second})
+	defer p.close()
+
+	// partial message
+	_, err = p.Write(msg[:3])
+	require.NoError(t, err)
+	p.Flush()
+	assert.False(t, rec.Flushed)
+
+	_, err = p.Write(msg[3:])
+	require.NoError(t, err)
+	p.Flush()
+	assert.True(t, rec.Flushed)
+	assert.Equal(t, msg, rec.Body.Bytes())
+}
+
+func TestGRPCWebText(t *testing.T) {
+	gs := grpc.NewServer()
+	healthpb.RegisterHealthServer(gs, health.NewServer())
+
+	frame := func(msg proto.Message) []byte {
+		b, err := proto.Marshal(msg)
+		require.NoError(t, err)
+		f := make([]byte, grpcFrameHeaderLen, grpcFrameHeaderLen+len(b))
+		binary.BigEndian.PutUint32(f[1:], uint32(len(b)))
+		return append(f, b...)
+	}
+	call := func(cfg *Config, msg proto.Message, chunked bool) *http.Response {
+		sctx := &serveCtx{cfg: cfg}
+		handler := sctx.grpcHandlerFunc(gs, http.NotFoundHandler(), nil)
+
+		body := base64.StdEncoding.EncodeToString(frame(msg))
+		r := httptest.NewRequest(http.MethodPost, "/grpc.health.v1.Health/Check", strings.NewReader(body))
+		r.Header.Set(header.ContentType, header.ApplicationGRPCWebText)
+		if chunked {
+			r.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Result()
+	}
+	grpcStatus := func(res *http.Response) string {
+		if st := res.Header.Get("Grpc-Status"); st != "" {
+			return st
+		}
+		return res.Trailer.Get("Grpc-Status")
+	}
+
+	assert.Equal(t, int64(defaultMaxRecvMsgSize+grpcFrameHeaderLen), (&Config{}).grpcWebTextLimit())
+
+	res := call(&Config{}, &healthpb.HealthCheckRequest{}, false)
+	assert.Equal(t, header.ApplicationGRPCWebText, res.Header.Get(header.ContentType))
+	assert.Equal(t, "0", grpcStatus(res))
+
+	raw, err := base64.StdEncoding.DecodeString(readAll(t, res))
+	require.NoError(t, err)
+	require.Greater(t, len(raw), grpcFrameHeaderLen)
+	var hc healthpb.HealthCheckResponse
+	require.NoError(t, proto.Unmarshal(raw[grpcFrameHeaderLen:], &hc))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, hc.Status)
+
+	// the trailers only response
+	res = call(&Config{}, &healthpb.HealthCheckRequest{Service: "unknown"}, false)
+	assert.Equal(t, header.ApplicationGRPCWebText, res.Header.Get(header.ContentType))
+	assert.Equal(t, strconv.Itoa(int(codes.NotFound)), grpcStatus(res))
+
+	cfg := &Config{GRPCWeb: &GRPCWeb{MaxTextSize: 8}}
+	big := &healthpb.HealthCheckRequest{Service: "oversized"}
+
+	// rejected by Content-Length
+	res = call(cfg, big, false)
+	assert.Equal(t, "8", grpcStatus(res))
+	assert.Equal(t, "grpc-web-text request exceeds 8 bytes", res.Header.Get("Grpc-Message"))
+
+	// rejected while decoding
+	res = call(cfg, big, true)
+	assert.Equal(t, strconv.Itoa(int(codes.ResourceExhausted)), grpcStatus(res))
+}
+
+func readAll(t *testing.T, res *http.Response) string {
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestGRPCWebPreflight(t *testing.T) {
+	gs := grpc.NewServer()
+	healthpb.RegisterHealthServer(gs, health.NewServer())
+
+	enabled := true
+	sctx := &serveCtx{cfg: &Config{
+		CORS: &CORS{
+			AllowedOrigins:   []string{"https://app.example.com"},
+			AllowedHeaders:   []string{"Authorization"},
+			ExposedHeaders:   []string{"X-Correlation-ID"},
+			MaxAge:           600,
+			AllowCredentials: &enabled,
+		},
+	}}
+	handler := sctx.grpcHandlerFunc(gs, http.NotFoundHandler(), nil)
+
+	preflight := func(path, origin, method, headers string) *http.Response {
+		r := httptest.NewRequest(http.MethodOptions, path, nil)
+		r.Header.Set(header.Origin, origin)
+		r.Header.Set(header.AccessControlRequestMethod, method)
+		if headers != "" {
+			r.Header.Set(header.AccessControlRequestHeaders, headers)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Result()
+	}
+
+	res := preflight("/grpc.health.v1.Health/Check", "https://app.example.com", http.MethodPost,
+		"content-type,X-Grpc-Web, x-user-agent, authorization")
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.Equal(t, "https://app.example.com", res.Header.Get(header.AccessControlAllowOrigin))
+	assert.Equal(t, "true", res.Header.Get(header.AccessControlAllowCredentials))
+	assert.Equal(t, http.MethodPost, res.Header.Get(header.AccessControlAllowMethods))
+	assert.Equal(t, "content-type, x-grpc-web, x-user-agent, authorization", res.Header.Get(header.AccessControlAllowHeaders))
+	assert.Equal(t, "600", res.Header.Get(header.AccessControlMaxAge))
+	assert.Contains(t, res.Header.Values(header.Vary), header.Origin)
+
+	// unknown path with grpc-web headers
+	res = preflight("/custom.Service/Method", "https://app.example.com", http.MethodPost, "x-grpc-web")
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	res = preflight("/grpc.health.v1.Health/Check", "https://evil.example.com", http.MethodPost, "x-grpc-web")
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	assert.Empty(t, res.Header.Get(header.AccessControlAllowOrigin))
+
+	res = preflight("/grpc.health.v1.Health/Check", "https://app.example.com", http.MethodPut, "x-grpc-web")
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	res = preflight("/grpc.health.v1.Health/Check", "https://app.example.com", http.MethodPost, "x-grpc-web, x-custom")
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	// REST preflight is served by other handler
+	res = preflight("/v1/status", "https://app.example.com", http.MethodGet, "")
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestListenUnix(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "s.sock")
+
+	// leave the stale socket file
+	l, err := net.Listen("unix", addr)
+	require.NoError(t, err)
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, l.Close())
+
+	_, err = listenUnix(addr, nil)
+	require.Error(t, err)
+
+	enabled := true
+	cfg := &UnixSocket{
+		Mode:        "0600",
+		Owner:       strconv.Itoa(os.Getuid()),
+		Group:       strconv.Itoa(os.Getgid()),
+		RemoveStale: &enabled,
+		Unlink:      &enabled,
+	}
+	l, err = listenUnix(addr, cfg)
+	require.NoError(t, err)
+
+	fi, err := os.Stat(addr)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	// the socket is in use
+	_, err = listenUnix(addr, cfg)
+	assert.EqualError(t, err, "socket is in use: "+addr)
+
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, l.Close())
+	unlinkSocket(addr)
+	_, err = os.Stat(addr)
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = listenUnix(addr, &UnixSocket{Mode: "rw"})
+	assert.EqualError(t, err, "invalid socket mode: rw")
+	_, err = os.Stat(addr)
+	assert.True(t, os.IsNotExist(err), "the listener is closed on error")
+
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, []byte("data"), 0600))
+	_, err = listenUnix(file, cfg)
+	assert.EqualError(t, err, "not a socket: "+file)
+}
+
+func TestMaxConnections(t *testing.T) {
+	cfg := &Config{
+		ListenURLs:           []string{"http://127.0.0.1:0"},
+		MaxConnections:       1,
+		MaxConcurrentStreams: 10,
+		KeepAlive: KeepAliveCfg{
+			MaxConnectionAge:      time.Minute,
+			MaxConnectionAgeGrace: time.Second,
+		},
+	}
+	sctxs, err := configureListeners(cfg)
+	require.NoError(t, err)
+	require.Len(t, sctxs, 1)
+
+	var l net.Listener
+	for _, sctx := range sctxs {
+		l = sctx.listener
+	}
+	defer l.Close()
+
+	c1, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer c1.Close()
+	c2, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer c2.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	first := <-accepted
+	select {
+	case <-accepted:
+		t.Fatal("the second connection must wait")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// the slot is released on close
+	require.NoError(t, first.Close())
+	select {
+	case c := <-accepted:
+		c.Close()
+	case <-time.After(time.Second):
+		t.Fatal("the second connection is not accepted")
+	}
+}
+
+type securityRecorder struct {
+	events []SecurityEvent
+}
+
+func (r *securityRecorder) OnRepeatedAuthFailures(_ context.Context, ev *SecurityEvent) {
+	r.events = append(r.events, *ev)
+}
+
+func (r *securityRecorder) OnTokenInvalid(_ context.Context, ev *SecurityEvent) {
+	r.events = append(r.events, *ev)
+}
+
+func (r *securityRecorder) OnAuthzDenied(_ context.Context, ev *SecurityEvent) {
+	r.events = append(r.events, *ev)
+}
+
+func (r *securityRecorder) OnRateLimited(_ context.Context, ev *SecurityEvent) {
+	r.events = append(r.events, *ev)
+}
+
+func TestSecurityMonitor(t *testing.T) {
+	ctx := context.Background()
+
+	var m *securityMonitor
+	assert.Nil(t, newSecurityMonitor("test", nil, nil))
+	// no-op
+	m.authFailed(ctx, "http", "/v1/users", "10.0.0.1", errors.New("expired"))
+	m.authzDenied(ctx, "/v1/users", nil)
+	m.rateLimited(ctx, "http", "/v1/users", "10.0.0.1", nil)
+
+	enabled := true
+	m = newSecurityMonitor("test", &SecurityEventsCfg{Enabled: &enabled}, nil)
+	require.NotNil(t, m)
+	assert.Equal(t, defaultAuthFailureThreshold, m.threshold)
+	assert.Equal(t, defaultAuthFailureWindow, m.window)
+
+	rec := &securityRecorder{}
+	m = newSecurityMonitor("test", &SecurityEventsCfg{
+		AuthFailureThreshold: 2,
+		AuthFailureWindow:    time.Minute,
+		SensitivePaths:       []string{"/v1/admin", "/pb.AdminService/"},
+	}, rec)
+	require.NotNil(t, m)
+
+	for i := 0; i < 3; i++ {
+		m.authFailed(ctx, "http", "/v1/users", "10.0.0.1", errors.New("token expired"))
+	}
+	m.authFailed(ctx, "grpc", "/pb.Service/Get", "10.0.0.2", errors.New("invalid signature"))
+	require.Len(t, rec.events, 5)
+	assert.Equal(t, SecurityEvent{
+		Server:   "test",
+		Event:    EventInvalidToken,
+		Protocol: "http",
+		Path:     "/v1/users",
+		ClientIP: "10.0.0.1",
+		Reason:   "token expired",
+	}, rec.events[0])
+	assert.Equal(t, EventAuthFailures, rec.events[2].Event)
+	assert.Equal(t, 2, rec.events[2].Count)
+	assert.Equal(t, EventInvalidToken, rec.events[3].Event, "reported once per window")
+	assert.Equal(t, "10.0.0.2", rec.events[4].ClientIP)
+
+	rec.events = nil
+	bob := identity.NewIdentity("bob", "bob@test", "", nil, "", "")
+	m.authzDenied(ctx, "/v1/users", bob)
+	m.authzDenied(ctx, "/v1/admin/users", bob)
+	m.authzDenied(ctx, "/pb.AdminService/Delete", bob)
+	m.rateLimited(ctx, "grpc", "/pb.Service/Get", "10.0.0.3", bob)
+	require.Len(t, rec.events, 3)
+	assert.Equal(t, EventAuthzDenied, rec.events[0].Event)
+	assert.Equal(t, "/v1/admin/users", rec.events[0].Path)
+	assert.Equal(t, "bob", rec.events[0].Role)
+	assert.Equal(t, "bob@test", rec.events[0].Subject)
+	assert.Equal(t, "/pb.AdminService/Delete", rec.events[1].Path)
+	assert.Equal(t, EventRateLimited, rec.events[2].Event)
+	assert.Equal(t, "10.0.0.3", rec.events[2].ClientIP)
+
+	// default logger
+	l := NewSecurityEventsLogger()
+	l.OnRepeatedAuthFailures(ctx, &SecurityEvent{Event: EventAuthFailures, Protocol: "http"})
+	l.OnTokenInvalid(ctx, &SecurityEvent{Event: EventInvalidToken, Protocol: "http"})
+	l.OnAuthzDenied(ctx, &SecurityEvent{Event: EventAuthzDenied, Protocol: "grpc"})
+	l.OnRateLimited(ctx, &SecurityEvent{Event: EventRateLimited, Protocol: "grpc"})
+}
+
+func TestRecovery(t *testing.T) {
+	var reported *safecall.PanicError
+	s := &Server{}
+	WithCrashReporter(func(_ *http.Request, pe *safecall.PanicError) {
+		reported = pe
+	}).apply(&s.opts)
+
+	var mode string
+	handler := configureRecovery(s, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		switch mode {
+		case "partial":
+			_, _ = w.Write([]byte("partial"))
+			panic("after write")
+		case "abort":
+			panic(http.ErrAbortHandler)
+		case "ok":
+			w.(http.Flusher).Flush()
+			_, _ = w.Write([]byte("ok"))
+		default:
+			panic("boom")
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/panic", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"unexpected"`)
+	assert.Contains(t, w.Body.String(), "panic in http: boom")
+	require.NotNil(t, reported)
+	assert.Equal(t, "boom", reported.Value)
+	assert.NotEmpty(t, reported.Stack)
+
+	mode = "ok"
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/ok", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, w.Flushed)
+
+	reported = nil
+	mode = "partial"
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/partial", nil))
+	})
+	require.NotNil(t, reported)
+	assert.Equal(t, "after write", reported.Value)
+
+	reported = nil
+	mode = "abort"
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/abort", nil))
+	})
+	assert.Nil(t, reported)
+
+	// the reporter does not crash the server
+	WithCrashReporter(func(*http.Request, *safecall.PanicError) {
+		panic("reporter")
+	}).apply(&s.opts)
+	mode = ""
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/panic", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
@@ -6,18 +6,23 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/effective-security/porto/gserver/roles"
 	"github.com/effective-security/porto/pkg/discovery"
 	"github.com/effective-security/porto/restserver"
 	"github.com/effective-security/porto/restserver/authz"
+	"github.com/effective-security/porto/restserver/ready"
+	"github.com/effective-security/porto/restserver/telemetry"
+	"github.com/effective-security/porto/xhttp/redact"
 	"github.com/effective-security/x/netutil"
 	"github.com/effective-security/xlog"
 	"github.com/effective-security/xpki/jwt"
 	"github.com/pkg/errors"
 	"go.uber.org/dig"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
 )
 
 var logger = xlog.NewPackageLogger("github.com/effective-security/porto", "gserver")
@@ -74,8 +79,11 @@ type GServer interface {
 	Discovery() discovery.Discovery
 	// Err returns error channel
 	Err() <-chan error
+	// Run waits until the context is done or a listener fails,
+	// then gracefully shuts down the server and returns the report
+	Run(ctx context.Context) (*ShutdownReport, error)
 	// Close gracefully shuts down all servers/listeners.
-	// Client requests will be terminated with request timeout.
+	// In-flight requests are drained up to the shutdown timeout.
 	// After timeout, enforce remaning requests be closed immediately.
 	Close()
 }
@@ -96,13 +104,29 @@ type Server struct {
 	stopc     chan struct{}
 	errc      chan error
 	closeOnce sync.Once
+	draining  atomic.Bool
 	startedAt time.Time
 
+	// inFlight is the number of HTTP requests and gRPC calls in progress
+	inFlight     atomic.Int64
+	shutdownOnce sync.Once
+	reportLock   sync.Mutex
+	report       *ShutdownReport
+
 	services map[string]Service
 
 	authz    *authz.Provider
 	identity roles.IdentityProvider
 	disco    discovery.Discovery
+	load     *ready.LoadMonitor
+	redactor *redact.Redactor
+	health   *health.Server
+	tracing  *tracing
+	security *securityMonitor
+	admin    *adminServer
+
+	accessLog     telemetry.AccessLogSink
+	accessLogFile *telemetry.JSONAccessLogSink
 
 	opts options
 }
@@ -180,6 +204,66 @@ func Start(
 		}
 	}
 
+	if err = cfg.Internal.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Internal.GetEnabled() && e.authz == nil &&
+		(cfg.Internal.Debug || len(cfg.Internal.MetricsRoles) > 0) {
+		err = errors.New("authz must be configured to restrict the internal endpoints by roles")
+		return nil, err
+	}
+	cfg.Internal.Allow(e.authz)
+
+	if err = cfg.Admin.Validate(); err != nil {
+		return nil, err
+	}
+
+	e.security = newSecurityMonitor(name, cfg.SecurityEvents, e.opts.securityEvents)
+	if e.security != nil && e.authz != nil {
+		e.authz.OnDenied(e.security.authzDenied)
+	}
+
+	e.redactor, err = cfg.DebugRedaction.Redactor()
+	if err != nil {
+		return nil, errors.WithMessage(err, "invalid debug_redaction")
+	}
+
+	e.accessLog = e.opts.accessLogSink
+	if e.accessLog == nil && cfg.AccessLog != nil && cfg.AccessLog.File != "" {
+		e.accessLogFile, err = telemetry.OpenJSONAccessLog(cfg.AccessLog.File)
+		if err != nil {
+			return nil, err
+		}
+		e.accessLog = e.accessLogFile
+	}
+
+	if cfg.Tracing.GetEnabled() {
+		e.tracing, err = newTracing(name, cfg.Tracing)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Readiness.GetEnabled() {
+		e.load = ready.NewLoadMonitor(ready.LoadThresholds{
+			MaxInFlight: cfg.Readiness.MaxInFlight,
+			MaxLatency:  cfg.Readiness.MaxLatency,
+			RetryAfter:  cfg.Readiness.RetryAfter,
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-e.stopc
+			cancel()
+		}()
+		go e.load.Run(ctx, cfg.Readiness.SampleInterval)
+	}
+
+	e.startHealth()
+
+	if err = e.serveAdmin(); err != nil {
+		return e, err
+	}
+
 	if err = e.serveClients(); err != nil {
 		return e, err
 	}
@@ -258,7 +342,8 @@ func (e *Server) serveClients() (err error) {
 	// start client servers in each goroutine
 	for _, sctx := range e.sctxs {
 		go func(s *serveCtx) {
-			e.errHandler(s.serve(e, e.errHandler))
+			errHandler := e.listenerErrHandler(s.addr)
+			errHandler(s.serve(e, errHandler))
 		}(sctx)
 	}
 	return nil
@@ -280,74 +365,203 @@ func (e *Server) errHandler(err error) {
 }
 
 // Close gracefully shuts down all servers/listeners.
-// Client requests will be terminated with request timeout.
+// The server reports not ready for the Shutdown.Delay period,
+// then stops accepting new connections and drains in-flight requests.
 // After timeout, enforce remaning requests be closed immediately.
 func (e *Server) Close() {
-	logger.KV(xlog.INFO, "server", e.Name())
+	e.shutdown(ShutdownClosed, nil)
+}
 
-	for _, svc := range e.services {
-		svc.Close()
+// shutdown closes the server once, the concurrent calls wait
+// until the first one completes
+func (e *Server) shutdown(reason string, lerr *ListenerError) {
+	e.shutdownOnce.Do(func() {
+		e.close(reason, lerr)
+	})
+}
+
+func (e *Server) close(reason string, lerr *ListenerError) {
+	logger.KV(xlog.INFO, "server", e.Name(), "status", "closing", "reason", reason)
+
+	report := &ShutdownReport{
+		Server:    e.Name(),
+		Reason:    reason,
+		StartedAt: time.Now(),
+	}
+	if lerr != nil {
+		report.Listener = lerr.Listener
+		report.Error = lerr.Err.Error()
 	}
 
 	e.closeOnce.Do(func() { close(e.stopc) })
 
-	// close client requests with request timeout
-	timeout := 3 * time.Second
-	if e.cfg.Timeout.Request != 0 {
-		timeout = e.cfg.Timeout.Request
+	if !e.draining.Swap(true) {
+		if e.health != nil {
+			// announce NOT_SERVING to the health checking clients
+			e.health.Shutdown()
+		}
+		if delay := e.cfg.Shutdown.GetDelay(); delay > 0 {
+			logger.KV(xlog.INFO, "server", e.Name(), "status", "not_serving", "delay", delay)
+			time.Sleep(delay)
+		}
 	}
+
+	// stop accepting new connections
+	for i := range e.Listeners {
+		if e.Listeners[i] != nil {
+			e.Listeners[i].Close()
+		}
+	}
+	if e.cfg.UnixSocket.GetUnlink() {
+		for _, sctx := range e.sctxs {
+			if sctx.network == "unix" {
+				unlinkSocket(sctx.addr)
+			}
+		}
+	}
+
+	// drain client requests up to the deadline
+	timeout := e.shutdownTimeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	report.InFlight = e.inFlight.Load()
+
+	var wg sync.WaitGroup
+	var forced atomic.Int32
 	for _, sctx := range e.sctxs {
 		for ss := range sctx.serversC {
-			ctx, cancel := context.WithTimeout(context.Background(), timeout)
-			stopServers(ctx, ss)
-			cancel()
+			wg.Add(1)
+			go func(ss *servers) {
+				defer wg.Done()
+				if stopServers(ctx, ss) {
+					forced.Add(1)
+				}
+			}(ss)
 		}
 	}
+	wg.Wait()
+
+	report.ForcedCloses = int(forced.Load())
+	if report.ForcedCloses > 0 {
+		// the requests cancelled by the forced close are not drained
+		report.Drained = report.InFlight - e.inFlight.Load()
+		if report.Drained < 0 {
+			report.Drained = 0
+		}
+	} else {
+		report.Drained = report.InFlight
+	}
+
+	logger.KV(xlog.INFO, "server", e.Name(), "status", "drained", "timeout", timeout)
+
+	e.admin.close()
+
+	for _, svc := range e.services {
+		svc.Close()
+	}
 
 	for _, sctx := range e.sctxs {
 		sctx.cancel()
 	}
 
-	for i := range e.Listeners {
-		if e.Listeners[i] != nil {
-			e.Listeners[i].Close()
-		}
+	// flush the pending spans
+	tctx, tcancel := context.WithTimeout(context.Background(), timeout)
+	defer tcancel()
+	e.tracing.shutdown(tctx)
+
+	if e.accessLogFile != nil {
+		_ = e.accessLogFile.Close()
+	}
+
+	report.Duration = time.Since(report.StartedAt)
+	e.reportLock.Lock()
+	e.report = report
+	e.reportLock.Unlock()
+
+	logger.KV(xlog.NOTICE,
+		"server", report.Server,
+		"status", "shutdown",
+		"reason", report.Reason,
+		"listener", report.Listener,
+		"in_flight", report.InFlight,
+		"drained", report.Drained,
+		"forced_closes", report.ForcedCloses,
+		"duration", report.Duration)
+
+	for _, l := range e.opts.shutdownListeners {
+		l(report)
 	}
 }
 
-func stopServers(ctx context.Context, ss *servers) {
-	shutdownNow := func() {
-		// first, close the http.Server
-		_ = ss.http.Shutdown(ctx)
-		// then close grpc.Server; cancels all active RPCs
-		ss.grpc.Stop()
+// IsDraining returns true when the server is shutting down
+func (e *Server) IsDraining() bool {
+	return e.draining.Load()
+}
+
+func (e *Server) shutdownTimeout() time.Duration {
+	if e.opts.shutdownTimeout > 0 {
+		return e.opts.shutdownTimeout
+	}
+	if timeout := e.cfg.Shutdown.GetTimeout(); timeout > 0 {
+		return timeout
+	}
+	if e.cfg.Timeout.Request > 0 {
+		return e.cfg.Timeout.Request
 	}
+	return 3 * time.Second
+}
 
-	// do not grpc.Server.GracefulStop with TLS enabled server
-	// See https://github.com/grpc/grpc-go/issues/1384#issuecomment-317124531
-	if ss.secure {
-		shutdownNow()
-		return
+// stopServers returns true if the servers were closed
+// after the timeout, with the remaining requests cancelled
+func stopServers(ctx context.Context, ss *servers) bool {
+	if ss.drainer != nil {
+		ss.drainer.Close()
+	}
+	if ss.h3 != nil {
+		// HTTP/3 connections are closed immediately
+		_ = ss.h3.Close()
+		_ = ss.udp.Close()
 	}
 
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		// drain in-flight HTTP requests,
+		// including gRPC served by the HTTP handler on TLS enabled server
+		_ = ss.http.Shutdown(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		// do not grpc.Server.GracefulStop with TLS enabled server
+		// See https://github.com/grpc/grpc-go/issues/1384#issuecomment-317124531
+		if !ss.secure {
+			// will block on any existing transports
+			ss.grpc.GracefulStop()
+		}
+	}()
+
 	ch := make(chan struct{})
 	go func() {
-		defer close(ch)
-		// close listeners to stop accepting new connections,
-		// will block on any existing transports
-		ss.grpc.GracefulStop()
+		wg.Wait()
+		close(ch)
 	}()
 
-	// wait until all pending RPCs are finished
+	// wait until all pending requests are finished
 	select {
 	case <-ch:
+		ss.grpc.Stop()
+		return false
 	case <-ctx.Done():
-		// took too long, manually close open transports
+		// took too long, force close open connections
 		// e.g. watch streams
-		shutdownNow()
-
+		_ = ss.http.Close()
+		// cancels all active RPCs,
 		// concurrent GracefulStop should be interrupted
+		ss.grpc.Stop()
 		<-ch
+		return true
 	}
 }
 
@@ -2,20 +2,41 @@ package gserver_test
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/effective-security/porto/gserver"
+	"github.com/effective-security/porto/gserver/roles"
 	"github.com/effective-security/porto/pkg/discovery"
 	"github.com/effective-security/porto/pkg/retriable"
 	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/restserver/authz"
+	"github.com/effective-security/porto/restserver/deprecation"
+	"github.com/effective-security/porto/restserver/opsroutes"
 	"github.com/effective-security/porto/tests/mockappcontainer"
 	"github.com/effective-security/porto/tests/testutils"
 	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/xpki/jwt"
+	"github.com/quic-go/quic-go/http3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func TestStartEmptyHTTP(t *testing.T) {
@@ -96,15 +117,692 @@ func TestRateLimit(t *testing.T) {
 			assert.NoError(t, err)
 			assert.Equal(t, "1", hdr.Get("RateLimit-Limit"))
 			assert.Equal(t, "0", hdr.Get("RateLimit-Remaining"))
+			assert.Equal(t, "1", hdr.Get(header.XRateLimitLimit))
+			assert.Equal(t, "0", hdr.Get(header.XRateLimitRemaining))
+			assert.Equal(t, "1", hdr.Get(header.XRateLimitReset))
 		} else {
-			assert.EqualError(t, err, "You have reached maximum request limit.")
-			assert.Equal(t, "1.00", hdr.Get("X-Rate-Limit-Limit"))
-			assert.Equal(t, "1", hdr.Get("X-Rate-Limit-Duration"))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "rate_limit_exceeded: rate limit exceeded")
+			herr, ok := err.(*httperror.Error)
+			require.True(t, ok)
+			assert.Equal(t, time.Second, herr.RetryAfter())
+			assert.Equal(t, "1", hdr.Get(header.RetryAfter))
+			assert.Equal(t, "1", hdr.Get(header.XRateLimitLimit))
+			assert.Equal(t, "0", hdr.Get(header.XRateLimitRemaining))
 			assert.Equal(t, http.StatusTooManyRequests, status)
 		}
 	}
 }
 
+func TestRequestLimits(t *testing.T) {
+	cfg := &gserver.Config{
+		ListenURLs:     []string{testutils.CreateURL("http", "")},
+		Services:       []string{"test"},
+		MaxRequestSize: 16,
+	}
+	cfg.Timeout.ReadHeader = 100 * time.Millisecond
+
+	c := mockappcontainer.NewBuilder().
+		WithJwtParser(nil).
+		WithDiscovery(discovery.New()).
+		Container()
+
+	fact := map[string]gserver.ServiceFactory{
+		"test": testServiceFactory,
+	}
+	srv, err := gserver.Start("TestRequestLimits", cfg, c, fact)
+	require.NoError(t, err)
+	require.NotNil(t, srv)
+	defer srv.Close()
+
+	res, err := http.Post(cfg.ListenURLs[0]+"/status", header.ApplicationJSON, strings.NewReader(strings.Repeat("a", 100)))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), httperror.CodeRequestTooLarge)
+
+	// the slow client is disconnected after ReadHeader timeout
+	conn, err := net.Dial("tcp", strings.TrimPrefix(cfg.ListenURLs[0], "http://"))
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /status HTTP/1.1\r\n"))
+	require.NoError(t, err)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = conn.Read(make([]byte, 1))
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, os.ErrDeadlineExceeded), "connection must be closed by the server")
+}
+
+func TestEarlyPreflight(t *testing.T) {
+	enabled := true
+	cfg := &gserver.Config{
+		ListenURLs: []string{testutils.CreateURL("http", "")},
+		Services:   []string{"test"},
+		CORS: &gserver.CORS{
+			Enabled:        &enabled,
+			EarlyPreflight: &enabled,
+			AllowedOrigins: []string{"https://app.test"},
+			AllowedMethods: []string{http.MethodGet},
+		},
+		RateLimit: &gserver.RateLimit{
+			Enabled:           &enabled,
+			RequestsPerSecond: 1,
+		},
+	}
+
+	c := mockappcontainer.NewBuilder().
+		WithJwtParser(nil).
+		WithDiscovery(discovery.New()).
+		Container()
+
+	fact := map[string]gserver.ServiceFactory{
+		"test": testServiceFactory,
+	}
+	srv, err := gserver.Start("TestEarlyPreflight", cfg, c, fact)
+	require.NoError(t, err)
+	require.NotNil(t, srv)
+	defer srv.Close()
+
+	// the preflight requests are not rate limited
+	for i := 0; i < 3; i++ {
+		req, err := http.NewRequest(http.MethodOptions, cfg.ListenURLs[0]+"/status", nil)
+		require.NoError(t, err)
+		req.Header.Set("Origin", "https://app.test")
+		req.Header.Set(header.AccessControlRequestMethod, http.MethodGet)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		assert.Equal(t, "https://app.test", resp.Header.Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, resp.Header.Get("RateLimit-Limit"))
+	}
+
+	resp, err := http.Get(cfg.ListenURLs[0] + "/status")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestReadiness(t *testing.T) {
+	enabled := true
+	cfg := &gserver.Config{
+		ListenURLs: []string{testutils.CreateURL("http", "")},
+		Services:   []string{"test"},
+		Readiness: &gserver.Readiness{
+			Enabled: &enabled,
+			// any timer delay crosses the threshold
+			MaxLatency:     time.Nanosecond,
+			SampleInterval: time.Millisecond,
+			RetryAfter:     time.Second,
+		},
+	}
+	assert.Equal(t, []string{"/readyz"}, cfg.Readiness.GetPaths())
+
+	c := mockappcontainer.NewBuilder().
+		WithJwtParser(nil).
+		WithDiscovery(discovery.New()).
+		Container()
+
+	fact := map[string]gserver.ServiceFactory{
+		"test": testServiceFactory,
+	}
+	srv, err := gserver.Start("TestReadiness", cfg, c, fact)
+	require.NoError(t, err)
+	require.NotNil(t, srv)
+	defer srv.Close()
+
+	client, err := retriable.Default(cfg.ListenURLs[0])
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.Eventually(t, func() bool {
+		_, status, _ := client.Get(ctx, "/readyz", httptest.NewRecorder())
+		return status == http.StatusTooManyRequests
+	}, 3*time.Second, 10*time.Millisecond)
+
+	hdr, _, err := client.Get(ctx, "/readyz", httptest.NewRecorder())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "degraded: the service is degraded: scheduler latency")
+	assert.Equal(t, "1", hdr.Get(header.RetryAfter))
+
+	// not a probe path
+	_, status, err := client.Get(ctx, "/status", httptest.NewRecorder())
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestDeprecations(t *testing.T) {
+	cfg := &gserver.Config{
+		ListenURLs: []string{testutils.CreateURL("http", "")},
+		Services:   []string{"test"},
+		Deprecations: []*deprecation.Endpoint{
+			{
+				Path:   "/status",
+				Sunset: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	c := mockappcontainer.NewBuilder().
+		WithJwtParser(nil).
+		WithDiscovery(discovery.New()).
+		Container()
+
+	fact := map[string]gserver.ServiceFactory{
+		"test": testServiceFactory,
+	}
+	srv, err := gserver.Start("TestDeprecations", cfg, c, fact)
+	require.NoError(t, err)
+	require.NotNil(t, srv)
+	defer srv.Close()
+
+	client, err := retriable.Default(cfg.ListenURLs[0])
+	require.NoError(t, err)
+
+	hdr, status, err := client.Get(context.Background(), "/status", httptest.NewRecorder())
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "true", hdr.Get(header.Deprecation))
+	assert.Equal(t, "Tue, 01 Jan 2030 00:00:00 GMT", hdr.Get(header.Sunset))
+}
+
+func TestInternalEndpoints(t *testing.T) {
+	enabled := true
+	cfg := &gserver.Config{
+		ListenURLs: []string{testutils.CreateURL("http", "")},
+		Services:   []string{"test"},
+		Authz: &authz.Config{
+			AllowAny: []string{"/status"},
+		},
+		Internal: &opsroutes.Config{
+			Enabled:    &enabled,
+			Debug:      true,
+			DebugRoles: []string{"admin"},
+		},
+	}
+
+	c := mockappcontainer.NewBuilder().
+		WithJwtParser(nil).
+		WithDiscovery(discovery.New()).
+		Container()
+
+	fact := map[string]gserver.ServiceFactory{
+		"test": testServiceFactory,
+	}
+	srv, err := gserver.Start("TestInternalEndpoints", cfg, c, fact)
+	require.NoError(t, err)
+	require.NotNil(t, srv)
+	defer srv.Close()
+
+	client, err := retriable.Default(cfg.ListenURLs[0])
+	require.NoError(t, err)
+
+	for _, p := range []string{"/healthz", "/readyz", "/metrics"} {
+		_, status, err := client.Get(context.Background(), p, httptest.NewRecorder())
+		require.NoError(t, err, p)
+		assert.Equal(t, http.StatusOK, status, p)
+	}
+	_, status, _ := client.Get(context.Background(), "/debug/pprof/", httptest.NewRecorder())
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// roles require authz
+	cfg.Authz = nil
+	cfg.ListenURLs = []string{testutils.CreateURL("http", "")}
+	_, err = gserver.Start("TestInternalEndpointsNoAuthz", cfg, c, fact)
+	assert.EqualError(t, err, "authz must be configured to restrict the internal endpoints by roles")
+
+	cfg.Internal.DebugRoles = nil
+	cfg.ListenURLs = []string{testutils.CreateURL("http", "")}
+	_, err = gserver.Start("TestInternalEndpointsInvalid", cfg, c, fact)
+	assert.EqualError(t, err, "opsroutes: debug_roles are required for debug endpoints")
+}
+
+func TestAdminListener(t *testing.T) {
+	enabled := true
+	cfg := &gserver.Config{
+		ListenURLs: []string{testutils.CreateURL("http", "")},
+		Services:   []string{"test"},
+		IdentityMap: &roles.IdentityMap{
+			JWT: roles.JWTIdentityMap{
+				Enabled:                  true,
+				DefaultAuthenticatedRole: "jwt_user",
+				Roles: map[string][]string{
+					"admin": {"admin@test.com"},
+				},
+			},
+		},
+		Admin: &gserver.Admin{
+			Enabled:   &enabled,
+			ListenURL: testutils.CreateURL("http", ""),
+			Roles:     []string{"admin"},
+		},
+	}
+
+	c := mockappcontainer.NewBuilder().
+		WithJwtParser(mockJWT{
+			"admin-token": {"sub": "admin", "email": "admin@test.com"},
+			"user-token":  {"sub": "user", "email": "user@test.com"},
+		}).
+		WithDiscovery(discovery.New()).
+		Container()
+
+	fact := map[string]gserver.ServiceFactory{
+		"test": testServiceFactory,
+	}
+	srv, err := gserver.Start("TestAdminListener", cfg, c, fact)
+	require.NoError(t, err)
+	require.NotNil(t, srv)
+	defer srv.Close()
+
+	get := func(u, token string) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set(header.Authorization, "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, string(body)
+	}
+
+	adminURL := cfg.Admin.ListenURL
+	code, _ := get(adminURL+"/debug/pprof/", "admin-token")
+	assert.Equal(t, http.StatusOK, code)
+	code, body := get(adminURL+gserver.AdminVarsPath, "admin-token")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "memstats")
+	code, body = get(adminURL+gserver.AdminRuntimePath, "admin-token")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "/sched/goroutines:goroutines")
+	// authz is applied before routing
+	code, _ = get(adminURL+"/status", "admin-token")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// the roles are enforced
+	code, _ = get(adminURL+"/debug/pprof/", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = get(adminURL+gserver.AdminVarsPath, "user-token")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// not exposed on the public listener
+	code, _ = get(cfg.ListenURLs[0]+gserver.AdminVarsPath, "admin-token")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	conn, err := grpc.NewClient(strings.TrimPrefix(adminURL, "http://"),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	channelz := channelzpb.NewChannelzClient(conn)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer admin-token")
+	servers, err := channelz.GetServers(ctx, &channelzpb.GetServersRequest{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, servers.Server)
+
+	_, err = channelz.GetServers(context.Background(), &channelzpb.GetServersRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	ctx = metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer user-token")
+	_, err = channelz.GetServers(ctx, &channelzpb.GetServersRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	cfg.ListenURLs = []string{testutils.CreateURL("http", "")}
+	cfg.Admin.Roles = []string{"guest"}
+	_, err = gserver.Start("TestAdminListenerGuest", cfg, c, fact)
+	assert.EqualError(t, err, "admin: guest role is not allowed")
+
+	cfg.ListenURLs = []string{testutils.CreateURL("http", "")}
+	cfg.Admin.Roles = nil
+	_, err = gserver.Start("TestAdminListenerInvalid", cfg, c, fact)
+	assert.EqualError(t, err, "admin: roles are required")
+}
+
+// mockJWT returns the claims by the token
+type mockJWT map[string]jwt.MapClaims
+
+func (m mockJWT) GetRevocation() jwt.Revocation {
+	return nil
+}
+
+func (m mockJWT) SetRevocation(jwt.Revocation) {
+}
+
+func (m mockJWT) ParseToken(_ context.Context, token string, _ *jwt.VerifyConfig) (jwt.MapClaims, error) {
+	claims, ok := m[token]
+	if !ok {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	enabled := true
+	cfg := &gserver.Config{
+		ListenURLs: []string{testutils.CreateURL("http", "")},
+		Services:   []string{"test"},
+		Internal: &opsroutes.Config{
+			Enabled: &enabled,
+		},
+		Shutdown: &gserver.Shutdown{
+			Delay:   200 * time.Millisecond,
+			Timeout: 2 * time.Second,
+		},
+	}
+
+	c := mockappcontainer.NewBuilder().
+		WithJwtParser(nil).
+		WithDiscovery(discovery.New()).
+		Container()
+
+	fact := map[string]gserver.ServiceFactory{
+		"test": testServiceFactory,
+	}
+	srv, err := gserver.Start("TestGracefulShutdown", cfg, c, fact)
+	require.NoError(t, err)
+	require.NotNil(t, srv)
+
+	get := func(path string) int {
+		resp, err := http.Get(cfg.ListenURLs[0] + path)
+		if err != nil {
+			return 0
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+	require.Equal(t, http.StatusOK, get("/readyz"))
+
+	slow := make(chan int, 1)
+	go func() {
+		slow <- get("/slow")
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		srv.Close()
+		close(closed)
+	}()
+
+	// still serving, but not ready during the delay
+	require.Eventually(t, func() bool {
+		return get("/readyz") == http.StatusServiceUnavailable
+	}, time.Second, 10*time.Millisecond)
+	assert.True(t, srv.(*gserver.Server).IsDraining())
+
+	// in-flight request is drained
+	assert.Equal(t, http.StatusOK, <-slow)
+	<-closed
+	assert.Equal(t, 0, get("/status"))
+}
+
+func TestRunShutdownReport(t *testing.T) {
+	cfg := &gserver.Config{
+		ListenURLs: []string{testutils.CreateURL("http", "")},
+		Services:   []string{"test"},
+	}
+
+	c := mockappcontainer.NewBuilder().
+		WithJwtParser(nil).
+		WithDiscovery(discovery.New()).
+		Container()
+
+	fact := map[string]gserver.ServiceFactory{
+		"test": testServiceFactory,
+	}
+	reported := make(chan *gserver.ShutdownReport, 1)
+	srv, err := gserver.Start("TestRunShutdownReport", cfg, c, fact,
+		gserver.WithShutdownListener(func(r *gserver.ShutdownReport) {
+			reported <- r
+		}))
+	require.NoError(t, err)
+	require.NotNil(t, srv)
+
+	slow := make(chan struct{})
+	go func() {
+		defer close(slow)
+		resp, err := http.Get(cfg.ListenURLs[0] + "/slow")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err := srv.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, gserver.ExitOK, gserver.ExitCode(err))
+	<-slow
+
+	require.NotNil(t, report)
+	assert.Equal(t, "TestRunShutdownReport", report.Server)
+	assert.Equal(t, gserver.ShutdownCanceled, report.Reason)
+	assert.Equal(t, int64(1), report.InFlight)
+	assert.Equal(t, int64(1), report.Drained)
+	assert.Zero(t, report.ForcedCloses)
+	assert.Positive(t, report.Duration)
+	assert.Same(t, report, <-reported)
+	assert.Same(t, report, srv.(*gserver.Server).ShutdownReport())
+
+	// the report of the first shutdown is kept
+	srv.Close()
+	assert.Same(t, report, srv.(*gserver.Server).ShutdownReport())
+}
+
+func TestExitCode(t *testing.T) {
+	lerr := &gserver.ListenerError{Listener: "127.0.0.1:8080", Err: errors.New("accept failed")}
+	assert.EqualError(t, lerr, "listener 127.0.0.1:8080: accept failed")
+	derr := &gserver.DrainTimeoutError{Remaining: 2, ForcedCloses: 1}
+	assert.EqualError(t, derr, "shutdown timeout: 2 requests cancelled, 1 servers closed")
+
+	assert.Equal(t, gserver.ExitOK, gserver.ExitCode(nil))
+	assert.Equal(t, gserver.ExitFailure, gserver.ExitCode(errors.New("failed")))
+	assert.Equal(t, gserver.ExitListenerFailed, gserver.ExitCode(lerr))
+	assert.Equal(t, gserver.ExitDrainTimeout, gserver.ExitCode(derr))
+	assert.True(t, errors.Is(lerr, lerr.Err))
+}
+
+func TestHealthService(t *testing.T) {
+	cfg := &gserver.Config{
+		ListenURLs: []string{testutils.CreateURL("http", "")},
+		Services:   []string{"test"},
+		Health: &gserver.Health{
+			Interval: 10 * time.Millisecond,
+		},
+	}
+
+	c := mockappcontainer.NewBuilder().
+		WithJwtParser(nil).
+		WithDiscovery(discovery.New()).
+		Container()
+
+	fact := map[string]gserver.ServiceFactory{
+		"test": testServiceFactory,
+	}
+	srv, err := gserver.Start("TestHealthService", cfg, c, fact)
+	require.NoError(t, err)
+	require.NotNil(t, srv)
+	defer srv.Close()
+
+	conn, err := grpc.NewClient(strings.TrimPrefix(cfg.ListenURLs[0], "http://"),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	client := healthpb.NewHealthClient(conn)
+	for _, name := range []string{"", "test"} {
+		res, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: name})
+		require.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, res.Status, name)
+	}
+
+	_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestGRPCRateLimit(t *testing.T) {
+	enabled := true
+	cfg := &gserver.Config{
+		ListenURLs: []string{testutils.CreateURL("http", "")},
+		Services:   []string{"test"},
+		GRPCRateLimit: &gserver.GRPCRateLimit{
+			Enabled: &enabled,
+			Methods: map[string]float64{
+				"/grpc.health.v1.Health": 1,
+			},
+		},
+	}
+
+	c := mockappcontainer.NewBuilder().
+		WithJwtParser(nil).
+		WithDiscovery(discovery.New()).
+		Container()
+
+	fact := map[string]gserver.ServiceFactory{
+		"test": testServiceFactory,
+	}
+	srv, err := gserver.Start("TestGRPCRateLimit", cfg, c, fact)
+	require.NoError(t, err)
+	require.NotNil(t, srv)
+	defer srv.Close()
+
+	conn, err := grpc.NewClient(strings.TrimPrefix(cfg.ListenURLs[0], "http://"),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx := context.Background()
+	client := healthpb.NewHealthClient(conn)
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	var md metadata.MD
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Header(&md))
+	require.Error(t, err)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{"1"}, md.Get(header.RetryAfter))
+
+	herr := httperror.NewFromPb(err)
+	assert.Equal(t, httperror.CodeRateLimitExceeded, herr.Code)
+	assert.Equal(t, time.Second, herr.RetryAfter())
+
+	// the limit is per method
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.NoError(t, err)
+
+	stream, err = client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestH2C(t *testing.T) {
+	enabled := true
+	cfg := &gserver.Config{
+		ListenURLs: []string{testutils.CreateURL("http", "")},
+		Services:   []string{"test"},
+		H2C:        &enabled,
+	}
+
+	c := mockappcontainer.NewBuilder().
+		WithJwtParser(nil).
+		WithDiscovery(discovery.New()).
+		Container()
+
+	fact := map[string]gserver.ServiceFactory{
+		"test": testServiceFactory,
+	}
+	srv, err := gserver.Start("TestH2C", cfg, c, fact)
+	require.NoError(t, err)
+	require.NotNil(t, srv)
+	defer srv.Close()
+
+	// prior knowledge
+	client := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		},
+	}
+	res, err := client.Get(cfg.ListenURLs[0] + "/status")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, 2, res.ProtoMajor)
+
+	// HTTP/1.1
+	res, err = http.Get(cfg.ListenURLs[0] + "/status")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, 1, res.ProtoMajor)
+
+	// gRPC
+	conn, err := grpc.NewClient(strings.TrimPrefix(cfg.ListenURLs[0], "http://"),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	hc, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, hc.Status)
+}
+
+func TestTracing(t *testing.T) {
+	enabled := true
+	cfg := &gserver.Config{
+		ListenURLs: []string{testutils.CreateURL("http", "")},
+		Services:   []string{"test"},
+		Tracing: &gserver.Tracing{
+			Enabled:    &enabled,
+			Attributes: map[string]string{"deployment.environment": "test"},
+		},
+	}
+	assert.Equal(t, float64(1), cfg.Tracing.GetSamplingRatio())
+
+	c := mockappcontainer.NewBuilder().
+		WithJwtParser(nil).
+		WithDiscovery(discovery.New()).
+		Container()
+
+	fact := map[string]gserver.ServiceFactory{
+		"test": testServiceFactory,
+	}
+	srv, err := gserver.Start("TestTracing", cfg, c, fact)
+	require.NoError(t, err)
+	require.NotNil(t, srv)
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, cfg.ListenURLs[0]+"/status", nil)
+	require.NoError(t, err)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	// the trace ID is used as Correlation ID
+	assert.Equal(t, "4bf92f3577b3", resp.Header.Get(header.XCorrelationID))
+
+	// the provided Correlation ID is preserved
+	req.Header.Set(header.XCorrelationID, "client-id")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "client-id", resp.Header.Get(header.XCorrelationID))
+}
+
 func TestStartEmptyHTTPS(t *testing.T) {
 	cfg := &gserver.Config{
 		ListenURLs: []string{testutils.CreateURL("https", ""), testutils.CreateURL("unixs", "localhost")},
@@ -128,6 +826,52 @@ func TestStartEmptyHTTPS(t *testing.T) {
 	assert.Equal(t, "EmptyHTTPS", srv.Name())
 }
 
+func TestQUIC(t *testing.T) {
+	addr := testutils.CreateBindAddr("127.0.0.1")
+	cfg := &gserver.Config{
+		ListenURLs: []string{"https+quic://" + addr},
+		Services:   []string{"test"},
+		ServerTLS: &gserver.TLSInfo{
+			CertFile:      "testdata/test-server.pem",
+			KeyFile:       "testdata/test-server-key.pem",
+			TrustedCAFile: "testdata/test-server-rootca.pem",
+		},
+	}
+
+	c := mockappcontainer.NewBuilder().
+		WithJwtParser(nil).
+		WithDiscovery(discovery.New()).
+		Container()
+
+	fact := map[string]gserver.ServiceFactory{
+		"test": testServiceFactory,
+	}
+	srv, err := gserver.Start("TestQUIC", cfg, c, fact)
+	require.NoError(t, err)
+	require.NotNil(t, srv)
+	defer srv.Close()
+
+	// the test certificate does not have SAN
+	tlsCfg := &tls.Config{InsecureSkipVerify: true}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsCfg}}
+	res, err := client.Get("https://" + addr + "/status")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	_, port, _ := net.SplitHostPort(addr)
+	assert.Equal(t, `h3=":`+port+`"; ma=86400`, res.Header.Get(header.AltSvc))
+
+	rt := &http3.RoundTripper{TLSClientConfig: tlsCfg}
+	defer rt.Close()
+	client = &http.Client{Transport: rt}
+	res, err = client.Get("https://" + addr + "/status")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, 3, res.ProtoMajor)
+}
+
 type tservice struct{}
 
 // Name returns the service name
@@ -137,6 +881,10 @@ func (s *tservice) Close()        {}
 
 func (s *tservice) RegisterRoute(r restserver.Router) {
 	r.GET("/status", s.handler())
+	r.GET("/slow", func(w http.ResponseWriter, r *http.Request, _ restserver.Params) {
+		time.Sleep(300 * time.Millisecond)
+		s.handler()(w, r, nil)
+	})
 }
 
 func (s *tservice) handler() restserver.Handle {
@@ -0,0 +1,190 @@
+package gserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+// Reasons of the shutdown
+const (
+	// ShutdownClosed is reported when Close is called
+	ShutdownClosed = "closed"
+	// ShutdownCanceled is reported when the context of Run is done
+	ShutdownCanceled = "canceled"
+	// ShutdownListenerFailed is reported when a listener failed
+	ShutdownListenerFailed = "listener_failed"
+)
+
+// Exit codes returned by ExitCode
+const (
+	// ExitOK is returned for the graceful shutdown
+	ExitOK = 0
+	// ExitFailure is returned for the other errors
+	ExitFailure = 1
+	// ExitListenerFailed is returned when a listener failed
+	ExitListenerFailed = 2
+	// ExitDrainTimeout is returned when the in-flight requests
+	// were not drained within the shutdown timeout
+	ExitDrainTimeout = 3
+)
+
+// ShutdownReport describes the shutdown of the server
+type ShutdownReport struct {
+	Server string `json:"server"`
+	// Reason of the shutdown: closed, canceled or listener_failed
+	Reason string `json:"reason"`
+	// Listener is the address of the failed listener
+	Listener string `json:"listener,omitempty"`
+	// Error of the failed listener
+	Error string `json:"error,omitempty"`
+	// StartedAt is the time when the shutdown started
+	StartedAt time.Time `json:"started_at"`
+	// Duration of the shutdown, including the delay and the drain
+	Duration time.Duration `json:"duration"`
+	// InFlight is the number of HTTP requests and gRPC calls
+	// in flight, when the drain started
+	InFlight int64 `json:"in_flight"`
+	// Drained is the number of the in-flight requests completed during the drain
+	Drained int64 `json:"drained"`
+	// ForcedCloses is the number of the servers closed after the shutdown timeout,
+	// with the remaining requests cancelled
+	ForcedCloses int `json:"forced_closes,omitempty"`
+}
+
+// ListenerError is returned by Run when a listener failed
+type ListenerError struct {
+	// Listener is the address of the listener
+	Listener string
+	Err      error
+}
+
+// Error implements error interface
+func (e *ListenerError) Error() string {
+	return fmt.Sprintf("listener %s: %s", e.Listener, e.Err.Error())
+}
+
+// Unwrap returns the error of the listener
+func (e *ListenerError) Unwrap() error {
+	return e.Err
+}
+
+// DrainTimeoutError is returned by Run when the in-flight requests
+// were not drained within the shutdown timeout
+type DrainTimeoutError struct {
+	// Remaining is the number of the requests, cancelled by the forced close
+	Remaining int64
+	// ForcedCloses is the number of the servers closed after the timeout
+	ForcedCloses int
+}
+
+// Error implements error interface
+func (e *DrainTimeoutError) Error() string {
+	return fmt.Sprintf("shutdown timeout: %d requests cancelled, %d servers closed",
+		e.Remaining, e.ForcedCloses)
+}
+
+// ExitCode returns the process exit code for the error returned by Run
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var lerr *ListenerError
+	if errors.As(err, &lerr) {
+		return ExitListenerFailed
+	}
+	var derr *DrainTimeoutError
+	if errors.As(err, &derr) {
+		return ExitDrainTimeout
+	}
+	return ExitFailure
+}
+
+// Run waits until the context is done or a listener fails,
+// then gracefully shuts down the server.
+// The returned error is ListenerError if a listener failed,
+// or DrainTimeoutError if the requests were not drained within the shutdown timeout.
+func (e *Server) Run(ctx context.Context) (*ShutdownReport, error) {
+	var lerr *ListenerError
+	for lerr == nil {
+		select {
+		case <-ctx.Done():
+			e.shutdown(ShutdownCanceled, nil)
+			return e.ShutdownReport(), e.reportErr()
+		case <-e.stopc:
+			// closed by Close, wait for the report
+			e.Close()
+			return e.ShutdownReport(), e.reportErr()
+		case err := <-e.errc:
+			if err == nil {
+				continue
+			}
+			if !errors.As(err, &lerr) {
+				lerr = &ListenerError{Err: err}
+			}
+		}
+	}
+	e.shutdown(ShutdownListenerFailed, lerr)
+	return e.ShutdownReport(), lerr
+}
+
+// ShutdownReport returns the report of the shutdown,
+// or nil if the server is not closed
+func (e *Server) ShutdownReport() *ShutdownReport {
+	e.reportLock.Lock()
+	defer e.reportLock.Unlock()
+	return e.report
+}
+
+// reportErr returns DrainTimeoutError for the forced shutdown
+func (e *Server) reportErr() error {
+	r := e.ShutdownReport()
+	if r == nil || r.ForcedCloses == 0 {
+		return nil
+	}
+	return &DrainTimeoutError{
+		Remaining:    r.InFlight - r.Drained,
+		ForcedCloses: r.ForcedCloses,
+	}
+}
+
+// listenerErrHandler returns the handler, that reports the errors of the listener
+func (e *Server) listenerErrHandler(addr string) func(error) {
+	return func(err error) {
+		if err != nil {
+			err = &ListenerError{Listener: addr, Err: err}
+		}
+		e.errHandler(err)
+	}
+}
+
+// trackInFlight counts the in-flight HTTP requests
+func (e *Server) trackInFlight(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e.inFlight.Add(1)
+		defer e.inFlight.Add(-1)
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// inFlightUnaryInterceptor counts the in-flight gRPC calls
+func (e *Server) inFlightUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		e.inFlight.Add(1)
+		defer e.inFlight.Add(-1)
+		return handler(ctx, req)
+	}
+}
+
+// inFlightStreamInterceptor counts the in-flight gRPC streams
+func (e *Server) inFlightStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		e.inFlight.Add(1)
+		defer e.inFlight.Add(-1)
+		return handler(srv, ss)
+	}
+}
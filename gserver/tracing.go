@@ -0,0 +1,118 @@
+package gserver
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/effective-security/porto/xhttp/correlation"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// tracing provides OpenTelemetry instrumentation of the server
+type tracing struct {
+	provider   *sdktrace.TracerProvider
+	propagator propagation.TextMapPropagator
+}
+
+func newTracing(name string, cfg *Tracing) (*tracing, error) {
+	attrs := []attribute.KeyValue{attribute.String("service.name", name)}
+	for k, v := range cfg.Attributes {
+		attrs = append(attrs, attribute.String(k, v))
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(attrs...)),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.GetSamplingRatio()))),
+	}
+	if cfg.Endpoint != "" {
+		eopts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			eopts = append(eopts, otlptracehttp.WithInsecure())
+		}
+		exporter, err := otlptracehttp.New(context.Background(), eopts...)
+		if err != nil {
+			return nil, errors.WithMessage(err, "unable to create trace exporter")
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+
+	return &tracing{
+		provider: sdktrace.NewTracerProvider(opts...),
+		propagator: propagation.NewCompositeTextMapPropagator(
+			propagation.TraceContext{},
+			propagation.Baggage{},
+		),
+	}, nil
+}
+
+// handler returns HTTP handler, that starts the server span,
+// and uses the trace ID as Correlation ID, if it is not provided by the client
+func (t *tracing) handler(operation string, delegate http.Handler) http.Handler {
+	if t == nil {
+		return delegate
+	}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(header.XCorrelationID) == "" && r.Header.Get("X-Request-ID") == "" {
+			if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+				r = r.WithContext(correlation.WithIDValue(r.Context(), sc.TraceID().String()))
+			}
+		}
+		delegate.ServeHTTP(w, r)
+	})
+	return otelhttp.NewHandler(h, operation,
+		otelhttp.WithTracerProvider(t.provider),
+		otelhttp.WithPropagators(t.propagator),
+	)
+}
+
+// serverOption returns gRPC option, that starts the server spans,
+// the stats handler supersedes the deprecated otelgrpc interceptors
+func (t *tracing) serverOption() grpc.ServerOption {
+	return grpc.StatsHandler(otelgrpc.NewServerHandler(
+		otelgrpc.WithTracerProvider(t.provider),
+		otelgrpc.WithPropagators(t.propagator),
+	))
+}
+
+// unaryInterceptor uses the trace ID as Correlation ID,
+// if it is not provided by the client
+func (t *tracing) unaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !hasCorrelationMD(ctx) {
+			if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+				ctx = correlation.WithIDValue(ctx, sc.TraceID().String())
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+func hasCorrelationMD(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	return len(md[correlation.CorrelationIDgRPCHeaderName]) > 0 ||
+		len(md["x-request-id"]) > 0
+}
+
+func (t *tracing) shutdown(ctx context.Context) {
+	if t == nil {
+		return
+	}
+	if err := t.provider.Shutdown(ctx); err != nil {
+		logger.KV(xlog.ERROR, "reason", "tracing_shutdown", "err", err.Error())
+	}
+}
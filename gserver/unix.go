@@ -0,0 +1,137 @@
+package gserver
+
+import (
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+// listenUnix listens on the Unix domain socket,
+// and applies the permissions of the socket file
+func listenUnix(addr string, cfg *UnixSocket) (net.Listener, error) {
+	// the abstract sockets have no file
+	abstract := strings.HasPrefix(addr, "@")
+
+	if !abstract && cfg.GetRemoveStale() {
+		if err := removeStaleSocket(addr); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", addr)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if cfg != nil && !abstract {
+		if err = cfg.apply(addr); err != nil {
+			_ = l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// removeStaleSocket removes the socket file,
+// if no process is listening on it
+func removeStaleSocket(addr string) error {
+	fi, err := os.Lstat(addr)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return errors.Errorf("not a socket: %s", addr)
+	}
+
+	conn, err := net.DialTimeout("unix", addr, time.Second)
+	if err == nil {
+		_ = conn.Close()
+		return errors.Errorf("socket is in use: %s", addr)
+	}
+
+	logger.KV(xlog.NOTICE, "reason", "stale_socket", "address", addr)
+	if err = os.Remove(addr); err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// unlinkSocket removes the socket file on shutdown
+func unlinkSocket(addr string) {
+	if strings.HasPrefix(addr, "@") {
+		return
+	}
+	if err := os.Remove(addr); err != nil && !os.IsNotExist(err) {
+		logger.KV(xlog.ERROR, "reason", "unlink_socket", "address", addr, "err", err.Error())
+	}
+}
+
+// apply sets the mode and the owner of the socket file
+func (c *UnixSocket) apply(addr string) error {
+	if c.Mode != "" {
+		mode, err := strconv.ParseUint(c.Mode, 8, 32)
+		if err != nil {
+			return errors.Errorf("invalid socket mode: %s", c.Mode)
+		}
+		if err = os.Chmod(addr, os.FileMode(mode)); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if c.Owner == "" && c.Group == "" {
+		return nil
+	}
+
+	uid, gid := -1, -1
+	if c.Owner != "" {
+		id, err := lookupID(c.Owner, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return errors.WithMessagef(err, "invalid socket owner: %s", c.Owner)
+		}
+		uid = id
+	}
+	if c.Group != "" {
+		id, err := lookupID(c.Group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return errors.WithMessagef(err, "invalid socket group: %s", c.Group)
+		}
+		gid = id
+	}
+	return errors.WithStack(os.Lchown(addr, uid, gid))
+}
+
+// lookupID returns the numeric ID, or looks up the ID by name
+func lookupID(nameOrID string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(nameOrID); err == nil {
+		return id, nil
+	}
+	s, err := lookup(nameOrID)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	id, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return id, nil
+}
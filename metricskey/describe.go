@@ -29,6 +29,195 @@ var (
 		RequiredTags: []string{"api", "status", "role"},
 		Help:         "provides counts for gRPC request by role.",
 	}
+	// GRPCWebOversized is counter metric for rejected oversized gRPC-Web requests
+	GRPCWebOversized = metrics.Describe{
+		Type:         metrics.TypeCounter,
+		Name:         "rpc_web_oversized",
+		RequiredTags: []string{"api"},
+		Help:         "rpc_web_oversized provides the counter of gRPC-Web requests rejected for exceeding the size limit.",
+	}
+
+	// SLOBurnRate is gauge metric for SLO burn rate
+	SLOBurnRate = metrics.Describe{
+		Type:         metrics.TypeGauge,
+		Name:         "slo_burn_rate",
+		RequiredTags: []string{"slo", "window"},
+		Help:         "slo_burn_rate provides the rate of error budget consumption over the window.",
+	}
+	// SLOErrorBudget is gauge metric for SLO remaining error budget
+	SLOErrorBudget = metrics.Describe{
+		Type:         metrics.TypeGauge,
+		Name:         "slo_error_budget",
+		RequiredTags: []string{"slo"},
+		Help:         "slo_error_budget provides the fraction of error budget remaining over the longest window.",
+	}
+
+	// HTTPDeprecatedCalls is counter metric for calls to deprecated endpoints
+	HTTPDeprecatedCalls = metrics.Describe{
+		Type:         metrics.TypeCounter,
+		Name:         "http_deprecated_calls",
+		RequiredTags: []string{"method", "endpoint", "role"},
+		Help:         "http_deprecated_calls provides the counter of calls to deprecated endpoints by client role.",
+	}
+
+	// HTTPCostLimited is counter metric for requests rejected by the cost limiter
+	HTTPCostLimited = metrics.Describe{
+		Type:         metrics.TypeCounter,
+		Name:         "http_cost_limited",
+		RequiredTags: []string{"limiter", "scope"},
+		Help:         "http_cost_limited provides the counter of requests rejected by the cost limiter.",
+	}
+	// HTTPFairQueueDepth is gauge metric for the number of pending requests per tenant
+	HTTPFairQueueDepth = metrics.Describe{
+		Type:         metrics.TypeGauge,
+		Name:         "http_fair_queue_depth",
+		RequiredTags: []string{"tenant"},
+		Help:         "http_fair_queue_depth provides the number of requests pending in the fair queue by tenant.",
+	}
+	// HTTPFairQueueWait is sample metric for the time spent in the fair queue
+	HTTPFairQueueWait = metrics.Describe{
+		Type:         metrics.TypeSample,
+		Name:         "http_fair_queue_wait",
+		RequiredTags: []string{"tenant"},
+		Help:         "http_fair_queue_wait provides quantiles for the time in milliseconds the requests spent in the fair queue by tenant.",
+	}
+	// HTTPFairQueueRejected is counter metric for requests rejected by the fair queue
+	HTTPFairQueueRejected = metrics.Describe{
+		Type:         metrics.TypeCounter,
+		Name:         "http_fair_queue_rejected",
+		RequiredTags: []string{"tenant", "reason"},
+		Help:         "http_fair_queue_rejected provides the counter of requests rejected by the fair queue by reason: queue_full, timeout or cancelled.",
+	}
+
+	// AuthzShadowDivergence is counter metric for divergence of authz shadow policy
+	AuthzShadowDivergence = metrics.Describe{
+		Type:         metrics.TypeCounter,
+		Name:         "authz_shadow_divergence",
+		RequiredTags: []string{"decision", "node"},
+		Help:         "authz_shadow_divergence provides the counter of requests, where the shadow policy would_allow or would_deny.",
+	}
+	// SecurityEvents is counter metric for reported security events
+	SecurityEvents = metrics.Describe{
+		Type:         metrics.TypeCounter,
+		Name:         "security_events",
+		RequiredTags: []string{"event", "protocol"},
+		Help:         "security_events provides the counter of security events by event: auth_failures, invalid_token, authz_denied or rate_limited.",
+	}
+
+	// TLSTrustBundleUpdates is counter metric for trust bundle refreshes
+	TLSTrustBundleUpdates = metrics.Describe{
+		Type:         metrics.TypeCounter,
+		Name:         "tls_trust_bundle_updates",
+		RequiredTags: []string{"status"},
+		Help:         "tls_trust_bundle_updates provides the counter of trust bundle refreshes by status: updated, unchanged or failed.",
+	}
+
+	// TLSConnDrained is counter metric for connections drained after TLS rotation
+	TLSConnDrained = metrics.Describe{
+		Type:         metrics.TypeCounter,
+		Name:         "tls_conn_drained",
+		RequiredTags: []string{"reason", "mode"},
+		Help:         "tls_conn_drained provides the counter of connections drained after rotation of server_cert or client_ca, by mode: graceful or idle.",
+	}
+
+	// IdentityCache is counter metric for lookups in the identity cache
+	IdentityCache = metrics.Describe{
+		Type:         metrics.TypeCounter,
+		Name:         "identity_cache",
+		RequiredTags: []string{"result"},
+		Help:         "identity_cache provides the counter of identity cache lookups by result: hit or miss.",
+	}
+
+	// HTTPRetryBudget is counter metric for retries checked by the client retry budget
+	HTTPRetryBudget = metrics.Describe{
+		Type:         metrics.TypeCounter,
+		Name:         "http_retry_budget",
+		RequiredTags: []string{"client", "decision"},
+		Help:         "http_retry_budget provides the counter of client retries by decision: allowed or rejected.",
+	}
+	// HTTPRetryBudgetAvailable is gauge metric for available retries in the client retry budget
+	HTTPRetryBudgetAvailable = metrics.Describe{
+		Type:         metrics.TypeGauge,
+		Name:         "http_retry_budget_available",
+		RequiredTags: []string{"client"},
+		Help:         "http_retry_budget_available provides the number of retries available in the client retry budget.",
+	}
+	// HTTPHedge is counter metric for hedged requests
+	HTTPHedge = metrics.Describe{
+		Type:         metrics.TypeCounter,
+		Name:         "http_hedge",
+		RequiredTags: []string{"client", "result"},
+		Help:         "http_hedge provides the counter of client hedged requests by result: sent or won.",
+	}
+	// TasksScheduled is gauge metric for the number of tasks in the scheduler
+	TasksScheduled = metrics.Describe{
+		Type: metrics.TypeGauge,
+		Name: "tasks_scheduled",
+		Help: "tasks_scheduled provides the number of tasks registered in the scheduler.",
+	}
+	// TaskRuns is counter metric for task runs
+	TaskRuns = metrics.Describe{
+		Type:         metrics.TypeCounter,
+		Name:         "task_runs",
+		RequiredTags: []string{"task", "status"},
+		Help:         "task_runs provides the counter of task runs by status: succeeded, failed or skipped.",
+	}
+	// TaskRunPerf is sample metric for task run duration
+	TaskRunPerf = metrics.Describe{
+		Type:         metrics.TypeSample,
+		Name:         "task_run_perf",
+		RequiredTags: []string{"task"},
+		Help:         "task_run_perf provides quantiles for task run duration.",
+	}
+	// TaskQueueDelay is sample metric for the delay of task start after its scheduled time
+	TaskQueueDelay = metrics.Describe{
+		Type:         metrics.TypeSample,
+		Name:         "task_queue_delay",
+		RequiredTags: []string{"task"},
+		Help:         "task_queue_delay provides quantiles for the delay in milliseconds between the scheduled and the actual start of the task.",
+	}
+	// PanicsRecovered is counter metric for recovered panics
+	PanicsRecovered = metrics.Describe{
+		Type:         metrics.TypeCounter,
+		Name:         "panics_recovered",
+		RequiredTags: []string{"name"},
+		Help:         "panics_recovered provides the counter of panics recovered into errors.",
+	}
+
+	// RedisCmdPerf is sample metric for redis command latency
+	RedisCmdPerf = metrics.Describe{
+		Type:         metrics.TypeSample,
+		Name:         "redis_cmd_perf",
+		RequiredTags: []string{"cmd"},
+		Help:         "redis_cmd_perf provides quantiles for redis command latency by command, or pipeline.",
+	}
+	// RedisCmdErrors is counter metric for redis command errors
+	RedisCmdErrors = metrics.Describe{
+		Type:         metrics.TypeCounter,
+		Name:         "redis_cmd_errors",
+		RequiredTags: []string{"cmd", "type"},
+		Help:         "redis_cmd_errors provides the counter of redis command errors by type: timeout, canceled, network, pool_timeout, closed, other, or the prefix of the server error.",
+	}
+	// RedisCmdKeys is counter metric for redis commands by key prefix
+	RedisCmdKeys = metrics.Describe{
+		Type:         metrics.TypeCounter,
+		Name:         "redis_cmd_keys",
+		RequiredTags: []string{"cmd", "prefix"},
+		Help:         "redis_cmd_keys provides the counter of redis commands by the first segment of the key.",
+	}
+	// RedisKeyPrefixes is gauge metric for the number of distinct key prefixes
+	RedisKeyPrefixes = metrics.Describe{
+		Type: metrics.TypeGauge,
+		Name: "redis_key_prefixes",
+		Help: "redis_key_prefixes provides the number of distinct key prefixes used by the redis commands.",
+	}
+	// RedisPool is gauge metric for redis connection pool stats
+	RedisPool = metrics.Describe{
+		Type:         metrics.TypeGauge,
+		Name:         "redis_pool",
+		RequiredTags: []string{"stat"},
+		Help:         "redis_pool provides redis connection pool stats: hits, misses, timeouts, total_conns, idle_conns or stale_conns.",
+	}
 
 	// StatsVersion is gauge metric for app version
 	StatsVersion = metrics.Describe{
@@ -53,6 +242,31 @@ var Metrics = []*metrics.Describe{
 	&GRPCReqPerf,
 	&GRPCReqPerf,
 	&GRPCReqByRole,
+	&SLOBurnRate,
+	&SLOErrorBudget,
+	&HTTPDeprecatedCalls,
+	&HTTPCostLimited,
+	&HTTPFairQueueDepth,
+	&HTTPFairQueueWait,
+	&HTTPFairQueueRejected,
+	&AuthzShadowDivergence,
+	&SecurityEvents,
+	&TLSTrustBundleUpdates,
+	&TLSConnDrained,
+	&IdentityCache,
+	&HTTPRetryBudget,
+	&HTTPRetryBudgetAvailable,
+	&HTTPHedge,
+	&TasksScheduled,
+	&TaskRuns,
+	&TaskRunPerf,
+	&TaskQueueDelay,
+	&PanicsRecovered,
+	&RedisCmdPerf,
+	&RedisCmdErrors,
+	&RedisCmdKeys,
+	&RedisKeyPrefixes,
+	&RedisPool,
 	&StatsVersion,
 	&HealthLogErrors,
 }
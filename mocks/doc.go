@@ -0,0 +1,6 @@
+// Package mocks provides generated mocks for the porto interfaces,
+// so the consumers do not have to maintain their own.
+//
+// The mocks are generated with mockery, see .mockery.yaml in the root of the repo,
+// and can be regenerated with `make mocks`.
+package mocks
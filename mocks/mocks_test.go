@@ -0,0 +1,68 @@
+package mocks_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/effective-security/porto/gserver/roles"
+	"github.com/effective-security/porto/mocks/mockcache"
+	"github.com/effective-security/porto/mocks/mockretriable"
+	"github.com/effective-security/porto/mocks/mockroles"
+	"github.com/effective-security/porto/mocks/mocktasks"
+	"github.com/effective-security/porto/pkg/cache"
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/pkg/tasks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ retriable.GenericHTTP   = (*mockretriable.MockGenericHTTP)(nil)
+	_ retriable.HTTPClient    = (*mockretriable.MockHTTPClient)(nil)
+	_ retriable.NonceProvider = (*mockretriable.MockNonceProvider)(nil)
+	_ retriable.Requestor     = (*mockretriable.MockRequestor)(nil)
+	_ cache.KeyValue          = (*mockcache.MockKeyValue)(nil)
+	_ cache.Provider          = (*mockcache.MockProvider)(nil)
+	_ cache.PubSub            = (*mockcache.MockPubSub)(nil)
+	_ cache.Subscription      = (*mockcache.MockSubscription)(nil)
+	_ roles.IdentityProvider  = (*mockroles.MockIdentityProvider)(nil)
+	_ tasks.Publisher         = (*mocktasks.MockPublisher)(nil)
+	_ tasks.Scheduler         = (*mocktasks.MockScheduler)(nil)
+	_ tasks.Task              = (*mocktasks.MockTask)(nil)
+)
+
+func TestMockHTTPClient(t *testing.T) {
+	m := mockretriable.NewMockHTTPClient(t)
+	m.On("Get", mock.Anything, "/v1/status", mock.Anything).
+		Return(http.Header{"X-Test": []string{"1"}}, http.StatusOK, nil).
+		Once()
+
+	var c retriable.HTTPClient = m
+	hdr, status, err := c.Get(context.Background(), "/v1/status", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "1", hdr.Get("X-Test"))
+}
+
+func TestMockCache(t *testing.T) {
+	m := mockcache.NewMockProvider(t)
+	m.On("Get", mock.Anything, "key", mock.Anything).Return(cache.ErrNotFound).Once()
+
+	var v string
+	err := m.Get(context.Background(), "key", &v)
+	assert.Equal(t, cache.ErrNotFound, err)
+}
+
+func TestMockScheduler(t *testing.T) {
+	task := mocktasks.NewMockTask(t)
+	task.On("ID").Return("task1").Once()
+
+	s := mocktasks.NewMockScheduler(t)
+	s.On("Get", "task1").Return(task).Once()
+	s.On("Get", "unknown").Return(nil).Once()
+
+	assert.Equal(t, "task1", s.Get("task1").ID())
+	assert.Nil(t, s.Get("unknown"))
+}
@@ -17,9 +17,6 @@ var DefaultTTL = 30 * time.Minute
 // KeepTTL specifies to keep value
 var KeepTTL = time.Duration(-1)
 
-// NowFunc allows to override default time
-var NowFunc = time.Now
-
 // Config specifies configuration of the cache.
 type Config struct {
 	// Provider specifies the cache provider: redis|memory
@@ -35,6 +32,10 @@ type RedisConfig struct {
 	ClientTLS *gserver.TLSInfo `json:"client_tls,omitempty" yaml:"client_tls,omitempty"`
 	User      string           `json:"user,omitempty" yaml:"user,omitempty"`
 	Password  string           `json:"password,omitempty" yaml:"password,omitempty"`
+	// DisableMetrics specifies to not report the command and pool metrics
+	DisableMetrics bool `json:"disable_metrics,omitempty" yaml:"disable_metrics,omitempty"`
+	// PoolStatsInterval specifies the interval to report the pool stats, default 10s
+	PoolStatsInterval time.Duration `json:"pool_stats_interval,omitempty" yaml:"pool_stats_interval,omitempty"`
 }
 
 // Subscription defines subscription interface
@@ -46,14 +47,91 @@ type Subscription interface {
 	ReceiveMessage(ctx context.Context) (string, error)
 }
 
-// Provider defines cache interface
-type Provider interface {
+// KeyValue defines a narrow key-value interface of the cache
+type KeyValue interface {
 	// Set data
 	Set(ctx context.Context, key string, v any, ttl time.Duration) error
 	// Get data
 	Get(ctx context.Context, key string, v any) error
 	// Delete data
 	Delete(ctx context.Context, key string) error
+}
+
+// Locker defines an optional interface of the provider,
+// to set data only if the key does not exist, for example to acquire a lock
+type Locker interface {
+	// SetNX sets data if the key does not exist,
+	// and returns true if the data was set
+	SetNX(ctx context.Context, key string, v any, ttl time.Duration) (bool, error)
+}
+
+// Counter defines an optional interface of the provider,
+// to atomically increment the integer value
+type Counter interface {
+	// IncrBy increments the value by n, and returns the new value,
+	// the ttl is set when the key is created
+	IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error)
+}
+
+// RawEntry is the entry of the cache in the provider's encoding,
+// used to export and import the keyspace
+type RawEntry struct {
+	// Key is relative to the provider prefix
+	Key string `json:"key"`
+	// Value is the stored value
+	Value []byte `json:"value"`
+	// TTL is the remaining time to live, zero if the entry does not expire
+	TTL time.Duration `json:"ttl,omitempty"`
+}
+
+// Snapshotter defines an optional interface of the provider,
+// to export and import the raw entries
+type Snapshotter interface {
+	// Scan calls fn for each entry with the key matching the pattern,
+	// the order of entries is not specified
+	Scan(ctx context.Context, pattern string, fn func(*RawEntry) error) error
+	// Restore sets the entry, if replace is false then the existing entry is not modified,
+	// and returns true if the entry was set
+	Restore(ctx context.Context, e *RawEntry, replace bool) (bool, error)
+}
+
+// DelayedItem is the item of the delay queue
+type DelayedItem struct {
+	// ID is unique in the queue
+	ID string
+	// Payload is the stored data
+	Payload []byte
+	// DueAt is the time the item is due
+	DueAt time.Time
+}
+
+// DelayQueue defines an optional interface of the provider,
+// to schedule the items at the given time, and to claim the due items
+type DelayQueue interface {
+	// Schedule adds the item to the queue, or reschedules it if the ID exists
+	Schedule(ctx context.Context, queue string, item *DelayedItem) error
+	// Cancel removes the item from the queue,
+	// and returns true if the item was scheduled
+	Cancel(ctx context.Context, queue, id string) (bool, error)
+	// Claim removes up to limit items, that are due at the given time,
+	// and returns them in the order of DueAt, zero limit returns all due items.
+	// Each item is returned only to one caller.
+	Claim(ctx context.Context, queue string, now time.Time, limit int) ([]*DelayedItem, error)
+}
+
+// PubSub defines a narrow publish-subscribe interface of the cache
+type PubSub interface {
+	// Publish publishes message to channel
+	Publish(ctx context.Context, channel, message string) error
+	// Subscribe subscribes to channel
+	Subscribe(ctx context.Context, channel string) Subscription
+}
+
+// Provider defines cache interface
+type Provider interface {
+	KeyValue
+	PubSub
+
 	// CleanExpired data
 	CleanExpired(ctx context.Context)
 	// Close closes the client, releasing any open resources.
@@ -65,11 +143,6 @@ type Provider interface {
 
 	// IsLocal returns true, if cache is local
 	IsLocal() bool
-
-	// Publish publishes message to channel
-	Publish(ctx context.Context, channel, message string) error
-	// Subscribe subscribes to channel
-	Subscribe(ctx context.Context, channel string) Subscription
 }
 
 // GetOrSet gets value from cache, or sets it using getter
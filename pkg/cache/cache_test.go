@@ -168,7 +168,7 @@ func provTest(t *testing.T, p cache.Provider, root string) {
 
 	p.CleanExpired(ctx)
 
-	// With Redis we can't use NowFunc to override local time,
+	// With Redis we can't use the clock to override local time,
 	// so have to sleep to expire
 	for _, tc := range tcases {
 		err = p.Set(ctx, tc.name, tc.in, time.Millisecond)
@@ -276,6 +276,177 @@ func provTest(t *testing.T, p cache.Provider, root string) {
 	require.NoError(t, err)
 
 	wg.Wait()
+
+	lockerTest(t, p)
+	counterTest(t, p)
+	snapshotTest(t, p)
+	delayQueueTest(t, p)
+}
+
+func lockerTest(t *testing.T, p cache.Provider) {
+	ctx := context.Background()
+	l, ok := p.(cache.Locker)
+	require.True(t, ok)
+
+	key := "lock-" + certutil.RandomString(4)
+	set, err := l.SetNX(ctx, key, "owner1", 100*time.Millisecond)
+	require.NoError(t, err)
+	assert.True(t, set)
+
+	set, err = l.SetNX(ctx, key, "owner2", time.Second)
+	require.NoError(t, err)
+	assert.False(t, set)
+
+	var val string
+	require.NoError(t, p.Get(ctx, key, &val))
+	assert.Equal(t, "owner1", val)
+
+	// expired
+	time.Sleep(150 * time.Millisecond)
+	set, err = l.SetNX(ctx, key, "owner3", time.Second)
+	require.NoError(t, err)
+	assert.True(t, set)
+
+	require.NoError(t, p.Delete(ctx, key))
+	set, err = l.SetNX(ctx, key, "owner4", time.Second)
+	require.NoError(t, err)
+	assert.True(t, set)
+}
+
+func TestLocker(t *testing.T) {
+	mem := cache.NewMemoryProvider("test")
+	lockerTest(t, mem)
+	lockerTest(t, cache.NewProxyProvider("sub", mem))
+
+	_, err := cache.NewProxyProvider("sub", nonLocker{mem}).(cache.Locker).
+		SetNX(context.Background(), "k", "v", time.Second)
+	assert.EqualError(t, err, "provider does not support SetNX")
+}
+
+type nonLocker struct {
+	cache.Provider
+}
+
+func counterTest(t *testing.T, p cache.Provider) {
+	ctx := context.Background()
+	c, ok := p.(cache.Counter)
+	require.True(t, ok)
+
+	key := "counter-" + certutil.RandomString(4)
+	v, err := c.IncrBy(ctx, key, 5, 100*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), v)
+
+	v, err = c.IncrBy(ctx, key, -2, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), v)
+
+	var val int64
+	require.NoError(t, p.Get(ctx, key, &val))
+	assert.Equal(t, int64(3), val)
+
+	// expired
+	time.Sleep(150 * time.Millisecond)
+	v, err = c.IncrBy(ctx, key, 1, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), v)
+
+	require.NoError(t, p.Delete(ctx, key))
+}
+
+func TestCounter(t *testing.T) {
+	mem := cache.NewMemoryProvider("test")
+	counterTest(t, mem)
+	counterTest(t, cache.NewProxyProvider("sub", mem))
+
+	_, err := cache.NewProxyProvider("sub", nonLocker{mem}).(cache.Counter).
+		IncrBy(context.Background(), "k", 1, time.Second)
+	assert.EqualError(t, err, "provider does not support IncrBy")
+
+	require.NoError(t, mem.Set(context.Background(), "str", "value", time.Second))
+	_, err = mem.(cache.Counter).IncrBy(context.Background(), "str", 1, time.Second)
+	assert.EqualError(t, err, "value is not an integer: test/str: json: cannot unmarshal string into Go value of type int64")
+}
+
+func snapshotTest(t *testing.T, p cache.Provider) {
+	ctx := context.Background()
+	s, ok := p.(cache.Snapshotter)
+	require.True(t, ok)
+
+	prefix := "snap-" + certutil.RandomString(4)
+	require.NoError(t, p.Set(ctx, prefix+"/a", "va", time.Hour))
+	require.NoError(t, p.Set(ctx, prefix+"/b", "vb", cache.KeepTTL))
+
+	entries := map[string]*cache.RawEntry{}
+	err := s.Scan(ctx, prefix+"/*", func(e *cache.RawEntry) error {
+		entries[e.Key] = e
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	a := entries[prefix+"/a"]
+	require.NotNil(t, a)
+	assert.Greater(t, a.TTL, 59*time.Minute)
+	assert.Equal(t, time.Duration(0), entries[prefix+"/b"].TTL)
+
+	assert.EqualError(t, s.Scan(ctx, prefix+"/*", func(*cache.RawEntry) error {
+		return errors.New("stop")
+	}), "stop")
+
+	// restore into new key
+	set, err := s.Restore(ctx, &cache.RawEntry{Key: prefix + "/c", Value: a.Value, TTL: time.Hour}, false)
+	require.NoError(t, err)
+	assert.True(t, set)
+	var val string
+	require.NoError(t, p.Get(ctx, prefix+"/c", &val))
+	assert.Equal(t, "va", val)
+
+	// conflict
+	set, err = s.Restore(ctx, &cache.RawEntry{Key: prefix + "/c", Value: entries[prefix+"/b"].Value}, false)
+	require.NoError(t, err)
+	assert.False(t, set)
+	set, err = s.Restore(ctx, &cache.RawEntry{Key: prefix + "/c", Value: entries[prefix+"/b"].Value}, true)
+	require.NoError(t, err)
+	assert.True(t, set)
+	require.NoError(t, p.Get(ctx, prefix+"/c", &val))
+	assert.Equal(t, "vb", val)
+
+	for _, k := range []string{"a", "b", "c"} {
+		require.NoError(t, p.Delete(ctx, prefix+"/"+k))
+	}
+}
+
+func TestSnapshotter(t *testing.T) {
+	mem := cache.NewMemoryProvider("test")
+	snapshotTest(t, mem)
+	snapshotTest(t, cache.NewProxyProvider("sub", mem))
+
+	proxy := cache.NewProxyProvider("sub", nonLocker{mem}).(cache.Snapshotter)
+	assert.EqualError(t, proxy.Scan(context.Background(), "*", nil), "provider does not support Scan")
+	_, err := proxy.Restore(context.Background(), &cache.RawEntry{Key: "k"}, false)
+	assert.EqualError(t, err, "provider does not support Restore")
+}
+
+func TestMemoryClock(t *testing.T) {
+	ctx := context.Background()
+	clk := testutils.NewClock(time.Now())
+	p := cache.NewMemoryProvider("test", cache.WithClock(clk))
+
+	require.NoError(t, p.Set(ctx, "short", "v1", time.Minute))
+	require.NoError(t, p.Set(ctx, "long", "v2", time.Hour))
+	require.NoError(t, p.Set(ctx, "keep", "v3", cache.KeepTTL))
+
+	var val string
+	clk.Advance(2 * time.Minute)
+	assert.True(t, cache.IsNotFoundError(p.Get(ctx, "short", &val)))
+	require.NoError(t, p.Get(ctx, "long", &val))
+	assert.Equal(t, "v2", val)
+
+	clk.Advance(time.Hour)
+	p.CleanExpired(ctx)
+	keys, err := p.Keys(ctx, "*")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test/keep"}, keys)
 }
 
 func TestIsNotFoundError(t *testing.T) {
@@ -287,3 +458,133 @@ func TestIsNotFoundError(t *testing.T) {
 	assert.True(t, cache.IsNotFoundError(errors.New("key not found")))
 	assert.False(t, cache.IsNotFoundError(errors.New("invalid key")))
 }
+
+func delayQueueTest(t *testing.T, p cache.Provider) {
+	ctx := context.Background()
+	q, ok := p.(cache.DelayQueue)
+	require.True(t, ok)
+
+	queue := "delayed-" + certutil.RandomString(4)
+	now := time.Now().Truncate(time.Millisecond)
+
+	items, err := q.Claim(ctx, queue, now, 10)
+	require.NoError(t, err)
+	assert.Empty(t, items)
+
+	require.NoError(t, q.Schedule(ctx, queue, &cache.DelayedItem{ID: "1", Payload: []byte("one"), DueAt: now.Add(-time.Second)}))
+	require.NoError(t, q.Schedule(ctx, queue, &cache.DelayedItem{ID: "2", Payload: []byte("two"), DueAt: now.Add(-2 * time.Second)}))
+	require.NoError(t, q.Schedule(ctx, queue, &cache.DelayedItem{ID: "3", Payload: []byte("three"), DueAt: now.Add(-3 * time.Second)}))
+	require.NoError(t, q.Schedule(ctx, queue, &cache.DelayedItem{ID: "4", Payload: []byte("four"), DueAt: now.Add(time.Hour)}))
+
+	// reschedule
+	require.NoError(t, q.Schedule(ctx, queue, &cache.DelayedItem{ID: "3", Payload: []byte("three"), DueAt: now.Add(time.Hour)}))
+
+	canceled, err := q.Cancel(ctx, queue, "1")
+	require.NoError(t, err)
+	assert.True(t, canceled)
+	canceled, err = q.Cancel(ctx, queue, "1")
+	require.NoError(t, err)
+	assert.False(t, canceled)
+
+	require.NoError(t, q.Schedule(ctx, queue, &cache.DelayedItem{ID: "5", Payload: []byte("five"), DueAt: now}))
+
+	items, err = q.Claim(ctx, queue, now, 10)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, "2", items[0].ID)
+	assert.Equal(t, "two", string(items[0].Payload))
+	assert.True(t, now.Add(-2*time.Second).Equal(items[0].DueAt))
+	assert.Equal(t, "5", items[1].ID)
+
+	// claimed once
+	items, err = q.Claim(ctx, queue, now, 10)
+	require.NoError(t, err)
+	assert.Empty(t, items)
+
+	items, err = q.Claim(ctx, queue, now.Add(2*time.Hour), 1)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+
+	for _, id := range []string{"3", "4"} {
+		_, err = q.Cancel(ctx, queue, id)
+		require.NoError(t, err)
+	}
+}
+
+func TestDelayQueue(t *testing.T) {
+	mem := cache.NewMemoryProvider("test")
+	delayQueueTest(t, mem)
+	delayQueueTest(t, cache.NewProxyProvider("sub", mem))
+
+	proxy := cache.NewProxyProvider("sub", nonLocker{mem}).(cache.DelayQueue)
+	assert.EqualError(t, proxy.Schedule(context.Background(), "q", &cache.DelayedItem{ID: "1"}), "provider does not support Schedule")
+	_, err := proxy.Cancel(context.Background(), "q", "1")
+	assert.EqualError(t, err, "provider does not support Cancel")
+	_, err = proxy.Claim(context.Background(), "q", time.Now(), 1)
+	assert.EqualError(t, err, "provider does not support Claim")
+}
+
+func TestFaultProvider(t *testing.T) {
+	ctx := context.Background()
+	mem := cache.NewMemoryProvider("test")
+	p := cache.NewFaultProvider(mem)
+
+	// no faults
+	lockerTest(t, p)
+	counterTest(t, p)
+	delayQueueTest(t, p)
+	assert.Equal(t, mem.IsLocal(), p.IsLocal())
+
+	// latency
+	p.SetFault(cache.CmdGet, &cache.Fault{Latency: 50 * time.Millisecond})
+	require.NoError(t, p.Set(ctx, "k", "v", time.Minute))
+	started := time.Now()
+	var val string
+	require.NoError(t, p.Get(ctx, "k", &val))
+	assert.GreaterOrEqual(t, time.Since(started), 50*time.Millisecond)
+
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	err := p.Get(tctx, "k", &val)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// transient errors per command, and for all commands
+	p.SetFault(cache.CmdGet, &cache.Fault{ErrorRate: 1})
+	err = p.Get(ctx, "k", &val)
+	assert.EqualError(t, err, "cache get: injected fault")
+	assert.ErrorIs(t, err, cache.ErrInjectedFault)
+	require.NoError(t, p.Set(ctx, "k", "v", time.Minute))
+
+	custom := errors.New("READONLY You can't write against a read only replica")
+	p.SetFault(cache.AllCommands, &cache.Fault{ErrorRate: 1, Err: custom})
+	err = p.Set(ctx, "k", "v", time.Minute)
+	assert.ErrorIs(t, err, custom)
+	assert.ErrorIs(t, p.Get(ctx, "k", &val), cache.ErrInjectedFault, "the command fault takes precedence")
+	assert.Equal(t, 2, p.Injected(cache.CmdGet))
+	assert.Equal(t, 1, p.Injected(cache.CmdSet))
+
+	// connection drops
+	p.Reset()
+	p.SetFault(cache.CmdPublish, &cache.Fault{DropRate: 1, DropDuration: 100 * time.Millisecond})
+	assert.ErrorIs(t, p.Publish(ctx, "ch", "msg"), cache.ErrConnectionDropped)
+	assert.ErrorIs(t, p.Delete(ctx, "k"), cache.ErrConnectionDropped)
+	_, err = p.Keys(ctx, "*")
+	assert.ErrorIs(t, err, cache.ErrConnectionDropped)
+	sub := p.Subscribe(ctx, "ch")
+	_, err = sub.ReceiveMessage(ctx)
+	assert.ErrorIs(t, err, cache.ErrConnectionDropped)
+	require.NoError(t, sub.Close())
+
+	time.Sleep(110 * time.Millisecond)
+	p.SetFault(cache.CmdPublish, nil)
+	require.NoError(t, p.Delete(ctx, "k"))
+
+	p.Drop(time.Minute)
+	assert.ErrorIs(t, p.Set(ctx, "k", "v", time.Minute), cache.ErrConnectionDropped)
+	p.Reset()
+	require.NoError(t, p.Set(ctx, "k", "v", time.Minute))
+	assert.Zero(t, p.Injected(cache.CmdSet))
+
+	_, err = cache.NewFaultProvider(nonLocker{mem}).SetNX(ctx, "k", "v", time.Second)
+	assert.EqualError(t, err, "provider does not support SetNX")
+}
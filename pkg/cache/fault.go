@@ -0,0 +1,333 @@
+package cache
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Commands of the provider, used to configure the faults
+const (
+	CmdGet      = "get"
+	CmdSet      = "set"
+	CmdDelete   = "delete"
+	CmdKeys     = "keys"
+	CmdPublish  = "publish"
+	CmdReceive  = "receive"
+	CmdSetNX    = "setnx"
+	CmdIncrBy   = "incrby"
+	CmdScan     = "scan"
+	CmdRestore  = "restore"
+	CmdSchedule = "schedule"
+	CmdCancel   = "cancel"
+	CmdClaim    = "claim"
+	AllCommands = "*"
+)
+
+var (
+	// ErrInjectedFault is the default transient error of FaultProvider
+	ErrInjectedFault = errors.New("injected fault")
+	// ErrConnectionDropped is returned by FaultProvider while the connection is dropped
+	ErrConnectionDropped = errors.New("connection dropped")
+)
+
+// Fault specifies the failures injected before the command
+type Fault struct {
+	// Latency is added before the command
+	Latency time.Duration
+	// Jitter adds random duration up to Jitter to Latency
+	Jitter time.Duration
+	// ErrorRate is the probability from 0 to 1 of the transient error
+	ErrorRate float64
+	// Err is the transient error, default is ErrInjectedFault
+	Err error
+	// DropRate is the probability from 0 to 1 of the connection drop,
+	// all commands fail with ErrConnectionDropped for DropDuration
+	DropRate float64
+	// DropDuration specifies how long the connection is dropped
+	DropDuration time.Duration
+}
+
+// FaultProvider wraps the provider, and injects latency, transient errors
+// and connection drops per command, to test the resilience of the services
+// to the degradation of the cache.
+// It must be used only in tests.
+type FaultProvider struct {
+	prov Provider
+
+	lock      sync.RWMutex
+	faults    map[string]*Fault
+	downUntil time.Time
+	injected  map[string]int
+}
+
+// NewFaultProvider returns FaultProvider without faults
+func NewFaultProvider(prov Provider) *FaultProvider {
+	return &FaultProvider{
+		prov:     prov,
+		faults:   map[string]*Fault{},
+		injected: map[string]int{},
+	}
+}
+
+// SetFault specifies the fault for the command, or AllCommands,
+// the fault of the command takes precedence over AllCommands.
+// Use nil to remove the fault.
+func (p *FaultProvider) SetFault(cmd string, f *Fault) *FaultProvider {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if f == nil {
+		delete(p.faults, cmd)
+	} else {
+		p.faults[cmd] = f
+	}
+	return p
+}
+
+// Drop drops the connection for the duration
+func (p *FaultProvider) Drop(d time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.downUntil = time.Now().Add(d)
+}
+
+// Reset removes the faults, restores the connection and the counters
+func (p *FaultProvider) Reset() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.faults = map[string]*Fault{}
+	p.injected = map[string]int{}
+	p.downUntil = time.Time{}
+}
+
+// Injected returns the number of the errors injected for the command
+func (p *FaultProvider) Injected(cmd string) int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.injected[cmd]
+}
+
+// inject applies the fault of the command
+func (p *FaultProvider) inject(ctx context.Context, cmd string) error {
+	p.lock.RLock()
+	f := p.faults[cmd]
+	if f == nil {
+		f = p.faults[AllCommands]
+	}
+	down := time.Now().Before(p.downUntil)
+	p.lock.RUnlock()
+
+	if down {
+		return p.failed(cmd, ErrConnectionDropped)
+	}
+	if f == nil {
+		return nil
+	}
+
+	if delay := f.Latency + jitter(f.Jitter); delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+
+	if f.DropRate > 0 && rand.Float64() < f.DropRate {
+		p.Drop(f.DropDuration)
+		return p.failed(cmd, ErrConnectionDropped)
+	}
+	if f.ErrorRate > 0 && rand.Float64() < f.ErrorRate {
+		err := f.Err
+		if err == nil {
+			err = ErrInjectedFault
+		}
+		return p.failed(cmd, err)
+	}
+	return nil
+}
+
+func (p *FaultProvider) failed(cmd string, err error) error {
+	p.lock.Lock()
+	p.injected[cmd]++
+	p.lock.Unlock()
+	return errors.WithMessagef(err, "cache %s", cmd)
+}
+
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d)
+}
+
+// Close closes the wrapped provider
+func (p *FaultProvider) Close() error {
+	return p.prov.Close()
+}
+
+// IsLocal returns true, if cache is local
+func (p *FaultProvider) IsLocal() bool {
+	return p.prov.IsLocal()
+}
+
+// Set data
+func (p *FaultProvider) Set(ctx context.Context, key string, v any, ttl time.Duration) error {
+	if err := p.inject(ctx, CmdSet); err != nil {
+		return err
+	}
+	return p.prov.Set(ctx, key, v, ttl)
+}
+
+// Get data
+func (p *FaultProvider) Get(ctx context.Context, key string, v any) error {
+	if err := p.inject(ctx, CmdGet); err != nil {
+		return err
+	}
+	return p.prov.Get(ctx, key, v)
+}
+
+// Delete data
+func (p *FaultProvider) Delete(ctx context.Context, key string) error {
+	if err := p.inject(ctx, CmdDelete); err != nil {
+		return err
+	}
+	return p.prov.Delete(ctx, key)
+}
+
+// SetNX sets data if the key does not exist,
+// the wrapped provider must implement Locker
+func (p *FaultProvider) SetNX(ctx context.Context, key string, v any, ttl time.Duration) (bool, error) {
+	l, ok := p.prov.(Locker)
+	if !ok {
+		return false, errors.New("provider does not support SetNX")
+	}
+	if err := p.inject(ctx, CmdSetNX); err != nil {
+		return false, err
+	}
+	return l.SetNX(ctx, key, v, ttl)
+}
+
+// IncrBy increments the value by n,
+// the wrapped provider must implement Counter
+func (p *FaultProvider) IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	c, ok := p.prov.(Counter)
+	if !ok {
+		return 0, errors.New("provider does not support IncrBy")
+	}
+	if err := p.inject(ctx, CmdIncrBy); err != nil {
+		return 0, err
+	}
+	return c.IncrBy(ctx, key, n, ttl)
+}
+
+// Scan calls fn for each entry with the key matching the pattern,
+// the wrapped provider must implement Snapshotter
+func (p *FaultProvider) Scan(ctx context.Context, pattern string, fn func(*RawEntry) error) error {
+	s, ok := p.prov.(Snapshotter)
+	if !ok {
+		return errors.New("provider does not support Scan")
+	}
+	if err := p.inject(ctx, CmdScan); err != nil {
+		return err
+	}
+	return s.Scan(ctx, pattern, fn)
+}
+
+// Restore sets the entry,
+// the wrapped provider must implement Snapshotter
+func (p *FaultProvider) Restore(ctx context.Context, e *RawEntry, replace bool) (bool, error) {
+	s, ok := p.prov.(Snapshotter)
+	if !ok {
+		return false, errors.New("provider does not support Restore")
+	}
+	if err := p.inject(ctx, CmdRestore); err != nil {
+		return false, err
+	}
+	return s.Restore(ctx, e, replace)
+}
+
+// Schedule adds the item to the queue,
+// the wrapped provider must implement DelayQueue
+func (p *FaultProvider) Schedule(ctx context.Context, queue string, item *DelayedItem) error {
+	q, ok := p.prov.(DelayQueue)
+	if !ok {
+		return errors.New("provider does not support Schedule")
+	}
+	if err := p.inject(ctx, CmdSchedule); err != nil {
+		return err
+	}
+	return q.Schedule(ctx, queue, item)
+}
+
+// Cancel removes the item from the queue,
+// the wrapped provider must implement DelayQueue
+func (p *FaultProvider) Cancel(ctx context.Context, queue, id string) (bool, error) {
+	q, ok := p.prov.(DelayQueue)
+	if !ok {
+		return false, errors.New("provider does not support Cancel")
+	}
+	if err := p.inject(ctx, CmdCancel); err != nil {
+		return false, err
+	}
+	return q.Cancel(ctx, queue, id)
+}
+
+// Claim removes and returns the due items,
+// the wrapped provider must implement DelayQueue
+func (p *FaultProvider) Claim(ctx context.Context, queue string, now time.Time, limit int) ([]*DelayedItem, error) {
+	q, ok := p.prov.(DelayQueue)
+	if !ok {
+		return nil, errors.New("provider does not support Claim")
+	}
+	if err := p.inject(ctx, CmdClaim); err != nil {
+		return nil, err
+	}
+	return q.Claim(ctx, queue, now, limit)
+}
+
+// CleanExpired data
+func (p *FaultProvider) CleanExpired(ctx context.Context) {
+	p.prov.CleanExpired(ctx)
+}
+
+// Keys returns list of keys
+func (p *FaultProvider) Keys(ctx context.Context, pattern string) ([]string, error) {
+	if err := p.inject(ctx, CmdKeys); err != nil {
+		return nil, err
+	}
+	return p.prov.Keys(ctx, pattern)
+}
+
+// Publish publishes message to channel
+func (p *FaultProvider) Publish(ctx context.Context, channel, message string) error {
+	if err := p.inject(ctx, CmdPublish); err != nil {
+		return err
+	}
+	return p.prov.Publish(ctx, channel, message)
+}
+
+// Subscribe subscribes to channel,
+// the faults of CmdReceive are injected in ReceiveMessage
+func (p *FaultProvider) Subscribe(ctx context.Context, channel string) Subscription {
+	return &faultSub{
+		Subscription: p.prov.Subscribe(ctx, channel),
+		prov:         p,
+	}
+}
+
+type faultSub struct {
+	Subscription
+	prov *FaultProvider
+}
+
+func (s *faultSub) ReceiveMessage(ctx context.Context) (string, error) {
+	if err := s.prov.inject(ctx, CmdReceive); err != nil {
+		return "", err
+	}
+	return s.Subscription.ReceiveMessage(ctx)
+}
@@ -4,19 +4,25 @@ import (
 	"context"
 	"encoding/json"
 	"path"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/effective-security/porto/x/clock"
 	"github.com/effective-security/x/guid"
 	"github.com/pkg/errors"
 )
 
 type memProv struct {
 	prefix string
+	clock  clock.Clock
 
 	subs  sync.Map
 	cache sync.Map
+
+	delayLock sync.Mutex
+	delayed   map[string]map[string]*DelayedItem
 }
 
 type entry struct {
@@ -25,10 +31,24 @@ type entry struct {
 	data []byte
 }
 
+// MemoryOption configures the memory provider
+type MemoryOption func(*memProv)
+
+// WithClock specifies the time source of the expiration
+func WithClock(c clock.Clock) MemoryOption {
+	return func(p *memProv) {
+		p.clock = clock.OrSystem(c)
+	}
+}
+
 // NewMemoryProvider returns memory cache
-func NewMemoryProvider(prefix string) Provider {
+func NewMemoryProvider(prefix string, ops ...MemoryOption) Provider {
 	prov := &memProv{
 		prefix: prefix,
+		clock:  clock.System,
+	}
+	for _, op := range ops {
+		op(prov)
 	}
 
 	return prov
@@ -62,7 +82,7 @@ func (p *memProv) Set(_ context.Context, key string, v any, ttl time.Duration) e
 	}
 
 	if ttl != KeepTTL {
-		exp := NowFunc().Add(ttl)
+		exp := p.clock.Now().Add(ttl)
 		val.expires = &exp
 	}
 	p.cache.Store(k, val)
@@ -74,7 +94,7 @@ func (p *memProv) Get(_ context.Context, key string, v any) error {
 	k := path.Join(p.prefix, key)
 	if ent, ok := p.cache.Load(k); ok {
 		e := ent.(*entry)
-		if e.expires == nil || e.expires.After(NowFunc()) {
+		if e.expires == nil || e.expires.After(p.clock.Now()) {
 			err := json.Unmarshal(ent.(*entry).data, v)
 			if err != nil {
 				return errors.Wrapf(err, "failed to unmarshal value: %s", k)
@@ -86,6 +106,190 @@ func (p *memProv) Get(_ context.Context, key string, v any) error {
 	return ErrNotFound
 }
 
+// SetNX sets data if the key does not exist
+func (p *memProv) SetNX(_ context.Context, key string, v any, ttl time.Duration) (bool, error) {
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+
+	k := path.Join(p.prefix, key)
+	b, err := json.Marshal(v)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to marshal value: %s", k)
+	}
+
+	val := &entry{
+		data: b,
+	}
+	if ttl != KeepTTL {
+		exp := p.clock.Now().Add(ttl)
+		val.expires = &exp
+	}
+
+	return p.setNX(k, val), nil
+}
+
+// setNX stores the entry if the key does not exist or expired
+func (p *memProv) setNX(k string, val *entry) bool {
+	for {
+		actual, loaded := p.cache.LoadOrStore(k, val)
+		if !loaded {
+			return true
+		}
+		e := actual.(*entry)
+		if e.expires == nil || e.expires.After(p.clock.Now()) {
+			return false
+		}
+		// replace expired
+		if p.cache.CompareAndSwap(k, actual, val) {
+			return true
+		}
+	}
+}
+
+// Scan calls fn for each entry with the key matching the pattern
+func (p *memProv) Scan(_ context.Context, pattern string, fn func(*RawEntry) error) error {
+	k := strings.TrimRight(path.Join(p.prefix, pattern), "*?")
+	now := p.clock.Now()
+
+	var err error
+	p.cache.Range(func(key any, value any) bool {
+		name := key.(string)
+		if !strings.HasPrefix(name, k) {
+			return true
+		}
+		e := value.(*entry)
+		re := &RawEntry{
+			Key:   strings.TrimPrefix(strings.TrimPrefix(name, p.prefix), "/"),
+			Value: e.data,
+		}
+		if e.expires != nil {
+			re.TTL = e.expires.Sub(now)
+			if re.TTL <= 0 {
+				return true
+			}
+		}
+		err = fn(re)
+		return err == nil
+	})
+	return err
+}
+
+// Restore sets the entry
+func (p *memProv) Restore(_ context.Context, e *RawEntry, replace bool) (bool, error) {
+	k := path.Join(p.prefix, e.Key)
+	val := &entry{
+		data: e.Value,
+	}
+	if e.TTL > 0 {
+		exp := p.clock.Now().Add(e.TTL)
+		val.expires = &exp
+	}
+	if replace {
+		p.cache.Store(k, val)
+		return true, nil
+	}
+	return p.setNX(k, val), nil
+}
+
+// IncrBy increments the value by n
+func (p *memProv) IncrBy(_ context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+
+	k := path.Join(p.prefix, key)
+	for {
+		actual, loaded := p.cache.Load(k)
+		var cur int64
+		val := &entry{}
+		if loaded {
+			// expired value is replaced
+			e := actual.(*entry)
+			if e.expires == nil || e.expires.After(p.clock.Now()) {
+				if err := json.Unmarshal(e.data, &cur); err != nil {
+					return 0, errors.Wrapf(err, "value is not an integer: %s", k)
+				}
+				val.expires = e.expires
+			}
+		}
+		if val.expires == nil && ttl != KeepTTL {
+			exp := p.clock.Now().Add(ttl)
+			val.expires = &exp
+		}
+
+		cur += n
+		val.data, _ = json.Marshal(cur)
+		if loaded {
+			if p.cache.CompareAndSwap(k, actual, val) {
+				return cur, nil
+			}
+		} else if _, exists := p.cache.LoadOrStore(k, val); !exists {
+			return cur, nil
+		}
+	}
+}
+
+// Schedule adds the item to the queue, or reschedules it if the ID exists
+func (p *memProv) Schedule(_ context.Context, queue string, item *DelayedItem) error {
+	k := path.Join(p.prefix, queue)
+
+	p.delayLock.Lock()
+	defer p.delayLock.Unlock()
+
+	if p.delayed == nil {
+		p.delayed = map[string]map[string]*DelayedItem{}
+	}
+	q := p.delayed[k]
+	if q == nil {
+		q = map[string]*DelayedItem{}
+		p.delayed[k] = q
+	}
+	c := *item
+	q[item.ID] = &c
+	return nil
+}
+
+// Cancel removes the item from the queue
+func (p *memProv) Cancel(_ context.Context, queue, id string) (bool, error) {
+	k := path.Join(p.prefix, queue)
+
+	p.delayLock.Lock()
+	defer p.delayLock.Unlock()
+
+	q := p.delayed[k]
+	if _, ok := q[id]; !ok {
+		return false, nil
+	}
+	delete(q, id)
+	return true, nil
+}
+
+// Claim removes up to limit items, that are due at the given time
+func (p *memProv) Claim(_ context.Context, queue string, now time.Time, limit int) ([]*DelayedItem, error) {
+	k := path.Join(p.prefix, queue)
+
+	p.delayLock.Lock()
+	defer p.delayLock.Unlock()
+
+	var due []*DelayedItem
+	for _, item := range p.delayed[k] {
+		if !item.DueAt.After(now) {
+			due = append(due, item)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].DueAt.Before(due[j].DueAt)
+	})
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	for _, item := range due {
+		delete(p.delayed[k], item.ID)
+	}
+	return due, nil
+}
+
 // Delete data
 func (p *memProv) Delete(_ context.Context, key string) error {
 	k := path.Join(p.prefix, key)
@@ -95,10 +299,10 @@ func (p *memProv) Delete(_ context.Context, key string) error {
 
 // CleanExpired data
 func (p *memProv) CleanExpired(_ context.Context) {
-	now := NowFunc()
+	now := p.clock.Now()
 	p.cache.Range(func(key any, value any) bool {
 		e := value.(*entry)
-		if e.expires != nil && e.expires.After(now) {
+		if e.expires != nil && !e.expires.After(now) {
 			k := key.(string)
 			p.cache.Delete(k)
 		}
@@ -3,7 +3,10 @@ package cache
 import (
 	"context"
 	"path"
+	"strings"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 type proxyProv struct {
@@ -47,6 +50,82 @@ func (p *proxyProv) Get(ctx context.Context, key string, v any) error {
 	return p.prov.Get(ctx, p.keyName(key), v)
 }
 
+// SetNX sets data if the key does not exist,
+// the parent provider must implement Locker
+func (p *proxyProv) SetNX(ctx context.Context, key string, v any, ttl time.Duration) (bool, error) {
+	l, ok := p.prov.(Locker)
+	if !ok {
+		return false, errors.New("provider does not support SetNX")
+	}
+	return l.SetNX(ctx, p.keyName(key), v, ttl)
+}
+
+// IncrBy increments the value by n,
+// the parent provider must implement Counter
+func (p *proxyProv) IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	c, ok := p.prov.(Counter)
+	if !ok {
+		return 0, errors.New("provider does not support IncrBy")
+	}
+	return c.IncrBy(ctx, p.keyName(key), n, ttl)
+}
+
+// Scan calls fn for each entry with the key matching the pattern,
+// the parent provider must implement Snapshotter
+func (p *proxyProv) Scan(ctx context.Context, pattern string, fn func(*RawEntry) error) error {
+	s, ok := p.prov.(Snapshotter)
+	if !ok {
+		return errors.New("provider does not support Scan")
+	}
+	return s.Scan(ctx, p.keyName(pattern), func(e *RawEntry) error {
+		re := *e
+		re.Key = strings.TrimPrefix(strings.TrimPrefix(e.Key, p.prefix), "/")
+		return fn(&re)
+	})
+}
+
+// Restore sets the entry,
+// the parent provider must implement Snapshotter
+func (p *proxyProv) Restore(ctx context.Context, e *RawEntry, replace bool) (bool, error) {
+	s, ok := p.prov.(Snapshotter)
+	if !ok {
+		return false, errors.New("provider does not support Restore")
+	}
+	re := *e
+	re.Key = p.keyName(e.Key)
+	return s.Restore(ctx, &re, replace)
+}
+
+// Schedule adds the item to the queue,
+// the parent provider must implement DelayQueue
+func (p *proxyProv) Schedule(ctx context.Context, queue string, item *DelayedItem) error {
+	q, ok := p.prov.(DelayQueue)
+	if !ok {
+		return errors.New("provider does not support Schedule")
+	}
+	return q.Schedule(ctx, p.keyName(queue), item)
+}
+
+// Cancel removes the item from the queue,
+// the parent provider must implement DelayQueue
+func (p *proxyProv) Cancel(ctx context.Context, queue, id string) (bool, error) {
+	q, ok := p.prov.(DelayQueue)
+	if !ok {
+		return false, errors.New("provider does not support Cancel")
+	}
+	return q.Cancel(ctx, p.keyName(queue), id)
+}
+
+// Claim removes and returns the due items,
+// the parent provider must implement DelayQueue
+func (p *proxyProv) Claim(ctx context.Context, queue string, now time.Time, limit int) ([]*DelayedItem, error) {
+	q, ok := p.prov.(DelayQueue)
+	if !ok {
+		return nil, errors.New("provider does not support Claim")
+	}
+	return q.Claim(ctx, p.keyName(queue), now, limit)
+}
+
 // Delete data
 func (p *proxyProv) Delete(ctx context.Context, key string) error {
 	return p.prov.Delete(ctx, p.keyName(key))
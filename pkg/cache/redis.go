@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"path"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/effective-security/porto/pkg/tlsconfig"
@@ -17,6 +19,9 @@ type redisProv struct {
 	prefix string
 	cfg    RedisConfig
 	client *redis.Client
+
+	stop      chan struct{}
+	closeOnce sync.Once
 }
 
 // NewRedisProvider returns Redis cache
@@ -52,6 +57,16 @@ func NewRedisProvider(cfg RedisConfig, prefix string) (Provider, error) {
 		prefix: prefix,
 		cfg:    cfg,
 		client: redis.NewClient(options),
+		stop:   make(chan struct{}),
+	}
+
+	if !cfg.DisableMetrics {
+		prov.client.AddHook(newRedisMetrics(prefix))
+		interval := cfg.PoolStatsInterval
+		if interval <= 0 {
+			interval = defaultPoolStatsInterval
+		}
+		go prov.reportPoolStats(interval)
 	}
 
 	return prov, nil
@@ -60,6 +75,7 @@ func NewRedisProvider(cfg RedisConfig, prefix string) (Provider, error) {
 // Close closes the client, releasing any open resources.
 // It is rare to Close a Client, as the Client is meant to be long-lived and shared between many goroutines.
 func (p *redisProv) Close() error {
+	p.closeOnce.Do(func() { close(p.stop) })
 	return p.client.Close()
 }
 
@@ -136,6 +152,189 @@ func (p *redisProv) Get(ctx context.Context, key string, v any) error {
 	return nil
 }
 
+// SetNX sets data if the key does not exist
+func (p *redisProv) SetNX(ctx context.Context, key string, v any, ttl time.Duration) (bool, error) {
+	if ttl == 0 {
+		ttl = p.cfg.TTL
+	}
+
+	var value any
+	switch t := v.(type) {
+	case string:
+		value = t
+	case []byte:
+		value = t
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to marshal value: %s", key)
+		}
+		value = string(b)
+	}
+
+	k := path.Join(p.prefix, key)
+	ok, err := p.client.SetNX(ctx, k, value, ttl).Result()
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to set key: %s", k)
+	}
+	return ok, nil
+}
+
+// incrByScript increments the value, and sets TTL if the key has no expiration
+var incrByScript = redis.NewScript(`
+local v = redis.call('INCRBY', KEYS[1], ARGV[1])
+if tonumber(ARGV[2]) > 0 and redis.call('PTTL', KEYS[1]) < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return v
+`)
+
+// IncrBy increments the value by n
+func (p *redisProv) IncrBy(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	if ttl == 0 {
+		ttl = p.cfg.TTL
+	}
+
+	k := path.Join(p.prefix, key)
+	v, err := incrByScript.Run(ctx, p.client, []string{k}, n, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to increment key: %s", k)
+	}
+	return v, nil
+}
+
+// Scan calls fn for each entry with the key matching the pattern
+func (p *redisProv) Scan(ctx context.Context, pattern string, fn func(*RawEntry) error) error {
+	iter := p.client.Scan(ctx, 0, path.Join(p.prefix, pattern), 100).Iterator()
+	for iter.Next(ctx) {
+		k := iter.Val()
+
+		pipe := p.client.Pipeline()
+		get := pipe.Get(ctx, k)
+		pttl := pipe.PTTL(ctx, k)
+		_, err := pipe.Exec(ctx)
+		if errors.Is(err, redis.Nil) {
+			// expired
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to get key: %s", k)
+		}
+
+		e := &RawEntry{
+			Key:   strings.TrimPrefix(strings.TrimPrefix(k, p.prefix), "/"),
+			Value: []byte(get.Val()),
+		}
+		if ttl := pttl.Val(); ttl > 0 {
+			e.TTL = ttl
+		}
+		if err = fn(e); err != nil {
+			return err
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return errors.Wrap(err, "failed to scan keys")
+	}
+	return nil
+}
+
+// Restore sets the entry
+func (p *redisProv) Restore(ctx context.Context, e *RawEntry, replace bool) (bool, error) {
+	k := path.Join(p.prefix, e.Key)
+	if replace {
+		if err := p.client.Set(ctx, k, e.Value, e.TTL).Err(); err != nil {
+			return false, errors.Wrapf(err, "failed to set key: %s", k)
+		}
+		return true, nil
+	}
+	ok, err := p.client.SetNX(ctx, k, e.Value, e.TTL).Result()
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to set key: %s", k)
+	}
+	return ok, nil
+}
+
+// delayQueueKeys returns the keys of the sorted set and the payloads
+func (p *redisProv) delayQueueKeys(queue string) []string {
+	k := path.Join(p.prefix, queue)
+	return []string{k, k + ":payload"}
+}
+
+// Schedule adds the item to the queue, or reschedules it if the ID exists
+func (p *redisProv) Schedule(ctx context.Context, queue string, item *DelayedItem) error {
+	keys := p.delayQueueKeys(queue)
+	_, err := p.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, keys[0], redis.Z{Score: float64(item.DueAt.UnixMilli()), Member: item.ID})
+		pipe.HSet(ctx, keys[1], item.ID, item.Payload)
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to schedule item: %s", keys[0])
+	}
+	return nil
+}
+
+// Cancel removes the item from the queue
+func (p *redisProv) Cancel(ctx context.Context, queue, id string) (bool, error) {
+	keys := p.delayQueueKeys(queue)
+	var rem *redis.IntCmd
+	_, err := p.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		rem = pipe.ZRem(ctx, keys[0], id)
+		pipe.HDel(ctx, keys[1], id)
+		return nil
+	})
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to cancel item: %s", keys[0])
+	}
+	return rem.Val() > 0, nil
+}
+
+// claimScript atomically removes the due items, and returns id, score, payload triplets
+var claimScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'WITHSCORES', 'LIMIT', 0, ARGV[2])
+local res = {}
+for i = 1, #due, 2 do
+	local id = due[i]
+	local payload = redis.call('HGET', KEYS[2], id)
+	redis.call('ZREM', KEYS[1], id)
+	redis.call('HDEL', KEYS[2], id)
+	table.insert(res, id)
+	table.insert(res, due[i+1])
+	table.insert(res, payload or '')
+end
+return res
+`)
+
+// Claim removes up to limit items, that are due at the given time
+func (p *redisProv) Claim(ctx context.Context, queue string, now time.Time, limit int) ([]*DelayedItem, error) {
+	if limit <= 0 {
+		// negative count returns all the items
+		limit = -1
+	}
+	keys := p.delayQueueKeys(queue)
+	vals, err := claimScript.Run(ctx, p.client, keys, now.UnixMilli(), limit).StringSlice()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to claim items: %s", keys[0])
+	}
+
+	items := make([]*DelayedItem, 0, len(vals)/3)
+	for i := 0; i+2 < len(vals); i += 3 {
+		ms, err := strconv.ParseFloat(vals[i+1], 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid score: %s", vals[i+1])
+		}
+		items = append(items, &DelayedItem{
+			ID:      vals[i],
+			DueAt:   time.UnixMilli(int64(ms)),
+			Payload: []byte(vals[i+2]),
+		})
+	}
+	return items, nil
+}
+
 // Delete data
 func (p *redisProv) Delete(ctx context.Context, key string) error {
 	k := path.Join(p.prefix, key)
@@ -0,0 +1,178 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/effective-security/porto/metricskey"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// defaultPoolStatsInterval is the interval to report the pool stats
+	defaultPoolStatsInterval = 10 * time.Second
+	// maxKeyPrefixes limits the cardinality of the prefix tag,
+	// the keys with other prefixes are reported as "other"
+	maxKeyPrefixes = 100
+)
+
+// redisMetrics implements redis.Hook to report the command latency,
+// the errors and the key prefixes
+type redisMetrics struct {
+	prefix string
+
+	lock     sync.RWMutex
+	prefixes map[string]struct{}
+}
+
+func newRedisMetrics(prefix string) *redisMetrics {
+	return &redisMetrics{
+		prefix:   prefix,
+		prefixes: map[string]struct{}{},
+	}
+}
+
+// DialHook reports the errors of the new connections
+func (m *redisMetrics) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := next(ctx, network, addr)
+		if err != nil {
+			metricskey.RedisCmdErrors.IncrCounter(1, "dial", redisErrorType(err))
+		}
+		return conn, err
+	}
+}
+
+// ProcessHook reports the command
+func (m *redisMetrics) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		started := time.Now()
+		err := next(ctx, cmd)
+		metricskey.RedisCmdPerf.MeasureSince(started, cmd.Name())
+		m.report(cmd)
+		return err
+	}
+}
+
+// ProcessPipelineHook reports the pipeline latency, and each command of the pipeline
+func (m *redisMetrics) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		started := time.Now()
+		err := next(ctx, cmds)
+		metricskey.RedisCmdPerf.MeasureSince(started, "pipeline")
+		for _, cmd := range cmds {
+			m.report(cmd)
+		}
+		return err
+	}
+}
+
+func (m *redisMetrics) report(cmd redis.Cmder) {
+	name := cmd.Name()
+	if err := cmd.Err(); err != nil && !errors.Is(err, redis.Nil) {
+		metricskey.RedisCmdErrors.IncrCounter(1, name, redisErrorType(err))
+	}
+	if prefix, ok := m.keyPrefix(cmd.Args()); ok {
+		metricskey.RedisCmdKeys.IncrCounter(1, name, prefix)
+	}
+}
+
+// keyPrefix returns the first segment of the key after the provider prefix,
+// "none" for the keys without segments, or "other" when the limit is reached
+func (m *redisMetrics) keyPrefix(args []any) (string, bool) {
+	if len(args) < 2 {
+		return "", false
+	}
+	key, ok := args[1].(string)
+	if !ok || !strings.HasPrefix(key, m.prefix) {
+		return "", false
+	}
+	key = strings.TrimPrefix(strings.TrimPrefix(key, m.prefix), "/")
+	i := strings.IndexAny(key, "/:")
+	if i <= 0 {
+		return "none", true
+	}
+	prefix := key[:i]
+
+	m.lock.RLock()
+	_, found := m.prefixes[prefix]
+	count := len(m.prefixes)
+	m.lock.RUnlock()
+	if found {
+		return prefix, true
+	}
+	if count >= maxKeyPrefixes {
+		return "other", true
+	}
+
+	m.lock.Lock()
+	m.prefixes[prefix] = struct{}{}
+	count = len(m.prefixes)
+	m.lock.Unlock()
+
+	metricskey.RedisKeyPrefixes.SetGauge(float64(count))
+	return prefix, true
+}
+
+// redisErrorType returns the type of the error with low cardinality
+func redisErrorType(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, redis.ErrClosed):
+		return "closed"
+	case err.Error() == "redis: connection pool timeout":
+		return "pool_timeout"
+	}
+
+	var rerr redis.Error
+	if errors.As(err, &rerr) {
+		// the server errors start with the error code, e.g. READONLY or WRONGTYPE
+		if code, _, _ := strings.Cut(rerr.Error(), " "); code != "" {
+			return strings.ToLower(code)
+		}
+		return "server"
+	}
+	var nerr net.Error
+	if errors.As(err, &nerr) {
+		if nerr.Timeout() {
+			return "timeout"
+		}
+		return "network"
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return "network"
+	}
+	return "other"
+}
+
+// reportPoolStats reports the pool stats until the provider is closed
+func (p *redisProv) reportPoolStats(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			reportPoolStats(p.client.PoolStats())
+		}
+	}
+}
+
+func reportPoolStats(s *redis.PoolStats) {
+	metricskey.RedisPool.SetGauge(float64(s.Hits), "hits")
+	metricskey.RedisPool.SetGauge(float64(s.Misses), "misses")
+	metricskey.RedisPool.SetGauge(float64(s.Timeouts), "timeouts")
+	metricskey.RedisPool.SetGauge(float64(s.TotalConns), "total_conns")
+	metricskey.RedisPool.SetGauge(float64(s.IdleConns), "idle_conns")
+	metricskey.RedisPool.SetGauge(float64(s.StaleConns), "stale_conns")
+}
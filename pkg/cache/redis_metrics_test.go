@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+type redisErr string
+
+func (e redisErr) Error() string { return string(e) }
+func (e redisErr) RedisError()   {}
+
+func TestRedisErrorType(t *testing.T) {
+	tcs := []struct {
+		err error
+		exp string
+	}{
+		{context.DeadlineExceeded, "timeout"},
+		{errors.WithMessage(context.Canceled, "failed"), "canceled"},
+		{redis.ErrClosed, "closed"},
+		{errors.New("redis: connection pool timeout"), "pool_timeout"},
+		{redisErr("READONLY You can't write against a read only replica."), "readonly"},
+		{fmt.Errorf("failed: %w", redisErr("WRONGTYPE Operation against a key")), "wrongtype"},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, "network"},
+		{&net.DNSError{IsTimeout: true}, "timeout"},
+		{io.EOF, "network"},
+		{errors.New("unknown"), "other"},
+	}
+	for _, tc := range tcs {
+		assert.Equal(t, tc.exp, redisErrorType(tc.err), tc.err.Error())
+	}
+}
+
+func TestRedisKeyPrefix(t *testing.T) {
+	m := newRedisMetrics("/svc")
+
+	prefix, ok := m.keyPrefix([]any{"get", "/svc/sessions/123"})
+	assert.True(t, ok)
+	assert.Equal(t, "sessions", prefix)
+	prefix, _ = m.keyPrefix([]any{"set", "/svc/lock:job", "v"})
+	assert.Equal(t, "lock", prefix)
+	prefix, _ = m.keyPrefix([]any{"del", "/svc/123"})
+	assert.Equal(t, "none", prefix)
+
+	_, ok = m.keyPrefix([]any{"ping"})
+	assert.False(t, ok)
+	_, ok = m.keyPrefix([]any{"scan", 0})
+	assert.False(t, ok)
+	_, ok = m.keyPrefix([]any{"publish", "channel", "msg"})
+	assert.False(t, ok)
+
+	for i := len(m.prefixes); i < maxKeyPrefixes; i++ {
+		_, _ = m.keyPrefix([]any{"get", fmt.Sprintf("/svc/p%d/k", i)})
+	}
+	prefix, _ = m.keyPrefix([]any{"get", "/svc/new/k"})
+	assert.Equal(t, "other", prefix)
+	prefix, _ = m.keyPrefix([]any{"get", "/svc/sessions/456"})
+	assert.Equal(t, "sessions", prefix)
+
+	cmd := redis.NewStatusCmd(context.Background(), "set", "/svc/sessions/1", "v")
+	cmd.SetErr(redisErr("OOM command not allowed"))
+	hook := m.ProcessHook(func(context.Context, redis.Cmder) error {
+		time.Sleep(time.Millisecond)
+		return cmd.Err()
+	})
+	assert.Error(t, hook(context.Background(), cmd))
+}
@@ -0,0 +1,167 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+// Client provides JSON-RPC 2.0 client over retriable HTTP client
+type Client struct {
+	requester retriable.PostRequester
+	path      string
+	lastID    uint64
+}
+
+// NewClient returns a new JSON-RPC client,
+// that sends requests to the specified path
+func NewClient(requester retriable.PostRequester, path string) *Client {
+	return &Client{
+		requester: requester,
+		path:      path,
+	}
+}
+
+// BatchCall defines a call in the batch
+type BatchCall struct {
+	// Method to call
+	Method string
+	// Params of the call
+	Params any
+	// Result to decode the result into, nil for notification
+	Result any
+	// Error is set when the call failed
+	Error error
+	// Notification specifies that the call does not expect a response
+	Notification bool
+}
+
+func (c *Client) nextID() json.RawMessage {
+	return json.RawMessage(strconv.FormatUint(atomic.AddUint64(&c.lastID, 1), 10))
+}
+
+func newRequest(method string, params any, id json.RawMessage) (*Request, error) {
+	req := &Request{
+		JSONRPC: Version,
+		Method:  method,
+		ID:      id,
+	}
+	if params != nil {
+		js, err := json.Marshal(params)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "unable to encode params for %s", method)
+		}
+		req.Params = js
+	}
+	return req, nil
+}
+
+// Call invokes the method, and decodes the result.
+// JSON-RPC errors are returned as *httperror.Error,
+// with the cause set to *jsonrpc.Error
+func (c *Client) Call(ctx context.Context, method string, params any, result any) error {
+	req, err := newRequest(method, params, c.nextID())
+	if err != nil {
+		return err
+	}
+
+	var res Response
+	_, _, err = c.requester.Post(ctx, c.path, req, &res)
+	if err != nil {
+		return err
+	}
+	return decodeResult(&res, req.ID, result)
+}
+
+// Notify sends the notification, the server does not reply to notifications
+func (c *Client) Notify(ctx context.Context, method string, params any) error {
+	req, err := newRequest(method, params, nil)
+	if err != nil {
+		return err
+	}
+	w := bytes.Buffer{}
+	_, _, err = c.requester.Post(ctx, c.path, req, &w)
+	return err
+}
+
+// Batch sends the calls in a single batch request,
+// the results and errors are set on each call
+func (c *Client) Batch(ctx context.Context, calls []*BatchCall) error {
+	if len(calls) == 0 {
+		return nil
+	}
+
+	reqs := make([]*Request, 0, len(calls))
+	byID := map[string]*BatchCall{}
+	for _, call := range calls {
+		var id json.RawMessage
+		if !call.Notification {
+			id = c.nextID()
+			byID[string(id)] = call
+		}
+		req, err := newRequest(call.Method, call.Params, id)
+		if err != nil {
+			return err
+		}
+		reqs = append(reqs, req)
+	}
+
+	w := bytes.Buffer{}
+	_, _, err := c.requester.Post(ctx, c.path, reqs, &w)
+	if err != nil {
+		return err
+	}
+	if len(byID) == 0 {
+		return nil
+	}
+
+	var res []*Response
+	if err = json.Unmarshal(w.Bytes(), &res); err != nil {
+		// the server may return a single error for invalid batch
+		var single Response
+		if json.Unmarshal(w.Bytes(), &single) == nil && single.Error != nil {
+			return single.Error.HTTPError()
+		}
+		return errors.WithMessage(err, "unable to decode batch response")
+	}
+
+	for _, r := range res {
+		call := byID[string(r.ID)]
+		if call == nil {
+			logger.ContextKV(ctx, xlog.WARNING,
+				"reason", "unknown_id",
+				"id", string(r.ID))
+			continue
+		}
+		call.Error = decodeResult(r, r.ID, call.Result)
+		delete(byID, string(r.ID))
+	}
+	for id, call := range byID {
+		call.Error = httperror.Unexpected("no response for call %s, id %s", call.Method, id)
+	}
+	return nil
+}
+
+func decodeResult(res *Response, id json.RawMessage, result any) error {
+	if res.Error != nil {
+		return res.Error.HTTPError()
+	}
+	if !bytes.Equal(res.ID, id) {
+		return httperror.Unexpected("unexpected response id: %s", string(res.ID))
+	}
+	if result != nil && len(res.Result) > 0 {
+		d := json.NewDecoder(bytes.NewReader(res.Result))
+		d.UseNumber()
+		if err := d.Decode(result); err != nil {
+			return errors.WithMessagef(err, "unable to decode result to (%T) type", result)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+// Package jsonrpc provides JSON-RPC 2.0 client and server helpers
+package jsonrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+var logger = xlog.NewPackageLogger("github.com/effective-security/porto/pkg", "jsonrpc")
+
+// Version is the JSON-RPC protocol version
+const Version = "2.0"
+
+// Standard JSON-RPC 2.0 error codes
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	// CodeServerError is reserved for implementation-defined server-errors,
+	// the range is from -32000 to -32099
+	CodeServerError = -32000
+)
+
+// Request defines JSON-RPC request,
+// the request without ID is a notification
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// IsNotification returns true if the request is a notification
+func (r *Request) IsNotification() bool {
+	return len(r.ID) == 0
+}
+
+// Response defines JSON-RPC response
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// Error defines JSON-RPC error object
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+// NewError returns a new Error
+func NewError(code int, msgFormat string, vals ...any) *Error {
+	return &Error{
+		Code:    code,
+		Message: fmt.Sprintf(msgFormat, vals...),
+	}
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc %d: %s", e.Code, e.Message)
+}
+
+// HTTPError maps JSON-RPC error to httperror.Error
+func (e *Error) HTTPError() *httperror.Error {
+	var herr *httperror.Error
+	switch e.Code {
+	case CodeParseError:
+		herr = httperror.InvalidJSON("%s", e.Message)
+	case CodeInvalidRequest:
+		herr = httperror.InvalidRequest("%s", e.Message)
+	case CodeMethodNotFound:
+		herr = httperror.NotFound("%s", e.Message)
+	case CodeInvalidParams:
+		herr = httperror.InvalidParam("%s", e.Message)
+	case CodeInternalError:
+		herr = httperror.Unexpected("%s", e.Message)
+	default:
+		if code, ok := e.Data.(string); ok && code != "" {
+			// the server can provide httperror code in data
+			herr = httperror.New(http.StatusBadRequest, code, "%s", e.Message)
+		} else {
+			herr = httperror.New(http.StatusBadRequest, httperror.CodeRequestFailed, "%s", e.Message)
+		}
+	}
+	return herr.WithCause(e)
+}
+
+// ErrorFromError maps the error returned by a handler into JSON-RPC error object
+func ErrorFromError(err error) *Error {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+
+	var herr *httperror.Error
+	if errors.As(err, &herr) {
+		code := CodeServerError
+		switch herr.Code {
+		case httperror.CodeInvalidJSON:
+			code = CodeParseError
+		case httperror.CodeInvalidRequest:
+			code = CodeInvalidRequest
+		case httperror.CodeInvalidParam:
+			code = CodeInvalidParams
+		case httperror.CodeUnexpected:
+			code = CodeInternalError
+		}
+		return &Error{
+			Code:    code,
+			Message: herr.Message,
+			Data:    herr.Code,
+		}
+	}
+
+	return &Error{
+		Code:    CodeInternalError,
+		Message: err.Error(),
+	}
+}
@@ -0,0 +1,190 @@
+package jsonrpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/effective-security/porto/pkg/jsonrpc"
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/restserver/authz"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/porto/xhttp/identity"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sumParams struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+func newTestServer(t *testing.T, az jsonrpc.Authorizer, role string) (*httptest.Server, *int32) {
+	var notified int32
+	svc := jsonrpc.NewService("/v1/jsonrpc").
+		WithAuthz(az).
+		AddMethod("sum", func(_ context.Context, params json.RawMessage) (any, error) {
+			var p sumParams
+			if err := json.Unmarshal(params, &p); err != nil {
+				return nil, httperror.InvalidParam("invalid params")
+			}
+			return p.A + p.B, nil
+		}).
+		AddMethod("fail", func(context.Context, json.RawMessage) (any, error) {
+			return nil, httperror.NotFound("item not found")
+		}).
+		AddMethod("panic", func(context.Context, json.RawMessage) (any, error) {
+			panic("boom")
+		}).
+		AddMethod("notify", func(context.Context, json.RawMessage) (any, error) {
+			atomic.AddInt32(&notified, 1)
+			return nil, nil
+		})
+	assert.Equal(t, jsonrpc.ServiceName, svc.Name())
+	assert.True(t, svc.IsReady())
+
+	router := restserver.NewRouter(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	svc.Register(router)
+
+	h := router.Handler()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = identity.WithTestIdentity(r, identity.NewIdentity(role, "test", "", nil, "", ""))
+		h.ServeHTTP(w, r)
+	}))
+	return server, &notified
+}
+
+func TestService(t *testing.T) {
+	server, notified := newTestServer(t, nil, "guest")
+	defer server.Close()
+
+	rc, err := retriable.Default(server.URL)
+	require.NoError(t, err)
+	client := jsonrpc.NewClient(rc, "/v1/jsonrpc")
+	ctx := context.Background()
+
+	var sum int
+	require.NoError(t, client.Call(ctx, "sum", &sumParams{A: 1, B: 2}, &sum))
+	assert.Equal(t, 3, sum)
+
+	err = client.Call(ctx, "sum", "invalid", &sum)
+	require.Error(t, err)
+	herr := new(httperror.Error)
+	require.True(t, errors.As(err, &herr))
+	assert.Equal(t, httperror.CodeInvalidParam, herr.Code)
+
+	err = client.Call(ctx, "fail", nil, nil)
+	require.True(t, errors.As(err, &herr))
+	assert.Equal(t, httperror.CodeNotFound, herr.Code)
+	assert.Equal(t, "item not found", herr.Message)
+
+	err = client.Call(ctx, "panic", nil, nil)
+	require.True(t, errors.As(err, &herr))
+	assert.Equal(t, httperror.CodeUnexpected, herr.Code)
+
+	err = client.Call(ctx, "unknown", nil, nil)
+	require.True(t, errors.As(err, &herr))
+	assert.Equal(t, httperror.CodeNotFound, herr.Code)
+	var rpcErr *jsonrpc.Error
+	require.True(t, errors.As(err, &rpcErr))
+	assert.Equal(t, jsonrpc.CodeMethodNotFound, rpcErr.Code)
+
+	require.NoError(t, client.Notify(ctx, "notify", nil))
+	assert.Equal(t, int32(1), atomic.LoadInt32(notified))
+
+	var sum2 int
+	calls := []*jsonrpc.BatchCall{
+		{Method: "sum", Params: &sumParams{A: 2, B: 2}, Result: &sum},
+		{Method: "notify", Notification: true},
+		{Method: "fail"},
+		{Method: "sum", Params: &sumParams{A: 3, B: 3}, Result: &sum2},
+	}
+	require.NoError(t, client.Batch(ctx, calls))
+	assert.NoError(t, calls[0].Error)
+	assert.Equal(t, 4, sum)
+	assert.Error(t, calls[2].Error)
+	assert.NoError(t, calls[3].Error)
+	assert.Equal(t, 6, sum2)
+	assert.Equal(t, int32(2), atomic.LoadInt32(notified))
+
+	require.NoError(t, client.Batch(ctx, []*jsonrpc.BatchCall{{Method: "notify", Notification: true}}))
+	assert.Equal(t, int32(3), atomic.LoadInt32(notified))
+}
+
+func TestServiceInvalid(t *testing.T) {
+	server, _ := newTestServer(t, nil, "guest")
+	defer server.Close()
+
+	tcases := []struct {
+		req  string
+		code int
+	}{
+		{`{`, jsonrpc.CodeParseError},
+		{`[]`, jsonrpc.CodeInvalidRequest},
+		{`{"jsonrpc":"1.0","method":"sum","id":1}`, jsonrpc.CodeInvalidRequest},
+	}
+	for _, tc := range tcases {
+		resp, err := http.Post(server.URL+"/v1/jsonrpc", "application/json", strings.NewReader(tc.req))
+		require.NoError(t, err)
+
+		var res jsonrpc.Response
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		resp.Body.Close()
+		require.NotNil(t, res.Error, tc.req)
+		assert.Equal(t, tc.code, res.Error.Code, tc.req)
+	}
+}
+
+func TestServiceAuthz(t *testing.T) {
+	az, err := authz.New(&authz.Config{
+		Allow: []string{"/v1/jsonrpc/sum:admin"},
+	})
+	require.NoError(t, err)
+
+	server, _ := newTestServer(t, az, "guest")
+	defer server.Close()
+
+	rc, err := retriable.Default(server.URL)
+	require.NoError(t, err)
+	client := jsonrpc.NewClient(rc, "/v1/jsonrpc")
+
+	var sum int
+	err = client.Call(context.Background(), "sum", &sumParams{A: 1, B: 2}, &sum)
+	require.Error(t, err)
+	herr := new(httperror.Error)
+	require.True(t, errors.As(err, &herr))
+	assert.Equal(t, httperror.CodeUnauthorized, herr.Code)
+
+	server2, _ := newTestServer(t, az, "admin")
+	defer server2.Close()
+
+	client = jsonrpc.NewClient(rc.WithHost(server2.URL), "/v1/jsonrpc")
+	require.NoError(t, client.Call(context.Background(), "sum", &sumParams{A: 1, B: 2}, &sum))
+	assert.Equal(t, 3, sum)
+}
+
+func TestErrorMapping(t *testing.T) {
+	e := jsonrpc.ErrorFromError(errors.New("plain"))
+	assert.Equal(t, jsonrpc.CodeInternalError, e.Code)
+	assert.Equal(t, "jsonrpc -32603: plain", e.Error())
+	assert.Equal(t, httperror.CodeUnexpected, e.HTTPError().Code)
+
+	e = jsonrpc.ErrorFromError(httperror.InvalidJSON("bad"))
+	assert.Equal(t, jsonrpc.CodeParseError, e.Code)
+	assert.Equal(t, httperror.CodeInvalidJSON, e.HTTPError().Code)
+
+	e = jsonrpc.ErrorFromError(httperror.InvalidRequest("bad"))
+	assert.Equal(t, httperror.CodeInvalidRequest, e.HTTPError().Code)
+
+	e = jsonrpc.NewError(1, "custom")
+	assert.Equal(t, httperror.CodeRequestFailed, e.HTTPError().Code)
+	assert.Equal(t, e, jsonrpc.ErrorFromError(errors.WithMessage(e, "wrapped")))
+}
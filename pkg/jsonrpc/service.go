@@ -0,0 +1,219 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/x/concurrency"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/identity"
+	"github.com/effective-security/xlog"
+)
+
+// Handler defines a JSON-RPC method handler
+type Handler func(ctx context.Context, params json.RawMessage) (any, error)
+
+// Authorizer defines an interface to check access to JSON-RPC methods,
+// the path is the service path with the method name appended, e.g. /v1/jsonrpc/user.get
+type Authorizer interface {
+	IsAllowed(ctx context.Context, path string, idn identity.Identity) bool
+}
+
+// ServiceName provides the default service name
+const ServiceName = "jsonrpc"
+
+// Service provides restserver.Service adapter,
+// that dispatches JSON-RPC requests to registered handlers
+type Service struct {
+	name     string
+	path     string
+	authz    Authorizer
+	lock     sync.RWMutex
+	handlers map[string]Handler
+}
+
+// NewService returns a new JSON-RPC service,
+// that handles POST requests on the specified path
+func NewService(path string) *Service {
+	return &Service{
+		name:     ServiceName,
+		path:     path,
+		handlers: map[string]Handler{},
+	}
+}
+
+// WithName sets the service name
+func (s *Service) WithName(name string) *Service {
+	s.name = name
+	return s
+}
+
+// WithAuthz sets the authorizer, that will be checked for every method call
+func (s *Service) WithAuthz(authz Authorizer) *Service {
+	s.authz = authz
+	return s
+}
+
+// AddMethod registers the handler for the method
+func (s *Service) AddMethod(method string, handler Handler) *Service {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.handlers[method] = handler
+	return s
+}
+
+// Name returns the service name
+func (s *Service) Name() string {
+	return s.name
+}
+
+// IsReady indicates that the service is ready to serve its end-points
+func (s *Service) IsReady() bool {
+	return true
+}
+
+// Close the subservices and it's resources
+func (s *Service) Close() {
+}
+
+// Register adds the JSON-RPC endpoint to the router
+func (s *Service) Register(r restserver.Router) {
+	r.POST(s.path, s.handle)
+}
+
+func (s *Service) handle(w http.ResponseWriter, r *http.Request, _ restserver.Params) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeResponse(w, http.StatusOK, errorResponse(nil, NewError(CodeParseError, "unable to read request")))
+		return
+	}
+
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var reqs []*Request
+		if err = json.Unmarshal(body, &reqs); err != nil {
+			writeResponse(w, http.StatusOK, errorResponse(nil, NewError(CodeParseError, "invalid JSON")))
+			return
+		}
+		if len(reqs) == 0 {
+			writeResponse(w, http.StatusOK, errorResponse(nil, NewError(CodeInvalidRequest, "empty batch")))
+			return
+		}
+
+		var res []*Response
+		for _, req := range reqs {
+			if rs := s.dispatch(r, req); rs != nil {
+				res = append(res, rs)
+			}
+		}
+		if len(res) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeResponse(w, http.StatusOK, res)
+		return
+	}
+
+	var req Request
+	if err = json.Unmarshal(body, &req); err != nil {
+		writeResponse(w, http.StatusOK, errorResponse(nil, NewError(CodeParseError, "invalid JSON")))
+		return
+	}
+	res := s.dispatch(r, &req)
+	if res == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeResponse(w, http.StatusOK, res)
+}
+
+// dispatch executes the request, and returns nil for notifications
+func (s *Service) dispatch(r *http.Request, req *Request) *Response {
+	ctx := r.Context()
+	if req.JSONRPC != Version || req.Method == "" {
+		return errorResponse(req.ID, NewError(CodeInvalidRequest, "invalid request"))
+	}
+
+	s.lock.RLock()
+	handler := s.handlers[req.Method]
+	s.lock.RUnlock()
+
+	if handler == nil {
+		return s.reply(req, nil, NewError(CodeMethodNotFound, "method not found: %s", req.Method))
+	}
+
+	if s.authz != nil {
+		idn := identity.FromRequest(r).Identity()
+		if !s.authz.IsAllowed(ctx, s.methodPath(req.Method), idn) {
+			logger.ContextKV(ctx, xlog.NOTICE,
+				"status", "denied",
+				"method", req.Method,
+				"role", idn.Role())
+			return s.reply(req, nil, &Error{
+				Code:    CodeServerError,
+				Message: idn.Role() + " role not allowed",
+				Data:    "unauthorized",
+			})
+		}
+	}
+
+	var result any
+	err := concurrency.Safe(ctx, req.Method, func(ctx context.Context) error {
+		var err error
+		result, err = handler(ctx, req.Params)
+		return err
+	})
+	if err != nil {
+		logger.ContextKV(ctx, xlog.DEBUG,
+			"method", req.Method,
+			"err", err.Error())
+		return s.reply(req, nil, ErrorFromError(err))
+	}
+	return s.reply(req, result, nil)
+}
+
+func (s *Service) methodPath(method string) string {
+	return strings.TrimSuffix(s.path, "/") + "/" + method
+}
+
+func (s *Service) reply(req *Request, result any, rpcErr *Error) *Response {
+	if req.IsNotification() {
+		return nil
+	}
+	if rpcErr != nil {
+		return errorResponse(req.ID, rpcErr)
+	}
+
+	js, err := json.Marshal(result)
+	if err != nil {
+		return errorResponse(req.ID, NewError(CodeInternalError, "unable to encode result"))
+	}
+	return &Response{
+		JSONRPC: Version,
+		Result:  js,
+		ID:      req.ID,
+	}
+}
+
+func errorResponse(id json.RawMessage, rpcErr *Error) *Response {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return &Response{
+		JSONRPC: Version,
+		Error:   rpcErr,
+		ID:      id,
+	}
+}
+
+func writeResponse(w http.ResponseWriter, status int, body any) {
+	w.Header().Set(header.ContentType, header.ApplicationJSON)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
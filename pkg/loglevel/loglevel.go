@@ -0,0 +1,257 @@
+// Package loglevel provides runtime control of xlog levels per repo and package,
+// with optional TTL after which the previous level is restored.
+package loglevel
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+var logger = xlog.NewPackageLogger("github.com/effective-security/porto/pkg", "loglevel")
+
+// Level specifies the requested log level
+type Level struct {
+	// Repo specifies the repo name, or '*' for all repos
+	Repo string `json:"repo" yaml:"repo"`
+	// Package specifies the package name, or empty for all packages in the repo
+	Package string `json:"package,omitempty" yaml:"package,omitempty"`
+	// Level specifies the log level [ERROR,WARNING,NOTICE,INFO,DEBUG,TRACE]
+	Level string `json:"level" yaml:"level"`
+	// TTL specifies the duration after which the previous level is restored,
+	// zero value means the level is permanent
+	TTL time.Duration `json:"-" yaml:"ttl,omitempty"`
+}
+
+// Override describes the active temporary level
+type Override struct {
+	Level
+	Expires time.Time `json:"expires"`
+}
+
+type override struct {
+	Override
+	previous []xlog.RepoLogLevel
+	timer    *time.Timer
+}
+
+// Controller changes log levels at runtime
+type Controller struct {
+	lock      sync.Mutex
+	overrides map[string]*override
+}
+
+// New returns Controller
+func New() *Controller {
+	return &Controller{
+		overrides: map[string]*override{},
+	}
+}
+
+// Set changes the log level, and schedules the revert if TTL is specified
+func (c *Controller) Set(ctx context.Context, l Level) error {
+	lvl, err := xlog.ParseLevel(strings.ToUpper(l.Level))
+	if err != nil {
+		return httperror.InvalidParam("invalid level: %s", l.Level)
+	}
+	if l.Repo == "" {
+		return httperror.InvalidParam("repo is required")
+	}
+	if l.Package == "*" {
+		l.Package = ""
+	}
+	if l.Repo != "*" {
+		rl, err := xlog.GetRepoLogger(l.Repo)
+		if err != nil {
+			return httperror.NotFound("repo not found: %s", l.Repo)
+		}
+		if _, ok := rl[l.Package]; l.Package != "" && !ok {
+			return httperror.NotFound("package not found: %s/%s", l.Repo, l.Package)
+		}
+	}
+	l.Level = lvl.String()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	key := l.Repo + "/" + l.Package
+	prev := c.overrides[key]
+	if prev != nil {
+		prev.timer.Stop()
+		delete(c.overrides, key)
+	}
+
+	if l.TTL > 0 {
+		o := &override{
+			Override: Override{
+				Level:   l,
+				Expires: time.Now().Add(l.TTL),
+			},
+		}
+		if prev != nil {
+			// keep the original level to restore
+			o.previous = prev.previous
+		} else {
+			o.previous = snapshot(l.Repo, l.Package)
+		}
+		o.timer = time.AfterFunc(l.TTL, func() {
+			c.expire(key, o)
+		})
+		c.overrides[key] = o
+	}
+
+	xlog.SetRepoLevel(xlog.RepoLogLevel{
+		Repo:    l.Repo,
+		Package: l.Package,
+		Level:   l.Level,
+	})
+
+	logger.ContextKV(ctx, xlog.NOTICE,
+		"repo", l.Repo,
+		"package", l.Package,
+		"level", l.Level,
+		"ttl", l.TTL)
+	return nil
+}
+
+// Reset restores the previous level of the active override
+func (c *Controller) Reset(ctx context.Context, repo, pkg string) error {
+	if pkg == "*" {
+		pkg = ""
+	}
+	key := repo + "/" + pkg
+
+	c.lock.Lock()
+	o := c.overrides[key]
+	c.lock.Unlock()
+
+	if o == nil {
+		return httperror.NotFound("override not found: %s", key)
+	}
+	o.timer.Stop()
+	c.expire(key, o)
+	return nil
+}
+
+// Overrides returns the active overrides
+func (c *Controller) Overrides() []Override {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	list := make([]Override, 0, len(c.overrides))
+	for _, o := range c.overrides {
+		list = append(list, o.Override)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Repo == list[j].Repo {
+			return list[i].Package < list[j].Package
+		}
+		return list[i].Repo < list[j].Repo
+	})
+	return list
+}
+
+// Close stops the timers, the current levels are not restored
+func (c *Controller) Close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for key, o := range c.overrides {
+		o.timer.Stop()
+		delete(c.overrides, key)
+	}
+}
+
+func (c *Controller) expire(key string, o *override) {
+	c.lock.Lock()
+	if c.overrides[key] != o {
+		// already replaced or reset
+		c.lock.Unlock()
+		return
+	}
+	delete(c.overrides, key)
+	c.lock.Unlock()
+
+	xlog.SetRepoLevels(o.previous)
+
+	logger.KV(xlog.NOTICE,
+		"status", "restored",
+		"repo", o.Repo,
+		"package", o.Package)
+}
+
+// WatchFile loads the levels from the YAML file, and applies them
+// when the file is modified, until the context is cancelled
+func (c *Controller) WatchFile(ctx context.Context, file string, interval time.Duration) {
+	var modTime time.Time
+	check := func() {
+		fi, err := os.Stat(file)
+		if err != nil || !fi.ModTime().After(modTime) {
+			return
+		}
+		modTime = fi.ModTime()
+		if err = c.LoadFile(ctx, file); err != nil {
+			logger.ContextKV(ctx, xlog.ERROR,
+				"file", file,
+				"err", err.Error())
+		}
+	}
+	check()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				check()
+			}
+		}
+	}()
+}
+
+// LoadFile applies the levels from the YAML file
+func (c *Controller) LoadFile(ctx context.Context, file string) error {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	var levels []Level
+	if err = yaml.Unmarshal(b, &levels); err != nil {
+		return errors.WithMessagef(err, "unable to parse: %s", file)
+	}
+	for _, l := range levels {
+		if err = c.Set(ctx, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshot returns the current levels of the packages affected by the change
+func snapshot(repo, pkg string) []xlog.RepoLogLevel {
+	var list []xlog.RepoLogLevel
+	for _, l := range xlog.GetRepoLevels() {
+		if repo != "*" && l.Repo != repo {
+			continue
+		}
+		if pkg != "" && l.Package != pkg {
+			continue
+		}
+		if l.Package == "*" {
+			// restoring the repo level would override all packages
+			continue
+		}
+		list = append(list, l)
+	}
+	return list
+}
@@ -0,0 +1,158 @@
+package loglevel_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/loglevel"
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/xlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRepo = "github.com/effective-security/porto/pkg/loglevel_test"
+
+var (
+	pkgA = xlog.NewPackageLogger(testRepo, "a")
+	pkgB = xlog.NewPackageLogger(testRepo, "b")
+)
+
+func TestController(t *testing.T) {
+	ctx := context.Background()
+	xlog.SetRepoLogLevel(testRepo, xlog.INFO)
+
+	c := loglevel.New()
+	defer c.Close()
+
+	require.NoError(t, c.Set(ctx, loglevel.Level{Repo: testRepo, Package: "a", Level: "debug", TTL: 50 * time.Millisecond}))
+	assert.True(t, pkgA.LevelAt(xlog.DEBUG))
+	assert.False(t, pkgB.LevelAt(xlog.DEBUG))
+
+	list := c.Overrides()
+	require.Len(t, list, 1)
+	assert.Equal(t, "DEBUG", list[0].Level.Level)
+	assert.False(t, list[0].Expires.IsZero())
+
+	// extend the override, the original level is kept
+	require.NoError(t, c.Set(ctx, loglevel.Level{Repo: testRepo, Package: "a", Level: "DEBUG", TTL: 50 * time.Millisecond}))
+	assert.True(t, pkgA.LevelAt(xlog.DEBUG))
+
+	assert.Eventually(t, func() bool {
+		return !pkgA.LevelAt(xlog.DEBUG)
+	}, time.Second, 10*time.Millisecond)
+	assert.True(t, pkgA.LevelAt(xlog.INFO))
+	assert.Empty(t, c.Overrides())
+
+	// repo wide with reset
+	require.NoError(t, c.Set(ctx, loglevel.Level{Repo: testRepo, Level: "DEBUG", TTL: time.Hour}))
+	assert.True(t, pkgA.LevelAt(xlog.DEBUG))
+	assert.True(t, pkgB.LevelAt(xlog.DEBUG))
+	require.NoError(t, c.Reset(ctx, testRepo, "*"))
+	assert.False(t, pkgA.LevelAt(xlog.DEBUG))
+	assert.False(t, pkgB.LevelAt(xlog.DEBUG))
+
+	// permanent
+	require.NoError(t, c.Set(ctx, loglevel.Level{Repo: testRepo, Package: "b", Level: "ERROR"}))
+	assert.False(t, pkgB.LevelAt(xlog.INFO))
+	assert.Empty(t, c.Overrides())
+	xlog.SetRepoLogLevel(testRepo, xlog.INFO)
+
+	assert.EqualError(t, c.Set(ctx, loglevel.Level{Repo: testRepo, Level: "LOUD"}), "invalid_parameter: invalid level: LOUD")
+	assert.EqualError(t, c.Set(ctx, loglevel.Level{Level: "INFO"}), "invalid_parameter: repo is required")
+	assert.EqualError(t, c.Set(ctx, loglevel.Level{Repo: "unknown", Level: "INFO"}), "not_found: repo not found: unknown")
+	assert.EqualError(t, c.Set(ctx, loglevel.Level{Repo: testRepo, Package: "c", Level: "INFO"}), "not_found: package not found: "+testRepo+"/c")
+	assert.EqualError(t, c.Reset(ctx, testRepo, "a"), "not_found: override not found: "+testRepo+"/a")
+}
+
+func TestWatchFile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	xlog.SetRepoLogLevel(testRepo, xlog.INFO)
+	defer xlog.SetRepoLogLevel(testRepo, xlog.INFO)
+
+	file := filepath.Join(t.TempDir(), "levels.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(`
+- repo: `+testRepo+`
+  package: b
+  level: DEBUG
+  ttl: 1h
+`), 0600))
+
+	c := loglevel.New()
+	defer c.Close()
+	c.WatchFile(ctx, file, 10*time.Millisecond)
+	assert.True(t, pkgB.LevelAt(xlog.DEBUG))
+	require.Len(t, c.Overrides(), 1)
+	assert.Equal(t, time.Hour, c.Overrides()[0].TTL)
+
+	// the next modification is applied
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, os.WriteFile(file, []byte(`[{repo: `+testRepo+`, package: b, level: WARNING}]`), 0600))
+	future := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(file, future, future))
+	assert.Eventually(t, func() bool {
+		return !pkgB.LevelAt(xlog.NOTICE)
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(file, []byte(`invalid`), 0600))
+	assert.Error(t, c.LoadFile(ctx, file))
+	assert.Error(t, c.LoadFile(ctx, file+".missing"))
+}
+
+func TestService(t *testing.T) {
+	xlog.SetRepoLogLevel(testRepo, xlog.INFO)
+	defer xlog.SetRepoLogLevel(testRepo, xlog.INFO)
+
+	c := loglevel.New()
+	defer c.Close()
+	svc := loglevel.NewService(c, "")
+	assert.Equal(t, loglevel.ServiceName, svc.Name())
+	assert.True(t, svc.IsReady())
+	defer svc.Close()
+
+	router := restserver.NewRouter(nil)
+	svc.Register(router)
+	h := router.Handler()
+
+	call := func(method, url, body string) (*httptest.ResponseRecorder, *loglevel.LevelsResponse) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		res := new(loglevel.LevelsResponse)
+		_ = json.Unmarshal(w.Body.Bytes(), res)
+		return w, res
+	}
+
+	w, res := call(http.MethodGet, loglevel.DefaultPath, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, res.Levels)
+	assert.Empty(t, res.Overrides)
+
+	w, res = call(http.MethodPost, loglevel.DefaultPath, `{"repo":"`+testRepo+`","package":"a","level":"debug","ttl":"10m"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Len(t, res.Overrides, 1)
+	assert.Equal(t, "a", res.Overrides[0].Package)
+	assert.True(t, pkgA.LevelAt(xlog.DEBUG))
+
+	w, _ = call(http.MethodPost, loglevel.DefaultPath, `{"repo":"`+testRepo+`","level":"debug","ttl":"soon"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w, _ = call(http.MethodPost, loglevel.DefaultPath, `{`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w, _ = call(http.MethodPost, loglevel.DefaultPath, `{"repo":"unknown","level":"debug"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w, res = call(http.MethodDelete, loglevel.DefaultPath+"?repo="+testRepo+"&package=a", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, res.Overrides)
+	assert.False(t, pkgA.LevelAt(xlog.DEBUG))
+
+	w, _ = call(http.MethodDelete, loglevel.DefaultPath+"?repo="+testRepo+"&package=a", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
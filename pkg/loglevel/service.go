@@ -0,0 +1,124 @@
+package loglevel
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/porto/xhttp/marshal"
+	"github.com/effective-security/xlog"
+)
+
+// ServiceName provides the default service name
+const ServiceName = "loglevel"
+
+// DefaultPath is the default admin path for log levels,
+// access should be restricted by authz configuration
+const DefaultPath = "/v1/admin/loglevels"
+
+// SetLevelRequest is the request to change the log level
+type SetLevelRequest struct {
+	Repo    string `json:"repo"`
+	Package string `json:"package,omitempty"`
+	Level   string `json:"level"`
+	// TTL is the duration in Go format, for example 15m
+	TTL string `json:"ttl,omitempty"`
+}
+
+// LevelsResponse is returned by the admin endpoints
+type LevelsResponse struct {
+	Levels    []xlog.RepoLogLevel `json:"levels"`
+	Overrides []Override          `json:"overrides"`
+}
+
+// Service provides restserver.Service with admin endpoints:
+// GET to list levels, POST to change the level, and DELETE to reset the override
+// specified by `repo` and `package` query parameters
+type Service struct {
+	path string
+	ctrl *Controller
+}
+
+// NewService returns admin Service for the Controller
+func NewService(ctrl *Controller, path string) *Service {
+	if path == "" {
+		path = DefaultPath
+	}
+	return &Service{
+		path: path,
+		ctrl: ctrl,
+	}
+}
+
+// Name returns the service name
+func (s *Service) Name() string {
+	return ServiceName
+}
+
+// IsReady indicates that the service is ready to serve its end-points
+func (s *Service) IsReady() bool {
+	return true
+}
+
+// Close the subservices and it's resources
+func (s *Service) Close() {
+}
+
+// Register adds the admin endpoints to the router
+func (s *Service) Register(r restserver.Router) {
+	r.GET(s.path, s.list)
+	r.POST(s.path, s.set)
+	r.DELETE(s.path, s.reset)
+}
+
+func (s *Service) list(w http.ResponseWriter, r *http.Request, _ restserver.Params) {
+	marshal.WriteJSON(w, r, s.levels())
+}
+
+func (s *Service) set(w http.ResponseWriter, r *http.Request, _ restserver.Params) {
+	ctx := r.Context()
+
+	var req SetLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		marshal.WriteJSON(w, r, httperror.InvalidJSON("unable to decode request").WithContext(ctx))
+		return
+	}
+	l := Level{
+		Repo:    req.Repo,
+		Package: req.Package,
+		Level:   req.Level,
+	}
+	if req.TTL != "" {
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl < 0 {
+			marshal.WriteJSON(w, r, httperror.InvalidParam("invalid ttl: %s", req.TTL).WithContext(ctx))
+			return
+		}
+		l.TTL = ttl
+	}
+
+	if err := s.ctrl.Set(ctx, l); err != nil {
+		marshal.WriteJSON(w, r, httperror.WrapWithCtx(ctx, err))
+		return
+	}
+	marshal.WriteJSON(w, r, s.levels())
+}
+
+func (s *Service) reset(w http.ResponseWriter, r *http.Request, _ restserver.Params) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	if err := s.ctrl.Reset(ctx, q.Get("repo"), q.Get("package")); err != nil {
+		marshal.WriteJSON(w, r, httperror.WrapWithCtx(ctx, err))
+		return
+	}
+	marshal.WriteJSON(w, r, s.levels())
+}
+
+func (s *Service) levels() *LevelsResponse {
+	return &LevelsResponse{
+		Levels:    xlog.GetRepoLevels(),
+		Overrides: s.ctrl.Overrides(),
+	}
+}
@@ -0,0 +1,305 @@
+// Package profiler provides helpers to capture heap, goroutine and mutex profiles
+// on demand, or automatically when the process crosses the memory or goroutine thresholds.
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+var logger = xlog.NewPackageLogger("github.com/effective-security/porto/pkg", "profiler")
+
+// Supported profiles
+const (
+	ProfileHeap      = "heap"
+	ProfileGoroutine = "goroutine"
+	ProfileMutex     = "mutex"
+	ProfileAllocs    = "allocs"
+	ProfileBlock     = "block"
+)
+
+// DefaultProfiles is the list of profiles captured by default
+var DefaultProfiles = []string{ProfileHeap, ProfileGoroutine, ProfileMutex}
+
+// Config provides configuration for the Profiler
+type Config struct {
+	// Profiles specifies the list of profiles to capture, default is heap, goroutine and mutex
+	Profiles []string `json:"profiles,omitempty" yaml:"profiles,omitempty"`
+
+	// MaxRSS specifies the RSS threshold in bytes, to capture profiles automatically
+	MaxRSS uint64 `json:"max_rss,omitempty" yaml:"max_rss,omitempty"`
+	// MaxGoroutines specifies the goroutine threshold, to capture profiles automatically
+	MaxGoroutines int `json:"max_goroutines,omitempty" yaml:"max_goroutines,omitempty"`
+	// CheckInterval specifies the interval to check the thresholds, default is 10s
+	CheckInterval time.Duration `json:"check_interval,omitempty" yaml:"check_interval,omitempty"`
+	// Cooldown specifies the minimum interval between automatic captures, default is 10m
+	Cooldown time.Duration `json:"cooldown,omitempty" yaml:"cooldown,omitempty"`
+
+	// MaxDumps specifies the number of dumps to keep, 0 for unlimited
+	MaxDumps int `json:"max_dumps,omitempty" yaml:"max_dumps,omitempty"`
+	// MaxAge specifies the maximum age of dumps to keep, 0 for unlimited
+	MaxAge time.Duration `json:"max_age,omitempty" yaml:"max_age,omitempty"`
+}
+
+// Dump describes the captured profile
+type Dump struct {
+	Name    string    `json:"name"`
+	Profile string    `json:"profile"`
+	Reason  string    `json:"reason"`
+	Size    int       `json:"size"`
+	Created time.Time `json:"created"`
+}
+
+// Profiler captures profiles to the Sink
+type Profiler struct {
+	cfg  Config
+	sink Sink
+
+	lock     sync.Mutex
+	lastAuto time.Time
+}
+
+// TimeNow is a function that returns the current time
+var TimeNow = time.Now
+
+// RSS returns the resident set size of the process in bytes
+var RSS = DefaultRSS
+
+// New returns Profiler
+func New(cfg Config, sink Sink) *Profiler {
+	if len(cfg.Profiles) == 0 {
+		cfg.Profiles = DefaultProfiles
+	}
+	if cfg.CheckInterval == 0 {
+		cfg.CheckInterval = 10 * time.Second
+	}
+	if cfg.Cooldown == 0 {
+		cfg.Cooldown = 10 * time.Minute
+	}
+	return &Profiler{
+		cfg:  cfg,
+		sink: sink,
+	}
+}
+
+// Capture writes the configured profiles to the sink,
+// and applies the retention policy
+func (p *Profiler) Capture(ctx context.Context, reason string) ([]*Dump, error) {
+	return p.CaptureProfiles(ctx, reason, p.cfg.Profiles...)
+}
+
+// CaptureProfiles writes the specified profiles to the sink,
+// and applies the retention policy
+func (p *Profiler) CaptureProfiles(ctx context.Context, reason string, profiles ...string) ([]*Dump, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	reason = sanitize(reason)
+	now := TimeNow().UTC()
+
+	var dumps []*Dump
+	for _, name := range profiles {
+		prof := pprof.Lookup(name)
+		if prof == nil {
+			return dumps, errors.Errorf("profile not supported: %s", name)
+		}
+		var buf bytes.Buffer
+		if err := prof.WriteTo(&buf, 0); err != nil {
+			return dumps, errors.WithMessagef(err, "unable to write %s profile", name)
+		}
+
+		d := &Dump{
+			Name:    fmt.Sprintf("%s_%s_%s.pprof", now.Format("20060102T150405.000Z"), reason, name),
+			Profile: name,
+			Reason:  reason,
+			Size:    buf.Len(),
+			Created: now,
+		}
+		if err := p.sink.Write(ctx, d.Name, buf.Bytes()); err != nil {
+			return dumps, errors.WithMessagef(err, "unable to store %s profile", name)
+		}
+		dumps = append(dumps, d)
+	}
+
+	logger.ContextKV(ctx, xlog.NOTICE,
+		"status", "captured",
+		"reason", reason,
+		"profiles", profiles)
+
+	if err := p.applyRetention(ctx); err != nil {
+		logger.ContextKV(ctx, xlog.ERROR,
+			"reason", "retention",
+			"err", err.Error())
+	}
+	return dumps, nil
+}
+
+// List returns the captured dumps, sorted by name
+func (p *Profiler) List(ctx context.Context) ([]*Dump, error) {
+	objs, err := p.sink.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var dumps []*Dump
+	for _, o := range objs {
+		d := parseDump(o.Name)
+		if d == nil {
+			continue
+		}
+		d.Size = int(o.Size)
+		dumps = append(dumps, d)
+	}
+	sort.Slice(dumps, func(i, j int) bool {
+		return dumps[i].Name < dumps[j].Name
+	})
+	return dumps, nil
+}
+
+// Check captures the profiles, if the process crossed the thresholds,
+// and returns the reason if captured
+func (p *Profiler) Check(ctx context.Context) (string, error) {
+	reason := ""
+	if p.cfg.MaxGoroutines > 0 && runtime.NumGoroutine() > p.cfg.MaxGoroutines {
+		reason = "goroutines"
+	} else if p.cfg.MaxRSS > 0 {
+		if rss := RSS(); rss > p.cfg.MaxRSS {
+			reason = "rss"
+		}
+	}
+	if reason == "" {
+		return "", nil
+	}
+
+	p.lock.Lock()
+	now := TimeNow()
+	if !p.lastAuto.IsZero() && now.Sub(p.lastAuto) < p.cfg.Cooldown {
+		p.lock.Unlock()
+		return "", nil
+	}
+	p.lastAuto = now
+	p.lock.Unlock()
+
+	logger.ContextKV(ctx, xlog.WARNING,
+		"reason", reason,
+		"goroutines", runtime.NumGoroutine(),
+		"rss", RSS())
+
+	_, err := p.Capture(ctx, reason)
+	return reason, err
+}
+
+// Start checks the thresholds periodically, until the context is cancelled
+func (p *Profiler) Start(ctx context.Context) {
+	if p.cfg.MaxRSS == 0 && p.cfg.MaxGoroutines == 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(p.cfg.CheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := p.Check(ctx); err != nil {
+					logger.ContextKV(ctx, xlog.ERROR,
+						"reason", "check",
+						"err", err.Error())
+				}
+			}
+		}
+	}()
+}
+
+// applyRetention must be called under lock
+func (p *Profiler) applyRetention(ctx context.Context) error {
+	if p.cfg.MaxDumps == 0 && p.cfg.MaxAge == 0 {
+		return nil
+	}
+	objs, err := p.sink.List(ctx)
+	if err != nil {
+		return err
+	}
+	// newest first
+	sort.Slice(objs, func(i, j int) bool {
+		return objs[i].Name > objs[j].Name
+	})
+
+	now := TimeNow()
+	for idx, o := range objs {
+		expired := p.cfg.MaxDumps > 0 && idx >= p.cfg.MaxDumps
+		if !expired && p.cfg.MaxAge > 0 {
+			if d := parseDump(o.Name); d != nil && now.Sub(d.Created) > p.cfg.MaxAge {
+				expired = true
+			}
+		}
+		if expired {
+			if err = p.sink.Delete(ctx, o.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func parseDump(name string) *Dump {
+	base, ok := strings.CutSuffix(name, ".pprof")
+	if !ok {
+		return nil
+	}
+	parts := strings.Split(base, "_")
+	if len(parts) < 3 {
+		return nil
+	}
+	created, err := time.Parse("20060102T150405.000Z", parts[0])
+	if err != nil {
+		return nil
+	}
+	return &Dump{
+		Name:    name,
+		Created: created,
+		Reason:  strings.Join(parts[1:len(parts)-1], "_"),
+		Profile: parts[len(parts)-1],
+	}
+}
+
+func sanitize(reason string) string {
+	reason = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-':
+			return r
+		}
+		return '-'
+	}, reason)
+	if reason == "" {
+		return "manual"
+	}
+	return reason
+}
+
+// DefaultRSS returns RSS from /proc, or the memory obtained from the OS
+func DefaultRSS() uint64 {
+	if b, err := os.ReadFile("/proc/self/statm"); err == nil {
+		fields := strings.Fields(string(b))
+		if len(fields) > 1 {
+			if pages, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+				return pages * uint64(os.Getpagesize())
+			}
+		}
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.Sys
+}
@@ -0,0 +1,138 @@
+package profiler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/profiler"
+	"github.com/effective-security/porto/restserver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapture(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	sink, err := profiler.NewDirSink(filepath.Join(dir, "dumps"))
+	require.NoError(t, err)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	profiler.TimeNow = func() time.Time { return now }
+	defer func() { profiler.TimeNow = time.Now }()
+
+	p := profiler.New(profiler.Config{MaxDumps: 4, MaxAge: time.Hour}, sink)
+
+	dumps, err := p.Capture(ctx, "test run")
+	require.NoError(t, err)
+	require.Len(t, dumps, 3)
+	assert.Equal(t, "20240101T000000.000Z_test-run_heap.pprof", dumps[0].Name)
+	assert.Equal(t, "test-run", dumps[0].Reason)
+	assert.NotZero(t, dumps[0].Size)
+
+	_, err = os.Stat(filepath.Join(dir, "dumps", dumps[1].Name))
+	require.NoError(t, err)
+
+	now = now.Add(time.Minute)
+	_, err = p.CaptureProfiles(ctx, "", profiler.ProfileGoroutine, profiler.ProfileHeap)
+	require.NoError(t, err)
+
+	// MaxDumps retention keeps the newest 4
+	list, err := p.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 4)
+	assert.Equal(t, "20240101T000100.000Z_manual_goroutine.pprof", list[2].Name)
+	assert.Equal(t, "manual", list[2].Reason)
+	assert.Equal(t, profiler.ProfileGoroutine, list[2].Profile)
+
+	// MaxAge retention
+	now = now.Add(2 * time.Hour)
+	_, err = p.CaptureProfiles(ctx, "later", profiler.ProfileHeap)
+	require.NoError(t, err)
+	list, err = p.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "later", list[0].Reason)
+
+	_, err = p.CaptureProfiles(ctx, "bad", "unknown")
+	assert.EqualError(t, err, "profile not supported: unknown")
+}
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	sink, err := profiler.NewDirSink(t.TempDir())
+	require.NoError(t, err)
+
+	profiler.RSS = func() uint64 { return 100 }
+	defer func() { profiler.RSS = profiler.DefaultRSS }()
+
+	p := profiler.New(profiler.Config{MaxRSS: 200, Profiles: []string{profiler.ProfileGoroutine}}, sink)
+	reason, err := p.Check(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, reason)
+
+	profiler.RSS = func() uint64 { return 300 }
+	reason, err = p.Check(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "rss", reason)
+
+	// cooldown
+	reason, err = p.Check(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, reason)
+
+	p = profiler.New(profiler.Config{MaxGoroutines: 1, Profiles: []string{profiler.ProfileGoroutine}}, sink)
+	reason, err = p.Check(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "goroutines", reason)
+
+	list, err := p.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	assert.NotZero(t, profiler.DefaultRSS())
+}
+
+func TestService(t *testing.T) {
+	sink, err := profiler.NewDirSink(t.TempDir())
+	require.NoError(t, err)
+
+	svc := profiler.NewService(profiler.New(profiler.Config{}, sink), "")
+	assert.Equal(t, profiler.ServiceName, svc.Name())
+	assert.True(t, svc.IsReady())
+	defer svc.Close()
+
+	router := restserver.NewRouter(nil)
+	svc.Register(router)
+	h := router.Handler()
+
+	call := func(method, url string) (*httptest.ResponseRecorder, *profiler.CaptureResponse) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, url, nil))
+		res := new(profiler.CaptureResponse)
+		_ = json.Unmarshal(w.Body.Bytes(), res)
+		return w, res
+	}
+
+	w, res := call(http.MethodPost, profiler.DefaultPath+"?profile=heap&reason=oom")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, res.Dumps, 1)
+	assert.Equal(t, "oom", res.Dumps[0].Reason)
+
+	w, res = call(http.MethodPost, profiler.DefaultPath)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, res.Dumps, 3)
+
+	w, res = call(http.MethodGet, profiler.DefaultPath)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, res.Dumps, 4)
+
+	w, _ = call(http.MethodPost, profiler.DefaultPath+"?profile=cpu")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "profile not supported: cpu")
+}
@@ -0,0 +1,105 @@
+package profiler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/porto/xhttp/marshal"
+)
+
+// ServiceName provides the default service name
+const ServiceName = "profiler"
+
+// DefaultPath is the default admin path for profiles,
+// access should be restricted by authz configuration
+const DefaultPath = "/v1/admin/profiles"
+
+// CaptureResponse is returned by the capture endpoint
+type CaptureResponse struct {
+	Dumps []*Dump `json:"dumps"`
+}
+
+// Service provides restserver.Service with admin endpoints:
+// GET to list dumps, and POST to capture profiles,
+// where `profile` and `reason` query parameters are optional
+type Service struct {
+	path     string
+	profiler *Profiler
+}
+
+// NewService returns admin Service for the Profiler
+func NewService(p *Profiler, path string) *Service {
+	if path == "" {
+		path = DefaultPath
+	}
+	return &Service{
+		path:     path,
+		profiler: p,
+	}
+}
+
+// Name returns the service name
+func (s *Service) Name() string {
+	return ServiceName
+}
+
+// IsReady indicates that the service is ready to serve its end-points
+func (s *Service) IsReady() bool {
+	return true
+}
+
+// Close the subservices and it's resources
+func (s *Service) Close() {
+}
+
+// Register adds the admin endpoints to the router
+func (s *Service) Register(r restserver.Router) {
+	r.GET(s.path, s.list)
+	r.POST(s.path, s.capture)
+}
+
+func (s *Service) list(w http.ResponseWriter, r *http.Request, _ restserver.Params) {
+	dumps, err := s.profiler.List(r.Context())
+	if err != nil {
+		marshal.WriteJSON(w, r, httperror.WrapWithCtx(r.Context(), err, "unable to list profiles"))
+		return
+	}
+	marshal.WriteJSON(w, r, &CaptureResponse{Dumps: dumps})
+}
+
+func (s *Service) capture(w http.ResponseWriter, r *http.Request, _ restserver.Params) {
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	profiles := s.profiler.cfg.Profiles
+	if list := q.Get("profile"); list != "" {
+		profiles = strings.Split(list, ",")
+		for _, p := range profiles {
+			if !isSupported(p) {
+				marshal.WriteJSON(w, r, httperror.InvalidParam("profile not supported: %s", p).WithContext(ctx))
+				return
+			}
+		}
+	}
+	reason := q.Get("reason")
+	if reason == "" {
+		reason = "manual"
+	}
+
+	dumps, err := s.profiler.CaptureProfiles(ctx, reason, profiles...)
+	if err != nil {
+		marshal.WriteJSON(w, r, httperror.WrapWithCtx(ctx, err, "unable to capture profiles"))
+		return
+	}
+	marshal.WriteJSON(w, r, &CaptureResponse{Dumps: dumps})
+}
+
+func isSupported(profile string) bool {
+	switch profile {
+	case ProfileHeap, ProfileGoroutine, ProfileMutex, ProfileAllocs, ProfileBlock:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package profiler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Object describes the stored dump
+type Object struct {
+	Name string
+	Size int64
+}
+
+// Sink provides the storage for profile dumps,
+// it can be implemented for object storage
+type Sink interface {
+	Write(ctx context.Context, name string, data []byte) error
+	List(ctx context.Context) ([]Object, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// DirSink stores dumps in the local folder
+type DirSink struct {
+	dir string
+}
+
+// NewDirSink returns Sink for the local folder
+func NewDirSink(dir string) (*DirSink, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.WithMessagef(err, "unable to create folder: %s", dir)
+	}
+	return &DirSink{dir: dir}, nil
+}
+
+// Write stores the dump
+func (s *DirSink) Write(_ context.Context, name string, data []byte) error {
+	if err := os.WriteFile(filepath.Join(s.dir, filepath.Base(name)), data, 0600); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// List returns the stored dumps
+func (s *DirSink) List(_ context.Context) ([]Object, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var list []Object
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".pprof") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		list = append(list, Object{Name: e.Name(), Size: info.Size()})
+	}
+	return list, nil
+}
+
+// Delete removes the dump
+func (s *DirSink) Delete(_ context.Context, name string) error {
+	err := os.Remove(filepath.Join(s.dir, filepath.Base(name)))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+	return nil
+}
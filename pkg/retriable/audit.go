@@ -0,0 +1,282 @@
+package retriable
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/effective-security/porto/xhttp/correlation"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/x/guid"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+// AuditRecord describes an outgoing request,
+// the bodies are not included, only the hash of the request body
+type AuditRecord struct {
+	Time   time.Time `json:"time"`
+	Client string    `json:"client,omitempty"`
+	Method string    `json:"method"`
+	// URL with the secrets redacted
+	URL string `json:"url"`
+	// StatusCode of the response, or zero on error
+	StatusCode int           `json:"status,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	Attempts   int           `json:"attempts"`
+	// Identity is the authorization scheme and the fingerprint of the credentials,
+	// for example `Bearer:2c26b46b68ffc68f`
+	Identity      string `json:"identity,omitempty"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// BodyHash is hex encoded SHA-256 of the request body
+	BodyHash string `json:"body_hash,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// AuditSink persists the audit records
+type AuditSink interface {
+	WriteAuditRecord(ctx context.Context, r *AuditRecord) error
+}
+
+// AuditConfig specifies the audit of the outgoing requests
+type AuditConfig struct {
+	// SampleRate is the fraction of the successful requests to audit,
+	// from 0 to 1, the failed requests are always audited.
+	// Zero value audits all requests.
+	SampleRate float64
+	// HashBody specifies to include SHA-256 of the request body
+	HashBody bool
+}
+
+// WithAudit is a ClientOption that persists the audit record
+// of each outgoing request to the sink
+func WithAudit(sink AuditSink, cfg AuditConfig) ClientOption {
+	return optionFunc(func(c *Client) {
+		if sink != nil {
+			c.WithEventListener(&auditListener{
+				client: c,
+				sink:   sink,
+				cfg:    cfg,
+			})
+		}
+	})
+}
+
+type auditListener struct {
+	NopEventListener
+	client *Client
+	sink   AuditSink
+	cfg    AuditConfig
+}
+
+func (l *auditListener) OnResponse(e *ResponseEvent) {
+	l.write(e.Request, e.Response.StatusCode, e.Attempts, e.Elapsed, nil)
+}
+
+func (l *auditListener) OnError(e *ErrorEvent) {
+	l.write(e.Request, 0, e.Attempts, e.Elapsed, e.Err)
+}
+
+func (l *auditListener) write(r *http.Request, status, attempts int, elapsed time.Duration, err error) {
+	failed := err != nil || status >= http.StatusBadRequest
+	if !failed && l.cfg.SampleRate > 0 && l.cfg.SampleRate < 1 && rand.Float64() >= l.cfg.SampleRate {
+		return
+	}
+
+	ctx := r.Context()
+	rec := &AuditRecord{
+		Time:          l.client.clock.Now().Add(-elapsed).UTC(),
+		Client:        l.client.Name,
+		Method:        r.Method,
+		URL:           l.client.redactor.URL(r.URL),
+		StatusCode:    status,
+		Duration:      elapsed,
+		Attempts:      attempts,
+		Identity:      auditIdentity(r.Header.Get(header.Authorization)),
+		CorrelationID: correlation.ID(ctx),
+	}
+	if l.cfg.HashBody {
+		rec.BodyHash = bodyHash(r)
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+
+	if werr := l.sink.WriteAuditRecord(context.WithoutCancel(ctx), rec); werr != nil {
+		logger.ContextKV(ctx, xlog.ERROR,
+			"client", l.client.Name,
+			"reason", "audit",
+			"err", werr.Error())
+	}
+}
+
+// bodyHash returns hex encoded SHA-256 of the request body
+func bodyHash(r *http.Request) string {
+	if r.GetBody == nil {
+		return ""
+	}
+	body, err := r.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer body.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, body); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// auditIdentity returns the scheme and the fingerprint of the credentials
+func auditIdentity(authorization string) string {
+	if authorization == "" {
+		return ""
+	}
+	scheme, creds, ok := strings.Cut(authorization, " ")
+	if !ok {
+		scheme, creds = "", authorization
+	}
+	h := sha256.Sum256([]byte(creds))
+	fp := hex.EncodeToString(h[:8])
+	if scheme == "" {
+		return fp
+	}
+	return scheme + ":" + fp
+}
+
+// FileAuditSink writes the audit records as JSON lines to the daily files,
+// and removes the files older than the retention period
+type FileAuditSink struct {
+	folder    string
+	retention time.Duration
+
+	lock sync.Mutex
+	day  string
+	file *os.File
+	w    *bufio.Writer
+}
+
+// NewFileAuditSink returns FileAuditSink,
+// zero retention keeps the files
+func NewFileAuditSink(folder string, retention time.Duration) (*FileAuditSink, error) {
+	if err := os.MkdirAll(folder, 0700); err != nil {
+		return nil, errors.WithMessagef(err, "unable to create audit folder")
+	}
+	return &FileAuditSink{
+		folder:    folder,
+		retention: retention,
+	}, nil
+}
+
+// AuditSink returns FileAuditSink in the `audit` folder of the storage
+func (c *Storage) AuditSink(retention time.Duration) (*FileAuditSink, error) {
+	return NewFileAuditSink(filepath.Join(c.folder, "audit"), retention)
+}
+
+// WriteAuditRecord implements AuditSink
+func (s *FileAuditSink) WriteAuditRecord(_ context.Context, r *AuditRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	day := r.Time.UTC().Format(time.DateOnly)
+	if day != s.day || s.file == nil {
+		if err = s.rotate(day); err != nil {
+			return err
+		}
+	}
+
+	_, _ = s.w.Write(b)
+	_ = s.w.WriteByte('\n')
+	return errors.WithStack(s.w.Flush())
+}
+
+// Close closes the current file
+func (s *FileAuditSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.closeFile()
+}
+
+func (s *FileAuditSink) closeFile() error {
+	if s.file == nil {
+		return nil
+	}
+	_ = s.w.Flush()
+	err := s.file.Close()
+	s.file, s.w = nil, nil
+	return errors.WithStack(err)
+}
+
+func (s *FileAuditSink) rotate(day string) error {
+	_ = s.closeFile()
+
+	f, err := os.OpenFile(filepath.Join(s.folder, "audit-"+day+".jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.WithMessagef(err, "unable to open audit file")
+	}
+	s.file, s.w, s.day = f, bufio.NewWriter(f), day
+
+	if s.retention > 0 {
+		s.cleanup(time.Now().Add(-s.retention))
+	}
+	return nil
+}
+
+// cleanup removes the files of the days before the given time
+func (s *FileAuditSink) cleanup(before time.Time) {
+	files, _ := filepath.Glob(filepath.Join(s.folder, "audit-*.jsonl"))
+	for _, f := range files {
+		day := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(f), "audit-"), ".jsonl")
+		t, err := time.Parse(time.DateOnly, day)
+		if err == nil && t.AddDate(0, 0, 1).Before(before) {
+			_ = os.Remove(f)
+		}
+	}
+}
+
+// KeyValue is the subset of cache.KeyValue used by CacheAuditSink,
+// declared here as the cache package depends on the server packages
+type KeyValue interface {
+	// Set data
+	Set(ctx context.Context, key string, v any, ttl time.Duration) error
+}
+
+// CacheAuditSink stores the audit records in the cache, such as Redis,
+// the records expire after the retention period
+type CacheAuditSink struct {
+	kv        KeyValue
+	prefix    string
+	retention time.Duration
+}
+
+// NewCacheAuditSink returns CacheAuditSink,
+// the records are stored with `<prefix>/<date>/<id>` keys
+func NewCacheAuditSink(kv KeyValue, prefix string, retention time.Duration) *CacheAuditSink {
+	return &CacheAuditSink{
+		kv:        kv,
+		prefix:    prefix,
+		retention: retention,
+	}
+}
+
+// WriteAuditRecord implements AuditSink
+func (s *CacheAuditSink) WriteAuditRecord(ctx context.Context, r *AuditRecord) error {
+	key := s.prefix + "/" + r.Time.UTC().Format(time.DateOnly) + "/" + guid.MustCreate()
+	return s.kv.Set(ctx, key, r, s.retention)
+}
@@ -0,0 +1,130 @@
+package retriable_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/cache"
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/xhttp/correlation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type auditRecorder struct {
+	lock    sync.Mutex
+	records []*retriable.AuditRecord
+}
+
+func (r *auditRecorder) WriteAuditRecord(_ context.Context, rec *retriable.AuditRecord) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.records = append(r.records, rec)
+	return nil
+}
+
+func TestAudit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"code":"bad_request","message":"bad"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	rec := &auditRecorder{}
+	sampled := &auditRecorder{}
+	client, err := retriable.New(retriable.ClientConfig{Host: server.URL},
+		retriable.WithName("audited"),
+		retriable.WithAudit(rec, retriable.AuditConfig{HashBody: true}),
+		retriable.WithAudit(sampled, retriable.AuditConfig{SampleRate: 0.0001}),
+	)
+	require.NoError(t, err)
+	client.AddHeader("Authorization", "Bearer secret")
+
+	ctx := correlation.WithID(context.Background())
+	var res map[string]any
+	_, _, err = client.Post(ctx, "/v1/items?token=secret", []byte(`{"name":"test"}`), &res)
+	require.NoError(t, err)
+	_, _, err = client.Get(ctx, "/fail", &res)
+	require.Error(t, err)
+
+	require.Len(t, rec.records, 2)
+	r := rec.records[0]
+	assert.Equal(t, "audited", r.Client)
+	assert.Equal(t, http.MethodPost, r.Method)
+	assert.NotContains(t, r.URL, "secret")
+	assert.Equal(t, http.StatusOK, r.StatusCode)
+	assert.Equal(t, 1, r.Attempts)
+	assert.Equal(t, correlation.ID(ctx), r.CorrelationID)
+	sum := sha256.Sum256([]byte(`{"name":"test"}`))
+	assert.Equal(t, hex.EncodeToString(sum[:]), r.BodyHash)
+	id := sha256.Sum256([]byte("secret"))
+	assert.Equal(t, "Bearer:"+hex.EncodeToString(id[:8]), r.Identity)
+
+	assert.Equal(t, http.StatusBadRequest, rec.records[1].StatusCode)
+	assert.Empty(t, rec.records[1].BodyHash)
+
+	// the failed requests are always audited
+	require.Len(t, sampled.records, 1)
+	assert.Equal(t, http.StatusBadRequest, sampled.records[0].StatusCode)
+}
+
+func TestFileAuditSink(t *testing.T) {
+	folder := filepath.Join(t.TempDir(), "audit")
+	sink, err := retriable.NewFileAuditSink(folder, 48*time.Hour)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	old := filepath.Join(folder, "audit-2000-01-01.jsonl")
+	require.NoError(t, os.WriteFile(old, []byte("{}\n"), 0600))
+
+	now := time.Now().UTC()
+	ctx := context.Background()
+	require.NoError(t, sink.WriteAuditRecord(ctx, &retriable.AuditRecord{Time: now, Method: "GET", URL: "/1"}))
+	require.NoError(t, sink.WriteAuditRecord(ctx, &retriable.AuditRecord{Time: now, Method: "GET", URL: "/2"}))
+
+	assert.NoFileExists(t, old)
+
+	f, err := os.Open(filepath.Join(folder, "audit-"+now.Format(time.DateOnly)+".jsonl"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	var urls []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r retriable.AuditRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		urls = append(urls, r.URL)
+	}
+	assert.Equal(t, []string{"/1", "/2"}, urls)
+
+	storage := retriable.OpenStorage(t.TempDir(), "", "")
+	ss, err := storage.AuditSink(0)
+	require.NoError(t, err)
+	require.NoError(t, ss.Close())
+}
+
+func TestCacheAuditSink(t *testing.T) {
+	mem := cache.NewMemoryProvider("test")
+	sink := retriable.NewCacheAuditSink(mem, "audit", time.Hour)
+
+	now := time.Now().UTC()
+	require.NoError(t, sink.WriteAuditRecord(context.Background(), &retriable.AuditRecord{Time: now, Method: "GET", URL: "/1"}))
+
+	keys, err := mem.Keys(context.Background(), "audit/"+now.Format(time.DateOnly)+"/*")
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+}
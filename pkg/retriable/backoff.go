@@ -0,0 +1,85 @@
+package retriable
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/effective-security/porto/x/backoff"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/pkg/errors"
+)
+
+// Backoff returns the delay before the next retry,
+// base is the wait duration returned by ShouldRetry for the status code,
+// and retries is the number of already made retries
+type Backoff func(base time.Duration, retries int) time.Duration
+
+// Backoff strategy names
+const (
+	BackoffConstant          = "constant"
+	BackoffLinear            = "linear"
+	BackoffExponential       = "exponential"
+	BackoffExponentialJitter = "exponential_jitter"
+)
+
+// ConstantBackoff always waits for the base duration
+func ConstantBackoff(base time.Duration, _ int) time.Duration {
+	return base
+}
+
+// LinearBackoff waits for base*(retries+1)
+func LinearBackoff(base time.Duration, retries int) time.Duration {
+	return base * time.Duration(retries+1)
+}
+
+// ExponentialBackoff waits for base*2^retries
+func ExponentialBackoff(base time.Duration, retries int) time.Duration {
+	return backoff.Exponential(base, 2, retries)
+}
+
+// ExponentialJitterBackoff waits for a random duration
+// in [d/2, d) range, where d is the ExponentialBackoff
+func ExponentialJitterBackoff(base time.Duration, retries int) time.Duration {
+	return backoff.Jitter(ExponentialBackoff(base, retries), 0.5)
+}
+
+// BackoffByName returns the backoff strategy by name,
+// empty name returns ConstantBackoff
+func BackoffByName(name string) (Backoff, error) {
+	switch name {
+	case "", BackoffConstant:
+		return ConstantBackoff, nil
+	case BackoffLinear:
+		return LinearBackoff, nil
+	case BackoffExponential:
+		return ExponentialBackoff, nil
+	case BackoffExponentialJitter:
+		return ExponentialJitterBackoff, nil
+	}
+	return nil, errors.Errorf("unsupported backoff: %q", name)
+}
+
+// backoff returns the delay before the next retry,
+// according to the policy
+func (p *Policy) backoff(resp *http.Response, wait time.Duration, retries int) time.Duration {
+	if p.Backoff != nil {
+		wait = p.Backoff(wait, retries)
+	}
+	if p.HonorRetryAfter && resp != nil {
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			if d := httperror.ParseRetryAfter(resp.Header.Get(header.RetryAfter)); d > 0 {
+				wait = d
+			}
+		}
+		// the server is still processing the request,
+		// retry earlier is not useful
+		if d := httperror.ParseRetryAfter(resp.Header.Get(header.XProcessingHint)); d > wait {
+			wait = d
+		}
+	}
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	return wait
+}
@@ -0,0 +1,159 @@
+package retriable_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff(t *testing.T) {
+	base := 100 * time.Millisecond
+	assert.Equal(t, base, retriable.ConstantBackoff(base, 3))
+	assert.Equal(t, base, retriable.LinearBackoff(base, 0))
+	assert.Equal(t, 3*base, retriable.LinearBackoff(base, 2))
+	assert.Equal(t, base, retriable.ExponentialBackoff(base, 0))
+	assert.Equal(t, 8*base, retriable.ExponentialBackoff(base, 3))
+	assert.Greater(t, retriable.ExponentialBackoff(time.Hour, 100), time.Hour)
+
+	for i := 0; i < 100; i++ {
+		d := retriable.ExponentialJitterBackoff(base, 2)
+		assert.GreaterOrEqual(t, d, 2*base)
+		assert.Less(t, d, 4*base)
+	}
+	assert.Equal(t, time.Duration(0), retriable.ExponentialJitterBackoff(0, 2))
+
+	for _, name := range []string{"", retriable.BackoffConstant, retriable.BackoffLinear,
+		retriable.BackoffExponential, retriable.BackoffExponentialJitter} {
+		b, err := retriable.BackoffByName(name)
+		require.NoError(t, err)
+		assert.NotNil(t, b)
+	}
+	_, err := retriable.BackoffByName("fibonacci")
+	assert.EqualError(t, err, `unsupported backoff: "fibonacci"`)
+
+	_, err = retriable.New(retriable.ClientConfig{
+		Host:    "http://localhost",
+		Request: &retriable.RequestPolicy{Backoff: "fibonacci"},
+	})
+	assert.EqualError(t, err, `unsupported backoff: "fibonacci"`)
+}
+
+func TestPolicyBackoff(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/v1", nil)
+	require.NoError(t, err)
+	unavailable := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}
+
+	p := retriable.Policy{
+		TotalRetryLimit: 5,
+		Retries: map[int]retriable.ShouldRetry{
+			http.StatusServiceUnavailable: retriable.DefaultShouldRetryFactory(5, time.Second, "unavailable"),
+			http.StatusTooManyRequests:    retriable.DefaultShouldRetryFactory(5, time.Second, "rate-limit"),
+		},
+	}
+
+	ok, wait, _ := p.ShouldRetry(req, unavailable, nil, 3)
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, wait)
+
+	p.Backoff = retriable.ExponentialBackoff
+	ok, wait, _ = p.ShouldRetry(req, unavailable, nil, 3)
+	assert.True(t, ok)
+	assert.Equal(t, 8*time.Second, wait)
+
+	p.MaxBackoff = 5 * time.Second
+	_, wait, _ = p.ShouldRetry(req, unavailable, nil, 3)
+	assert.Equal(t, 5*time.Second, wait)
+
+	unavailable.Header.Set(header.RetryAfter, "3")
+	_, wait, _ = p.ShouldRetry(req, unavailable, nil, 3)
+	assert.Equal(t, 5*time.Second, wait, "Retry-After is ignored by default")
+
+	p.HonorRetryAfter = true
+	_, wait, _ = p.ShouldRetry(req, unavailable, nil, 3)
+	assert.Equal(t, 3*time.Second, wait)
+
+	unavailable.Header.Set(header.RetryAfter, "60")
+	_, wait, _ = p.ShouldRetry(req, unavailable, nil, 3)
+	assert.Equal(t, 5*time.Second, wait, "Retry-After is capped by MaxBackoff")
+
+	tooMany := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	tooMany.Header.Set(header.RetryAfter, "2")
+	ok, wait, reason := p.ShouldRetry(req, tooMany, nil, 0)
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Second, wait)
+	assert.Equal(t, "rate-limit", reason)
+
+	p.HonorRetryAfter = false
+	ok, _, reason = p.ShouldRetry(req, tooMany, nil, 0)
+	assert.False(t, ok)
+	assert.Equal(t, retriable.LimitExceeded, reason)
+}
+
+func TestPolicyBackoff_ProcessingHint(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/v1", nil)
+	require.NoError(t, err)
+	gateway := &http.Response{StatusCode: http.StatusGatewayTimeout, Header: http.Header{}}
+	gateway.Header.Set(header.XProcessingHint, "3")
+
+	p := retriable.Policy{
+		TotalRetryLimit: 5,
+		Retries: map[int]retriable.ShouldRetry{
+			http.StatusGatewayTimeout: retriable.DefaultShouldRetryFactory(5, time.Second, "gateway"),
+		},
+		MaxBackoff: 10 * time.Second,
+	}
+
+	_, wait, _ := p.ShouldRetry(req, gateway, nil, 0)
+	assert.Equal(t, time.Second, wait, "hint is ignored by default")
+
+	p.HonorRetryAfter = true
+	_, wait, _ = p.ShouldRetry(req, gateway, nil, 0)
+	assert.Equal(t, 3*time.Second, wait)
+
+	p.Backoff = retriable.ExponentialBackoff
+	_, wait, _ = p.ShouldRetry(req, gateway, nil, 2)
+	assert.Equal(t, 4*time.Second, wait, "longer backoff is preserved")
+
+	gateway.Header.Set(header.XProcessingHint, "60")
+	_, wait, _ = p.ShouldRetry(req, gateway, nil, 0)
+	assert.Equal(t, 10*time.Second, wait, "hint is capped by MaxBackoff")
+}
+
+func TestHonorRetryAfter(t *testing.T) {
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if count.Add(1) == 1 {
+			w.Header().Set(header.RetryAfter, "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set(header.ContentType, header.ApplicationJSON)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	client, err := retriable.New(retriable.ClientConfig{
+		Host: server.URL,
+		Request: &retriable.RequestPolicy{
+			RetryLimit:      2,
+			Backoff:         retriable.BackoffExponentialJitter,
+			MaxBackoff:      10 * time.Millisecond,
+			HonorRetryAfter: true,
+		},
+	})
+	require.NoError(t, err)
+
+	var res map[string]any
+	_, status, err := client.Get(context.Background(), "/", &res)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int32(2), count.Load())
+}
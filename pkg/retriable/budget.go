@@ -0,0 +1,174 @@
+package retriable
+
+import (
+	"sync"
+	"time"
+
+	"github.com/effective-security/porto/metricskey"
+	"github.com/effective-security/porto/x/clock"
+)
+
+const (
+	// DefaultRetryBudgetRatio is the default ratio of retries to requests
+	DefaultRetryBudgetRatio = 0.2
+	// DefaultRetryBudgetMinRetries is the default number of retries
+	// allowed in the window regardless of the ratio
+	DefaultRetryBudgetMinRetries = 10
+	// DefaultRetryBudgetWindow is the default sliding window of the budget
+	DefaultRetryBudgetWindow = 10 * time.Second
+
+	budgetBuckets = 10
+)
+
+// RetryBudgetConfig provides configuration for RetryBudget
+type RetryBudgetConfig struct {
+	// Ratio of retries to requests allowed in the window, default is DefaultRetryBudgetRatio
+	Ratio float64 `json:"ratio,omitempty" yaml:"ratio,omitempty"`
+	// MinRetries allowed in the window regardless of the ratio,
+	// default is DefaultRetryBudgetMinRetries
+	MinRetries int `json:"min_retries,omitempty" yaml:"min_retries,omitempty"`
+	// Window is the sliding window, default is DefaultRetryBudgetWindow
+	Window time.Duration `json:"window,omitempty" yaml:"window,omitempty"`
+}
+
+// RetryBudgetError is returned when the request failed,
+// and the retry was rejected by the retry budget
+type RetryBudgetError struct {
+	// Err is the error of the last attempt
+	Err error
+}
+
+// Error returns the error message
+func (e *RetryBudgetError) Error() string {
+	return BudgetExhausted + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error of the last attempt
+func (e *RetryBudgetError) Unwrap() error {
+	return e.Err
+}
+
+type budgetBucket struct {
+	requests int
+	retries  int
+}
+
+// RetryBudget limits the number of retries to a ratio of the requests
+// over a sliding window, to prevent retry amplification during an outage.
+// RetryBudget can be shared by multiple clients.
+type RetryBudget struct {
+	ratio      float64
+	minRetries int
+	bucketSize time.Duration
+	clock      clock.Clock
+
+	lock    sync.Mutex
+	buckets [budgetBuckets]budgetBucket
+	idx     int
+	started time.Time
+}
+
+// NewRetryBudget returns RetryBudget
+func NewRetryBudget(cfg RetryBudgetConfig) *RetryBudget {
+	if cfg.Ratio <= 0 {
+		cfg.Ratio = DefaultRetryBudgetRatio
+	}
+	if cfg.MinRetries <= 0 {
+		cfg.MinRetries = DefaultRetryBudgetMinRetries
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultRetryBudgetWindow
+	}
+	return &RetryBudget{
+		ratio:      cfg.Ratio,
+		minRetries: cfg.MinRetries,
+		bucketSize: cfg.Window / budgetBuckets,
+		clock:      clock.System,
+		started:    clock.System.Now(),
+	}
+}
+
+// WithClock specifies the time source of the sliding window
+func (b *RetryBudget) WithClock(clk clock.Clock) *RetryBudget {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.clock = clock.OrSystem(clk)
+	b.started = b.clock.Now()
+	return b
+}
+
+// advance moves the current bucket, and resets the expired ones
+func (b *RetryBudget) advance(now time.Time) {
+	n := int(now.Sub(b.started) / b.bucketSize)
+	if n <= 0 {
+		return
+	}
+	for i := 0; i < n && i < budgetBuckets; i++ {
+		b.idx = (b.idx + 1) % budgetBuckets
+		b.buckets[b.idx] = budgetBucket{}
+	}
+	b.started = b.started.Add(time.Duration(n) * b.bucketSize)
+}
+
+func (b *RetryBudget) available() float64 {
+	var requests, retries int
+	for _, bucket := range b.buckets {
+		requests += bucket.requests
+		retries += bucket.retries
+	}
+	return float64(b.minRetries) + b.ratio*float64(requests) - float64(retries)
+}
+
+// Deposit records the request
+func (b *RetryBudget) Deposit() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.advance(b.clock.Now())
+	b.buckets[b.idx].requests++
+}
+
+// Withdraw returns true and records the retry, if the budget allows the retry
+func (b *RetryBudget) Withdraw() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.advance(b.clock.Now())
+	if b.available() < 1 {
+		return false
+	}
+	b.buckets[b.idx].retries++
+	return true
+}
+
+// Available returns the number of retries available in the window
+func (b *RetryBudget) Available() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.advance(b.clock.Now())
+	if av := b.available(); av > 0 {
+		return int(av)
+	}
+	return 0
+}
+
+// WithRetryBudget is a ClientOption that specifies the retry budget,
+// nil disables the budget
+func WithRetryBudget(b *RetryBudget) ClientOption {
+	return optionFunc(func(c *Client) {
+		c.budget = b
+	})
+}
+
+// withdrawRetry returns false, if the retry budget is exhausted
+func (c *Client) withdrawRetry() bool {
+	if c.budget == nil {
+		return true
+	}
+	allowed := c.budget.Withdraw()
+	decision := "allowed"
+	if !allowed {
+		decision = "rejected"
+	}
+	metricskey.HTTPRetryBudget.IncrCounter(1, c.Name, decision)
+	metricskey.HTTPRetryBudgetAvailable.SetGauge(float64(c.budget.Available()), c.Name)
+	return allowed
+}
@@ -0,0 +1,99 @@
+package retriable_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/tests/testutils"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryBudget(t *testing.T) {
+	clk := testutils.NewClock(time.Now())
+	b := retriable.NewRetryBudget(retriable.RetryBudgetConfig{
+		Ratio:      0.5,
+		MinRetries: 2,
+		Window:     100 * time.Millisecond,
+	}).WithClock(clk)
+	assert.Equal(t, 2, b.Available())
+	for i := 0; i < 4; i++ {
+		b.Deposit()
+	}
+	assert.Equal(t, 4, b.Available())
+	for i := 0; i < 4; i++ {
+		assert.True(t, b.Withdraw())
+	}
+	assert.False(t, b.Withdraw())
+	assert.Equal(t, 0, b.Available())
+
+	// window expired
+	clk.Advance(120 * time.Millisecond)
+	assert.Equal(t, 2, b.Available())
+	assert.True(t, b.Withdraw())
+
+	def := retriable.NewRetryBudget(retriable.RetryBudgetConfig{})
+	assert.Equal(t, retriable.DefaultRetryBudgetMinRetries, def.Available())
+}
+
+func TestClientRetryBudget(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	pol := retriable.Policy{
+		TotalRetryLimit: 5,
+		Retries: map[int]retriable.ShouldRetry{
+			0:                             retriable.DefaultShouldRetryFactory(5, time.Millisecond, "connection"),
+			http.StatusServiceUnavailable: retriable.DefaultShouldRetryFactory(5, time.Millisecond, "unavailable"),
+		},
+	}
+	client, err := retriable.New(retriable.ClientConfig{
+		RetryBudget: &retriable.RetryBudgetConfig{
+			Ratio:      0.01,
+			MinRetries: 2,
+			Window:     time.Minute,
+		},
+	}, retriable.WithPolicy(pol))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	_, status, err := client.Request(ctx, http.MethodGet, server.URL, "/", nil, nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	// the first attempt and two retries
+	assert.Equal(t, int32(3), atomic.LoadInt32(&count))
+
+	// budget is exhausted, fail fast
+	_, status, err = client.Request(ctx, http.MethodGet, server.URL, "/", nil, nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&count))
+
+	// connection error
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	_, _, err = client.Request(ctx, http.MethodGet, closed.URL, "/", nil, nil)
+	require.Error(t, err)
+	var berr *retriable.RetryBudgetError
+	require.True(t, errors.As(err, &berr), "%T: %v", err, err)
+	assert.Contains(t, err.Error(), "budget-exhausted: ")
+	assert.Contains(t, err.Error(), "connection refused")
+
+	// disabled
+	client, err = retriable.New(retriable.ClientConfig{}, retriable.WithPolicy(pol), retriable.WithRetryBudget(nil))
+	require.NoError(t, err)
+	atomic.StoreInt32(&count, 0)
+	_, _, err = client.Request(ctx, http.MethodGet, server.URL, "/", nil, nil)
+	require.Error(t, err)
+	assert.Equal(t, int32(6), atomic.LoadInt32(&count))
+}
@@ -0,0 +1,38 @@
+package retriable
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/effective-security/porto/xhttp/bulk"
+	"github.com/pkg/errors"
+)
+
+// Bulk submits the operations to the bulk endpoint,
+// and returns the response with the status of each operation.
+// The returned error is nil on partial success,
+// use bulk.Response.Err to get the errors of failed operations.
+func (c *Client) Bulk(ctx context.Context, path string, ops ...*bulk.Operation) (*bulk.Response, error) {
+	res := new(bulk.Response)
+	_, _, err := c.Post(ctx, path, &bulk.Request{Operations: ops}, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// NewBulkOperation returns bulk.Operation with the encoded body
+func NewBulkOperation(id, action string, body any) (*bulk.Operation, error) {
+	op := &bulk.Operation{
+		ID:     id,
+		Action: action,
+	}
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		op.Body = b
+	}
+	return op, nil
+}
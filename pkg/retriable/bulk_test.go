@@ -0,0 +1,64 @@
+package retriable_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/xhttp/bulk"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bulkItem struct {
+	Name string `json:"name"`
+}
+
+func TestBulk(t *testing.T) {
+	h := bulk.New(bulk.Config{}).NewHandler(func(_ context.Context, op *bulk.Operation) (any, error) {
+		var it bulkItem
+		if err := op.Decode(&it); err != nil {
+			return nil, err
+		}
+		if it.Name == "" {
+			return nil, httperror.InvalidParam("name is required")
+		}
+		return &it, nil
+	})
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	client, err := retriable.New(retriable.ClientConfig{Host: server.URL})
+	require.NoError(t, err)
+
+	op1, err := retriable.NewBulkOperation("1", "create", &bulkItem{Name: "alice"})
+	require.NoError(t, err)
+	op2, err := retriable.NewBulkOperation("2", "create", &bulkItem{})
+	require.NoError(t, err)
+	op3, err := retriable.NewBulkOperation("3", "delete", nil)
+	require.NoError(t, err)
+	assert.Empty(t, op3.Body)
+
+	res, err := client.Bulk(context.Background(), "/v1/items:bulk", op1, op2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Succeeded)
+	assert.Equal(t, 1, res.Failed)
+
+	var it bulkItem
+	require.NoError(t, res.Result("1").Decode(&it))
+	assert.Equal(t, "alice", it.Name)
+
+	var many *httperror.ManyError
+	require.ErrorAs(t, res.Err(), &many)
+	assert.Equal(t, http.StatusBadRequest, many.Errors["2"].HTTPStatus)
+	assert.Equal(t, httperror.CodeInvalidParam, many.Errors["2"].Code)
+
+	_, err = client.Bulk(context.Background(), "/v1/items:bulk")
+	assert.EqualError(t, err, "invalid_request: no operations")
+
+	_, err = retriable.NewBulkOperation("4", "", make(chan int))
+	assert.Error(t, err)
+}
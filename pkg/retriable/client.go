@@ -10,7 +10,8 @@ import (
 //
 // host should include all the protocol/host/port preamble, e.g. https://foo.bar:3444
 // path should be an absolute URI path, i.e. /foo/bar/baz
-func (c *Client) HeadTo(ctx context.Context, host string, path string) (http.Header, int, error) {
+func (c *Client) HeadTo(ctx context.Context, host string, path string, opts ...RequestOption) (http.Header, int, error) {
+	ctx = c.withRequestOptions(ctx, opts)
 	resp, err := c.executeRequest(ctx, http.MethodHead, host, path, nil)
 	if err != nil {
 		return nil, 0, err
@@ -22,8 +23,8 @@ func (c *Client) HeadTo(ctx context.Context, host string, path string) (http.Hea
 // Head makes HEAD request.
 // path should be an absolute URI path, i.e. /foo/bar/baz
 // The client must be configured with the hosts list.
-func (c *Client) Head(ctx context.Context, path string) (http.Header, int, error) {
-	return c.HeadTo(ctx, c.host, path)
+func (c *Client) Head(ctx context.Context, path string, opts ...RequestOption) (http.Header, int, error) {
+	return c.HeadTo(ctx, c.host, path, opts...)
 }
 
 // Post makes an HTTP POST to the supplied path.
@@ -32,8 +33,8 @@ func (c *Client) Head(ctx context.Context, path string) (http.Header, int, error
 // into a go error, waits & retries for rate limiting errors will be applied based on the
 // client config.
 // path should be an absolute URI path, i.e. /foo/bar/baz
-func (c *Client) Post(ctx context.Context, path string, requestBody interface{}, responseBody interface{}) (http.Header, int, error) {
-	return c.Request(ctx, "POST", c.host, path, requestBody, responseBody)
+func (c *Client) Post(ctx context.Context, path string, requestBody interface{}, responseBody interface{}, opts ...RequestOption) (http.Header, int, error) {
+	return c.Request(ctx, "POST", c.host, path, requestBody, responseBody, opts...)
 }
 
 // Put makes an HTTP PUT to the supplied path.
@@ -42,8 +43,8 @@ func (c *Client) Post(ctx context.Context, path string, requestBody interface{},
 // into a go error, waits & retries for rate limiting errors will be applied based on the
 // client config.
 // path should be an absolute URI path, i.e. /foo/bar/baz
-func (c *Client) Put(ctx context.Context, path string, requestBody interface{}, responseBody interface{}) (http.Header, int, error) {
-	return c.Request(ctx, "PUT", c.host, path, requestBody, responseBody)
+func (c *Client) Put(ctx context.Context, path string, requestBody interface{}, responseBody interface{}, opts ...RequestOption) (http.Header, int, error) {
+	return c.Request(ctx, "PUT", c.host, path, requestBody, responseBody, opts...)
 }
 
 // Get fetches the supplied resource using the current selected cluster member
@@ -53,8 +54,8 @@ func (c *Client) Put(ctx context.Context, path string, requestBody interface{},
 // into an go error.
 // If configured, this call will wait & retry on rate limit and leader election errors
 // path should be an absolute URI path, i.e. /foo/bar/baz
-func (c *Client) Get(ctx context.Context, path string, body interface{}) (http.Header, int, error) {
-	return c.Request(ctx, "GET", c.host, path, nil, body)
+func (c *Client) Get(ctx context.Context, path string, body interface{}, opts ...RequestOption) (http.Header, int, error) {
+	return c.Request(ctx, "GET", c.host, path, nil, body, opts...)
 }
 
 // Delete removes the supplied resource using the current selected cluster member
@@ -64,6 +65,6 @@ func (c *Client) Get(ctx context.Context, path string, body interface{}) (http.H
 // into an go error.
 // If configured, this call will wait & retry on rate limit and leader election errors
 // path should be an absolute URI path, i.e. /foo/bar/baz
-func (c *Client) Delete(ctx context.Context, path string, body interface{}) (http.Header, int, error) {
-	return c.Request(ctx, "DELETE", c.host, path, nil, body)
+func (c *Client) Delete(ctx context.Context, path string, body interface{}, opts ...RequestOption) (http.Header, int, error) {
+	return c.Request(ctx, "DELETE", c.host, path, nil, body, opts...)
 }
@@ -0,0 +1,321 @@
+package retriable
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/pkg/errors"
+	ugorji "github.com/ugorji/go/codec"
+)
+
+// Codec defines an interface to encode requests and decode responses
+type Codec interface {
+	// ContentType returns the content type of the encoded payload
+	ContentType() string
+	// Encode writes the encoding of v to w
+	Encode(w io.Writer, v any) error
+	// Decode reads the encoded value from r and stores it in v
+	Decode(r io.Reader, v any) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return header.ApplicationJSON }
+
+func (jsonCodec) Encode(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (jsonCodec) Decode(r io.Reader, v any) error {
+	d := json.NewDecoder(r)
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+type xmlCodec struct {
+	contentType string
+}
+
+func (c xmlCodec) ContentType() string { return c.contentType }
+
+func (xmlCodec) Encode(w io.Writer, v any) error {
+	return xml.NewEncoder(w).Encode(v)
+}
+
+func (xmlCodec) Decode(r io.Reader, v any) error {
+	return xml.NewDecoder(r).Decode(v)
+}
+
+type formCodec struct{}
+
+func (formCodec) ContentType() string { return header.ApplicationFormURLEncoded }
+
+// Encode writes url.Values, map[string]string, map[string][]string,
+// or the fields of the struct encoded as JSON object
+func (formCodec) Encode(w io.Writer, v any) error {
+	var vals url.Values
+	switch t := v.(type) {
+	case url.Values:
+		vals = t
+	case map[string][]string:
+		vals = url.Values(t)
+	case map[string]string:
+		vals = url.Values{}
+		for k, v := range t {
+			vals.Set(k, v)
+		}
+	default:
+		js, err := json.Marshal(v)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		var m map[string]any
+		d := json.NewDecoder(bytes.NewReader(js))
+		d.UseNumber()
+		if err = d.Decode(&m); err != nil {
+			return errors.Errorf("unsupported form type: %T", v)
+		}
+		vals = url.Values{}
+		for k, v := range m {
+			switch val := v.(type) {
+			case nil:
+			case []any:
+				for _, item := range val {
+					vals.Add(k, fmt.Sprint(item))
+				}
+			default:
+				vals.Set(k, fmt.Sprint(val))
+			}
+		}
+	}
+	_, err := io.WriteString(w, vals.Encode())
+	return errors.WithStack(err)
+}
+
+// Decode reads the form into *url.Values, *map[string][]string or *map[string]string
+func (formCodec) Decode(r io.Reader, v any) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	vals, err := url.ParseQuery(string(b))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	switch t := v.(type) {
+	case *url.Values:
+		*t = vals
+	case *map[string][]string:
+		*t = vals
+	case *map[string]string:
+		m := make(map[string]string, len(vals))
+		for k := range vals {
+			m[k] = vals.Get(k)
+		}
+		*t = m
+	default:
+		return errors.Errorf("unsupported form type: %T", v)
+	}
+	return nil
+}
+
+type textCodec struct{}
+
+func (textCodec) ContentType() string { return header.TextPlain }
+
+func (textCodec) Encode(w io.Writer, v any) error {
+	var err error
+	switch t := v.(type) {
+	case []byte:
+		_, err = w.Write(t)
+	default:
+		_, err = fmt.Fprint(w, v)
+	}
+	return errors.WithStack(err)
+}
+
+// Decode reads the text into *string or *[]byte
+func (textCodec) Decode(r io.Reader, v any) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	switch t := v.(type) {
+	case *string:
+		*t = string(b)
+	case *[]byte:
+		*t = b
+	default:
+		return errors.Errorf("unsupported text type: %T", v)
+	}
+	return nil
+}
+
+// isTextTarget returns true, if the body can be decoded by TextCodec
+func isTextTarget(body any) bool {
+	switch body.(type) {
+	case *string, *[]byte, io.Writer:
+		return true
+	}
+	return false
+}
+
+type msgpackCodec struct {
+	handle *ugorji.MsgpackHandle
+}
+
+func (msgpackCodec) ContentType() string { return header.ApplicationMsgpack }
+
+func (c msgpackCodec) Encode(w io.Writer, v any) error {
+	return ugorji.NewEncoder(w, c.handle).Encode(v)
+}
+
+func (c msgpackCodec) Decode(r io.Reader, v any) error {
+	return ugorji.NewDecoder(r, c.handle).Decode(v)
+}
+
+func newMsgpackHandle() *ugorji.MsgpackHandle {
+	h := &ugorji.MsgpackHandle{}
+	h.WriteExt = true
+	h.RawToString = true
+	h.MapType = reflect.TypeOf(map[string]any(nil))
+	return h
+}
+
+var (
+	// JSONCodec encodes payloads with encoding/json
+	JSONCodec Codec = jsonCodec{}
+	// XMLCodec encodes payloads with encoding/xml
+	XMLCodec Codec = xmlCodec{contentType: header.ApplicationXML}
+	// SOAPCodec encodes SOAP 1.1 payloads with encoding/xml
+	SOAPCodec Codec = xmlCodec{contentType: header.TextXML}
+	// FormCodec encodes payloads as application/x-www-form-urlencoded
+	FormCodec Codec = formCodec{}
+	// TextCodec encodes payloads as text/plain
+	TextCodec Codec = textCodec{}
+	// MsgpackCodec encodes payloads as application/msgpack
+	MsgpackCodec Codec = msgpackCodec{handle: newMsgpackHandle()}
+)
+
+var (
+	codecsLock sync.RWMutex
+	codecs     = map[string]Codec{
+		header.ApplicationJSON:           JSONCodec,
+		header.ApplicationXML:            XMLCodec,
+		header.TextXML:                   SOAPCodec,
+		header.ApplicationSOAPXML:        xmlCodec{contentType: header.ApplicationSOAPXML},
+		header.ApplicationFormURLEncoded: FormCodec,
+		header.TextPlain:                 TextCodec,
+		header.ApplicationMsgpack:        MsgpackCodec,
+	}
+)
+
+// RegisterCodec registers the codec for its content type
+func RegisterCodec(codec Codec) {
+	codecsLock.Lock()
+	defer codecsLock.Unlock()
+	codecs[codec.ContentType()] = codec
+}
+
+// CodecForContentType returns a registered codec for the content type,
+// or nil if not found
+func CodecForContentType(contentType string) Codec {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+	return codecs[mt]
+}
+
+// WithContentType returns a copy of parent with the codec
+// for the specified content type, that will be used to encode
+// the request and decode the response.
+// If the content type is not registered, the default JSON codec is used.
+func WithContentType(ctx context.Context, contentType string) context.Context {
+	codec := CodecForContentType(contentType)
+	if codec == nil {
+		codec = JSONCodec
+	}
+	return WithCodec(ctx, codec)
+}
+
+// WithCodec returns a copy of parent with the codec
+// that will be used to encode the request and decode the response.
+func WithCodec(ctx context.Context, codec Codec) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, contextValueForCodec, codec)
+}
+
+// WithRequestCodec is a RequestOption that specifies the codec
+// to encode the request and decode the response for the call
+func WithRequestCodec(codec Codec) RequestOption {
+	return requestOptionFunc(func(o *requestOptions) {
+		o.codec = codec
+	})
+}
+
+func codecFromContext(ctx context.Context) Codec {
+	if ctx != nil {
+		if ro := requestOptionsFromContext(ctx); ro != nil && ro.codec != nil {
+			return ro.codec
+		}
+		if codec, ok := ctx.Value(contextValueForCodec).(Codec); ok {
+			return codec
+		}
+	}
+	return nil
+}
+
+// responseCodec returns the codec registered for the response content type,
+// or specified for the request
+func responseCodec(resp *http.Response) Codec {
+	if codec := CodecForContentType(resp.Header.Get(header.ContentType)); codec != nil {
+		return codec
+	}
+	if resp.Request != nil {
+		return codecFromContext(resp.Request.Context())
+	}
+	return nil
+}
+
+func decodeResponseWithCodec(codec Codec, resp *http.Response, body any) (http.Header, int, error) {
+	if resp.StatusCode >= http.StatusMultipleChoices { // 300
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return resp.Header, resp.StatusCode, errors.WithStack(err)
+		}
+		if fault := ParseSOAPFault(b); fault != nil {
+			return resp.Header, resp.StatusCode, fault.HTTPError(resp.StatusCode)
+		}
+		// Unable to parse as Fault, then return body as error
+		return resp.Header, resp.StatusCode, errors.New(string(b))
+	}
+
+	switch typ := body.(type) {
+	case io.Writer:
+		_, err := io.Copy(typ, resp.Body)
+		if err != nil {
+			return resp.Header, resp.StatusCode, errors.WithMessagef(err, "unable to read body response to (%T) type", body)
+		}
+	default:
+		if err := codec.Decode(resp.Body, body); err != nil {
+			return resp.Header, resp.StatusCode, errors.WithMessagef(err, "unable to decode body response to (%T) type", body)
+		}
+	}
+
+	return resp.Header, resp.StatusCode, nil
+}
@@ -0,0 +1,136 @@
+package retriable_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type codecPerson struct {
+	Name string   `json:"name"`
+	Age  int      `json:"age"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+func TestCodecs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/form":
+			if r.Header.Get(header.ContentType) != header.ApplicationFormURLEncoded {
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				return
+			}
+			_ = r.ParseForm()
+			w.Header().Set(header.ContentType, "text/plain; charset=utf-8")
+			_, _ = w.Write([]byte("hello " + r.PostForm.Get("name") + " " + r.PostForm.Get("age") + " " + strings.Join(r.PostForm["tags"], ",")))
+		case "/form-response":
+			w.Header().Set(header.ContentType, header.ApplicationFormURLEncoded)
+			_, _ = w.Write([]byte("access_token=token&expires_in=3600"))
+		case "/msgpack":
+			var p codecPerson
+			if err := retriable.MsgpackCodec.Decode(r.Body, &p); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			p.Age++
+			w.Header().Set(header.ContentType, header.ApplicationMsgpack)
+			_ = retriable.MsgpackCodec.Encode(w, &p)
+		case "/sniffed":
+			// sniffed as text/plain
+			_, _ = w.Write([]byte(`{"name":"alice","age":30}`))
+		case "/sniffed-error":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"code":"bad_request","message":"invalid name"}`))
+		}
+	}))
+	defer server.Close()
+
+	client, err := retriable.New(retriable.ClientConfig{Host: server.URL})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	t.Run("form", func(t *testing.T) {
+		var text string
+		_, status, err := client.Post(ctx, "/form",
+			&codecPerson{Name: "alice", Age: 30, Tags: []string{"a", "b"}}, &text,
+			retriable.WithRequestCodec(retriable.FormCodec))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "hello alice 30 a,b", text)
+
+		_, _, err = client.Post(ctx, "/form", map[string]string{"name": "bob", "age": "1"}, &text,
+			retriable.WithRequestCodec(retriable.FormCodec))
+		require.NoError(t, err)
+		assert.Equal(t, "hello bob 1 ", text)
+
+		var m map[string]string
+		_, _, err = client.Get(ctx, "/form-response", &m)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"access_token": "token", "expires_in": "3600"}, m)
+
+		var vals url.Values
+		_, _, err = client.Get(ctx, "/form-response", &vals)
+		require.NoError(t, err)
+		assert.Equal(t, "token", vals.Get("access_token"))
+	})
+
+	t.Run("msgpack", func(t *testing.T) {
+		var p codecPerson
+		_, _, err := client.Post(ctx, "/msgpack", &codecPerson{Name: "alice", Age: 30}, &p,
+			retriable.WithRequestCodec(retriable.MsgpackCodec))
+		require.NoError(t, err)
+		assert.Equal(t, codecPerson{Name: "alice", Age: 31}, p)
+	})
+
+	t.Run("sniffed_json", func(t *testing.T) {
+		var p codecPerson
+		hdr, _, err := client.Get(ctx, "/sniffed", &p)
+		require.NoError(t, err)
+		assert.Contains(t, hdr.Get(header.ContentType), "text/plain")
+		assert.Equal(t, codecPerson{Name: "alice", Age: 30}, p)
+
+		var text string
+		_, _, err = client.Get(ctx, "/sniffed", &text)
+		require.NoError(t, err)
+		assert.Equal(t, `{"name":"alice","age":30}`, text)
+
+		_, status, err := client.Get(ctx, "/sniffed-error", &text)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.EqualError(t, err, "bad_request: invalid name")
+	})
+
+	t.Run("registry", func(t *testing.T) {
+		assert.Equal(t, retriable.FormCodec, retriable.CodecForContentType("application/x-www-form-urlencoded; charset=utf-8"))
+		assert.Equal(t, retriable.TextCodec, retriable.CodecForContentType("text/plain"))
+		assert.Equal(t, retriable.MsgpackCodec, retriable.CodecForContentType("application/msgpack"))
+		assert.Nil(t, retriable.CodecForContentType("application/x-custom"))
+
+		retriable.RegisterCodec(customCodec{})
+		assert.Equal(t, customCodec{}, retriable.CodecForContentType("application/x-custom"))
+	})
+
+	t.Run("text", func(t *testing.T) {
+		var b bytes.Buffer
+		require.NoError(t, retriable.TextCodec.Encode(&b, 42))
+		assert.Equal(t, "42", b.String())
+
+		var i int
+		assert.EqualError(t, retriable.TextCodec.Decode(&b, &i), "unsupported text type: *int")
+		assert.EqualError(t, retriable.FormCodec.Decode(strings.NewReader("a=b"), &i), "unsupported form type: *int")
+	})
+}
+
+type customCodec struct {
+	retriable.Codec
+}
+
+func (customCodec) ContentType() string { return "application/x-custom" }
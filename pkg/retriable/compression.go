@@ -0,0 +1,166 @@
+package retriable
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// Content encodings supported by WithCompression
+const (
+	EncodingGzip = "gzip"
+	EncodingZstd = "zstd"
+)
+
+// DefaultCompressionThreshold specifies the minimum size of the request body to compress
+const DefaultCompressionThreshold = 1024
+
+// WithCompression is a ClientOption that compresses the request bodies
+// larger than threshold with the encoding (gzip or zstd),
+// and transparently decompresses gzip and zstd responses.
+// Zero threshold uses DefaultCompressionThreshold.
+func WithCompression(encoding string, threshold int) ClientOption {
+	return WithMiddleware(CompressionMiddleware(encoding, threshold))
+}
+
+// CompressionMiddleware returns Middleware,
+// that compresses the requests and decompresses the responses
+func CompressionMiddleware(encoding string, threshold int) Middleware {
+	if threshold <= 0 {
+		threshold = DefaultCompressionThreshold
+	}
+	return func(next RoundTripFn) RoundTripFn {
+		return func(r *http.Request) (*http.Response, error) {
+			// the request is reused for retries with the rewound body,
+			// the headers must not be modified in place
+			r = r.Clone(r.Context())
+			// the ranges of the encoded content can not be decompressed
+			if r.Header.Get(header.AcceptEncoding) == "" && r.Header.Get(header.Range) == "" {
+				r.Header.Set(header.AcceptEncoding, EncodingGzip+", "+EncodingZstd)
+			}
+			if r.Body != nil && r.Body != http.NoBody &&
+				r.Header.Get(header.ContentEncoding) == "" &&
+				(r.ContentLength < 0 || r.ContentLength >= int64(threshold)) {
+				if err := compressRequest(r, encoding, threshold); err != nil {
+					return nil, err
+				}
+			}
+
+			resp, err := next(r)
+			if err != nil || resp == nil {
+				return resp, err
+			}
+			if err = decompressResponse(resp); err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+			return resp, nil
+		}
+	}
+}
+
+func compressRequest(r *http.Request, encoding string, threshold int) error {
+	body, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if len(body) < threshold {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		return nil
+	}
+
+	buf := &bytes.Buffer{}
+	var w io.WriteCloser
+	switch encoding {
+	case EncodingGzip:
+		w = gzip.NewWriter(buf)
+	case EncodingZstd:
+		w, err = zstd.NewWriter(buf)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	default:
+		return errors.Errorf("unsupported encoding: %s", encoding)
+	}
+	if _, err = w.Write(body); err != nil {
+		return errors.WithStack(err)
+	}
+	if err = w.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	compressed := buf.Bytes()
+	r.Body = io.NopCloser(bytes.NewReader(compressed))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(compressed)), nil
+	}
+	r.ContentLength = int64(len(compressed))
+	r.Header.Set(header.ContentEncoding, encoding)
+	return nil
+}
+
+// decompressResponse replaces the body of gzip or zstd encoded response
+// with the decoding reader
+func decompressResponse(resp *http.Response) error {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get(header.ContentEncoding)))
+	if resp.Body == nil || resp.Body == http.NoBody {
+		return nil
+	}
+
+	var rc io.ReadCloser
+	switch encoding {
+	case EncodingGzip:
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				// empty body
+				return nil
+			}
+			return errors.WithMessage(err, "unable to decompress gzip response")
+		}
+		rc = &decompressBody{Reader: zr, decoder: zr, body: resp.Body}
+	case EncodingZstd:
+		zr, err := zstd.NewReader(resp.Body)
+		if err != nil {
+			return errors.WithMessage(err, "unable to decompress zstd response")
+		}
+		rc = &decompressBody{Reader: zr, decoder: zstdCloser{zr}, body: resp.Body}
+	default:
+		return nil
+	}
+
+	resp.Body = rc
+	resp.Header.Del(header.ContentEncoding)
+	resp.Header.Del(header.ContentLength)
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+type decompressBody struct {
+	io.Reader
+	decoder io.Closer
+	body    io.ReadCloser
+}
+
+func (b *decompressBody) Close() error {
+	_ = b.decoder.Close()
+	return b.body.Close()
+}
+
+type zstdCloser struct {
+	d *zstd.Decoder
+}
+
+func (c zstdCloser) Close() error {
+	c.d.Close()
+	return nil
+}
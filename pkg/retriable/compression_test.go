@@ -0,0 +1,92 @@
+package retriable_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompression(t *testing.T) {
+	large := `{"data":"` + strings.Repeat("a", 2048) + `"}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		switch r.Header.Get(header.ContentEncoding) {
+		case "gzip":
+			zr, err := gzip.NewReader(r.Body)
+			require.NoError(t, err)
+			body = zr
+		case "zstd":
+			zr, err := zstd.NewReader(r.Body)
+			require.NoError(t, err)
+			defer zr.Close()
+			body = zr
+		}
+		b, err := io.ReadAll(body)
+		require.NoError(t, err)
+
+		w.Header().Set("X-Request-Encoding", r.Header.Get(header.ContentEncoding))
+		w.Header().Set(header.ContentType, header.ApplicationJSON)
+		switch {
+		case r.URL.Path == "/zstd" && strings.Contains(r.Header.Get(header.AcceptEncoding), "zstd"):
+			w.Header().Set(header.ContentEncoding, "zstd")
+			zw, _ := zstd.NewWriter(w)
+			_, _ = zw.Write(b)
+			_ = zw.Close()
+		case strings.Contains(r.Header.Get(header.AcceptEncoding), "gzip"):
+			w.Header().Set(header.ContentEncoding, "gzip")
+			zw := gzip.NewWriter(w)
+			_, _ = zw.Write(b)
+			_ = zw.Close()
+		default:
+			_, _ = w.Write(b)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	for _, enc := range []string{retriable.EncodingGzip, retriable.EncodingZstd} {
+		t.Run(enc, func(t *testing.T) {
+			client, err := retriable.New(retriable.ClientConfig{Host: server.URL},
+				retriable.WithCompression(enc, 0))
+			require.NoError(t, err)
+
+			var res map[string]string
+			h, _, err := client.Post(ctx, "/"+enc, []byte(large), &res)
+			require.NoError(t, err)
+			assert.Equal(t, enc, h.Get("X-Request-Encoding"))
+			assert.Len(t, res["data"], 2048)
+			assert.Empty(t, h.Get(header.ContentEncoding))
+
+			// small body is not compressed
+			h, _, err = client.Post(ctx, "/"+enc, []byte(`{"data":"small"}`), &res)
+			require.NoError(t, err)
+			assert.Empty(t, h.Get("X-Request-Encoding"))
+			assert.Equal(t, "small", res["data"])
+
+			// streaming into io.Writer
+			w := bytes.NewBuffer([]byte{})
+			_, _, err = client.Post(ctx, "/"+enc, []byte(large), w)
+			require.NoError(t, err)
+			assert.Equal(t, large, w.String())
+		})
+	}
+
+	client, err := retriable.New(retriable.ClientConfig{Host: server.URL},
+		retriable.WithCompression("br", 1))
+	require.NoError(t, err)
+	_, _, err = client.Post(ctx, "/", []byte(large), nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported encoding: br")
+}
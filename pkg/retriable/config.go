@@ -2,11 +2,13 @@ package retriable
 
 import (
 	"crypto"
+	"crypto/tls"
 	"net/url"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/effective-security/porto/pkg/tlsconfig"
 	"github.com/effective-security/porto/xhttp/header"
 	"github.com/effective-security/xlog"
 	"github.com/effective-security/xpki/jwt/dpop"
@@ -30,9 +32,22 @@ type ClientConfig struct {
 	// TLS provides TLS config for the client
 	TLS *TLSInfo `json:"tls,omitempty" yaml:"tls,omitempty"`
 
+	// HostTLS provides TLS config per host, in host[:port] or URL format,
+	// that overrides TLS for the requests to the host
+	HostTLS map[string]*TLSInfo `json:"host_tls,omitempty" yaml:"host_tls,omitempty"`
+
 	// Request provides Request Policy
 	Request *RequestPolicy `json:"request,omitempty" yaml:"request,omitempty"`
 
+	// RetryBudget limits the retries to a ratio of the requests
+	RetryBudget *RetryBudgetConfig `json:"retry_budget,omitempty" yaml:"retry_budget,omitempty"`
+
+	// Dialer specifies the dual-stack behavior of the connections
+	Dialer *DialerConfig `json:"dialer,omitempty" yaml:"dialer,omitempty"`
+
+	// DNSCache specifies the caching of the resolved addresses
+	DNSCache *DNSCacheConfig `json:"dns_cache,omitempty" yaml:"dns_cache,omitempty"`
+
 	// StorageFolder specifies the root folder for keys and token.
 	StorageFolder string `json:"storage_folder,omitempty" yaml:"storage_folder,omitempty"`
 
@@ -49,6 +64,23 @@ func (c *ClientConfig) Storage() *Storage {
 type RequestPolicy struct {
 	RetryLimit int           `json:"retry_limit,omitempty" yaml:"retry_limit,omitempty"`
 	Timeout    time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// PerAttemptTimeout limits the time of a single attempt
+	PerAttemptTimeout time.Duration `json:"per_attempt_timeout,omitempty" yaml:"per_attempt_timeout,omitempty"`
+	// Backoff specifies the backoff strategy:
+	// constant, linear, exponential, exponential_jitter
+	Backoff string `json:"backoff,omitempty" yaml:"backoff,omitempty"`
+	// MaxBackoff caps the delay before the next retry
+	MaxBackoff time.Duration `json:"max_backoff,omitempty" yaml:"max_backoff,omitempty"`
+	// HonorRetryAfter uses the delay from Retry-After header of 429 and 503 responses,
+	// and waits at least for X-Processing-Hint of the retried responses
+	HonorRetryAfter bool `json:"honor_retry_after,omitempty" yaml:"honor_retry_after,omitempty"`
+	// HedgeDelay enables hedged requests for idempotent methods,
+	// the duplicate request is sent if no response is received within the delay
+	HedgeDelay time.Duration `json:"hedge_delay,omitempty" yaml:"hedge_delay,omitempty"`
+	// MaxHedges limits the number of duplicate requests per attempt, default is 1
+	MaxHedges int `json:"max_hedges,omitempty" yaml:"max_hedges,omitempty"`
+	// HedgeHosts specifies the hosts for the duplicate requests
+	HedgeHosts []string `json:"hedge_hosts,omitempty" yaml:"hedge_hosts,omitempty"`
 }
 
 // TLSInfo contains configuration info for the TLS
@@ -61,6 +93,24 @@ type TLSInfo struct {
 
 	// TrustedCAFile specifies location of the trusted Root file
 	TrustedCAFile string `json:"trusted_ca,omitempty" yaml:"trusted_ca,omitempty"`
+
+	// ServerName overrides the server name for SNI and certificate verification
+	ServerName string `json:"server_name,omitempty" yaml:"server_name,omitempty"`
+
+	// InsecureSkipVerify disables the server certificate verification,
+	// must be used only for lab hosts
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty" yaml:"insecure_skip_verify,omitempty"`
+}
+
+// TLSConfig returns the TLS config
+func (t *TLSInfo) TLSConfig() (*tls.Config, error) {
+	tlscfg, err := tlsconfig.NewClientTLSFromFiles(t.CertFile, t.KeyFile, t.TrustedCAFile)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to load TLS config")
+	}
+	tlscfg.ServerName = t.ServerName
+	tlscfg.InsecureSkipVerify = t.InsecureSkipVerify
+	return tlscfg, nil
 }
 
 // Factory provides factory for retriable client for a specific host
@@ -0,0 +1,215 @@
+package retriable
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/effective-security/porto/restserver/jsonschema"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// ContractMode specifies how the response contract violations are handled
+type ContractMode int
+
+const (
+	// ContractReport logs the violations, and reports them to OnViolation callback
+	ContractReport ContractMode = iota
+	// ContractEnforce returns ContractError from the call,
+	// to fail loudly in test and staging environments
+	ContractEnforce
+)
+
+// ResponseContract validates the response body
+type ResponseContract interface {
+	// ValidateResponse returns the list of the mismatched fields
+	ValidateResponse(body []byte) ([]*jsonschema.FieldError, error)
+}
+
+// SchemaContract returns ResponseContract for JSON Schema
+func SchemaContract(s *jsonschema.Schema) ResponseContract {
+	return schemaContract{schema: s}
+}
+
+type schemaContract struct {
+	schema *jsonschema.Schema
+}
+
+func (c schemaContract) ValidateResponse(body []byte) ([]*jsonschema.FieldError, error) {
+	return c.schema.ValidateJSON(body)
+}
+
+// ProtoContract returns ResponseContract for the protobuf message,
+// the response must be decodable by protojson without unknown fields
+func ProtoContract(msg proto.Message) ResponseContract {
+	return protoContract{msg: msg}
+}
+
+type protoContract struct {
+	msg proto.Message
+}
+
+func (c protoContract) ValidateResponse(body []byte) ([]*jsonschema.FieldError, error) {
+	m := c.msg.ProtoReflect().New().Interface()
+	if err := protojson.Unmarshal(body, m); err != nil {
+		return []*jsonschema.FieldError{{Message: err.Error()}}, nil
+	}
+	return nil, nil
+}
+
+// ContractError describes the response that does not match the contract
+type ContractError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Violations []*jsonschema.FieldError
+}
+
+// Error implements error interface
+func (e *ContractError) Error() string {
+	list := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		list[i] = v.Error()
+	}
+	return fmt.Sprintf("response contract violation: %s %s: %s",
+		e.Method, e.Path, strings.Join(list, "; "))
+}
+
+// Contracts provides the response contracts per route,
+// the path may include `{name}` or `:name` segments
+type Contracts struct {
+	mode        ContractMode
+	onViolation func(*ContractError)
+
+	lock   sync.RWMutex
+	routes []*contractRoute
+}
+
+type contractRoute struct {
+	method   string
+	segments []string
+	path     string
+	contract ResponseContract
+}
+
+// NewContracts returns Contracts
+func NewContracts(mode ContractMode) *Contracts {
+	return &Contracts{mode: mode}
+}
+
+// OnViolation specifies the callback to report the violations
+func (c *Contracts) OnViolation(fn func(*ContractError)) *Contracts {
+	c.onViolation = fn
+	return c
+}
+
+// Add registers the contract for the route
+func (c *Contracts) Add(method, path string, contract ResponseContract) *Contracts {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.routes = append(c.routes, &contractRoute{
+		method:   method,
+		path:     path,
+		segments: strings.Split(strings.Trim(path, "/"), "/"),
+		contract: contract,
+	})
+	return c
+}
+
+// AddSchema registers JSON Schema for the route
+func (c *Contracts) AddSchema(method, path string, schema *jsonschema.Schema) *Contracts {
+	return c.Add(method, path, SchemaContract(schema))
+}
+
+// AddProto registers the protobuf message for the route
+func (c *Contracts) AddProto(method, path string, msg proto.Message) *Contracts {
+	return c.Add(method, path, ProtoContract(msg))
+}
+
+func (c *Contracts) find(method, path string) *contractRoute {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for _, r := range c.routes {
+		if r.method == method && matchSegments(r.segments, segments) {
+			return r
+		}
+	}
+	return nil
+}
+
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) != len(segments) {
+		return false
+	}
+	for i, p := range pattern {
+		if strings.HasPrefix(p, ":") || (strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}")) {
+			continue
+		}
+		if p != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// check validates the successful response,
+// the body is buffered and can be decoded after the check
+func (c *Contracts) check(resp *http.Response) error {
+	if resp.Request == nil || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil
+	}
+	route := c.find(resp.Request.Method, resp.Request.URL.Path)
+	if route == nil {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	violations, err := route.contract.ValidateResponse(body)
+	if err != nil {
+		violations = []*jsonschema.FieldError{{Message: err.Error()}}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+
+	cerr := &ContractError{
+		Method:     route.method,
+		Path:       route.path,
+		StatusCode: resp.StatusCode,
+		Violations: violations,
+	}
+	logger.ContextKV(resp.Request.Context(), xlog.WARNING,
+		"reason", "contract_violation",
+		"method", cerr.Method,
+		"path", cerr.Path,
+		"err", cerr.Error())
+
+	if c.onViolation != nil {
+		c.onViolation(cerr)
+	}
+	if c.mode == ContractEnforce {
+		return cerr
+	}
+	return nil
+}
+
+// WithResponseContracts is a ClientOption that validates
+// the successful responses against the registered contracts
+func WithResponseContracts(contracts *Contracts) ClientOption {
+	return optionFunc(func(c *Client) {
+		c.contracts = contracts
+	})
+}
@@ -0,0 +1,88 @@
+package retriable_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/restserver/jsonschema"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+const userSchema = `{
+	"type": "object",
+	"required": ["id", "name"],
+	"properties": {
+		"id": {"type": "integer"},
+		"name": {"type": "string"}
+	}
+}`
+
+func TestResponseContracts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/users/1":
+			_, _ = w.Write([]byte(`{"id":1,"name":"alice"}`))
+		case "/v1/users/2":
+			_, _ = w.Write([]byte(`{"id":"2"}`))
+		case "/v1/info/ok":
+			_, _ = w.Write([]byte(`{"reason":"ok","domain":"test"}`))
+		case "/v1/info/drift":
+			_, _ = w.Write([]byte(`{"reason":"ok","extra":1}`))
+		}
+	}))
+	defer server.Close()
+
+	var reported []*retriable.ContractError
+	contracts := retriable.NewContracts(retriable.ContractEnforce).
+		AddSchema(http.MethodGet, "/v1/users/{id}", jsonschema.MustCompile([]byte(userSchema))).
+		AddProto(http.MethodGet, "/v1/info/:name", &errdetails.ErrorInfo{}).
+		OnViolation(func(e *retriable.ContractError) {
+			reported = append(reported, e)
+		})
+
+	client, err := retriable.New(retriable.ClientConfig{Host: server.URL},
+		retriable.WithResponseContracts(contracts))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	var user struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	_, _, err = client.Get(ctx, "/v1/users/1", &user)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", user.Name)
+
+	_, _, err = client.Get(ctx, "/v1/users/2", &user)
+	require.Error(t, err)
+	var cerr *retriable.ContractError
+	require.True(t, errors.As(err, &cerr))
+	assert.Equal(t, "/v1/users/{id}", cerr.Path)
+	assert.Len(t, cerr.Violations, 2)
+	assert.Contains(t, err.Error(), "response contract violation: GET /v1/users/{id}: ")
+
+	var info map[string]any
+	_, _, err = client.Get(ctx, "/v1/info/ok", &info)
+	require.NoError(t, err)
+	assert.Equal(t, "test", info["domain"])
+
+	_, _, err = client.Get(ctx, "/v1/info/drift", &info)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "extra")
+	assert.Len(t, reported, 2)
+
+	// report mode does not fail the call
+	client, err = retriable.New(retriable.ClientConfig{Host: server.URL},
+		retriable.WithResponseContracts(retriable.NewContracts(retriable.ContractReport).
+			AddSchema(http.MethodGet, "/v1/users/{id}", jsonschema.MustCompile([]byte(userSchema)))))
+	require.NoError(t, err)
+	_, _, err = client.Get(ctx, "/v1/users/2", &info)
+	require.NoError(t, err)
+	assert.Equal(t, "2", info["id"])
+}
@@ -0,0 +1,350 @@
+package retriable
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+// Address families of DialerConfig.Prefer
+const (
+	IPv4 = "ipv4"
+	IPv6 = "ipv6"
+)
+
+// DefaultFallbackDelay is the delay before the connection
+// to the other address family is started
+const DefaultFallbackDelay = 300 * time.Millisecond
+
+// DialerConfig specifies the dual-stack behavior of the connections
+type DialerConfig struct {
+	// Timeout limits the time to establish the connection,
+	// including the resolution and the fallbacks
+	Timeout time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// KeepAlive specifies the interval of TCP keep-alive probes,
+	// zero uses the system default
+	KeepAlive time.Duration `json:"keep_alive,omitempty" yaml:"keep_alive,omitempty"`
+	// DisableHappyEyeballs disables the racing of IPv4 and IPv6 connections,
+	// the addresses are tried one by one in the preferred order
+	DisableHappyEyeballs bool `json:"disable_happy_eyeballs,omitempty" yaml:"disable_happy_eyeballs,omitempty"`
+	// FallbackDelay specifies the delay before the connection
+	// to the other address family is started, default is 300ms
+	FallbackDelay time.Duration `json:"fallback_delay,omitempty" yaml:"fallback_delay,omitempty"`
+	// Prefer specifies the preferred address family: ipv4 or ipv6,
+	// by default the family of the first resolved address is preferred
+	Prefer string `json:"prefer,omitempty" yaml:"prefer,omitempty"`
+	// IPv4Timeout limits the connection to a single IPv4 address
+	IPv4Timeout time.Duration `json:"ipv4_timeout,omitempty" yaml:"ipv4_timeout,omitempty"`
+	// IPv6Timeout limits the connection to a single IPv6 address
+	IPv6Timeout time.Duration `json:"ipv6_timeout,omitempty" yaml:"ipv6_timeout,omitempty"`
+	// PinnedIPs maps the host names to the addresses to connect to,
+	// the DNS resolution is not used for the pinned hosts
+	PinnedIPs map[string][]string `json:"pinned_ips,omitempty" yaml:"pinned_ips,omitempty"`
+}
+
+// Validate returns error if the config is invalid
+func (cfg *DialerConfig) Validate() error {
+	switch cfg.Prefer {
+	case "", IPv4, IPv6:
+	default:
+		return errors.Errorf("invalid address family: %s", cfg.Prefer)
+	}
+	for host, ips := range cfg.PinnedIPs {
+		for _, ip := range ips {
+			if net.ParseIP(ip) == nil {
+				return errors.Errorf("invalid pinned IP for %s: %s", host, ip)
+			}
+		}
+	}
+	return nil
+}
+
+// WithDialer is a ClientOption that specifies the dual-stack behavior
+// of the connections: Happy Eyeballs, the preferred address family,
+// the connect timeouts per address family, and the pinned IPs.
+//
+//	retriable.New(retriable.WithDialer(retriable.DialerConfig{Prefer: retriable.IPv4}))
+//
+// Note that WithDialer applies changes to http client Transport object
+// and hence if used in conjuction with WithTransport method,
+// WithDialer should be called after WithTransport is called.
+func WithDialer(cfg DialerConfig) ClientOption {
+	return optionFunc(func(c *Client) {
+		c.WithDialer(cfg)
+	})
+}
+
+// WithDialer modifies the dialer of the connections,
+// see WithDialer option for details.
+func (c *Client) WithDialer(cfg DialerConfig) *Client {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.dialer = &cfg
+	c.setDialContext()
+	return c
+}
+
+// setDialContext sets DialContext of the transport
+// with the dialer config, DNS server and DNS cache
+func (c *Client) setDialContext() {
+	if c.httpClient.Transport == nil {
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		tr.MaxIdleConnsPerHost = 100
+		tr.MaxConnsPerHost = 100
+		tr.MaxIdleConns = 100
+
+		c.httpClient.Transport = tr
+	} else {
+		logger.KV(xlog.DEBUG, "reason", "update_transport")
+	}
+
+	tr, ok := c.httpClient.Transport.(*http.Transport)
+	if !ok {
+		logger.KV(xlog.WARNING, "reason", "custom_transport", "dialer", "not_applied")
+		return
+	}
+
+	resolver := net.DefaultResolver
+	if dns := c.dns; dns != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				d := net.Dialer{}
+				return d.DialContext(ctx, network, dns)
+			},
+		}
+	}
+
+	if c.dialer == nil && c.dnsCache == nil {
+		tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			d := net.Dialer{Resolver: resolver}
+			return d.DialContext(ctx, network, addr)
+		}
+		c.hostClients = nil
+		return
+	}
+
+	lookup := func(ctx context.Context, host string) ([]net.IP, error) {
+		return resolver.LookupIP(ctx, "ip", host)
+	}
+	if c.dnsCache != nil {
+		lookup = c.dnsCache.LookupIP
+	}
+	var cfg DialerConfig
+	if c.dialer != nil {
+		cfg = *c.dialer
+	}
+	tr.DialContext = newDualStackDialer(cfg, lookup).DialContext
+	c.hostClients = nil
+}
+
+// dualStackDialer connects to IPv4 and IPv6 addresses of the host
+type dualStackDialer struct {
+	cfg    DialerConfig
+	lookup func(ctx context.Context, host string) ([]net.IP, error)
+	pinned map[string][]net.IP
+}
+
+func newDualStackDialer(cfg DialerConfig, lookup func(ctx context.Context, host string) ([]net.IP, error)) *dualStackDialer {
+	d := &dualStackDialer{
+		cfg:    cfg,
+		lookup: lookup,
+		pinned: map[string][]net.IP{},
+	}
+	if d.cfg.FallbackDelay <= 0 {
+		d.cfg.FallbackDelay = DefaultFallbackDelay
+	}
+	for host, list := range cfg.PinnedIPs {
+		for _, s := range list {
+			if ip := net.ParseIP(s); ip != nil {
+				host = strings.ToLower(host)
+				d.pinned[host] = append(d.pinned[host], ip)
+			} else {
+				logger.KV(xlog.WARNING, "reason", "invalid_pinned_ip", "host", host, "ip", s)
+			}
+		}
+	}
+	return d
+}
+
+// DialContext connects to the address on the named network
+func (d *dualStackDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if d.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.cfg.Timeout)
+		defer cancel()
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	ips, err := d.resolve(ctx, network, host)
+	if err != nil {
+		return nil, err
+	}
+
+	primaries, fallbacks := d.partition(ips)
+	if d.cfg.DisableHappyEyeballs || len(fallbacks) == 0 {
+		return d.dialSerial(ctx, network, append(primaries, fallbacks...), port)
+	}
+	return d.dialParallel(ctx, network, primaries, fallbacks, port)
+}
+
+// resolve returns the pinned or resolved addresses of the host,
+// suitable for the network
+func (d *dualStackDialer) resolve(ctx context.Context, network, host string) ([]net.IP, error) {
+	var ips []net.IP
+	if pinned, ok := d.pinned[strings.ToLower(host)]; ok {
+		ips = pinned
+	} else if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		resolved, err := d.lookup(ctx, host)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		ips = resolved
+	}
+
+	list := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
+		ipv4 := ip.To4() != nil
+		if (network == "tcp4" && !ipv4) || (network == "tcp6" && ipv4) {
+			continue
+		}
+		list = append(list, ip)
+	}
+	if len(list) == 0 {
+		return nil, errors.Errorf("no suitable address for host: %s", host)
+	}
+	return list, nil
+}
+
+// partition splits the addresses into the preferred and the other address family,
+// preserving the order
+func (d *dualStackDialer) partition(ips []net.IP) (primaries, fallbacks []net.IP) {
+	preferIPv4 := ips[0].To4() != nil
+	switch d.cfg.Prefer {
+	case IPv4:
+		preferIPv4 = true
+	case IPv6:
+		preferIPv4 = false
+	}
+	for _, ip := range ips {
+		if (ip.To4() != nil) == preferIPv4 {
+			primaries = append(primaries, ip)
+		} else {
+			fallbacks = append(fallbacks, ip)
+		}
+	}
+	if len(primaries) == 0 {
+		return fallbacks, nil
+	}
+	return primaries, fallbacks
+}
+
+// dialSerial connects to the addresses one by one,
+// and returns the first successful connection or the first error
+func (d *dualStackDialer) dialSerial(ctx context.Context, network string, ips []net.IP, port string) (net.Conn, error) {
+	var firstErr error
+	for _, ip := range ips {
+		conn, err := d.dial(ctx, network, ip, port)
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+func (d *dualStackDialer) dial(ctx context.Context, network string, ip net.IP, port string) (net.Conn, error) {
+	timeout := d.cfg.IPv6Timeout
+	if ip.To4() != nil {
+		timeout = d.cfg.IPv4Timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	dialer := net.Dialer{KeepAlive: d.cfg.KeepAlive}
+	conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return conn, nil
+}
+
+// dialParallel races the connections to the preferred and the other address family,
+// the fallback is started after FallbackDelay, or when the preferred one fails
+func (d *dualStackDialer) dialParallel(ctx context.Context, network string, primaries, fallbacks []net.IP, port string) (net.Conn, error) {
+	type result struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	returned := make(chan struct{})
+	defer close(returned)
+
+	results := make(chan result)
+	start := func(ips []net.IP, primary bool) {
+		conn, err := d.dialSerial(ctx, network, ips, port)
+		select {
+		case results <- result{conn: conn, err: err, primary: primary}:
+		case <-returned:
+			if conn != nil {
+				_ = conn.Close()
+			}
+		}
+	}
+
+	go start(primaries, true)
+
+	timer := time.NewTimer(d.cfg.FallbackDelay)
+	defer timer.Stop()
+
+	var primaryErr error
+	fallbackStarted, primaryDone, fallbackDone := false, false, false
+	for {
+		select {
+		case <-timer.C:
+			if !fallbackStarted {
+				fallbackStarted = true
+				go start(fallbacks, false)
+			}
+		case res := <-results:
+			if res.err == nil {
+				return res.conn, nil
+			}
+			if res.primary {
+				primaryDone = true
+				primaryErr = res.err
+			} else {
+				fallbackDone = true
+			}
+			if primaryDone && fallbackDone {
+				return nil, primaryErr
+			}
+			if !fallbackStarted {
+				fallbackStarted = true
+				go start(fallbacks, false)
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package retriable_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"host":"` + r.Host + `"}`))
+	}))
+	defer ts.Close()
+
+	_, port, err := net.SplitHostPort(ts.Listener.Addr().String())
+	require.NoError(t, err)
+	host := "http://service.test:" + port
+
+	call := func(cfg retriable.DialerConfig) error {
+		client, err := retriable.New(retriable.ClientConfig{
+			Host:   host,
+			Dialer: &cfg,
+		})
+		require.NoError(t, err)
+
+		var res map[string]string
+		_, _, err = client.Get(context.Background(), "/", &res)
+		if err == nil {
+			assert.Equal(t, "service.test:"+port, res["host"])
+		}
+		return err
+	}
+
+	t.Run("pinned", func(t *testing.T) {
+		err := call(retriable.DialerConfig{
+			PinnedIPs: map[string][]string{"service.test": {"127.0.0.1"}},
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		// the server listens only on IPv4
+		err := call(retriable.DialerConfig{
+			Prefer:        retriable.IPv6,
+			FallbackDelay: time.Second,
+			PinnedIPs:     map[string][]string{"service.test": {"127.0.0.1", "::1"}},
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("serial", func(t *testing.T) {
+		err := call(retriable.DialerConfig{
+			Prefer:               retriable.IPv6,
+			DisableHappyEyeballs: true,
+			PinnedIPs:            map[string][]string{"service.test": {"127.0.0.1", "::1"}},
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("ipv4_timeout", func(t *testing.T) {
+		client, err := retriable.New(retriable.ClientConfig{
+			Dialer: &retriable.DialerConfig{
+				IPv4Timeout: time.Nanosecond,
+				PinnedIPs:   map[string][]string{"service.test": {"127.0.0.1"}},
+			},
+		})
+		require.NoError(t, err)
+
+		tr := client.HTTPClient().Transport.(*http.Transport)
+		_, err = tr.DialContext(context.Background(), "tcp", "service.test:"+port)
+		require.Error(t, err)
+
+		_, err = tr.DialContext(context.Background(), "tcp6", "service.test:"+port)
+		assert.EqualError(t, err, "no suitable address for host: service.test")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := retriable.New(retriable.ClientConfig{
+			Dialer: &retriable.DialerConfig{Prefer: "ipv5"},
+		})
+		assert.EqualError(t, err, "invalid address family: ipv5")
+
+		_, err = retriable.New(retriable.ClientConfig{
+			Dialer: &retriable.DialerConfig{PinnedIPs: map[string][]string{"service.test": {"localhost"}}},
+		})
+		assert.EqualError(t, err, "invalid pinned IP for service.test: localhost")
+	})
+}
@@ -0,0 +1,353 @@
+package retriable
+
+import (
+	"context"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/effective-security/porto/x/clock"
+	"github.com/pkg/errors"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DefaultDNSTTL is the TTL of the addresses,
+// if the resolver does not provide TTL
+const DefaultDNSTTL = 30 * time.Second
+
+// DNSCacheConfig specifies the caching of the resolved addresses
+type DNSCacheConfig struct {
+	// DefaultTTL is used if the resolver does not provide TTL, default 30s
+	DefaultTTL time.Duration `json:"default_ttl,omitempty" yaml:"default_ttl,omitempty"`
+	// MinTTL overrides TTL of the records, that are shorter
+	MinTTL time.Duration `json:"min_ttl,omitempty" yaml:"min_ttl,omitempty"`
+	// MaxTTL overrides TTL of the records, that are longer
+	MaxTTL time.Duration `json:"max_ttl,omitempty" yaml:"max_ttl,omitempty"`
+	// NegativeTTL specifies the time to cache the failed lookups,
+	// zero disables the negative caching
+	NegativeTTL time.Duration `json:"negative_ttl,omitempty" yaml:"negative_ttl,omitempty"`
+}
+
+// Resolver looks up the addresses of the host
+type Resolver interface {
+	// LookupIP returns the addresses of the host, and TTL of the records,
+	// zero TTL if not known
+	LookupIP(ctx context.Context, host string) ([]net.IP, time.Duration, error)
+}
+
+// ResolverFunc is an adapter to use a function as Resolver
+type ResolverFunc func(ctx context.Context, host string) ([]net.IP, time.Duration, error)
+
+// LookupIP calls f(ctx, host)
+func (f ResolverFunc) LookupIP(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+	return f(ctx, host)
+}
+
+// SystemResolver returns Resolver, that uses net.Resolver,
+// the TTL is not provided by the system resolver
+func SystemResolver(r *net.Resolver) Resolver {
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	return ResolverFunc(func(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+		ips, err := r.LookupIP(ctx, "ip", host)
+		return ips, 0, errors.WithStack(err)
+	})
+}
+
+// DNSLookupMetrics describes a lookup of the host
+type DNSLookupMetrics struct {
+	Host string
+	// Hit is true if the addresses were returned from the cache
+	Hit bool
+	// Latency of the resolver, zero for the cache hits
+	Latency time.Duration
+	Err     error
+}
+
+// DNSMetrics receives the metrics of the lookups.
+// The callback is called synchronously, and must not block.
+type DNSMetrics interface {
+	OnDNSLookup(m *DNSLookupMetrics)
+}
+
+// DNSCache caches the resolved addresses with TTL of the records,
+// the concurrent lookups of the same host share the result
+type DNSCache struct {
+	cfg      DNSCacheConfig
+	resolver Resolver
+	metrics  DNSMetrics
+	clock    clock.Clock
+
+	lock    sync.Mutex
+	entries map[string]*dnsEntry
+}
+
+type dnsEntry struct {
+	ips     []net.IP
+	err     error
+	expires time.Time
+	done    chan struct{}
+}
+
+// NewDNSCache returns DNSCache,
+// if resolver is nil, the system resolver is used
+func NewDNSCache(cfg DNSCacheConfig, resolver Resolver) *DNSCache {
+	if resolver == nil {
+		resolver = SystemResolver(nil)
+	}
+	if cfg.DefaultTTL <= 0 {
+		cfg.DefaultTTL = DefaultDNSTTL
+	}
+	return &DNSCache{
+		cfg:      cfg,
+		resolver: resolver,
+		clock:    clock.System,
+		entries:  map[string]*dnsEntry{},
+	}
+}
+
+// WithMetrics specifies the metrics of the lookups
+func (c *DNSCache) WithMetrics(m DNSMetrics) *DNSCache {
+	c.metrics = m
+	return c
+}
+
+// WithClock specifies the time source of the expiry
+func (c *DNSCache) WithClock(clk clock.Clock) *DNSCache {
+	c.clock = clock.OrSystem(clk)
+	return c
+}
+
+// LookupIP returns the cached or resolved addresses of the host
+func (c *DNSCache) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	c.lock.Lock()
+	if e := c.entries[host]; e != nil {
+		select {
+		case <-e.done:
+			if c.clock.Now().Before(e.expires) {
+				c.lock.Unlock()
+				c.report(host, true, 0, e.err)
+				return e.ips, e.err
+			}
+		default:
+			// the lookup is in flight
+			c.lock.Unlock()
+			select {
+			case <-e.done:
+				c.report(host, true, 0, e.err)
+				return e.ips, e.err
+			case <-ctx.Done():
+				return nil, errors.WithStack(ctx.Err())
+			}
+		}
+	}
+	e := &dnsEntry{done: make(chan struct{})}
+	c.entries[host] = e
+	c.lock.Unlock()
+
+	started := time.Now()
+	ips, ttl, err := c.resolver.LookupIP(ctx, host)
+	latency := time.Since(started)
+	if err == nil && len(ips) == 0 {
+		err = errors.Errorf("no addresses for host: %s", host)
+	}
+
+	e.ips, e.err = ips, err
+	if err != nil {
+		ttl = c.cfg.NegativeTTL
+		if ctx.Err() != nil {
+			// do not cache the cancelled lookups
+			ttl = 0
+		}
+	} else {
+		ttl = c.ttl(ttl)
+	}
+	e.expires = c.clock.Now().Add(ttl)
+	close(e.done)
+
+	if ttl <= 0 {
+		c.lock.Lock()
+		if c.entries[host] == e {
+			delete(c.entries, host)
+		}
+		c.lock.Unlock()
+	}
+
+	c.report(host, false, latency, err)
+	return ips, err
+}
+
+// Flush removes the hosts from the cache,
+// or all entries if no hosts are provided
+func (c *DNSCache) Flush(hosts ...string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if len(hosts) == 0 {
+		c.entries = map[string]*dnsEntry{}
+		return
+	}
+	for _, host := range hosts {
+		delete(c.entries, strings.ToLower(strings.TrimSuffix(host, ".")))
+	}
+}
+
+// ttl applies the overrides to TTL of the records
+func (c *DNSCache) ttl(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		ttl = c.cfg.DefaultTTL
+	}
+	if c.cfg.MinTTL > 0 && ttl < c.cfg.MinTTL {
+		ttl = c.cfg.MinTTL
+	}
+	if c.cfg.MaxTTL > 0 && ttl > c.cfg.MaxTTL {
+		ttl = c.cfg.MaxTTL
+	}
+	return ttl
+}
+
+func (c *DNSCache) report(host string, hit bool, latency time.Duration, err error) {
+	if c.metrics != nil {
+		c.metrics.OnDNSLookup(&DNSLookupMetrics{
+			Host:    host,
+			Hit:     hit,
+			Latency: latency,
+			Err:     err,
+		})
+	}
+}
+
+// WithDNSCache is a ClientOption that resolves the hosts with the cache,
+// the cache can be shared by the clients.
+//
+//	retriable.New(retriable.WithDNSCache(retriable.NewDNSCache(cfg, nil)))
+//
+// Note that WithDNSCache applies changes to http client Transport object
+// and hence if used in conjuction with WithTransport method,
+// WithDNSCache should be called after WithTransport is called.
+func WithDNSCache(cache *DNSCache) ClientOption {
+	return optionFunc(func(c *Client) {
+		c.WithDNSCache(cache)
+	})
+}
+
+// WithDNSCache modifies the DNS cache of the connections,
+// see WithDNSCache option for details.
+func (c *Client) WithDNSCache(cache *DNSCache) *Client {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.dnsCache = cache
+	c.setDialContext()
+	return c
+}
+
+// DNSServerResolver returns Resolver, that queries the DNS server
+// in <host>:<port> format over UDP, and provides TTL of the records
+func DNSServerResolver(server string) Resolver {
+	return ResolverFunc(func(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+		var ips []net.IP
+		var ttl time.Duration
+		var firstErr error
+		for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+			list, rttl, err := queryDNS(ctx, server, host, qtype)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			if len(list) > 0 && (ttl == 0 || rttl < ttl) {
+				ttl = rttl
+			}
+			ips = append(ips, list...)
+		}
+		if len(ips) == 0 {
+			if firstErr == nil {
+				firstErr = errors.Errorf("no addresses for host: %s", host)
+			}
+			return nil, 0, firstErr
+		}
+		return ips, ttl, nil
+	})
+}
+
+// queryDNS returns the addresses of the type, and the minimum TTL of the records
+func queryDNS(ctx context.Context, server, host string, qtype dnsmessage.Type) ([]net.IP, time.Duration, error) {
+	name, err := dnsmessage.NewName(strings.TrimSuffix(host, ".") + ".")
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	id := uint16(rand.Uint32())
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{
+			{Name: name, Type: qtype, Class: dnsmessage.ClassINET},
+		},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	} else {
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	}
+	if _, err = conn.Write(packed); err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, 0, errors.WithStack(err)
+		}
+		var res dnsmessage.Message
+		if err = res.Unpack(buf[:n]); err != nil {
+			return nil, 0, errors.WithStack(err)
+		}
+		if res.ID != id || !res.Response {
+			// not the response to the query
+			continue
+		}
+		switch res.RCode {
+		case dnsmessage.RCodeSuccess:
+		case dnsmessage.RCodeNameError:
+			return nil, 0, errors.Errorf("no such host: %s", host)
+		default:
+			return nil, 0, errors.Errorf("DNS query failed for host %s: %s", host, res.RCode)
+		}
+
+		var ips []net.IP
+		var ttl uint32
+		for _, a := range res.Answers {
+			var ip net.IP
+			switch rr := a.Body.(type) {
+			case *dnsmessage.AResource:
+				ip = net.IP(rr.A[:])
+			case *dnsmessage.AAAAResource:
+				ip = net.IP(rr.AAAA[:])
+			default:
+				continue
+			}
+			if len(ips) == 0 || a.Header.TTL < ttl {
+				ttl = a.Header.TTL
+			}
+			ips = append(ips, ip)
+		}
+		return ips, time.Duration(ttl) * time.Second, nil
+	}
+}
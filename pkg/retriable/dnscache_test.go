@@ -0,0 +1,169 @@
+package retriable_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/x/clock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type dnsRecorder struct {
+	lock    sync.Mutex
+	lookups []retriable.DNSLookupMetrics
+}
+
+func (r *dnsRecorder) OnDNSLookup(m *retriable.DNSLookupMetrics) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.lookups = append(r.lookups, *m)
+}
+
+func TestDNSCache(t *testing.T) {
+	var calls atomic.Int32
+	resolver := retriable.ResolverFunc(func(_ context.Context, host string) ([]net.IP, time.Duration, error) {
+		calls.Add(1)
+		if host == "bad.test" {
+			return nil, 0, errors.New("no such host")
+		}
+		return []net.IP{net.ParseIP("127.0.0.1")}, 10 * time.Second, nil
+	})
+
+	now := time.Now()
+	clk := clock.Func(func() time.Time { return now })
+	rec := &dnsRecorder{}
+	cache := retriable.NewDNSCache(retriable.DNSCacheConfig{
+		MinTTL:      20 * time.Second,
+		MaxTTL:      time.Minute,
+		NegativeTTL: 5 * time.Second,
+	}, resolver).WithClock(clk).WithMetrics(rec)
+
+	ctx := context.Background()
+	ips, err := cache.LookupIP(ctx, "SVC.test.")
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", ips[0].String())
+	_, err = cache.LookupIP(ctx, "svc.test")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), calls.Load())
+
+	// TTL is raised to MinTTL
+	now = now.Add(19 * time.Second)
+	_, err = cache.LookupIP(ctx, "svc.test")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), calls.Load())
+
+	now = now.Add(2 * time.Second)
+	_, err = cache.LookupIP(ctx, "svc.test")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+
+	cache.Flush("svc.test")
+	_, err = cache.LookupIP(ctx, "svc.test")
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), calls.Load())
+
+	// negative caching
+	_, err = cache.LookupIP(ctx, "bad.test")
+	require.Error(t, err)
+	_, err = cache.LookupIP(ctx, "bad.test")
+	assert.EqualError(t, err, "no such host")
+	assert.Equal(t, int32(4), calls.Load())
+
+	now = now.Add(6 * time.Second)
+	_, err = cache.LookupIP(ctx, "bad.test")
+	require.Error(t, err)
+	assert.Equal(t, int32(5), calls.Load())
+
+	cache.Flush()
+	_, err = cache.LookupIP(ctx, "svc.test")
+	require.NoError(t, err)
+	assert.Equal(t, int32(6), calls.Load())
+
+	rec.lock.Lock()
+	require.Len(t, rec.lookups, 9)
+	assert.Equal(t, "svc.test", rec.lookups[0].Host)
+	assert.False(t, rec.lookups[0].Hit)
+	assert.True(t, rec.lookups[1].Hit)
+	assert.Zero(t, rec.lookups[1].Latency)
+	assert.Error(t, rec.lookups[6].Err)
+	rec.lock.Unlock()
+
+	t.Run("client", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(`{}`))
+		}))
+		defer ts.Close()
+		_, port, err := net.SplitHostPort(ts.Listener.Addr().String())
+		require.NoError(t, err)
+
+		client, err := retriable.New(retriable.ClientConfig{Host: "http://svc.test:" + port},
+			retriable.WithDNSCache(cache))
+		require.NoError(t, err)
+
+		var res map[string]any
+		_, _, err = client.Get(ctx, "/", &res)
+		require.NoError(t, err)
+		_, _, err = client.Get(ctx, "/", &res)
+		require.NoError(t, err)
+		assert.Equal(t, int32(6), calls.Load())
+	})
+}
+
+func TestDNSServerResolver(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc.Close()
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var q dnsmessage.Message
+			if q.Unpack(buf[:n]) != nil {
+				continue
+			}
+			res := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: q.ID, Response: true},
+				Questions: q.Questions,
+			}
+			hdr := dnsmessage.ResourceHeader{Name: q.Questions[0].Name, Class: dnsmessage.ClassINET, TTL: 42}
+			switch q.Questions[0].Type {
+			case dnsmessage.TypeA:
+				hdr.Type = dnsmessage.TypeA
+				res.Answers = append(res.Answers, dnsmessage.Resource{
+					Header: hdr,
+					Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+				})
+			case dnsmessage.TypeAAAA:
+				hdr.Type = dnsmessage.TypeAAAA
+				hdr.TTL = 300
+				res.Answers = append(res.Answers, dnsmessage.Resource{
+					Header: hdr,
+					Body:   &dnsmessage.AAAAResource{AAAA: [16]byte{15: 1}},
+				})
+			}
+			b, _ := res.Pack()
+			_, _ = pc.WriteTo(b, addr)
+		}
+	}()
+
+	ips, ttl, err := retriable.DNSServerResolver(pc.LocalAddr().String()).LookupIP(context.Background(), "svc.test")
+	require.NoError(t, err)
+	require.Len(t, ips, 2)
+	assert.Equal(t, "127.0.0.1", ips[0].String())
+	assert.Equal(t, "::1", ips[1].String())
+	assert.Equal(t, 42*time.Second, ttl)
+}
@@ -0,0 +1,275 @@
+package retriable
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+// DefaultDownloadResumes specifies the default number of attempts
+// to resume the interrupted download
+const DefaultDownloadResumes = 3
+
+// ProgressFunc is called when the downloaded data is written,
+// total is -1 if the size is unknown
+type ProgressFunc func(written, total int64)
+
+// DownloadOption configures Download
+type DownloadOption interface {
+	applyDownloadOption(*downloadOptions)
+}
+
+type downloadOptions struct {
+	progress ProgressFunc
+	resumes  int
+	offset   int64
+}
+
+type downloadOptionFunc func(*downloadOptions)
+
+func (f downloadOptionFunc) applyDownloadOption(o *downloadOptions) { f(o) }
+
+// WithProgress specifies the callback to report the progress
+func WithProgress(f ProgressFunc) DownloadOption {
+	return downloadOptionFunc(func(o *downloadOptions) {
+		o.progress = f
+	})
+}
+
+// WithResumes specifies the number of attempts to resume the interrupted download
+// with Range request, default is DefaultDownloadResumes
+func WithResumes(n int) DownloadOption {
+	return downloadOptionFunc(func(o *downloadOptions) {
+		o.resumes = n
+	})
+}
+
+// WithOffset specifies to start the download from the offset,
+// for example when the caller has a partial file from the previous download.
+// The Content-MD5 is not verified if the offset is specified.
+func WithOffset(offset int64) DownloadOption {
+	return downloadOptionFunc(func(o *downloadOptions) {
+		o.offset = offset
+	})
+}
+
+// Download streams the response body of GET request to w,
+// without buffering.
+// If the stream is interrupted, then the download is resumed with Range request,
+// and If-Range header to ensure the same version of the content.
+// The size is verified with Content-Length or Content-Range,
+// and the content with Content-MD5, if present.
+// It returns the headers of the first response, and the number of bytes written,
+// including the offset.
+func (c *Client) Download(ctx context.Context, path string, w io.Writer, opts ...DownloadOption) (http.Header, int64, error) {
+	o := downloadOptions{
+		resumes: DefaultDownloadResumes,
+	}
+	for _, opt := range opts {
+		opt.applyDownloadOption(&o)
+	}
+
+	d := &download{
+		w:        w,
+		written:  o.offset,
+		total:    -1,
+		progress: o.progress,
+	}
+	if o.offset == 0 {
+		d.md5 = md5.New()
+	}
+
+	var hdr http.Header
+	for attempt := 0; ; attempt++ {
+		resp, err := c.downloadRequest(ctx, path, d.written, hdr)
+		if err != nil {
+			return hdr, d.written, err
+		}
+		if hdr == nil {
+			hdr = resp.Header
+		}
+
+		done, err := d.read(resp)
+		resp.Body.Close()
+		if done || d.writeErr != nil {
+			return hdr, d.written, err
+		}
+		if attempt >= o.resumes || ctx.Err() != nil {
+			if err == nil {
+				err = errors.Errorf("incomplete download: %d of %d bytes", d.written, d.total)
+			}
+			return hdr, d.written, err
+		}
+		logger.ContextKV(ctx, xlog.WARNING,
+			"client", c.Name,
+			"reason", "resume",
+			"path", c.redactor.Query(path),
+			"written", d.written,
+			"total", d.total,
+			"err", err)
+	}
+}
+
+// downloadRequest sends GET request, with Range if offset is specified
+func (c *Client) downloadRequest(ctx context.Context, path string, offset int64, first http.Header) (*http.Response, error) {
+	host := c.CurrentHost()
+	if host == "" {
+		return nil, errors.Errorf("invalid parameter: host")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, host+path, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if offset > 0 {
+		req.Header.Set(header.Range, fmt.Sprintf("bytes=%d-", offset))
+		if first != nil {
+			if v := first.Get(header.ETag); v != "" && !strings.HasPrefix(v, "W/") {
+				req.Header.Set(header.IfRange, v)
+			} else if v := first.Get(header.LastModified); v != "" {
+				req.Header.Set(header.IfRange, v)
+			}
+		}
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if c.nonceProvider != nil {
+		c.nonceProvider.SetFromHeader(resp.Header)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK && offset > 0:
+		resp.Body.Close()
+		return nil, errors.Errorf("server does not support range requests, or the content was modified")
+	case resp.StatusCode == http.StatusOK, resp.StatusCode == http.StatusPartialContent:
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	_, status, err := c.DecodeResponse(resp, io.Discard)
+	if err == nil {
+		err = errors.Errorf("unexpected status: %d", status)
+	}
+	return nil, err
+}
+
+// download keeps the state of the download
+type download struct {
+	w        io.Writer
+	written  int64
+	total    int64
+	progress ProgressFunc
+	md5      hash.Hash
+	expected []byte
+	writeErr error
+}
+
+// read copies the response body, and returns true if the download is complete
+func (d *download) read(resp *http.Response) (bool, error) {
+	if resp.StatusCode == http.StatusPartialContent {
+		start, total, err := parseContentRange(resp.Header.Get(header.ContentRange))
+		if err != nil {
+			return true, err
+		}
+		if start != d.written {
+			return true, errors.Errorf("unexpected range start: %d, expected %d", start, d.written)
+		}
+		d.total = total
+	} else {
+		d.total = resp.ContentLength
+		if d.md5 != nil {
+			if v := resp.Header.Get(header.ContentMD5); v != "" {
+				expected, err := base64.StdEncoding.DecodeString(v)
+				if err != nil {
+					return true, errors.Errorf("invalid Content-MD5: %s", v)
+				}
+				d.expected = expected
+			}
+		}
+	}
+
+	_, err := io.Copy(d, resp.Body)
+	if d.writeErr != nil {
+		return true, d.writeErr
+	}
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	if d.total >= 0 && d.written != d.total {
+		return false, nil
+	}
+	if d.total < 0 && resp.StatusCode == http.StatusOK {
+		d.total = d.written
+	}
+	return true, d.verify()
+}
+
+// Write writes the data to the writer, and reports the progress
+func (d *download) Write(p []byte) (int, error) {
+	n, err := d.w.Write(p)
+	d.written += int64(n)
+	if d.md5 != nil {
+		d.md5.Write(p[:n])
+	}
+	if err != nil {
+		d.writeErr = errors.WithMessage(err, "unable to write downloaded data")
+		return n, d.writeErr
+	}
+	if d.progress != nil {
+		d.progress(d.written, d.total)
+	}
+	return n, nil
+}
+
+func (d *download) verify() error {
+	if d.md5 == nil || d.expected == nil {
+		return nil
+	}
+	if actual := d.md5.Sum(nil); !bytes.Equal(actual, d.expected) {
+		return errors.Errorf("Content-MD5 mismatch: expected %s, actual %s",
+			base64.StdEncoding.EncodeToString(d.expected),
+			base64.StdEncoding.EncodeToString(actual))
+	}
+	return nil
+}
+
+// parseContentRange parses "bytes start-end/total" value,
+// total is -1 if unknown
+func parseContentRange(val string) (int64, int64, error) {
+	rng, ok := strings.CutPrefix(val, "bytes ")
+	if !ok {
+		return 0, 0, errors.Errorf("invalid Content-Range: %q", val)
+	}
+	rng, size, ok := strings.Cut(rng, "/")
+	if !ok {
+		return 0, 0, errors.Errorf("invalid Content-Range: %q", val)
+	}
+	startStr, _, ok := strings.Cut(rng, "-")
+	if !ok {
+		return 0, 0, errors.Errorf("invalid Content-Range: %q", val)
+	}
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil {
+		return 0, 0, errors.Errorf("invalid Content-Range: %q", val)
+	}
+	total := int64(-1)
+	if size != "*" {
+		if total, err = strconv.ParseInt(size, 10, 64); err != nil {
+			return 0, 0, errors.Errorf("invalid Content-Range: %q", val)
+		}
+	}
+	return start, total, nil
+}
@@ -0,0 +1,164 @@
+package retriable_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/porto/xhttp/marshal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// truncatedWriter aborts the response after limit bytes
+type truncatedWriter struct {
+	http.ResponseWriter
+	limit int
+}
+
+func (w *truncatedWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		n, _ := w.ResponseWriter.Write(p[:w.limit])
+		w.limit -= n
+		w.ResponseWriter.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.limit -= n
+	return n, err
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestDownload(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	sum := md5.Sum(content)
+	contentMD5 := base64.StdEncoding.EncodeToString(sum[:])
+
+	var requests, failures atomic.Int32
+	md5Header := contentMD5
+	mux := http.NewServeMux()
+	mux.HandleFunc("/file", func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		w.Header().Set(header.ETag, `"v1"`)
+		w.Header().Set(header.ContentMD5, md5Header)
+		if n <= failures.Load() {
+			w = &truncatedWriter{ResponseWriter: w, limit: 10000}
+		}
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+	})
+	mux.HandleFunc("/norange", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set(header.ContentLength, "65536")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(content[:1000])
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		marshal.WriteJSON(w, r, httperror.NotFound("file not found"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := retriable.New(retriable.ClientConfig{Host: server.URL})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	t.Run("full", func(t *testing.T) {
+		requests.Store(0)
+		failures.Store(0)
+		var buf bytes.Buffer
+		var progress, total int64
+		hdr, n, err := client.Download(ctx, "/file", &buf, retriable.WithProgress(func(w, t int64) {
+			progress, total = w, t
+		}))
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), n)
+		assert.Equal(t, content, buf.Bytes())
+		assert.Equal(t, `"v1"`, hdr.Get(header.ETag))
+		assert.Equal(t, n, progress)
+		assert.Equal(t, n, total)
+		assert.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		requests.Store(0)
+		failures.Store(2)
+		var buf bytes.Buffer
+		_, n, err := client.Download(ctx, "/file", &buf)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), n)
+		assert.Equal(t, content, buf.Bytes())
+		assert.Equal(t, int32(3), requests.Load())
+	})
+
+	t.Run("resume_limit", func(t *testing.T) {
+		requests.Store(0)
+		failures.Store(10)
+		var buf bytes.Buffer
+		_, n, err := client.Download(ctx, "/file", &buf, retriable.WithResumes(1))
+		require.Error(t, err)
+		assert.Equal(t, int64(buf.Len()), n)
+		assert.Less(t, n, int64(len(content)))
+		assert.Equal(t, int32(2), requests.Load())
+	})
+
+	t.Run("offset", func(t *testing.T) {
+		requests.Store(0)
+		failures.Store(0)
+		var buf bytes.Buffer
+		_, n, err := client.Download(ctx, "/file", &buf, retriable.WithOffset(1000))
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), n)
+		assert.Equal(t, content[1000:], buf.Bytes())
+	})
+
+	t.Run("md5_mismatch", func(t *testing.T) {
+		failures.Store(0)
+		md5Header = base64.StdEncoding.EncodeToString(make([]byte, 16))
+		defer func() { md5Header = contentMD5 }()
+		var buf bytes.Buffer
+		_, _, err := client.Download(ctx, "/file", &buf)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Content-MD5 mismatch")
+	})
+
+	t.Run("no_range", func(t *testing.T) {
+		requests.Store(0)
+		var buf bytes.Buffer
+		_, n, err := client.Download(ctx, "/norange", &buf)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "server does not support range requests")
+		assert.Equal(t, int64(1000), n)
+		assert.Equal(t, int32(2), requests.Load())
+	})
+
+	t.Run("write_error", func(t *testing.T) {
+		requests.Store(0)
+		failures.Store(0)
+		_, _, err := client.Download(ctx, "/file", failingWriter{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "disk full")
+		assert.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("not_found", func(t *testing.T) {
+		var buf bytes.Buffer
+		_, _, err := client.Download(ctx, "/missing", &buf)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "file not found")
+	})
+}
@@ -0,0 +1,114 @@
+package retriable
+
+import (
+	"net/http"
+	"time"
+)
+
+// RequestStartEvent is sent before the first attempt of the request
+type RequestStartEvent struct {
+	// Client is the name of the client
+	Client  string
+	Request *http.Request
+}
+
+// AttemptEvent is sent after each attempt of the request
+type AttemptEvent struct {
+	Client  string
+	Request *http.Request
+	// Attempt is zero based number of the attempt
+	Attempt int
+	// StatusCode of the response, or zero on error
+	StatusCode int
+	Err        error
+	Elapsed    time.Duration
+}
+
+// RetryScheduledEvent is sent when the retry is scheduled
+type RetryScheduledEvent struct {
+	Client  string
+	Request *http.Request
+	// Attempt is zero based number of the failed attempt
+	Attempt    int
+	StatusCode int
+	Err        error
+	// Reason of the retry, as returned by ShouldRetry
+	Reason string
+	// Delay before the next attempt
+	Delay time.Duration
+}
+
+// ResponseEvent is sent when the request completed with a response
+type ResponseEvent struct {
+	Client   string
+	Request  *http.Request
+	Response *http.Response
+	// Attempts is the total number of attempts
+	Attempts int
+	// Elapsed is the total time of the request
+	Elapsed time.Duration
+}
+
+// ErrorEvent is sent when the request failed
+type ErrorEvent struct {
+	Client   string
+	Request  *http.Request
+	Err      error
+	Attempts int
+	Elapsed  time.Duration
+}
+
+// EventListener receives the events of the request lifecycle.
+// The callbacks are called synchronously, and must not block.
+type EventListener interface {
+	OnRequestStart(e *RequestStartEvent)
+	OnAttempt(e *AttemptEvent)
+	OnRetryScheduled(e *RetryScheduledEvent)
+	OnResponse(e *ResponseEvent)
+	OnError(e *ErrorEvent)
+}
+
+// NopEventListener provides no-op EventListener,
+// to be embedded by listeners that handle only some of the events
+type NopEventListener struct{}
+
+// OnRequestStart is no-op
+func (NopEventListener) OnRequestStart(*RequestStartEvent) {}
+
+// OnAttempt is no-op
+func (NopEventListener) OnAttempt(*AttemptEvent) {}
+
+// OnRetryScheduled is no-op
+func (NopEventListener) OnRetryScheduled(*RetryScheduledEvent) {}
+
+// OnResponse is no-op
+func (NopEventListener) OnResponse(*ResponseEvent) {}
+
+// OnError is no-op
+func (NopEventListener) OnError(*ErrorEvent) {}
+
+// WithEventListener is a ClientOption that adds the event listeners
+func WithEventListener(listeners ...EventListener) ClientOption {
+	return optionFunc(func(c *Client) {
+		c.WithEventListener(listeners...)
+	})
+}
+
+// WithEventListener adds the event listeners
+func (c *Client) WithEventListener(listeners ...EventListener) *Client {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, l := range listeners {
+		if l != nil {
+			c.listeners = append(c.listeners, l)
+		}
+	}
+	return c
+}
+
+func statusCode(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
@@ -0,0 +1,103 @@
+package retriable_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	lock   sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(format string, args ...any) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) OnRequestStart(e *retriable.RequestStartEvent) {
+	r.add("start %s %s", e.Client, e.Request.Method)
+}
+
+func (r *recorder) OnAttempt(e *retriable.AttemptEvent) {
+	r.add("attempt %d %d %t", e.Attempt, e.StatusCode, e.Err != nil)
+}
+
+func (r *recorder) OnRetryScheduled(e *retriable.RetryScheduledEvent) {
+	r.add("retry %d %d %s %v", e.Attempt, e.StatusCode, e.Reason, e.Delay)
+}
+
+func (r *recorder) OnResponse(e *retriable.ResponseEvent) {
+	r.add("response %d %d", e.Response.StatusCode, e.Attempts)
+}
+
+func (r *recorder) OnError(e *retriable.ErrorEvent) {
+	r.add("error %d", e.Attempts)
+}
+
+type errorsOnly struct {
+	retriable.NopEventListener
+	count int32
+}
+
+func (l *errorsOnly) OnError(e *retriable.ErrorEvent) {
+	atomic.AddInt32(&l.count, 1)
+}
+
+func TestEventListener(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	rec := &recorder{}
+	eo := &errorsOnly{}
+	client, err := retriable.New(retriable.ClientConfig{},
+		retriable.WithName("test"),
+		retriable.WithEventListener(rec, nil),
+		retriable.WithPolicy(retriable.Policy{
+			TotalRetryLimit: 2,
+			Retries: map[int]retriable.ShouldRetry{
+				http.StatusServiceUnavailable: retriable.DefaultShouldRetryFactory(2, time.Millisecond, "unavailable"),
+			},
+		}))
+	require.NoError(t, err)
+	client.WithEventListener(eo)
+
+	var res map[string]any
+	_, _, err = client.Request(context.Background(), http.MethodGet, server.URL, "/", nil, &res)
+	require.NoError(t, err)
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	_, _, err = client.Request(context.Background(), http.MethodGet, closed.URL, "/", nil, &res)
+	require.Error(t, err)
+
+	assert.Equal(t, []string{
+		"start test GET",
+		"attempt 0 503 false",
+		"retry 0 503 unavailable 1ms",
+		"attempt 1 200 false",
+		"response 200 2",
+		"start test GET",
+		"attempt 0 0 true",
+		"error 1",
+	}, rec.events)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&eo.count))
+}
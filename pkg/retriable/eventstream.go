@@ -0,0 +1,180 @@
+package retriable
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/effective-security/porto/x/backoff"
+	"github.com/effective-security/porto/xhttp/correlation"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+// ErrStopEventStream can be returned by EventHandler to close the stream,
+// in which case EventStream returns nil
+var ErrStopEventStream = errors.New("stop event stream")
+
+// EventHandler is called for each Server-Sent Event,
+// the event is "message" if not specified by the server.
+// Returning an error closes the stream.
+type EventHandler func(event, data string) error
+
+// eventStream is the state of the stream kept between the reconnects
+type eventStream struct {
+	lastEventID string
+	retry       time.Duration
+}
+
+// EventStream opens Server-Sent Events connection to the current host,
+// and calls the handler for each event until the context is cancelled,
+// or the handler returns an error.
+// When the connection is dropped, the stream is resumed with Last-Event-ID header,
+// with the delay and the number of attempts according to the retry policy,
+// or the delay requested by the server with `retry` field.
+// The request timeouts of the policy are not applied to the stream.
+func (c *Client) EventStream(ctx context.Context, path string, handler EventHandler, opts ...RequestOption) error {
+	host := c.CurrentHost()
+	if host == "" {
+		return errors.Errorf("invalid parameter: host")
+	}
+	ctx = c.withRequestOptions(ctx, opts)
+	ctx = correlation.WithID(ctx)
+
+	pol := *c.policy(ctx)
+	stream := pol
+	stream.RequestTimeout = 0
+	stream.PerAttemptTimeout = 0
+	ctx = c.withRequestOptions(ctx, []RequestOption{WithRetryPolicy(stream)})
+
+	s := &eventStream{}
+	for reconnects := 0; ; reconnects++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, host+path, nil)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		req.Header.Set(header.Accept, header.TextEventStream)
+		req.Header.Set(header.CacheControl, "no-cache")
+		if s.lastEventID != "" {
+			req.Header.Set(header.LastEventID, s.lastEventID)
+		}
+
+		received, done, err := c.readEventStream(req, s, handler)
+		if done {
+			if errors.Is(err, ErrStopEventStream) {
+				return nil
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return errors.WithStack(ctx.Err())
+		}
+		if err == nil {
+			err = io.EOF
+		}
+		if received {
+			reconnects = 0
+		}
+
+		retry, wait, reason := pol.ShouldRetry(req, nil, err, reconnects)
+		if !retry {
+			return errors.WithMessagef(err, "event stream closed: %s", reason)
+		}
+		if s.retry > 0 {
+			wait = s.retry
+		}
+		logger.ContextKV(ctx, xlog.WARNING,
+			"client", c.Name,
+			"reason", "reconnect",
+			"path", c.redactor.Query(path),
+			"last_event_id", s.lastEventID,
+			"sleep", wait,
+			"err", err.Error())
+
+		if err = backoff.Wait(ctx, wait); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+}
+
+// readEventStream reads the events until the connection is closed,
+// received is true if any event was dispatched,
+// done is true if the stream must not be resumed
+func (c *Client) readEventStream(req *http.Request, s *eventStream, handler EventHandler) (received bool, done bool, err error) {
+	resp, err := c.Do(req)
+	if err != nil {
+		return false, true, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNoContent:
+		// the server requested to stop reconnecting
+		return false, true, nil
+	case resp.StatusCode >= http.StatusBadRequest:
+		_, _, err = c.DecodeResponse(resp, nil)
+		return false, true, err
+	case resp.StatusCode != http.StatusOK:
+		return false, true, errors.Errorf("event stream: unexpected status: %s", resp.Status)
+	case !strings.HasPrefix(resp.Header.Get(header.ContentType), header.TextEventStream):
+		return false, true, errors.Errorf("event stream: unexpected content type: %q", resp.Header.Get(header.ContentType))
+	}
+
+	var event string
+	var data strings.Builder
+	// the id is applied when the event is complete
+	id := s.lastEventID
+	r := bufio.NewReader(resp.Body)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			// the incomplete event is discarded
+			return received, false, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			// dispatch the event
+			s.lastEventID = id
+			if data.Len() > 0 {
+				if event == "" {
+					event = "message"
+				}
+				received = true
+				if err = handler(event, strings.TrimSuffix(data.String(), "\n")); err != nil {
+					return received, true, err
+				}
+			}
+			event = ""
+			data.Reset()
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// comment, or keep-alive
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+		case "id":
+			if !strings.Contains(value, "\x00") {
+				id = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 32); err == nil {
+				s.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
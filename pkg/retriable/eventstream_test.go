@@ -0,0 +1,101 @@
+package retriable_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sseEvent struct {
+	event string
+	data  string
+}
+
+func TestEventStream(t *testing.T) {
+	var connects atomic.Int32
+	var lastEventID atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/done":
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case "/forbidden":
+			w.Header().Set(header.ContentType, header.ApplicationJSON)
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"code":"forbidden","message":"denied"}`))
+			return
+		case "/json":
+			w.Header().Set(header.ContentType, header.ApplicationJSON)
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+
+		assert.Equal(t, header.TextEventStream, r.Header.Get(header.Accept))
+		w.Header().Set(header.ContentType, header.TextEventStream)
+		if connects.Add(1) == 1 {
+			_, _ = w.Write([]byte(": keep-alive\n" +
+				"retry: 10\n\n" +
+				"id: 1\ndata: first\n\n" +
+				"id: 2\nevent: progress\ndata: line1\ndata:line2\r\n\r\n" +
+				"id: 3\ndata: incomplete"))
+			return
+		}
+		lastEventID.Store(r.Header.Get(header.LastEventID))
+		_, _ = w.Write([]byte("id: 3\nevent: done\ndata: {\"status\":\"ok\"}\n\n"))
+	}))
+	defer server.Close()
+
+	client, err := retriable.New(retriable.ClientConfig{Host: server.URL})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	var events []sseEvent
+	err = client.EventStream(ctx, "/v1/progress", func(event, data string) error {
+		events = append(events, sseEvent{event, data})
+		if event == "done" {
+			return retriable.ErrStopEventStream
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), connects.Load())
+	assert.Equal(t, "2", lastEventID.Load())
+	assert.Equal(t, []sseEvent{
+		{"message", "first"},
+		{"progress", "line1\nline2"},
+		{"done", `{"status":"ok"}`},
+	}, events)
+
+	// handler error
+	connects.Store(0)
+	err = client.EventStream(ctx, "/v1/progress", func(string, string) error {
+		return errors.New("handler failed")
+	})
+	assert.EqualError(t, err, "handler failed")
+
+	noop := func(string, string) error { return nil }
+	assert.NoError(t, client.EventStream(ctx, "/done", noop))
+
+	err = client.EventStream(ctx, "/forbidden", noop)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "denied")
+
+	err = client.EventStream(ctx, "/json", noop)
+	assert.EqualError(t, err, `event stream: unexpected content type: "application/json"`)
+
+	cctx, cancel := context.WithCancel(ctx)
+	connects.Store(0)
+	err = client.EventStream(cctx, "/v1/progress", func(string, string) error {
+		cancel()
+		return nil
+	})
+	assert.True(t, errors.Is(err, context.Canceled))
+}
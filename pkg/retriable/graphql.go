@@ -0,0 +1,196 @@
+package retriable
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/pkg/errors"
+)
+
+// DefaultGraphQLPath specifies the default path of GraphQL endpoint
+const DefaultGraphQLPath = "/graphql"
+
+// GraphQLRequest defines GraphQL request payload
+type GraphQLRequest struct {
+	Query         string         `json:"query,omitempty"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+	Extensions    map[string]any `json:"extensions,omitempty"`
+}
+
+// GraphQLLocation defines location of the error in GraphQL document
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// GraphQLError defines an error returned by GraphQL server
+type GraphQLError struct {
+	Message    string            `json:"message"`
+	Path       []any             `json:"path,omitempty"`
+	Locations  []GraphQLLocation `json:"locations,omitempty"`
+	Extensions map[string]any    `json:"extensions,omitempty"`
+}
+
+// GraphQLResponse defines GraphQL response payload
+type GraphQLResponse struct {
+	Data   json.RawMessage `json:"data,omitempty"`
+	Errors []GraphQLError  `json:"errors,omitempty"`
+}
+
+const persistedQueryNotFound = "PersistedQueryNotFound"
+
+// WithGraphQL is a ClientOption that specifies the GraphQL endpoint path,
+// and enables Automatic Persisted Queries if persisted is true.
+//
+//	retriable.New(retriable.WithGraphQL("/v1/graphql", true))
+func WithGraphQL(path string, persisted bool) ClientOption {
+	return optionFunc(func(c *Client) {
+		c.WithGraphQL(path, persisted)
+	})
+}
+
+// WithGraphQL modifies the GraphQL endpoint path,
+// and enables Automatic Persisted Queries if persisted is true.
+func (c *Client) WithGraphQL(path string, persisted bool) *Client {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.graphQLPath = path
+	c.graphQLPersisted = persisted
+	return c
+}
+
+// Query executes GraphQL query, and decodes the data into result.
+// GraphQL errors are returned as *httperror.ManyError,
+// in which case the result may contain partial data.
+// The retry policy is applied only for transport-level failures,
+// errors returned by GraphQL server are not retried.
+func (c *Client) Query(ctx context.Context, query string, variables map[string]any, result any) error {
+	return c.GraphQL(ctx, &GraphQLRequest{
+		Query:     query,
+		Variables: variables,
+	}, result)
+}
+
+// Mutate executes GraphQL mutation, and decodes the data into result.
+// See Query for the error handling.
+func (c *Client) Mutate(ctx context.Context, mutation string, variables map[string]any, result any) error {
+	return c.GraphQL(ctx, &GraphQLRequest{
+		Query:     mutation,
+		Variables: variables,
+	}, result)
+}
+
+// GraphQL executes GraphQL request, and decodes the data into result.
+func (c *Client) GraphQL(ctx context.Context, req *GraphQLRequest, result any) error {
+	c.lock.RLock()
+	path := c.graphQLPath
+	persisted := c.graphQLPersisted
+	c.lock.RUnlock()
+
+	if path == "" {
+		path = DefaultGraphQLPath
+	}
+
+	var res *GraphQLResponse
+	var err error
+	if persisted && req.Query != "" {
+		h := sha256.Sum256([]byte(req.Query))
+		apq := &GraphQLRequest{
+			OperationName: req.OperationName,
+			Variables:     req.Variables,
+			Extensions:    map[string]any{},
+		}
+		for k, v := range req.Extensions {
+			apq.Extensions[k] = v
+		}
+		apq.Extensions["persistedQuery"] = map[string]any{
+			"version":    1,
+			"sha256Hash": hex.EncodeToString(h[:]),
+		}
+
+		res, err = c.postGraphQL(ctx, path, apq)
+		if err != nil {
+			return err
+		}
+		if isPersistedQueryNotFound(res.Errors) {
+			// register the query with the server
+			apq.Query = req.Query
+			res, err = c.postGraphQL(ctx, path, apq)
+		}
+	} else {
+		res, err = c.postGraphQL(ctx, path, req)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(res.Data) > 0 && string(res.Data) != "null" && result != nil {
+		d := json.NewDecoder(strings.NewReader(string(res.Data)))
+		d.UseNumber()
+		if err := d.Decode(result); err != nil {
+			return errors.WithMessagef(err, "unable to decode GraphQL data to (%T) type", result)
+		}
+	}
+
+	if len(res.Errors) > 0 {
+		return GraphQLErrors(res.Errors)
+	}
+	return nil
+}
+
+func (c *Client) postGraphQL(ctx context.Context, path string, req *GraphQLRequest) (*GraphQLResponse, error) {
+	res := new(GraphQLResponse)
+	_, _, err := c.Request(ctx, http.MethodPost, c.CurrentHost(), path, req, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func isPersistedQueryNotFound(errs []GraphQLError) bool {
+	for _, e := range errs {
+		if e.Message == persistedQueryNotFound ||
+			e.Extensions["code"] == "PERSISTED_QUERY_NOT_FOUND" {
+			return true
+		}
+	}
+	return false
+}
+
+// GraphQLErrors maps GraphQL errors into httperror.ManyError,
+// the errors are keyed by the path, or by the index if the path is not provided.
+// The code of the error is taken from `extensions.code`, if provided.
+func GraphQLErrors(errs []GraphQLError) *httperror.ManyError {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	many := httperror.NewMany(http.StatusBadRequest, httperror.CodeRequestFailed, "%s", errs[0].Message)
+	for i, ge := range errs {
+		code := httperror.CodeRequestFailed
+		if c, ok := ge.Extensions["code"].(string); ok && c != "" {
+			code = strings.ToLower(c)
+		}
+
+		key := fmt.Sprintf("%d", i)
+		if len(ge.Path) > 0 {
+			var parts []string
+			for _, p := range ge.Path {
+				parts = append(parts, fmt.Sprint(p))
+			}
+			key = strings.Join(parts, ".")
+		}
+		if _, exists := many.Errors[key]; exists {
+			key = fmt.Sprintf("%s#%d", key, i)
+		}
+		many.Add(key, httperror.New(http.StatusBadRequest, code, "%s", ge.Message))
+	}
+	return many
+}
@@ -0,0 +1,103 @@
+package retriable_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type gqlResult struct {
+	User struct {
+		Name string `json:"name"`
+	} `json:"user"`
+}
+
+func TestGraphQL(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, retriable.DefaultGraphQLPath, r.URL.Path)
+
+		var req retriable.GraphQLRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		w.Header().Set("Content-Type", "application/json")
+		switch req.Variables["id"] {
+		case "1":
+			_, _ = w.Write([]byte(`{"data":{"user":{"name":"alice"}}}`))
+		case "2":
+			_, _ = w.Write([]byte(`{"data":{"user":null},"errors":[
+				{"message":"user not found","path":["user"],"extensions":{"code":"NOT_FOUND"}},
+				{"message":"second"}
+			]}`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(h))
+	defer server.Close()
+
+	client, err := retriable.Default(server.URL)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	var res gqlResult
+	err = client.Query(ctx, `query($id: ID!) { user(id: $id) { name } }`, map[string]any{"id": "1"}, &res)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", res.User.Name)
+
+	err = client.Mutate(ctx, `mutation($id: ID!) { deleteUser(id: $id) { name } }`, map[string]any{"id": "2"}, &res)
+	require.Error(t, err)
+	many, ok := err.(*httperror.ManyError)
+	require.True(t, ok, "%T", err)
+	assert.Equal(t, "user not found", many.Message)
+	require.Len(t, many.Errors, 2)
+	assert.Equal(t, httperror.CodeNotFound, many.Errors["user"].Code)
+	assert.Equal(t, httperror.CodeRequestFailed, many.Errors["1"].Code)
+
+	client.WithPolicy(retriable.Policy{TotalRetryLimit: 0})
+	err = client.Query(ctx, `query { user { name } }`, map[string]any{"id": "3"}, &res)
+	require.Error(t, err)
+}
+
+func TestGraphQLPersistedQuery(t *testing.T) {
+	var calls, registered int32
+	h := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		assert.Equal(t, "/v1/graphql", r.URL.Path)
+
+		var req retriable.GraphQLRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.NotNil(t, req.Extensions["persistedQuery"])
+
+		w.Header().Set("Content-Type", "application/json")
+		if req.Query == "" && atomic.LoadInt32(&registered) == 0 {
+			_, _ = w.Write([]byte(`{"errors":[{"message":"PersistedQueryNotFound"}]}`))
+			return
+		}
+		atomic.StoreInt32(&registered, 1)
+		_, _ = w.Write([]byte(`{"data":{"user":{"name":"bob"}}}`))
+	}
+	server := httptest.NewServer(http.HandlerFunc(h))
+	defer server.Close()
+
+	client, err := retriable.New(retriable.ClientConfig{Host: server.URL},
+		retriable.WithGraphQL("/v1/graphql", true))
+	require.NoError(t, err)
+
+	var res gqlResult
+	query := `query { user { name } }`
+	require.NoError(t, client.Query(context.Background(), query, nil, &res))
+	assert.Equal(t, "bob", res.User.Name)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	require.NoError(t, client.Query(context.Background(), query, nil, &res))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,194 @@
+package retriable
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/effective-security/porto/metricskey"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+// contextValueForHedgeDelay specifies context value name
+// for per-request override of Policy.HedgeDelay
+const contextValueForHedgeDelay = contextValueName("HedgeDelay")
+
+// WithHedgeDelay returns context that overrides Policy.HedgeDelay
+// for the request, zero delay disables the hedging
+func WithHedgeDelay(ctx context.Context, delay time.Duration) context.Context {
+	return context.WithValue(ctx, contextValueForHedgeDelay, delay)
+}
+
+// hedgeDelay returns the hedge delay for the request
+func (c *Client) hedgeDelay(r *http.Request) time.Duration {
+	if d, ok := r.Context().Value(contextValueForHedgeDelay).(time.Duration); ok {
+		return d
+	}
+	return c.policy(r.Context()).HedgeDelay
+}
+
+// canHedge returns true if the duplicate requests can be sent:
+// hedging is enabled, the request is idempotent and its body can be rewound
+func (c *Client) canHedge(req *Request) bool {
+	return c.hedgeDelay(req.Request) > 0 &&
+		IsIdempotent(req.Request) &&
+		req.Request.Header.Get(header.Upgrade) == "" &&
+		(req.body != nil || req.Request.Body == nil || req.Request.Body == http.NoBody)
+}
+
+type hedgeResult struct {
+	hedge  int
+	resp   *http.Response
+	err    error
+	cancel context.CancelFunc
+}
+
+// succeeded returns true if the result can be used as the response,
+// server errors are superseded by the response of other in-flight hedges
+func (h *hedgeResult) succeeded() bool {
+	return h.err == nil && h.resp.StatusCode < http.StatusInternalServerError
+}
+
+// discard releases the resources of the result
+func (h *hedgeResult) discard() {
+	if h.resp != nil && h.resp.Body != nil {
+		_, _ = io.Copy(io.Discard, h.resp.Body)
+		_ = h.resp.Body.Close()
+	}
+	h.cancel()
+}
+
+// response returns the response and error of the result,
+// the hedge context is cancelled when the body is closed
+func (h *hedgeResult) response() (*http.Response, error) {
+	if h.resp != nil && h.resp.Body != nil {
+		h.resp.Body = &cancelBody{ReadCloser: h.resp.Body, cancel: []context.CancelFunc{h.cancel}}
+	} else {
+		h.cancel()
+	}
+	return h.resp, h.err
+}
+
+// hedgedRoundTrip sends the request, and the duplicate requests
+// after HedgeDelay without a response, up to MaxHedges.
+// The first successful response is returned, and the other requests are cancelled.
+// The duplicate requests are withdrawn from the retry budget.
+// Each request is sent with the client for its host, so the per-host TLS
+// configuration applies to Policy.HedgeHosts.
+func (c *Client) hedgedRoundTrip(middlewares []Middleware, req *Request) (*http.Response, error) {
+	delay := c.hedgeDelay(req.Request)
+	maxHedges := c.policy(req.Request.Context()).MaxHedges
+	if maxHedges <= 0 {
+		maxHedges = 1
+	}
+
+	// the body reader is shared by the request copies,
+	// so the payload is read once for concurrent requests
+	var payload []byte
+	if req.body != nil {
+		body, err := req.body()
+		if err != nil {
+			return nil, err
+		}
+		if payload, err = io.ReadAll(body); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	parent := req.Request.Context()
+	results := make(chan *hedgeResult, maxHedges+1)
+	launch := func(hedge int, r *http.Request) {
+		ctx, cancel := context.WithCancel(parent)
+		r = r.WithContext(ctx)
+		roundTrip := roundTripChain(c.clientFor(r).Do, middlewares)
+		go func() {
+			resp, err := roundTrip(r)
+			results <- &hedgeResult{hedge: hedge, resp: resp, err: err, cancel: cancel}
+		}()
+	}
+
+	first, err := c.hedgeRequest(req, payload, 0)
+	if err != nil {
+		return nil, err
+	}
+	launch(0, first)
+	launched, inflight := 1, 1
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var last *hedgeResult
+	for inflight > 0 {
+		select {
+		case res := <-results:
+			inflight--
+			if res.succeeded() {
+				if res.hedge > 0 {
+					metricskey.HTTPHedge.IncrCounter(1, c.Name, "won")
+				}
+				if last != nil {
+					last.discard()
+				}
+				// cancel the losers in background
+				go func(n int) {
+					for ; n > 0; n-- {
+						(<-results).discard()
+					}
+				}(inflight)
+				return res.response()
+			}
+			if last != nil {
+				last.discard()
+			}
+			last = res
+		case <-timer.C:
+			if launched > maxHedges || !c.withdrawRetry() {
+				continue
+			}
+			r, err := c.hedgeRequest(req, payload, launched)
+			if err != nil {
+				logger.ContextKV(parent, xlog.WARNING,
+					"client", c.Name,
+					"reason", "hedge",
+					"err", err.Error())
+				continue
+			}
+			logger.ContextKV(parent, xlog.DEBUG,
+				"client", c.Name,
+				"hedge", launched,
+				"host", r.URL.Host,
+				"delay", delay)
+			metricskey.HTTPHedge.IncrCounter(1, c.Name, "sent")
+			launch(launched, r)
+			launched++
+			inflight++
+			timer.Reset(delay)
+		}
+	}
+	return last.response()
+}
+
+// hedgeRequest returns the copy of the request for the hedge,
+// with the payload, and the host from Policy.HedgeHosts for the duplicate requests
+func (c *Client) hedgeRequest(req *Request, payload []byte, hedge int) (*http.Request, error) {
+	r := req.Request.Clone(req.Request.Context())
+	if req.body != nil {
+		r.Body = io.NopCloser(bytes.NewReader(payload))
+	}
+
+	if hosts := c.policy(req.Request.Context()).HedgeHosts; hedge > 0 && len(hosts) > 0 {
+		u, err := url.Parse(hosts[(hedge-1)%len(hosts)])
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		r.URL.Scheme = u.Scheme
+		r.URL.Host = u.Host
+		r.Host = ""
+	}
+	return r, nil
+}
@@ -0,0 +1,169 @@
+package retriable_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHedge(t *testing.T) {
+	var count, cancelled atomic.Int32
+	// the first request is slow, the duplicate is fast
+	handler := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if count.Add(1) == 1 {
+				select {
+				case <-r.Context().Done():
+					cancelled.Add(1)
+					return
+				case <-time.After(5 * time.Second):
+				}
+			}
+			w.Header().Set(header.ContentType, header.ApplicationJSON)
+			_, _ = w.Write([]byte(`{"server":"` + name + `","body":"` + string(body) + `"}`))
+		}
+	}
+	primary := httptest.NewServer(handler("primary"))
+	defer primary.Close()
+	secondary := httptest.NewServer(handler("secondary"))
+	defer secondary.Close()
+
+	type result struct {
+		Server string `json:"server"`
+		Body   string `json:"body"`
+	}
+
+	client, err := retriable.New(retriable.ClientConfig{
+		Host: primary.URL,
+		Request: &retriable.RequestPolicy{
+			RetryLimit: 1,
+			HedgeDelay: 20 * time.Millisecond,
+		},
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	reset := func() {
+		count.Store(0)
+		cancelled.Store(0)
+	}
+
+	t.Run("same_host", func(t *testing.T) {
+		reset()
+		var res result
+		started := time.Now()
+		_, status, err := client.Get(ctx, "/", &res)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "primary", res.Server)
+		assert.Less(t, time.Since(started), 2*time.Second)
+		assert.Equal(t, int32(2), count.Load())
+		assert.Eventually(t, func() bool { return cancelled.Load() == 1 }, 2*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("body", func(t *testing.T) {
+		reset()
+		var res result
+		_, _, err := client.Request(ctx, http.MethodPut, primary.URL, "/", strings.NewReader("payload"), &res)
+		require.NoError(t, err)
+		assert.Equal(t, "payload", res.Body)
+		assert.Equal(t, int32(2), count.Load())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		reset()
+		var res result
+		hctx, cancel := context.WithTimeout(retriable.WithHedgeDelay(ctx, 0), 200*time.Millisecond)
+		defer cancel()
+		_, _, err := client.Get(hctx, "/", &res)
+		require.Error(t, err)
+		assert.Equal(t, int32(1), count.Load())
+	})
+
+	t.Run("non_idempotent", func(t *testing.T) {
+		reset()
+		var res result
+		pctx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancel()
+		_, _, err := client.Post(pctx, "/", []byte("{}"), &res)
+		require.Error(t, err)
+		assert.Equal(t, int32(1), count.Load())
+	})
+
+	t.Run("secondary_host", func(t *testing.T) {
+		pol := client.Policy
+		pol.HedgeHosts = []string{secondary.URL}
+		hc, err := retriable.New(retriable.ClientConfig{Host: primary.URL}, retriable.WithPolicy(pol))
+		require.NoError(t, err)
+
+		reset()
+		var res result
+		_, _, err = hc.Get(ctx, "/", &res)
+		require.NoError(t, err)
+		assert.Equal(t, "secondary", res.Server)
+	})
+
+	t.Run("secondary_host_tls", func(t *testing.T) {
+		secure := httptest.NewTLSServer(handler("secure"))
+		defer secure.Close()
+		roots := x509.NewCertPool()
+		roots.AddCert(secure.Certificate())
+
+		pol := client.Policy
+		pol.HedgeHosts = []string{secure.URL}
+		hc, err := retriable.New(retriable.ClientConfig{Host: primary.URL},
+			retriable.WithPolicy(pol),
+			retriable.WithHostTLS(secure.URL, &tls.Config{RootCAs: roots}),
+		)
+		require.NoError(t, err)
+
+		reset()
+		var res result
+		_, _, err = hc.Get(ctx, "/", &res)
+		require.NoError(t, err)
+		assert.Equal(t, "secure", res.Server)
+	})
+}
+
+func TestHedge_ServerError(t *testing.T) {
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := count.Add(1)
+		if n == 1 {
+			// the slow request wins over the failed duplicate
+			time.Sleep(100 * time.Millisecond)
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client, err := retriable.New(retriable.ClientConfig{
+		Host: server.URL,
+		Request: &retriable.RequestPolicy{
+			HedgeDelay: 10 * time.Millisecond,
+			MaxHedges:  2,
+		},
+	})
+	require.NoError(t, err)
+
+	var res map[string]any
+	_, status, err := client.Get(context.Background(), "/", &res)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int32(3), count.Load())
+}
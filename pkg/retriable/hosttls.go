@@ -0,0 +1,141 @@
+package retriable
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/effective-security/xlog"
+)
+
+// contextValueForServerName specifies context value name for SNI override
+const contextValueForServerName = contextValueName("ServerName")
+
+// WithHostTLS is a ClientOption that specifies TLS configuration
+// for the requests to the host.
+//
+//	retriable.New(retriable.WithHostTLS("https://lab.local:8443", t))
+//
+// The host can be in host[:port] or URL format.
+func WithHostTLS(host string, tlsConfig *tls.Config) ClientOption {
+	return optionFunc(func(c *Client) {
+		c.WithHostTLS(host, tlsConfig)
+	})
+}
+
+// WithHostTLS sets TLS configuration for the requests to the host.
+// The host can be in host[:port] or URL format.
+func (c *Client) WithHostTLS(host string, tlsConfig *tls.Config) *Client {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.hostTLS == nil {
+		c.hostTLS = map[string]*tls.Config{}
+	}
+	c.hostTLS[hostKey(host)] = tlsConfig
+	// reset the cached clients
+	c.hostClients = nil
+	return c
+}
+
+// WithServerName returns the context with server name,
+// that overrides SNI and the name for certificate verification for the request
+func WithServerName(ctx context.Context, serverName string) context.Context {
+	return context.WithValue(ctx, contextValueForServerName, serverName)
+}
+
+// hostKey returns host[:port] of the host in URL format
+func hostKey(host string) string {
+	if strings.Contains(host, "://") {
+		if u, err := url.Parse(host); err == nil {
+			return strings.ToLower(u.Host)
+		}
+	}
+	return strings.ToLower(host)
+}
+
+// clientFor returns http.Client for the request,
+// with per-host TLS configuration and SNI override applied
+func (c *Client) clientFor(r *http.Request) *http.Client {
+	serverName, _ := r.Context().Value(contextValueForServerName).(string)
+
+	host := strings.ToLower(r.URL.Host)
+	key := host + "|" + serverName
+
+	// fast path for the hosts without TLS configuration, or with the cached client
+	c.lock.RLock()
+	_, ok := c.lookupHostTLS(host)
+	if !ok && serverName == "" {
+		c.lock.RUnlock()
+		return c.httpClient
+	}
+	hc := c.hostClients[key]
+	c.lock.RUnlock()
+	if hc != nil {
+		return hc
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// the configuration may be changed, or the client cached by another request
+	tlsConfig, ok := c.lookupHostTLS(host)
+	if !ok && serverName == "" {
+		return c.httpClient
+	}
+	if hc := c.hostClients[key]; hc != nil {
+		return hc
+	}
+
+	var tr *http.Transport
+	switch t := c.httpClient.Transport.(type) {
+	case nil:
+		tr = http.DefaultTransport.(*http.Transport).Clone()
+		tr.MaxIdleConnsPerHost = 100
+		tr.MaxConnsPerHost = 100
+		tr.MaxIdleConns = 100
+	case *http.Transport:
+		tr = t.Clone()
+	default:
+		logger.KV(xlog.WARNING, "reason", "custom_transport", "host", host)
+		return c.httpClient
+	}
+
+	if tlsConfig != nil {
+		tr.TLSClientConfig = c.pinned(tlsConfig).Clone()
+	} else if tr.TLSClientConfig == nil {
+		tr.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if serverName != "" {
+		tr.TLSClientConfig.ServerName = serverName
+	}
+
+	hc = &http.Client{
+		Transport:     tr,
+		CheckRedirect: c.httpClient.CheckRedirect,
+		Jar:           c.httpClient.Jar,
+		Timeout:       c.httpClient.Timeout,
+	}
+	if c.hostClients == nil {
+		c.hostClients = map[string]*http.Client{}
+	}
+	c.hostClients[key] = hc
+
+	logger.KV(xlog.DEBUG, "reason", "host_transport", "host", host, "server_name", serverName)
+	return hc
+}
+
+// lookupHostTLS returns TLS configuration for the host[:port] or the hostname,
+// must be called under the lock
+func (c *Client) lookupHostTLS(host string) (*tls.Config, bool) {
+	tlsConfig, ok := c.hostTLS[host]
+	if !ok {
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			tlsConfig, ok = c.hostTLS[hostname]
+		}
+	}
+	return tlsConfig, ok
+}
@@ -0,0 +1,105 @@
+package retriable_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostTLS(t *testing.T) {
+	var lock sync.Mutex
+	var sni string
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		sni = r.TLS.ServerName
+		lock.Unlock()
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+
+	lastSNI := func() string {
+		lock.Lock()
+		defer lock.Unlock()
+		return sni
+	}
+
+	ctx := context.Background()
+	var res map[string]any
+
+	t.Run("default", func(t *testing.T) {
+		client, err := retriable.New(retriable.ClientConfig{}, retriable.WithPolicy(retriable.Policy{}))
+		require.NoError(t, err)
+		_, _, err = client.Request(ctx, http.MethodGet, ts.URL, "/", nil, &res)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "certificate")
+	})
+
+	t.Run("host", func(t *testing.T) {
+		client, err := retriable.New(retriable.ClientConfig{},
+			retriable.WithPolicy(retriable.Policy{}),
+			retriable.WithHostTLS(ts.URL, &tls.Config{RootCAs: roots}),
+		)
+		require.NoError(t, err)
+		_, status, err := client.Request(ctx, http.MethodGet, ts.URL, "/", nil, &res)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, status)
+
+		// SNI override per request
+		_, _, err = client.Request(retriable.WithServerName(ctx, "example.com"), http.MethodGet, ts.URL, "/", nil, &res)
+		require.NoError(t, err)
+		assert.Equal(t, "example.com", lastSNI())
+
+		_, _, err = client.Request(retriable.WithServerName(ctx, "other.com"), http.MethodGet, ts.URL, "/", nil, &res)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "other.com")
+	})
+
+	t.Run("config", func(t *testing.T) {
+		caFile := filepath.Join(t.TempDir(), "ca.pem")
+		require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0600))
+
+		client, err := retriable.New(retriable.ClientConfig{
+			HostTLS: map[string]*retriable.TLSInfo{
+				ts.Listener.Addr().String(): {
+					TrustedCAFile: caFile,
+					ServerName:    "example.com",
+				},
+			},
+		}, retriable.WithPolicy(retriable.Policy{}))
+		require.NoError(t, err)
+		_, _, err = client.Request(ctx, http.MethodGet, ts.URL, "/", nil, &res)
+		require.NoError(t, err)
+		assert.Equal(t, "example.com", lastSNI())
+
+		// lab host
+		client, err = retriable.New(retriable.ClientConfig{
+			HostTLS: map[string]*retriable.TLSInfo{
+				"127.0.0.1": {InsecureSkipVerify: true},
+			},
+		}, retriable.WithPolicy(retriable.Policy{}))
+		require.NoError(t, err)
+		_, _, err = client.Request(ctx, http.MethodGet, ts.URL, "/", nil, &res)
+		require.NoError(t, err)
+
+		_, err = retriable.New(retriable.ClientConfig{
+			HostTLS: map[string]*retriable.TLSInfo{
+				"lab": {TrustedCAFile: "/notfound/ca.pem"},
+			},
+		})
+		assert.EqualError(t, err, "host lab: failed to load TLS config: open /notfound/ca.pem: no such file or directory")
+	})
+}
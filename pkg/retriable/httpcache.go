@@ -0,0 +1,237 @@
+package retriable
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/xlog"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultResponseCacheSize specifies the default number of responses in the memory cache
+	DefaultResponseCacheSize = 1000
+	// MaxCachedResponseSize specifies the max size of the response body to cache
+	MaxCachedResponseSize = 10 * 1024 * 1024
+
+	responseCacheFolder = ".http_cache"
+)
+
+// X-Cache-Status values set on the responses served from the cache
+const (
+	CacheStatusHit  = "HIT"
+	CacheStatusMiss = "MISS"
+)
+
+// CachedResponse is the response stored in ResponseCache
+type CachedResponse struct {
+	StatusCode int         `json:"status"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+}
+
+// ResponseCache stores the responses of GET requests,
+// to be revalidated with If-None-Match and If-Modified-Since
+type ResponseCache interface {
+	// Get returns the cached response for the key
+	Get(key string) (*CachedResponse, bool)
+	// Set stores the response for the key
+	Set(key string, resp *CachedResponse)
+}
+
+type memoryResponseCache struct {
+	cache *lru.Cache[string, *CachedResponse]
+}
+
+// NewMemoryResponseCache returns ResponseCache in memory,
+// that stores up to size responses
+func NewMemoryResponseCache(size int) ResponseCache {
+	if size <= 0 {
+		size = DefaultResponseCacheSize
+	}
+	cache, _ := lru.New[string, *CachedResponse](size)
+	return &memoryResponseCache{cache: cache}
+}
+
+// Get returns the cached response for the key
+func (m *memoryResponseCache) Get(key string) (*CachedResponse, bool) {
+	return m.cache.Get(key)
+}
+
+// Set stores the response for the key
+func (m *memoryResponseCache) Set(key string, resp *CachedResponse) {
+	m.cache.Add(key, resp)
+}
+
+type storageResponseCache struct {
+	folder string
+}
+
+// ResponseCache returns ResponseCache persisted in the storage folder
+func (c *Storage) ResponseCache() ResponseCache {
+	return &storageResponseCache{folder: path.Join(c.folder, responseCacheFolder)}
+}
+
+func (s *storageResponseCache) location(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return path.Join(s.folder, hex.EncodeToString(h[:]))
+}
+
+// Get returns the cached response for the key
+func (s *storageResponseCache) Get(key string) (*CachedResponse, bool) {
+	b, err := os.ReadFile(s.location(key))
+	if err != nil {
+		return nil, false
+	}
+	resp := new(CachedResponse)
+	if err = json.Unmarshal(b, resp); err != nil {
+		return nil, false
+	}
+	return resp, true
+}
+
+// Set stores the response for the key
+func (s *storageResponseCache) Set(key string, resp *CachedResponse) {
+	b, err := json.Marshal(resp)
+	if err == nil {
+		_ = os.MkdirAll(s.folder, 0700)
+		err = os.WriteFile(s.location(key), b, 0600)
+	}
+	if err != nil {
+		logger.KV(xlog.DEBUG, "reason", "cache", "err", errors.WithStack(err).Error())
+	}
+}
+
+// WithResponseCache is a ClientOption that caches the responses of GET requests
+func WithResponseCache(cache ResponseCache) ClientOption {
+	return optionFunc(func(c *Client) {
+		c.WithResponseCache(cache)
+	})
+}
+
+// WithResponseCache caches the responses of GET requests with ETag or Last-Modified,
+// sends If-None-Match and If-Modified-Since on the next requests,
+// and serves the cached body on 304 Not Modified response
+func (c *Client) WithResponseCache(cache ResponseCache) *Client {
+	return c.Use(func(next RoundTripFn) RoundTripFn {
+		return func(r *http.Request) (*http.Response, error) {
+			if !cacheableRequest(r) {
+				return next(r)
+			}
+
+			key := responseCacheKey(r)
+			cached, ok := cache.Get(key)
+			if ok {
+				if etag := cached.Header.Get(header.ETag); etag != "" {
+					r.Header.Set(header.IfNoneMatch, etag)
+				}
+				if lm := cached.Header.Get(header.LastModified); lm != "" {
+					r.Header.Set(header.IfModifiedSince, lm)
+				}
+			}
+
+			resp, err := next(r)
+			if err != nil {
+				return resp, err
+			}
+
+			if ok && resp.StatusCode == http.StatusNotModified {
+				// the server may update the validators and caching headers
+				hdr := cached.Header.Clone()
+				for k, v := range resp.Header {
+					hdr[k] = v
+				}
+				_, _ = io.Copy(io.Discard, resp.Body)
+				_ = resp.Body.Close()
+
+				cached = &CachedResponse{
+					StatusCode: cached.StatusCode,
+					Header:     hdr,
+					Body:       cached.Body,
+				}
+				cache.Set(key, cached)
+				return cachedHTTPResponse(r, cached), nil
+			}
+
+			if resp.StatusCode == http.StatusOK && cacheableResponse(resp) {
+				body, err := io.ReadAll(io.LimitReader(resp.Body, MaxCachedResponseSize+1))
+				if err != nil {
+					// the error is returned to the caller on reading the body
+					resp.Body = readCloser{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+					return resp, nil
+				}
+				if len(body) > MaxCachedResponseSize {
+					resp.Body = readCloser{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+					return resp, nil
+				}
+				_ = resp.Body.Close()
+				cache.Set(key, &CachedResponse{
+					StatusCode: resp.StatusCode,
+					Header:     resp.Header.Clone(),
+					Body:       body,
+				})
+				resp.Body = io.NopCloser(bytes.NewReader(body))
+				resp.Header.Set(header.XCacheStatus, CacheStatusMiss)
+			}
+			return resp, nil
+		}
+	})
+}
+
+// readCloser reads from the reader, and closes the closer
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// cacheableRequest returns true, if the request is a plain GET,
+// without its own conditional or range headers
+func cacheableRequest(r *http.Request) bool {
+	return r.Method == http.MethodGet &&
+		r.Header.Get(header.IfNoneMatch) == "" &&
+		r.Header.Get(header.IfModifiedSince) == "" &&
+		r.Header.Get(header.Range) == "" &&
+		!strings.Contains(r.Header.Get(header.CacheControl), "no-store")
+}
+
+// cacheableResponse returns true, if the response has validators
+// and can be stored
+func cacheableResponse(resp *http.Response) bool {
+	if resp.Header.Get(header.ETag) == "" && resp.Header.Get(header.LastModified) == "" {
+		return false
+	}
+	return !strings.Contains(resp.Header.Get(header.CacheControl), "no-store") &&
+		resp.Header.Get(header.Vary) != "*"
+}
+
+// responseCacheKey returns the key of the request,
+// the Accept header is included as the response depends on it
+func responseCacheKey(r *http.Request) string {
+	return r.URL.String() + " " + r.Header.Get(header.Accept)
+}
+
+func cachedHTTPResponse(r *http.Request, cached *CachedResponse) *http.Response {
+	hdr := cached.Header.Clone()
+	hdr.Set(header.XCacheStatus, CacheStatusHit)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", cached.StatusCode, http.StatusText(cached.StatusCode)),
+		StatusCode:    cached.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        hdr,
+		Body:          io.NopCloser(bytes.NewReader(cached.Body)),
+		ContentLength: int64(len(cached.Body)),
+		Request:       r,
+	}
+}
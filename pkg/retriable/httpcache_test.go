@@ -0,0 +1,121 @@
+package retriable_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseCache(t *testing.T) {
+	var version, requests, notModified atomic.Int32
+	version.Store(1)
+	modified := time.Now().UTC().Truncate(time.Second)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/etag":
+			etag := `"v` + string(rune('0'+version.Load())) + `"`
+			w.Header().Set(header.ETag, etag)
+			if r.Header.Get(header.IfNoneMatch) == etag {
+				notModified.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set(header.ContentType, header.ApplicationJSON)
+			_, _ = w.Write([]byte(`{"version":` + string(rune('0'+version.Load())) + `}`))
+		case "/modified":
+			w.Header().Set(header.LastModified, modified.Format(http.TimeFormat))
+			if r.Header.Get(header.IfModifiedSince) == modified.Format(http.TimeFormat) {
+				notModified.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set(header.ContentType, header.ApplicationJSON)
+			_, _ = w.Write([]byte(`{"modified":true}`))
+		case "/nostore":
+			assert.Empty(t, r.Header.Get(header.IfNoneMatch))
+			w.Header().Set(header.ETag, `"v1"`)
+			w.Header().Set(header.CacheControl, "no-store")
+			w.Header().Set(header.ContentType, header.ApplicationJSON)
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	type result struct {
+		Version  int32 `json:"version"`
+		Modified bool  `json:"modified"`
+	}
+	get := func(client *retriable.Client, path string) (http.Header, result) {
+		var res result
+		hdr, status, err := client.Get(ctx, path, &res)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, status)
+		return hdr, res
+	}
+
+	t.Run("memory", func(t *testing.T) {
+		client, err := retriable.New(retriable.ClientConfig{Host: server.URL},
+			retriable.WithResponseCache(retriable.NewMemoryResponseCache(0)))
+		require.NoError(t, err)
+
+		hdr, res := get(client, "/etag")
+		assert.Equal(t, retriable.CacheStatusMiss, hdr.Get(header.XCacheStatus))
+		assert.EqualValues(t, 1, res.Version)
+
+		notModified.Store(0)
+		hdr, res = get(client, "/etag")
+		assert.Equal(t, retriable.CacheStatusHit, hdr.Get(header.XCacheStatus))
+		assert.EqualValues(t, 1, res.Version)
+		assert.Equal(t, int32(1), notModified.Load())
+
+		version.Store(2)
+		hdr, res = get(client, "/etag")
+		assert.Equal(t, retriable.CacheStatusMiss, hdr.Get(header.XCacheStatus))
+		assert.EqualValues(t, 2, res.Version)
+		hdr, res = get(client, "/etag")
+		assert.Equal(t, retriable.CacheStatusHit, hdr.Get(header.XCacheStatus))
+		assert.EqualValues(t, 2, res.Version)
+
+		get(client, "/modified")
+		notModified.Store(0)
+		hdr, res = get(client, "/modified")
+		assert.Equal(t, retriable.CacheStatusHit, hdr.Get(header.XCacheStatus))
+		assert.True(t, res.Modified)
+		assert.Equal(t, int32(1), notModified.Load())
+
+		for range 2 {
+			hdr, _ = get(client, "/nostore")
+			assert.Empty(t, hdr.Get(header.XCacheStatus))
+		}
+	})
+
+	t.Run("storage", func(t *testing.T) {
+		storage := retriable.OpenStorage(t.TempDir(), server.URL, "")
+		client, err := retriable.New(retriable.ClientConfig{Host: server.URL},
+			retriable.WithResponseCache(storage.ResponseCache()))
+		require.NoError(t, err)
+		hdr, _ := get(client, "/etag")
+		assert.Equal(t, retriable.CacheStatusMiss, hdr.Get(header.XCacheStatus))
+
+		// the new client uses the persisted response
+		client, err = retriable.New(retriable.ClientConfig{Host: server.URL})
+		require.NoError(t, err)
+		client.WithResponseCache(storage.ResponseCache())
+		notModified.Store(0)
+		hdr, res := get(client, "/etag")
+		assert.Equal(t, retriable.CacheStatusHit, hdr.Get(header.XCacheStatus))
+		assert.EqualValues(t, version.Load(), res.Version)
+		assert.Equal(t, int32(1), notModified.Load())
+	})
+}
@@ -0,0 +1,51 @@
+package retriable
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+
+	"github.com/effective-security/porto/xhttp/header"
+)
+
+// contextValueForRetryNonIdempotent specifies context value name
+// for per-request override of Policy.RetryNonIdempotent
+const contextValueForRetryNonIdempotent = contextValueName("RetryNonIdempotent")
+
+// WithRetryNonIdempotent returns context that overrides Policy.RetryNonIdempotent
+// for the request
+func WithRetryNonIdempotent(ctx context.Context, retry bool) context.Context {
+	return context.WithValue(ctx, contextValueForRetryNonIdempotent, retry)
+}
+
+// IsIdempotent returns true if the request can be safely retried,
+// after it may have been sent to the server:
+// the method is idempotent, or Idempotency-Key header is set
+func IsIdempotent(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return r.Header.Get(header.IdempotencyKey) != ""
+}
+
+// canRetrySent returns true if the request, that may have been sent,
+// can be retried on connection error
+func (c *Client) canRetrySent(r *http.Request) bool {
+	if retry, ok := r.Context().Value(contextValueForRetryNonIdempotent).(bool); ok {
+		return retry || IsIdempotent(r)
+	}
+	return c.policy(r.Context()).RetryNonIdempotent || IsIdempotent(r)
+}
+
+// withSentTrace returns context that sets sent flag,
+// when the request headers are written to the connection
+func withSentTrace(ctx context.Context, sent *atomic.Bool) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		WroteHeaders: func() {
+			sent.Store(true)
+		},
+	})
+}
@@ -0,0 +1,94 @@
+package retriable_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsIdempotent(t *testing.T) {
+	for _, m := range []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete} {
+		r := httptest.NewRequest(m, "/", nil)
+		assert.True(t, retriable.IsIdempotent(r), m)
+	}
+	for _, m := range []string{http.MethodPost, http.MethodPatch} {
+		r := httptest.NewRequest(m, "/", nil)
+		assert.False(t, retriable.IsIdempotent(r), m)
+		r.Header.Set(header.IdempotencyKey, "k1")
+		assert.True(t, retriable.IsIdempotent(r), m)
+	}
+}
+
+func TestRetryNonIdempotent(t *testing.T) {
+	var count int32
+	// the server reads the half of the body, and drops the connection
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		_, _ = io.ReadFull(r.Body, make([]byte, 10))
+		conn, _, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		_ = conn.Close()
+	}))
+	defer server.Close()
+
+	pol := retriable.Policy{
+		TotalRetryLimit: 2,
+		Retries: map[int]retriable.ShouldRetry{
+			0: retriable.DefaultShouldRetryFactory(2, time.Millisecond, "connection"),
+		},
+	}
+	client, err := retriable.New(retriable.ClientConfig{}, retriable.WithPolicy(pol))
+	require.NoError(t, err)
+
+	body := strings.Repeat("0123456789", 1000)
+	post := func(ctx context.Context, method string, hdr map[string]string) int32 {
+		atomic.StoreInt32(&count, 0)
+		if hdr != nil {
+			ctx = retriable.WithHeaders(ctx, hdr)
+		}
+		_, _, err := client.Request(ctx, method, server.URL, "/", bytes.NewReader([]byte(body)), nil)
+		require.Error(t, err)
+		return atomic.LoadInt32(&count)
+	}
+
+	ctx := context.Background()
+	assert.Equal(t, int32(1), post(ctx, http.MethodPost, nil))
+	assert.Equal(t, int32(1), post(ctx, http.MethodPatch, nil))
+	assert.Greater(t, post(ctx, http.MethodPut, nil), int32(1))
+	assert.Greater(t, post(ctx, http.MethodPost, map[string]string{header.IdempotencyKey: "k1"}), int32(1))
+	assert.Greater(t, post(retriable.WithRetryNonIdempotent(ctx, true), http.MethodPost, nil), int32(1))
+
+	// opt-in by policy, and per-request override
+	pol.RetryNonIdempotent = true
+	client.WithPolicy(pol)
+	assert.Greater(t, post(ctx, http.MethodPost, nil), int32(1))
+	assert.Equal(t, int32(1), post(retriable.WithRetryNonIdempotent(ctx, false), http.MethodPost, nil))
+
+	// not sent, retried
+	pol.RetryNonIdempotent = false
+	client.WithPolicy(pol)
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	var dials int32
+	client.WithTransport(&http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	})
+	_, _, err = client.Request(ctx, http.MethodPost, closed.URL, "/", bytes.NewReader([]byte(body)), nil)
+	require.Error(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&dials))
+}
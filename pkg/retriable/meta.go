@@ -0,0 +1,154 @@
+package retriable
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/effective-security/porto/xhttp/header"
+)
+
+// contextValueForResponseMeta specifies context value name for ResponseMeta
+const contextValueForResponseMeta = contextValueName("ResponseMeta")
+
+// RateLimit provides the rate limit info of the response
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	// Reset is the time until the limit is reset
+	Reset time.Duration
+}
+
+// ResponseMeta provides the commonly used metadata of the response
+type ResponseMeta struct {
+	StatusCode int
+	Header     http.Header
+	// RequestID is the value of X-Request-ID, or X-Correlation-ID header
+	RequestID string
+	// RateLimit is parsed from X-RateLimit-* headers, or nil if not present
+	RateLimit *RateLimit
+	// RetryAfter is parsed from Retry-After header
+	RetryAfter time.Duration
+	// Links are parsed from Link header, by rel
+	Links map[string]string
+	// Deprecated is true, if Deprecation header is present
+	Deprecated bool
+	// Deprecation is the deprecation date, if specified
+	Deprecation time.Time
+	// Sunset is the date when the resource becomes unavailable, if specified
+	Sunset time.Time
+}
+
+// WithResponseMeta returns context with the meta,
+// that is populated by the Request call
+//
+//	var meta retriable.ResponseMeta
+//	client.Request(retriable.WithResponseMeta(ctx, &meta), ...)
+func WithResponseMeta(ctx context.Context, meta *ResponseMeta) context.Context {
+	return context.WithValue(ctx, contextValueForResponseMeta, meta)
+}
+
+func responseMetaFromContext(ctx context.Context) *ResponseMeta {
+	if ctx == nil {
+		return nil
+	}
+	meta, _ := ctx.Value(contextValueForResponseMeta).(*ResponseMeta)
+	return meta
+}
+
+// ParseResponseMeta returns ResponseMeta of the response
+func ParseResponseMeta(resp *http.Response) *ResponseMeta {
+	h := resp.Header
+	m := &ResponseMeta{
+		StatusCode: resp.StatusCode,
+		Header:     h,
+		RequestID:  h.Get(header.XRequestID),
+		RetryAfter: parseRetryAfter(h.Get(header.RetryAfter)),
+		Links:      parseLinks(h.Values(header.Link)),
+	}
+	if m.RequestID == "" {
+		m.RequestID = h.Get(header.XCorrelationID)
+	}
+
+	if limit := h.Get(header.XRateLimitLimit); limit != "" {
+		rl := &RateLimit{}
+		rl.Limit, _ = strconv.Atoi(limit)
+		rl.Remaining, _ = strconv.Atoi(h.Get(header.XRateLimitRemaining))
+		reset, _ := strconv.Atoi(h.Get(header.XRateLimitReset))
+		rl.Reset = time.Duration(reset) * time.Second
+		m.RateLimit = rl
+	}
+
+	if dep := h.Get(header.Deprecation); dep != "" {
+		m.Deprecated = dep != "false"
+		m.Deprecation = parseDate(dep)
+	}
+	m.Sunset = parseDate(h.Get(header.Sunset))
+	return m
+}
+
+// NextLink returns URL of the next page, or empty string
+func (m *ResponseMeta) NextLink() string {
+	return m.Links["next"]
+}
+
+// parseRetryAfter returns the duration of Retry-After header,
+// in seconds or HTTP-date format
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if sec, err := strconv.Atoi(v); err == nil {
+		return time.Duration(sec) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// parseDate returns the time in HTTP-date, or @unix-seconds format
+func parseDate(v string) time.Time {
+	if strings.HasPrefix(v, "@") {
+		if sec, err := strconv.ParseInt(v[1:], 10, 64); err == nil {
+			return time.Unix(sec, 0).UTC()
+		}
+		return time.Time{}
+	}
+	t, _ := http.ParseTime(v)
+	return t
+}
+
+// parseLinks returns the links by rel, from Link header values:
+//
+//	<https://api/items?page=2>; rel="next", <https://api/items?page=5>; rel="last"
+func parseLinks(values []string) map[string]string {
+	var links map[string]string
+	for _, v := range values {
+		for _, link := range strings.Split(v, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			target = target[1 : len(target)-1]
+			for _, param := range parts[1:] {
+				name, val, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if !ok || !strings.EqualFold(name, "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(val, `"`)) {
+					if links == nil {
+						links = make(map[string]string)
+					}
+					links[strings.ToLower(rel)] = target
+				}
+			}
+		}
+	}
+	return links
+}
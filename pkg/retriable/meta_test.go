@@ -0,0 +1,78 @@
+package retriable_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseMeta(t *testing.T) {
+	sunset := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set(header.XRequestID, "req1")
+		h.Set(header.XRateLimitLimit, "100")
+		h.Set(header.XRateLimitRemaining, "99")
+		h.Set(header.XRateLimitReset, "30")
+		h.Set(header.RetryAfter, "5")
+		h.Add(header.Link, `<https://api/items?page=2>; rel="next", <https://api/items?page=1>; rel="prev first"`)
+		h.Add(header.Link, `<https://api/items?page=5>; rel=last`)
+		h.Set(header.Deprecation, "@1688169599")
+		h.Set(header.Sunset, sunset.Format(http.TimeFormat))
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	client, err := retriable.New(retriable.ClientConfig{})
+	require.NoError(t, err)
+
+	var meta retriable.ResponseMeta
+	var res map[string]any
+	_, _, err = client.Request(retriable.WithResponseMeta(context.Background(), &meta), http.MethodGet, server.URL, "/", nil, &res)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, meta.StatusCode)
+	assert.Equal(t, "req1", meta.RequestID)
+	assert.Equal(t, &retriable.RateLimit{Limit: 100, Remaining: 99, Reset: 30 * time.Second}, meta.RateLimit)
+	assert.Equal(t, 5*time.Second, meta.RetryAfter)
+	assert.Equal(t, map[string]string{
+		"next":  "https://api/items?page=2",
+		"prev":  "https://api/items?page=1",
+		"first": "https://api/items?page=1",
+		"last":  "https://api/items?page=5",
+	}, meta.Links)
+	assert.Equal(t, "https://api/items?page=2", meta.NextLink())
+	assert.True(t, meta.Deprecated)
+	assert.Equal(t, time.Unix(1688169599, 0).UTC(), meta.Deprecation)
+	assert.Equal(t, sunset, meta.Sunset)
+	assert.NotNil(t, meta.Header)
+}
+
+func TestParseResponseMeta(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	m := retriable.ParseResponseMeta(resp)
+	assert.Empty(t, m.RequestID)
+	assert.Nil(t, m.RateLimit)
+	assert.Nil(t, m.Links)
+	assert.Empty(t, m.NextLink())
+	assert.False(t, m.Deprecated)
+	assert.True(t, m.Sunset.IsZero())
+
+	resp.Header.Set(header.XCorrelationID, "corr1")
+	resp.Header.Set(header.Deprecation, "true")
+	resp.Header.Set(header.RetryAfter, time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	resp.Header.Set(header.Link, `invalid, <https://api/x>; title="x"`)
+	m = retriable.ParseResponseMeta(resp)
+	assert.Equal(t, "corr1", m.RequestID)
+	assert.True(t, m.Deprecated)
+	assert.True(t, m.Deprecation.IsZero())
+	assert.Greater(t, m.RetryAfter, 50*time.Second)
+	assert.Nil(t, m.Links)
+}
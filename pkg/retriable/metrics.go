@@ -0,0 +1,216 @@
+package retriable
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// RequestMetrics describes an attempt of the request
+type RequestMetrics struct {
+	// Client is the name of the client
+	Client string
+	Method string
+	Host   string
+	// PathTemplate is the path with the identifiers replaced by `{id}`,
+	// or the value provided by WithPathTemplate
+	PathTemplate string
+	// StatusCode of the response, or zero on error
+	StatusCode int
+	// Attempt is one based number of the attempt
+	Attempt int
+	Latency time.Duration
+	Err     error
+}
+
+// Metrics receives the metrics of every attempt of the request.
+// The callback is called synchronously, and must not block.
+type Metrics interface {
+	OnRequestFinished(m *RequestMetrics)
+}
+
+// MetricsFunc is an adapter to use a function as Metrics
+type MetricsFunc func(m *RequestMetrics)
+
+// OnRequestFinished calls f(m)
+func (f MetricsFunc) OnRequestFinished(m *RequestMetrics) {
+	f(m)
+}
+
+// WithMetrics is a ClientOption that reports the metrics of every attempt
+func WithMetrics(m Metrics) ClientOption {
+	return optionFunc(func(c *Client) {
+		if m != nil {
+			c.WithEventListener(&metricsListener{metrics: m})
+		}
+	})
+}
+
+// WithPathTemplate is a RequestOption that specifies the path template
+// reported in the metrics, for example `/v1/users/{id}`
+func WithPathTemplate(template string) RequestOption {
+	return requestOptionFunc(func(o *requestOptions) {
+		o.pathTemplate = template
+	})
+}
+
+type metricsListener struct {
+	NopEventListener
+	metrics Metrics
+}
+
+func (l *metricsListener) OnAttempt(e *AttemptEvent) {
+	m := &RequestMetrics{
+		Client:     e.Client,
+		StatusCode: e.StatusCode,
+		Attempt:    e.Attempt + 1,
+		Latency:    e.Elapsed,
+		Err:        e.Err,
+	}
+	if r := e.Request; r != nil {
+		m.Method = r.Method
+		m.Host = r.URL.Host
+		if ro := requestOptionsFromContext(r.Context()); ro != nil && ro.pathTemplate != "" {
+			m.PathTemplate = ro.pathTemplate
+		} else {
+			m.PathTemplate = PathTemplate(r.URL.Path)
+		}
+	}
+	l.metrics.OnRequestFinished(m)
+}
+
+// PathTemplate returns the path with the segments, that look like identifiers,
+// replaced by `{id}`, to limit the cardinality of the metrics labels
+func PathTemplate(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if isIdentifier(s) {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// isIdentifier returns true for numbers, UUIDs and long tokens with digits
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	digits := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	return digits == len(s) ||
+		(digits > 0 && len(s) >= 16)
+}
+
+// PrometheusMetrics is Metrics that exposes Prometheus collectors:
+//
+//	<namespace>_http_client_requests_total{client,method,host,path,status}
+//	<namespace>_http_client_retries_total{client,method,host,path}
+//	<namespace>_http_client_request_duration_seconds{client,method,host,path}
+//
+// and DNSMetrics collectors:
+//
+//	<namespace>_http_client_dns_lookups_total{host,result}
+//	<namespace>_http_client_dns_lookup_duration_seconds{host}
+type PrometheusMetrics struct {
+	requests    *prom.CounterVec
+	retries     *prom.CounterVec
+	duration    *prom.HistogramVec
+	dnsLookups  *prom.CounterVec
+	dnsDuration *prom.HistogramVec
+}
+
+// NewPrometheusMetrics returns PrometheusMetrics,
+// that must be registered with prometheus.Registerer
+func NewPrometheusMetrics(namespace string) *PrometheusMetrics {
+	labels := []string{"client", "method", "host", "path"}
+	return &PrometheusMetrics{
+		requests: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http_client",
+			Name:      "requests_total",
+			Help:      "Number of the request attempts by status, the status is `error` if no response",
+		}, append(labels, "status")),
+		retries: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http_client",
+			Name:      "retries_total",
+			Help:      "Number of the retried attempts",
+		}, labels),
+		duration: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http_client",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of the request attempts",
+			Buckets:   prom.DefBuckets,
+		}, labels),
+		dnsLookups: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http_client",
+			Name:      "dns_lookups_total",
+			Help:      "Number of the DNS lookups by result: hit, miss or error",
+		}, []string{"host", "result"}),
+		dnsDuration: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http_client",
+			Name:      "dns_lookup_duration_seconds",
+			Help:      "Latency of the DNS lookups, not served from the cache",
+			Buckets:   prom.DefBuckets,
+		}, []string{"host"}),
+	}
+}
+
+// OnRequestFinished implements Metrics
+func (p *PrometheusMetrics) OnRequestFinished(m *RequestMetrics) {
+	status := "error"
+	if m.StatusCode > 0 {
+		status = strconv.Itoa(m.StatusCode)
+	}
+
+	p.requests.WithLabelValues(m.Client, m.Method, m.Host, m.PathTemplate, status).Inc()
+	if m.Attempt > 1 {
+		p.retries.WithLabelValues(m.Client, m.Method, m.Host, m.PathTemplate).Inc()
+	}
+	p.duration.WithLabelValues(m.Client, m.Method, m.Host, m.PathTemplate).Observe(m.Latency.Seconds())
+}
+
+// OnDNSLookup implements DNSMetrics
+func (p *PrometheusMetrics) OnDNSLookup(m *DNSLookupMetrics) {
+	result := "miss"
+	if m.Err != nil {
+		result = "error"
+	} else if m.Hit {
+		result = "hit"
+	}
+	p.dnsLookups.WithLabelValues(m.Host, result).Inc()
+	if !m.Hit {
+		p.dnsDuration.WithLabelValues(m.Host).Observe(m.Latency.Seconds())
+	}
+}
+
+// Describe implements prometheus.Collector
+func (p *PrometheusMetrics) Describe(ch chan<- *prom.Desc) {
+	p.requests.Describe(ch)
+	p.retries.Describe(ch)
+	p.duration.Describe(ch)
+	p.dnsLookups.Describe(ch)
+	p.dnsDuration.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (p *PrometheusMetrics) Collect(ch chan<- prom.Metric) {
+	p.requests.Collect(ch)
+	p.retries.Collect(ch)
+	p.duration.Collect(ch)
+	p.dnsLookups.Collect(ch)
+	p.dnsDuration.Collect(ch)
+}
@@ -0,0 +1,105 @@
+package retriable_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathTemplate(t *testing.T) {
+	tcases := map[string]string{
+		"":                  "/",
+		"/":                 "/",
+		"/v1/users":         "/v1/users",
+		"/v1/users/123":     "/v1/users/{id}",
+		"/v1/users/123/ops": "/v1/users/{id}/ops",
+		"/v1/keys/4a6e1f0b-2c1d-4b7e-9f3a-0d5c6b7a8e9f": "/v1/keys/{id}",
+		"/v2/status": "/v2/status",
+	}
+	for path, exp := range tcases {
+		assert.Equal(t, exp, retriable.PathTemplate(path), path)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	var lock sync.Mutex
+	var reported []retriable.RequestMetrics
+	pm := retriable.NewPrometheusMetrics("test")
+	reg := prom.NewRegistry()
+	require.NoError(t, reg.Register(pm))
+
+	client, err := retriable.New(retriable.ClientConfig{Host: server.URL},
+		retriable.WithName("test"),
+		retriable.WithMetrics(pm),
+		retriable.WithMetrics(retriable.MetricsFunc(func(m *retriable.RequestMetrics) {
+			lock.Lock()
+			defer lock.Unlock()
+			reported = append(reported, *m)
+		})),
+		retriable.WithPolicy(retriable.Policy{
+			TotalRetryLimit: 2,
+			Retries: map[int]retriable.ShouldRetry{
+				http.StatusServiceUnavailable: retriable.DefaultShouldRetryFactory(2, time.Millisecond, "unavailable"),
+			},
+		}))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	var res map[string]any
+	_, _, err = client.Get(ctx, "/v1/users/123", &res)
+	require.NoError(t, err)
+	_, _, err = client.Get(ctx, "/v1/users/alice", &res, retriable.WithPathTemplate("/v1/users/{name}"))
+	require.NoError(t, err)
+
+	lock.Lock()
+	require.Len(t, reported, 3)
+	assert.Equal(t, "test", reported[0].Client)
+	assert.Equal(t, http.MethodGet, reported[0].Method)
+	assert.Equal(t, strings.TrimPrefix(server.URL, "http://"), reported[0].Host)
+	assert.Equal(t, "/v1/users/{id}", reported[0].PathTemplate)
+	assert.Equal(t, http.StatusServiceUnavailable, reported[0].StatusCode)
+	assert.Equal(t, 1, reported[0].Attempt)
+	assert.Equal(t, http.StatusOK, reported[1].StatusCode)
+	assert.Equal(t, 2, reported[1].Attempt)
+	assert.Equal(t, "/v1/users/{name}", reported[2].PathTemplate)
+	lock.Unlock()
+
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			switch {
+			case m.GetCounter() != nil:
+				values[mf.GetName()] += m.GetCounter().GetValue()
+			case m.GetHistogram() != nil:
+				values[mf.GetName()] += float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	assert.Equal(t, map[string]float64{
+		"test_http_client_requests_total":           3,
+		"test_http_client_retries_total":            1,
+		"test_http_client_request_duration_seconds": 3,
+	}, values)
+}
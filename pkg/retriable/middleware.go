@@ -0,0 +1,39 @@
+package retriable
+
+import "net/http"
+
+// RoundTripFn sends a single attempt of the HTTP request
+type RoundTripFn func(r *http.Request) (*http.Response, error)
+
+// Middleware wraps RoundTripFn, for example to sign the request,
+// refresh the auth token, or to collect metrics.
+// The middleware is called for every attempt, including retries.
+type Middleware func(next RoundTripFn) RoundTripFn
+
+// WithMiddleware is a ClientOption that adds the middlewares
+func WithMiddleware(mws ...Middleware) ClientOption {
+	return optionFunc(func(c *Client) {
+		c.Use(mws...)
+	})
+}
+
+// Use adds the middlewares, that are executed in the order of registration:
+// the first one receives the request first, and the response last
+func (c *Client) Use(mws ...Middleware) *Client {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, mw := range mws {
+		if mw != nil {
+			c.middlewares = append(c.middlewares, mw)
+		}
+	}
+	return c
+}
+
+// roundTripChain returns RoundTripFn that executes the middlewares
+func roundTripChain(rt RoundTripFn, mws []Middleware) RoundTripFn {
+	for i := len(mws) - 1; i >= 0; i-- {
+		rt = mws[i](rt)
+	}
+	return rt
+}
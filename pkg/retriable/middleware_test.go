@@ -0,0 +1,85 @@
+package retriable_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if count.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("X-Attempt", r.Header.Get("X-Attempt"))
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	var lock sync.Mutex
+	var calls []string
+	record := func(name string) retriable.Middleware {
+		return func(next retriable.RoundTripFn) retriable.RoundTripFn {
+			return func(r *http.Request) (*http.Response, error) {
+				lock.Lock()
+				calls = append(calls, ">"+name)
+				lock.Unlock()
+				resp, err := next(r)
+				lock.Lock()
+				calls = append(calls, "<"+name)
+				lock.Unlock()
+				return resp, err
+			}
+		}
+	}
+	var attempts atomic.Int32
+	attempt := func(next retriable.RoundTripFn) retriable.RoundTripFn {
+		return func(r *http.Request) (*http.Response, error) {
+			r.Header.Set("X-Attempt", strconv.Itoa(int(attempts.Add(1))))
+			return next(r)
+		}
+	}
+
+	pol := retriable.Policy{
+		TotalRetryLimit: 2,
+		Retries: map[int]retriable.ShouldRetry{
+			http.StatusServiceUnavailable: retriable.DefaultShouldRetryFactory(2, time.Millisecond, "unavailable"),
+		},
+	}
+	client, err := retriable.New(retriable.ClientConfig{Host: server.URL},
+		retriable.WithPolicy(pol),
+		retriable.WithMiddleware(record("a"), nil),
+	)
+	require.NoError(t, err)
+	client.Use(record("b"), attempt)
+
+	var res map[string]any
+	hdr, status, err := client.Get(context.Background(), "/", &res)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "2", hdr.Get("X-Attempt"))
+	assert.Equal(t, []string{">a", ">b", "<b", "<a", ">a", ">b", "<b", "<a"}, calls)
+
+	// middleware can fail the attempt
+	client.Use(func(retriable.RoundTripFn) retriable.RoundTripFn {
+		return func(*http.Request) (*http.Response, error) {
+			return nil, errors.New("x509: certificate refused by middleware")
+		}
+	})
+	count.Store(1)
+	_, _, err = client.Get(context.Background(), "/", &res)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "refused by middleware")
+}
@@ -0,0 +1,120 @@
+package retriable
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/effective-security/xlog"
+)
+
+// SPKIPrefix is the optional prefix of the pinned SPKI hash
+const SPKIPrefix = "sha256/"
+
+// PinMismatchError is returned when the server certificate chain
+// does not contain any of the pinned public keys
+type PinMismatchError struct {
+	// ServerName is the name of the server
+	ServerName string
+	// Presented is the list of SPKI hashes of the presented certificates
+	Presented []string
+}
+
+// Error implements error interface
+func (e *PinMismatchError) Error() string {
+	return fmt.Sprintf("certificate pin mismatch for %q: presented %s",
+		e.ServerName, strings.Join(e.Presented, ", "))
+}
+
+// SPKIHash returns base64 encoded SHA-256 hash of the certificate's SubjectPublicKeyInfo,
+// as used in WithPinnedSPKI
+func SPKIHash(cert *x509.Certificate) string {
+	h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// WithPinnedSPKI is a ClientOption that specifies the pinned public keys,
+// as base64 encoded SHA-256 hashes of SubjectPublicKeyInfo, optionally with sha256/ prefix.
+// The connection is allowed if any certificate in the server chain matches any pin,
+// in addition to CA validation. Specify multiple pins for key rotation.
+//
+//	retriable.New(retriable.WithPinnedSPKI(current, next))
+func WithPinnedSPKI(hashes ...string) ClientOption {
+	return optionFunc(func(c *Client) {
+		c.WithPinnedSPKI(hashes...)
+	})
+}
+
+// WithPinnedSPKI sets the pinned public keys,
+// see WithPinnedSPKI option for details.
+func (c *Client) WithPinnedSPKI(hashes ...string) *Client {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.pins = nil
+	if len(hashes) > 0 {
+		c.pins = make(map[string]bool, len(hashes))
+		for _, h := range hashes {
+			c.pins[strings.TrimPrefix(h, SPKIPrefix)] = true
+		}
+	}
+
+	if c.httpClient.Transport == nil {
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		tr.MaxIdleConnsPerHost = 100
+		tr.MaxConnsPerHost = 100
+		tr.MaxIdleConns = 100
+		c.httpClient.Transport = tr
+	}
+	if tr, ok := c.httpClient.Transport.(*http.Transport); ok {
+		tr.TLSClientConfig = c.pinned(tr.TLSClientConfig)
+	} else {
+		logger.KV(xlog.WARNING, "reason", "custom_transport", "pins", "not_applied")
+	}
+	c.hostClients = nil
+	return c
+}
+
+// pinned returns the copy of TLS config with pins verification,
+// or the original config if pins are not set
+func (c *Client) pinned(cfg *tls.Config) *tls.Config {
+	if len(c.pins) == 0 {
+		return cfg
+	}
+	if cfg == nil {
+		cfg = &tls.Config{MinVersion: tls.VersionTLS12}
+	} else {
+		cfg = cfg.Clone()
+	}
+	pins := c.pins
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		return verifyPins(cs, pins)
+	}
+	return cfg
+}
+
+func verifyPins(cs tls.ConnectionState, pins map[string]bool) error {
+	certs := cs.PeerCertificates
+	for _, chain := range cs.VerifiedChains {
+		certs = append(certs, chain...)
+	}
+
+	presented := make([]string, 0, len(cs.PeerCertificates))
+	for i, cert := range certs {
+		h := SPKIHash(cert)
+		if pins[h] {
+			return nil
+		}
+		if i < len(cs.PeerCertificates) {
+			presented = append(presented, SPKIPrefix+h)
+		}
+	}
+	return &PinMismatchError{
+		ServerName: cs.ServerName,
+		Presented:  presented,
+	}
+}
@@ -0,0 +1,59 @@
+package retriable_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPinnedSPKI(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+	tlsConfig := &tls.Config{RootCAs: roots}
+
+	pin := retriable.SPKIHash(ts.Certificate())
+	other := "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+
+	ctx := context.Background()
+	var res map[string]any
+
+	request := func(opts ...retriable.ClientOption) error {
+		client, err := retriable.New(retriable.ClientConfig{}, append(opts, retriable.WithPolicy(retriable.Policy{}))...)
+		require.NoError(t, err)
+		_, _, err = client.Request(ctx, http.MethodGet, ts.URL, "/", nil, &res)
+		return err
+	}
+
+	assert.NoError(t, request(retriable.WithTLS(tlsConfig), retriable.WithPinnedSPKI(pin)))
+	// rotation, order of options
+	assert.NoError(t, request(retriable.WithPinnedSPKI(other, retriable.SPKIPrefix+pin), retriable.WithTLS(tlsConfig)))
+	// host TLS
+	assert.NoError(t, request(retriable.WithPinnedSPKI(pin), retriable.WithHostTLS(ts.URL, tlsConfig)))
+
+	err := request(retriable.WithTLS(tlsConfig), retriable.WithPinnedSPKI(other))
+	require.Error(t, err)
+	var perr *retriable.PinMismatchError
+	require.True(t, errors.As(err, &perr), "%T", err)
+	assert.Equal(t, []string{retriable.SPKIPrefix + pin}, perr.Presented)
+	assert.Contains(t, err.Error(), "certificate pin mismatch")
+
+	assert.Error(t, request(retriable.WithPinnedSPKI(other), retriable.WithHostTLS(ts.URL, tlsConfig)))
+
+	// CA validation is still applied
+	err = request(retriable.WithPinnedSPKI(pin))
+	require.Error(t, err)
+	assert.False(t, errors.As(err, &perr))
+}
@@ -0,0 +1,232 @@
+package retriable
+
+import (
+	"context"
+	"encoding"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// EncodeQuery encodes the struct into URL query parameters,
+// in the style of gRPC-gateway:
+//
+//   - the name is taken from `url` tag, or `json` tag, or the field name;
+//     "-" skips the field, and omitempty skips the zero value
+//   - repeated fields are encoded as repeated parameters: ids=1&ids=2
+//   - nested structs use dot-notation: page.size=10
+//   - maps are encoded as name[key]=value
+//   - time.Time is formatted as RFC 3339 in UTC, time.Duration as seconds: 1.5s
+//   - []byte is base64 encoded, encoding.TextMarshaler is used if implemented
+//
+// The value can be a struct, a pointer to struct, url.Values, or nil.
+func EncodeQuery(v any) (url.Values, error) {
+	vals := url.Values{}
+	if v == nil {
+		return vals, nil
+	}
+	if uv, ok := v.(url.Values); ok {
+		for k, v := range uv {
+			vals[k] = append(vals[k], v...)
+		}
+		return vals, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return vals, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, errors.Errorf("query must be a struct: %T", v)
+	}
+	if err := encodeStruct(vals, "", rv); err != nil {
+		return nil, err
+	}
+	return vals, nil
+}
+
+// PathWithQuery returns the path with the query parameters of v appended
+func PathWithQuery(path string, v any) (string, error) {
+	vals, err := EncodeQuery(v)
+	if err != nil {
+		return "", err
+	}
+	if len(vals) == 0 {
+		return path, nil
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + vals.Encode(), nil
+}
+
+// GetWithQuery fetches the supplied resource with the query parameters,
+// encoded from the query struct with EncodeQuery.
+// path should be an absolute URI path, i.e. /foo/bar/baz
+func (c *Client) GetWithQuery(ctx context.Context, path string, query any, body any, opts ...RequestOption) (http.Header, int, error) {
+	p, err := PathWithQuery(path, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	return c.Request(ctx, http.MethodGet, c.host, p, nil, body, opts...)
+}
+
+func encodeStruct(vals url.Values, prefix string, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		// as in encoding/json, the exported fields of unexported embedded structs are used
+		if !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		name, omitEmpty, skip := queryFieldName(f)
+		if skip {
+			continue
+		}
+
+		fv := rv.Field(i)
+		// embedded structs without the name are flattened
+		if f.Anonymous && name == "" {
+			for fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					break
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				if err := encodeStruct(vals, prefix, fv); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if omitEmpty && fv.IsZero() {
+			continue
+		}
+		if err := encodeValue(vals, prefix+name, fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeValue(vals url.Values, name string, rv reflect.Value) error {
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+
+	if s, ok, err := formatScalar(rv); ok || err != nil {
+		if err != nil {
+			return errors.WithMessagef(err, "field %s", name)
+		}
+		vals.Add(name, s)
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Struct:
+		return encodeStruct(vals, name+".", rv)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if err := encodeValue(vals, name, rv.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			ki, _, _ := formatScalar(keys[i])
+			kj, _, _ := formatScalar(keys[j])
+			return ki < kj
+		})
+		for _, k := range keys {
+			ks, ok, err := formatScalar(k)
+			if !ok || err != nil {
+				return errors.Errorf("field %s: unsupported map key: %s", name, k.Type())
+			}
+			if err := encodeValue(vals, name+"["+ks+"]", rv.MapIndex(k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errors.Errorf("field %s: unsupported type: %s", name, rv.Type())
+}
+
+// formatScalar returns the string value of the scalar,
+// and false if the value is not a scalar
+func formatScalar(rv reflect.Value) (string, bool, error) {
+	switch rv.Type() {
+	case timeType:
+		return rv.Interface().(time.Time).UTC().Format(time.RFC3339Nano), true, nil
+	case durationType:
+		d := time.Duration(rv.Int())
+		return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s", true, nil
+	}
+	if rv.Type().Implements(textMarshalerType) {
+		b, err := rv.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), true, errors.WithStack(err)
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), true, nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), true, nil
+	case reflect.Float32:
+		return strconv.FormatFloat(rv.Float(), 'g', -1, 32), true, nil
+	case reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'g', -1, 64), true, nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return base64.StdEncoding.EncodeToString(rv.Bytes()), true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// queryFieldName returns the name of the field from `url` or `json` tag
+func queryFieldName(f reflect.StructField) (name string, omitEmpty, skip bool) {
+	tag, ok := f.Tag.Lookup("url")
+	if !ok {
+		tag = f.Tag.Get("json")
+	}
+	if tag == "-" {
+		return "", false, true
+	}
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return parts[0], omitEmpty, false
+}
@@ -0,0 +1,131 @@
+package retriable_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type queryPage struct {
+	Size  int    `json:"size,omitempty"`
+	Token string `json:"token,omitempty"`
+}
+
+type queryBase struct {
+	Tenant string `json:"tenant"`
+}
+
+type queryStatus int
+
+func (s queryStatus) MarshalText() ([]byte, error) {
+	return []byte([]string{"unknown", "active", "disabled"}[s]), nil
+}
+
+type listQuery struct {
+	queryBase
+	IDs      []uint64          `json:"ids,omitempty"`
+	Name     string            `url:"q,omitempty"`
+	Active   *bool             `json:"active,omitempty"`
+	Since    time.Time         `json:"since,omitempty"`
+	Timeout  time.Duration     `json:"timeout,omitempty"`
+	Page     *queryPage        `json:"page,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Status   []queryStatus     `json:"status,omitempty"`
+	Data     []byte            `json:"data,omitempty"`
+	Score    float64           `json:"score"`
+	Internal string            `json:"-"`
+	Raw      string
+	hidden   string
+}
+
+func TestEncodeQuery(t *testing.T) {
+	active := false
+	q := &listQuery{
+		queryBase: queryBase{Tenant: "acme"},
+		IDs:       []uint64{1, 2},
+		Name:      "john",
+		Active:    &active,
+		Since:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("PST", -8*3600)),
+		Timeout:   1500 * time.Millisecond,
+		Page:      &queryPage{Size: 10},
+		Labels:    map[string]string{"env": "prod", "app": "porto"},
+		Status:    []queryStatus{1, 2},
+		Data:      []byte("hi"),
+		Internal:  "secret",
+		Raw:       "raw",
+		hidden:    "hidden",
+	}
+
+	vals, err := retriable.EncodeQuery(q)
+	require.NoError(t, err)
+	assert.Equal(t, url.Values{
+		"tenant":      {"acme"},
+		"ids":         {"1", "2"},
+		"q":           {"john"},
+		"active":      {"false"},
+		"since":       {"2024-01-02T11:04:05Z"},
+		"timeout":     {"1.5s"},
+		"page.size":   {"10"},
+		"labels[app]": {"porto"},
+		"labels[env]": {"prod"},
+		"status":      {"active", "disabled"},
+		"data":        {"aGk="},
+		"score":       {"0"},
+		"Raw":         {"raw"},
+	}, vals)
+
+	vals, err = retriable.EncodeQuery(&listQuery{})
+	require.NoError(t, err)
+	assert.Equal(t, url.Values{"tenant": {""}, "score": {"0"}, "Raw": {""}}, vals)
+
+	vals, err = retriable.EncodeQuery(nil)
+	require.NoError(t, err)
+	assert.Empty(t, vals)
+	vals, err = retriable.EncodeQuery((*listQuery)(nil))
+	require.NoError(t, err)
+	assert.Empty(t, vals)
+	vals, err = retriable.EncodeQuery(url.Values{"a": {"b"}})
+	require.NoError(t, err)
+	assert.Equal(t, url.Values{"a": {"b"}}, vals)
+
+	_, err = retriable.EncodeQuery("string")
+	assert.EqualError(t, err, "query must be a struct: string")
+	_, err = retriable.EncodeQuery(struct{ Fn func() }{Fn: func() {}})
+	assert.EqualError(t, err, "field Fn: unsupported type: func()")
+
+	p, err := retriable.PathWithQuery("/v1/users", queryPage{Size: 5, Token: "a b"})
+	require.NoError(t, err)
+	assert.Equal(t, "/v1/users?size=5&token=a+b", p)
+	p, err = retriable.PathWithQuery("/v1/users?x=1", queryPage{Size: 5})
+	require.NoError(t, err)
+	assert.Equal(t, "/v1/users?x=1&size=5", p)
+	p, err = retriable.PathWithQuery("/v1/users", queryPage{})
+	require.NoError(t, err)
+	assert.Equal(t, "/v1/users", p)
+}
+
+func TestGetWithQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"query":"` + r.URL.RawQuery + `"}`))
+	}))
+	defer server.Close()
+
+	client, err := retriable.New(retriable.ClientConfig{Host: server.URL})
+	require.NoError(t, err)
+
+	var res map[string]string
+	_, status, err := client.GetWithQuery(context.Background(), "/v1/users", &queryPage{Size: 5}, &res)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "size=5", res["query"])
+
+	_, _, err = client.GetWithQuery(context.Background(), "/v1/users", 1, &res)
+	assert.EqualError(t, err, "query must be a struct: int")
+}
@@ -0,0 +1,130 @@
+package retriable
+
+import (
+	"context"
+	"time"
+)
+
+// contextValueForRequestOptions specifies context value name for per-request options
+const contextValueForRequestOptions = contextValueName("RequestOptions")
+
+// A RequestOption overrides the client defaults for a single call.
+//
+//	client.Get(ctx, path, &res, retriable.WithRequestTimeout(2*time.Second))
+type RequestOption interface {
+	applyRequestOption(*requestOptions)
+}
+
+type requestOptionFunc func(*requestOptions)
+
+func (f requestOptionFunc) applyRequestOption(o *requestOptions) { f(o) }
+
+// requestOptions are stored in the request context
+type requestOptions struct {
+	policy  *Policy
+	timeout *time.Duration
+	noRetry bool
+	headers map[string]string
+	// pathTemplate is reported in the metrics
+	pathTemplate string
+	// codec encodes the request and decodes the response
+	codec Codec
+}
+
+// WithRequestTimeout is a RequestOption that overrides Policy.RequestTimeout
+// for the call, zero timeout disables the limit
+func WithRequestTimeout(timeout time.Duration) RequestOption {
+	return requestOptionFunc(func(o *requestOptions) {
+		o.timeout = &timeout
+	})
+}
+
+// WithRetryPolicy is a RequestOption that replaces the client Policy for the call
+func WithRetryPolicy(policy Policy) RequestOption {
+	return requestOptionFunc(func(o *requestOptions) {
+		o.policy = &policy
+	})
+}
+
+// WithNoRetry is a RequestOption that disables retries and hedged requests for the call
+func WithNoRetry() RequestOption {
+	return requestOptionFunc(func(o *requestOptions) {
+		o.noRetry = true
+	})
+}
+
+// WithHeader is a RequestOption that sets the header for the call,
+// it overrides the client headers and the headers from the context
+func WithHeader(name, value string) RequestOption {
+	return requestOptionFunc(func(o *requestOptions) {
+		if o.headers == nil {
+			o.headers = map[string]string{}
+		}
+		o.headers[name] = value
+	})
+}
+
+// withRequestOptions returns the context with the options,
+// and the effective policy for the call
+func (c *Client) withRequestOptions(ctx context.Context, opts []RequestOption) context.Context {
+	if len(opts) == 0 {
+		return ctx
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	ro := &requestOptions{}
+	if parent := requestOptionsFromContext(ctx); parent != nil {
+		ro.policy = parent.policy
+		ro.noRetry = parent.noRetry
+		ro.pathTemplate = parent.pathTemplate
+		ro.codec = parent.codec
+		if len(parent.headers) > 0 {
+			ro.headers = make(map[string]string, len(parent.headers))
+			for k, v := range parent.headers {
+				ro.headers[k] = v
+			}
+		}
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt.applyRequestOption(ro)
+		}
+	}
+
+	c.lock.RLock()
+	pol := c.Policy
+	c.lock.RUnlock()
+
+	if ro.policy != nil {
+		pol = *ro.policy
+	}
+	if ro.timeout != nil {
+		pol.RequestTimeout = *ro.timeout
+	}
+	if ro.noRetry {
+		pol.TotalRetryLimit = 0
+		pol.HedgeDelay = 0
+	}
+	ro.policy = &pol
+	ro.timeout = nil
+
+	return context.WithValue(ctx, contextValueForRequestOptions, ro)
+}
+
+func requestOptionsFromContext(ctx context.Context) *requestOptions {
+	if ctx == nil {
+		return nil
+	}
+	ro, _ := ctx.Value(contextValueForRequestOptions).(*requestOptions)
+	return ro
+}
+
+// policy returns the effective policy of the request
+func (c *Client) policy(ctx context.Context) *Policy {
+	if ro := requestOptionsFromContext(ctx); ro != nil && ro.policy != nil {
+		return ro.policy
+	}
+	return &c.Policy
+}
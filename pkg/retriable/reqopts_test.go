@@ -0,0 +1,96 @@
+package retriable_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestOptions(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(300 * time.Millisecond)
+		case "/unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"header":"` + r.Header.Get("X-Test") + `"}`))
+	}))
+	defer server.Close()
+
+	pol := retriable.Policy{
+		Retries: map[int]retriable.ShouldRetry{
+			http.StatusServiceUnavailable: retriable.DefaultShouldRetryFactory(2, 10*time.Millisecond, "unavailable"),
+		},
+		TotalRetryLimit: 2,
+	}
+	client, err := retriable.New(retriable.ClientConfig{Host: server.URL}, retriable.WithPolicy(pol))
+	require.NoError(t, err)
+	client.AddHeader("X-Test", "client")
+
+	ctx := context.Background()
+	type result struct {
+		Header string `json:"header"`
+	}
+
+	t.Run("header", func(t *testing.T) {
+		var res result
+		_, _, err := client.Get(ctx, "/", &res)
+		require.NoError(t, err)
+		assert.Equal(t, "client", res.Header)
+
+		_, _, err = client.Get(ctx, "/", &res, retriable.WithHeader("X-Test", "call"))
+		require.NoError(t, err)
+		assert.Equal(t, "call", res.Header)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		var res result
+		_, _, err := client.Get(ctx, "/slow", &res)
+		require.NoError(t, err)
+
+		_, _, err = client.Get(ctx, "/slow", &res, retriable.WithRequestTimeout(50*time.Millisecond))
+		require.Error(t, err)
+		var te *retriable.TimeoutError
+		require.True(t, errors.As(err, &te))
+		assert.Equal(t, retriable.LimitRequestTimeout, te.Limit)
+		assert.Equal(t, 50*time.Millisecond, te.Timeout)
+	})
+
+	t.Run("no_retry", func(t *testing.T) {
+		atomic.StoreInt32(&count, 0)
+		_, status, err := client.Get(ctx, "/unavailable", nil)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, status)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&count))
+
+		atomic.StoreInt32(&count, 0)
+		_, _, err = client.Get(ctx, "/unavailable", nil, retriable.WithNoRetry())
+		require.Error(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+	})
+
+	t.Run("retry_policy", func(t *testing.T) {
+		one := pol
+		one.TotalRetryLimit = 1
+
+		atomic.StoreInt32(&count, 0)
+		_, _, err := client.Post(ctx, "/unavailable", []byte("{}"), nil, retriable.WithRetryPolicy(one))
+		require.Error(t, err)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+
+		// the client policy is not modified
+		assert.Equal(t, 2, client.Policy.TotalRetryLimit)
+	})
+}
@@ -52,6 +52,15 @@ func NewRequest(method, url string, rawBody io.ReadSeeker) (*Request, error) {
 		return nil, errors.WithStack(err)
 	}
 	httpReq.ContentLength = contentLength
+	if body != nil {
+		httpReq.GetBody = func() (io.ReadCloser, error) {
+			r, err := body()
+			if err != nil {
+				return nil, err
+			}
+			return io.NopCloser(r), nil
+		}
+	}
 
 	return &Request{body: body, Request: httpReq}, nil
 }
@@ -7,20 +7,22 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/effective-security/porto/gserver/credentials"
-	"github.com/effective-security/porto/pkg/tlsconfig"
+	"github.com/effective-security/porto/x/backoff"
+	"github.com/effective-security/porto/x/clock"
 	"github.com/effective-security/porto/xhttp/correlation"
 	"github.com/effective-security/porto/xhttp/header"
 	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/porto/xhttp/redact"
 	"github.com/effective-security/x/netutil"
 	"github.com/effective-security/x/slices"
 	"github.com/effective-security/xlog"
@@ -41,6 +43,10 @@ const (
 	DeadlineExceeded = "deadline"
 	// Cancelled returned when request was cancelled
 	Cancelled = "cancelled"
+	// BudgetExhausted returned when the retry budget is exhausted
+	BudgetExhausted = "budget-exhausted"
+	// NonIdempotent returned when non-idempotent request may have been sent
+	NonIdempotent = "non-idempotent"
 	// NonRetriableError returned when non-retriable error occured
 	NonRetriableError = "non-retriable"
 )
@@ -51,6 +57,8 @@ type contextValueName string
 const (
 	// ContextValueForHTTPHeader specifies context value name for HTTP headers
 	contextValueForHTTPHeader = contextValueName("HTTP-Header")
+	// contextValueForCodec specifies context value name for Codec
+	contextValueForCodec = contextValueName("Codec")
 )
 
 // GenericHTTP defines a number of generalized HTTP request handling wrappers
@@ -67,17 +75,17 @@ type GenericHTTP interface {
 	// path should be an absolute URI path, i.e. /foo/bar/baz
 	// requestBody can be io.Reader, []byte, or an object to be JSON encoded
 	// responseBody can be io.Writer, or a struct to decode JSON into.
-	Request(ctx context.Context, method string, host string, path string, requestBody interface{}, responseBody interface{}) (http.Header, int, error)
+	Request(ctx context.Context, method string, host string, path string, requestBody interface{}, responseBody interface{}, opts ...RequestOption) (http.Header, int, error)
 
 	// RequestURL is similar to Request but uses raw URL to one host
-	RequestURL(ctx context.Context, method, rawURL string, requestBody interface{}, responseBody interface{}) (http.Header, int, error)
+	RequestURL(ctx context.Context, method, rawURL string, requestBody interface{}, responseBody interface{}, opts ...RequestOption) (http.Header, int, error)
 
 	// HeadTo makes HEAD request against the specified hosts.
 	// The supplied hosts are tried in order until one succeeds.
 	//
 	// host should include all the protocol/host/port preamble, e.g. https://foo.bar:3444
 	// path should be an absolute URI path, i.e. /foo/bar/baz
-	HeadTo(ctx context.Context, host string, path string) (http.Header, int, error)
+	HeadTo(ctx context.Context, host string, path string, opts ...RequestOption) (http.Header, int, error)
 }
 
 // HeadRequester defines HTTP Head interface
@@ -85,7 +93,7 @@ type HeadRequester interface {
 	// Head makes HEAD request.
 	// path should be an absolute URI path, i.e. /foo/bar/baz
 	// The client must be configured with the hosts list.
-	Head(ctx context.Context, path string) (http.Header, int, error)
+	Head(ctx context.Context, path string, opts ...RequestOption) (http.Header, int, error)
 }
 
 // GetRequester defines HTTP Get interface
@@ -95,7 +103,7 @@ type GetRequester interface {
 	// the resulting HTTP body will be decoded into the supplied body parameter, and the
 	// http status code returned.
 	// The client must be configured with the hosts list.
-	Get(ctx context.Context, path string, body interface{}) (http.Header, int, error)
+	Get(ctx context.Context, path string, body interface{}, opts ...RequestOption) (http.Header, int, error)
 }
 
 // PostRequester defines HTTP Post interface
@@ -106,7 +114,7 @@ type PostRequester interface {
 	// into a go error, waits & retries for rate limiting errors will be applied based on the
 	// client config.
 	// path should be an absolute URI path, i.e. /foo/bar/baz
-	Post(ctx context.Context, path string, requestBody interface{}, responseBody interface{}) (http.Header, int, error)
+	Post(ctx context.Context, path string, requestBody interface{}, responseBody interface{}, opts ...RequestOption) (http.Header, int, error)
 }
 
 // PutRequester defines HTTP Put interface
@@ -117,7 +125,7 @@ type PutRequester interface {
 	// into a go error, waits & retries for rate limiting errors will be applied based on the
 	// client config.
 	// path should be an absolute URI path, i.e. /foo/bar/baz
-	Put(ctx context.Context, path string, requestBody interface{}, responseBody interface{}) (http.Header, int, error)
+	Put(ctx context.Context, path string, requestBody interface{}, responseBody interface{}, opts ...RequestOption) (http.Header, int, error)
 }
 
 // DeleteRequester defines HTTP Delete interface
@@ -126,7 +134,7 @@ type DeleteRequester interface {
 	// path should be an absolute URI path, i.e. /foo/bar/baz
 	// the resulting HTTP body will be decoded into the supplied body parameter, and the
 	// http status code returned.
-	Delete(ctx context.Context, path string, body interface{}) (http.Header, int, error)
+	Delete(ctx context.Context, path string, body interface{}, opts ...RequestOption) (http.Header, int, error)
 }
 
 // HTTPClient defines a number of generalized HTTP request handling wrappers
@@ -175,8 +183,44 @@ type Policy struct {
 	// Maximum number of retries.
 	TotalRetryLimit int
 
+	// RequestTimeout limits the overall time of the request,
+	// including all retries and reading the response body
 	RequestTimeout time.Duration
 
+	// PerAttemptTimeout limits the time of a single attempt,
+	// the timed out attempt is retried as a connection error
+	PerAttemptTimeout time.Duration
+
+	// RetryNonIdempotent allows to retry POST and PATCH requests
+	// without Idempotency-Key on connection errors,
+	// after the request may have been sent
+	RetryNonIdempotent bool
+
+	// Backoff computes the delay before the next retry from the wait duration
+	// of the status code, if not set, the wait duration is used as is
+	Backoff Backoff
+
+	// MaxBackoff caps the delay before the next retry
+	MaxBackoff time.Duration
+
+	// HonorRetryAfter uses the delay from Retry-After header of 429 and 503 responses,
+	// waits at least for X-Processing-Hint of the retried responses,
+	// and allows to retry 429 responses if the policy has ShouldRetry for it
+	HonorRetryAfter bool
+
+	// HedgeDelay enables hedged requests for idempotent methods:
+	// if no response is received within the delay,
+	// a duplicate request is sent, and the first response is used
+	HedgeDelay time.Duration
+
+	// MaxHedges limits the number of duplicate requests per attempt,
+	// default is 1
+	MaxHedges int
+
+	// HedgeHosts specifies the hosts for the duplicate requests,
+	// used in order; by default the host of the request is used
+	HedgeHosts []string
+
 	NonRetriableErrors []string
 }
 
@@ -300,6 +344,25 @@ func WithCallerIdentity(ci credentials.CallerIdentity) ClientOption {
 	})
 }
 
+// WithClock is a ClientOption that specifies the time source
+// for the token expiry checks and the audit records, by default clock.System is used.
+func WithClock(clk clock.Clock) ClientOption {
+	return optionFunc(func(c *Client) {
+		c.clock = clock.OrSystem(clk)
+	})
+}
+
+// WithRedactor is a ClientOption that specifies redaction of secrets
+// in the request and response dumps in DEBUG logs,
+// by default redact.Default is used, nil disables redaction.
+//
+//	retriable.New(retriable.WithRedactor(r))
+func WithRedactor(r *redact.Redactor) ClientOption {
+	return optionFunc(func(c *Client) {
+		c.redactor = r
+	})
+}
+
 // Client is custom implementation of http.Client
 type Client struct {
 	Name             string
@@ -316,8 +379,36 @@ type Client struct {
 	beforeSend BeforeSendRequest
 	dpopSigner dpop.Signer
 
+	// hostTLS is TLS config per host
+	hostTLS map[string]*tls.Config
+	// hostClients is the cache of HTTP clients per host and server name
+	hostClients map[string]*http.Client
+	// pins is the set of pinned SPKI hashes
+	pins map[string]bool
+	// redactor redacts secrets in debug logs
+	redactor *redact.Redactor
+	// budget limits the retries
+	budget *RetryBudget
+	// listeners receive the request lifecycle events
+	listeners []EventListener
+	// middlewares wrap each attempt of the request
+	middlewares []Middleware
+	// contracts validate the responses
+	contracts *Contracts
+	// clock is the time source of the token expiry checks
+	clock clock.Clock
+	// dialer specifies the dual-stack behavior of the connections
+	dialer *DialerConfig
+	// dns is the custom DNS server
+	dns string
+	// dnsCache caches the resolved addresses
+	dnsCache *DNSCache
+
 	token          credentials.Token
 	callerIdentity credentials.CallerIdentity
+
+	graphQLPath      string
+	graphQLPersisted bool
 }
 
 // Default creates a default Client for the given host
@@ -337,24 +428,56 @@ func New(cfg ClientConfig, opts ...ClientOption) (*Client, error) {
 	}
 
 	if cfg.TLS != nil {
-		tlscfg, err := tlsconfig.NewClientTLSFromFiles(
-			cfg.TLS.CertFile,
-			cfg.TLS.KeyFile,
-			cfg.TLS.TrustedCAFile,
-		)
+		tlscfg, err := cfg.TLS.TLSConfig()
 		if err != nil {
-			return nil, errors.WithMessagef(err, "failed to load TLS config")
+			return nil, err
 		}
 		dopts = append(dopts, WithTLS(tlscfg))
 	}
 
+	for host, info := range cfg.HostTLS {
+		tlscfg, err := info.TLSConfig()
+		if err != nil {
+			return nil, errors.WithMessagef(err, "host %s", host)
+		}
+		dopts = append(dopts, WithHostTLS(host, tlscfg))
+	}
+
 	if cfg.Request != nil {
 		pol := DefaultPolicy()
 		pol.RequestTimeout = cfg.Request.Timeout
+		pol.PerAttemptTimeout = cfg.Request.PerAttemptTimeout
 		pol.TotalRetryLimit = cfg.Request.RetryLimit
+		pol.MaxBackoff = cfg.Request.MaxBackoff
+		pol.HonorRetryAfter = cfg.Request.HonorRetryAfter
+		pol.HedgeDelay = cfg.Request.HedgeDelay
+		pol.MaxHedges = cfg.Request.MaxHedges
+		pol.HedgeHosts = cfg.Request.HedgeHosts
+		if cfg.Request.Backoff != "" {
+			backoff, err := BackoffByName(cfg.Request.Backoff)
+			if err != nil {
+				return nil, err
+			}
+			pol.Backoff = backoff
+		}
 		dopts = append(dopts, WithPolicy(pol))
 	}
 
+	if cfg.RetryBudget != nil {
+		dopts = append(dopts, WithRetryBudget(NewRetryBudget(*cfg.RetryBudget)))
+	}
+
+	if cfg.DNSCache != nil {
+		dopts = append(dopts, WithDNSCache(NewDNSCache(*cfg.DNSCache, nil)))
+	}
+
+	if cfg.Dialer != nil {
+		if err := cfg.Dialer.Validate(); err != nil {
+			return nil, err
+		}
+		dopts = append(dopts, WithDialer(*cfg.Dialer))
+	}
+
 	dopts = append(dopts, opts...)
 
 	c := &Client{
@@ -362,8 +485,10 @@ func New(cfg ClientConfig, opts ...ClientOption) (*Client, error) {
 		httpClient: &http.Client{
 			//Timeout: time.Second * 30,
 		},
-		Policy: DefaultPolicy(),
-		Config: cfg,
+		Policy:   DefaultPolicy(),
+		Config:   cfg,
+		redactor: redact.Default,
+		clock:    clock.System,
 	}
 
 	for _, opt := range dopts {
@@ -461,9 +586,10 @@ func (c *Client) WithCallerIdentity(ci credentials.CallerIdentity) *Client {
 
 // WithTLS modifies TLS configuration.
 func (c *Client) WithTLS(tlsConfig *tls.Config) *Client {
-	c.lock.RLock()
-	defer c.lock.RUnlock()
+	c.lock.Lock()
+	defer c.lock.Unlock()
 
+	tlsConfig = c.pinned(tlsConfig)
 	if c.httpClient.Transport == nil {
 		tr := http.DefaultTransport.(*http.Transport).Clone()
 		tr.MaxIdleConnsPerHost = 100
@@ -478,14 +604,16 @@ func (c *Client) WithTLS(tlsConfig *tls.Config) *Client {
 		c.httpClient.Transport.(*http.Transport).TLSClientConfig = tlsConfig
 		logger.KV(xlog.DEBUG, "reason", "update_transport")
 	}
+	c.hostClients = nil
 	return c
 }
 
 // WithTransport modifies HTTP Transport configuration.
 func (c *Client) WithTransport(transport http.RoundTripper) *Client {
-	c.lock.RLock()
-	defer c.lock.RUnlock()
+	c.lock.Lock()
+	defer c.lock.Unlock()
 	c.httpClient.Transport = transport
+	c.hostClients = nil
 	return c
 }
 
@@ -510,30 +638,10 @@ func (c *Client) WithUserAgent(name string) *Client {
 // WithDNSServer modifies DNS server.
 // dns must be specified in <host>:<port> format
 func (c *Client) WithDNSServer(dns string) *Client {
-	c.lock.RLock()
-	defer c.lock.RUnlock()
-
-	if c.httpClient.Transport == nil {
-		tr := http.DefaultTransport.(*http.Transport).Clone()
-		tr.MaxIdleConnsPerHost = 100
-		tr.MaxConnsPerHost = 100
-		tr.MaxIdleConns = 100
-
-		c.httpClient.Transport = tr
-	} else {
-		logger.KV(xlog.DEBUG, "reason", "update_transport")
-	}
-	c.httpClient.Transport.(*http.Transport).DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
-		d := net.Dialer{}
-		d.Resolver = &net.Resolver{
-			PreferGo: true,
-			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
-				d := net.Dialer{}
-				return d.DialContext(ctx, network, dns)
-			},
-		}
-		return d.DialContext(ctx, network, addr)
-	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.dns = dns
+	c.setDialContext()
 	return c
 }
 
@@ -581,14 +689,14 @@ func DefaultPolicy() Policy {
 }
 
 // RequestURL is similar to Request but uses raw URL to one host
-func (c *Client) RequestURL(ctx context.Context, method, rawURL string, requestBody interface{}, responseBody interface{}) (http.Header, int, error) {
+func (c *Client) RequestURL(ctx context.Context, method, rawURL string, requestBody interface{}, responseBody interface{}, opts ...RequestOption) (http.Header, int, error) {
 	u, err := url.Parse(rawURL)
 	if err != nil {
 		return nil, 0, errors.WithStack(err)
 	}
 	host := u.Scheme + "://" + u.Host
 	path := rawURL[len(host):]
-	return c.Request(ctx, method, host, path, requestBody, responseBody)
+	return c.Request(ctx, method, host, path, requestBody, responseBody, opts...)
 }
 
 // Request sends request to the specified hosts.
@@ -603,7 +711,10 @@ func (c *Client) RequestURL(ctx context.Context, method, rawURL string, requestB
 // path should be an absolute URI path, i.e. /foo/bar/baz
 // requestBody can be io.Reader, []byte, or an object to be JSON encoded
 // responseBody can be io.Writer, or a struct to decode JSON into.
-func (c *Client) Request(ctx context.Context, method string, host string, path string, requestBody interface{}, responseBody interface{}) (http.Header, int, error) {
+// opts override the client defaults for the call.
+func (c *Client) Request(ctx context.Context, method string, host string, path string, requestBody interface{}, responseBody interface{}, opts ...RequestOption) (http.Header, int, error) {
+	ctx = c.withRequestOptions(ctx, opts)
+
 	var body io.ReadSeeker
 
 	if requestBody != nil {
@@ -621,6 +732,14 @@ func (c *Client) Request(ctx context.Context, method string, host string, path s
 		case string:
 			body = strings.NewReader(val)
 		default:
+			if codec := codecFromContext(ctx); codec != nil {
+				buf := bytes.Buffer{}
+				if err := codec.Encode(&buf, requestBody); err != nil {
+					return nil, 0, errors.WithStack(err)
+				}
+				body = bytes.NewReader(buf.Bytes())
+				break
+			}
 			js, err := json.Marshal(requestBody)
 			if err != nil {
 				return nil, 0, errors.WithStack(err)
@@ -637,24 +756,27 @@ func (c *Client) Request(ctx context.Context, method string, host string, path s
 	if c.nonceProvider != nil {
 		c.nonceProvider.SetFromHeader(resp.Header)
 	}
+	if meta := responseMetaFromContext(ctx); meta != nil {
+		*meta = *ParseResponseMeta(resp)
+	}
 
 	return c.DecodeResponse(resp, responseBody)
 }
 
 var noop context.CancelFunc = func() {}
 
-func (c *Client) ensureContext(ctx context.Context, httpMethod, path string) (context.Context, context.CancelFunc) {
+func (c *Client) ensureContext(ctx context.Context, httpMethod, path string) context.Context {
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	if c.Policy.RequestTimeout > 0 {
+	if pol := c.policy(ctx); pol.RequestTimeout > 0 || pol.PerAttemptTimeout > 0 {
 		logger.KV(xlog.DEBUG,
 			"method", httpMethod,
-			"path", path,
-			"timeout", c.Policy.RequestTimeout)
-		return context.WithTimeout(ctx, c.Policy.RequestTimeout)
+			"path", c.redactor.Query(path),
+			"timeout", pol.RequestTimeout,
+			"per_attempt_timeout", pol.PerAttemptTimeout)
 	}
-	return ctx, noop
+	return ctx
 }
 
 func (c *Client) executeRequest(ctx context.Context, httpMethod string, host string, path string, body io.ReadSeeker) (*http.Response, error) {
@@ -665,9 +787,7 @@ func (c *Client) executeRequest(ctx context.Context, httpMethod string, host str
 	var err error
 	var resp *http.Response
 
-	// NOTE: do not `defer cancel()` context as it will cause error
-	// when reading the body
-	ctx, _ = c.ensureContext(ctx, httpMethod, path)
+	ctx = c.ensureContext(ctx, httpMethod, path)
 	ctx = correlation.WithID(ctx)
 
 	resp, err = c.doHTTP(ctx, httpMethod, host, path, body)
@@ -676,14 +796,14 @@ func (c *Client) executeRequest(ctx context.Context, httpMethod string, host str
 			"client", c.Name,
 			"method", httpMethod,
 			"host", host,
-			"path", path,
+			"path", c.redactor.Query(path),
 			"err", err)
 	} else {
 		logger.ContextKV(ctx, xlog.DEBUG,
 			"client", c.Name,
 			"method", httpMethod,
 			"host", host,
-			"path", path,
+			"path", c.redactor.Query(path),
 			"status", resp.StatusCode)
 	}
 
@@ -728,6 +848,20 @@ func (c *Client) convertRequest(req *http.Request) (*Request, error) {
 				}
 		*/
 	}
+	if ro := requestOptionsFromContext(ctx); ro != nil {
+		for header, val := range ro.headers {
+			req.Header.Set(header, val)
+		}
+	}
+
+	if codec := codecFromContext(ctx); codec != nil {
+		if req.Header.Get(header.ContentType) == "" {
+			req.Header.Set(header.ContentType, codec.ContentType())
+		}
+		if req.Header.Get(header.Accept) == "" {
+			req.Header.Set(header.Accept, codec.ContentType())
+		}
+	}
 
 	if req.Header.Get(header.XCorrelationID) == "" {
 		req.Header.Add(header.XCorrelationID, correlation.ID(ctx))
@@ -737,7 +871,7 @@ func (c *Client) convertRequest(req *http.Request) (*Request, error) {
 	}
 
 	if c.callerIdentity != nil {
-		if c.token.AccessToken == "" || (c.token.Expires != nil && c.token.Expires.Before(time.Now())) {
+		if c.token.AccessToken == "" || (c.token.Expires != nil && c.token.Expires.Before(c.clock.Now())) {
 			ti, err := c.callerIdentity.GetCallerIdentity(ctx)
 			if err != nil {
 				return nil, err
@@ -745,7 +879,7 @@ func (c *Client) convertRequest(req *http.Request) (*Request, error) {
 			c.token = *ti
 		}
 
-		if c.token.AccessToken != "" && (c.token.Expires == nil || c.token.Expires.After(time.Now())) {
+		if c.token.AccessToken != "" && (c.token.Expires == nil || c.token.Expires.After(c.clock.Now())) {
 			authHeader := c.token.AccessToken
 			if c.token.TokenType != "" {
 				authHeader = c.token.TokenType + " " + authHeader
@@ -797,11 +931,33 @@ func (c *Client) Do(r *http.Request) (*http.Response, error) {
 		return nil, err
 	}
 
+	// the overall deadline applies to all attempts,
+	// and to reading the body of the returned response
+	ctx, cancel := c.requestContext(r.Context())
+	attemptCtx, cancelAttempt := ctx, noop
+
+	if c.budget != nil {
+		c.budget.Deposit()
+	}
+
+	c.lock.RLock()
+	listeners := c.listeners
+	middlewares := c.middlewares
+	c.lock.RUnlock()
+
+	for _, l := range listeners {
+		l.OnRequestStart(&RequestStartEvent{Client: c.Name, Request: r})
+	}
+
+	requestStarted := time.Now()
+	roundTrip := roundTripChain(c.clientFor(req.Request).Do, middlewares)
+loop:
 	for retries = 0; ; retries++ {
 		// Always rewind the request body when non-nil.
 		if req.body != nil {
 			body, err := req.body()
 			if err != nil {
+				cancel()
 				return resp, err
 			}
 			if c, ok := body.(io.ReadCloser); ok {
@@ -811,8 +967,16 @@ func (c *Client) Do(r *http.Request) (*http.Response, error) {
 			}
 		}
 
+		attemptCtx, cancelAttempt = c.attemptContext(ctx)
+		var sent atomic.Bool
+		req.Request = req.Request.WithContext(withSentTrace(attemptCtx, &sent))
+
 		started := time.Now()
-		resp, err = c.httpClient.Do(req.Request)
+		if c.canHedge(req) {
+			resp, err = c.hedgedRoundTrip(middlewares, req)
+		} else {
+			resp, err = roundTrip(req.Request)
+		}
 		elapsed := time.Since(started)
 		if err != nil {
 			logger.ContextKV(r.Context(), xlog.WARNING,
@@ -822,13 +986,57 @@ func (c *Client) Do(r *http.Request) (*http.Response, error) {
 				"elapsed", elapsed.String(),
 				"err", err.Error())
 		}
-		// Check if we should continue with retries.
-		shouldRetry, sleepDuration, reason := c.Policy.ShouldRetry(req.Request, resp, err, retries)
+		for _, l := range listeners {
+			l.OnAttempt(&AttemptEvent{
+				Client:     c.Name,
+				Request:    req.Request,
+				Attempt:    retries,
+				StatusCode: statusCode(resp),
+				Err:        err,
+				Elapsed:    elapsed,
+			})
+		}
+		// Check if we should continue with retries,
+		// the attempt timeout is retriable within the overall deadline
+		shouldRetry, sleepDuration, reason := c.policy(ctx).ShouldRetry(req.Request.WithContext(ctx), resp, err, retries)
 		if !shouldRetry {
 			break
 		}
+		if err != nil && sent.Load() && !c.canRetrySent(req.Request) {
+			logger.ContextKV(r.Context(), xlog.WARNING,
+				"client", c.Name,
+				"retries", retries,
+				"host", req.Host,
+				"method", req.Request.Method,
+				"reason", NonIdempotent)
+			break
+		}
+		if !c.withdrawRetry() {
+			logger.ContextKV(r.Context(), xlog.WARNING,
+				"client", c.Name,
+				"retries", retries,
+				"host", req.Host,
+				"reason", BudgetExhausted,
+				"retry_reason", reason)
+			if err != nil {
+				err = &RetryBudgetError{Err: err}
+			}
+			break
+		}
 
-		desc := fmt.Sprintf("%s %s", req.Request.Method, req.Request.URL)
+		for _, l := range listeners {
+			l.OnRetryScheduled(&RetryScheduledEvent{
+				Client:     c.Name,
+				Request:    req.Request,
+				Attempt:    retries,
+				StatusCode: statusCode(resp),
+				Err:        err,
+				Reason:     reason,
+				Delay:      sleepDuration,
+			})
+		}
+
+		desc := fmt.Sprintf("%s %s", req.Request.Method, c.redactor.URL(req.Request.URL))
 		if resp != nil {
 			if resp.Status != "" {
 				desc += " "
@@ -836,6 +1044,7 @@ func (c *Client) Do(r *http.Request) (*http.Response, error) {
 			}
 			c.consumeResponseBody(resp)
 		}
+		cancelAttempt()
 
 		logger.ContextKV(r.Context(), xlog.WARNING,
 			"client", c.Name,
@@ -844,12 +1053,47 @@ func (c *Client) Do(r *http.Request) (*http.Response, error) {
 			"reason", reason,
 			"sleep", sleepDuration)
 
-		time.Sleep(sleepDuration)
+		if werr := backoff.Wait(ctx, sleepDuration); werr != nil {
+			resp, err = nil, errors.WithStack(werr)
+			break loop
+		}
 	}
 
-	debugRequest(req.Request, err != nil)
+	c.debugRequest(req.Request, err != nil)
 
-	return resp, err
+	if err != nil {
+		err = c.timeoutError(r.Context(), ctx, attemptCtx, err)
+		cancelAttempt()
+		cancel()
+		for _, l := range listeners {
+			l.OnError(&ErrorEvent{
+				Client:   c.Name,
+				Request:  req.Request,
+				Err:      err,
+				Attempts: retries + 1,
+				Elapsed:  time.Since(requestStarted),
+			})
+		}
+		return resp, err
+	}
+	for _, l := range listeners {
+		l.OnResponse(&ResponseEvent{
+			Client:   c.Name,
+			Request:  req.Request,
+			Response: resp,
+			Attempts: retries + 1,
+			Elapsed:  time.Since(requestStarted),
+		})
+	}
+	if rwc, ok := resp.Body.(io.ReadWriteCloser); ok && resp.StatusCode == http.StatusSwitchingProtocols {
+		resp.Body = &cancelUpgradeBody{ReadWriteCloser: rwc, cancel: []context.CancelFunc{cancelAttempt, cancel}}
+	} else if resp.Body != nil {
+		resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: []context.CancelFunc{cancelAttempt, cancel}}
+	} else {
+		cancelAttempt()
+		cancel()
+	}
+	return resp, nil
 }
 
 // consumeResponseBody is a helper to safely consume the remaining response body
@@ -859,24 +1103,24 @@ func (c *Client) consumeResponseBody(r *http.Response) {
 	}
 }
 
-func debugRequest(r *http.Request, body bool) {
+func (c *Client) debugRequest(r *http.Request, body bool) {
 	if logger.LevelAt(xlog.DEBUG) {
 		b, err := httputil.DumpRequestOut(r, body)
 		if err != nil {
 			logger.ContextKV(r.Context(), xlog.ERROR, "err", err.Error())
 		} else {
-			logger.Debug(string(b))
+			logger.Debug(string(c.redactor.Dump(b)))
 		}
 	}
 }
 
-func debugResponse(w *http.Response, body bool) {
+func (c *Client) debugResponse(w *http.Response, body bool) {
 	if logger.LevelAt(xlog.DEBUG) {
 		b, err := httputil.DumpResponse(w, body)
 		if err != nil {
 			logger.KV(xlog.ERROR, "err", err.Error())
 		} else {
-			logger.Debug(string(b))
+			logger.Debug(string(c.redactor.Dump(b)))
 		}
 	}
 }
@@ -885,10 +1129,28 @@ func debugResponse(w *http.Response, body bool) {
 // the body parameters, or to an error
 // [retrying rate limit errors should be done before this]
 func (c *Client) DecodeResponse(resp *http.Response, body interface{}) (http.Header, int, error) {
-	debugResponse(resp, resp.StatusCode >= 300)
+	c.debugResponse(resp, resp.StatusCode >= 300)
 	if resp.StatusCode == http.StatusNoContent {
 		return resp.Header, resp.StatusCode, nil
-	} else if resp.StatusCode >= http.StatusMultipleChoices { // 300
+	}
+
+	if c.contracts != nil {
+		if err := c.contracts.check(resp); err != nil {
+			return resp.Header, resp.StatusCode, err
+		}
+	}
+
+	codec := responseCodec(resp)
+	if codec == TextCodec && (resp.StatusCode >= http.StatusMultipleChoices || !isTextTarget(body)) {
+		// JSON written without Content-Type is sniffed as text/plain,
+		// the errors and the structured targets are decoded as JSON
+		codec = nil
+	}
+	if codec != nil && codec != JSONCodec {
+		return decodeResponseWithCodec(codec, resp, body)
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices { // 300
 		e := new(httperror.Error)
 		e.HTTPStatus = resp.StatusCode
 		bodyCopy := bytes.Buffer{}
@@ -898,6 +1160,13 @@ func (c *Client) DecodeResponse(resp *http.Response, body interface{}) (http.Hea
 			// Unable to parse as Error, then return body as error
 			return resp.Header, resp.StatusCode, errors.New(bodyCopy.String())
 		}
+		e.RPCStatus = httperror.RPCStatusFromCode(e.Code, resp.StatusCode)
+		if d := httperror.ParseRetryAfter(resp.Header.Get(header.RetryAfter)); d > 0 {
+			e.WithRetryAfter(d)
+		}
+		if d := httperror.ParseRetryAfter(resp.Header.Get(header.XProcessingHint)); d > 0 {
+			e.WithProcessingHint(d)
+		}
 		return resp.Header, resp.StatusCode, e
 	}
 
@@ -938,6 +1207,7 @@ var DefaultNonRetriableErrors = []string{
 	"server gave HTTP response to HTTPS client",
 	"dial tcp: lookup",
 	"peer reset",
+	"unable to get access token",
 }
 
 // ShouldRetry returns if connection should be retried
@@ -986,7 +1256,7 @@ func (p *Policy) ShouldRetry(r *http.Request, resp *http.Response, err error, re
 
 		// On error, use 0 code
 		if fn, ok := p.Retries[0]; ok {
-			return fn(r, resp, err, retries)
+			return p.retry(fn, r, resp, err, retries)
 		}
 		return false, 0, NonRetriableError
 	}
@@ -1011,6 +1281,9 @@ func (p *Policy) ShouldRetry(r *http.Request, resp *http.Response, err error, re
 	}
 
 	if resp.StatusCode == 429 {
+		if fn, ok := p.Retries[429]; ok && p.HonorRetryAfter {
+			return p.retry(fn, r, resp, err, retries)
+		}
 		return false, 0, LimitExceeded
 	}
 
@@ -1019,12 +1292,21 @@ func (p *Policy) ShouldRetry(r *http.Request, resp *http.Response, err error, re
 	}
 
 	if fn, ok := p.Retries[resp.StatusCode]; ok {
-		return fn(r, resp, err, retries)
+		return p.retry(fn, r, resp, err, retries)
 	}
 
 	return false, 0, NonRetriableError
 }
 
+// retry calls ShouldRetry and applies the backoff to the wait duration
+func (p *Policy) retry(fn ShouldRetry, r *http.Request, resp *http.Response, err error, retries int) (bool, time.Duration, string) {
+	ok, wait, reason := fn(r, resp, err, retries)
+	if ok {
+		wait = p.backoff(resp, wait, retries)
+	}
+	return ok, wait, reason
+}
+
 // PropagateHeadersFromRequest will set specified headers in the context,
 // if present in the request
 func PropagateHeadersFromRequest(ctx context.Context, r *http.Request, headers ...string) context.Context {
@@ -28,6 +28,7 @@ import (
 	"github.com/effective-security/xpki/testca"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
 )
 
 var (
@@ -810,6 +811,26 @@ func Test_DecodeResponse(t *testing.T) {
 	assert.Equal(t, "MY_CODE", ge.Code)
 	assert.Equal(t, "doesn't exist", ge.Message)
 	assert.Equal(t, http.StatusNotFound, ge.HTTPStatus)
+	assert.Equal(t, codes.NotFound, ge.RPCStatus)
+
+	// error with details and Retry-After
+	res = http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": []string{"5"}, "X-Processing-Hint": []string{"7"}},
+		Body: io.NopCloser(bytes.NewBufferString(
+			`{"code":"rate_limit_exceeded","message":"slow down","details":{"domain":"porto","violations":[{"field":"count","description":"too many"}]}}`)),
+	}
+	_, _, err = c.DecodeResponse(&res, &body)
+	require.Error(t, err)
+	ge, ok = err.(*httperror.Error)
+	require.True(t, ok)
+	assert.Equal(t, codes.ResourceExhausted, ge.RPCStatus)
+	assert.Equal(t, 5*time.Second, ge.RetryAfter())
+	assert.Equal(t, 7*time.Second, ge.ProcessingHint())
+	require.NotNil(t, ge.Details)
+	assert.Equal(t, "porto", ge.Details.Domain)
+	assert.Equal(t, []*httperror.FieldViolation{{Field: "count", Description: "too many"}}, ge.Details.Violations)
+	res.StatusCode = http.StatusNotFound
 
 	// if the body isn't valid json, we should get returned a json parser error, as well as the body
 	invalidResponse := `["foo"}`
@@ -896,3 +917,65 @@ func makeTestHandlerSlow(t *testing.T, expURI string, status int, delay time.Dur
 	}
 	return http.HandlerFunc(h)
 }
+
+func Test_RetriableRedactDebug(t *testing.T) {
+	xlog.SetGlobalLogLevel(xlog.DEBUG)
+	defer xlog.SetGlobalLogLevel(xlog.TRACE)
+
+	var buf bytes.Buffer
+	f := xlog.GetFormatter()
+	xlog.SetFormatter(xlog.NewStringFormatter(&buf))
+	defer xlog.SetFormatter(f)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"refresh_token":"0123456789abcdef"}`))
+	}))
+	defer server.Close()
+
+	call := func(opts ...retriable.ClientOption) string {
+		buf.Reset()
+		client, err := retriable.New(retriable.ClientConfig{}, opts...)
+		require.NoError(t, err)
+		client.AddHeader("Authorization", "Bearer 0123456789abcdef")
+
+		w := bytes.NewBuffer([]byte{})
+		_, _, err = client.Request(context.Background(), http.MethodPost, server.URL, "/v1/test?access_token=0123456789abcdef", `{"password":"pwd"}`, w)
+		require.Error(t, err)
+		return buf.String()
+	}
+
+	logs := call()
+	assert.Contains(t, logs, "access_token=****cdef")
+	assert.Contains(t, logs, "Authorization: ****cdef")
+	assert.Contains(t, logs, `\"refresh_token\":\"****cdef\"`)
+	assert.NotContains(t, logs, "0123456789abcdef")
+
+	logs = call(retriable.WithRedactor(nil))
+	assert.Contains(t, logs, "Authorization: Bearer 0123456789abcdef")
+}
+
+func Test_DecodeResponseExtensions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		marshal.WriteJSON(w, r, httperror.Conflict("version mismatch").
+			WithExtension("current_version", 7).
+			WithExtension("resource", map[string]any{"id": "123"}))
+	}))
+	defer server.Close()
+
+	client, err := retriable.New(retriable.ClientConfig{Host: server.URL})
+	require.NoError(t, err)
+
+	var body map[string]any
+	_, _, err = client.Get(context.Background(), "/v1/items/123", &body)
+	require.Error(t, err)
+
+	ge, ok := err.(*httperror.Error)
+	require.True(t, ok)
+	assert.Equal(t, httperror.CodeConflict, ge.Code)
+	assert.Equal(t, "version mismatch", ge.Message)
+	assert.Equal(t, map[string]any{
+		"current_version": float64(7),
+		"resource":        map[string]any{"id": "123"},
+	}, ge.Extensions)
+}
@@ -0,0 +1,184 @@
+package retriable
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"net/http"
+	"strings"
+
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/pkg/errors"
+)
+
+// SOAPEnvelopeNamespace is the namespace of SOAP 1.1 envelope
+const SOAPEnvelopeNamespace = "http://schemas.xmlsoap.org/soap/envelope/"
+
+// SOAPEnvelope defines SOAP envelope
+type SOAPEnvelope struct {
+	XMLName xml.Name    `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Header  *SOAPHeader `xml:"http://schemas.xmlsoap.org/soap/envelope/ Header,omitempty"`
+	Body    SOAPBody    `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+}
+
+// SOAPHeader defines SOAP header
+type SOAPHeader struct {
+	Content any `xml:",omitempty"`
+}
+
+// SOAPBody defines SOAP body, which contains either the Content,
+// or the Fault
+type SOAPBody struct {
+	Fault   *SOAPFault `xml:",omitempty"`
+	Content any        `xml:",omitempty"`
+}
+
+// SOAPFault defines SOAP fault,
+// both SOAP 1.1 and SOAP 1.2 formats are supported for decoding
+type SOAPFault struct {
+	XMLName xml.Name `xml:"Fault"`
+	// SOAP 1.1
+	Code   string `xml:"faultcode,omitempty"`
+	String string `xml:"faultstring,omitempty"`
+	Actor  string `xml:"faultactor,omitempty"`
+	Detail string `xml:"detail,omitempty"`
+	// SOAP 1.2
+	Code12   *SOAPFaultCode   `xml:"Code,omitempty"`
+	Reason12 *SOAPFaultReason `xml:"Reason,omitempty"`
+}
+
+// SOAPFaultCode defines SOAP 1.2 fault code
+type SOAPFaultCode struct {
+	Value string `xml:"Value"`
+}
+
+// SOAPFaultReason defines SOAP 1.2 fault reason
+type SOAPFaultReason struct {
+	Text string `xml:"Text"`
+}
+
+// UnmarshalXML decodes the Fault, or the Content of the body
+func (b *SOAPBody) UnmarshalXML(d *xml.Decoder, _ xml.StartElement) error {
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		switch se := token.(type) {
+		case xml.StartElement:
+			if se.Name.Local == "Fault" {
+				b.Fault = new(SOAPFault)
+				if err = d.DecodeElement(b.Fault, &se); err != nil {
+					return errors.WithStack(err)
+				}
+			} else if b.Content != nil {
+				if err = d.DecodeElement(b.Content, &se); err != nil {
+					return errors.WithStack(err)
+				}
+			} else if err = d.Skip(); err != nil {
+				return errors.WithStack(err)
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// FaultCode returns the fault code without namespace prefix
+func (f *SOAPFault) FaultCode() string {
+	code := f.Code
+	if code == "" && f.Code12 != nil {
+		code = f.Code12.Value
+	}
+	if idx := strings.LastIndex(code, ":"); idx >= 0 {
+		code = code[idx+1:]
+	}
+	return code
+}
+
+// Message returns the fault message
+func (f *SOAPFault) Message() string {
+	if f.String == "" && f.Reason12 != nil {
+		return f.Reason12.Text
+	}
+	return f.String
+}
+
+// Error returns the fault as a string
+func (f *SOAPFault) Error() string {
+	return f.FaultCode() + ": " + f.Message()
+}
+
+// HTTPError maps the fault to httperror.Error:
+// Client and Sender faults are mapped to invalid_request,
+// others are mapped to unexpected error
+func (f *SOAPFault) HTTPError(status int) *httperror.Error {
+	code := httperror.CodeUnexpected
+	switch f.FaultCode() {
+	case "Client", "Sender":
+		code = httperror.CodeInvalidRequest
+		if status < http.StatusBadRequest {
+			status = http.StatusBadRequest
+		}
+	default:
+		if status < http.StatusBadRequest {
+			status = http.StatusInternalServerError
+		}
+	}
+	return httperror.New(status, code, "%s", f.Message()).WithCause(f)
+}
+
+// ParseSOAPFault returns SOAP fault from the payload,
+// or nil if the payload is not a SOAP envelope with the fault
+func ParseSOAPFault(b []byte) *SOAPFault {
+	var env SOAPEnvelope
+	if err := xml.NewDecoder(bytes.NewReader(b)).Decode(&env); err != nil {
+		// SOAP 1.2 uses a different namespace
+		var env12 struct {
+			Body struct {
+				Fault *SOAPFault `xml:"Fault"`
+			} `xml:"Body"`
+		}
+		if err := xml.Unmarshal(b, &env12); err != nil {
+			return nil
+		}
+		return env12.Body.Fault
+	}
+	return env.Body.Fault
+}
+
+// SOAP sends SOAP 1.1 request to the specified path, with request wrapped into the envelope.
+// The Content of the response envelope is decoded into response.
+// The fault returned by the server is mapped to httperror.Error.
+func (c *Client) SOAP(ctx context.Context, path, action string, request, response any) (http.Header, int, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	headers := map[string]string{}
+	if existing, ok := ctx.Value(contextValueForHTTPHeader).(map[string]string); ok {
+		for k, v := range existing {
+			headers[k] = v
+		}
+	}
+	headers[header.SOAPAction] = `"` + action + `"`
+
+	ctx = WithCodec(WithHeaders(ctx, headers), SOAPCodec)
+
+	req := &SOAPEnvelope{
+		Body: SOAPBody{Content: request},
+	}
+	res := &SOAPEnvelope{
+		Body: SOAPBody{Content: response},
+	}
+	hdr, status, err := c.Request(ctx, http.MethodPost, c.CurrentHost(), path, req, res)
+	if err != nil {
+		return hdr, status, err
+	}
+	if res.Body.Fault != nil {
+		return hdr, status, res.Body.Fault.HTTPError(status)
+	}
+	return hdr, status, nil
+}
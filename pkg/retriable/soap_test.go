@@ -0,0 +1,155 @@
+package retriable_test
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type getPriceRequest struct {
+	XMLName xml.Name `xml:"http://example.com/stock GetPrice"`
+	Symbol  string   `xml:"Symbol"`
+}
+
+type getPriceResponse struct {
+	XMLName xml.Name `xml:"http://example.com/stock GetPriceResponse"`
+	Price   float64  `xml:"Price"`
+}
+
+const soapFault = `<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+<soap:Body>
+<soap:Fault>
+<faultcode>soap:Client</faultcode>
+<faultstring>unknown symbol</faultstring>
+</soap:Fault>
+</soap:Body>
+</soap:Envelope>`
+
+const soapResponse = `<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+<soap:Body>
+<m:GetPriceResponse xmlns:m="http://example.com/stock">
+<m:Price>34.5</m:Price>
+</m:GetPriceResponse>
+</soap:Body>
+</soap:Envelope>`
+
+func TestSOAP(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, header.TextXML, r.Header.Get(header.ContentType))
+		assert.Equal(t, `"http://example.com/GetPrice"`, r.Header.Get(header.SOAPAction))
+
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		w.Header().Set(header.ContentType, header.TextXML)
+		if strings.Contains(string(b), "<Symbol>UNKNOWN</Symbol>") {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(soapFault))
+			return
+		}
+		_, _ = w.Write([]byte(soapResponse))
+	}
+	server := httptest.NewServer(http.HandlerFunc(h))
+	defer server.Close()
+
+	client, err := retriable.Default(server.URL)
+	require.NoError(t, err)
+	client.WithPolicy(retriable.Policy{TotalRetryLimit: 0})
+
+	var res getPriceResponse
+	_, status, err := client.SOAP(context.Background(), "/stock", "http://example.com/GetPrice",
+		&getPriceRequest{Symbol: "IBM"}, &res)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 34.5, res.Price)
+
+	_, status, err = client.SOAP(context.Background(), "/stock", "http://example.com/GetPrice",
+		&getPriceRequest{Symbol: "UNKNOWN"}, &res)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusInternalServerError, status)
+	herr, ok := err.(*httperror.Error)
+	require.True(t, ok, "%T", err)
+	assert.Equal(t, httperror.CodeInvalidRequest, herr.Code)
+	assert.Equal(t, "unknown symbol", herr.Message)
+}
+
+type xmlItem struct {
+	XMLName xml.Name `xml:"item"`
+	Name    string   `xml:"name"`
+}
+
+func TestXMLContentType(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, header.ApplicationXML, r.Header.Get(header.ContentType))
+		assert.Equal(t, header.ApplicationXML, r.Header.Get(header.Accept))
+
+		var item xmlItem
+		require.NoError(t, xml.NewDecoder(r.Body).Decode(&item))
+
+		w.Header().Set(header.ContentType, header.ApplicationXML)
+		if item.Name == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`<error>bad item</error>`))
+			return
+		}
+		_ = xml.NewEncoder(w).Encode(&xmlItem{Name: item.Name + "-reply"})
+	}
+	server := httptest.NewServer(http.HandlerFunc(h))
+	defer server.Close()
+
+	client, err := retriable.Default(server.URL)
+	require.NoError(t, err)
+
+	ctx := retriable.WithContentType(context.Background(), header.ApplicationXML)
+
+	var res xmlItem
+	_, _, err = client.Post(ctx, "/v1/item", &xmlItem{Name: "test"}, &res)
+	require.NoError(t, err)
+	assert.Equal(t, "test-reply", res.Name)
+
+	_, status, err := client.Post(ctx, "/v1/item", &xmlItem{Name: "bad"}, &res)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "<error>bad item</error>", err.Error())
+}
+
+func TestCodecForContentType(t *testing.T) {
+	assert.Equal(t, retriable.JSONCodec, retriable.CodecForContentType("application/json; charset=utf-8"))
+	assert.Equal(t, retriable.XMLCodec, retriable.CodecForContentType(header.ApplicationXML))
+	assert.Equal(t, retriable.SOAPCodec, retriable.CodecForContentType(header.TextXML))
+	assert.Nil(t, retriable.CodecForContentType("application/unknown"))
+	assert.Nil(t, retriable.CodecForContentType(""))
+}
+
+func TestParseSOAPFault(t *testing.T) {
+	f := retriable.ParseSOAPFault([]byte(soapFault))
+	require.NotNil(t, f)
+	assert.Equal(t, "Client", f.FaultCode())
+	assert.Equal(t, "Client: unknown symbol", f.Error())
+
+	f = retriable.ParseSOAPFault([]byte(`<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope">
+<env:Body><env:Fault>
+<env:Code><env:Value>env:Receiver</env:Value></env:Code>
+<env:Reason><env:Text xml:lang="en">failed</env:Text></env:Reason>
+</env:Fault></env:Body></env:Envelope>`))
+	require.NotNil(t, f)
+	assert.Equal(t, "Receiver", f.FaultCode())
+	assert.Equal(t, "failed", f.Message())
+	assert.Equal(t, httperror.CodeUnexpected, f.HTTPError(200).Code)
+	assert.Equal(t, http.StatusInternalServerError, f.HTTPError(200).HTTPStatus)
+
+	assert.Nil(t, retriable.ParseSOAPFault([]byte(`<error>bad</error>`)))
+	assert.Nil(t, retriable.ParseSOAPFault([]byte(`not xml`)))
+}
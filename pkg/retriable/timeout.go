@@ -0,0 +1,109 @@
+package retriable
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Timeout limits reported in TimeoutError
+const (
+	// LimitContext is reported when the deadline of the caller's context is exceeded
+	LimitContext = "context"
+	// LimitRequestTimeout is reported when Policy.RequestTimeout is exceeded
+	LimitRequestTimeout = "request_timeout"
+	// LimitPerAttemptTimeout is reported when Policy.PerAttemptTimeout
+	// is exceeded on the last attempt
+	LimitPerAttemptTimeout = "per_attempt_timeout"
+)
+
+// TimeoutError is returned when the request is timed out,
+// and specifies the limit that triggered
+type TimeoutError struct {
+	// Limit is one of LimitContext, LimitRequestTimeout, LimitPerAttemptTimeout
+	Limit string
+	// Timeout is the configured timeout, or zero for LimitContext
+	Timeout time.Duration
+	// Err is the original error
+	Err error
+}
+
+// Error returns the error message
+func (e *TimeoutError) Error() string {
+	if e.Timeout > 0 {
+		return fmt.Sprintf("%s of %v exceeded: %s", e.Limit, e.Timeout, e.Err.Error())
+	}
+	return fmt.Sprintf("%s deadline exceeded: %s", e.Limit, e.Err.Error())
+}
+
+// Unwrap returns the original error
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// requestContext returns the overall context of the request,
+// limited by Policy.RequestTimeout
+func (c *Client) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if timeout := c.policy(ctx).RequestTimeout; timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// attemptContext returns the context of a single attempt,
+// limited by Policy.PerAttemptTimeout
+func (c *Client) attemptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if timeout := c.policy(ctx).PerAttemptTimeout; timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return ctx, noop
+}
+
+// timeoutError returns TimeoutError if err is caused by one of the limits,
+// otherwise err is returned as is
+func (c *Client) timeoutError(parent, ctx, attemptCtx context.Context, err error) error {
+	if err == nil || !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	pol := c.policy(parent)
+	switch {
+	case parent.Err() != nil:
+		return &TimeoutError{Limit: LimitContext, Err: err}
+	case ctx.Err() != nil:
+		return &TimeoutError{Limit: LimitRequestTimeout, Timeout: pol.RequestTimeout, Err: err}
+	case attemptCtx.Err() != nil:
+		return &TimeoutError{Limit: LimitPerAttemptTimeout, Timeout: pol.PerAttemptTimeout, Err: err}
+	}
+	return err
+}
+
+// cancelBody cancels the request contexts when the response body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel []context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	for _, cancel := range b.cancel {
+		cancel()
+	}
+	return err
+}
+
+// cancelUpgradeBody is the writable body of 101 Switching Protocols response
+type cancelUpgradeBody struct {
+	io.ReadWriteCloser
+	cancel []context.CancelFunc
+}
+
+func (b *cancelUpgradeBody) Close() error {
+	err := b.ReadWriteCloser.Close()
+	for _, cancel := range b.cancel {
+		cancel()
+	}
+	return err
+}
@@ -0,0 +1,129 @@
+package retriable_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeouts(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first attempt is slow
+		if atomic.AddInt32(&count, 1) == 1 {
+			time.Sleep(500 * time.Millisecond)
+		}
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer server.Close()
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	}))
+	defer slow.Close()
+
+	retry := map[int]retriable.ShouldRetry{
+		0: retriable.DefaultShouldRetryFactory(3, 10*time.Millisecond, "connection"),
+	}
+
+	newClient := func(pol retriable.Policy) *retriable.Client {
+		pol.Retries = retry
+		pol.TotalRetryLimit = 3
+		client, err := retriable.New(retriable.ClientConfig{}, retriable.WithPolicy(pol))
+		require.NoError(t, err)
+		return client
+	}
+
+	t.Run("attempt retried", func(t *testing.T) {
+		client := newClient(retriable.Policy{
+			RequestTimeout:    time.Second,
+			PerAttemptTimeout: 100 * time.Millisecond,
+		})
+		var res map[string]string
+		_, status, err := client.Request(context.Background(), http.MethodGet, server.URL, "/", nil, &res)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "ok", res["status"])
+		assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+	})
+
+	t.Run("per_attempt_timeout", func(t *testing.T) {
+		client := newClient(retriable.Policy{
+			PerAttemptTimeout: 50 * time.Millisecond,
+		})
+		_, _, err := client.Request(context.Background(), http.MethodGet, slow.URL, "/", nil, nil)
+		require.Error(t, err)
+		var terr *retriable.TimeoutError
+		require.True(t, errors.As(err, &terr), "%T: %v", err, err)
+		assert.Equal(t, retriable.LimitPerAttemptTimeout, terr.Limit)
+		assert.Equal(t, 50*time.Millisecond, terr.Timeout)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		assert.Contains(t, err.Error(), "per_attempt_timeout of 50ms exceeded: ")
+		assert.Contains(t, err.Error(), slow.URL)
+	})
+
+	t.Run("request_timeout", func(t *testing.T) {
+		client := newClient(retriable.Policy{
+			RequestTimeout:    120 * time.Millisecond,
+			PerAttemptTimeout: 50 * time.Millisecond,
+		})
+		_, _, err := client.Request(context.Background(), http.MethodGet, slow.URL, "/", nil, nil)
+		require.Error(t, err)
+		var terr *retriable.TimeoutError
+		require.True(t, errors.As(err, &terr), "%T: %v", err, err)
+		assert.Equal(t, retriable.LimitRequestTimeout, terr.Limit)
+		assert.Equal(t, 120*time.Millisecond, terr.Timeout)
+	})
+
+	t.Run("context", func(t *testing.T) {
+		client := newClient(retriable.Policy{
+			RequestTimeout:    time.Second,
+			PerAttemptTimeout: 200 * time.Millisecond,
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, _, err := client.Request(ctx, http.MethodGet, slow.URL, "/", nil, nil)
+		require.Error(t, err)
+		var terr *retriable.TimeoutError
+		require.True(t, errors.As(err, &terr), "%T: %v", err, err)
+		assert.Equal(t, retriable.LimitContext, terr.Limit)
+		assert.Equal(t, time.Duration(0), terr.Timeout)
+		assert.Contains(t, err.Error(), "context deadline exceeded: ")
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		client := newClient(retriable.Policy{
+			RequestTimeout: time.Second,
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		_, _, err := client.Request(ctx, http.MethodGet, slow.URL, "/", nil, nil)
+		require.Error(t, err)
+		var terr *retriable.TimeoutError
+		assert.False(t, errors.As(err, &terr))
+		assert.True(t, errors.Is(err, context.Canceled))
+	})
+
+	t.Run("body after Do", func(t *testing.T) {
+		client := newClient(retriable.Policy{
+			RequestTimeout: time.Second,
+		})
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, `{"status":"ok"}`, string(b))
+		assert.NoError(t, resp.Body.Close())
+	})
+}
@@ -0,0 +1,247 @@
+package retriable
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/effective-security/porto/gserver/credentials"
+	"github.com/effective-security/porto/x/clock"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/x/values"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+// DefaultTokenRefreshBefore specifies the default time before the token expiry,
+// when the token is refreshed
+const DefaultTokenRefreshBefore = time.Minute
+
+// TokenSource provides access tokens for outgoing requests
+type TokenSource interface {
+	// Token returns a valid access token
+	Token(ctx context.Context) (*credentials.Token, error)
+}
+
+// TokenSourceFunc is an adapter to use a function as TokenSource
+type TokenSourceFunc func(ctx context.Context) (*credentials.Token, error)
+
+// Token returns a valid access token
+func (f TokenSourceFunc) Token(ctx context.Context) (*credentials.Token, error) {
+	return f(ctx)
+}
+
+// WithTokenSource is a ClientOption that specifies the source of access tokens,
+// the token is attached to every attempt of the request
+func WithTokenSource(ts TokenSource) ClientOption {
+	return optionFunc(func(c *Client) {
+		c.WithTokenSource(ts)
+	})
+}
+
+// WithTokenSource specifies the source of access tokens,
+// the token is attached to every attempt of the request
+func (c *Client) WithTokenSource(ts TokenSource) *Client {
+	return c.Use(func(next RoundTripFn) RoundTripFn {
+		return func(r *http.Request) (*http.Response, error) {
+			t, err := ts.Token(r.Context())
+			if err != nil {
+				return nil, errors.WithMessage(err, "unable to get access token")
+			}
+			authHeader := t.AccessToken
+			if t.TokenType != "" {
+				authHeader = t.TokenType + " " + authHeader
+			}
+			r.Header.Set(header.Authorization, authHeader)
+			return next(r)
+		}
+	})
+}
+
+// cachedTokenSource caches the token until it is about to expire
+type cachedTokenSource struct {
+	src           TokenSource
+	refreshBefore time.Duration
+	clock         clock.Clock
+
+	lock  sync.Mutex
+	token *credentials.Token
+}
+
+// NewCachedTokenSource returns TokenSource that caches the token from src,
+// and refreshes it refreshBefore the expiry.
+// If the refresh fails, the cached token is returned while it's not expired.
+func NewCachedTokenSource(src TokenSource, refreshBefore time.Duration) TokenSource {
+	return newCachedTokenSource(src, refreshBefore, clock.System)
+}
+
+func newCachedTokenSource(src TokenSource, refreshBefore time.Duration, clk clock.Clock) TokenSource {
+	if refreshBefore <= 0 {
+		refreshBefore = DefaultTokenRefreshBefore
+	}
+	return &cachedTokenSource{
+		src:           src,
+		refreshBefore: refreshBefore,
+		clock:         clk,
+	}
+}
+
+// Token returns a valid access token
+func (s *cachedTokenSource) Token(ctx context.Context) (*credentials.Token, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.clock.Now()
+	t := s.token
+	if t != nil && (t.Expires == nil || now.Add(s.refreshBefore).Before(*t.Expires)) {
+		return t, nil
+	}
+
+	nt, err := s.src.Token(ctx)
+	if err != nil {
+		if t != nil && now.Before(*t.Expires) {
+			logger.ContextKV(ctx, xlog.WARNING,
+				"reason", "refresh_token",
+				"expires", t.Expires,
+				"err", err.Error())
+			return t, nil
+		}
+		return nil, err
+	}
+	s.token = nt
+	return nt, nil
+}
+
+// ClientCredentialsConfig provides configuration for OAuth2 client credentials flow
+type ClientCredentialsConfig struct {
+	// TokenURL is the token endpoint
+	TokenURL string
+	// ClientID and ClientSecret of the client
+	ClientID     string
+	ClientSecret string
+	// Scopes specifies the requested scopes
+	Scopes []string
+	// EndpointParams specifies additional parameters for the token request,
+	// for example audience or resource
+	EndpointParams url.Values
+	// AuthInParams sends the client credentials in the request body,
+	// instead of Basic auth
+	AuthInParams bool
+	// RefreshBefore specifies the time before the token expiry,
+	// when the token is refreshed, default is DefaultTokenRefreshBefore
+	RefreshBefore time.Duration
+}
+
+type clientCredentials struct {
+	cfg    ClientCredentialsConfig
+	client *Client
+}
+
+// tokenResponse is RFC 6749 token response
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// NewClientCredentialsTokenSource returns TokenSource for OAuth2 client credentials flow,
+// the token is cached and refreshed before the expiry
+func NewClientCredentialsTokenSource(cfg ClientCredentialsConfig, opts ...ClientOption) (TokenSource, error) {
+	if cfg.ClientID == "" {
+		return nil, errors.New("oauth2: client ID is required")
+	}
+	u, err := url.Parse(cfg.TokenURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, errors.Errorf("oauth2: invalid token URL: %q", cfg.TokenURL)
+	}
+
+	opts = append([]ClientOption{WithName("oauth2")}, opts...)
+	client, err := New(ClientConfig{Host: u.Scheme + "://" + u.Host}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newCachedTokenSource(&clientCredentials{
+		cfg:    cfg,
+		client: client,
+	}, cfg.RefreshBefore, client.clock), nil
+}
+
+// Token requests a new access token
+func (s *clientCredentials) Token(ctx context.Context) (*credentials.Token, error) {
+	form := url.Values{
+		"grant_type": {"client_credentials"},
+	}
+	if len(s.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.cfg.Scopes, " "))
+	}
+	for k, v := range s.cfg.EndpointParams {
+		form[k] = v
+	}
+	if s.cfg.AuthInParams {
+		form.Set("client_id", s.cfg.ClientID)
+		form.Set("client_secret", s.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set(header.ContentType, header.ApplicationFormURLEncoded)
+	req.Header.Set(header.Accept, header.ApplicationJSON)
+	if !s.cfg.AuthInParams {
+		req.SetBasicAuth(url.QueryEscape(s.cfg.ClientID), url.QueryEscape(s.cfg.ClientSecret))
+	}
+
+	now := s.client.clock.Now()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.WithMessage(err, "oauth2: token request failed")
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, errors.WithMessage(err, "oauth2: unable to read token response")
+	}
+
+	var res tokenResponse
+	if err = json.Unmarshal(body, &res); err != nil && resp.StatusCode < 300 {
+		return nil, errors.WithMessage(err, "oauth2: unable to decode token response")
+	}
+	if res.Error != "" {
+		msg := "oauth2: " + res.Error
+		if res.ErrorDescription != "" {
+			msg += ": " + res.ErrorDescription
+		}
+		return nil, errors.New(msg)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, errors.Errorf("oauth2: token request failed: %s", resp.Status)
+	}
+	if res.AccessToken == "" {
+		return nil, errors.New("oauth2: server response missing access_token")
+	}
+
+	// token_type is case insensitive, normalize the common one
+	tokenType := values.StringsCoalesce(res.TokenType, header.Bearer)
+	if strings.EqualFold(tokenType, header.Bearer) {
+		tokenType = header.Bearer
+	}
+	t := &credentials.Token{
+		TokenType:   tokenType,
+		AccessToken: res.AccessToken,
+	}
+	if res.ExpiresIn > 0 {
+		expires := now.Add(time.Duration(res.ExpiresIn) * time.Second)
+		t.Expires = &expires
+	}
+	return t, nil
+}
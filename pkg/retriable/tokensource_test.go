@@ -0,0 +1,162 @@
+package retriable_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/gserver/credentials"
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCredentialsTokenSource(t *testing.T) {
+	var issued atomic.Int32
+	var expiresIn atomic.Int64
+	expiresIn.Store(3600)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(header.ContentType, header.ApplicationJSON)
+		clientID, secret, ok := r.BasicAuth()
+		if !ok {
+			clientID, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+		}
+		if r.PostFormValue("grant_type") != "client_credentials" || clientID != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"error":             "invalid_client",
+				"error_description": "client authentication failed",
+			})
+			return
+		}
+		n := issued.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "token" + string(rune('0'+n)) + ":" + r.PostFormValue("scope") + ":" + r.PostFormValue("audience"),
+			"token_type":   "bearer",
+			"expires_in":   expiresIn.Load(),
+		})
+	})
+	mux.HandleFunc("/v1/echo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(header.ContentType, header.ApplicationJSON)
+		_ = json.NewEncoder(w).Encode(map[string]string{"auth": r.Header.Get(header.Authorization)})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx := context.Background()
+
+	_, err := retriable.NewClientCredentialsTokenSource(retriable.ClientCredentialsConfig{TokenURL: server.URL})
+	assert.EqualError(t, err, "oauth2: client ID is required")
+	_, err = retriable.NewClientCredentialsTokenSource(retriable.ClientCredentialsConfig{ClientID: "client", TokenURL: "/token"})
+	assert.EqualError(t, err, `oauth2: invalid token URL: "/token"`)
+
+	ts, err := retriable.NewClientCredentialsTokenSource(retriable.ClientCredentialsConfig{
+		TokenURL:       server.URL + "/oauth2/token",
+		ClientID:       "client",
+		ClientSecret:   "secret",
+		Scopes:         []string{"read", "write"},
+		EndpointParams: map[string][]string{"audience": {"api"}},
+	})
+	require.NoError(t, err)
+
+	client, err := retriable.New(retriable.ClientConfig{Host: server.URL}, retriable.WithTokenSource(ts))
+	require.NoError(t, err)
+
+	var res map[string]string
+	_, _, err = client.Get(ctx, "/v1/echo", &res)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer token1:read write:api", res["auth"])
+
+	_, _, err = client.Get(ctx, "/v1/echo", &res)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer token1:read write:api", res["auth"])
+	assert.Equal(t, int32(1), issued.Load(), "token is cached")
+
+	t.Run("refresh", func(t *testing.T) {
+		// the token expires within the refresh period
+		expiresIn.Store(30)
+		ts, err := retriable.NewClientCredentialsTokenSource(retriable.ClientCredentialsConfig{
+			TokenURL:     server.URL + "/oauth2/token",
+			ClientID:     "client",
+			ClientSecret: "secret",
+			AuthInParams: true,
+		})
+		require.NoError(t, err)
+
+		issued.Store(0)
+		tk, err := ts.Token(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "token1::", tk.AccessToken)
+		require.NotNil(t, tk.Expires)
+
+		tk, err = ts.Token(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "token2::", tk.AccessToken)
+		assert.Equal(t, int32(2), issued.Load())
+	})
+
+	t.Run("invalid_client", func(t *testing.T) {
+		ts, err := retriable.NewClientCredentialsTokenSource(retriable.ClientCredentialsConfig{
+			TokenURL:     server.URL + "/oauth2/token",
+			ClientID:     "client",
+			ClientSecret: "wrong",
+		})
+		require.NoError(t, err)
+		_, err = ts.Token(ctx)
+		assert.EqualError(t, err, "oauth2: invalid_client: client authentication failed")
+
+		client, err := retriable.New(retriable.ClientConfig{Host: server.URL}, retriable.WithTokenSource(ts))
+		require.NoError(t, err)
+		_, _, err = client.Get(ctx, "/v1/echo", &res)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unable to get access token: oauth2: invalid_client")
+	})
+}
+
+func TestCachedTokenSource(t *testing.T) {
+	ctx := context.Background()
+	var calls int
+	var fail bool
+	expires := time.Now().Add(30 * time.Second)
+	ts := retriable.NewCachedTokenSource(retriable.TokenSourceFunc(func(context.Context) (*credentials.Token, error) {
+		calls++
+		if fail {
+			return nil, errors.New("unavailable")
+		}
+		return &credentials.Token{AccessToken: "t", Expires: &expires}, nil
+	}), 0)
+
+	_, err := ts.Token(ctx)
+	require.NoError(t, err)
+
+	// refresh fails, but the token is still valid
+	fail = true
+	tk, err := ts.Token(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "t", tk.AccessToken)
+	assert.Equal(t, 2, calls)
+
+	// expired
+	expires = time.Now().Add(-time.Second)
+	_, err = ts.Token(ctx)
+	assert.EqualError(t, err, "unavailable")
+
+	// tokens without expiry are cached
+	calls = 0
+	fail = false
+	ts = retriable.NewCachedTokenSource(retriable.TokenSourceFunc(func(context.Context) (*credentials.Token, error) {
+		calls++
+		return &credentials.Token{AccessToken: "t"}, nil
+	}), time.Minute)
+	_, _ = ts.Token(ctx)
+	_, _ = ts.Token(ctx)
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,262 @@
+package retriable
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+// DefaultWarmupTimeout specifies the default timeout to warm up a host
+const DefaultWarmupTimeout = 10 * time.Second
+
+// WarmupResult describes the warm-up of a single host
+type WarmupResult struct {
+	Host string
+	// StatusCode of the warm-up request, or zero on error
+	StatusCode int
+	// Reused is true, if an idle connection from the pool was used
+	Reused bool
+	// DNS is the duration of the name resolution
+	DNS time.Duration
+	// Connect is the duration of establishing TCP connection
+	Connect time.Duration
+	// TLS is the duration of TLS handshake
+	TLS time.Duration
+	// Elapsed is the total duration of the warm-up request
+	Elapsed time.Duration
+	Err     error
+}
+
+// WarmupOption is an option for Warmup
+type WarmupOption interface {
+	applyWarmupOption(*warmupOptions)
+}
+
+type warmupOptions struct {
+	hosts      []string
+	healthPath string
+	timeout    time.Duration
+}
+
+type warmupOption func(*warmupOptions)
+
+func (f warmupOption) applyWarmupOption(o *warmupOptions) {
+	f(o)
+}
+
+// WithWarmupHosts specifies the hosts to warm up,
+// by default all the configured hosts are used
+func WithWarmupHosts(hosts ...string) WarmupOption {
+	return warmupOption(func(o *warmupOptions) {
+		o.hosts = hosts
+	})
+}
+
+// WithHealthPath specifies the path of the health endpoint,
+// that is requested with GET and must not return a server error.
+// By default HEAD / is requested, and any response status is accepted.
+func WithHealthPath(path string) WarmupOption {
+	return warmupOption(func(o *warmupOptions) {
+		o.healthPath = path
+	})
+}
+
+// WithWarmupTimeout specifies the timeout to warm up a host,
+// default is DefaultWarmupTimeout
+func WithWarmupTimeout(timeout time.Duration) WarmupOption {
+	return warmupOption(func(o *warmupOptions) {
+		o.timeout = timeout
+	})
+}
+
+// Warmup resolves DNS and establishes the connections to the hosts,
+// so the first request does not pay the cold-start latency.
+// The connections are established by sending HEAD request,
+// or GET request to the health endpoint, without retries.
+// The error is returned if any of the hosts failed.
+func (c *Client) Warmup(ctx context.Context, opts ...WarmupOption) ([]*WarmupResult, error) {
+	o := warmupOptions{timeout: DefaultWarmupTimeout}
+	for _, opt := range opts {
+		opt.applyWarmupOption(&o)
+	}
+	hosts := o.hosts
+	if len(hosts) == 0 {
+		hosts = c.warmupHosts()
+	}
+	if len(hosts) == 0 {
+		return nil, errors.New("no hosts to warm up")
+	}
+
+	results := make([]*WarmupResult, len(hosts))
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.warmupHost(ctx, host, &o)
+		}()
+	}
+	wg.Wait()
+
+	var failed []string
+	for _, res := range results {
+		if res.Err != nil {
+			failed = append(failed, res.Host)
+		}
+	}
+	if len(failed) > 0 {
+		return results, errors.Errorf("warmup failed: %s", strings.Join(failed, ","))
+	}
+	return results, nil
+}
+
+// StartKeepalive periodically warms up the hosts,
+// to keep the connections in the pool.
+// The interval must be less than the idle timeout of the transport and the server.
+// The returned function stops the keepalive.
+func (c *Client) StartKeepalive(interval time.Duration, opts ...WarmupOption) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := c.Warmup(ctx, opts...); err != nil && ctx.Err() == nil {
+					logger.KV(xlog.WARNING,
+						"client", c.Name,
+						"reason", "keepalive",
+						"err", err.Error())
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// warmupHosts returns the configured hosts
+func (c *Client) warmupHosts() []string {
+	var hosts []string
+	seen := map[string]bool{}
+	add := func(host string) {
+		if host == "" {
+			return
+		}
+		if !strings.Contains(host, "://") {
+			host = "https://" + host
+		}
+		host = strings.TrimSuffix(host, "/")
+		if key := hostKey(host); !seen[key] {
+			seen[key] = true
+			hosts = append(hosts, host)
+		}
+	}
+
+	add(c.CurrentHost())
+	add(c.Config.Host)
+	for _, host := range c.Config.LegacyHosts {
+		add(host)
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for host := range c.hostTLS {
+		add(host)
+	}
+	return hosts
+}
+
+func (c *Client) warmupHost(ctx context.Context, host string, o *warmupOptions) *WarmupResult {
+	res := &WarmupResult{Host: host}
+
+	ctx, cancel := context.WithTimeout(ctx, o.timeout)
+	defer cancel()
+
+	// the trace hooks may be called from the dialing goroutines,
+	// even after the request is completed
+	var lock sync.Mutex
+	var finished bool
+	var dnsStart, connectStart, tlsStart time.Time
+	trace := func(f func()) {
+		lock.Lock()
+		defer lock.Unlock()
+		if !finished {
+			f()
+		}
+	}
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			trace(func() { res.Reused = info.Reused })
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			trace(func() { dnsStart = time.Now() })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			trace(func() { res.DNS = time.Since(dnsStart) })
+		},
+		ConnectStart: func(string, string) {
+			trace(func() { connectStart = time.Now() })
+		},
+		ConnectDone: func(string, string, error) {
+			trace(func() { res.Connect = time.Since(connectStart) })
+		},
+		TLSHandshakeStart: func() {
+			trace(func() { tlsStart = time.Now() })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			trace(func() { res.TLS = time.Since(tlsStart) })
+		},
+	})
+
+	method, path := http.MethodHead, "/"
+	if o.healthPath != "" {
+		method, path = http.MethodGet, o.healthPath
+	}
+	req, err := http.NewRequestWithContext(ctx, method, host+path, nil)
+	if err != nil {
+		res.Err = errors.WithStack(err)
+		return res
+	}
+
+	started := time.Now()
+	resp, err := c.clientFor(req).Do(req)
+	lock.Lock()
+	finished = true
+	lock.Unlock()
+	res.Elapsed = time.Since(started)
+	if err != nil {
+		res.Err = errors.WithStack(err)
+		return res
+	}
+	// drain the body to return the connection to the pool
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	res.StatusCode = resp.StatusCode
+	if o.healthPath != "" && resp.StatusCode >= http.StatusInternalServerError {
+		res.Err = errors.Errorf("health check failed: %s", resp.Status)
+	}
+
+	logger.KV(xlog.DEBUG,
+		"client", c.Name,
+		"host", host,
+		"status", res.StatusCode,
+		"reused", res.Reused,
+		"elapsed", res.Elapsed.String())
+	return res
+}
@@ -0,0 +1,100 @@
+package retriable_test
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarmup(t *testing.T) {
+	var heads, health atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodHead:
+			heads.Add(1)
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/healthz":
+			health.Add(1)
+			_, _ = w.Write([]byte("ok"))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	tlsConfig := server.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+	tlsConfig.RootCAs = pool
+
+	client, err := retriable.New(retriable.ClientConfig{Host: server.URL})
+	require.NoError(t, err)
+	client.WithTLS(tlsConfig)
+
+	ctx := context.Background()
+	res, err := client.Warmup(ctx)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, server.URL, res[0].Host)
+	assert.Equal(t, http.StatusNotFound, res[0].StatusCode, "any status is accepted")
+	assert.False(t, res[0].Reused)
+	assert.NotZero(t, res[0].TLS)
+
+	res, err = client.Warmup(ctx)
+	require.NoError(t, err)
+	assert.True(t, res[0].Reused)
+	assert.Equal(t, int32(2), heads.Load())
+
+	res, err = client.Warmup(ctx, retriable.WithHealthPath("/healthz"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res[0].StatusCode)
+	assert.True(t, res[0].Reused)
+	assert.Equal(t, int32(1), health.Load())
+
+	res, err = client.Warmup(ctx, retriable.WithHealthPath("/unhealthy"))
+	assert.EqualError(t, err, "warmup failed: "+server.URL)
+	assert.EqualError(t, res[0].Err, "health check failed: 503 Service Unavailable")
+
+	_, err = client.Warmup(ctx,
+		retriable.WithWarmupHosts("https://127.0.0.1:1"),
+		retriable.WithWarmupTimeout(time.Second))
+	assert.EqualError(t, err, "warmup failed: https://127.0.0.1:1")
+
+	empty, err := retriable.New(retriable.ClientConfig{})
+	require.NoError(t, err)
+	_, err = empty.Warmup(ctx)
+	assert.EqualError(t, err, "no hosts to warm up")
+}
+
+func TestStartKeepalive(t *testing.T) {
+	var heads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			heads.Add(1)
+		}
+	}))
+	defer server.Close()
+
+	client, err := retriable.New(retriable.ClientConfig{Host: server.URL})
+	require.NoError(t, err)
+
+	stop := client.StartKeepalive(10 * time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return heads.Load() >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+	stop()
+
+	// the cancelled request may still reach the server
+	time.Sleep(20 * time.Millisecond)
+	count := heads.Load()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, count, heads.Load())
+}
@@ -0,0 +1,111 @@
+package retriable
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/effective-security/porto/xhttp/correlation"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/pkg/errors"
+)
+
+// webSocketGUID is defined by RFC 6455 to compute Sec-WebSocket-Accept
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocketConn is the connection upgraded to WebSocket protocol.
+// The frames are not parsed, the connection can be used
+// with a WebSocket library that works on top of io.ReadWriter.
+type WebSocketConn struct {
+	io.ReadWriteCloser
+	// Response is the handshake response
+	Response *http.Response
+	// Protocol is the subprotocol selected by the server
+	Protocol string
+}
+
+// ConnectWebSocket performs WebSocket handshake with the current host,
+// the request is sent with the client's TLS configuration, headers,
+// correlation ID and the access token of CallerIdentity or TokenSource,
+// and retried on connection failures according to the policy.
+func (c *Client) ConnectWebSocket(ctx context.Context, path string, protocols []string, opts ...RequestOption) (*WebSocketConn, error) {
+	host := c.CurrentHost()
+	if host == "" {
+		return nil, errors.Errorf("invalid parameter: host")
+	}
+	ctx = c.withRequestOptions(ctx, opts)
+	ctx = correlation.WithID(ctx)
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, host+path, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set(header.Connection, "Upgrade")
+	req.Header.Set(header.Upgrade, "websocket")
+	req.Header.Set(header.SecWebSocketVersion, "13")
+	req.Header.Set(header.SecWebSocketKey, key)
+	if len(protocols) > 0 {
+		req.Header.Set(header.SecWebSocketProtocol, strings.Join(protocols, ", "))
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest {
+			_, _, err = c.DecodeResponse(resp, nil)
+			return nil, err
+		}
+		return nil, errors.Errorf("websocket: unexpected status: %s", resp.Status)
+	}
+
+	rwc, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return nil, errors.New("websocket: connection is not writable")
+	}
+	if !strings.EqualFold(resp.Header.Get(header.Upgrade), "websocket") ||
+		!headerContainsToken(resp.Header, header.Connection, "upgrade") {
+		rwc.Close()
+		return nil, errors.New("websocket: invalid upgrade response")
+	}
+	if resp.Header.Get(header.SecWebSocketAccept) != webSocketAccept(key) {
+		rwc.Close()
+		return nil, errors.New("websocket: invalid Sec-WebSocket-Accept")
+	}
+
+	return &WebSocketConn{
+		ReadWriteCloser: rwc,
+		Response:        resp,
+		Protocol:        resp.Header.Get(header.SecWebSocketProtocol),
+	}, nil
+}
+
+// webSocketAccept returns the expected value of Sec-WebSocket-Accept
+func webSocketAccept(key string) string {
+	h := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
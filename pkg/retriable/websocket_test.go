@@ -0,0 +1,96 @@
+package retriable_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/xhttp/correlation"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectWebSocket(t *testing.T) {
+	var calls atomic.Int32
+	var authHeader, correlationID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path == "/forbidden" {
+			w.Header().Set(header.ContentType, header.ApplicationJSON)
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"code":"forbidden","message":"denied"}`))
+			return
+		}
+		authHeader = r.Header.Get(header.Authorization)
+		correlationID = r.Header.Get(header.XCorrelationID)
+
+		key := r.Header.Get(header.SecWebSocketKey)
+		if r.URL.Path == "/bad-accept" {
+			key = "invalid"
+		}
+		h := sha1.Sum([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		defer conn.Close()
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+			"Upgrade: websocket\r\n" +
+			"Connection: Upgrade\r\n" +
+			"Sec-WebSocket-Protocol: v1.test\r\n" +
+			"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(h[:]) + "\r\n\r\n")
+		_ = rw.Flush()
+
+		// echo
+		line, err := rw.ReadString('\n')
+		if err == nil {
+			_, _ = rw.WriteString("echo: " + line)
+			_ = rw.Flush()
+		}
+	}))
+	defer server.Close()
+
+	client, err := retriable.New(retriable.ClientConfig{Host: server.URL},
+		retriable.WithPolicy(retriable.Policy{
+			TotalRetryLimit: 2,
+			Retries: map[int]retriable.ShouldRetry{
+				http.StatusServiceUnavailable: retriable.DefaultShouldRetryFactory(2, 10*time.Millisecond, "unavailable"),
+			},
+		}))
+	require.NoError(t, err)
+	client.AddHeader(header.Authorization, "Bearer token")
+
+	ctx := correlation.WithID(context.Background())
+	conn, err := client.ConnectWebSocket(ctx, "/v1/ws", []string{"v1.test", "v2.test"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	assert.Equal(t, int32(2), calls.Load(), "retried")
+	assert.Equal(t, "v1.test", conn.Protocol)
+	assert.Equal(t, "Bearer token", authHeader)
+	assert.Equal(t, correlation.ID(ctx), correlationID)
+
+	_, err = io.WriteString(conn, "hello\n")
+	require.NoError(t, err)
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "echo: hello\n", line)
+
+	_, err = client.ConnectWebSocket(ctx, "/bad-accept", nil)
+	assert.EqualError(t, err, "websocket: invalid Sec-WebSocket-Accept")
+
+	_, err = client.ConnectWebSocket(ctx, "/forbidden", nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "denied")
+}
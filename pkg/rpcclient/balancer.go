@@ -0,0 +1,304 @@
+package rpcclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/health" // enables client-side health checking
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/resolver"
+)
+
+const (
+	// DefaultResolveInterval is the default interval to refresh the endpoints
+	DefaultResolveInterval = 30 * time.Second
+	// DefaultFailureThreshold is the default number of consecutive failures
+	// to open the circuit for an endpoint
+	DefaultFailureThreshold = 5
+	// DefaultOpenTimeout is the default time the endpoint is excluded
+	// from load balancing after the circuit is open
+	DefaultOpenTimeout = 30 * time.Second
+
+	balancerScheme = "porto"
+)
+
+// EndpointsResolver provides the endpoints of the service
+type EndpointsResolver interface {
+	Resolve(ctx context.Context) ([]string, error)
+}
+
+// StaticResolver provides the static list of endpoints
+type StaticResolver []string
+
+// Resolve returns the endpoints
+func (r StaticResolver) Resolve(context.Context) ([]string, error) {
+	return r, nil
+}
+
+// ResolverFromConfig returns the resolver for the hosts
+// of the retriable client configuration
+func ResolverFromConfig(cfg *retriable.ClientConfig) StaticResolver {
+	var hosts StaticResolver
+	if cfg.Host != "" {
+		hosts = append(hosts, cfg.Host)
+	}
+	return append(hosts, cfg.LegacyHosts...)
+}
+
+// CircuitBreaker configures per-endpoint circuit breaking
+type CircuitBreaker struct {
+	// FailureThreshold is the number of consecutive failures
+	// to open the circuit, default is DefaultFailureThreshold
+	FailureThreshold int
+	// OpenTimeout is the time the endpoint is excluded from load balancing,
+	// before it's tried again, default is DefaultOpenTimeout
+	OpenTimeout time.Duration
+}
+
+// balanced returns true if the client-side load balancing is configured
+func (c *Config) balanced() bool {
+	return len(c.Endpoints) > 0 || c.Resolver != nil || c.HealthCheck || c.CircuitBreaker != nil
+}
+
+// serviceConfig returns the gRPC service config with round_robin,
+// and health checking if enabled
+func (c *Config) serviceConfig() string {
+	sc := `{"loadBalancingConfig":[{"round_robin":{}}]`
+	if c.HealthCheck {
+		sc += fmt.Sprintf(`,"healthCheckConfig":{"serviceName":%q}`, c.HealthCheckServiceName)
+	}
+	return sc + "}"
+}
+
+type breakerState struct {
+	failures  int
+	openUntil time.Time
+}
+
+// endpointsBalancer is resolver.Builder and resolver.Resolver,
+// that resolves the endpoints to addresses, and excludes the endpoints
+// with open circuit
+type endpointsBalancer struct {
+	endpoints []string
+	resolver  EndpointsResolver
+	threshold int
+	timeout   time.Duration
+	lookup    func(ctx context.Context, host string) ([]string, error)
+
+	lock     sync.Mutex
+	cc       resolver.ClientConn
+	addrs    []resolver.Address
+	breakers map[string]*breakerState
+}
+
+func newEndpointsBalancer(cfg *Config, endpoint string) *endpointsBalancer {
+	b := &endpointsBalancer{
+		endpoints: append([]string{endpoint}, cfg.Endpoints...),
+		resolver:  cfg.Resolver,
+		threshold: DefaultFailureThreshold,
+		timeout:   DefaultOpenTimeout,
+		lookup:    net.DefaultResolver.LookupHost,
+		breakers:  make(map[string]*breakerState),
+	}
+	if cb := cfg.CircuitBreaker; cb != nil {
+		if cb.FailureThreshold > 0 {
+			b.threshold = cb.FailureThreshold
+		}
+		if cb.OpenTimeout > 0 {
+			b.timeout = cb.OpenTimeout
+		}
+	}
+	return b
+}
+
+// Build implements resolver.Builder
+func (b *endpointsBalancer) Build(_ resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	b.lock.Lock()
+	b.cc = cc
+	b.lock.Unlock()
+	b.update()
+	return b, nil
+}
+
+// Scheme implements resolver.Builder
+func (b *endpointsBalancer) Scheme() string {
+	return balancerScheme
+}
+
+// ResolveNow implements resolver.Resolver
+func (b *endpointsBalancer) ResolveNow(resolver.ResolveNowOptions) {
+	go b.refresh(context.Background())
+}
+
+// Close implements resolver.Resolver
+func (b *endpointsBalancer) Close() {}
+
+// run refreshes the endpoints until the context is cancelled
+func (b *endpointsBalancer) run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultResolveInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.refresh(ctx)
+		}
+	}
+}
+
+// refresh resolves the endpoints to addresses
+func (b *endpointsBalancer) refresh(ctx context.Context) {
+	endpoints := b.endpoints
+	if b.resolver != nil {
+		resolved, err := b.resolver.Resolve(ctx)
+		if err != nil {
+			logger.ContextKV(ctx, xlog.ERROR, "reason", "resolve", "err", err.Error())
+		}
+		endpoints = append(endpoints[:len(endpoints):len(endpoints)], resolved...)
+	}
+
+	seen := map[string]bool{}
+	var addrs []resolver.Address
+	for _, endpoint := range endpoints {
+		for _, addr := range b.resolveEndpoint(ctx, endpoint) {
+			if !seen[addr.Addr] {
+				seen[addr.Addr] = true
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+
+	b.lock.Lock()
+	b.addrs = addrs
+	b.lock.Unlock()
+	b.update()
+}
+
+func (b *endpointsBalancer) resolveEndpoint(ctx context.Context, endpoint string) []resolver.Address {
+	target := dialTarget(endpoint)
+	host, port, err := net.SplitHostPort(target)
+	if err != nil || net.ParseIP(host) != nil {
+		return []resolver.Address{{Addr: target}}
+	}
+	ips, err := b.lookup(ctx, host)
+	if err != nil || len(ips) == 0 {
+		logger.ContextKV(ctx, xlog.WARNING, "reason", "lookup", "host", host, "err", err)
+		return []resolver.Address{{Addr: target}}
+	}
+	addrs := make([]resolver.Address, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, resolver.Address{
+			Addr:       net.JoinHostPort(ip, port),
+			ServerName: host,
+		})
+	}
+	return addrs
+}
+
+// update sends the addresses with closed circuit to the client connection,
+// or all addresses if all circuits are open
+func (b *endpointsBalancer) update() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.cc == nil {
+		return
+	}
+	if len(b.addrs) == 0 {
+		b.cc.ReportError(errors.New("no endpoints resolved"))
+		return
+	}
+
+	now := time.Now()
+	addrs := make([]resolver.Address, 0, len(b.addrs))
+	for _, addr := range b.addrs {
+		if bs := b.breakers[addr.Addr]; bs == nil || !now.Before(bs.openUntil) {
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) == 0 {
+		addrs = b.addrs
+	}
+	_ = b.cc.UpdateState(resolver.State{Addresses: addrs})
+}
+
+// record updates the circuit state of the address
+func (b *endpointsBalancer) record(addr string, failed bool) {
+	b.lock.Lock()
+	bs := b.breakers[addr]
+	if !failed {
+		if bs != nil {
+			delete(b.breakers, addr)
+			logger.KV(xlog.DEBUG, "status", "circuit_closed", "addr", addr)
+		}
+		b.lock.Unlock()
+		return
+	}
+
+	if bs == nil {
+		bs = new(breakerState)
+		b.breakers[addr] = bs
+	}
+	bs.failures++
+	now := time.Now()
+	opened := bs.failures >= b.threshold && !now.Before(bs.openUntil)
+	if opened {
+		bs.openUntil = now.Add(b.timeout)
+		logger.KV(xlog.WARNING, "status", "circuit_open", "addr", addr, "failures", bs.failures, "timeout", b.timeout)
+	}
+	b.lock.Unlock()
+
+	if opened {
+		b.update()
+		// include the address back, after the timeout
+		time.AfterFunc(b.timeout, b.update)
+	}
+}
+
+// unaryInterceptor records the outcome of the call per endpoint
+func (b *endpointsBalancer) unaryInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		p := new(peer.Peer)
+		err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Peer(p))...)
+		if p.Addr != nil {
+			b.record(p.Addr.String(), isEndpointFailure(err))
+		}
+		return err
+	}
+}
+
+// isEndpointFailure returns true if the error indicates
+// that the endpoint is unavailable or overloaded
+func isEndpointFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch httperror.GRPCCode(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// dialTarget returns host:port of the endpoint
+func dialTarget(endpoint string) string {
+	target := removePrefix.Replace(endpoint)
+	if !strings.Contains(target, ":") {
+		target += ":443"
+	}
+	return target
+}
@@ -0,0 +1,200 @@
+package rpcclient
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+)
+
+type testServer struct {
+	addr   string
+	health *health.Server
+	stop   func()
+}
+
+func startHealthServer(t *testing.T) *testServer {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	hs := health.NewServer()
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+	go func() { _ = srv.Serve(lis) }()
+
+	return &testServer{
+		addr:   lis.Addr().String(),
+		health: hs,
+		stop:   srv.Stop,
+	}
+}
+
+func TestBalancer_HealthCheck(t *testing.T) {
+	s1 := startHealthServer(t)
+	defer s1.stop()
+	s2 := startHealthServer(t)
+	defer s2.stop()
+
+	s2.health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	client, err := New(&Config{
+		Endpoint:    s1.addr,
+		Endpoints:   []string{s2.addr, s1.addr},
+		HealthCheck: true,
+		DialTimeout: 5 * time.Second,
+	}, true)
+	require.NoError(t, err)
+	defer client.Close()
+
+	hc := healthpb.NewHealthClient(client.Conn())
+	ctx := context.Background()
+
+	peers := map[string]int{}
+	for i := 0; i < 10; i++ {
+		var p peer.Peer
+		res, err := hc.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Peer(&p))
+		require.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, res.Status)
+		peers[p.Addr.String()]++
+	}
+	assert.Equal(t, map[string]int{s1.addr: 10}, peers)
+
+	// both are serving
+	s2.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	require.Eventually(t, func() bool {
+		var p peer.Peer
+		_, err := hc.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Peer(&p))
+		return err == nil && p.Addr.String() == s2.addr
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+type testClientConn struct {
+	resolver.ClientConn
+
+	lock  sync.Mutex
+	state resolver.State
+	err   error
+}
+
+func (cc *testClientConn) UpdateState(s resolver.State) error {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+	cc.state = s
+	return nil
+}
+
+func (cc *testClientConn) ReportError(err error) {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+	cc.err = err
+}
+
+func (cc *testClientConn) addrs() []string {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+	var list []string
+	for _, a := range cc.state.Addresses {
+		list = append(list, a.Addr)
+	}
+	return list
+}
+
+func TestBalancer_CircuitBreaker(t *testing.T) {
+	cfg := &Config{
+		Endpoints: []string{"http://10.0.0.2:8080", "localhost:8080"},
+		Resolver:  StaticResolver{"10.0.0.3:8080"},
+		CircuitBreaker: &CircuitBreaker{
+			FailureThreshold: 2,
+			OpenTimeout:      200 * time.Millisecond,
+		},
+	}
+	assert.True(t, cfg.balanced())
+	assert.Equal(t, `{"loadBalancingConfig":[{"round_robin":{}}]}`, cfg.serviceConfig())
+
+	b := newEndpointsBalancer(cfg, "https://10.0.0.1:8080")
+	b.lookup = func(_ context.Context, host string) ([]string, error) {
+		if host == "localhost" {
+			return []string{"127.0.0.1"}, nil
+		}
+		return nil, errors.New("not found")
+	}
+
+	cc := new(testClientConn)
+	_, err := b.Build(resolver.Target{}, cc, resolver.BuildOptions{})
+	require.NoError(t, err)
+	assert.EqualError(t, cc.err, "no endpoints resolved")
+
+	b.refresh(context.Background())
+	all := []string{"10.0.0.1:8080", "10.0.0.2:8080", "127.0.0.1:8080", "10.0.0.3:8080"}
+	assert.Equal(t, all, cc.addrs())
+	assert.Equal(t, "localhost", cc.state.Addresses[2].ServerName)
+
+	invoker := func(code codes.Code, addr string) grpc.UnaryInvoker {
+		return func(_ context.Context, _ string, _, _ any, _ *grpc.ClientConn, opts ...grpc.CallOption) error {
+			for _, o := range opts {
+				if po, ok := o.(grpc.PeerCallOption); ok {
+					po.PeerAddr.Addr = &net.TCPAddr{IP: net.ParseIP(addr), Port: 8080}
+				}
+			}
+			if code == codes.OK {
+				return nil
+			}
+			return status.Error(code, "failed")
+		}
+	}
+	call := func(code codes.Code, addr string) {
+		_ = b.unaryInterceptor()(context.Background(), "/test", nil, nil, nil, invoker(code, addr))
+	}
+
+	call(codes.Unavailable, "10.0.0.1")
+	assert.Equal(t, all, cc.addrs())
+	// not endpoint failure
+	call(codes.NotFound, "10.0.0.1")
+	call(codes.Unavailable, "10.0.0.1")
+	call(codes.Unavailable, "10.0.0.1")
+	assert.Equal(t, all[1:], cc.addrs())
+
+	// included back after the timeout
+	require.Eventually(t, func() bool { return len(cc.addrs()) == len(all) }, time.Second, 10*time.Millisecond)
+
+	// half-open: the next failure opens the circuit again
+	call(codes.DeadlineExceeded, "10.0.0.1")
+	assert.Equal(t, all[1:], cc.addrs())
+	call(codes.OK, "10.0.0.1")
+	b.update()
+	assert.Equal(t, all, cc.addrs())
+
+	// all open: use all addresses
+	for _, addr := range []string{"10.0.0.1", "10.0.0.2", "127.0.0.1", "10.0.0.3"} {
+		call(codes.Unavailable, addr)
+		call(codes.Unavailable, addr)
+	}
+	assert.Equal(t, all, cc.addrs())
+}
+
+func TestResolverFromConfig(t *testing.T) {
+	r := ResolverFromConfig(&retriable.ClientConfig{
+		Host:        "https://h1:443",
+		LegacyHosts: []string{"https://h2:443"},
+	})
+	list, err := r.Resolve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://h1:443", "https://h2:443"}, list)
+
+	cfg := &Config{HealthCheck: true, HealthCheckServiceName: "svc"}
+	assert.Equal(t, `{"loadBalancingConfig":[{"round_robin":{}}],"healthCheckConfig":{"serviceName":"svc"}}`, cfg.serviceConfig())
+	assert.False(t, (&Config{}).balanced())
+}
@@ -198,9 +198,19 @@ func (c *Client) dial(target string, creds credentials.TransportCredentials, dop
 		defer cancel()
 	}
 
-	target = removePrefix.Replace(target)
-	if !strings.Contains(target, ":") {
-		target += ":443"
+	if c.cfg.balanced() {
+		b := newEndpointsBalancer(&c.cfg, target)
+		b.refresh(c.ctx)
+		go b.run(c.ctx, c.cfg.ResolveInterval)
+
+		opts = append(opts,
+			grpc.WithResolvers(b),
+			grpc.WithDefaultServiceConfig(c.cfg.serviceConfig()),
+			grpc.WithChainUnaryInterceptor(b.unaryInterceptor()),
+		)
+		target = balancerScheme + ":///" + dialTarget(target)
+	} else {
+		target = dialTarget(target)
 	}
 
 	logger.KV(xlog.DEBUG, "target", target, "timeout", c.cfg.DialTimeout)
@@ -224,6 +234,7 @@ func (c *Client) dialSetupOpts(creds credentials.TransportCredentials, dopts ...
 		}
 		opts = append(opts, grpc.WithKeepaliveParams(params))
 	}
+	opts = append(opts, grpc.WithChainUnaryInterceptor(httperror.NewUnaryClientInterceptor()))
 	opts = append(opts, dopts...)
 
 	if creds == nil {
@@ -15,6 +15,30 @@ type Config struct {
 	// Endpoint of the server
 	Endpoint string
 
+	// Endpoints is the list of additional endpoints of the same service.
+	// When specified, the client balances the requests with round_robin
+	// across Endpoint and Endpoints.
+	Endpoints []string
+
+	// Resolver provides the endpoints of the service in addition to Endpoints,
+	// for example ResolverFromConfig for the retriable client hosts.
+	Resolver EndpointsResolver
+
+	// ResolveInterval is the interval to refresh the endpoints,
+	// default is DefaultResolveInterval
+	ResolveInterval time.Duration
+
+	// HealthCheck specifies to exclude the endpoints,
+	// that are not serving as reported by the standard gRPC health service.
+	HealthCheck bool
+
+	// HealthCheckServiceName is the service name to check,
+	// default is empty for the server status
+	HealthCheckServiceName string
+
+	// CircuitBreaker configures per-endpoint circuit breaking for unary calls
+	CircuitBreaker *CircuitBreaker
+
 	// DialTimeout is the timeout for failing to establish a connection.
 	DialTimeout time.Duration
 
@@ -0,0 +1,139 @@
+package tasks
+
+import (
+	"strings"
+	"time"
+)
+
+// DSTPolicy specifies how to run the task scheduled at the wall time,
+// that does not exist or is ambiguous due to DST transition
+type DSTPolicy int
+
+const (
+	// DSTTrigger runs the task at the nonexistent time shifted by the transition,
+	// e.g. 02:30 is run at 03:30 on the spring forward day,
+	// and runs the task once at the first occurrence of the ambiguous time
+	DSTTrigger DSTPolicy = iota
+	// DSTSkip skips the run, if the time does not exist or is ambiguous on that day
+	DSTSkip
+)
+
+// maxCalendarSteps limits the search of the next run
+const maxCalendarSteps = 1000
+
+// WithLocation option to provide the time location of the task schedule,
+// if it's not specified in the format, by default the package location is used
+func WithLocation(location *time.Location) Option {
+	return newFuncOption(func(o *options) {
+		o.location = location
+	})
+}
+
+// WithDSTPolicy option to provide the policy for DST transitions
+func WithDSTPolicy(policy DSTPolicy) Option {
+	return newFuncOption(func(o *options) {
+		o.dstPolicy = &policy
+	})
+}
+
+// location returns the time location of the schedule
+func (s *Schedule) location() *time.Location {
+	if s.Location != nil {
+		return s.Location
+	}
+	return loc
+}
+
+// parseLocation returns the location, if the token is a time zone name:
+// UTC, Local or IANA name like America/New_York
+func parseLocation(token string) (*time.Location, bool) {
+	switch strings.ToLower(token) {
+	case "utc":
+		return time.UTC, true
+	case "local":
+		return time.Local, true
+	}
+	if !strings.Contains(token, "/") {
+		return nil, false
+	}
+	l, err := time.LoadLocation(token)
+	if err != nil {
+		return nil, false
+	}
+	return l, true
+}
+
+// nextCalendarRun returns the first run of Days or Weeks schedule after the time,
+// computed in the wall time of the schedule location
+func (s *Schedule) nextCalendarRun(after time.Time) time.Time {
+	l := s.location()
+	last := after.In(l)
+	hour, min, sec := last.Clock()
+	if s.atSet {
+		hour, min, sec = s.hour, s.minute, 0
+	}
+
+	step := int(s.Interval)
+	y, m, d := last.Date()
+	if s.Unit == Weeks {
+		step *= 7
+		d -= (int(last.Weekday()) - int(s.StartDay) + 7) % 7
+	}
+	if step < 1 {
+		step = 1
+	}
+
+	for i := 0; i < maxCalendarSteps; i++ {
+		if t, ok := resolveWallTime(y, m, d, hour, min, sec, l, s.DSTPolicy); ok && t.After(after) {
+			return t
+		}
+		d += step
+	}
+	return after.Add(s.Duration())
+}
+
+// resolveWallTime returns the instant of the wall time in the location,
+// and false if the run must be skipped according to the policy
+func resolveWallTime(y int, m time.Month, d, hour, min, sec int, l *time.Location, policy DSTPolicy) (time.Time, bool) {
+	wall := time.Date(y, m, d, hour, min, sec, 0, time.UTC)
+
+	// the offsets before and after the possible transition
+	_, before := wall.Add(-12 * time.Hour).In(l).Zone()
+	_, after := wall.Add(12 * time.Hour).In(l).Zone()
+
+	var found []time.Time
+	for _, offset := range []int{before, after} {
+		t := wall.Add(-time.Duration(offset) * time.Second).In(l)
+		if sameWallTime(t, wall) && (len(found) == 0 || !found[0].Equal(t)) {
+			found = append(found, t)
+		}
+	}
+
+	switch len(found) {
+	case 1:
+		return found[0], true
+	case 2:
+		// ambiguous time, when the clock is set back
+		if policy == DSTSkip {
+			return time.Time{}, false
+		}
+		if found[1].Before(found[0]) {
+			return found[1], true
+		}
+		return found[0], true
+	}
+
+	// nonexistent time, when the clock is set forward
+	if policy == DSTSkip {
+		return time.Time{}, false
+	}
+	return wall.Add(-time.Duration(before) * time.Second).In(l), true
+}
+
+func sameWallTime(t, wall time.Time) bool {
+	y1, m1, d1 := t.Date()
+	y2, m2, d2 := wall.Date()
+	h1, n1, s1 := t.Clock()
+	h2, n2, s2 := wall.Clock()
+	return y1 == y2 && m1 == m2 && d1 == d2 && h1 == h2 && n1 == n2 && s1 == s2
+}
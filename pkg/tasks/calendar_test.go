@@ -0,0 +1,151 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadNY(t *testing.T) *time.Location {
+	l, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	return l
+}
+
+func dailyAt(l *time.Location, hour, min int, policy DSTPolicy, last time.Time) *Schedule {
+	s := &Schedule{
+		Interval:  1,
+		Unit:      Days,
+		Location:  l,
+		DSTPolicy: policy,
+		LastRunAt: &last,
+	}
+	s.hour, s.minute, s.atSet = hour, min, true
+	return s
+}
+
+func TestParseSchedule_Location(t *testing.T) {
+	ny := loadNY(t)
+
+	s, err := ParseSchedule("every day 02:00 America/New_York")
+	require.NoError(t, err)
+	assert.Equal(t, Days, s.Unit)
+	require.NotNil(t, s.Location)
+	assert.Equal(t, "America/New_York", s.Location.String())
+	require.NotNil(t, s.LastRunAt)
+	assert.Equal(t, ny.String(), s.LastRunAt.Location().String())
+	assert.Equal(t, 2, s.LastRunAt.Hour())
+	assert.Equal(t, 0, s.LastRunAt.Minute())
+
+	s, err = ParseSchedule("Saturday 23:13 UTC")
+	require.NoError(t, err)
+	assert.Equal(t, Weeks, s.Unit)
+	assert.Equal(t, time.UTC, s.Location)
+	assert.Equal(t, time.Saturday, s.LastRunAt.Weekday())
+
+	s1, err := ParseSchedule("every day 02:00 America/New_York")
+	require.NoError(t, err)
+	s2, err := ParseSchedule("every day 02:00 Europe/London")
+	require.NoError(t, err)
+	assert.False(t, s1.Equal(s2))
+
+	for _, f := range []string{
+		"every day 02:00 America/New_York UTC",
+		"every day 02:00 Unknown/Zone",
+	} {
+		_, err = ParseSchedule(f)
+		assert.Error(t, err, f)
+	}
+}
+
+func TestSchedule_DailyAcrossDST(t *testing.T) {
+	ny := loadNY(t)
+
+	// fall back: the day is 25 hours long
+	s := dailyAt(ny, 2, 0, DSTTrigger, time.Date(2024, 11, 2, 2, 0, 0, 0, ny))
+	next := s.UpdateNextRun()
+	assert.Equal(t, time.Date(2024, 11, 3, 2, 0, 0, 0, ny), next)
+	assert.Equal(t, 25*time.Hour, next.Sub(*s.LastRunAt))
+
+	// spring forward: the day is 23 hours long
+	s = dailyAt(ny, 4, 0, DSTTrigger, time.Date(2024, 3, 9, 4, 0, 0, 0, ny))
+	next = s.UpdateNextRun()
+	assert.Equal(t, time.Date(2024, 3, 10, 4, 0, 0, 0, ny), next)
+	assert.Equal(t, 23*time.Hour, next.Sub(*s.LastRunAt))
+}
+
+func TestSchedule_NonexistentTime(t *testing.T) {
+	ny := loadNY(t)
+	last := time.Date(2024, 3, 9, 2, 30, 0, 0, ny)
+
+	s := dailyAt(ny, 2, 30, DSTTrigger, last)
+	next := s.UpdateNextRun()
+	assert.Equal(t, time.Date(2024, 3, 10, 7, 30, 0, 0, time.UTC), next.UTC())
+	assert.Equal(t, 3, next.Hour())
+
+	s = dailyAt(ny, 2, 30, DSTSkip, last)
+	next = s.UpdateNextRun()
+	assert.Equal(t, time.Date(2024, 3, 11, 2, 30, 0, 0, ny), next)
+}
+
+func TestSchedule_AmbiguousTime(t *testing.T) {
+	ny := loadNY(t)
+	last := time.Date(2024, 11, 2, 1, 30, 0, 0, ny)
+
+	s := dailyAt(ny, 1, 30, DSTTrigger, last)
+	next := s.UpdateNextRun()
+	// the first occurrence in EDT
+	assert.Equal(t, time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC), next.UTC())
+
+	// run only once on the ambiguous day
+	ran := next.Add(time.Second)
+	s.LastRunAt = &ran
+	next = s.UpdateNextRun()
+	assert.Equal(t, time.Date(2024, 11, 4, 1, 30, 0, 0, ny), next)
+
+	s = dailyAt(ny, 1, 30, DSTSkip, last)
+	next = s.UpdateNextRun()
+	assert.Equal(t, time.Date(2024, 11, 4, 1, 30, 0, 0, ny), next)
+}
+
+func TestSchedule_WeeklyAcrossDST(t *testing.T) {
+	ny := loadNY(t)
+	last := time.Date(2024, 3, 3, 2, 30, 0, 0, ny)
+
+	s := &Schedule{
+		Interval:  1,
+		Unit:      Weeks,
+		StartDay:  time.Sunday,
+		Location:  ny,
+		DSTPolicy: DSTSkip,
+		LastRunAt: &last,
+	}
+	s.hour, s.minute, s.atSet = 2, 30, true
+
+	next := s.UpdateNextRun()
+	assert.Equal(t, time.Date(2024, 3, 17, 2, 30, 0, 0, ny), next)
+
+	s.DSTPolicy = DSTTrigger
+	next = s.UpdateNextRun()
+	assert.Equal(t, time.Date(2024, 3, 10, 3, 30, 0, 0, ny), next)
+	assert.Equal(t, time.Sunday, next.Weekday())
+}
+
+func TestNew_WithLocation(t *testing.T) {
+	ny := loadNY(t)
+
+	tsk := NewTaskDaily(2, 30, WithLocation(ny), WithDSTPolicy(DSTSkip)).Do("test", testTask)
+	sch := tsk.Schedule()
+	assert.Equal(t, ny, sch.Location)
+	assert.Equal(t, DSTSkip, sch.DSTPolicy)
+	assert.True(t, sch.NextRunAt.After(TimeNow()))
+	assert.Equal(t, ny.String(), sch.NextRunAt.Location().String())
+	assert.Equal(t, 30, sch.NextRunAt.Minute())
+
+	require.NoError(t, tsk.UpdateSchedule("every day 04:00"))
+	assert.Equal(t, ny, tsk.Schedule().Location)
+	assert.Equal(t, DSTSkip, tsk.Schedule().DSTPolicy)
+	assert.Equal(t, 4, tsk.Schedule().LastRunAt.Hour())
+}
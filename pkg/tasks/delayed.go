@@ -0,0 +1,158 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/effective-security/porto/pkg/cache"
+	"github.com/effective-security/x/guid"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+// DefaultDelayedJobsBatch specifies the number of jobs claimed per poll
+const DefaultDelayedJobsBatch = 100
+
+// Job is a one-off delayed job
+type Job struct {
+	ID string `json:"id"`
+	// Type specifies the handler of the job
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// RunAt is the time the job is due
+	RunAt time.Time `json:"run_at"`
+}
+
+// JobHandler runs the job
+type JobHandler func(ctx context.Context, job *Job) error
+
+// DelayedJobs schedules one-off jobs in the delay queue, such as Redis sorted set,
+// and runs the due jobs when polled.
+// The due jobs are claimed atomically, so each job runs once
+// across the replicas polling the same queue.
+type DelayedJobs struct {
+	store cache.DelayQueue
+	queue string
+	batch int
+
+	lock     sync.RWMutex
+	handlers map[string]JobHandler
+}
+
+// NewDelayedJobs returns DelayedJobs for the queue
+func NewDelayedJobs(store cache.DelayQueue, queue string) *DelayedJobs {
+	return &DelayedJobs{
+		store:    store,
+		queue:    queue,
+		batch:    DefaultDelayedJobsBatch,
+		handlers: map[string]JobHandler{},
+	}
+}
+
+// Handle registers the handler for the job type
+func (d *DelayedJobs) Handle(jobType string, h JobHandler) *DelayedJobs {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.handlers[jobType] = h
+	return d
+}
+
+// ScheduleAt schedules the job to run at the given time,
+// and returns the job ID to cancel it
+func (d *DelayedJobs) ScheduleAt(ctx context.Context, jobType string, payload any, at time.Time) (string, error) {
+	job := &Job{
+		ID:    guid.MustCreate(),
+		Type:  jobType,
+		RunAt: at,
+	}
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to marshal payload: %s", jobType)
+		}
+		job.Payload = b
+	}
+
+	b, err := json.Marshal(job)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	err = d.store.Schedule(ctx, d.queue, &cache.DelayedItem{
+		ID:      job.ID,
+		Payload: b,
+		DueAt:   at,
+	})
+	if err != nil {
+		return "", err
+	}
+	return job.ID, nil
+}
+
+// ScheduleAfter schedules the job to run after the given duration,
+// and returns the job ID to cancel it
+func (d *DelayedJobs) ScheduleAfter(ctx context.Context, jobType string, payload any, after time.Duration) (string, error) {
+	return d.ScheduleAt(ctx, jobType, payload, TimeNow().Add(after))
+}
+
+// Cancel removes the scheduled job,
+// and returns false if the job is not found or already claimed
+func (d *DelayedJobs) Cancel(ctx context.Context, id string) (bool, error) {
+	return d.store.Cancel(ctx, d.queue, id)
+}
+
+// Poll claims the due jobs, runs them, and returns the number of the claimed jobs.
+// The failed jobs are not rescheduled, the handler can schedule a retry.
+func (d *DelayedJobs) Poll(ctx context.Context) (int, error) {
+	items, err := d.store.Claim(ctx, d.queue, TimeNow(), d.batch)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range items {
+		job := new(Job)
+		if err := json.Unmarshal(item.Payload, job); err != nil {
+			logger.KV(xlog.ERROR,
+				"reason", "unmarshal",
+				"queue", d.queue,
+				"job", item.ID,
+				"err", err.Error())
+			continue
+		}
+
+		d.lock.RLock()
+		h := d.handlers[job.Type]
+		d.lock.RUnlock()
+
+		if h == nil {
+			logger.KV(xlog.ERROR,
+				"reason", "no_handler",
+				"queue", d.queue,
+				"job", job.ID,
+				"type", job.Type)
+			continue
+		}
+
+		if err := h(ctx, job); err != nil {
+			logger.KV(xlog.ERROR,
+				"reason", "job_failed",
+				"queue", d.queue,
+				"job", job.ID,
+				"type", job.Type,
+				"err", err.Error())
+		}
+	}
+	return len(items), nil
+}
+
+// Task returns the task to poll the queue by the scheduler
+func (d *DelayedJobs) Task(interval uint64, unit TimeUnit, ops ...Option) Task {
+	return NewTaskAtIntervals(interval, unit, ops...).
+		Do("delayed_jobs:"+d.queue, d.poll)
+}
+
+func (d *DelayedJobs) poll() error {
+	_, err := d.Poll(context.Background())
+	return err
+}
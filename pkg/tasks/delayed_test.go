@@ -0,0 +1,76 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/cache"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DelayedJobs(t *testing.T) {
+	ctx := context.Background()
+	store := cache.NewMemoryProvider("test").(cache.DelayQueue)
+
+	var lock sync.Mutex
+	var ran []string
+	handler := func(_ context.Context, job *Job) error {
+		lock.Lock()
+		defer lock.Unlock()
+		var msg string
+		if err := json.Unmarshal(job.Payload, &msg); err != nil {
+			return err
+		}
+		ran = append(ran, msg)
+		if msg == "fail" {
+			return errors.New("failed")
+		}
+		return nil
+	}
+
+	replica1 := NewDelayedJobs(store, "reminders").Handle("remind", handler)
+	replica2 := NewDelayedJobs(store, "reminders").Handle("remind", handler)
+
+	now := TimeNow()
+	_, err := replica1.ScheduleAt(ctx, "remind", "first", now.Add(-time.Second))
+	require.NoError(t, err)
+	_, err = replica1.ScheduleAfter(ctx, "remind", "fail", 0)
+	require.NoError(t, err)
+	id, err := replica1.ScheduleAfter(ctx, "remind", "canceled", 0)
+	require.NoError(t, err)
+	_, err = replica1.ScheduleAfter(ctx, "remind", "later", time.Hour)
+	require.NoError(t, err)
+	_, err = replica1.ScheduleAfter(ctx, "unknown", nil, 0)
+	require.NoError(t, err)
+
+	canceled, err := replica2.Cancel(ctx, id)
+	require.NoError(t, err)
+	assert.True(t, canceled)
+
+	var wg sync.WaitGroup
+	counts := make([]int, 2)
+	for i, r := range []*DelayedJobs{replica1, replica2} {
+		wg.Add(1)
+		go func(i int, r *DelayedJobs) {
+			defer wg.Done()
+			n, err := r.Poll(ctx)
+			assert.NoError(t, err)
+			counts[i] = n
+		}(i, r)
+	}
+	wg.Wait()
+
+	// each job is claimed once
+	assert.Equal(t, 3, counts[0]+counts[1])
+	assert.ElementsMatch(t, []string{"first", "fail"}, ran)
+
+	task := replica1.Task(1, Seconds)
+	assert.Contains(t, task.Name(), "delayed_jobs:reminders")
+	assert.True(t, task.Run())
+	assert.Len(t, ran, 2)
+}
@@ -1,7 +1,10 @@
 // Package tasks is task scheduling package which lets you run Go functions
 // periodically at pre-determined interval using a simple, human-friendly syntax.
 /*
-	scheduler := tasks.NewScheduler()
+	// Receive the task events: started, finished, skipped
+	scheduler := tasks.NewScheduler(tasks.WithEventListener(tasks.EventListenerFunc(func(e *tasks.Event) {
+		log.Printf("%s %s: %v", e.TaskName, e.Type, e.Err)
+	})))
 
 	// Do tasks with params
 	tasks.NewTaskAtIntervals(1, Minutes).Do(taskWithParams, 1, "hello")
@@ -26,6 +29,25 @@
 	tasks.NewTask("Monday")
 	tasks.NewTask("Saturday 23:13")
 
+	// Schedule in the time zone, and skip the runs at nonexistent or ambiguous time
+	tasks.NewTask("every day 02:30 America/New_York", tasks.WithDSTPolicy(tasks.DSTSkip))
+	tasks.NewTaskDaily(2, 30, tasks.WithLocation(time.UTC))
+
+	// Run the dependent tasks after the upstream task finished
+	pipeline := tasks.NewPipeline()
+	extract := tasks.NewTaskDaily(1, 0).Do("extract", extract)
+	transform := tasks.NewTriggeredTask().Do("transform", transform)
+	load := tasks.NewTriggeredTask().Do("load", load)
+	pipeline.After(transform, extract)
+	pipeline.AfterWithPolicy(tasks.IgnoreFailure, load, transform)
+	scheduler.Add(extract)
+
+	// Run one-off delayed jobs, claimed once across the replicas
+	jobs := tasks.NewDelayedJobs(redisProvider.(cache.DelayQueue), "reminders").
+		Handle("remind", sendReminder)
+	jobs.ScheduleAfter(ctx, "remind", reminder, 24*time.Hour)
+	scheduler.Add(jobs.Task(5, tasks.Seconds))
+
 	scheduler.Add(j)
 
 	// Start the scheduler
@@ -0,0 +1,98 @@
+package tasks
+
+import (
+	"time"
+
+	"github.com/effective-security/porto/metricskey"
+)
+
+// EventType specifies the type of the task event
+type EventType string
+
+// Task event types
+const (
+	// EventStarted is sent when the task run is started
+	EventStarted EventType = "started"
+	// EventFinished is sent when the task run is finished
+	EventFinished EventType = "finished"
+	// EventSkipped is sent when the task run is skipped,
+	// as the previous run is still in progress
+	EventSkipped EventType = "skipped"
+)
+
+// Run status values for task_runs metric
+const (
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+	RunSkipped   = "skipped"
+)
+
+// Event describes the task run
+type Event struct {
+	Type     EventType
+	TaskID   string
+	TaskName string
+	// RunCount is the number of the task runs, including the current one
+	RunCount uint32
+	// ScheduledAt is the time the run was scheduled at
+	ScheduledAt time.Time
+	// StartedAt is the time the run was started at, for started and finished events
+	StartedAt time.Time
+	// Elapsed is the duration of the run, for finished event
+	Elapsed time.Duration
+	// Err is returned by the task function, or recovered from panic
+	Err error
+}
+
+// EventListener receives the task events.
+// The callbacks are called synchronously, and must not block.
+type EventListener interface {
+	OnTaskEvent(e *Event)
+}
+
+// EventSource is an optional interface of the task,
+// that supports the event listeners
+type EventSource interface {
+	// AddEventListener adds the listeners of the task events
+	AddEventListener(listeners ...EventListener) Task
+}
+
+// EventListenerFunc is an adapter to use a function as EventListener
+type EventListenerFunc func(e *Event)
+
+// OnTaskEvent calls f(e)
+func (f EventListenerFunc) OnTaskEvent(e *Event) {
+	f(e)
+}
+
+// WithEventListener option to provide the task event listeners,
+// when used with the scheduler, the listeners are added to all tasks
+func WithEventListener(listeners ...EventListener) Option {
+	return newFuncOption(func(o *options) {
+		o.listeners = append(o.listeners, listeners...)
+	})
+}
+
+// notify sends the event to the listeners, and emits the metrics
+func (j *task) notify(e *Event) {
+	switch e.Type {
+	case EventStarted:
+		if !e.ScheduledAt.IsZero() {
+			delay := max(e.StartedAt.Sub(e.ScheduledAt), 0)
+			metricskey.TaskQueueDelay.AddSample(float64(delay.Milliseconds()), e.TaskName)
+		}
+	case EventFinished:
+		status := RunSucceeded
+		if e.Err != nil {
+			status = RunFailed
+		}
+		metricskey.TaskRuns.IncrCounter(1, e.TaskName, status)
+		metricskey.TaskRunPerf.MeasureSince(e.StartedAt, e.TaskName)
+	case EventSkipped:
+		metricskey.TaskRuns.IncrCounter(1, e.TaskName, RunSkipped)
+	}
+
+	for _, l := range j.listeners {
+		l.OnTaskEvent(e)
+	}
+}
@@ -0,0 +1,129 @@
+package tasks
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/effective-security/metrics"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testListener struct {
+	lock   sync.Mutex
+	events []*Event
+}
+
+func (l *testListener) OnTaskEvent(e *Event) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.events = append(l.events, e)
+}
+
+func (l *testListener) types() []EventType {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	var types []EventType
+	for _, e := range l.events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func (l *testListener) last() *Event {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.events[len(l.events)-1]
+}
+
+func Test_TaskEvents(t *testing.T) {
+	im := metrics.NewInmemSink(time.Minute, time.Minute)
+	_, err := metrics.NewGlobal(metrics.DefaultConfig("test"), im)
+	require.NoError(t, err)
+
+	l := &testListener{}
+	job := NewTaskAtIntervals(1, Minutes, WithEventListener(l)).Do("ok", testTask)
+	assert.True(t, job.Run())
+	assert.Equal(t, []EventType{EventStarted, EventFinished}, l.types())
+	e := l.last()
+	assert.Equal(t, job.ID(), e.TaskID)
+	assert.Equal(t, job.Name(), e.TaskName)
+	assert.Equal(t, uint32(1), e.RunCount)
+	assert.False(t, e.ScheduledAt.IsZero())
+	assert.False(t, e.StartedAt.IsZero())
+	assert.NoError(t, e.Err)
+
+	l = &testListener{}
+	job = NewTaskAtIntervals(1, Minutes).(EventSource).
+		AddEventListener(l, nil).
+		Do("fail", func() error { return errors.New("failed") })
+	assert.True(t, job.Run())
+	assert.EqualError(t, l.last().Err, "failed")
+
+	l = &testListener{}
+	job = NewTaskAtIntervals(1, Minutes, WithEventListener(l)).
+		Do("nil_error", func() (int, error) { return 1, nil })
+	assert.True(t, job.Run())
+	assert.NoError(t, l.last().Err)
+
+	l = &testListener{}
+	job = NewTaskAtIntervals(1, Minutes, WithEventListener(l)).
+		Do("panic", func() { panic("oops") })
+	assert.True(t, job.Run())
+	require.Error(t, l.last().Err)
+	assert.Contains(t, l.last().Err.Error(), "unexpected: panic in panic@")
+	assert.True(t, strings.HasSuffix(l.last().Err.Error(), ": oops"))
+
+	// the second run is skipped while the first one is in progress
+	l = &testListener{}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	job = NewTaskAtIntervals(1, Minutes, WithEventListener(l), WithRunTimeout(10*time.Millisecond)).
+		Do("slow", func() {
+			close(started)
+			<-release
+		})
+	done := make(chan bool)
+	go func() { done <- job.Run() }()
+	<-started
+	assert.False(t, job.Run())
+	close(release)
+	assert.True(t, <-done)
+	assert.Equal(t, []EventType{EventStarted, EventSkipped, EventFinished}, l.types())
+
+	counters := map[string]int{}
+	data := im.Data()
+	for k, c := range data[0].Counters {
+		if strings.Contains(k, "task_runs") {
+			for _, status := range []string{RunSucceeded, RunFailed, RunSkipped} {
+				if strings.Contains(k, "status="+status) {
+					counters[status] += c.Count
+				}
+			}
+		}
+	}
+	assert.Equal(t, map[string]int{RunSucceeded: 3, RunFailed: 2, RunSkipped: 1}, counters)
+
+	var samples []string
+	for k := range data[0].Samples {
+		samples = append(samples, k)
+	}
+	assert.Contains(t, strings.Join(samples, ","), "task_run_perf")
+	assert.Contains(t, strings.Join(samples, ","), "task_queue_delay")
+}
+
+func Test_SchedulerEvents(t *testing.T) {
+	l := &testListener{}
+	s := NewScheduler(WithEventListener(l), WithTickerInterval(10*time.Millisecond))
+	s.Add(NewTaskAtIntervals(1, Seconds).Do("test", testTask).SetNextRun(0))
+	require.NoError(t, s.Start())
+	defer s.Stop()
+
+	assert.Eventually(t, func() bool {
+		types := l.types()
+		return len(types) >= 2 && types[1] == EventFinished
+	}, 2*time.Second, 10*time.Millisecond)
+}
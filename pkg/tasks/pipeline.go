@@ -0,0 +1,237 @@
+package tasks
+
+import (
+	"sync"
+
+	"github.com/effective-security/porto/metricskey"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+// FailurePolicy specifies how the failure of the upstream tasks
+// propagates to the dependent task
+type FailurePolicy int
+
+const (
+	// RequireAll runs the dependent task only if all the upstream tasks succeeded,
+	// otherwise the task is skipped and the failure propagates downstream
+	RequireAll FailurePolicy = iota
+	// RequireAny runs the dependent task if at least one upstream task succeeded
+	RequireAny
+	// IgnoreFailure runs the dependent task regardless of the upstream results
+	IgnoreFailure
+)
+
+// ErrUpstreamFailed is reported in EventSkipped,
+// when the dependent task is not run due to the upstream failure
+var ErrUpstreamFailed = errors.New("upstream task failed")
+
+// Pipeline runs the dependent tasks when their upstream tasks finish.
+//
+// The pipeline listens to EventFinished of the upstream tasks,
+// and runs the dependent task once all its upstream tasks finished
+// since its previous trigger (fan-in).
+// A task may have many dependent tasks (fan-out).
+// If an upstream task finishes more than once before the others,
+// only its latest result is used.
+//
+// The dependent tasks are triggered by the pipeline, and should be created
+// with NewTriggeredTask, or not be added to the scheduler,
+// while the root tasks are usually scheduled as usual.
+type Pipeline struct {
+	lock      sync.Mutex
+	nodes     map[string]*pipelineNode
+	listeners []EventListener
+}
+
+type pipelineNode struct {
+	task       Task
+	policy     FailurePolicy
+	upstream   []string
+	downstream []string
+	// results of the upstream tasks since the last trigger
+	results map[string]error
+	// subscribed is true, if the pipeline listens to the task events
+	subscribed bool
+}
+
+// NewPipeline returns a new pipeline,
+// WithEventListener option can be used to receive EventSkipped
+// for the tasks that are not run due to the upstream failure
+func NewPipeline(ops ...Option) *Pipeline {
+	dops := options{}
+	for _, op := range ops {
+		op.apply(&dops)
+	}
+	return &Pipeline{
+		nodes:     map[string]*pipelineNode{},
+		listeners: dops.listeners,
+	}
+}
+
+// NewTriggeredTask creates a new task that never runs by the schedule,
+// and is expected to be run by a Pipeline
+func NewTriggeredTask(ops ...Option) Task {
+	return NewTaskAtIntervals(0, Never, ops...)
+}
+
+// After declares that the task runs after all the upstream tasks succeeded
+func (p *Pipeline) After(task Task, upstream ...Task) error {
+	return p.AfterWithPolicy(RequireAll, task, upstream...)
+}
+
+// AfterWithPolicy declares that the task runs after the upstream tasks finished,
+// the policy specifies how the upstream failures are handled
+func (p *Pipeline) AfterWithPolicy(policy FailurePolicy, task Task, upstream ...Task) error {
+	if task == nil || len(upstream) == 0 {
+		return errors.Errorf("task and upstream tasks are required")
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if n := p.nodes[task.ID()]; n != nil && len(n.upstream) > 0 {
+		return errors.Errorf("dependencies already declared: task=%s", task.Name())
+	}
+
+	unique := make([]Task, 0, len(upstream))
+	seen := map[string]bool{}
+	for _, u := range upstream {
+		if u == nil {
+			return errors.Errorf("invalid upstream task: task=%s", task.Name())
+		}
+		if seen[u.ID()] {
+			continue
+		}
+		seen[u.ID()] = true
+
+		if u.ID() == task.ID() || p.reachable(task.ID(), u.ID()) {
+			return errors.Errorf("dependency cycle: task=%s, upstream=%s", task.Name(), u.Name())
+		}
+		if _, ok := u.(EventSource); !ok {
+			return errors.Errorf("upstream task does not support events: task=%s", u.Name())
+		}
+		unique = append(unique, u)
+	}
+
+	n := p.node(task)
+	n.policy = policy
+	n.results = make(map[string]error, len(unique))
+	for _, u := range unique {
+		un := p.node(u)
+		if !un.subscribed {
+			u.(EventSource).AddEventListener(p)
+			un.subscribed = true
+		}
+		un.downstream = append(un.downstream, task.ID())
+		n.upstream = append(n.upstream, u.ID())
+	}
+
+	return nil
+}
+
+// OnTaskEvent implements EventListener
+func (p *Pipeline) OnTaskEvent(e *Event) {
+	if e.Type != EventFinished {
+		return
+	}
+
+	var run []Task
+	var skipped []*Event
+
+	p.lock.Lock()
+	p.complete(e.TaskID, e.Err, &run, &skipped)
+	p.lock.Unlock()
+
+	for _, se := range skipped {
+		logger.KV(xlog.DEBUG,
+			"status", "upstream_failed",
+			"task", se.TaskName,
+			"err", se.Err.Error())
+
+		metricskey.TaskRuns.IncrCounter(1, se.TaskName, RunSkipped)
+		for _, l := range p.listeners {
+			l.OnTaskEvent(se)
+		}
+	}
+	for _, t := range run {
+		go t.Run()
+	}
+}
+
+// complete records the result of the task,
+// and collects the dependent tasks to run or to skip
+func (p *Pipeline) complete(id string, err error, run *[]Task, skipped *[]*Event) {
+	n := p.nodes[id]
+	if n == nil {
+		return
+	}
+
+	for _, did := range n.downstream {
+		d := p.nodes[did]
+		d.results[id] = err
+		if len(d.results) < len(d.upstream) {
+			continue
+		}
+
+		results := d.results
+		d.results = make(map[string]error, len(d.upstream))
+
+		if derr := d.policy.check(results); derr != nil {
+			*skipped = append(*skipped, &Event{
+				Type:     EventSkipped,
+				TaskID:   did,
+				TaskName: d.task.Name(),
+				RunCount: d.task.RunCount(),
+				Err:      derr,
+			})
+			// the skipped task fails its own dependents
+			p.complete(did, derr, run, skipped)
+			continue
+		}
+		*run = append(*run, d.task)
+	}
+}
+
+// check returns ErrUpstreamFailed, if the dependent task must not run
+func (f FailurePolicy) check(results map[string]error) error {
+	failed := 0
+	for _, err := range results {
+		if err != nil {
+			failed++
+		}
+	}
+
+	switch {
+	case failed == 0, f == IgnoreFailure:
+		return nil
+	case f == RequireAny && failed < len(results):
+		return nil
+	}
+	return errors.WithMessagef(ErrUpstreamFailed, "%d of %d", failed, len(results))
+}
+
+func (p *Pipeline) node(t Task) *pipelineNode {
+	n := p.nodes[t.ID()]
+	if n == nil {
+		n = &pipelineNode{
+			task: t,
+		}
+		p.nodes[t.ID()] = n
+	}
+	return n
+}
+
+// reachable returns true, if the task `to` is downstream of the task `from`
+func (p *Pipeline) reachable(from, to string) bool {
+	n := p.nodes[from]
+	if n == nil {
+		return false
+	}
+	for _, did := range n.downstream {
+		if did == to || p.reachable(did, to) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package tasks
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pipelineRecorder struct {
+	lock sync.Mutex
+	runs []string
+	done chan string
+}
+
+func (r *pipelineRecorder) task(name string, fail bool) func() error {
+	return func() error {
+		r.lock.Lock()
+		r.runs = append(r.runs, name)
+		r.lock.Unlock()
+		r.done <- name
+		if fail {
+			return errors.Errorf("%s failed", name)
+		}
+		return nil
+	}
+}
+
+func (r *pipelineRecorder) wait(t *testing.T, names ...string) {
+	for range names {
+		select {
+		case <-r.done:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timeout waiting for tasks: %v", names)
+		}
+	}
+}
+
+func (r *pipelineRecorder) list() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string{}, r.runs...)
+}
+
+func Test_Pipeline(t *testing.T) {
+	t.Run("fan_out_fan_in", func(t *testing.T) {
+		r := &pipelineRecorder{done: make(chan string, 10)}
+		a := NewTaskAtIntervals(1, Hours).Do("a", r.task("a", false))
+		b := NewTriggeredTask().Do("b", r.task("b", false))
+		c := NewTriggeredTask().Do("c", r.task("c", false))
+		d := NewTriggeredTask().Do("d", r.task("d", false))
+		assert.False(t, b.ShouldRun())
+
+		p := NewPipeline()
+		require.NoError(t, p.After(b, a))
+		require.NoError(t, p.After(c, a))
+		require.NoError(t, p.After(d, b, c))
+
+		a.Run()
+		r.wait(t, "a", "b", "c", "d")
+		runs := r.list()
+		require.Len(t, runs, 4)
+		assert.Equal(t, "a", runs[0])
+		assert.Equal(t, "d", runs[3])
+		assert.ElementsMatch(t, []string{"b", "c"}, runs[1:3])
+
+		// the fan-in resets after the trigger
+		a.Run()
+		r.wait(t, "a", "b", "c", "d")
+		assert.Len(t, r.list(), 8)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		r := &pipelineRecorder{done: make(chan string, 10)}
+		sl := &testListener{}
+
+		a := NewTaskAtIntervals(1, Hours).Do("a", r.task("a", true))
+		b := NewTriggeredTask().Do("b", r.task("b", false))
+		c := NewTriggeredTask().Do("c", r.task("c", false))
+		d := NewTriggeredTask().Do("d", r.task("d", false))
+
+		p := NewPipeline(WithEventListener(sl))
+		require.NoError(t, p.After(b, a))
+		require.NoError(t, p.After(c, b))
+		require.NoError(t, p.AfterWithPolicy(IgnoreFailure, d, c))
+
+		a.Run()
+		r.wait(t, "a", "d")
+		assert.Equal(t, []string{"a", "d"}, r.list())
+		assert.Equal(t, []EventType{EventSkipped, EventSkipped}, sl.types())
+		assert.True(t, errors.Is(sl.last().Err, ErrUpstreamFailed))
+		assert.Equal(t, c.ID(), sl.last().TaskID)
+	})
+
+	t.Run("require_any", func(t *testing.T) {
+		r := &pipelineRecorder{done: make(chan string, 10)}
+		a := NewTriggeredTask().Do("a", r.task("a", true))
+		b := NewTriggeredTask().Do("b", r.task("b", false))
+		c := NewTriggeredTask().Do("c", r.task("c", false))
+
+		p := NewPipeline()
+		require.NoError(t, p.AfterWithPolicy(RequireAny, c, a, b))
+
+		a.Run()
+		r.wait(t, "a")
+		b.Run()
+		r.wait(t, "b", "c")
+		assert.Equal(t, []string{"a", "b", "c"}, r.list())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		a := NewTriggeredTask().Do("a", func() {})
+		b := NewTriggeredTask().Do("b", func() {})
+		c := NewTriggeredTask().Do("c", func() {})
+
+		p := NewPipeline()
+		assert.EqualError(t, p.After(a), "task and upstream tasks are required")
+		assert.Error(t, p.After(a, a))
+
+		require.NoError(t, p.After(b, a))
+		require.NoError(t, p.After(c, b))
+		err := p.After(a, c)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "dependency cycle")
+
+		err = p.After(b, c)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "dependencies already declared")
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/effective-security/porto/metricskey"
 	"github.com/effective-security/xlog"
 	"github.com/pkg/errors"
 )
@@ -160,8 +161,12 @@ func (s *scheduler) Add(j Task) Scheduler {
 	if s.dops.publisher != nil {
 		j.SetPublisher(s.dops.publisher)
 	}
+	if es, ok := j.(EventSource); ok {
+		es.AddEventListener(s.dops.listeners...)
+	}
 
 	s.tasks = append(s.tasks, j)
+	metricskey.TasksScheduled.SetGauge(float64(len(s.tasks)))
 	return s
 }
 
@@ -191,6 +196,7 @@ func (s *scheduler) Clear() {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 	s.tasks = []Task{}
+	metricskey.TasksScheduled.SetGauge(0)
 }
 
 // IsRunning return the status
@@ -275,6 +281,9 @@ type options struct {
 	id             string
 	runTimeout     time.Duration
 	publisher      Publisher
+	listeners      []EventListener
+	location       *time.Location
+	dstPolicy      *DSTPolicy
 }
 
 type funcOption struct {
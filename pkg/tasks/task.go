@@ -1,16 +1,18 @@
 package tasks
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"reflect"
 	"runtime"
-	"runtime/debug"
 	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
 
+	"github.com/effective-security/porto/x/clock"
+	"github.com/effective-security/porto/x/safecall"
 	"github.com/effective-security/x/guid"
 	"github.com/effective-security/x/values"
 	"github.com/effective-security/xlog"
@@ -20,8 +22,13 @@ import (
 // TimeUnit specifies the time unit: 'minutes', 'hours'...
 type TimeUnit uint
 
-// TimeNow is a function that returns the current time
-var TimeNow = time.Now
+// Clock is the time source of the schedules, allows to override in tests
+var Clock clock.Clock = clock.System
+
+// TimeNow returns the current time of the Clock
+func TimeNow() time.Time {
+	return Clock.Now()
+}
 
 const (
 	// Never specifies the time unit to never run a task
@@ -83,8 +90,18 @@ type Schedule struct {
 	NextRunAt time.Time
 	// RunCount specifies the number of runs
 	RunCount uint32
+	// Location specifies the time zone of the schedule,
+	// if not set, the package location is used
+	Location *time.Location
+	// DSTPolicy specifies how to run the task at the wall time,
+	// that does not exist or is ambiguous due to DST transition
+	DSTPolicy DSTPolicy
 	// cache the period between last an next run
 	period time.Duration
+	// hour and minute of the day to run, if atSet
+	hour   int
+	minute int
+	atSet  bool
 }
 
 // Equal returns true if the schedules are equal
@@ -92,7 +109,9 @@ func (s *Schedule) Equal(other *Schedule) bool {
 	return s.Interval == other.Interval &&
 		s.Unit == other.Unit &&
 		s.StartDay == other.StartDay &&
-		s.Format == other.Format
+		s.Format == other.Format &&
+		s.DSTPolicy == other.DSTPolicy &&
+		s.location().String() == other.location().String()
 }
 
 // GetLastRun returns the last run time
@@ -120,6 +139,7 @@ type task struct {
 	// timeout interval to schedule a run
 	runTimeout time.Duration
 	publisher  Publisher
+	listeners  []EventListener
 }
 
 // DefaultRunTimeoutInterval specify a timeout for a task to start
@@ -196,17 +216,38 @@ func New(s *Schedule, ops ...Option) Task {
 	}
 
 	dops.id = values.StringsCoalesce(dops.id, guid.MustCreate())
+	if dops.dstPolicy != nil {
+		s.DSTPolicy = *dops.dstPolicy
+	}
+	if dops.location != nil && s.Location == nil {
+		s.Location = dops.location
+		if s.atSet {
+			s.at(s.hour, s.minute)
+		}
+	}
+
 	j := &task{
 		id:         dops.id,
 		schedule:   s,
 		runLock:    make(chan struct{}, 1),
 		runTimeout: dops.runTimeout,
 		publisher:  dops.publisher,
+		listeners:  dops.listeners,
 	}
 
 	return j
 }
 
+// AddEventListener adds the listeners of the task events
+func (j *task) AddEventListener(listeners ...EventListener) Task {
+	for _, l := range listeners {
+		if l != nil {
+			j.listeners = append(j.listeners, l)
+		}
+	}
+	return j
+}
+
 // SetPublisher sets the publisher for all tasks
 func (j *task) SetPublisher(pub Publisher) Task {
 	j.publisher = pub
@@ -226,6 +267,16 @@ func (j *task) UpdateSchedule(format string) error {
 	if err != nil {
 		return err
 	}
+	// preserve the location and DST policy provided by options
+	if old := j.schedule; old != nil {
+		if s.Location == nil && old.Location != nil {
+			s.Location = old.Location
+			if s.atSet {
+				s.at(s.hour, s.minute)
+			}
+		}
+		s.DSTPolicy = old.DSTPolicy
+	}
 	j.schedule = s
 	return nil
 }
@@ -290,15 +341,18 @@ func (j *task) Do(taskName string, taskFunc interface{}, params ...interface{})
 }
 
 func (s *Schedule) at(hour, min int) *Schedule {
-	now := TimeNow()
+	s.hour, s.minute, s.atSet = hour, min, true
+
+	l := s.location()
+	now := TimeNow().In(l)
 	y, m, d := now.Date()
 
-	lastRun := time.Date(y, m, d, hour, min, 0, 0, loc)
+	lastRun := time.Date(y, m, d, hour, min, 0, 0, l)
 
 	if s.Unit == Days {
 		if !now.After(lastRun) {
 			// remove 1 day
-			lastRun = lastRun.UTC().AddDate(0, 0, -1).Local()
+			lastRun = time.Date(y, m, d-1, hour, min, 0, 0, l)
 		}
 	} else if s.Unit == Weeks {
 		if s.StartDay != now.Weekday() || (now.After(lastRun) && s.StartDay == now.Weekday()) {
@@ -306,10 +360,10 @@ func (s *Schedule) at(hour, min int) *Schedule {
 			if i < 0 {
 				i = 7 + i
 			}
-			lastRun = lastRun.UTC().AddDate(0, 0, -i).Local()
+			lastRun = time.Date(y, m, d-i, hour, min, 0, 0, l)
 		} else {
 			// remove 1 week
-			lastRun = lastRun.UTC().AddDate(0, 0, -7).Local()
+			lastRun = time.Date(y, m, d-7, hour, min, 0, 0, l)
 		}
 	}
 	s.LastRunAt = &lastRun
@@ -329,6 +383,11 @@ func (j *task) Run() bool {
 		timeout = DefaultRunTimeoutInterval
 	}
 
+	var scheduledAt time.Time
+	if next := j.schedule.NextRunAt; next.Unix() > 0 {
+		scheduledAt = next
+	}
+
 	timer := time.NewTimer(timeout)
 	select {
 	case j.runLock <- struct{}{}:
@@ -337,6 +396,7 @@ func (j *task) Run() bool {
 		j.schedule.LastRunAt = &now
 		j.running = true
 		count := atomic.AddUint32(&j.schedule.RunCount, 1)
+		started := time.Now()
 
 		logger.KV(xlog.DEBUG,
 			"status", "running",
@@ -345,23 +405,32 @@ func (j *task) Run() bool {
 			"task", j.Name())
 
 		j.Publish()
-
-		func() {
-			defer func() {
-				if r := recover(); r != nil {
-					logger.KV(xlog.ERROR,
-						"reason", "panic",
-						"task", j.Name(),
-						"err", r,
-						"stack", string(debug.Stack()))
-				}
-			}()
-			j.callback.Call(j.params)
-		}()
+		j.notify(&Event{
+			Type:        EventStarted,
+			TaskID:      j.id,
+			TaskName:    j.Name(),
+			RunCount:    count,
+			ScheduledAt: scheduledAt,
+			StartedAt:   started,
+		})
+
+		err := safecall.Call(context.Background(), j.Name(), func(context.Context) error {
+			return resultError(j.callback.Call(j.params))
+		})
 
 		j.running = false
 		j.schedule.UpdateNextRun()
 		j.Publish()
+		j.notify(&Event{
+			Type:        EventFinished,
+			TaskID:      j.id,
+			TaskName:    j.Name(),
+			RunCount:    count,
+			ScheduledAt: scheduledAt,
+			StartedAt:   started,
+			Elapsed:     time.Since(started),
+			Err:         err,
+		})
 
 		<-j.runLock
 		return true
@@ -374,9 +443,31 @@ func (j *task) Run() bool {
 		"started_at", j.schedule.LastRunAt,
 		"task", j.Name())
 
+	j.notify(&Event{
+		Type:        EventSkipped,
+		TaskID:      j.id,
+		TaskName:    j.Name(),
+		RunCount:    j.RunCount(),
+		ScheduledAt: scheduledAt,
+	})
 	return false
 }
 
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// resultError returns the error, if the task function returns it as the last value
+func resultError(out []reflect.Value) error {
+	if len(out) == 0 {
+		return nil
+	}
+	last := out[len(out)-1]
+	if !last.Type().Implements(errorType) || last.IsNil() {
+		return nil
+	}
+	err, _ := last.Interface().(error)
+	return err
+}
+
 func parseTimeFormat(t string) (hour, min int, err error) {
 	var errTimeFormat = errors.Errorf("time format not valid: %q", t)
 	ts := strings.Split(t, ":")
@@ -403,7 +494,9 @@ func parseTimeFormat(t string) (hour, min int, err error) {
 	return
 }
 
-// ParseSchedule parses a schedule string
+// ParseSchedule parses a schedule string.
+// The time zone of the schedule can be specified by the IANA name,
+// e.g. "every day 02:00 America/New_York"
 func ParseSchedule(format string) (*Schedule, error) {
 	var errTimeFormat = errors.Errorf("task format not valid: %q", format)
 
@@ -416,8 +509,10 @@ func ParseSchedule(format string) (*Schedule, error) {
 		StartDay:  time.Sunday,
 	}
 
-	ts := strings.Split(strings.ToLower(format), " ")
-	for _, t := range ts {
+	hour, min := -1, -1
+	ts := strings.Split(format, " ")
+	for _, token := range ts {
+		t := strings.ToLower(token)
 		switch t {
 		case "every":
 			if s.Interval > 0 {
@@ -477,8 +572,14 @@ func ParseSchedule(format string) (*Schedule, error) {
 			s.Unit = Weeks
 			s.StartDay = time.Sunday
 		default:
-			if strings.Contains(t, ":") {
-				hour, min, err := parseTimeFormat(t)
+			if l, ok := parseLocation(token); ok {
+				if s.Location != nil {
+					return nil, errors.WithStack(errTimeFormat)
+				}
+				s.Location = l
+			} else if strings.Contains(t, ":") {
+				var err error
+				hour, min, err = parseTimeFormat(t)
 				if err != nil {
 					return nil, errors.WithStack(errTimeFormat)
 				}
@@ -487,7 +588,6 @@ func ParseSchedule(format string) (*Schedule, error) {
 				} else if s.Unit != Days && s.Unit != Weeks {
 					return nil, errors.WithStack(errTimeFormat)
 				}
-				s.at(hour, min)
 			} else {
 				if s.Interval > 1 {
 					return nil, errors.WithStack(errTimeFormat)
@@ -506,13 +606,18 @@ func ParseSchedule(format string) (*Schedule, error) {
 	if s.Unit == Never {
 		return nil, errors.WithStack(errTimeFormat)
 	}
+	if hour >= 0 {
+		// the time is applied after the location is parsed
+		s.at(hour, min)
+	}
 
 	return s, nil
 }
 
-// ShouldRun returns true if the task should be run now
+// ShouldRun returns true if the task should be run now,
+// the task with Never unit is not run by the schedule
 func (s *Schedule) ShouldRun() bool {
-	return TimeNow().After(s.NextRunAt)
+	return s.Unit != Never && TimeNow().After(s.NextRunAt)
 }
 
 // UpdateNextRun computes the instant when this task should run next
@@ -520,17 +625,24 @@ func (s *Schedule) UpdateNextRun() time.Time {
 	now := TimeNow()
 	if s.LastRunAt == nil {
 		if s.Unit == Weeks {
+			l := s.location()
+			now = now.In(l)
 			i := now.Weekday() - s.StartDay
 			if i < 0 {
 				i = 7 + i
 			}
 			y, m, d := now.Date()
-			now = time.Date(y, m, d-int(i), 0, 0, 0, 0, loc)
+			now = time.Date(y, m, d-int(i), 0, 0, 0, 0, l)
 		}
 		s.LastRunAt = &now
 	}
 
-	s.NextRunAt = s.LastRunAt.Add(s.Duration())
+	if s.Unit == Days || s.Unit == Weeks {
+		// keep the wall time across DST transitions
+		s.NextRunAt = s.nextCalendarRun(*s.LastRunAt)
+	} else {
+		s.NextRunAt = s.LastRunAt.Add(s.Duration())
+	}
 
 	return s.NextRunAt
 }
@@ -7,6 +7,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/effective-security/porto/tests/testutils"
+	"github.com/effective-security/porto/x/clock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -285,6 +287,20 @@ func Test_TaskWeekdaysTodayBefore(t *testing.T) {
 	assert.Equal(t, timeToSchedule, job1.Schedule().NextRunAt, "Task should be run today, at the set time.")
 }
 
+func Test_TaskClock(t *testing.T) {
+	clk := testutils.NewClock(time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local))
+	Clock = clk
+	defer func() { Clock = clock.System }()
+
+	job := NewTaskAtIntervals(1, Minutes).Do("test", testTask)
+	job.SetNextRun(time.Minute)
+	assert.Equal(t, clk.Now().Add(time.Minute), job.Schedule().NextRunAt)
+	assert.False(t, job.ShouldRun())
+
+	clk.Advance(2 * time.Minute)
+	assert.True(t, job.ShouldRun())
+}
+
 func Test_NewTask_panic(t *testing.T) {
 	require.Panics(t, func() {
 		NewTaskOnWeekday(time.Wednesday, -1, 60)
@@ -0,0 +1,143 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+// CertPoolReloader watches PEM encoded CA bundle file,
+// and notifies the handlers on changes
+type CertPoolReloader struct {
+	path     string
+	pool     atomic.Pointer[x509.CertPool]
+	count    uint32
+	stopChan chan struct{}
+
+	lock       sync.Mutex
+	modifiedAt time.Time
+	handlers   []OnTrustBundleFunc
+	closed     bool
+}
+
+// NewCertPoolReloader returns CertPoolReloader,
+// the bundle is loaded before the function returns
+func NewCertPoolReloader(path string, checkInterval time.Duration) (*CertPoolReloader, error) {
+	r := &CertPoolReloader{
+		path:     path,
+		stopChan: make(chan struct{}),
+	}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	tickerStop, tickChan := makeTicker(checkInterval)
+	go func() {
+		for {
+			select {
+			case <-r.stopChan:
+				tickerStop()
+				logger.KV(xlog.TRACE, "status", "closed", "file", path, "count", r.LoadedCount())
+				return
+			case <-tickChan:
+				if _, err := r.Reload(); err != nil {
+					logger.KV(xlog.ERROR, "file", path, "err", err.Error())
+				}
+			}
+		}
+	}()
+
+	return r, nil
+}
+
+// CertPool returns the current pool of CAs
+func (r *CertPoolReloader) CertPool() *x509.CertPool {
+	return r.pool.Load()
+}
+
+// LoadedCount returns the number of times the bundle was loaded
+func (r *CertPoolReloader) LoadedCount() uint32 {
+	return atomic.LoadUint32(&r.count)
+}
+
+// OnReload allows to add OnTrustBundleFunc handler
+func (r *CertPoolReloader) OnReload(f OnTrustBundleFunc) *CertPoolReloader {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if f != nil {
+		r.handlers = append(r.handlers, f)
+	}
+	return r
+}
+
+// Reload loads the bundle if the file was modified,
+// and returns true if it was reloaded
+func (r *CertPoolReloader) Reload() (bool, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	fi, err := os.Stat(r.path)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	if r.pool.Load() != nil && !fi.ModTime().After(r.modifiedAt) {
+		return false, nil
+	}
+
+	pem, err := os.ReadFile(r.path)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return false, errors.Errorf("no certificates found in %s", r.path)
+	}
+
+	first := r.pool.Load() == nil
+	r.pool.Store(pool)
+	r.modifiedAt = fi.ModTime()
+	atomic.AddUint32(&r.count, 1)
+
+	if !first {
+		logger.KV(xlog.NOTICE, "status", "reloaded", "file", r.path, "count", r.count)
+		for _, h := range r.handlers {
+			go h(pool)
+		}
+	}
+	return true, nil
+}
+
+// GetConfigForClient returns a callback for server's TLSConfig,
+// that uses the current pool to verify client certificates
+func (r *CertPoolReloader) GetConfigForClient(base *tls.Config) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(_ *tls.ClientHelloInfo) (*tls.Config, error) {
+		cfg := base.Clone()
+		cfg.GetConfigForClient = nil
+		cfg.ClientCAs = r.CertPool()
+		return cfg, nil
+	}
+}
+
+// Close will stop the reloader and release its resources
+func (r *CertPoolReloader) Close() error {
+	if r == nil {
+		return nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return errors.New("already closed")
+	}
+	r.closed = true
+	close(r.stopChan)
+	return nil
+}
@@ -0,0 +1,80 @@
+package tlsconfig_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/tlsconfig"
+	"github.com/effective-security/xpki/testca"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertPoolReloader(t *testing.T) {
+	pemCert, _, err := testca.MakeSelfCertRSAPem(1)
+	require.NoError(t, err)
+
+	caFile := filepath.Join(t.TempDir(), "client-ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pemCert, 0o600))
+
+	_, err = tlsconfig.NewCertPoolReloader(filepath.Join(t.TempDir(), "notfound.pem"), time.Hour)
+	require.Error(t, err)
+
+	r, err := tlsconfig.NewCertPoolReloader(caFile, time.Hour)
+	require.NoError(t, err)
+	defer r.Close()
+
+	pool := r.CertPool()
+	require.NotNil(t, pool)
+	assert.Equal(t, uint32(1), r.LoadedCount())
+
+	reloaded := make(chan *x509.CertPool, 1)
+	r.OnReload(func(p *x509.CertPool) {
+		reloaded <- p
+	})
+
+	changed, err := r.Reload()
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	pemCert2, _, err := testca.MakeSelfCertRSAPem(1)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(caFile, pemCert2, 0o600))
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(caFile, future, future))
+
+	changed, err = r.Reload()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, uint32(2), r.LoadedCount())
+
+	select {
+	case p := <-reloaded:
+		assert.Same(t, r.CertPool(), p)
+		assert.NotSame(t, pool, p)
+	case <-time.After(time.Second):
+		t.Fatal("OnReload was not called")
+	}
+
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+	base.GetConfigForClient = r.GetConfigForClient(base)
+	cfg, err := base.GetConfigForClient(nil)
+	require.NoError(t, err)
+	assert.Nil(t, cfg.GetConfigForClient)
+	assert.Same(t, r.CertPool(), cfg.ClientCAs)
+
+	// invalid bundle keeps the current pool
+	require.NoError(t, os.WriteFile(caFile, []byte("invalid"), 0o600))
+	future = future.Add(time.Minute)
+	require.NoError(t, os.Chtimes(caFile, future, future))
+	_, err = r.Reload()
+	require.Error(t, err)
+	assert.NotNil(t, r.CertPool())
+
+	require.NoError(t, r.Close())
+	assert.EqualError(t, r.Close(), "already closed")
+}
@@ -0,0 +1,293 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/effective-security/porto/metricskey"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultTrustBundleInterval is the default interval to check for trust bundle updates
+	DefaultTrustBundleInterval = time.Hour
+	// DefaultTrustBundleSignatureHeader is the default response header,
+	// that contains base64 encoded signature of the bundle
+	DefaultTrustBundleSignatureHeader = "X-Bundle-Signature"
+
+	maxTrustBundleSize = 10 * 1024 * 1024
+)
+
+// VerifyBundleFunc verifies the signature of the trust bundle
+type VerifyBundleFunc func(bundle, signature []byte) error
+
+// OnTrustBundleFunc is a callback to handle trust bundle update
+type OnTrustBundleFunc func(pool *x509.CertPool)
+
+// TrustBundleConfig provides configuration for TrustBundleManager
+type TrustBundleConfig struct {
+	// URL of PEM encoded CA bundle
+	URL string
+	// Interval to check for updates, default is DefaultTrustBundleInterval
+	Interval time.Duration
+	// Client is HTTP client to fetch the bundle, default is http.DefaultClient
+	Client *http.Client
+	// Verify is optional callback to verify the bundle signature,
+	// if specified, the response without signature is rejected
+	Verify VerifyBundleFunc
+	// SignatureHeader is the response header with base64 encoded signature,
+	// default is DefaultTrustBundleSignatureHeader
+	SignatureHeader string
+}
+
+// TrustBundleManager periodically fetches CA bundle from the remote endpoint,
+// and notifies the handlers on changes
+type TrustBundleManager struct {
+	cfg      TrustBundleConfig
+	pool     atomic.Pointer[x509.CertPool]
+	count    uint32
+	stopChan chan struct{}
+
+	lock     sync.Mutex
+	etag     string
+	digest   [sha256.Size]byte
+	loadedAt time.Time
+	handlers []OnTrustBundleFunc
+	closed   bool
+}
+
+// NewTrustBundleManager returns TrustBundleManager,
+// the bundle is fetched before the function returns
+func NewTrustBundleManager(cfg TrustBundleConfig) (*TrustBundleManager, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("trust bundle URL is required")
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultTrustBundleInterval
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.SignatureHeader == "" {
+		cfg.SignatureHeader = DefaultTrustBundleSignatureHeader
+	}
+
+	m := &TrustBundleManager{
+		cfg:      cfg,
+		stopChan: make(chan struct{}),
+	}
+	if _, err := m.Refresh(context.Background()); err != nil {
+		return nil, err
+	}
+
+	tickerStop, tickChan := makeTicker(cfg.Interval)
+	go func() {
+		for {
+			select {
+			case <-m.stopChan:
+				tickerStop()
+				logger.KV(xlog.TRACE, "status", "closed", "url", cfg.URL, "count", m.LoadedCount())
+				return
+			case <-tickChan:
+				_, err := m.Refresh(context.Background())
+				if err != nil {
+					logger.KV(xlog.ERROR, "url", cfg.URL, "err", err.Error())
+				}
+			}
+		}
+	}()
+
+	return m, nil
+}
+
+// CertPool returns the current pool of trusted CAs
+func (m *TrustBundleManager) CertPool() *x509.CertPool {
+	return m.pool.Load()
+}
+
+// LoadedAt returns the last time when the bundle was changed
+func (m *TrustBundleManager) LoadedAt() time.Time {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.loadedAt
+}
+
+// LoadedCount returns the number of times the bundle was changed
+func (m *TrustBundleManager) LoadedCount() uint32 {
+	return atomic.LoadUint32(&m.count)
+}
+
+// OnUpdate allows to add OnTrustBundleFunc handler
+func (m *TrustBundleManager) OnUpdate(f OnTrustBundleFunc) *TrustBundleManager {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if f != nil {
+		m.handlers = append(m.handlers, f)
+	}
+	return m
+}
+
+// Refresh fetches the bundle, and returns true if it was changed
+func (m *TrustBundleManager) Refresh(ctx context.Context) (bool, error) {
+	changed, err := m.refresh(ctx)
+	status := "unchanged"
+	if err != nil {
+		status = "failed"
+	} else if changed {
+		status = "updated"
+	}
+	metricskey.TLSTrustBundleUpdates.IncrCounter(1, status)
+	return changed, err
+}
+
+func (m *TrustBundleManager) refresh(ctx context.Context) (bool, error) {
+	m.lock.Lock()
+	etag := m.etag
+	m.lock.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.cfg.URL, nil)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := m.cfg.Client.Do(req)
+	if err != nil {
+		return false, errors.WithMessage(err, "failed to fetch trust bundle")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, errors.Errorf("failed to fetch trust bundle: %s", resp.Status)
+	}
+
+	bundle, err := io.ReadAll(io.LimitReader(resp.Body, maxTrustBundleSize))
+	if err != nil {
+		return false, errors.WithMessage(err, "failed to read trust bundle")
+	}
+
+	if m.cfg.Verify != nil {
+		sig, err := base64.StdEncoding.DecodeString(resp.Header.Get(m.cfg.SignatureHeader))
+		if err != nil || len(sig) == 0 {
+			return false, errors.New("trust bundle signature is missing")
+		}
+		if err = m.cfg.Verify(bundle, sig); err != nil {
+			return false, errors.WithMessage(err, "invalid trust bundle signature")
+		}
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return false, errors.New("trust bundle does not contain certificates")
+	}
+
+	digest := sha256.Sum256(bundle)
+
+	etag = resp.Header.Get("ETag")
+	m.lock.Lock()
+	m.etag = etag
+	if digest == m.digest {
+		m.lock.Unlock()
+		return false, nil
+	}
+	m.digest = digest
+	m.loadedAt = time.Now().UTC()
+	m.pool.Store(pool)
+	count := atomic.AddUint32(&m.count, 1)
+	handlers := m.handlers
+	m.lock.Unlock()
+
+	logger.KV(xlog.NOTICE, "status", "trust_bundle_updated", "url", m.cfg.URL, "count", count, "etag", etag)
+
+	// execute notifications outside of the lock
+	for _, h := range handlers {
+		go h(pool)
+	}
+	return true, nil
+}
+
+// GetConfigForClient returns a callback for server's TLSConfig,
+// that uses the current trust bundle to verify client certificates
+func (m *TrustBundleManager) GetConfigForClient(base *tls.Config) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(_ *tls.ClientHelloInfo) (*tls.Config, error) {
+		cfg := base.Clone()
+		cfg.GetConfigForClient = nil
+		cfg.ClientCAs = m.CertPool()
+		return cfg, nil
+	}
+}
+
+// Close will stop the manager and release its resources
+func (m *TrustBundleManager) Close() error {
+	if m == nil {
+		return nil
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.closed {
+		return errors.New("already closed")
+	}
+	m.closed = true
+	close(m.stopChan)
+	return nil
+}
+
+// WithTrustBundle updates RootCAs of the transport on trust bundle changes
+func (t *HTTPTransport) WithTrustBundle(m *TrustBundleManager) *HTTPTransport {
+	update := func(pool *x509.CertPool) {
+		t.lock.Lock()
+		t.tlsConfig = t.tlsConfig.Clone()
+		t.tlsConfig.RootCAs = pool
+		t.transport.CloseIdleConnections()
+		t.lock.Unlock()
+	}
+	update(m.CertPool())
+	m.OnUpdate(update)
+	return t
+}
+
+// VerifyWithPublicKey returns VerifyBundleFunc, that verifies
+// SHA-256 signature with ECDSA, RSA PKCS#1 v1.5 or Ed25519 public key
+func VerifyWithPublicKey(pub crypto.PublicKey) VerifyBundleFunc {
+	return func(bundle, signature []byte) error {
+		digest := sha256.Sum256(bundle)
+		switch key := pub.(type) {
+		case *ecdsa.PublicKey:
+			if !ecdsa.VerifyASN1(key, digest[:], signature) {
+				return errors.New("ECDSA verification failed")
+			}
+		case *rsa.PublicKey:
+			if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+				return errors.WithStack(err)
+			}
+		case ed25519.PublicKey:
+			if !ed25519.Verify(key, bundle, signature) {
+				return errors.New("Ed25519 verification failed")
+			}
+		default:
+			return errors.Errorf("unsupported public key: %T", pub)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,168 @@
+package tlsconfig_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/tlsconfig"
+	"github.com/effective-security/xpki/testca"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bundleServer struct {
+	lock     sync.Mutex
+	bundle   []byte
+	etag     string
+	sig      string
+	notModif int
+}
+
+func (s *bundleServer) set(bundle []byte, etag string, key crypto.Signer) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.bundle = bundle
+	s.etag = etag
+	s.sig = ""
+	if key != nil {
+		digest := sha256.Sum256(bundle)
+		sig, _ := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+		s.sig = base64.StdEncoding.EncodeToString(sig)
+	}
+}
+
+func (s *bundleServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if r.Header.Get("If-None-Match") == s.etag {
+		s.notModif++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", s.etag)
+	if s.sig != "" {
+		w.Header().Set(tlsconfig.DefaultTrustBundleSignatureHeader, s.sig)
+	}
+	_, _ = w.Write(s.bundle)
+}
+
+func certPEM(c *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+}
+
+func Test_TrustBundleManager(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+	// client cert, and CA in the initial bundle
+	pemCert, pemKey, err := testca.MakeSelfCertRSAPem(1)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	bs := &bundleServer{}
+	bs.set(pemCert, "v1", key)
+	server := httptest.NewServer(bs)
+	defer server.Close()
+
+	_, err = tlsconfig.NewTrustBundleManager(tlsconfig.TrustBundleConfig{})
+	assert.EqualError(t, err, "trust bundle URL is required")
+
+	m, err := tlsconfig.NewTrustBundleManager(tlsconfig.TrustBundleConfig{
+		URL:    server.URL,
+		Verify: tlsconfig.VerifyWithPublicKey(key.Public()),
+	})
+	require.NoError(t, err)
+	defer m.Close()
+	assert.Equal(t, uint32(1), m.LoadedCount())
+	assert.False(t, m.LoadedAt().IsZero())
+
+	updated := make(chan *x509.CertPool, 1)
+	m.OnUpdate(func(pool *x509.CertPool) { updated <- pool })
+
+	// client transport
+	pemFile := filepath.Join(t.TempDir(), "cert.pem")
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(pemFile, pemCert, 0600))
+	require.NoError(t, os.WriteFile(keyFile, pemKey, 0600))
+	tr, err := tlsconfig.NewHTTPTransportWithReloader(pemFile, keyFile, "", time.Minute, nil)
+	require.NoError(t, err)
+	defer tr.Close()
+	tr.WithTrustBundle(m)
+
+	call := func() error {
+		r, err := http.NewRequest(http.MethodGet, target.URL, nil)
+		require.NoError(t, err)
+		resp, err := tr.RoundTrip(r)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	assert.Error(t, call())
+
+	// not modified
+	changed, err := m.Refresh(context.Background())
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, 1, bs.notModif)
+
+	// same content with new ETag
+	bs.set(pemCert, "v2", key)
+	changed, err = m.Refresh(context.Background())
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	// rotation
+	bs.set(append(pemCert, certPEM(target.Certificate())...), "v3", key)
+	changed, err = m.Refresh(context.Background())
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, uint32(2), m.LoadedCount())
+	select {
+	case pool := <-updated:
+		assert.Equal(t, m.CertPool(), pool)
+	case <-time.After(time.Second):
+		t.Fatal("handler not called")
+	}
+	require.Eventually(t, func() bool { return call() == nil }, time.Second, 10*time.Millisecond)
+
+	cfg, err := m.GetConfigForClient(&tls.Config{ClientAuth: tls.RequireAndVerifyClientCert})(nil)
+	require.NoError(t, err)
+	assert.Equal(t, m.CertPool(), cfg.ClientCAs)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, cfg.ClientAuth)
+
+	// invalid signature
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	bs.set(certPEM(target.Certificate()), "v4", otherKey)
+	_, err = m.Refresh(context.Background())
+	assert.EqualError(t, err, "invalid trust bundle signature: ECDSA verification failed")
+
+	bs.set(certPEM(target.Certificate()), "v5", nil)
+	_, err = m.Refresh(context.Background())
+	assert.EqualError(t, err, "trust bundle signature is missing")
+
+	bs.set([]byte("garbage"), "v6", key)
+	_, err = m.Refresh(context.Background())
+	assert.EqualError(t, err, "trust bundle does not contain certificates")
+	assert.Equal(t, uint32(2), m.LoadedCount())
+
+	assert.NoError(t, m.Close())
+	assert.EqualError(t, m.Close(), "already closed")
+}
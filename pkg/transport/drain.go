@@ -0,0 +1,172 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/effective-security/porto/metricskey"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/xlog"
+)
+
+// Drain modes reported in metrics
+const (
+	// DrainGraceful is reported when the response is sent with "Connection: close",
+	// that closes HTTP/1 connection, or sends GOAWAY for HTTP/2
+	DrainGraceful = "graceful"
+	// DrainIdle is reported when the idle connection is closed
+	DrainIdle = "idle"
+)
+
+type connContextKey struct{}
+
+type drainState struct {
+	state   http.ConnState
+	reason  string
+	drained bool
+}
+
+// ConnDrainer tracks the server connections, and gracefully closes
+// the connections established before the TLS rotation,
+// so the clients re-handshake against the new cert or client CA bundle.
+// The connections are drained over the period to avoid the reconnect storm.
+type ConnDrainer struct {
+	period time.Duration
+
+	lock   sync.Mutex
+	conns  map[net.Conn]*drainState
+	timers []*time.Timer
+	closed bool
+}
+
+// NewConnDrainer returns ConnDrainer
+func NewConnDrainer(period time.Duration) *ConnDrainer {
+	return &ConnDrainer{
+		period: period,
+		conns:  make(map[net.Conn]*drainState),
+	}
+}
+
+// ConnState is a callback for http.Server.ConnState
+func (d *ConnDrainer) ConnState(c net.Conn, state http.ConnState) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	switch state {
+	case http.StateHijacked, http.StateClosed:
+		delete(d.conns, c)
+		return
+	}
+
+	st := d.conns[c]
+	if st == nil {
+		st = &drainState{}
+		d.conns[c] = st
+	}
+	st.state = state
+	if state == http.StateIdle && st.reason != "" {
+		d.closeIdle(c, st)
+	}
+}
+
+// ConnContext is a callback for http.Server.ConnContext
+func (d *ConnDrainer) ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, c)
+}
+
+// Handler returns the handler, that responds with "Connection: close"
+// to the requests started on the connections to drain
+func (d *ConnDrainer) Handler(delegate http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, ok := r.Context().Value(connContextKey{}).(net.Conn); ok {
+			if reason := d.draining(c); reason != "" {
+				w.Header().Set(header.Connection, "close")
+			}
+		}
+		delegate.ServeHTTP(w, r)
+	})
+}
+
+// Drain schedules the current connections to be drained over the period
+func (d *ConnDrainer) Drain(reason string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.closed {
+		return
+	}
+
+	var conns []net.Conn
+	for c, st := range d.conns {
+		if st.reason == "" {
+			conns = append(conns, c)
+		}
+	}
+
+	logger.KV(xlog.NOTICE, "status", "drain", "reason", reason, "conns", len(conns), "period", d.period)
+	if len(conns) == 0 {
+		return
+	}
+
+	step := d.period / time.Duration(len(conns))
+	for i, c := range conns {
+		d.timers = append(d.timers, time.AfterFunc(step*time.Duration(i), func() {
+			d.mark(c, reason)
+		}))
+	}
+}
+
+// Close stops the scheduled drains
+func (d *ConnDrainer) Close() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.closed = true
+	for _, t := range d.timers {
+		t.Stop()
+	}
+	d.timers = nil
+}
+
+func (d *ConnDrainer) mark(c net.Conn, reason string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	st := d.conns[c]
+	if st == nil || st.reason != "" {
+		return
+	}
+	st.reason = reason
+	if st.state == http.StateIdle {
+		d.closeIdle(c, st)
+	}
+}
+
+// draining returns the reason, if the connection is marked to drain
+func (d *ConnDrainer) draining(c net.Conn) string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	st := d.conns[c]
+	if st == nil || st.reason == "" {
+		return ""
+	}
+	if !st.drained {
+		st.drained = true
+		metricskey.TLSConnDrained.IncrCounter(1, st.reason, DrainGraceful)
+	}
+	return st.reason
+}
+
+// closeIdle closes the idle connection, must be called under the lock
+func (d *ConnDrainer) closeIdle(c net.Conn, st *drainState) {
+	if !st.drained {
+		st.drained = true
+		metricskey.TLSConnDrained.IncrCounter(1, st.reason, DrainIdle)
+	}
+	delete(d.conns, c)
+	go c.Close()
+}
@@ -0,0 +1,177 @@
+package transport
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// drainServer returns the test server with ConnDrainer,
+// the handler blocks while the release channel is not closed
+func drainServer(t *testing.T, http2 bool, release <-chan struct{}, started chan<- struct{}) (*httptest.Server, *ConnDrainer, *atomic.Int32) {
+	d := NewConnDrainer(0)
+	var conns atomic.Int32
+
+	server := httptest.NewUnstartedServer(d.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/block" {
+			started <- struct{}{}
+			<-release
+		}
+		_, _ = w.Write([]byte("ok"))
+	})))
+	server.Config.ConnContext = d.ConnContext
+	server.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+		d.ConnState(c, state)
+	}
+	server.EnableHTTP2 = http2
+	server.StartTLS()
+	t.Cleanup(func() {
+		d.Close()
+		server.Close()
+	})
+	return server, d, &conns
+}
+
+func get(t *testing.T, client *http.Client, url string) *http.Response {
+	resp, err := client.Get(url)
+	require.NoError(t, err)
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp
+}
+
+func TestConnDrainer(t *testing.T) {
+	for _, h2 := range []bool{false, true} {
+		name := "http1"
+		if h2 {
+			name = "http2"
+		}
+		t.Run(name+"_inflight", func(t *testing.T) {
+			release := make(chan struct{})
+			started := make(chan struct{}, 2)
+			server, d, conns := drainServer(t, h2, release, started)
+			client := server.Client()
+
+			resp := get(t, client, server.URL+"/")
+			assert.Equal(t, h2, resp.ProtoMajor == 2)
+			assert.Equal(t, int32(1), conns.Load())
+
+			done := make(chan *http.Response, 2)
+			go func() {
+				done <- get(t, client, server.URL+"/block")
+			}()
+			<-started
+			d.Drain(RotationServerCert)
+			// wait for the scheduled drain
+			assert.Eventually(t, func() bool {
+				return d.draining(connOf(d)) != ""
+			}, time.Second, 10*time.Millisecond)
+
+			if h2 {
+				// the concurrent request on the same connection
+				// is responded with GOAWAY
+				go func() {
+					done <- get(t, client, server.URL+"/block")
+				}()
+				<-started
+				assert.Equal(t, int32(1), conns.Load())
+			}
+			close(release)
+			<-done
+			if h2 {
+				<-done
+			}
+
+			get(t, client, server.URL+"/")
+			assert.Equal(t, int32(2), conns.Load(), "expected new connection")
+		})
+
+		t.Run(name+"_idle", func(t *testing.T) {
+			server, d, conns := drainServer(t, h2, nil, nil)
+			client := server.Client()
+
+			get(t, client, server.URL+"/")
+			assert.Equal(t, int32(1), conns.Load())
+
+			d.Drain(RotationClientCA)
+			assert.Eventually(t, func() bool {
+				d.lock.Lock()
+				defer d.lock.Unlock()
+				return len(d.conns) == 0
+			}, time.Second, 10*time.Millisecond)
+
+			get(t, client, server.URL+"/")
+			assert.Equal(t, int32(2), conns.Load(), "expected new connection")
+		})
+	}
+
+	t.Run("closed", func(t *testing.T) {
+		server, d, conns := drainServer(t, false, nil, nil)
+		client := server.Client()
+		get(t, client, server.URL+"/")
+
+		d.Close()
+		d.Drain(RotationServerCert)
+		time.Sleep(50 * time.Millisecond)
+		get(t, client, server.URL+"/")
+		assert.Equal(t, int32(1), conns.Load())
+	})
+}
+
+// connOf returns the tracked connection, if only one
+func connOf(d *ConnDrainer) net.Conn {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for c := range d.conns {
+		return c
+	}
+	return nil
+}
+
+func TestTLSInfo_OnRotation(t *testing.T) {
+	caFile := serverRootFile + ".client"
+	pem, err := os.ReadFile(serverRootFile)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(caFile, pem, 0o600))
+	defer os.Remove(caFile)
+
+	tlsInfo := &TLSInfo{
+		CertFile:     serverCertFile,
+		KeyFile:      serverKeyFile,
+		ClientCAFile: caFile,
+	}
+	defer tlsInfo.Close()
+
+	cfg, err := tlsInfo.ServerTLSWithReloader()
+	require.NoError(t, err)
+	require.NotNil(t, cfg.GetConfigForClient)
+
+	reasons := make(chan string, 1)
+	tlsInfo.OnRotation(func(reason string) {
+		reasons <- reason
+	})
+
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(caFile, future, future))
+	changed, err := tlsInfo.caReloader.Reload()
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	select {
+	case reason := <-reasons:
+		assert.Equal(t, RotationClientCA, reason)
+	case <-time.After(time.Second):
+		t.Fatal("OnRotation was not called")
+	}
+}
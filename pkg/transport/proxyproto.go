@@ -0,0 +1,275 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+// DefaultProxyHeaderTimeout is the default timeout to read PROXY protocol header
+const DefaultProxyHeaderTimeout = 5 * time.Second
+
+// proxyV2Signature is the signature of PROXY protocol v2 header
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyV1Prefix is the prefix of PROXY protocol v1 header
+var proxyV1Prefix = []byte("PROXY ")
+
+// maxProxyV1Length is the maximum length of PROXY protocol v1 header
+const maxProxyV1Length = 107
+
+// ProxyConfig specifies PROXY protocol listener
+type ProxyConfig struct {
+	// Required specifies to reject the connections without PROXY header,
+	// by default the header is optional
+	Required bool
+	// Trusted specifies the networks of the load balancers,
+	// allowed to send PROXY header; if empty, all sources are trusted.
+	// The connections from other sources are served with the peer address.
+	Trusted []*net.IPNet
+	// HeaderTimeout specifies the timeout to read the header, default 5s
+	HeaderTimeout time.Duration
+}
+
+// NewProxyListener returns a listener, that parses PROXY protocol v1 and v2 headers,
+// sent by the load balancers, and reports the client address as RemoteAddr of the connections.
+// The header is read on the first Read or RemoteAddr call of the connection,
+// so Accept is not blocked by the slow clients.
+func NewProxyListener(l net.Listener, cfg ProxyConfig) net.Listener {
+	if cfg.HeaderTimeout <= 0 {
+		cfg.HeaderTimeout = DefaultProxyHeaderTimeout
+	}
+	return &proxyListener{Listener: l, cfg: cfg}
+}
+
+// ParseCIDRs returns the list of the networks,
+// the addresses without prefix length are parsed as single hosts
+func ParseCIDRs(list []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, errors.Errorf("invalid address: %s", s)
+			}
+			bits := 128
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+type proxyListener struct {
+	net.Listener
+	cfg ProxyConfig
+}
+
+// Accept waits for and returns the next connection
+func (l *proxyListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.trusted(c.RemoteAddr()) {
+		return c, nil
+	}
+	return &proxyConn{
+		Conn: c,
+		r:    bufio.NewReader(c),
+		cfg:  &l.cfg,
+	}, nil
+}
+
+func (l *proxyListener) trusted(addr net.Addr) bool {
+	if len(l.cfg.Trusted) == 0 {
+		return true
+	}
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, n := range l.cfg.Trusted {
+		if n.Contains(tcp.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyConn is the connection with PROXY protocol header
+type proxyConn struct {
+	net.Conn
+	r   *bufio.Reader
+	cfg *ProxyConfig
+
+	once   sync.Once
+	err    error
+	remote net.Addr
+	local  net.Addr
+}
+
+// Read reads the data after the header
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the client address from the header,
+// or the peer address if the header does not provide it
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the destination address from the header,
+// or the local address if the header does not provide it
+func (c *proxyConn) LocalAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.local != nil {
+		return c.local
+	}
+	return c.Conn.LocalAddr()
+}
+
+func (c *proxyConn) readHeader() {
+	_ = c.Conn.SetReadDeadline(time.Now().Add(c.cfg.HeaderTimeout))
+	c.err = c.parse()
+	_ = c.Conn.SetReadDeadline(time.Time{})
+
+	if c.err != nil {
+		logger.KV(xlog.WARNING,
+			"reason", "proxy_protocol",
+			"remote", c.Conn.RemoteAddr().String(),
+			"err", c.err.Error())
+		_ = c.Conn.Close()
+	}
+}
+
+func (c *proxyConn) parse() error {
+	b, err := c.r.Peek(len(proxyV1Prefix))
+	if err != nil {
+		if len(b) > 0 && !c.cfg.Required && !bytes.HasPrefix(proxyV1Prefix, b) {
+			// short request without the header
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+	if bytes.Equal(b, proxyV1Prefix) {
+		return c.parseV1()
+	}
+	if b[0] == proxyV2Signature[0] {
+		b, err = c.r.Peek(len(proxyV2Signature))
+		if err == nil && bytes.Equal(b, proxyV2Signature) {
+			return c.parseV2()
+		}
+	}
+	if c.cfg.Required {
+		return errors.New("PROXY protocol header is required")
+	}
+	return nil
+}
+
+// parseV1 parses the text header:
+// PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n
+func (c *proxyConn) parseV1() error {
+	var line []byte
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= maxProxyV1Length {
+			return errors.New("PROXY v1 header is too long")
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return errors.New("invalid PROXY v1 header")
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return errors.New("invalid PROXY v1 header")
+	}
+	src, dst := net.ParseIP(fields[2]), net.ParseIP(fields[3])
+	sport, err1 := strconv.ParseUint(fields[4], 10, 16)
+	dport, err2 := strconv.ParseUint(fields[5], 10, 16)
+	if src == nil || dst == nil || err1 != nil || err2 != nil {
+		return errors.New("invalid PROXY v1 address")
+	}
+	c.remote = &net.TCPAddr{IP: src, Port: int(sport)}
+	c.local = &net.TCPAddr{IP: dst, Port: int(dport)}
+	return nil
+}
+
+// parseV2 parses the binary header
+func (c *proxyConn) parseV2() error {
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(c.r, hdr); err != nil {
+		return errors.WithStack(err)
+	}
+	if hdr[12]>>4 != 2 {
+		return errors.Errorf("unsupported PROXY version: %d", hdr[12]>>4)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return errors.WithStack(err)
+	}
+
+	switch hdr[12] & 0x0F {
+	case 0x0:
+		// LOCAL command: health checks of the load balancer
+		return nil
+	case 0x1:
+		// PROXY command
+	default:
+		return errors.Errorf("unsupported PROXY command: %d", hdr[12]&0x0F)
+	}
+
+	// only TCP over IPv4 and IPv6 are reported, the TLVs are ignored
+	switch hdr[13] {
+	case 0x11:
+		if len(body) < 12 {
+			return errors.New("invalid PROXY v2 address")
+		}
+		c.remote = &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))}
+		c.local = &net.TCPAddr{IP: net.IP(body[4:8]), Port: int(binary.BigEndian.Uint16(body[10:12]))}
+	case 0x21:
+		if len(body) < 36 {
+			return errors.New("invalid PROXY v2 address")
+		}
+		c.remote = &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))}
+		c.local = &net.TCPAddr{IP: net.IP(body[16:32]), Port: int(binary.BigEndian.Uint16(body[34:36]))}
+	}
+	return nil
+}
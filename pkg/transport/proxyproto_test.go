@@ -0,0 +1,156 @@
+package transport
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyListener(t *testing.T) {
+	v2 := func(cmd byte, src, dst net.IP, sport, dport uint16) []byte {
+		b := append([]byte{}, proxyV2Signature...)
+		fam := byte(0x11)
+		if src.To4() == nil {
+			fam = 0x21
+		} else {
+			src, dst = src.To4(), dst.To4()
+		}
+		addr := append(append([]byte{}, src...), dst...)
+		addr = binary.BigEndian.AppendUint16(addr, sport)
+		addr = binary.BigEndian.AppendUint16(addr, dport)
+		// TLV is ignored
+		addr = append(addr, 0x04, 0x00, 0x01, 0xFF)
+		b = append(b, 0x20|cmd, fam)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(addr)))
+		return append(b, addr...)
+	}
+
+	tcs := []struct {
+		name   string
+		cfg    ProxyConfig
+		header []byte
+		remote string
+		// peer specifies that the peer address is reported
+		peer bool
+		err  bool
+	}{
+		{
+			name:   "v1",
+			header: []byte("PROXY TCP4 203.0.113.7 10.0.0.1 56324 443\r\n"),
+			remote: "203.0.113.7:56324",
+		},
+		{
+			name:   "v1_ipv6",
+			header: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 4000 443\r\n"),
+			remote: "[2001:db8::1]:4000",
+		},
+		{
+			name:   "v1_unknown",
+			header: []byte("PROXY UNKNOWN\r\n"),
+			peer:   true,
+		},
+		{
+			name:   "v2",
+			header: v2(1, net.ParseIP("203.0.113.7"), net.ParseIP("10.0.0.1"), 56324, 443),
+			remote: "203.0.113.7:56324",
+		},
+		{
+			name:   "v2_ipv6",
+			header: v2(1, net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"), 4000, 443),
+			remote: "[2001:db8::1]:4000",
+		},
+		{
+			name:   "v2_local",
+			header: v2(0, net.ParseIP("203.0.113.7"), net.ParseIP("10.0.0.1"), 56324, 443),
+			peer:   true,
+		},
+		{
+			name: "no_header",
+			peer: true,
+		},
+		{
+			name: "required",
+			cfg:  ProxyConfig{Required: true},
+			err:  true,
+		},
+		{
+			name:   "untrusted",
+			cfg:    ProxyConfig{Trusted: mustParseCIDRs(t, "10.0.0.0/8")},
+			header: []byte("PROXY TCP4 203.0.113.7 10.0.0.1 56324 443\r\n"),
+			peer:   true,
+		},
+		{
+			name:   "invalid",
+			header: []byte("PROXY TCP4 203.0.113.7\r\n"),
+			err:    true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			tc.cfg.HeaderTimeout = time.Second
+			ln = NewProxyListener(ln, tc.cfg)
+			defer ln.Close()
+
+			go func() {
+				conn, err := net.Dial("tcp", ln.Addr().String())
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				_, _ = conn.Write(append(tc.header, []byte("hello world")...))
+				_, _ = io.Copy(io.Discard, conn)
+			}()
+
+			conn, err := ln.Accept()
+			require.NoError(t, err)
+			defer conn.Close()
+
+			buf := make([]byte, 5)
+			_, err = io.ReadFull(conn, buf)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			if tc.peer {
+				host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+				assert.Equal(t, "127.0.0.1", host)
+			} else {
+				assert.Equal(t, tc.remote, conn.RemoteAddr().String())
+			}
+			if tc.name == "untrusted" {
+				assert.Equal(t, "PROXY", string(buf))
+			} else {
+				assert.Equal(t, "hello", string(buf))
+			}
+		})
+	}
+}
+
+func TestParseCIDRs(t *testing.T) {
+	nets, err := ParseCIDRs([]string{"10.0.0.0/8", "192.168.1.1", "2001:db8::/32"})
+	require.NoError(t, err)
+	require.Len(t, nets, 3)
+	assert.True(t, nets[0].Contains(net.ParseIP("10.1.2.3")))
+	assert.True(t, nets[1].Contains(net.ParseIP("192.168.1.1")))
+	assert.False(t, nets[1].Contains(net.ParseIP("192.168.1.2")))
+	assert.True(t, nets[2].Contains(net.ParseIP("2001:db8::5")))
+
+	_, err = ParseCIDRs([]string{"lb"})
+	assert.EqualError(t, err, "invalid address: lb")
+}
+
+func mustParseCIDRs(t *testing.T, list ...string) []*net.IPNet {
+	nets, err := ParseCIDRs(list)
+	require.NoError(t, err)
+	return nets
+}
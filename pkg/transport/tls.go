@@ -2,6 +2,7 @@ package transport
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"time"
 
@@ -46,8 +47,19 @@ type TLSInfo struct {
 
 	tlsCfg      *tls.Config
 	tlsReloader *tlsconfig.KeypairReloader
+	caReloader  *tlsconfig.CertPoolReloader
 }
 
+// Rotation reasons reported to OnRotationFunc
+const (
+	RotationServerCert = "server_cert"
+	RotationClientCA   = "client_ca"
+)
+
+// OnRotationFunc is a callback to handle rotation of the server cert,
+// or the client CA bundle
+type OnRotationFunc func(reason string)
+
 func (info *TLSInfo) String() string {
 	return fmt.Sprintf("cert=%s, key=%s, trusted-ca=%s, client-ca=%s, client-cert-auth=%d",
 		info.CertFile, info.KeyFile, info.TrustedCAFile, info.ClientCAFile, int(info.ClientAuthType))
@@ -64,6 +76,10 @@ func (info *TLSInfo) Close() {
 		info.tlsReloader.Close()
 		info.tlsReloader = nil
 	}
+	if info.caReloader != nil {
+		info.caReloader.Close()
+		info.caReloader = nil
+	}
 	if info.tlsCfg != nil {
 		info.tlsCfg = nil
 	}
@@ -114,5 +130,29 @@ func (info *TLSInfo) ServerTLSWithReloader() (*tls.Config, error) {
 	//  TODO: tlsloader.WithOCSPStaple(cfg.OCSPFile)
 	info.tlsCfg.GetCertificate = info.tlsReloader.GetKeypairFunc()
 
+	if info.ClientCAFile != "" {
+		info.caReloader, err = tlsconfig.NewCertPoolReloader(info.ClientCAFile, 5*time.Minute)
+		if err != nil {
+			return nil, err
+		}
+		info.tlsCfg.GetConfigForClient = info.caReloader.GetConfigForClient(info.tlsCfg)
+	}
+
 	return info.tlsCfg, nil
 }
+
+// OnRotation allows to add OnRotationFunc handler,
+// that is called when the server cert or the client CA bundle is reloaded.
+// Must be called after ServerTLSWithReloader.
+func (info *TLSInfo) OnRotation(f OnRotationFunc) {
+	if info.tlsReloader != nil {
+		info.tlsReloader.OnReload(func(*tls.Certificate) {
+			f(RotationServerCert)
+		})
+	}
+	if info.caReloader != nil {
+		info.caReloader.OnReload(func(*x509.CertPool) {
+			f(RotationClientCA)
+		})
+	}
+}
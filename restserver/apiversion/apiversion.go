@@ -0,0 +1,233 @@
+// Package apiversion provides API version negotiation:
+// the version is parsed from the path prefix, X-API-Version header,
+// or Accept header, validated and exposed in the request context.
+//
+// The supported formats:
+//
+//	GET /v2/items
+//	X-API-Version: 2
+//	Accept: application/json; version=2
+//	Accept: application/vnd.example.v2+json
+package apiversion
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/porto/xhttp/marshal"
+	"github.com/effective-security/porto/xhttp/reqctx"
+)
+
+// Source of the version
+const (
+	SourceDefault = "default"
+	SourcePath    = "path"
+	SourceHeader  = "header"
+	SourceAccept  = "accept"
+)
+
+// VersionKey is the context key of the negotiated Version
+var VersionKey = reqctx.NewKey[Version]("api_version")
+
+var (
+	pathVersion   = regexp.MustCompile(`^/(v\d+)(/|$)`)
+	vendorVersion = regexp.MustCompile(`\.(v\d+)(\+|$)`)
+)
+
+// Version is the negotiated API version
+type Version struct {
+	// Value of the version, in v<number> format
+	Value string
+	// Source of the version
+	Source string
+}
+
+// Normalize returns the version in v<number> format
+func Normalize(v string) string {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if v != "" && v[0] >= '0' && v[0] <= '9' {
+		return "v" + v
+	}
+	return v
+}
+
+// WithVersion returns the context with the version
+func WithVersion(ctx context.Context, v Version) context.Context {
+	return VersionKey.WithValue(ctx, v)
+}
+
+// FromContext returns the version from the context,
+// or empty string if not negotiated
+func FromContext(ctx context.Context) string {
+	return VersionKey.Get(ctx).Value
+}
+
+// FromRequest returns the version of the request
+func FromRequest(r *http.Request) Version {
+	return VersionKey.Get(r.Context())
+}
+
+// Option configures Negotiator
+type Option interface {
+	apply(*Negotiator)
+}
+
+type optionFunc func(*Negotiator)
+
+func (f optionFunc) apply(n *Negotiator) {
+	f(n)
+}
+
+// WithDefault specifies the version, when not requested by the client
+func WithDefault(version string) Option {
+	return optionFunc(func(n *Negotiator) {
+		n.def = Normalize(version)
+	})
+}
+
+// WithStripPrefix specifies to remove the version prefix from the path,
+// so the same logical route serves all versions
+func WithStripPrefix() Option {
+	return optionFunc(func(n *Negotiator) {
+		n.stripPrefix = true
+	})
+}
+
+// Negotiator parses and validates the requested API version
+type Negotiator struct {
+	supported   map[string]bool
+	def         string
+	stripPrefix bool
+}
+
+// New returns Negotiator for the supported versions,
+// the first version is the default
+func New(supported []string, opts ...Option) *Negotiator {
+	n := &Negotiator{
+		supported: make(map[string]bool, len(supported)),
+	}
+	for _, v := range supported {
+		n.supported[Normalize(v)] = true
+	}
+	if len(supported) > 0 {
+		n.def = Normalize(supported[0])
+	}
+	for _, opt := range opts {
+		opt.apply(n)
+	}
+	return n
+}
+
+// IsSupported returns true if the version is supported
+func (n *Negotiator) IsSupported(version string) bool {
+	return n.supported[Normalize(version)]
+}
+
+// Parse returns the version requested by the client
+func (n *Negotiator) Parse(r *http.Request) (Version, *httperror.Error) {
+	var found []Version
+	if m := pathVersion.FindStringSubmatch(r.URL.Path); m != nil {
+		found = append(found, Version{Value: m[1], Source: SourcePath})
+	}
+	if hv := r.Header.Get(header.XAPIVersion); hv != "" {
+		found = append(found, Version{Value: Normalize(hv), Source: SourceHeader})
+	}
+	if av := acceptVersion(r.Header.Values(header.Accept)); av != "" {
+		found = append(found, Version{Value: av, Source: SourceAccept})
+	}
+
+	if len(found) == 0 {
+		if n.def == "" {
+			return Version{}, httperror.New(http.StatusBadRequest, httperror.CodeUnsupportedVersion,
+				"API version is required")
+		}
+		return Version{Value: n.def, Source: SourceDefault}, nil
+	}
+
+	v := found[0]
+	for _, other := range found[1:] {
+		if other.Value != v.Value {
+			return Version{}, httperror.New(http.StatusBadRequest, httperror.CodeUnsupportedVersion,
+				"conflicting API version: %s %s, %s %s", v.Source, v.Value, other.Source, other.Value)
+		}
+	}
+	if !n.supported[v.Value] {
+		status := http.StatusBadRequest
+		if v.Source == SourceAccept {
+			status = http.StatusNotAcceptable
+		}
+		return Version{}, httperror.New(status, httperror.CodeUnsupportedVersion,
+			"unsupported API version: %s", v.Value)
+	}
+	return v, nil
+}
+
+// Handler returns the handler that negotiates the version,
+// and returns 400 or 406 for unsupported versions
+func (n *Negotiator) Handler(delegate http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add(header.Vary, header.Accept+", "+header.XAPIVersion)
+
+		v, err := n.Parse(r)
+		if err != nil {
+			marshal.WriteJSON(w, r, err.WithContext(r.Context()))
+			return
+		}
+		w.Header().Set(header.XAPIVersion, v.Value)
+
+		r = r.WithContext(WithVersion(r.Context(), v))
+		if n.stripPrefix && v.Source == SourcePath {
+			r.URL.Path = strings.TrimPrefix(r.URL.Path, "/"+v.Value)
+			if r.URL.Path == "" {
+				r.URL.Path = "/"
+			}
+			r.URL.RawPath = ""
+		}
+		delegate.ServeHTTP(w, r)
+	})
+}
+
+// acceptVersion returns the version from Accept header,
+// as version parameter or vendor media type
+func acceptVersion(values []string) string {
+	for _, val := range values {
+		for _, accept := range strings.Split(val, ",") {
+			mt, params, err := mime.ParseMediaType(accept)
+			if err != nil {
+				continue
+			}
+			if v := params["version"]; v != "" {
+				return Normalize(v)
+			}
+			if m := vendorVersion.FindStringSubmatch(mt); m != nil && strings.Contains(mt, "/vnd.") {
+				return m[1]
+			}
+		}
+	}
+	return ""
+}
+
+// Handlers provides per-version handlers for the same logical route, keyed by v<number>,
+// with optional "" key for the versions without the specific handler
+type Handlers map[string]restserver.Handle
+
+// Handle dispatches the request to the handler of the negotiated version
+func (h Handlers) Handle(w http.ResponseWriter, r *http.Request, p restserver.Params) {
+	v := FromContext(r.Context())
+	handle, ok := h[v]
+	if !ok {
+		handle, ok = h[""]
+	}
+	if !ok {
+		marshal.WriteJSON(w, r, httperror.NewFromCtx(r.Context(), http.StatusBadRequest, httperror.CodeUnsupportedVersion,
+			"API version %s is not supported by %s", v, r.URL.Path))
+		return
+	}
+	handle(w, r, p)
+}
@@ -0,0 +1,111 @@
+package apiversion_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/restserver/apiversion"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiator(t *testing.T) {
+	n := apiversion.New([]string{"v1", "2"})
+	assert.True(t, n.IsSupported("1"))
+	assert.True(t, n.IsSupported("V2"))
+	assert.False(t, n.IsSupported("v3"))
+
+	tcases := []struct {
+		path    string
+		headers map[string]string
+		exp     apiversion.Version
+		status  int
+		err     string
+	}{
+		{path: "/items", exp: apiversion.Version{Value: "v1", Source: apiversion.SourceDefault}},
+		{path: "/v2/items", exp: apiversion.Version{Value: "v2", Source: apiversion.SourcePath}},
+		{path: "/v2", exp: apiversion.Version{Value: "v2", Source: apiversion.SourcePath}},
+		{path: "/v2x/items", exp: apiversion.Version{Value: "v1", Source: apiversion.SourceDefault}},
+		{path: "/items", headers: map[string]string{header.XAPIVersion: "2"}, exp: apiversion.Version{Value: "v2", Source: apiversion.SourceHeader}},
+		{path: "/items", headers: map[string]string{header.Accept: "application/json; version=2"}, exp: apiversion.Version{Value: "v2", Source: apiversion.SourceAccept}},
+		{path: "/items", headers: map[string]string{header.Accept: "text/html, application/vnd.example.v2+json"}, exp: apiversion.Version{Value: "v2", Source: apiversion.SourceAccept}},
+		{path: "/v2/items", headers: map[string]string{header.XAPIVersion: "v2"}, exp: apiversion.Version{Value: "v2", Source: apiversion.SourcePath}},
+		{path: "/v2/items", headers: map[string]string{header.XAPIVersion: "v1"}, status: http.StatusBadRequest, err: "unsupported_version: conflicting API version: path v2, header v1"},
+		{path: "/v3/items", status: http.StatusBadRequest, err: "unsupported_version: unsupported API version: v3"},
+		{path: "/items", headers: map[string]string{header.XAPIVersion: "3"}, status: http.StatusBadRequest, err: "unsupported_version: unsupported API version: v3"},
+		{path: "/items", headers: map[string]string{header.Accept: "application/json;version=3"}, status: http.StatusNotAcceptable, err: "unsupported_version: unsupported API version: v3"},
+	}
+	for _, tc := range tcases {
+		t.Run(tc.path, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+			v, err := n.Parse(r)
+			if tc.err != "" {
+				require.NotNil(t, err)
+				assert.Equal(t, tc.status, err.HTTPStatus)
+				assert.Equal(t, tc.err, err.Error())
+				return
+			}
+			require.Nil(t, err)
+			assert.Equal(t, tc.exp, v)
+		})
+	}
+
+	required := apiversion.New([]string{"v1"}, apiversion.WithDefault(""))
+	_, err := required.Parse(httptest.NewRequest(http.MethodGet, "/items", nil))
+	require.NotNil(t, err)
+	assert.Equal(t, "unsupported_version: API version is required", err.Error())
+}
+
+func TestHandler(t *testing.T) {
+	handlers := apiversion.Handlers{
+		"v1": func(w http.ResponseWriter, r *http.Request, _ restserver.Params) {
+			_, _ = w.Write([]byte("v1:" + r.URL.Path))
+		},
+		"v2": func(w http.ResponseWriter, r *http.Request, _ restserver.Params) {
+			assert.Equal(t, apiversion.SourcePath, apiversion.FromRequest(r).Source)
+			_, _ = w.Write([]byte("v2:" + r.URL.Path))
+		},
+	}
+	router := restserver.NewRouter(nil)
+	router.GET("/items", handlers.Handle)
+	router.GET("/legacy", apiversion.Handlers{
+		"v2": handlers["v2"],
+	}.Handle)
+
+	h := apiversion.New([]string{"v1", "v2", "v3"}, apiversion.WithDefault("v1"), apiversion.WithStripPrefix()).
+		Handler(router.Handler())
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := serve("/items")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "v1:/items", w.Body.String())
+	assert.Equal(t, "v1", w.Header().Get(header.XAPIVersion))
+	assert.Equal(t, "Accept, X-API-Version", w.Header().Get(header.Vary))
+
+	w = serve("/v2/items")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "v2:/items", w.Body.String())
+	assert.Equal(t, "v2", w.Header().Get(header.XAPIVersion))
+
+	w = serve("/v4/items")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"unsupported_version"`)
+
+	w = serve("/legacy")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "API version v1 is not supported by /legacy")
+
+	w = serve("/v3/items")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
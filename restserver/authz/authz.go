@@ -35,10 +35,12 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/effective-security/porto/metricskey"
 	"github.com/effective-security/porto/restserver/telemetry"
 	"github.com/effective-security/porto/xhttp/httperror"
 	"github.com/effective-security/porto/xhttp/identity"
 	"github.com/effective-security/porto/xhttp/marshal"
+	"github.com/effective-security/porto/xhttp/urlpath"
 	"github.com/effective-security/x/math"
 	"github.com/effective-security/xlog"
 	"github.com/jinzhu/copier"
@@ -110,6 +112,26 @@ type Config struct {
 	// LogDenied specifies to log denied access
 	LogDenied bool `json:"log_denied" yaml:"log_denied"`
 
+	// CaseInsensitive specifies to match the paths case-insensitively,
+	// it must be set if the router is configured with case-insensitive rewrite
+	CaseInsensitive bool `json:"case_insensitive,omitempty" yaml:"case_insensitive,omitempty"`
+
+	// RejectSuspiciousPaths specifies to reject requests with encoded slashes,
+	// backslashes or dots, double encoding, or dot segments in the path
+	RejectSuspiciousPaths bool `json:"reject_suspicious_paths,omitempty" yaml:"reject_suspicious_paths,omitempty"`
+
+	// DenialHints specifies to include the required roles for the denied path
+	// in the error details, so client developers can self-serve fixes.
+	// It should be disabled for security-sensitive deployments.
+	DenialHints bool `json:"denial_hints,omitempty" yaml:"denial_hints,omitempty"`
+
+	// DocsURL specifies the documentation URL to include in the denial hints
+	DocsURL string `json:"docs_url,omitempty" yaml:"docs_url,omitempty"`
+
+	// Shadow specifies the policy to evaluate in parallel with the active one,
+	// the divergence is logged and metered without affecting responses
+	Shadow *Config `json:"shadow,omitempty" yaml:"shadow,omitempty"`
+
 	// SkipLogPaths if set, specifies a list of paths to not log.
 	// this can be used for /v1/status/node or /metrics
 	SkipLogPaths []telemetry.LoggerSkipPath `json:"logger_skip_paths,omitempty" yaml:"logger_skip_paths,omitempty"`
@@ -125,6 +147,8 @@ type Provider struct {
 	grpcRoleMapper    func(context.Context) identity.Identity
 	pathRoot          *pathNode
 	cfg               *Config
+	shadow            *Provider
+	onDenied          func(ctx context.Context, path string, idn identity.Identity)
 }
 
 type allowTypes int8
@@ -188,6 +212,15 @@ func New(cfg *Config) (*Provider, error) {
 		az.Allow(parts[0], roles...)
 	}
 
+	if cfg.Shadow != nil {
+		shadow, err := New(cfg.Shadow)
+		if err != nil {
+			return nil, errors.WithMessage(err, "invalid shadow policy")
+		}
+		az.shadow = shadow
+		logger.KV(xlog.NOTICE, "shadow", "enabled")
+	}
+
 	return az, nil
 }
 
@@ -292,13 +325,31 @@ func (c *Provider) Clone() *Provider {
 		grpcRoleMapper:    c.grpcRoleMapper,
 		pathRoot:          c.pathRoot.clone(),
 		cfg:               &Config{},
+		onDenied:          c.onDenied,
 	}
 
 	_ = copier.Copy(p.cfg, c.cfg)
+	if c.shadow != nil {
+		p.shadow = c.shadow.Clone()
+	}
 
 	return p
 }
 
+// SetShadow specifies the policy to evaluate in parallel with the active one,
+// the divergence is logged and metered without affecting responses.
+// Use nil to disable the shadow policy.
+func (c *Provider) SetShadow(shadow *Provider) {
+	c.shadow = shadow
+}
+
+// OnDenied specifies the callback for the denied HTTP requests and gRPC calls,
+// for example to report the security events.
+// The decisions of the shadow policy are not reported.
+func (c *Provider) OnDenied(f func(ctx context.Context, path string, idn identity.Identity)) {
+	c.onDenied = f
+}
+
 // SetRoleMapper configures the function that provides the mapping from an HTTP request to a role name
 func (c *Provider) SetRoleMapper(m func(r *http.Request) identity.Identity) {
 	c.requestRoleMapper = m
@@ -335,6 +386,9 @@ func (c *Provider) Allow(path string, roles ...string) {
 	}
 }
 
+// emptyNode is returned by walkPath, when no paths are configured
+var emptyNode = newPathNode("")
+
 // walkPath does the work of converting a URI path into a tree of pathNodes
 // if create is true, all nodes required to create a tree equaling the supplied
 // path will be created if needed.
@@ -347,17 +401,14 @@ func (c *Provider) walkPath(path string, create bool) *pathNode {
 		panic(fmt.Sprintf("Invalid path supplied to walkPath %v", path))
 	}
 	if c.pathRoot == nil {
+		if !create {
+			// no paths configured
+			return emptyNode
+		}
 		c.pathRoot = newPathNode("")
 	}
-	pathLen := len(path)
-	pathPos := 1
 	currentNode := c.pathRoot
-	for pathPos < pathLen {
-		segEnd := pathPos
-		for segEnd < pathLen && path[segEnd] != '/' {
-			segEnd++
-		}
-		pathSegment := path[pathPos:segEnd]
+	for _, pathSegment := range c.segments(path) {
 		childNode := currentNode.children[pathSegment]
 		if childNode == nil && !create {
 			return currentNode
@@ -367,11 +418,20 @@ func (c *Provider) walkPath(path string, create bool) *pathNode {
 			currentNode.children[pathSegment] = childNode
 		}
 		currentNode = childNode
-		pathPos = segEnd + 1
 	}
 	return currentNode
 }
 
+// segments returns the segments of the normalized path,
+// so that /foo//bar, /foo/bar/ and /foo/x/../bar are matched as /foo/bar,
+// the same way as the router normalizes the path
+func (c *Provider) segments(path string) []string {
+	if c.cfg != nil && c.cfg.CaseInsensitive {
+		path = strings.ToLower(path)
+	}
+	return urlpath.Segments(path)
+}
+
 // isAllowed returns true if access to 'path' is allowed for the specified role.
 func (c *Provider) isAllowed(ctx context.Context, path, userAgent string, idn identity.Identity) bool {
 	role := idn.Role()
@@ -411,9 +471,82 @@ func (c *Provider) isAllowed(ctx context.Context, path, userAgent string, idn id
 				"node", node.value)
 		}
 	}
+
+	if c.shadow != nil {
+		c.shadow.compare(ctx, path, userAgent, idn, res)
+	}
 	return res
 }
 
+// compare evaluates the shadow policy, and reports divergence with the active decision
+func (c *Provider) compare(ctx context.Context, path, userAgent string, idn identity.Identity, allowed bool) {
+	shadowAllowed := c.isAllowed(ctx, path, userAgent, idn)
+	if shadowAllowed == allowed {
+		return
+	}
+
+	decision := "would_deny"
+	if shadowAllowed {
+		decision = "would_allow"
+	}
+	node := c.Requirement(path).Node
+	metricskey.AuthzShadowDivergence.IncrCounter(1, decision, node)
+	logger.ContextKV(ctx, xlog.NOTICE,
+		"status", "shadow_divergence",
+		"decision", decision,
+		"path", path,
+		"node", node,
+		"role", idn.Role())
+}
+
+// Requirement describes the effective access rule for a path
+type Requirement struct {
+	// Node is the path of the deepest configured node matching the path
+	Node string `json:"node"`
+	// AllowAny is true, if any authenticated request is allowed
+	AllowAny bool `json:"allow_any,omitempty"`
+	// AllowAnyRole is true, if any request with non empty role is allowed
+	AllowAnyRole bool `json:"allow_any_role,omitempty"`
+	// Roles is the list of allowed roles
+	Roles []string `json:"roles,omitempty"`
+}
+
+// Requirement returns the effective access rule for the path,
+// if no rule is returned then the access is denied for all
+func (c *Provider) Requirement(path string) *Requirement {
+	if len(path) == 0 || path[0] != '/' || c.pathRoot == nil {
+		return &Requirement{Node: "/"}
+	}
+
+	node := c.pathRoot
+	matched := ""
+	for _, seg := range c.segments(path) {
+		child := node.children[seg]
+		if child == nil {
+			break
+		}
+		node = child
+		matched += "/" + seg
+	}
+	if matched == "" {
+		matched = "/"
+	}
+
+	return &Requirement{
+		Node:         matched,
+		AllowAny:     node.allowAny(),
+		AllowAnyRole: (node.allow & allowAnyRole) != 0,
+		Roles:        node.allowedRoleKeys(),
+	}
+}
+
+// IsAllowed returns true if access to the path is allowed for the identity.
+// It can be used by services that dispatch to sub-resources within a single route,
+// where the path represents a virtual path of the sub-resource.
+func (c *Provider) IsAllowed(ctx context.Context, path string, idn identity.Identity) bool {
+	return c.isAllowed(ctx, path, "", idn)
+}
+
 // checkAccess ensures that access to the supplied http.request is allowed
 func (c *Provider) checkAccess(r *http.Request) error {
 	if r.Method == http.MethodOptions {
@@ -424,12 +557,46 @@ func (c *Provider) checkAccess(r *http.Request) error {
 	idn := c.requestRoleMapper(r)
 	ctx := r.Context()
 	if !c.isAllowed(ctx, r.URL.Path, r.UserAgent(), idn) {
-		return httperror.Unauthorized("%s role not allowed", idn.Role()).WithContext(ctx)
+		c.reportDenied(ctx, r.URL.Path, idn)
+		return c.deniedError(ctx, r.URL.Path, idn)
 	}
 
 	return nil
 }
 
+func (c *Provider) reportDenied(ctx context.Context, path string, idn identity.Identity) {
+	if c.onDenied != nil {
+		c.onDenied(ctx, path, idn)
+	}
+}
+
+// DenialDomain is the domain of the error details with denial hints
+const DenialDomain = "authz"
+
+// deniedError returns Unauthorized error,
+// with the denial hints if configured
+func (c *Provider) deniedError(ctx context.Context, path string, idn identity.Identity) *httperror.Error {
+	err := httperror.Unauthorized("%s role not allowed", idn.Role()).WithContext(ctx)
+	if !c.cfg.DenialHints {
+		return err
+	}
+
+	req := c.Requirement(path)
+	md := map[string]string{
+		"node": req.Node,
+	}
+	if len(req.Roles) > 0 {
+		md["required_roles"] = strings.Join(req.Roles, ",")
+	}
+	if req.AllowAnyRole {
+		md["allow_any_role"] = "true"
+	}
+	if c.cfg.DocsURL != "" {
+		md["docs_url"] = c.cfg.DocsURL
+	}
+	return err.WithErrorInfo(DenialDomain, md)
+}
+
 // NewHandler returns a http.Handler that enforces the current authorization configuration
 // The handler has its own copy of the configuration changes to the Provider after calling
 // NewHandler won't affect previously created Handlers.
@@ -457,11 +624,25 @@ type authHandler struct {
 }
 
 func (a *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if a.config.cfg.RejectSuspiciousPaths {
+		if err := urlpath.CheckSuspicious(r.URL.EscapedPath()); err != nil {
+			logger.ContextKV(r.Context(), xlog.WARNING,
+				"status", "rejected",
+				"path", r.URL.EscapedPath(),
+				"reason", err.Error())
+			marshal.WriteJSON(w, r, httperror.InvalidRequest("invalid path: %s", err.Error()).WithContext(r.Context()))
+			return
+		}
+	}
 	err := a.config.checkAccess(r)
 	if err == nil {
 		a.delegate.ServeHTTP(w, r)
 	} else {
-		marshal.WriteJSON(w, r, httperror.Unauthorized("%s", err.Error()))
+		herr := httperror.Unauthorized("%s", err.Error())
+		if e, ok := err.(*httperror.Error); ok {
+			herr.Details = e.Details
+		}
+		marshal.WriteJSON(w, r, herr)
 	}
 }
 
@@ -471,7 +652,8 @@ func (c *Provider) NewUnaryInterceptor() grpc.UnaryServerInterceptor {
 		idn := c.grpcRoleMapper(ctx)
 		userAgent := headerFromContext(ctx, "user-agent")
 		if !c.isAllowed(ctx, info.FullMethod, userAgent, idn) {
-			return nil, httperror.Unauthorized("%s role not allowed", idn.Role()).WithContext(ctx)
+			c.reportDenied(ctx, info.FullMethod, idn)
+			return nil, c.deniedError(ctx, info.FullMethod, idn)
 		}
 
 		return handler(ctx, req)
@@ -11,6 +11,7 @@ import (
 
 	"github.com/effective-security/porto/xhttp/correlation"
 	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/httperror"
 	"github.com/effective-security/porto/xhttp/identity"
 	"github.com/effective-security/xlog"
 	"github.com/pkg/errors"
@@ -193,6 +194,43 @@ func TestConfig_Allow(t *testing.T) {
 	check("/alice", "alice", true)
 }
 
+func TestConfig_PathTricks(t *testing.T) {
+	c, err := New(&Config{
+		AllowAny: []string{"/public"},
+		Allow:    []string{"/public/admin:admin"},
+	})
+	require.NoError(t, err)
+
+	check := func(path, role string, allowed bool) {
+		idn := identity.NewIdentity(role, "test", "", nil, "", "")
+		checkAllowed(t, c, path, idn, allowed)
+	}
+	check("/public", "bob", true)
+	check("/public/", "bob", true)
+	check("/public/admin", "bob", false)
+	check("/public/admin/", "bob", false)
+	check("/public//admin", "bob", false)
+	check("//public///admin//", "bob", false)
+	check("/public//admin", "admin", true)
+	check("/public/x/../admin", "bob", false)
+	check("/public/./admin", "bob", false)
+	check("/x/../public/admin", "bob", false)
+	// case-sensitive by default, the router redirects to the registered path
+	check("/public/ADMIN", "bob", true)
+	assert.Equal(t, "/public/admin", c.Requirement("/public//admin/").Node)
+
+	c, err = New(&Config{
+		AllowAny:        []string{"/public"},
+		Allow:           []string{"/Public/Admin:admin"},
+		CaseInsensitive: true,
+	})
+	require.NoError(t, err)
+	check("/public/ADMIN", "bob", false)
+	check("/PUBLIC/admin", "admin", true)
+	check("/PUBLIC/other", "bob", true)
+	assert.Equal(t, []string{"admin"}, c.Requirement("/PUBLIC/Admin").Roles)
+}
+
 func TestConfig_AllowAny(t *testing.T) {
 	c, err := New(&Config{
 		Allow: []string{
@@ -414,6 +452,32 @@ func TestConfig_Handler(t *testing.T) {
 	testHandler("/alice/more", false)
 	testHandler("/somewhereElse", false)
 	testHandler("/", false)
+	testHandler("/who/%2e%2e/alice", false)
+	testHandler("/who/../alice", false)
+}
+
+func TestConfig_HandlerRejectSuspiciousPaths(t *testing.T) {
+	delegate := http.HandlerFunc(testHTTPHandler)
+	c, err := New(&Config{RejectSuspiciousPaths: true})
+	require.NoError(t, err)
+	c.SetRoleMapper(roleMapper("bob"))
+	c.AllowAny("/who")
+	h, err := c.NewHandler(delegate)
+	require.NoError(t, err)
+
+	for path, code := range map[string]int{
+		"/who/me":            http.StatusOK,
+		"/who/%2e%2e/alice":  http.StatusBadRequest,
+		"/who%2Fme":          http.StatusBadRequest,
+		"/who/../who/me":     http.StatusBadRequest,
+		"/who/me%252e%252e/": http.StatusBadRequest,
+	} {
+		r, err := http.NewRequest(http.MethodGet, path, nil)
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, code, w.Code, path)
+	}
 }
 
 func TestNewUnaryInterceptor(t *testing.T) {
@@ -471,3 +535,131 @@ func childNames(m map[string]*pathNode) []string {
 	sort.Strings(r)
 	return r
 }
+
+func TestConfig_DenialHints(t *testing.T) {
+	delegate := http.HandlerFunc(testHTTPHandler)
+	c, err := New(&Config{
+		Allow:        []string{"/v1/admin:admin,owner"},
+		AllowAnyRole: []string{"/v1/profile"},
+		DenialHints:  true,
+		DocsURL:      "https://docs.example.com/authz",
+	})
+	require.NoError(t, err)
+	c.SetRoleMapper(roleMapper(""))
+	h, err := c.NewHandler(delegate)
+	require.NoError(t, err)
+
+	call := func(path string) string {
+		r, err := http.NewRequest(http.MethodGet, path, nil)
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		return w.Body.String()
+	}
+
+	assert.JSONEq(t, `{"code":"unauthorized","message":"unauthorized:  role not allowed",
+		"details":{"domain":"authz","metadata":{"node":"/v1/admin","required_roles":"admin,owner","docs_url":"https://docs.example.com/authz"}}}`,
+		call("/v1/admin/users"))
+	assert.JSONEq(t, `{"code":"unauthorized","message":"unauthorized:  role not allowed",
+		"details":{"domain":"authz","metadata":{"node":"/v1/profile","allow_any_role":"true","docs_url":"https://docs.example.com/authz"}}}`,
+		call("/v1/profile"))
+
+	unary := c.NewUnaryInterceptor()
+	_, err = unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/v1/admin"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	require.Error(t, err)
+	herr, ok := err.(*httperror.Error)
+	require.True(t, ok)
+	require.NotNil(t, herr.Details)
+	assert.Equal(t, DenialDomain, herr.Details.Domain)
+	assert.Equal(t, "admin,owner", herr.Details.Metadata["required_roles"])
+
+	// disabled by default
+	c, err = New(&Config{Allow: []string{"/v1/admin:admin"}})
+	require.NoError(t, err)
+	c.SetRoleMapper(roleMapper("bob"))
+	h, err = c.NewHandler(delegate)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"code":"unauthorized","message":"unauthorized: bob role not allowed"}`, call("/v1/admin"))
+}
+
+func TestConfig_Shadow(t *testing.T) {
+	c, err := New(&Config{
+		Allow: []string{"/v1/users:admin"},
+		Shadow: &Config{
+			Allow:    []string{"/v1/users:admin,user"},
+			AllowAny: []string{"/v1/status"},
+		},
+	})
+	require.NoError(t, err)
+
+	buf := bytes.NewBuffer([]byte{})
+	xlog.SetFormatter(xlog.NewStringFormatter(buf))
+	defer xlog.SetFormatter(xlog.NewNilFormatter())
+
+	check := func(path, role string, allowed bool, expLog string) {
+		buf.Reset()
+		idn := identity.NewIdentity(role, "test", "", nil, "", "")
+		assert.Equal(t, allowed, c.IsAllowed(ctx, path, idn), path)
+		if expLog == "" {
+			assert.Empty(t, buf.String(), path)
+		} else {
+			assert.Contains(t, buf.String(), expLog, path)
+		}
+	}
+	check("/v1/users", "admin", true, "")
+	check("/v1/users", "user", false, `status="shadow_divergence" decision="would_allow" path="/v1/users" node="/v1/users" role="user"`)
+	check("/v1/status", "user", false, `decision="would_allow" path="/v1/status" node="/v1/status"`)
+	check("/v1/other", "user", false, "")
+
+	// the handler has a copy of the shadow
+	c.SetRoleMapper(roleMapper("user"))
+	h, err := c.NewHandler(http.HandlerFunc(testHTTPHandler))
+	require.NoError(t, err)
+	buf.Reset()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/users", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "shadow must not affect the response")
+	assert.Contains(t, buf.String(), `decision="would_allow"`)
+
+	// shadow denies
+	shadow, err := New(&Config{})
+	require.NoError(t, err)
+	c.SetShadow(shadow)
+	check("/v1/users", "admin", true, `decision="would_deny" path="/v1/users" node="/"`)
+	c.SetShadow(nil)
+	check("/v1/users", "admin", true, "")
+
+	_, err = New(&Config{Shadow: &Config{Allow: []string{"/a"}}})
+	assert.EqualError(t, err, `invalid shadow policy: not valid Authz allow configuration: "/a"`)
+}
+
+func TestConfig_OnDenied(t *testing.T) {
+	c, err := New(&Config{Allow: []string{"/v1/admin:admin"}})
+	require.NoError(t, err)
+
+	var denied []string
+	c.OnDenied(func(_ context.Context, path string, idn identity.Identity) {
+		denied = append(denied, path+"|"+idn.Role())
+	})
+	c.SetRoleMapper(roleMapper("bob"))
+	c.SetGRPCRoleMapper(gRPCRoleMapper("bob"))
+
+	h, err := c.NewHandler(http.HandlerFunc(testHTTPHandler))
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/admin/users", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	unary := c.NewUnaryInterceptor()
+	_, err = unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/v1/admin"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	require.Error(t, err)
+
+	// IsAllowed is not reported
+	assert.False(t, c.IsAllowed(ctx, "/v1/admin", identity.NewIdentity("bob", "", "", nil, "", "")))
+	assert.Equal(t, []string{"/v1/admin/users|bob", "/v1/admin|bob"}, denied)
+}
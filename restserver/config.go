@@ -1,8 +1,10 @@
 package restserver
 
 import (
+	"net/http"
 	"os"
 	"strings"
+	"time"
 )
 
 // TLSInfoConfig contains configuration info for the TLS
@@ -31,6 +33,44 @@ type Config interface {
 	GetServices() []string
 }
 
+// HTTPLimitsConfig is an optional interface of the server configuration,
+// to harden the server against the slow clients and stuck writes
+type HTTPLimitsConfig interface {
+	// GetReadTimeout returns the timeout to read the entire request
+	GetReadTimeout() time.Duration
+	// GetReadHeaderTimeout returns the timeout to read the request headers
+	GetReadHeaderTimeout() time.Duration
+	// GetWriteTimeout returns the timeout to write the response
+	GetWriteTimeout() time.Duration
+	// GetIdleTimeout returns the timeout to wait for the next request on keep-alive connections
+	GetIdleTimeout() time.Duration
+	// GetMaxHeaderBytes returns the maximum size of the request headers
+	GetMaxHeaderBytes() int
+}
+
+// DefaultIdleTimeout is used when HTTPLimitsConfig does not specify the idle timeout
+const DefaultIdleTimeout = time.Hour
+
+// ApplyLimits sets the timeouts and limits to the server,
+// the zero values are not applied
+func ApplyLimits(srv *http.Server, cfg HTTPLimitsConfig) {
+	if d := cfg.GetReadTimeout(); d > 0 {
+		srv.ReadTimeout = d
+	}
+	if d := cfg.GetReadHeaderTimeout(); d > 0 {
+		srv.ReadHeaderTimeout = d
+	}
+	if d := cfg.GetWriteTimeout(); d > 0 {
+		srv.WriteTimeout = d
+	}
+	if d := cfg.GetIdleTimeout(); d > 0 {
+		srv.IdleTimeout = d
+	}
+	if n := cfg.GetMaxHeaderBytes(); n > 0 {
+		srv.MaxHeaderBytes = n
+	}
+}
+
 // GetPort returns the port from HTTP bind address,
 // or standard HTTPS 443 port, if it's not specified in the config
 func GetPort(bindAddr string) string {
@@ -0,0 +1,250 @@
+// Package costlimit provides the limiter that enforces the cost-per-window budgets,
+// where the cost of the request is declared by the handler,
+// for example the number of items requested, or the size of the payload.
+//
+// The budgets are tracked per tenant, subject or client IP in cache.Provider,
+// like Redis, that implements cache.Counter, so the limit is shared by all instances.
+// The quota is reported in X-RateLimit-* headers.
+package costlimit
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/effective-security/porto/metricskey"
+	"github.com/effective-security/porto/pkg/cache"
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/porto/xhttp/marshal"
+	"github.com/effective-security/porto/xhttp/reqctx"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+var logger = xlog.NewPackageLogger("github.com/effective-security/porto/restserver", "costlimit")
+
+// Scopes of the budget
+const (
+	// ScopeTenant tracks the budget per tenant
+	ScopeTenant = "tenant"
+	// ScopeSubject tracks the budget per subject
+	ScopeSubject = "subject"
+	// ScopeIP tracks the budget per client IP
+	ScopeIP = "ip"
+)
+
+const keyPrefix = "costlimit"
+
+// TimeNow is a function that returns the current time
+var TimeNow = time.Now
+
+// CostFunc returns the cost of the request
+type CostFunc func(r *http.Request) (int64, error)
+
+// Config provides configuration of the limiter
+type Config struct {
+	// Name of the budget, the requests with the same name share the budget
+	Name string `json:"name" yaml:"name"`
+	// Limit is the maximum cost per Window
+	Limit int64 `json:"limit" yaml:"limit"`
+	// Window is the duration of the budget window
+	Window time.Duration `json:"window" yaml:"window"`
+	// Scope is one of tenant|subject|ip, default is subject,
+	// the tenant and subject scopes fall back to the client IP for guests
+	Scope string `json:"scope,omitempty" yaml:"scope,omitempty"`
+}
+
+// Quota provides the state of the budget
+type Quota struct {
+	Limit     int64
+	Remaining int64
+	Reset     time.Duration
+}
+
+// SetHeaders sets X-RateLimit-* headers
+func (q *Quota) SetHeaders(h http.Header) {
+	h.Set(header.XRateLimitLimit, strconv.FormatInt(q.Limit, 10))
+	h.Set(header.XRateLimitRemaining, strconv.FormatInt(q.Remaining, 10))
+	h.Set(header.XRateLimitReset, strconv.Itoa(int((q.Reset+time.Second-1)/time.Second)))
+}
+
+// Limiter enforces the cost budgets
+type Limiter struct {
+	cfg     Config
+	counter cache.Counter
+}
+
+// New returns Limiter, the provider must implement cache.Counter
+func New(prov cache.Provider, cfg Config) (*Limiter, error) {
+	counter, ok := prov.(cache.Counter)
+	if !ok {
+		return nil, errors.New("costlimit: provider does not support counters")
+	}
+	if cfg.Name == "" {
+		return nil, errors.New("costlimit: name is required")
+	}
+	if cfg.Limit <= 0 || cfg.Window <= 0 {
+		return nil, errors.New("costlimit: limit and window are required")
+	}
+	switch cfg.Scope {
+	case "":
+		cfg.Scope = ScopeSubject
+	case ScopeTenant, ScopeSubject, ScopeIP:
+	default:
+		return nil, errors.Errorf("costlimit: unsupported scope: %s", cfg.Scope)
+	}
+	return &Limiter{
+		cfg:     cfg,
+		counter: counter,
+	}, nil
+}
+
+// Allow charges the cost to the budget of the key,
+// and returns the quota and false if the budget is exceeded,
+// in which case the cost is not charged
+func (l *Limiter) Allow(ctx context.Context, key string, cost int64) (*Quota, bool, error) {
+	now := TimeNow()
+	start := now.Truncate(l.cfg.Window)
+	q := &Quota{
+		Limit: l.cfg.Limit,
+		Reset: start.Add(l.cfg.Window).Sub(now),
+	}
+
+	k := path.Join(keyPrefix, l.cfg.Name, key, strconv.FormatInt(start.Unix(), 10))
+	used, err := l.counter.IncrBy(ctx, k, cost, l.cfg.Window)
+	if err != nil {
+		return nil, false, err
+	}
+	if used > l.cfg.Limit {
+		// refund the rejected request
+		used, err = l.counter.IncrBy(ctx, k, -cost, l.cfg.Window)
+		if err != nil {
+			return nil, false, err
+		}
+		q.Remaining = max(l.cfg.Limit-used, 0)
+		return q, false, nil
+	}
+	q.Remaining = l.cfg.Limit - used
+	return q, true, nil
+}
+
+// Key returns the budget key of the request, by the configured scope
+func (l *Limiter) Key(r *http.Request) string {
+	ctx := r.Context()
+	idn := reqctx.Identity(ctx)
+	switch {
+	case l.cfg.Scope == ScopeTenant && idn.Tenant() != "":
+		return "tenant/" + idn.Tenant()
+	case l.cfg.Scope == ScopeSubject && idn.Subject() != "":
+		return "subject/" + idn.Subject()
+	}
+	return "ip/" + reqctx.ClientIP(ctx)
+}
+
+// Handler returns the handler that enforces the budget,
+// the cost function is called before the delegate
+func (l *Limiter) Handler(cost CostFunc, delegate http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.check(w, r, cost) {
+			delegate.ServeHTTP(w, r)
+		}
+	})
+}
+
+// Handle returns restserver.Handle that enforces the budget,
+// the cost function is called before the delegate
+func (l *Limiter) Handle(cost CostFunc, delegate restserver.Handle) restserver.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p restserver.Params) {
+		if l.check(w, r, cost) {
+			delegate(w, r, p)
+		}
+	}
+}
+
+// check returns true if the request is allowed,
+// otherwise the error response is written
+func (l *Limiter) check(w http.ResponseWriter, r *http.Request, cost CostFunc) bool {
+	ctx := r.Context()
+	n, err := cost(r)
+	if err != nil {
+		var herr *httperror.Error
+		if !errors.As(err, &herr) {
+			herr = httperror.InvalidRequest("%s", err.Error())
+		}
+		marshal.WriteJSON(w, r, herr)
+		return false
+	}
+	if n <= 0 {
+		return true
+	}
+	if n > l.cfg.Limit {
+		marshal.WriteJSON(w, r, httperror.InvalidRequest("request cost %d exceeds the limit %d", n, l.cfg.Limit))
+		return false
+	}
+
+	key := l.Key(r)
+	q, ok, err := l.Allow(ctx, key, n)
+	if err != nil {
+		// fail open, the limiter must not take down the service
+		logger.ContextKV(ctx, xlog.WARNING,
+			"reason", "allow",
+			"name", l.cfg.Name,
+			"err", err.Error())
+		return true
+	}
+	q.SetHeaders(w.Header())
+	if !ok {
+		logger.ContextKV(ctx, xlog.DEBUG,
+			"reason", "limited",
+			"name", l.cfg.Name,
+			"key", key,
+			"cost", n)
+		metricskey.HTTPCostLimited.IncrCounter(1, l.cfg.Name, l.cfg.Scope)
+		marshal.WriteJSON(w, r, httperror.RateLimitExceeded("cost limit exceeded").
+			WithContext(ctx).
+			WithRetryAfter(q.Reset))
+		return false
+	}
+	return true
+}
+
+// Fixed returns the cost function with the fixed cost
+func Fixed(n int64) CostFunc {
+	return func(*http.Request) (int64, error) {
+		return n, nil
+	}
+}
+
+// ContentLength returns the cost function by the size of the request body,
+// in units of the specified size, rounded up
+func ContentLength(unit int64) CostFunc {
+	if unit <= 0 {
+		unit = 1
+	}
+	return func(r *http.Request) (int64, error) {
+		if r.ContentLength <= 0 {
+			return 1, nil
+		}
+		return (r.ContentLength + unit - 1) / unit, nil
+	}
+}
+
+// QueryParam returns the cost function by the integer value of the query parameter,
+// for example the number of items requested, or def if not specified
+func QueryParam(name string, def int64) CostFunc {
+	return func(r *http.Request) (int64, error) {
+		v := r.URL.Query().Get(name)
+		if v == "" {
+			return def, nil
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return 0, httperror.InvalidParam("invalid %s parameter: %s", name, v)
+		}
+		return n, nil
+	}
+}
@@ -0,0 +1,175 @@
+package costlimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/cache"
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nonCounter struct {
+	cache.Provider
+}
+
+func TestNew(t *testing.T) {
+	prov := cache.NewMemoryProvider("test")
+
+	_, err := New(nonCounter{prov}, Config{Name: "n", Limit: 1, Window: time.Second})
+	assert.EqualError(t, err, "costlimit: provider does not support counters")
+	_, err = New(prov, Config{Limit: 1, Window: time.Second})
+	assert.EqualError(t, err, "costlimit: name is required")
+	_, err = New(prov, Config{Name: "n", Window: time.Second})
+	assert.EqualError(t, err, "costlimit: limit and window are required")
+	_, err = New(prov, Config{Name: "n", Limit: 1, Window: time.Second, Scope: "org"})
+	assert.EqualError(t, err, "costlimit: unsupported scope: org")
+
+	l, err := New(prov, Config{Name: "n", Limit: 1, Window: time.Second})
+	require.NoError(t, err)
+	assert.Equal(t, ScopeSubject, l.cfg.Scope)
+}
+
+func TestAllow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 10, 0, time.UTC)
+	TimeNow = func() time.Time { return now }
+	defer func() { TimeNow = time.Now }()
+
+	l, err := New(cache.NewMemoryProvider("test"), Config{Name: "batch", Limit: 100, Window: time.Minute})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	q, ok, err := l.Allow(ctx, "k1", 60)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, &Quota{Limit: 100, Remaining: 40, Reset: 50 * time.Second}, q)
+
+	q, ok, err = l.Allow(ctx, "k1", 50)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, int64(40), q.Remaining)
+
+	// the rejected cost is not charged
+	q, ok, err = l.Allow(ctx, "k1", 40)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(0), q.Remaining)
+
+	// other key
+	_, ok, err = l.Allow(ctx, "k2", 100)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// next window
+	now = now.Add(time.Minute)
+	q, ok, err = l.Allow(ctx, "k1", 10)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(90), q.Remaining)
+}
+
+func TestKey(t *testing.T) {
+	prov := cache.NewMemoryProvider("test")
+	idn := identity.NewIdentity("user", "alice", "acme", nil, "", "")
+
+	tcs := []struct {
+		scope    string
+		identity bool
+		exp      string
+	}{
+		{ScopeTenant, true, "tenant/acme"},
+		{ScopeSubject, true, "subject/alice"},
+		{ScopeIP, true, "ip/"},
+		{ScopeSubject, false, "ip/"},
+	}
+	for _, tc := range tcs {
+		l, err := New(prov, Config{Name: "n", Limit: 1, Window: time.Second, Scope: tc.scope})
+		require.NoError(t, err)
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.identity {
+			r = identity.WithTestIdentity(r, idn)
+		}
+		assert.True(t, strings.HasPrefix(l.Key(r), tc.exp), "%s: %s", tc.scope, l.Key(r))
+	}
+}
+
+func TestHandler(t *testing.T) {
+	l, err := New(cache.NewMemoryProvider("test"), Config{Name: "items", Limit: 100, Window: time.Hour})
+	require.NoError(t, err)
+
+	calls := 0
+	h := l.Handler(QueryParam("limit", 10), http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w
+	}
+
+	w := serve("/v1/items?limit=80")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "100", w.Header().Get(header.XRateLimitLimit))
+	assert.Equal(t, "20", w.Header().Get(header.XRateLimitRemaining))
+	assert.NotEmpty(t, w.Header().Get(header.XRateLimitReset))
+
+	w = serve("/v1/items")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "10", w.Header().Get(header.XRateLimitRemaining))
+
+	w = serve("/v1/items?limit=20")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "10", w.Header().Get(header.XRateLimitRemaining))
+	assert.NotEmpty(t, w.Header().Get(header.RetryAfter))
+
+	w = serve("/v1/items?limit=200")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "request cost 200 exceeds the limit 100")
+
+	w = serve("/v1/items?limit=abc")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid limit parameter: abc")
+
+	w = serve("/v1/items?limit=0")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 3, calls)
+}
+
+func TestHandle(t *testing.T) {
+	l, err := New(cache.NewMemoryProvider("test"), Config{Name: "upload", Limit: 2, Window: time.Hour})
+	require.NoError(t, err)
+
+	h := l.Handle(ContentLength(1024), func(w http.ResponseWriter, _ *http.Request, _ restserver.Params) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/upload", strings.NewReader(strings.Repeat("x", 1500)))
+	w := httptest.NewRecorder()
+	h(w, r, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "0", w.Header().Get(header.XRateLimitRemaining))
+
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPost, "/v1/upload", nil), nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+}
+
+func TestCostFuncs(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	n, err := Fixed(5)(r)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+
+	n, err = ContentLength(0)(r)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
@@ -0,0 +1,103 @@
+// Package deprecation provides the handler that marks deprecated endpoints
+// with Deprecation, Sunset and Link headers (RFC 9745, RFC 8594),
+// and counts the calls by the client role to drive API migrations.
+package deprecation
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/effective-security/porto/metricskey"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/identity"
+	"github.com/effective-security/porto/xhttp/urlpath"
+)
+
+// Endpoint describes the deprecated endpoint
+type Endpoint struct {
+	// Path of the endpoint, or prefix ending with /*
+	Path string `json:"path" yaml:"path"`
+	// Methods of the endpoint, if empty then all methods
+	Methods []string `json:"methods,omitempty" yaml:"methods,omitempty"`
+	// Deprecation is the date when the endpoint was deprecated,
+	// if not specified, then Deprecation header is set to true
+	Deprecation time.Time `json:"deprecation,omitempty" yaml:"deprecation,omitempty"`
+	// Sunset is the date when the endpoint becomes unavailable
+	Sunset time.Time `json:"sunset,omitempty" yaml:"sunset,omitempty"`
+	// Link is URL of the migration documentation
+	Link string `json:"link,omitempty" yaml:"link,omitempty"`
+}
+
+// Match returns true if the endpoint matches the method and path
+func (e *Endpoint) Match(method, path string) bool {
+	if len(e.Methods) > 0 {
+		found := false
+		for _, m := range e.Methods {
+			if strings.EqualFold(m, method) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if prefix, ok := strings.CutSuffix(e.Path, "/*"); ok {
+		return path == prefix || strings.HasPrefix(path, prefix+"/")
+	}
+	return path == e.Path
+}
+
+// SetHeaders sets the deprecation headers
+func (e *Endpoint) SetHeaders(h http.Header) {
+	if e.Deprecation.IsZero() {
+		h.Set(header.Deprecation, "true")
+	} else {
+		h.Set(header.Deprecation, "@"+strconv.FormatInt(e.Deprecation.Unix(), 10))
+	}
+	if !e.Sunset.IsZero() {
+		h.Set(header.Sunset, e.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if e.Link != "" {
+		h.Add(header.Link, "<"+e.Link+`>; rel="deprecation"; type="text/html"`)
+		if !e.Sunset.IsZero() {
+			h.Add(header.Link, "<"+e.Link+`>; rel="sunset"; type="text/html"`)
+		}
+	}
+}
+
+// Handler is a http.Handler that sets the deprecation headers
+// on responses of the deprecated endpoints
+type Handler struct {
+	endpoints []*Endpoint
+	delegate  http.Handler
+}
+
+// NewHandler returns the handler for the deprecated endpoints
+func NewHandler(endpoints []*Endpoint, delegate http.Handler) *Handler {
+	return &Handler{
+		endpoints: endpoints,
+		delegate:  delegate,
+	}
+}
+
+// ServeHTTP implements the http.Handler interface
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := urlpath.Clean(r.URL.Path)
+	for _, e := range h.endpoints {
+		if e.Match(r.Method, path) {
+			e.SetHeaders(w.Header())
+			role := identity.FromRequest(r).Identity().Role()
+			metricskey.HTTPDeprecatedCalls.IncrCounter(1, r.Method, e.Path, role)
+			break
+		}
+	}
+	h.delegate.ServeHTTP(w, r)
+}
+
+// Deprecated returns the handler for a single deprecated route
+func Deprecated(e *Endpoint, delegate http.Handler) http.Handler {
+	return NewHandler([]*Endpoint{e}, delegate)
+}
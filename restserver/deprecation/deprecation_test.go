@@ -0,0 +1,71 @@
+package deprecation_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/restserver/deprecation"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	e := &deprecation.Endpoint{Path: "/v1/items/*", Methods: []string{"get"}}
+	assert.True(t, e.Match(http.MethodGet, "/v1/items"))
+	assert.True(t, e.Match(http.MethodGet, "/v1/items/1"))
+	assert.False(t, e.Match(http.MethodGet, "/v1/itemsx"))
+	assert.False(t, e.Match(http.MethodPost, "/v1/items/1"))
+
+	e = &deprecation.Endpoint{Path: "/v1/status"}
+	assert.True(t, e.Match(http.MethodPost, "/v1/status"))
+	assert.False(t, e.Match(http.MethodGet, "/v1/status/node"))
+}
+
+func TestHandler(t *testing.T) {
+	deprecated := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)
+	h := deprecation.NewHandler([]*deprecation.Endpoint{
+		{
+			Path:        "/v1/items/*",
+			Deprecation: deprecated,
+			Sunset:      sunset,
+			Link:        "https://docs/migrate-v2",
+		},
+		{
+			Path:    "/v1/status",
+			Methods: []string{http.MethodGet},
+		},
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(method, path string) http.Header {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		return w.Header()
+	}
+
+	hdr := serve(http.MethodGet, "/v1/items//1")
+	assert.Equal(t, "@1704067200", hdr.Get(header.Deprecation))
+	assert.Equal(t, "Mon, 30 Jun 2025 00:00:00 GMT", hdr.Get(header.Sunset))
+	assert.Equal(t, []string{
+		`<https://docs/migrate-v2>; rel="deprecation"; type="text/html"`,
+		`<https://docs/migrate-v2>; rel="sunset"; type="text/html"`,
+	}, hdr.Values(header.Link))
+
+	hdr = serve(http.MethodGet, "/v1/status")
+	assert.Equal(t, "true", hdr.Get(header.Deprecation))
+	assert.Empty(t, hdr.Get(header.Sunset))
+	assert.Empty(t, hdr.Get(header.Link))
+
+	hdr = serve(http.MethodPost, "/v1/status")
+	assert.Empty(t, hdr.Get(header.Deprecation))
+
+	w := httptest.NewRecorder()
+	deprecation.Deprecated(&deprecation.Endpoint{Path: "/*"}, http.NotFoundHandler()).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/any", nil))
+	assert.Equal(t, "true", w.Header().Get(header.Deprecation))
+}
@@ -0,0 +1,353 @@
+// Package fairqueue provides the scheduling middleware, that limits
+// the number of concurrently served requests, and when the server is at its limit,
+// dequeues the pending requests with weighted fair queuing across the tenants,
+// so a noisy tenant can not starve the others.
+//
+// Each tenant has a virtual finish time, that advances by 1/weight
+// for each queued request, and the request with the smallest finish time
+// is served next, so the tenants get the share of the capacity
+// proportional to their weights.
+package fairqueue
+
+import (
+	"container/heap"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/effective-security/porto/metricskey"
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/porto/xhttp/marshal"
+	"github.com/effective-security/porto/xhttp/reqctx"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+var logger = xlog.NewPackageLogger("github.com/effective-security/porto/restserver", "fairqueue")
+
+const (
+	// DefaultMaxQueue is the default number of pending requests per tenant
+	DefaultMaxQueue = 100
+	// DefaultMaxWait is the default time the request can wait in the queue
+	DefaultMaxWait = 5 * time.Second
+	// DefaultWeight is the default weight of the tenant
+	DefaultWeight = 1
+)
+
+// Scopes of the queues
+const (
+	// ScopeTenant queues the requests per tenant
+	ScopeTenant = "tenant"
+	// ScopeSubject queues the requests per subject
+	ScopeSubject = "subject"
+)
+
+// Rejection reasons reported in metrics
+const (
+	reasonQueueFull = "queue_full"
+	reasonTimeout   = "timeout"
+	reasonCancelled = "cancelled"
+)
+
+// Config provides configuration of the fair queue
+type Config struct {
+	// MaxConcurrent is the number of requests served concurrently
+	MaxConcurrent int `json:"max_concurrent" yaml:"max_concurrent"`
+	// MaxQueue is the number of pending requests per tenant,
+	// default is DefaultMaxQueue
+	MaxQueue int `json:"max_queue,omitempty" yaml:"max_queue,omitempty"`
+	// MaxWait is the time the request can wait in the queue,
+	// default is DefaultMaxWait
+	MaxWait time.Duration `json:"max_wait,omitempty" yaml:"max_wait,omitempty"`
+	// Scope is one of tenant|subject, default is tenant,
+	// the requests of guests are queued by the client IP
+	Scope string `json:"scope,omitempty" yaml:"scope,omitempty"`
+	// Weights specifies the weights of the tenants
+	Weights map[string]int `json:"weights,omitempty" yaml:"weights,omitempty"`
+	// DefaultWeight is the weight of the tenants not listed in Weights,
+	// default is DefaultWeight
+	DefaultWeight int `json:"default_weight,omitempty" yaml:"default_weight,omitempty"`
+}
+
+// Stats provides the state of the queue
+type Stats struct {
+	// InFlight is the number of requests being served
+	InFlight int
+	// Pending is the number of queued requests per tenant
+	Pending map[string]int
+}
+
+// Queue schedules the requests with weighted fair queuing
+type Queue struct {
+	cfg Config
+
+	lock        sync.Mutex
+	inFlight    int
+	virtualTime float64
+	seq         uint64
+	flows       map[string]*flow
+	pending     waitHeap
+}
+
+type flow struct {
+	key        string
+	weight     int
+	lastFinish float64
+	pending    int
+}
+
+type waiter struct {
+	flow   *flow
+	finish float64
+	seq    uint64
+	index  int
+	ready  chan struct{}
+}
+
+// New returns Queue
+func New(cfg Config) (*Queue, error) {
+	if cfg.MaxConcurrent <= 0 {
+		return nil, errors.New("fairqueue: max concurrent is required")
+	}
+	if cfg.MaxQueue <= 0 {
+		cfg.MaxQueue = DefaultMaxQueue
+	}
+	if cfg.MaxWait <= 0 {
+		cfg.MaxWait = DefaultMaxWait
+	}
+	if cfg.DefaultWeight <= 0 {
+		cfg.DefaultWeight = DefaultWeight
+	}
+	switch cfg.Scope {
+	case "":
+		cfg.Scope = ScopeTenant
+	case ScopeTenant, ScopeSubject:
+	default:
+		return nil, errors.Errorf("fairqueue: unsupported scope: %s", cfg.Scope)
+	}
+	for tenant, w := range cfg.Weights {
+		if w <= 0 {
+			return nil, errors.Errorf("fairqueue: invalid weight of %s: %d", tenant, w)
+		}
+	}
+	return &Queue{
+		cfg:   cfg,
+		flows: make(map[string]*flow),
+	}, nil
+}
+
+// Key returns the queue key of the request, by the configured scope
+func (q *Queue) Key(r *http.Request) string {
+	ctx := r.Context()
+	idn := reqctx.Identity(ctx)
+	switch {
+	case q.cfg.Scope == ScopeTenant && idn.Tenant() != "":
+		return idn.Tenant()
+	case q.cfg.Scope == ScopeSubject && idn.Subject() != "":
+		return idn.Subject()
+	}
+	return "ip/" + reqctx.ClientIP(ctx)
+}
+
+func (q *Queue) weight(key string) int {
+	if w, ok := q.cfg.Weights[key]; ok {
+		return w
+	}
+	return q.cfg.DefaultWeight
+}
+
+// Acquire waits for the slot to serve the request of the tenant,
+// and returns the release function.
+// The error is returned when the tenant's queue is full,
+// the request waited longer than MaxWait, or the context is cancelled.
+func (q *Queue) Acquire(ctx context.Context, key string) (func(), error) {
+	q.lock.Lock()
+	if q.inFlight < q.cfg.MaxConcurrent && q.pending.Len() == 0 {
+		q.inFlight++
+		q.lock.Unlock()
+		return q.release, nil
+	}
+
+	f := q.flows[key]
+	if f == nil {
+		f = &flow{key: key, weight: q.weight(key)}
+		q.flows[key] = f
+	}
+	if f.pending >= q.cfg.MaxQueue {
+		q.lock.Unlock()
+		metricskey.HTTPFairQueueRejected.IncrCounter(1, key, reasonQueueFull)
+		return nil, httperror.RateLimitExceeded("too many pending requests").
+			WithContext(ctx).
+			WithRetryAfter(q.cfg.MaxWait)
+	}
+
+	// the finish time of the idle flow starts at the current virtual time
+	start := max(q.virtualTime, f.lastFinish)
+	f.lastFinish = start + 1/float64(f.weight)
+	f.pending++
+	q.seq++
+	w := &waiter{
+		flow:   f,
+		finish: f.lastFinish,
+		seq:    q.seq,
+		ready:  make(chan struct{}),
+	}
+	heap.Push(&q.pending, w)
+	metricskey.HTTPFairQueueDepth.SetGauge(float64(f.pending), key)
+	q.lock.Unlock()
+
+	started := time.Now()
+	timer := time.NewTimer(q.cfg.MaxWait)
+	defer timer.Stop()
+
+	var reason string
+	select {
+	case <-w.ready:
+		metricskey.HTTPFairQueueWait.AddSample(float64(time.Since(started).Milliseconds()), key)
+		return q.release, nil
+	case <-timer.C:
+		reason = reasonTimeout
+	case <-ctx.Done():
+		reason = reasonCancelled
+	}
+
+	q.lock.Lock()
+	if w.index < 0 {
+		// the slot was granted concurrently
+		q.lock.Unlock()
+		metricskey.HTTPFairQueueWait.AddSample(float64(time.Since(started).Milliseconds()), key)
+		return q.release, nil
+	}
+	heap.Remove(&q.pending, w.index)
+	q.dequeued(w)
+	q.lock.Unlock()
+
+	metricskey.HTTPFairQueueRejected.IncrCounter(1, key, reason)
+	logger.ContextKV(ctx, xlog.DEBUG,
+		"reason", reason,
+		"tenant", key,
+		"waited", time.Since(started).String())
+
+	if reason == reasonCancelled {
+		return nil, errors.WithStack(ctx.Err())
+	}
+	return nil, httperror.NotReady("the request waited too long in the queue").
+		WithContext(ctx).
+		WithRetryAfter(q.cfg.MaxWait)
+}
+
+// release frees the slot, and serves the next pending request
+func (q *Queue) release() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.pending.Len() == 0 {
+		q.inFlight--
+		return
+	}
+	// the slot is passed to the next request
+	w := heap.Pop(&q.pending).(*waiter)
+	q.virtualTime = w.finish
+	q.dequeued(w)
+	close(w.ready)
+}
+
+// dequeued updates the flow of the removed waiter,
+// must be called under the lock
+func (q *Queue) dequeued(w *waiter) {
+	f := w.flow
+	f.pending--
+	metricskey.HTTPFairQueueDepth.SetGauge(float64(f.pending), f.key)
+	if f.pending == 0 {
+		// the idle flow restarts at the current virtual time
+		delete(q.flows, f.key)
+	}
+}
+
+// Stats returns the state of the queue
+func (q *Queue) Stats() Stats {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	s := Stats{
+		InFlight: q.inFlight,
+		Pending:  make(map[string]int, len(q.flows)),
+	}
+	for k, f := range q.flows {
+		if f.pending > 0 {
+			s.Pending[k] = f.pending
+		}
+	}
+	return s
+}
+
+// Handler returns the handler that schedules the requests to the delegate
+func (q *Queue) Handler(delegate http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release, err := q.Acquire(r.Context(), q.Key(r))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		defer release()
+		delegate.ServeHTTP(w, r)
+	})
+}
+
+// Handle returns restserver.Handle that schedules the requests to the delegate
+func (q *Queue) Handle(delegate restserver.Handle) restserver.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p restserver.Params) {
+		release, err := q.Acquire(r.Context(), q.Key(r))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		defer release()
+		delegate(w, r, p)
+	}
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var herr *httperror.Error
+	if !errors.As(err, &herr) {
+		// the client has gone away
+		return
+	}
+	marshal.WriteJSON(w, r, herr)
+}
+
+// waitHeap is the min-heap of the waiters by the finish time
+type waitHeap []*waiter
+
+func (h waitHeap) Len() int { return len(h) }
+
+func (h waitHeap) Less(i, j int) bool {
+	if h[i].finish != h[j].finish {
+		return h[i].finish < h[j].finish
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h waitHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *waitHeap) Push(x any) {
+	w := x.(*waiter)
+	w.index = len(*h)
+	*h = append(*h, w)
+}
+
+func (h *waitHeap) Pop() any {
+	old := *h
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	w.index = -1
+	*h = old[:n-1]
+	return w
+}
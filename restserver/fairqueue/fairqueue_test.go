@@ -0,0 +1,144 @@
+package fairqueue
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New(Config{})
+	assert.EqualError(t, err, "fairqueue: max concurrent is required")
+	_, err = New(Config{MaxConcurrent: 1, Scope: "ip"})
+	assert.EqualError(t, err, "fairqueue: unsupported scope: ip")
+	_, err = New(Config{MaxConcurrent: 1, Weights: map[string]int{"t1": 0}})
+	assert.EqualError(t, err, "fairqueue: invalid weight of t1: 0")
+
+	q, err := New(Config{MaxConcurrent: 1, Weights: map[string]int{"t1": 3}})
+	require.NoError(t, err)
+	assert.Equal(t, ScopeTenant, q.cfg.Scope)
+	assert.Equal(t, DefaultMaxQueue, q.cfg.MaxQueue)
+	assert.Equal(t, DefaultMaxWait, q.cfg.MaxWait)
+	assert.Equal(t, 3, q.weight("t1"))
+	assert.Equal(t, DefaultWeight, q.weight("t2"))
+}
+
+func waitPending(t *testing.T, q *Queue, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		total := 0
+		for _, p := range q.Stats().Pending {
+			total += p
+		}
+		return total == n
+	}, time.Second, time.Millisecond)
+}
+
+func TestWeightedFairOrder(t *testing.T) {
+	q, err := New(Config{MaxConcurrent: 1, Weights: map[string]int{"a": 2}})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	release, err := q.Acquire(ctx, "holder")
+	require.NoError(t, err)
+	assert.Equal(t, 1, q.Stats().InFlight)
+
+	var lock sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	for i, key := range []string{"a", "b", "a", "b", "a", "a"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rel, err := q.Acquire(ctx, key)
+			if !assert.NoError(t, err) {
+				return
+			}
+			lock.Lock()
+			order = append(order, key)
+			lock.Unlock()
+			rel()
+		}()
+		waitPending(t, q, i+1)
+	}
+	assert.Equal(t, map[string]int{"a": 4, "b": 2}, q.Stats().Pending)
+
+	release()
+	wg.Wait()
+
+	// tenant a has twice the share of tenant b
+	assert.Equal(t, []string{"a", "b", "a", "a", "b", "a"}, order)
+	assert.Equal(t, Stats{Pending: map[string]int{}}, q.Stats())
+}
+
+func TestRejected(t *testing.T) {
+	q, err := New(Config{MaxConcurrent: 1, MaxQueue: 1, MaxWait: 20 * time.Millisecond})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	release, err := q.Acquire(ctx, "holder")
+	require.NoError(t, err)
+	defer release()
+
+	done := make(chan error)
+	go func() {
+		_, err := q.Acquire(ctx, "t1")
+		done <- err
+	}()
+	waitPending(t, q, 1)
+
+	// queue full
+	_, err = q.Acquire(ctx, "t1")
+	var herr *httperror.Error
+	require.True(t, errors.As(err, &herr))
+	assert.Equal(t, http.StatusTooManyRequests, herr.HTTPStatus)
+
+	// timeout
+	err = <-done
+	require.True(t, errors.As(err, &herr))
+	assert.Equal(t, http.StatusServiceUnavailable, herr.HTTPStatus)
+	assert.Empty(t, q.Stats().Pending)
+
+	// cancelled
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = q.Acquire(cctx, "t2")
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, 1, q.Stats().InFlight)
+}
+
+func TestHandler(t *testing.T) {
+	q, err := New(Config{MaxConcurrent: 1, MaxWait: 20 * time.Millisecond})
+	require.NoError(t, err)
+
+	h := q.Handler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/items", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	release, err := q.Acquire(context.Background(), "holder")
+	require.NoError(t, err)
+	handle := q.Handle(func(w http.ResponseWriter, _ *http.Request, _ restserver.Params) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	w = httptest.NewRecorder()
+	handle(w, httptest.NewRequest(http.MethodGet, "/v1/items", nil), nil)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	release()
+	w = httptest.NewRecorder()
+	handle(w, httptest.NewRequest(http.MethodGet, "/v1/items", nil), nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
@@ -0,0 +1,303 @@
+// Package grpcbridge provides restserver.Service, that exposes a generic
+// JSON bridge to invoke unary gRPC methods of the services,
+// discovered with gRPC server reflection.
+//
+// POST {path}/{service}/{method} accepts the request message in protojson format,
+// and returns the response message in protojson format.
+// The bridge is intended for the internal tooling, debugging and scripting,
+// so the access is restricted to the configured roles per method.
+package grpcbridge
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/restserver/authz"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/porto/xhttp/marshal"
+	"github.com/effective-security/porto/xhttp/reqctx"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var logger = xlog.NewPackageLogger("github.com/effective-security/porto/restserver", "grpcbridge")
+
+// ServiceName provides the default service name
+const ServiceName = "grpcbridge"
+
+const (
+	// DefaultPath is the default base path of the endpoint
+	DefaultPath = "/v1/invoke"
+	// DefaultMaxRequestSize is the default limit of the request body size
+	DefaultMaxRequestSize = 1024 * 1024
+)
+
+// Config provides configuration of the service
+type Config struct {
+	// Path is the base path of the endpoint, default is DefaultPath
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// Roles specifies the roles allowed to invoke any method,
+	// if not specified in MethodRoles
+	Roles []string `json:"roles,omitempty" yaml:"roles,omitempty"`
+	// MethodRoles specifies the roles allowed to invoke the method,
+	// the key is "package.Service/Method", or "package.Service/*"
+	MethodRoles map[string][]string `json:"method_roles,omitempty" yaml:"method_roles,omitempty"`
+	// MaxRequestSize specifies the limit of the request body size,
+	// default is DefaultMaxRequestSize
+	MaxRequestSize int64 `json:"max_request_size,omitempty" yaml:"max_request_size,omitempty"`
+}
+
+// rolesFor returns the roles allowed to invoke the method
+func (c *Config) rolesFor(service, method string) []string {
+	if roles, ok := c.MethodRoles[service+"/"+method]; ok {
+		return roles
+	}
+	if roles, ok := c.MethodRoles[service+"/*"]; ok {
+		return roles
+	}
+	return c.Roles
+}
+
+// Service provides restserver.Service to invoke gRPC methods
+type Service struct {
+	cfg  Config
+	conn grpc.ClientConnInterface
+
+	lock     sync.RWMutex
+	services map[string]protoreflect.ServiceDescriptor
+}
+
+// NewService returns Service, the connection must be to the server
+// with the reflection service registered.
+// If the authz provider is specified, then the configured roles are allowed for the path.
+func NewService(conn grpc.ClientConnInterface, az *authz.Provider, cfg Config) (*Service, error) {
+	if conn == nil {
+		return nil, errors.New("grpcbridge: connection is required")
+	}
+	if len(cfg.Roles) == 0 && len(cfg.MethodRoles) == 0 {
+		return nil, errors.New("grpcbridge: roles are required")
+	}
+	if cfg.Path == "" {
+		cfg.Path = DefaultPath
+	}
+	if cfg.MaxRequestSize <= 0 {
+		cfg.MaxRequestSize = DefaultMaxRequestSize
+	}
+	if az != nil {
+		roles := slices.Clone(cfg.Roles)
+		for _, r := range cfg.MethodRoles {
+			roles = append(roles, r...)
+		}
+		slices.Sort(roles)
+		az.Allow(cfg.Path, slices.Compact(roles)...)
+	}
+	return &Service{
+		cfg:      cfg,
+		conn:     conn,
+		services: make(map[string]protoreflect.ServiceDescriptor),
+	}, nil
+}
+
+// Name returns the service name
+func (s *Service) Name() string {
+	return ServiceName
+}
+
+// IsReady indicates that the service is ready to serve its end-points
+func (s *Service) IsReady() bool {
+	return true
+}
+
+// Close the subservices and it's resources
+func (s *Service) Close() {
+}
+
+// Register adds the endpoints to the router
+func (s *Service) Register(r restserver.Router) {
+	r.POST(s.cfg.Path+"/:service/:method", s.invoke)
+}
+
+func (s *Service) invoke(w http.ResponseWriter, r *http.Request, p restserver.Params) {
+	ctx := r.Context()
+	service := p.ByName("service")
+	method := p.ByName("method")
+
+	// checked in addition to authz, as the endpoint
+	// must not be exposed if the authz is not configured for the path
+	role := reqctx.Identity(ctx).Role()
+	if !slices.Contains(s.cfg.rolesFor(service, method), role) {
+		marshal.WriteJSON(w, r, httperror.Forbidden("%q role is not allowed to invoke %s/%s", role, service, method))
+		return
+	}
+
+	sd, err := s.serviceDescriptor(ctx, service)
+	if err != nil {
+		marshal.WriteJSON(w, r, err)
+		return
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		marshal.WriteJSON(w, r, httperror.NotFound("method not found: %s/%s", service, method))
+		return
+	}
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		marshal.WriteJSON(w, r, httperror.InvalidRequest("streaming method is not supported: %s/%s", service, method))
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.cfg.MaxRequestSize))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			marshal.WriteJSON(w, r, httperror.RequestTooLarge("request exceeds %d bytes", s.cfg.MaxRequestSize))
+			return
+		}
+		marshal.WriteJSON(w, r, httperror.InvalidRequest("unable to read request: %s", err.Error()))
+		return
+	}
+
+	req := dynamicpb.NewMessage(md.Input())
+	if len(body) > 0 {
+		if err = protojson.Unmarshal(body, req); err != nil {
+			marshal.WriteJSON(w, r, httperror.InvalidJSON("invalid %s: %s", md.Input().FullName(), err.Error()))
+			return
+		}
+	}
+
+	// propagate the caller's credentials,
+	// so the gRPC server applies its own authorization
+	if auth := r.Header.Get(header.Authorization); auth != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", auth)
+	}
+
+	fullMethod := "/" + service + "/" + method
+	res := dynamicpb.NewMessage(md.Output())
+	if err = s.conn.Invoke(ctx, fullMethod, req, res); err != nil {
+		logger.ContextKV(ctx, xlog.DEBUG, "method", fullMethod, "err", err.Error())
+		marshal.WriteJSON(w, r, httperror.NewFromPb(err))
+		return
+	}
+
+	js, err := protojson.Marshal(res)
+	if err != nil {
+		marshal.WriteJSON(w, r, httperror.Unexpected("unable to encode response: %s", err.Error()))
+		return
+	}
+	w.Header().Set(header.ContentType, header.ApplicationJSON)
+	_, _ = w.Write(js)
+}
+
+// serviceDescriptor returns the descriptor of the service,
+// resolved with the server reflection
+func (s *Service) serviceDescriptor(ctx context.Context, service string) (protoreflect.ServiceDescriptor, error) {
+	s.lock.RLock()
+	sd, ok := s.services[service]
+	s.lock.RUnlock()
+	if ok {
+		return sd, nil
+	}
+
+	files, err := s.resolveFiles(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, httperror.NotFound("service not found: %s", service)
+	}
+	sd, ok = d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, httperror.NotFound("service not found: %s", service)
+	}
+
+	s.lock.Lock()
+	s.services[service] = sd
+	s.lock.Unlock()
+	return sd, nil
+}
+
+// resolveFiles returns the files, that define the symbol and its dependencies
+func (s *Service) resolveFiles(ctx context.Context, symbol string) (*protoregistry.Files, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := reflectionpb.NewServerReflectionClient(s.conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, httperror.NewFromPb(err)
+	}
+	err = stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{
+			FileContainingSymbol: symbol,
+		},
+	})
+	if err != nil {
+		return nil, httperror.NewFromPb(err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		return nil, httperror.NewFromPb(err)
+	}
+	_ = stream.CloseSend()
+
+	if e := resp.GetErrorResponse(); e != nil {
+		return nil, httperror.NotFound("service not found: %s: %s", symbol, e.GetErrorMessage())
+	}
+
+	protos := map[string]*descriptorpb.FileDescriptorProto{}
+	for _, b := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+		fd := new(descriptorpb.FileDescriptorProto)
+		if err = proto.Unmarshal(b, fd); err != nil {
+			return nil, httperror.Unexpected("invalid file descriptor: %s", err.Error())
+		}
+		protos[fd.GetName()] = fd
+	}
+
+	files := new(protoregistry.Files)
+	for name := range protos {
+		if err = registerFile(files, protos, name); err != nil {
+			return nil, httperror.Unexpected("unable to resolve %s: %s", symbol, err.Error())
+		}
+	}
+	return files, nil
+}
+
+// registerFile registers the file after its dependencies,
+// the dependencies not returned by the server are resolved from the global registry
+func registerFile(files *protoregistry.Files, protos map[string]*descriptorpb.FileDescriptorProto, name string) error {
+	if _, err := files.FindFileByPath(name); err == nil {
+		return nil
+	}
+	fd, ok := protos[name]
+	if !ok {
+		gfd, err := protoregistry.GlobalFiles.FindFileByPath(name)
+		if err != nil {
+			return errors.Errorf("dependency not found: %s", name)
+		}
+		return files.RegisterFile(gfd)
+	}
+	for _, dep := range fd.GetDependency() {
+		if err := registerFile(files, protos, dep); err != nil {
+			return err
+		}
+	}
+	d, err := protodesc.NewFile(fd, files)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return files.RegisterFile(d)
+}
@@ -0,0 +1,157 @@
+package grpcbridge_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/restserver/authz"
+	"github.com/effective-security/porto/restserver/grpcbridge"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func dial(t *testing.T) *grpc.ClientConn {
+	lis := bufconn.Listen(1024 * 1024)
+	hs := health.NewServer()
+	hs.SetServingStatus("porto", healthpb.HealthCheckResponse_SERVING)
+
+	var auth string
+	srv := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("authorization")) > 0 {
+			auth = md.Get("authorization")[0]
+		}
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(srv, hs)
+	reflection.Register(srv)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(func() {
+		srv.Stop()
+		assert.Equal(t, "Bearer token", auth)
+	})
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func serve(router restserver.Router, role, url, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	r.Header.Set(header.Authorization, "Bearer token")
+	r = identity.WithTestIdentity(r, identity.NewIdentity(role, "alice", "", nil, "", ""))
+	w := httptest.NewRecorder()
+	router.Handler().ServeHTTP(w, r)
+	return w
+}
+
+func TestNewService(t *testing.T) {
+	conn := dial(t)
+	_, err := grpcbridge.NewService(nil, nil, grpcbridge.Config{Roles: []string{"admin"}})
+	assert.EqualError(t, err, "grpcbridge: connection is required")
+	_, err = grpcbridge.NewService(conn, nil, grpcbridge.Config{})
+	assert.EqualError(t, err, "grpcbridge: roles are required")
+
+	az, err := authz.New(&authz.Config{})
+	require.NoError(t, err)
+	svc, err := grpcbridge.NewService(conn, az, grpcbridge.Config{
+		Roles: []string{"admin"},
+		MethodRoles: map[string][]string{
+			"grpc.health.v1.Health/*": {"ops", "admin"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, grpcbridge.ServiceName, svc.Name())
+	assert.True(t, svc.IsReady())
+	svc.Close()
+
+	req := az.Requirement(grpcbridge.DefaultPath + "/grpc.health.v1.Health/Check")
+	assert.Equal(t, grpcbridge.DefaultPath, req.Node)
+	assert.Equal(t, []string{"admin", "ops"}, req.Roles)
+
+	// call to satisfy the authorization check in cleanup
+	router := restserver.NewRouter(http.NotFound)
+	svc.Register(router)
+	w := serve(router, "ops", "/v1/invoke/grpc.health.v1.Health/Check", `{"service":"porto"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestInvoke(t *testing.T) {
+	conn := dial(t)
+	router := restserver.NewRouter(http.NotFound)
+	svc, err := grpcbridge.NewService(conn, nil, grpcbridge.Config{
+		Roles: []string{"admin"},
+		MethodRoles: map[string][]string{
+			"grpc.health.v1.Health/Check": {"ops"},
+		},
+		MaxRequestSize: 64,
+	})
+	require.NoError(t, err)
+	svc.Register(router)
+
+	const checkURL = "/v1/invoke/grpc.health.v1.Health/Check"
+
+	t.Run("check", func(t *testing.T) {
+		w := serve(router, "ops", checkURL, `{"service":"porto"}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, header.ApplicationJSON, w.Header().Get(header.ContentType))
+		assert.JSONEq(t, `{"status":"SERVING"}`, w.Body.String())
+
+		// empty body is the empty message
+		w = serve(router, "ops", checkURL, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.JSONEq(t, `{"status":"SERVING"}`, w.Body.String())
+	})
+
+	t.Run("forbidden", func(t *testing.T) {
+		w := serve(router, "admin", checkURL, `{}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w = serve(router, "ops", "/v1/invoke/grpc.health.v1.Health/List", `{}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("not_found", func(t *testing.T) {
+		w := serve(router, "admin", "/v1/invoke/porto.Unknown/Check", `{}`)
+		assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+		w = serve(router, "admin", "/v1/invoke/grpc.health.v1.Health/Unknown", `{}`)
+		assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+	})
+
+	t.Run("grpc_error", func(t *testing.T) {
+		w := serve(router, "ops", checkURL, `{"service":"unknown"}`)
+		assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		w := serve(router, "admin", "/v1/invoke/grpc.health.v1.Health/Watch", `{}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), "streaming method is not supported")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		w := serve(router, "ops", checkURL, `{"unknown":1}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+		w = serve(router, "ops", checkURL, `{"service":"`+strings.Repeat("a", 100)+`"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), "request exceeds 64 bytes")
+	})
+}
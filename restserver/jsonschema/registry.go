@@ -0,0 +1,200 @@
+package jsonschema
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/porto/xhttp/marshal"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+var logger = xlog.NewPackageLogger("github.com/effective-security/porto/restserver", "jsonschema")
+
+// DefaultMaxBodySize specifies the default max size of the request body to validate
+var DefaultMaxBodySize int64 = 4 << 20
+
+// Registry provides JSON Schemas per route,
+// the compiled schemas are cached by content
+type Registry struct {
+	lock        sync.RWMutex
+	routes      map[string]*Schema
+	compiled    map[[sha256.Size]byte]*Schema
+	maxBodySize int64
+}
+
+// NewRegistry returns Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		routes:      map[string]*Schema{},
+		compiled:    map[[sha256.Size]byte]*Schema{},
+		maxBodySize: DefaultMaxBodySize,
+	}
+}
+
+// WithMaxBodySize specifies the max size of the request body
+func (r *Registry) WithMaxBodySize(size int64) *Registry {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.maxBodySize = size
+	return r
+}
+
+// Register compiles and registers the schema for the route
+func (r *Registry) Register(method, path string, schema []byte) error {
+	hash := sha256.Sum256(schema)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	s := r.compiled[hash]
+	if s == nil {
+		var err error
+		s, err = Compile(schema)
+		if err != nil {
+			return errors.WithMessagef(err, "invalid schema for %s %s", method, path)
+		}
+		r.compiled[hash] = s
+	}
+	r.routes[routeKey(method, path)] = s
+	return nil
+}
+
+// RegisterFile loads, compiles and registers the schema for the route
+func (r *Registry) RegisterFile(method, path, file string) error {
+	schema, err := os.ReadFile(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return r.Register(method, path, schema)
+}
+
+// Schema returns the schema for the route, or nil if not registered
+func (r *Registry) Schema(method, path string) *Schema {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.routes[routeKey(method, path)]
+}
+
+// Handle returns the handler, that validates the request payload
+// against the schema registered for the route, before invoking the handler.
+// If the schema is not registered, the handler is returned as is.
+func (r *Registry) Handle(method, path string, handle restserver.Handle) restserver.Handle {
+	s := r.Schema(method, path)
+	if s == nil {
+		return handle
+	}
+
+	r.lock.RLock()
+	maxBodySize := r.maxBodySize
+	r.lock.RUnlock()
+
+	return func(w http.ResponseWriter, req *http.Request, p restserver.Params) {
+		ctx := req.Context()
+		body, err := io.ReadAll(io.LimitReader(req.Body, maxBodySize+1))
+		if err != nil {
+			marshal.WriteJSON(w, req, httperror.InvalidRequest("unable to read request").WithContext(ctx).WithCause(err))
+			return
+		}
+		if int64(len(body)) > maxBodySize {
+			marshal.WriteJSON(w, req, httperror.RequestTooLarge("request body is too large").WithContext(ctx))
+			return
+		}
+		_ = req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		if len(bytes.TrimSpace(body)) == 0 {
+			marshal.WriteJSON(w, req, httperror.InvalidJSON("missing request body").WithContext(ctx))
+			return
+		}
+		errs, err := s.ValidateJSON(body)
+		if err != nil {
+			marshal.WriteJSON(w, req, httperror.InvalidJSON("unable to decode request").WithContext(ctx).WithCause(err))
+			return
+		}
+		if len(errs) > 0 {
+			logger.ContextKV(ctx, xlog.DEBUG,
+				"reason", "validation",
+				"method", method,
+				"path", path,
+				"errors", len(errs))
+
+			herr := httperror.InvalidRequest("request validation failed: %s", errs[0].Error()).WithContext(ctx)
+			for _, fe := range errs {
+				herr = herr.WithFieldViolation(fe.Field, fe.Message)
+			}
+			marshal.WriteJSON(w, req, herr)
+			return
+		}
+		handle(w, req, p)
+	}
+}
+
+// NewRouter returns restserver.Router, that validates payloads
+// of the routes with registered schemas.
+// The schemas must be registered before the routes are added.
+func NewRouter(router restserver.Router, registry *Registry) restserver.Router {
+	return &validatingRouter{
+		router:   router,
+		registry: registry,
+	}
+}
+
+type validatingRouter struct {
+	router   restserver.Router
+	registry *Registry
+}
+
+// Routes returns the registered routes, if supported by the router
+func (v *validatingRouter) Routes() []restserver.Route {
+	if lister, ok := v.router.(restserver.RouteLister); ok {
+		return lister.Routes()
+	}
+	return nil
+}
+
+func (v *validatingRouter) Handler() http.Handler {
+	return v.router.Handler()
+}
+
+func (v *validatingRouter) GET(path string, handle restserver.Handle) {
+	v.router.GET(path, handle)
+}
+
+func (v *validatingRouter) HEAD(path string, handle restserver.Handle) {
+	v.router.HEAD(path, handle)
+}
+
+func (v *validatingRouter) OPTIONS(path string, handle restserver.Handle) {
+	v.router.OPTIONS(path, handle)
+}
+
+func (v *validatingRouter) POST(path string, handle restserver.Handle) {
+	v.router.POST(path, v.registry.Handle(http.MethodPost, path, handle))
+}
+
+func (v *validatingRouter) PUT(path string, handle restserver.Handle) {
+	v.router.PUT(path, v.registry.Handle(http.MethodPut, path, handle))
+}
+
+func (v *validatingRouter) PATCH(path string, handle restserver.Handle) {
+	v.router.PATCH(path, v.registry.Handle(http.MethodPatch, path, handle))
+}
+
+func (v *validatingRouter) DELETE(path string, handle restserver.Handle) {
+	v.router.DELETE(path, v.registry.Handle(http.MethodDelete, path, handle))
+}
+
+func (v *validatingRouter) CONNECT(path string, handle restserver.Handle) {
+	v.router.CONNECT(path, handle)
+}
+
+func routeKey(method, path string) string {
+	return method + " " + path
+}
@@ -0,0 +1,85 @@
+package jsonschema_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/restserver/jsonschema"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter(t *testing.T) {
+	reg := jsonschema.NewRegistry().WithMaxBodySize(256)
+	require.NoError(t, reg.Register(http.MethodPost, "/v1/users", []byte(userSchema)))
+
+	file := filepath.Join(t.TempDir(), "patch.json")
+	require.NoError(t, os.WriteFile(file, []byte(userSchema), 0600))
+	require.NoError(t, reg.RegisterFile(http.MethodPut, "/v1/users/:id", file))
+	assert.Same(t, reg.Schema(http.MethodPost, "/v1/users"), reg.Schema(http.MethodPut, "/v1/users/:id"), "compiled schema must be cached")
+	assert.Nil(t, reg.Schema(http.MethodGet, "/v1/users"))
+
+	assert.Error(t, reg.Register(http.MethodPost, "/v1/invalid", []byte(`{"type":1}`)))
+	assert.Error(t, reg.RegisterFile(http.MethodPost, "/v1/invalid", file+".missing"))
+
+	echo := func(w http.ResponseWriter, r *http.Request, _ restserver.Params) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	}
+
+	router := jsonschema.NewRouter(restserver.NewRouter(nil), reg)
+	router.POST("/v1/users", echo)
+	router.PUT("/v1/users/:id", echo)
+	router.PATCH("/v1/users/:id", echo)
+	router.DELETE("/v1/users/:id", echo)
+	router.GET("/v1/users", echo)
+	router.HEAD("/v1/users", echo)
+	router.OPTIONS("/v1/users", echo)
+	router.CONNECT("/v1/users", echo)
+	assert.Len(t, router.(restserver.RouteLister).Routes(), 8)
+	h := router.Handler()
+
+	call := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return w
+	}
+
+	valid := `{"name":"bob","email":"bob@example.com"}`
+	w := call(http.MethodPost, "/v1/users", valid)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, valid, w.Body.String())
+
+	w = call(http.MethodPut, "/v1/users/123", `{"name":"B"}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	var herr httperror.Error
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &herr))
+	assert.Equal(t, httperror.CodeInvalidRequest, herr.Code)
+	require.NotNil(t, herr.Details)
+	assert.Len(t, herr.Details.Violations, 3)
+	assert.Equal(t, "/email", herr.Details.Violations[0].Field)
+
+	// not registered
+	w = call(http.MethodPatch, "/v1/users/123", `{"name":"B"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = call(http.MethodPost, "/v1/users", ``)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "missing request body")
+
+	w = call(http.MethodPost, "/v1/users", `{`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), httperror.CodeInvalidJSON)
+
+	w = call(http.MethodPost, "/v1/users", `{"name":"`+strings.Repeat("a", 300)+`"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), httperror.CodeRequestTooLarge)
+}
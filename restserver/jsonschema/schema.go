@@ -0,0 +1,841 @@
+// Package jsonschema provides JSON Schema validation of request payloads.
+//
+// The validator supports the commonly used subset of draft 2020-12:
+// type, enum, const, properties, patternProperties, additionalProperties,
+// required, dependentRequired, propertyNames, minProperties, maxProperties,
+// items, prefixItems, contains, minItems, maxItems, uniqueItems,
+// minLength, maxLength, pattern, format, minimum, maximum,
+// exclusiveMinimum, exclusiveMaximum, multipleOf,
+// allOf, anyOf, oneOf, not, if/then/else, $defs and local $ref.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Draft202012 is the URI of the supported draft
+const Draft202012 = "https://json-schema.org/draft/2020-12/schema"
+
+// FieldError describes the validation failure
+type FieldError struct {
+	// Field is the JSON pointer to the invalid value, empty for the root
+	Field string `json:"field"`
+	// Message describes the failure
+	Message string `json:"message"`
+}
+
+func (e *FieldError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
+
+// Schema is the compiled JSON Schema
+type Schema struct {
+	always *bool
+
+	types   []string
+	enum    []any
+	cnst    any
+	hasCnst bool
+
+	properties           map[string]*Schema
+	patternProperties    map[*regexp.Regexp]*Schema
+	additionalProperties *Schema
+	propertyNames        *Schema
+	required             []string
+	dependentRequired    map[string][]string
+	minProperties        *int
+	maxProperties        *int
+
+	items       *Schema
+	prefixItems []*Schema
+	contains    *Schema
+	minItems    *int
+	maxItems    *int
+	uniqueItems bool
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+	format    string
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	multipleOf       *float64
+
+	allOf []*Schema
+	anyOf []*Schema
+	oneOf []*Schema
+	not   *Schema
+	ifs   *Schema
+	thens *Schema
+	elses *Schema
+
+	ref   string
+	refed *Schema
+}
+
+// Compile returns the compiled schema
+func Compile(data []byte) (*Schema, error) {
+	raw, err := decode(data)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to parse schema")
+	}
+	c := &compiler{
+		root:  raw,
+		cache: map[string]*Schema{},
+	}
+	s, err := c.compile(raw, "#")
+	if err != nil {
+		return nil, err
+	}
+	// resolving may compile more schemas with refs
+	for i := 0; i < len(c.refs); i++ {
+		r := c.refs[i]
+		if r.refed, err = c.resolve(r.ref); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// MustCompile returns the compiled schema, or panics
+func MustCompile(data []byte) *Schema {
+	s, err := Compile(data)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// ValidateJSON validates the JSON document
+func (s *Schema) ValidateJSON(data []byte) ([]*FieldError, error) {
+	v, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return s.Validate(v), nil
+}
+
+// Validate validates the value, decoded from JSON with json.Number,
+// and returns the list of failures
+func (s *Schema) Validate(v any) []*FieldError {
+	var errs []*FieldError
+	s.validate(v, "", &errs)
+	return errs
+}
+
+func decode(data []byte) (any, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if d.More() {
+		return nil, errors.New("unexpected data after JSON value")
+	}
+	return v, nil
+}
+
+type compiler struct {
+	root  any
+	cache map[string]*Schema
+	refs  []*Schema
+}
+
+func (c *compiler) resolve(ref string) (*Schema, error) {
+	if s, ok := c.cache[ref]; ok {
+		return s, nil
+	}
+	if !strings.HasPrefix(ref, "#") {
+		return nil, errors.Errorf("unsupported $ref: %s", ref)
+	}
+	raw := c.root
+	ptr := strings.TrimPrefix(ref, "#")
+	if ptr != "" {
+		if !strings.HasPrefix(ptr, "/") {
+			return nil, errors.Errorf("unsupported $ref: %s", ref)
+		}
+		for _, tok := range strings.Split(ptr[1:], "/") {
+			tok = strings.ReplaceAll(strings.ReplaceAll(tok, "~1", "/"), "~0", "~")
+			switch t := raw.(type) {
+			case map[string]any:
+				raw = t[tok]
+			case []any:
+				i, err := strconv.Atoi(tok)
+				if err != nil || i < 0 || i >= len(t) {
+					return nil, errors.Errorf("invalid $ref: %s", ref)
+				}
+				raw = t[i]
+			default:
+				raw = nil
+			}
+			if raw == nil {
+				return nil, errors.Errorf("invalid $ref: %s", ref)
+			}
+		}
+	}
+	return c.compile(raw, ref)
+}
+
+func (c *compiler) compile(raw any, ptr string) (*Schema, error) {
+	if s, ok := c.cache[ptr]; ok {
+		return s, nil
+	}
+	s := new(Schema)
+	c.cache[ptr] = s
+
+	switch t := raw.(type) {
+	case bool:
+		s.always = &t
+		return s, nil
+	case map[string]any:
+		return s, c.compileObject(s, t, ptr)
+	}
+	return nil, errors.Errorf("invalid schema at %s", ptr)
+}
+
+func (c *compiler) compileObject(s *Schema, m map[string]any, ptr string) error {
+	var err error
+	sub := func(key string) (*Schema, error) {
+		v, ok := m[key]
+		if !ok {
+			return nil, nil
+		}
+		return c.compile(v, ptr+"/"+key)
+	}
+	subList := func(key string) ([]*Schema, error) {
+		v, ok := m[key]
+		if !ok {
+			return nil, nil
+		}
+		list, ok := v.([]any)
+		if !ok || len(list) == 0 {
+			return nil, errors.Errorf("%s/%s: must be non-empty array", ptr, key)
+		}
+		res := make([]*Schema, len(list))
+		for i, item := range list {
+			if res[i], err = c.compile(item, fmt.Sprintf("%s/%s/%d", ptr, key, i)); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	}
+	subMap := func(key string) (map[string]*Schema, error) {
+		v, ok := m[key]
+		if !ok {
+			return nil, nil
+		}
+		mm, ok := v.(map[string]any)
+		if !ok {
+			return nil, errors.Errorf("%s/%s: must be object", ptr, key)
+		}
+		res := make(map[string]*Schema, len(mm))
+		for k, item := range mm {
+			if res[k], err = c.compile(item, ptr+"/"+key+"/"+escape(k)); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	}
+
+	if v, ok := m["$ref"]; ok {
+		ref, ok := v.(string)
+		if !ok {
+			return errors.Errorf("%s/$ref: must be string", ptr)
+		}
+		s.ref = ref
+		c.refs = append(c.refs, s)
+	}
+	for _, key := range []string{"$defs", "definitions"} {
+		if _, err = subMap(key); err != nil {
+			return err
+		}
+	}
+
+	if v, ok := m["type"]; ok {
+		switch t := v.(type) {
+		case string:
+			s.types = []string{t}
+		case []any:
+			for _, item := range t {
+				str, ok := item.(string)
+				if !ok {
+					return errors.Errorf("%s/type: must be string or array of strings", ptr)
+				}
+				s.types = append(s.types, str)
+			}
+		default:
+			return errors.Errorf("%s/type: must be string or array of strings", ptr)
+		}
+		for _, t := range s.types {
+			switch t {
+			case "null", "boolean", "object", "array", "number", "integer", "string":
+			default:
+				return errors.Errorf("%s/type: unknown type: %s", ptr, t)
+			}
+		}
+	}
+	if v, ok := m["enum"]; ok {
+		list, ok := v.([]any)
+		if !ok {
+			return errors.Errorf("%s/enum: must be array", ptr)
+		}
+		s.enum = list
+	}
+	if v, ok := m["const"]; ok {
+		s.cnst = v
+		s.hasCnst = true
+	}
+
+	if s.properties, err = subMap("properties"); err != nil {
+		return err
+	}
+	if v, ok := m["patternProperties"]; ok {
+		mm, ok := v.(map[string]any)
+		if !ok {
+			return errors.Errorf("%s/patternProperties: must be object", ptr)
+		}
+		s.patternProperties = make(map[*regexp.Regexp]*Schema, len(mm))
+		for k, item := range mm {
+			re, err := regexp.Compile(k)
+			if err != nil {
+				return errors.Wrapf(err, "%s/patternProperties: invalid pattern", ptr)
+			}
+			if s.patternProperties[re], err = c.compile(item, ptr+"/patternProperties/"+escape(k)); err != nil {
+				return err
+			}
+		}
+	}
+	if s.additionalProperties, err = sub("additionalProperties"); err != nil {
+		return err
+	}
+	if s.propertyNames, err = sub("propertyNames"); err != nil {
+		return err
+	}
+	if s.required, err = stringList(m, "required", ptr); err != nil {
+		return err
+	}
+	if v, ok := m["dependentRequired"]; ok {
+		mm, ok := v.(map[string]any)
+		if !ok {
+			return errors.Errorf("%s/dependentRequired: must be object", ptr)
+		}
+		s.dependentRequired = make(map[string][]string, len(mm))
+		for k := range mm {
+			if s.dependentRequired[k], err = stringList(mm, k, ptr+"/dependentRequired"); err != nil {
+				return err
+			}
+		}
+	}
+	if s.minProperties, err = intValue(m, "minProperties", ptr); err != nil {
+		return err
+	}
+	if s.maxProperties, err = intValue(m, "maxProperties", ptr); err != nil {
+		return err
+	}
+
+	if s.items, err = sub("items"); err != nil {
+		return err
+	}
+	if s.prefixItems, err = subList("prefixItems"); err != nil {
+		return err
+	}
+	if s.contains, err = sub("contains"); err != nil {
+		return err
+	}
+	if s.minItems, err = intValue(m, "minItems", ptr); err != nil {
+		return err
+	}
+	if s.maxItems, err = intValue(m, "maxItems", ptr); err != nil {
+		return err
+	}
+	if v, ok := m["uniqueItems"]; ok {
+		b, ok := v.(bool)
+		if !ok {
+			return errors.Errorf("%s/uniqueItems: must be boolean", ptr)
+		}
+		s.uniqueItems = b
+	}
+
+	if s.minLength, err = intValue(m, "minLength", ptr); err != nil {
+		return err
+	}
+	if s.maxLength, err = intValue(m, "maxLength", ptr); err != nil {
+		return err
+	}
+	if v, ok := m["pattern"]; ok {
+		str, ok := v.(string)
+		if !ok {
+			return errors.Errorf("%s/pattern: must be string", ptr)
+		}
+		if s.pattern, err = regexp.Compile(str); err != nil {
+			return errors.Wrapf(err, "%s/pattern: invalid pattern", ptr)
+		}
+	}
+	if v, ok := m["format"]; ok {
+		str, ok := v.(string)
+		if !ok {
+			return errors.Errorf("%s/format: must be string", ptr)
+		}
+		s.format = str
+	}
+
+	for key, dst := range map[string]**float64{
+		"minimum":          &s.minimum,
+		"maximum":          &s.maximum,
+		"exclusiveMinimum": &s.exclusiveMinimum,
+		"exclusiveMaximum": &s.exclusiveMaximum,
+		"multipleOf":       &s.multipleOf,
+	} {
+		if *dst, err = numberValue(m, key, ptr); err != nil {
+			return err
+		}
+	}
+	if s.multipleOf != nil && *s.multipleOf <= 0 {
+		return errors.Errorf("%s/multipleOf: must be greater than 0", ptr)
+	}
+
+	if s.allOf, err = subList("allOf"); err != nil {
+		return err
+	}
+	if s.anyOf, err = subList("anyOf"); err != nil {
+		return err
+	}
+	if s.oneOf, err = subList("oneOf"); err != nil {
+		return err
+	}
+	if s.not, err = sub("not"); err != nil {
+		return err
+	}
+	if s.ifs, err = sub("if"); err != nil {
+		return err
+	}
+	if s.thens, err = sub("then"); err != nil {
+		return err
+	}
+	if s.elses, err = sub("else"); err != nil {
+		return err
+	}
+	return nil
+}
+
+func stringList(m map[string]any, key, ptr string) ([]string, error) {
+	v, ok := m[key]
+	if !ok {
+		return nil, nil
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return nil, errors.Errorf("%s/%s: must be array of strings", ptr, key)
+	}
+	res := make([]string, len(list))
+	for i, item := range list {
+		if res[i], ok = item.(string); !ok {
+			return nil, errors.Errorf("%s/%s: must be array of strings", ptr, key)
+		}
+	}
+	return res, nil
+}
+
+func numberValue(m map[string]any, key, ptr string) (*float64, error) {
+	v, ok := m[key]
+	if !ok {
+		return nil, nil
+	}
+	f, ok := toFloat(v)
+	if !ok {
+		return nil, errors.Errorf("%s/%s: must be number", ptr, key)
+	}
+	return &f, nil
+}
+
+func intValue(m map[string]any, key, ptr string) (*int, error) {
+	f, err := numberValue(m, key, ptr)
+	if err != nil || f == nil {
+		return nil, err
+	}
+	if *f < 0 || *f != math.Trunc(*f) {
+		return nil, errors.Errorf("%s/%s: must be non-negative integer", ptr, key)
+	}
+	i := int(*f)
+	return &i, nil
+}
+
+func toFloat(v any) (float64, bool) {
+	switch t := v.(type) {
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	case float64:
+		return t, true
+	case int:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	}
+	return 0, false
+}
+
+func escape(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+func typeOf(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	default:
+		if f, ok := toFloat(t); ok {
+			if f == math.Trunc(f) && !math.IsInf(f, 0) {
+				return "integer"
+			}
+			return "number"
+		}
+	}
+	return "unknown"
+}
+
+func (s *Schema) valid(v any, field string) bool {
+	var errs []*FieldError
+	s.validate(v, field, &errs)
+	return len(errs) == 0
+}
+
+func (s *Schema) validate(v any, field string, errs *[]*FieldError) {
+	fail := func(format string, vals ...any) {
+		*errs = append(*errs, &FieldError{Field: field, Message: fmt.Sprintf(format, vals...)})
+	}
+
+	if s.always != nil {
+		if !*s.always {
+			fail("value is not allowed")
+		}
+		return
+	}
+	if s.refed != nil {
+		s.refed.validate(v, field, errs)
+	}
+
+	typ := typeOf(v)
+	if len(s.types) > 0 {
+		matched := false
+		for _, t := range s.types {
+			if t == typ || (t == "number" && typ == "integer") {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("expected %s, but got %s", strings.Join(s.types, " or "), typ)
+			return
+		}
+	}
+	if len(s.enum) > 0 {
+		matched := false
+		for _, e := range s.enum {
+			if equal(e, v) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("value must be one of the enumerated values")
+		}
+	}
+	if s.hasCnst && !equal(s.cnst, v) {
+		fail("value must be equal to the constant")
+	}
+
+	switch typ {
+	case "object":
+		s.validateObject(v.(map[string]any), field, errs, fail)
+	case "array":
+		s.validateArray(v.([]any), field, errs, fail)
+	case "string":
+		s.validateString(v.(string), fail)
+	case "number", "integer":
+		f, _ := toFloat(v)
+		s.validateNumber(f, fail)
+	}
+
+	for _, sub := range s.allOf {
+		sub.validate(v, field, errs)
+	}
+	if len(s.anyOf) > 0 {
+		matched := false
+		for _, sub := range s.anyOf {
+			if sub.valid(v, field) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("value must match at least one schema in anyOf")
+		}
+	}
+	if len(s.oneOf) > 0 {
+		count := 0
+		for _, sub := range s.oneOf {
+			if sub.valid(v, field) {
+				count++
+			}
+		}
+		if count != 1 {
+			fail("value must match exactly one schema in oneOf, but matched %d", count)
+		}
+	}
+	if s.not != nil && s.not.valid(v, field) {
+		fail("value must not match the schema in not")
+	}
+	if s.ifs != nil {
+		if s.ifs.valid(v, field) {
+			if s.thens != nil {
+				s.thens.validate(v, field, errs)
+			}
+		} else if s.elses != nil {
+			s.elses.validate(v, field, errs)
+		}
+	}
+}
+
+func (s *Schema) validateObject(obj map[string]any, field string, errs *[]*FieldError, fail func(string, ...any)) {
+	for _, name := range s.required {
+		if _, ok := obj[name]; !ok {
+			*errs = append(*errs, &FieldError{Field: field + "/" + escape(name), Message: "required property is missing"})
+		}
+	}
+	for name, deps := range s.dependentRequired {
+		if _, ok := obj[name]; !ok {
+			continue
+		}
+		for _, dep := range deps {
+			if _, ok := obj[dep]; !ok {
+				*errs = append(*errs, &FieldError{Field: field + "/" + escape(dep), Message: "property is required when " + name + " is present"})
+			}
+		}
+	}
+	if s.minProperties != nil && len(obj) < *s.minProperties {
+		fail("must have at least %d properties", *s.minProperties)
+	}
+	if s.maxProperties != nil && len(obj) > *s.maxProperties {
+		fail("must have at most %d properties", *s.maxProperties)
+	}
+
+	// sort for stable errors
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		val := obj[name]
+		path := field + "/" + escape(name)
+		if s.propertyNames != nil {
+			s.propertyNames.validate(name, path, errs)
+		}
+		evaluated := false
+		if sub, ok := s.properties[name]; ok {
+			evaluated = true
+			sub.validate(val, path, errs)
+		}
+		for re, sub := range s.patternProperties {
+			if re.MatchString(name) {
+				evaluated = true
+				sub.validate(val, path, errs)
+			}
+		}
+		if !evaluated && s.additionalProperties != nil {
+			if s.additionalProperties.always != nil && !*s.additionalProperties.always {
+				*errs = append(*errs, &FieldError{Field: path, Message: "additional property is not allowed"})
+				continue
+			}
+			s.additionalProperties.validate(val, path, errs)
+		}
+	}
+}
+
+func (s *Schema) validateArray(list []any, field string, errs *[]*FieldError, fail func(string, ...any)) {
+	if s.minItems != nil && len(list) < *s.minItems {
+		fail("must have at least %d items", *s.minItems)
+	}
+	if s.maxItems != nil && len(list) > *s.maxItems {
+		fail("must have at most %d items", *s.maxItems)
+	}
+	if s.uniqueItems {
+	outer:
+		for i := range list {
+			for j := i + 1; j < len(list); j++ {
+				if equal(list[i], list[j]) {
+					fail("items must be unique, but items %d and %d are equal", i, j)
+					break outer
+				}
+			}
+		}
+	}
+	for i, item := range list {
+		path := field + "/" + strconv.Itoa(i)
+		if i < len(s.prefixItems) {
+			s.prefixItems[i].validate(item, path, errs)
+		} else if s.items != nil {
+			s.items.validate(item, path, errs)
+		}
+	}
+	if s.contains != nil {
+		matched := false
+		for i, item := range list {
+			if s.contains.valid(item, field+"/"+strconv.Itoa(i)) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("must contain at least one item matching the schema in contains")
+		}
+	}
+}
+
+func (s *Schema) validateString(str string, fail func(string, ...any)) {
+	n := utf8.RuneCountInString(str)
+	if s.minLength != nil && n < *s.minLength {
+		fail("must be at least %d characters long", *s.minLength)
+	}
+	if s.maxLength != nil && n > *s.maxLength {
+		fail("must be at most %d characters long", *s.maxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(str) {
+		fail("must match pattern %q", s.pattern.String())
+	}
+	if s.format != "" && !validFormat(s.format, str) {
+		fail("must be a valid %s", s.format)
+	}
+}
+
+func (s *Schema) validateNumber(f float64, fail func(string, ...any)) {
+	if s.minimum != nil && f < *s.minimum {
+		fail("must be greater than or equal to %v", *s.minimum)
+	}
+	if s.maximum != nil && f > *s.maximum {
+		fail("must be less than or equal to %v", *s.maximum)
+	}
+	if s.exclusiveMinimum != nil && f <= *s.exclusiveMinimum {
+		fail("must be greater than %v", *s.exclusiveMinimum)
+	}
+	if s.exclusiveMaximum != nil && f >= *s.exclusiveMaximum {
+		fail("must be less than %v", *s.exclusiveMaximum)
+	}
+	if s.multipleOf != nil {
+		q := f / *s.multipleOf
+		if math.Abs(q-math.Round(q)) > 1e-9 {
+			fail("must be a multiple of %v", *s.multipleOf)
+		}
+	}
+}
+
+var (
+	uuidRegex     = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hostnameRegex = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*$`)
+)
+
+// validFormat asserts the known formats, unknown formats are ignored
+func validFormat(format, str string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339Nano, str)
+		return err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", str)
+		return err == nil
+	case "time":
+		_, err := time.Parse("15:04:05Z07:00", str)
+		return err == nil
+	case "duration":
+		return strings.HasPrefix(str, "P") && len(str) > 1
+	case "email":
+		a, err := mail.ParseAddress(str)
+		return err == nil && a.Address == str
+	case "hostname":
+		return len(str) <= 253 && hostnameRegex.MatchString(str)
+	case "ipv4":
+		ip := net.ParseIP(str)
+		return ip != nil && ip.To4() != nil && !strings.Contains(str, ":")
+	case "ipv6":
+		ip := net.ParseIP(str)
+		return ip != nil && strings.Contains(str, ":")
+	case "uri":
+		u, err := url.Parse(str)
+		return err == nil && u.Scheme != ""
+	case "uri-reference":
+		_, err := url.Parse(str)
+		return err == nil
+	case "uuid":
+		return uuidRegex.MatchString(str)
+	case "regex":
+		_, err := regexp.Compile(str)
+		return err == nil
+	}
+	return true
+}
+
+func equal(a, b any) bool {
+	fa, oka := toFloat(a)
+	fb, okb := toFloat(b)
+	if oka && okb {
+		return fa == fb
+	}
+	switch ta := a.(type) {
+	case []any:
+		tb, ok := b.([]any)
+		if !ok || len(ta) != len(tb) {
+			return false
+		}
+		for i := range ta {
+			if !equal(ta[i], tb[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		tb, ok := b.(map[string]any)
+		if !ok || len(ta) != len(tb) {
+			return false
+		}
+		for k, va := range ta {
+			vb, ok := tb[k]
+			if !ok || !equal(va, vb) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,193 @@
+package jsonschema_test
+
+import (
+	"testing"
+
+	"github.com/effective-security/porto/restserver/jsonschema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const userSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["name", "email"],
+	"additionalProperties": false,
+	"properties": {
+		"name": {"type": "string", "minLength": 2, "maxLength": 10, "pattern": "^[a-z]+$"},
+		"email": {"type": "string", "format": "email"},
+		"age": {"type": "integer", "minimum": 0, "exclusiveMaximum": 150},
+		"score": {"type": "number", "multipleOf": 0.5},
+		"role": {"enum": ["admin", "user"]},
+		"kind": {"const": "person"},
+		"tags": {"type": "array", "items": {"type": "string"}, "uniqueItems": true, "maxItems": 3},
+		"point": {"type": "array", "prefixItems": [{"type": "number"}, {"type": "number"}], "items": false},
+		"address": {"$ref": "#/$defs/address"},
+		"id": {"type": "string", "format": "uuid"},
+		"created": {"type": "string", "format": "date-time"},
+		"contact": {"oneOf": [{"required": ["phone"]}, {"required": ["fax"]}]},
+		"labels": {"type": "object", "patternProperties": {"^x-": {"type": "string"}}, "additionalProperties": false}
+	},
+	"dependentRequired": {"age": ["role"]},
+	"$defs": {
+		"address": {
+			"type": "object",
+			"required": ["city"],
+			"properties": {
+				"city": {"type": "string"},
+				"next": {"$ref": "#/$defs/address"}
+			}
+		}
+	}
+}`
+
+func TestSchema(t *testing.T) {
+	s, err := jsonschema.Compile([]byte(userSchema))
+	require.NoError(t, err)
+
+	tcases := []struct {
+		doc  string
+		errs []string
+	}{
+		{doc: `{"name":"bob","email":"bob@example.com"}`},
+		{
+			doc: `{"name":"bob","email":"bob@example.com","age":30,"role":"admin","score":1.5,"kind":"person",
+				"tags":["a","b"],"point":[1,2.5],"address":{"city":"x","next":{"city":"y"}},
+				"id":"6b6e2cf4-2a5c-4f7f-9d2c-1f6b5d6e7a8b","created":"2024-01-02T03:04:05Z",
+				"contact":{"phone":"1"},"labels":{"x-a":"b"}}`,
+		},
+		{doc: `[]`, errs: []string{"expected object, but got array"}},
+		{doc: `{}`, errs: []string{"/name: required property is missing", "/email: required property is missing"}},
+		{
+			doc: `{"name":"B","email":"bob","other":1}`,
+			errs: []string{
+				"/email: must be a valid email",
+				"/name: must be at least 2 characters long",
+				`/name: must match pattern "^[a-z]+$"`,
+				"/other: additional property is not allowed",
+			},
+		},
+		{
+			doc:  `{"name":"bob","email":"b@x.com","age":1.5,"role":"admin"}`,
+			errs: []string{"/age: expected integer, but got number"},
+		},
+		{
+			doc:  `{"name":"bob","email":"b@x.com","age":150}`,
+			errs: []string{"/role: property is required when age is present", "/age: must be less than 150"},
+		},
+		{
+			doc: `{"name":"bob","email":"b@x.com","score":1.2,"role":"guest","kind":"robot"}`,
+			errs: []string{
+				"/kind: value must be equal to the constant",
+				"/role: value must be one of the enumerated values",
+				"/score: must be a multiple of 0.5",
+			},
+		},
+		{
+			doc: `{"name":"bob","email":"b@x.com","tags":["a","a",1,"b"]}`,
+			errs: []string{
+				"/tags: must have at most 3 items",
+				"/tags: items must be unique, but items 0 and 1 are equal",
+				"/tags/2: expected string, but got integer",
+			},
+		},
+		{
+			doc:  `{"name":"bob","email":"b@x.com","point":[1,2,3]}`,
+			errs: []string{"/point/2: value is not allowed"},
+		},
+		{
+			doc:  `{"name":"bob","email":"b@x.com","address":{"next":{}}}`,
+			errs: []string{"/address/city: required property is missing", "/address/next/city: required property is missing"},
+		},
+		{
+			doc:  `{"name":"bob","email":"b@x.com","id":"123","created":"yesterday"}`,
+			errs: []string{"/created: must be a valid date-time", "/id: must be a valid uuid"},
+		},
+		{
+			doc:  `{"name":"bob","email":"b@x.com","contact":{"phone":"1","fax":"2"}}`,
+			errs: []string{"/contact: value must match exactly one schema in oneOf, but matched 2"},
+		},
+		{
+			doc:  `{"name":"bob","email":"b@x.com","labels":{"a":"b","x-b":1}}`,
+			errs: []string{"/labels/a: additional property is not allowed", "/labels/x-b: expected string, but got integer"},
+		},
+	}
+
+	for _, tc := range tcases {
+		errs, err := s.ValidateJSON([]byte(tc.doc))
+		require.NoError(t, err, tc.doc)
+		var list []string
+		for _, e := range errs {
+			list = append(list, e.Error())
+		}
+		assert.ElementsMatch(t, tc.errs, list, tc.doc)
+	}
+
+	_, err = s.ValidateJSON([]byte(`{`))
+	assert.Error(t, err)
+	_, err = s.ValidateJSON([]byte(`{} {}`))
+	assert.EqualError(t, err, "unexpected data after JSON value")
+}
+
+func TestSchema_Combinators(t *testing.T) {
+	s := jsonschema.MustCompile([]byte(`{
+		"anyOf": [{"type": "string"}, {"type": "number", "minimum": 10}],
+		"not": {"const": "forbidden"},
+		"if": {"type": "string"},
+		"then": {"maxLength": 5},
+		"else": {"maximum": 100}
+	}`))
+
+	assert.Empty(t, s.Validate("abc"))
+	assert.Empty(t, s.Validate(50))
+	assert.Len(t, s.Validate("forbidden"), 2)
+	assert.Len(t, s.Validate(5), 1)
+	assert.Len(t, s.Validate(500), 1)
+	assert.Len(t, s.Validate(true), 1)
+
+	s = jsonschema.MustCompile([]byte(`{"type":"array","contains":{"const":1},"minItems":2}`))
+	assert.Empty(t, s.Validate([]any{2, 1}))
+	assert.Len(t, s.Validate([]any{2}), 2)
+
+	s = jsonschema.MustCompile([]byte(`{"type":["string","null"],"propertyNames":{"maxLength":1}}`))
+	assert.Empty(t, s.Validate(nil))
+	assert.Len(t, s.Validate(map[string]any{}), 1)
+
+	s = jsonschema.MustCompile([]byte(`{"type":"object","propertyNames":{"maxLength":1},"minProperties":1,"maxProperties":1}`))
+	assert.Empty(t, s.Validate(map[string]any{"a": 1}))
+	assert.Len(t, s.Validate(map[string]any{"ab": 1, "c": 2}), 2)
+	assert.Len(t, s.Validate(map[string]any{}), 1)
+
+	assert.Empty(t, jsonschema.MustCompile([]byte(`true`)).Validate(1))
+	assert.Len(t, jsonschema.MustCompile([]byte(`false`)).Validate(1), 1)
+}
+
+func TestCompile_Errors(t *testing.T) {
+	tcases := map[string]string{
+		`{`:                              "failed to parse schema: unexpected EOF",
+		`1`:                              "invalid schema at #",
+		`{"type":"unknown"}`:             "#/type: unknown type: unknown",
+		`{"type":1}`:                     "#/type: must be string or array of strings",
+		`{"$ref":"#/$defs/missing"}`:     "invalid $ref: #/$defs/missing",
+		`{"$ref":"http://x/schema"}`:     "unsupported $ref: http://x/schema",
+		`{"pattern":"["}`:                "#/pattern: invalid pattern: error parsing regexp: missing closing ]: `[`",
+		`{"minLength":-1}`:               "#/minLength: must be non-negative integer",
+		`{"multipleOf":0}`:               "#/multipleOf: must be greater than 0",
+		`{"required":[1]}`:               "#/required: must be array of strings",
+		`{"allOf":[]}`:                   "#/allOf: must be non-empty array",
+		`{"properties":{"a":1}}`:         "invalid schema at #/properties/a",
+		`{"enum":1}`:                     "#/enum: must be array",
+		`{"minimum":"1"}`:                "#/minimum: must be number",
+		`{"uniqueItems":1}`:              "#/uniqueItems: must be boolean",
+		`{"format":1}`:                   "#/format: must be string",
+		`{"dependentRequired":{"a":1}}`:  "#/dependentRequired/a: must be array of strings",
+		`{"patternProperties":{"[":{}}}`: "#/patternProperties: invalid pattern: error parsing regexp: missing closing ]: `[`",
+	}
+	for doc, exp := range tcases {
+		_, err := jsonschema.Compile([]byte(doc))
+		assert.EqualError(t, err, exp, doc)
+	}
+	assert.Panics(t, func() {
+		jsonschema.MustCompile([]byte(`1`))
+	})
+}
@@ -0,0 +1,243 @@
+// Package kvsnapshot provides restserver.Service to export and import
+// the keyspace of the service stored in cache.Provider, like Redis,
+// to support tenant migrations and backups of the state.
+//
+// The entries are streamed as NDJSON, one cache.RawEntry per line,
+// with the value in the provider's encoding and the remaining TTL.
+// The endpoints are restricted to the configured admin roles.
+package kvsnapshot
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/effective-security/porto/pkg/cache"
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/restserver/authz"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/porto/xhttp/marshal"
+	"github.com/effective-security/porto/xhttp/reqctx"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+var logger = xlog.NewPackageLogger("github.com/effective-security/porto/restserver", "kvsnapshot")
+
+// ServiceName provides the default service name
+const ServiceName = "kvsnapshot"
+
+const (
+	// DefaultPath is the default base path of the endpoints
+	DefaultPath = "/v1/admin/kv"
+	// DefaultMaxImportSize is the default limit of the import body size
+	DefaultMaxImportSize = 64 * 1024 * 1024
+
+	flushEvery = 100
+)
+
+// Conflict policies of the import
+const (
+	// ConflictSkip keeps the existing entries
+	ConflictSkip = "skip"
+	// ConflictOverwrite replaces the existing entries
+	ConflictOverwrite = "overwrite"
+	// ConflictFail stops the import on the first existing entry,
+	// the entries imported before the conflict are kept
+	ConflictFail = "fail"
+)
+
+// Config provides configuration of the service
+type Config struct {
+	// Path is the base path of the endpoints, default is DefaultPath
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// AdminRoles specifies the roles allowed to export and import
+	AdminRoles []string `json:"admin_roles" yaml:"admin_roles"`
+	// MaxImportSize specifies the limit of the import body size,
+	// default is DefaultMaxImportSize
+	MaxImportSize int64 `json:"max_import_size,omitempty" yaml:"max_import_size,omitempty"`
+}
+
+// ImportResponse provides the result of the import
+type ImportResponse struct {
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"`
+}
+
+// Service provides restserver.Service to export and import the keyspace
+type Service struct {
+	cfg  Config
+	snap cache.Snapshotter
+}
+
+// NewService returns Service, the provider must implement cache.Snapshotter.
+// If the authz provider is specified, then the admin roles are allowed for the path.
+func NewService(prov cache.Provider, az *authz.Provider, cfg Config) (*Service, error) {
+	snap, ok := prov.(cache.Snapshotter)
+	if !ok {
+		return nil, errors.New("kvsnapshot: provider does not support snapshots")
+	}
+	if len(cfg.AdminRoles) == 0 {
+		return nil, errors.New("kvsnapshot: admin roles are required")
+	}
+	if cfg.Path == "" {
+		cfg.Path = DefaultPath
+	}
+	if cfg.MaxImportSize <= 0 {
+		cfg.MaxImportSize = DefaultMaxImportSize
+	}
+	if az != nil {
+		az.Allow(cfg.Path, cfg.AdminRoles...)
+	}
+	return &Service{
+		cfg:  cfg,
+		snap: snap,
+	}, nil
+}
+
+// Name returns the service name
+func (s *Service) Name() string {
+	return ServiceName
+}
+
+// IsReady indicates that the service is ready to serve its end-points
+func (s *Service) IsReady() bool {
+	return true
+}
+
+// Close the subservices and it's resources
+func (s *Service) Close() {
+}
+
+// Register adds the endpoints to the router
+func (s *Service) Register(r restserver.Router) {
+	r.GET(s.cfg.Path+"/export", s.export)
+	r.POST(s.cfg.Path+"/import", s.importEntries)
+}
+
+// checkAccess is in addition to authz, as the endpoints
+// must not be exposed if the authz is not configured for the path
+func (s *Service) checkAccess(w http.ResponseWriter, r *http.Request) bool {
+	role := reqctx.Identity(r.Context()).Role()
+	if !slices.Contains(s.cfg.AdminRoles, role) {
+		marshal.WriteJSON(w, r, httperror.Forbidden("%q role is not allowed", role))
+		return false
+	}
+	return true
+}
+
+func (s *Service) export(w http.ResponseWriter, r *http.Request, _ restserver.Params) {
+	if !s.checkAccess(w, r) {
+		return
+	}
+	ctx := r.Context()
+	pattern := r.URL.Query().Get("pattern")
+	if pattern == "" {
+		pattern = "*"
+	}
+
+	w.Header().Set(header.ContentType, header.ApplicationNDJSON)
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	count := 0
+	err := s.snap.Scan(ctx, pattern, func(e *cache.RawEntry) error {
+		if err := enc.Encode(e); err != nil {
+			return errors.WithStack(err)
+		}
+		count++
+		if flusher != nil && count%flushEvery == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		// the status is already sent, the client detects the truncated stream
+		logger.ContextKV(ctx, xlog.ERROR,
+			"reason", "export",
+			"pattern", pattern,
+			"exported", count,
+			"err", err)
+		return
+	}
+	logger.ContextKV(ctx, xlog.NOTICE,
+		"status", "exported",
+		"pattern", pattern,
+		"count", count)
+}
+
+func (s *Service) importEntries(w http.ResponseWriter, r *http.Request, _ restserver.Params) {
+	if !s.checkAccess(w, r) {
+		return
+	}
+	ctx := r.Context()
+
+	policy := r.URL.Query().Get("conflict")
+	switch policy {
+	case "":
+		policy = ConflictSkip
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+	default:
+		marshal.WriteJSON(w, r, httperror.InvalidParam("invalid conflict policy: %s", policy))
+		return
+	}
+
+	res := &ImportResponse{}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.cfg.MaxImportSize))
+	for line := 1; ; line++ {
+		e := new(cache.RawEntry)
+		err := dec.Decode(e)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				marshal.WriteJSON(w, r, httperror.RequestTooLarge("import exceeds %d bytes, imported %d entries", s.cfg.MaxImportSize, res.Imported))
+				return
+			}
+			marshal.WriteJSON(w, r, httperror.New(http.StatusBadRequest, httperror.CodeInvalidJSON,
+				"invalid entry at line %d, imported %d entries: %s", line, res.Imported, err.Error()))
+			return
+		}
+		if !validKey(e.Key) || e.TTL < 0 {
+			marshal.WriteJSON(w, r, httperror.InvalidRequest("invalid entry at line %d, imported %d entries", line, res.Imported))
+			return
+		}
+
+		set, err := s.snap.Restore(ctx, e, policy == ConflictOverwrite)
+		if err != nil {
+			marshal.WriteJSON(w, r, errors.WithMessagef(err, "failed to import %s", e.Key))
+			return
+		}
+		if !set {
+			if policy == ConflictFail {
+				marshal.WriteJSON(w, r, httperror.Conflict("entry already exists: %s, imported %d entries", e.Key, res.Imported))
+				return
+			}
+			res.Skipped++
+			continue
+		}
+		res.Imported++
+	}
+
+	logger.ContextKV(ctx, xlog.NOTICE,
+		"status", "imported",
+		"conflict", policy,
+		"imported", res.Imported,
+		"skipped", res.Skipped)
+	marshal.WriteJSON(w, r, res)
+}
+
+// validKey returns false if the key is not relative to the provider prefix
+func validKey(key string) bool {
+	return key != "" &&
+		!strings.HasPrefix(key, "/") &&
+		path.Clean(key) == key &&
+		key != ".." && !strings.HasPrefix(key, "../")
+}
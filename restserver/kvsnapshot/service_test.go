@@ -0,0 +1,151 @@
+package kvsnapshot_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/cache"
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/restserver/authz"
+	"github.com/effective-security/porto/restserver/kvsnapshot"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nonSnapshotter struct {
+	cache.Provider
+}
+
+func TestNewService(t *testing.T) {
+	prov := cache.NewMemoryProvider("svc")
+
+	_, err := kvsnapshot.NewService(nonSnapshotter{prov}, nil, kvsnapshot.Config{AdminRoles: []string{"admin"}})
+	assert.EqualError(t, err, "kvsnapshot: provider does not support snapshots")
+	_, err = kvsnapshot.NewService(prov, nil, kvsnapshot.Config{})
+	assert.EqualError(t, err, "kvsnapshot: admin roles are required")
+
+	az, err := authz.New(&authz.Config{})
+	require.NoError(t, err)
+	svc, err := kvsnapshot.NewService(prov, az, kvsnapshot.Config{AdminRoles: []string{"admin"}})
+	require.NoError(t, err)
+	assert.Equal(t, kvsnapshot.ServiceName, svc.Name())
+	assert.True(t, svc.IsReady())
+	svc.Close()
+
+	req := az.Requirement(kvsnapshot.DefaultPath + "/export")
+	assert.Equal(t, kvsnapshot.DefaultPath, req.Node)
+	assert.Equal(t, []string{"admin"}, req.Roles)
+}
+
+func serve(t *testing.T, router restserver.Router, role, method, url, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, url, strings.NewReader(body))
+	r = identity.WithTestIdentity(r, identity.NewIdentity(role, "alice", "", nil, "", ""))
+	w := httptest.NewRecorder()
+	router.Handler().ServeHTTP(w, r)
+	return w
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	src := cache.NewMemoryProvider("src")
+	require.NoError(t, src.Set(ctx, "users/1", "alice", time.Hour))
+	require.NoError(t, src.Set(ctx, "users/2", "bob", cache.KeepTTL))
+	require.NoError(t, src.Set(ctx, "orgs/1", "acme", time.Hour))
+
+	router := restserver.NewRouter(nil)
+	svc, err := kvsnapshot.NewService(src, nil, kvsnapshot.Config{AdminRoles: []string{"admin"}})
+	require.NoError(t, err)
+	svc.Register(router)
+
+	w := serve(t, router, "user", http.MethodGet, "/v1/admin/kv/export", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = serve(t, router, "admin", http.MethodGet, "/v1/admin/kv/export?pattern=users/*", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, header.ApplicationNDJSON, w.Header().Get(header.ContentType))
+
+	export := w.Body.String()
+	var entries []*cache.RawEntry
+	scanner := bufio.NewScanner(strings.NewReader(export))
+	for scanner.Scan() {
+		e := new(cache.RawEntry)
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), e))
+		entries = append(entries, e)
+	}
+	require.Len(t, entries, 2)
+
+	// import into other prefix
+	dst := cache.NewMemoryProvider("dst")
+	require.NoError(t, dst.Set(ctx, "users/1", "old", time.Hour))
+
+	router = restserver.NewRouter(nil)
+	svc, err = kvsnapshot.NewService(dst, nil, kvsnapshot.Config{AdminRoles: []string{"admin"}})
+	require.NoError(t, err)
+	svc.Register(router)
+
+	w = serve(t, router, "user", http.MethodPost, "/v1/admin/kv/import", export)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = serve(t, router, "admin", http.MethodPost, "/v1/admin/kv/import?conflict=invalid", export)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve(t, router, "admin", http.MethodPost, "/v1/admin/kv/import", export)
+	require.Equal(t, http.StatusOK, w.Code)
+	var res kvsnapshot.ImportResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, 1, res.Imported)
+	assert.Equal(t, 1, res.Skipped)
+
+	w = serve(t, router, "admin", http.MethodPost, "/v1/admin/kv/import?conflict=fail", export)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "entry already exists: users/")
+
+	var val string
+	require.NoError(t, dst.Get(ctx, "users/1", &val))
+	assert.Equal(t, "old", val)
+	require.NoError(t, dst.Get(ctx, "users/2", &val))
+	assert.Equal(t, "bob", val)
+
+	w = serve(t, router, "admin", http.MethodPost, "/v1/admin/kv/import?conflict=overwrite", export)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, 2, res.Imported)
+	require.NoError(t, dst.Get(ctx, "users/1", &val))
+	assert.Equal(t, "alice", val)
+}
+
+func TestImportInvalid(t *testing.T) {
+	router := restserver.NewRouter(nil)
+	svc, err := kvsnapshot.NewService(cache.NewMemoryProvider("dst"), nil, kvsnapshot.Config{
+		AdminRoles:    []string{"admin"},
+		MaxImportSize: 100,
+	})
+	require.NoError(t, err)
+	svc.Register(router)
+
+	tcs := []struct {
+		body string
+		code int
+		msg  string
+	}{
+		{`{"key":"../other/1","value":"YQ=="}`, http.StatusBadRequest, "invalid entry at line 1"},
+		{`{"key":"/abs","value":"YQ=="}`, http.StatusBadRequest, "invalid entry at line 1"},
+		{`{"key":"a/./b","value":"YQ=="}`, http.StatusBadRequest, "invalid entry at line 1"},
+		{`{"key":"a","value":"YQ==","ttl":-1}`, http.StatusBadRequest, "invalid entry at line 1"},
+		{"{\"key\":\"a\",\"value\":\"YQ==\"}\n{", http.StatusBadRequest, "invalid entry at line 2, imported 1 entries"},
+		{strings.Repeat(`{"key":"a","value":"YQ=="}`, 10), http.StatusBadRequest, "request_too_large"},
+	}
+	for _, tc := range tcs {
+		w := serve(t, router, "admin", http.MethodPost, "/v1/admin/kv/import?conflict=overwrite", tc.body)
+		assert.Equal(t, tc.code, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), tc.msg, tc.body)
+	}
+}
@@ -0,0 +1,184 @@
+// Package offload provides the helper to offload large responses,
+// like exports, to object storage, and redirect the client
+// with 303 See Other to a signed URL, instead of streaming through the server.
+package offload
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/effective-security/porto/pkg/tasks"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/x/guid"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+var logger = xlog.NewPackageLogger("github.com/effective-security/porto/restserver", "offload")
+
+const (
+	// DefaultThreshold is the default size of the payload to offload
+	DefaultThreshold = 10 * 1024 * 1024
+	// DefaultPrefix is the default prefix of the offloaded objects
+	DefaultPrefix = "offload"
+	// DefaultURLTTL is the default TTL of the signed URL
+	DefaultURLTTL = 15 * time.Minute
+	// DefaultRetention is the default retention of the offloaded objects
+	DefaultRetention = 24 * time.Hour
+)
+
+// ObjectInfo describes the stored object
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	Created time.Time
+}
+
+// Store is the object storage abstraction, implemented by S3 or GCS adapters
+type Store interface {
+	// Put writes the object, size is -1 if unknown
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// SignedURL returns URL to download the object, valid for ttl
+	SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+	// List returns the objects with the prefix
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Delete removes the object
+	Delete(ctx context.Context, key string) error
+}
+
+// Config provides configuration for Offloader
+type Config struct {
+	// Threshold is the size of the payload to offload, default is DefaultThreshold
+	Threshold int64 `json:"threshold,omitempty" yaml:"threshold,omitempty"`
+	// Prefix of the objects, default is DefaultPrefix
+	Prefix string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	// URLTTL is TTL of the signed URL, default is DefaultURLTTL
+	URLTTL time.Duration `json:"url_ttl,omitempty" yaml:"url_ttl,omitempty"`
+	// Retention of the objects, removed by Cleanup, default is DefaultRetention
+	Retention time.Duration `json:"retention,omitempty" yaml:"retention,omitempty"`
+}
+
+// Offloader writes large payloads to object storage
+type Offloader struct {
+	store Store
+	cfg   Config
+}
+
+// New returns Offloader
+func New(store Store, cfg Config) *Offloader {
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = DefaultThreshold
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = DefaultPrefix
+	}
+	if cfg.URLTTL <= 0 {
+		cfg.URLTTL = DefaultURLTTL
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = DefaultRetention
+	}
+	return &Offloader{
+		store: store,
+		cfg:   cfg,
+	}
+}
+
+// Write writes the payload to the response, or if the payload size
+// is at least Threshold, then offloads it to the object storage,
+// and redirects the client to the signed URL.
+// The size is -1 if unknown, then up to Threshold bytes are buffered
+// to decide on the offload.
+// The name is used as the last segment of the object key.
+func (o *Offloader) Write(w http.ResponseWriter, r *http.Request, name, contentType string, body io.Reader, size int64) error {
+	if size < 0 {
+		buf := &bytes.Buffer{}
+		n, err := io.CopyN(buf, body, o.cfg.Threshold)
+		if err != nil && err != io.EOF {
+			return errors.WithMessage(err, "failed to read payload")
+		}
+		if n < o.cfg.Threshold {
+			size = n
+		}
+		body = io.MultiReader(buf, body)
+	}
+
+	if size >= 0 && size < o.cfg.Threshold {
+		w.Header().Set(header.ContentType, contentType)
+		w.WriteHeader(http.StatusOK)
+		_, err := io.Copy(w, body)
+		return errors.WithStack(err)
+	}
+
+	ctx := r.Context()
+	key := o.key(name)
+	if err := o.store.Put(ctx, key, body, size, contentType); err != nil {
+		return errors.WithMessage(err, "failed to offload payload")
+	}
+	url, err := o.store.SignedURL(ctx, key, o.cfg.URLTTL)
+	if err != nil {
+		return errors.WithMessage(err, "failed to sign URL")
+	}
+
+	logger.ContextKV(ctx, xlog.DEBUG, "status", "offloaded", "key", key, "size", size)
+
+	w.Header().Set(header.Location, url)
+	w.WriteHeader(http.StatusSeeOther)
+	return nil
+}
+
+// key returns the object key, prefixed with the date,
+// so the expired objects can be listed
+func (o *Offloader) key(name string) string {
+	name = path.Base("/" + strings.TrimSpace(name))
+	if name == "/" || name == "." {
+		name = "payload"
+	}
+	return path.Join(o.cfg.Prefix, time.Now().UTC().Format("20060102"), guid.MustCreate(), name)
+}
+
+// Cleanup removes the objects older than Retention,
+// and returns the number of removed objects
+func (o *Offloader) Cleanup(ctx context.Context) (int, error) {
+	list, err := o.store.List(ctx, o.cfg.Prefix+"/")
+	if err != nil {
+		return 0, errors.WithMessage(err, "failed to list objects")
+	}
+
+	expired := time.Now().Add(-o.cfg.Retention)
+	count := 0
+	for _, obj := range list {
+		if obj.Created.After(expired) {
+			continue
+		}
+		if err = o.store.Delete(ctx, obj.Key); err != nil {
+			return count, errors.WithMessagef(err, "failed to delete %s", obj.Key)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// CleanupTask returns the task to run Cleanup on the schedule,
+// in tasks.NewTask format, for example "every 1 hour"
+func (o *Offloader) CleanupTask(schedule string) (tasks.Task, error) {
+	t, err := tasks.NewTask(schedule)
+	if err != nil {
+		return nil, err
+	}
+	return t.Do("offload_cleanup", o.cleanup), nil
+}
+
+func (o *Offloader) cleanup() {
+	count, err := o.Cleanup(context.Background())
+	if err != nil {
+		logger.KV(xlog.ERROR, "reason", "cleanup", "removed", count, "err", err.Error())
+		return
+	}
+	logger.KV(xlog.DEBUG, "reason", "cleanup", "removed", count)
+}
@@ -0,0 +1,168 @@
+package offload
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type object struct {
+	data        []byte
+	contentType string
+	created     time.Time
+}
+
+type mockStore struct {
+	lock    sync.Mutex
+	objects map[string]*object
+	putErr  error
+}
+
+func newMockStore() *mockStore {
+	return &mockStore{objects: map[string]*object{}}
+}
+
+func (s *mockStore) Put(_ context.Context, key string, body io.Reader, _ int64, contentType string) error {
+	if s.putErr != nil {
+		return s.putErr
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.objects[key] = &object{data: b, contentType: contentType, created: time.Now()}
+	return nil
+}
+
+func (s *mockStore) SignedURL(_ context.Context, key string, ttl time.Duration) (string, error) {
+	return "https://storage.local/" + key + "?ttl=" + ttl.String(), nil
+}
+
+func (s *mockStore) List(_ context.Context, prefix string) ([]ObjectInfo, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var list []ObjectInfo
+	for k, o := range s.objects {
+		if strings.HasPrefix(k, prefix) {
+			list = append(list, ObjectInfo{Key: k, Size: int64(len(o.data)), Created: o.created})
+		}
+	}
+	return list, nil
+}
+
+func (s *mockStore) Delete(_ context.Context, key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func TestNew(t *testing.T) {
+	o := New(newMockStore(), Config{})
+	assert.Equal(t, int64(DefaultThreshold), o.cfg.Threshold)
+	assert.Equal(t, DefaultPrefix, o.cfg.Prefix)
+	assert.Equal(t, DefaultURLTTL, o.cfg.URLTTL)
+	assert.Equal(t, DefaultRetention, o.cfg.Retention)
+}
+
+func TestWrite(t *testing.T) {
+	store := newMockStore()
+	o := New(store, Config{Threshold: 10, Prefix: "exports"})
+
+	small := []byte("12345")
+	large := bytes.Repeat([]byte("x"), 25)
+
+	tcs := []struct {
+		name    string
+		body    []byte
+		size    int64
+		offload bool
+	}{
+		{"small", small, int64(len(small)), false},
+		{"small_unknown", small, -1, false},
+		{"large", large, int64(len(large)), true},
+		{"large_unknown", large, -1, true},
+		{"threshold_unknown", large[:10], -1, true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/export", nil)
+			w := httptest.NewRecorder()
+			err := o.Write(w, r, "export.csv", "text/csv", bytes.NewReader(tc.body), tc.size)
+			require.NoError(t, err)
+
+			if !tc.offload {
+				assert.Equal(t, http.StatusOK, w.Code)
+				assert.Equal(t, "text/csv", w.Header().Get(header.ContentType))
+				assert.Equal(t, tc.body, w.Body.Bytes())
+				return
+			}
+
+			assert.Equal(t, http.StatusSeeOther, w.Code)
+			loc := w.Header().Get(header.Location)
+			require.True(t, strings.HasPrefix(loc, "https://storage.local/exports/"), loc)
+			key := strings.TrimPrefix(strings.Split(loc, "?")[0], "https://storage.local/")
+			assert.True(t, strings.HasSuffix(key, "/export.csv"), key)
+
+			obj := store.objects[key]
+			require.NotNil(t, obj)
+			assert.Equal(t, tc.body, obj.data)
+			assert.Equal(t, "text/csv", obj.contentType)
+		})
+	}
+
+	t.Run("put_error", func(t *testing.T) {
+		store := newMockStore()
+		store.putErr = errors.New("access denied")
+		o := New(store, Config{Threshold: 10})
+		r := httptest.NewRequest(http.MethodGet, "/v1/export", nil)
+		w := httptest.NewRecorder()
+		err := o.Write(w, r, "export.csv", "text/csv", bytes.NewReader(large), -1)
+		assert.EqualError(t, err, "failed to offload payload: access denied")
+	})
+}
+
+func TestKey(t *testing.T) {
+	o := New(newMockStore(), Config{Prefix: "exports"})
+	assert.True(t, strings.HasSuffix(o.key("../../etc/passwd"), "/passwd"))
+	assert.True(t, strings.HasSuffix(o.key(""), "/payload"))
+	assert.True(t, strings.HasPrefix(o.key("a.csv"), "exports/"))
+}
+
+func TestCleanup(t *testing.T) {
+	store := newMockStore()
+	o := New(store, Config{Prefix: "exports", Retention: time.Hour})
+
+	now := time.Now()
+	store.objects["exports/old"] = &object{created: now.Add(-2 * time.Hour)}
+	store.objects["exports/new"] = &object{created: now}
+	store.objects["other/old"] = &object{created: now.Add(-2 * time.Hour)}
+
+	count, err := o.Cleanup(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Contains(t, store.objects, "exports/new")
+	assert.Contains(t, store.objects, "other/old")
+	assert.NotContains(t, store.objects, "exports/old")
+
+	task, err := o.CleanupTask("every 1 hour")
+	require.NoError(t, err)
+	assert.NotNil(t, task)
+	task.Run()
+
+	_, err = o.CleanupTask("invalid")
+	assert.Error(t, err)
+}
@@ -0,0 +1,190 @@
+// Package opsroutes provides the standard internal endpoints:
+// health and readiness probes, metrics, and pprof debug handlers,
+// registered in the router and in the authz rules from a single configuration,
+// so the probes are not broken by a missing authz rule.
+package opsroutes
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/restserver/authz"
+	"github.com/effective-security/porto/restserver/ready"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/porto/xhttp/marshal"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var logger = xlog.NewPackageLogger("github.com/effective-security/porto/restserver", "opsroutes")
+
+// Default paths of the endpoints
+const (
+	DefaultHealthPath  = "/healthz"
+	DefaultReadyPath   = "/readyz"
+	DefaultMetricsPath = "/metrics"
+	// DebugPath is the prefix of pprof endpoints
+	DebugPath = "/debug/pprof"
+)
+
+// Config provides configuration of the internal endpoints
+type Config struct {
+	// Enabled specifies if the internal endpoints are registered
+	Enabled *bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// HealthPath specifies the liveness probe path, default is DefaultHealthPath
+	HealthPath string `json:"health_path,omitempty" yaml:"health_path,omitempty"`
+	// ReadyPath specifies the readiness probe path, default is DefaultReadyPath
+	ReadyPath string `json:"ready_path,omitempty" yaml:"ready_path,omitempty"`
+	// MetricsPath specifies the Prometheus metrics path, default is DefaultMetricsPath,
+	// the metrics endpoint is not registered if set to "-"
+	MetricsPath string `json:"metrics_path,omitempty" yaml:"metrics_path,omitempty"`
+	// MetricsRoles specifies the roles allowed to scrape the metrics,
+	// if empty then any request is allowed
+	MetricsRoles []string `json:"metrics_roles,omitempty" yaml:"metrics_roles,omitempty"`
+	// Debug specifies to register pprof endpoints under DebugPath
+	Debug bool `json:"debug,omitempty" yaml:"debug,omitempty"`
+	// DebugRoles specifies the roles allowed to access pprof endpoints,
+	// required if Debug is enabled
+	DebugRoles []string `json:"debug_roles,omitempty" yaml:"debug_roles,omitempty"`
+}
+
+// GetEnabled specifies if the internal endpoints are enabled
+func (c *Config) GetEnabled() bool {
+	return c != nil && c.Enabled != nil && *c.Enabled
+}
+
+// GetHealthPath returns the liveness probe path
+func (c *Config) GetHealthPath() string {
+	if c == nil || c.HealthPath == "" {
+		return DefaultHealthPath
+	}
+	return c.HealthPath
+}
+
+// GetReadyPath returns the readiness probe path
+func (c *Config) GetReadyPath() string {
+	if c == nil || c.ReadyPath == "" {
+		return DefaultReadyPath
+	}
+	return c.ReadyPath
+}
+
+// GetMetricsPath returns the metrics path, or empty if disabled
+func (c *Config) GetMetricsPath() string {
+	if c == nil || c.MetricsPath == "" {
+		return DefaultMetricsPath
+	}
+	if c.MetricsPath == "-" {
+		return ""
+	}
+	return c.MetricsPath
+}
+
+// Validate returns error if the configuration is not valid
+func (c *Config) Validate() error {
+	if !c.GetEnabled() {
+		return nil
+	}
+	if c.Debug && len(c.DebugRoles) == 0 {
+		return errors.New("opsroutes: debug_roles are required for debug endpoints")
+	}
+	for _, p := range []string{c.HealthPath, c.ReadyPath, c.MetricsPath} {
+		if p != "" && p != "-" && !strings.HasPrefix(p, "/") {
+			return errors.Errorf("opsroutes: invalid path: %q", p)
+		}
+	}
+	return nil
+}
+
+// Allow adds the rules for the internal endpoints to the authz provider:
+// the probes are allowed for any request,
+// the metrics and debug endpoints are allowed for the configured roles
+func (c *Config) Allow(az *authz.Provider) {
+	if !c.GetEnabled() || az == nil {
+		return
+	}
+	az.AllowAny(c.GetHealthPath())
+	az.AllowAny(c.GetReadyPath())
+	if p := c.GetMetricsPath(); p != "" {
+		if len(c.MetricsRoles) > 0 {
+			az.Allow(p, c.MetricsRoles...)
+		} else {
+			az.AllowAny(p)
+		}
+	}
+	if c.Debug {
+		az.Allow(DebugPath, c.DebugRoles...)
+	}
+}
+
+// Register adds the internal endpoints to the router,
+// the readiness probe reports the status of the server
+func (c *Config) Register(r restserver.Router, status ready.ServiceStatus) {
+	if !c.GetEnabled() {
+		return
+	}
+	logger.KV(xlog.NOTICE,
+		"health", c.GetHealthPath(),
+		"ready", c.GetReadyPath(),
+		"metrics", c.GetMetricsPath(),
+		"debug", c.Debug)
+
+	r.GET(c.GetHealthPath(), health)
+	r.GET(c.GetReadyPath(), readiness(status))
+	if p := c.GetMetricsPath(); p != "" {
+		h := promhttp.Handler()
+		r.GET(p, func(w http.ResponseWriter, r *http.Request, _ restserver.Params) {
+			h.ServeHTTP(w, r)
+		})
+	}
+	if c.Debug {
+		RegisterDebug(r)
+	}
+}
+
+// RegisterDebug adds pprof endpoints under DebugPath to the router,
+// the access must be restricted by authz
+func RegisterDebug(r restserver.Router) {
+	r.GET(DebugPath+"/*profile", debug)
+	r.POST(DebugPath+"/symbol", func(w http.ResponseWriter, r *http.Request, _ restserver.Params) {
+		pprof.Symbol(w, r)
+	})
+}
+
+// StatusResponse is the response of the probes
+type StatusResponse struct {
+	Status string `json:"status"`
+}
+
+func health(w http.ResponseWriter, r *http.Request, _ restserver.Params) {
+	marshal.WriteJSON(w, r, &StatusResponse{Status: "ok"})
+}
+
+func readiness(status ready.ServiceStatus) restserver.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ restserver.Params) {
+		if status != nil && !status.IsReady() {
+			marshal.WriteJSON(w, r, httperror.NotReady("the service is not ready yet"))
+			return
+		}
+		marshal.WriteJSON(w, r, &StatusResponse{Status: "ok"})
+	}
+}
+
+func debug(w http.ResponseWriter, r *http.Request, p restserver.Params) {
+	switch strings.TrimPrefix(p.ByName("profile"), "/") {
+	case "cmdline":
+		pprof.Cmdline(w, r)
+	case "profile":
+		pprof.Profile(w, r)
+	case "symbol":
+		pprof.Symbol(w, r)
+	case "trace":
+		pprof.Trace(w, r)
+	default:
+		// pprof.Index serves the named profiles by the path under /debug/pprof/
+		pprof.Index(w, r)
+	}
+}
@@ -0,0 +1,116 @@
+package opsroutes_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/restserver/authz"
+	"github.com/effective-security/porto/restserver/opsroutes"
+	"github.com/effective-security/porto/xhttp/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type status bool
+
+func (s status) IsReady() bool { return bool(s) }
+
+func TestConfig(t *testing.T) {
+	var nilCfg *opsroutes.Config
+	assert.False(t, nilCfg.GetEnabled())
+	assert.Equal(t, opsroutes.DefaultHealthPath, nilCfg.GetHealthPath())
+	assert.Equal(t, opsroutes.DefaultReadyPath, nilCfg.GetReadyPath())
+	assert.Equal(t, opsroutes.DefaultMetricsPath, nilCfg.GetMetricsPath())
+	assert.NoError(t, nilCfg.Validate())
+
+	enabled := true
+	cfg := &opsroutes.Config{
+		Enabled:     &enabled,
+		HealthPath:  "/v1/status/live",
+		ReadyPath:   "/v1/status/ready",
+		MetricsPath: "-",
+	}
+	assert.Equal(t, "/v1/status/live", cfg.GetHealthPath())
+	assert.Equal(t, "/v1/status/ready", cfg.GetReadyPath())
+	assert.Empty(t, cfg.GetMetricsPath())
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Debug = true
+	assert.EqualError(t, cfg.Validate(), "opsroutes: debug_roles are required for debug endpoints")
+	cfg.DebugRoles = []string{"admin"}
+	cfg.HealthPath = "healthz"
+	assert.EqualError(t, cfg.Validate(), `opsroutes: invalid path: "healthz"`)
+}
+
+func TestRegister(t *testing.T) {
+	enabled := true
+	cfg := &opsroutes.Config{
+		Enabled:      &enabled,
+		MetricsRoles: []string{"monitor"},
+		Debug:        true,
+		DebugRoles:   []string{"admin"},
+	}
+	require.NoError(t, cfg.Validate())
+
+	az, err := authz.New(&authz.Config{})
+	require.NoError(t, err)
+	cfg.Allow(az)
+
+	assert.True(t, az.Requirement("/healthz").AllowAny)
+	assert.True(t, az.Requirement("/readyz").AllowAny)
+	assert.Equal(t, []string{"monitor"}, az.Requirement("/metrics").Roles)
+	assert.Equal(t, []string{"admin"}, az.Requirement("/debug/pprof/heap").Roles)
+
+	isReady := status(false)
+	router := restserver.NewRouter(nil)
+	cfg.Register(router, &isReady)
+	handler, err := az.NewHandler(router.Handler())
+	require.NoError(t, err)
+
+	serve := func(role, method, path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		if role != "" {
+			r = identity.WithTestIdentity(r, identity.NewIdentity(role, "alice", "", nil, "", ""))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve("", http.MethodGet, "/healthz")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"ok"`)
+
+	w = serve("", http.MethodGet, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	isReady = true
+	w = serve("", http.MethodGet, "/readyz")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, http.StatusUnauthorized, serve("user", http.MethodGet, "/metrics").Code)
+	w = serve("monitor", http.MethodGet, "/metrics")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "go_goroutines")
+
+	assert.Equal(t, http.StatusUnauthorized, serve("monitor", http.MethodGet, "/debug/pprof/heap").Code)
+	assert.Equal(t, http.StatusOK, serve("admin", http.MethodGet, "/debug/pprof/").Code)
+	assert.Equal(t, http.StatusOK, serve("admin", http.MethodGet, "/debug/pprof/cmdline").Code)
+	assert.Equal(t, http.StatusOK, serve("admin", http.MethodGet, "/debug/pprof/goroutine?debug=1").Code)
+	assert.Equal(t, http.StatusOK, serve("admin", http.MethodGet, "/debug/pprof/symbol").Code)
+}
+
+func TestDisabled(t *testing.T) {
+	cfg := &opsroutes.Config{}
+	az, err := authz.New(&authz.Config{})
+	require.NoError(t, err)
+	cfg.Allow(az)
+	assert.False(t, az.Requirement("/healthz").AllowAny)
+
+	router := restserver.NewRouter(http.NotFound)
+	cfg.Register(router, nil)
+	w := httptest.NewRecorder()
+	router.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,202 @@
+package restserver
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/porto/xhttp/marshal"
+	"github.com/effective-security/porto/xhttp/urlpath"
+)
+
+// PathMode specifies how the Router handles a request path,
+// that does not match a route but matches it after normalization
+type PathMode int
+
+const (
+	// PathRedirect redirects the client to the matching route path,
+	// the redirected request goes through all middleware again
+	PathRedirect PathMode = iota
+	// PathRewrite serves the matching route without redirect.
+	// Note that the middleware, like authz, sees the original path,
+	// and must apply the same normalization.
+	PathRewrite
+	// PathStrict does not normalize the path
+	PathStrict
+)
+
+// WithTrailingSlash specifies how to handle /foo/ when only /foo is registered,
+// and vice versa. Default is PathRedirect.
+func WithTrailingSlash(mode PathMode) RouterOption {
+	return newRouterFuncOption(func(o *routerOptions) {
+		o.trailingSlash = mode
+	})
+}
+
+// WithCleanPath specifies how to handle paths with duplicate slashes
+// and dot segments, like /foo//bar or /foo/../bar. Default is PathRedirect.
+func WithCleanPath(mode PathMode) RouterOption {
+	return newRouterFuncOption(func(o *routerOptions) {
+		o.cleanPath = mode
+	})
+}
+
+// WithCaseInsensitive specifies how to handle paths that match
+// a route case-insensitively. Default is PathRedirect.
+// With PathRewrite, authz must be configured with CaseInsensitive.
+func WithCaseInsensitive(mode PathMode) RouterOption {
+	return newRouterFuncOption(func(o *routerOptions) {
+		o.caseInsensitive = mode
+	})
+}
+
+// WithRejectSuspiciousPath specifies to reject requests with encoded slashes,
+// backslashes or dots, double encoding, or dot segments in the path
+func WithRejectSuspiciousPath(enable bool) RouterOption {
+	return newRouterFuncOption(func(o *routerOptions) {
+		o.rejectSuspicious = enable
+	})
+}
+
+// normalize serves the normalized path, if the request path does not match
+// a route, returns false if the request was not handled
+func (p *proxy) normalize(w http.ResponseWriter, r *http.Request) bool {
+	if p.opts.rejectSuspicious {
+		if err := urlpath.CheckSuspicious(r.URL.EscapedPath()); err != nil {
+			marshal.WriteJSON(w, r, httperror.InvalidRequest("invalid path: %s", err.Error()).WithContext(r.Context()))
+			return true
+		}
+	}
+
+	path := r.URL.Path
+	if path == "/" || p.exists(path) {
+		return false
+	}
+
+	fixed, mode, ok := p.fixPath(path)
+	if !ok {
+		return false
+	}
+
+	if mode == PathRewrite {
+		r.URL.Path = fixed
+		r.URL.RawPath = ""
+		p.serve(w, r)
+		return true
+	}
+
+	code := http.StatusMovedPermanently
+	if r.Method != http.MethodGet {
+		code = http.StatusTemporaryRedirect
+	}
+	u := *r.URL
+	u.Path = fixed
+	u.RawPath = ""
+	http.Redirect(w, r, u.String(), code)
+	return true
+}
+
+// fixPath returns the path of the matching route,
+// and the effective mode of applied normalizations
+func (p *proxy) fixPath(path string) (string, PathMode, bool) {
+	mode := PathRewrite
+	apply := func(m PathMode) {
+		if m == PathRedirect {
+			mode = PathRedirect
+		}
+	}
+
+	if p.opts.cleanPath != PathStrict {
+		if cleaned := urlpath.Clean(path); cleaned != path {
+			path = cleaned
+			apply(p.opts.cleanPath)
+			if p.exists(path) {
+				return path, mode, true
+			}
+		}
+	}
+
+	candidates := []string{path}
+	if p.opts.trailingSlash != PathStrict {
+		toggled := toggleTrailingSlash(path)
+		if p.exists(toggled) {
+			apply(p.opts.trailingSlash)
+			return toggled, mode, true
+		}
+		candidates = append(candidates, toggled)
+	}
+
+	if p.opts.caseInsensitive != PathStrict {
+		for i, candidate := range candidates {
+			if fixed, ok := p.findCaseInsensitive(candidate); ok {
+				apply(p.opts.caseInsensitive)
+				if i > 0 {
+					apply(p.opts.trailingSlash)
+				}
+				return fixed, mode, true
+			}
+		}
+	}
+	return "", mode, false
+}
+
+// exists returns true if the path matches a route for any method
+func (p *proxy) exists(path string) bool {
+	for _, method := range allowMethods {
+		if h, _, _ := p.router.Lookup(method, path); h != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// findCaseInsensitive returns the path with static segments
+// of the matching route, and the original values of parameters
+func (p *proxy) findCaseInsensitive(path string) (string, bool) {
+	segs := strings.Split(path, "/")
+	for _, route := range p.Routes() {
+		if fixed, ok := matchCaseInsensitive(route.Path, segs); ok {
+			return fixed, true
+		}
+	}
+	return "", false
+}
+
+func matchCaseInsensitive(pattern string, segs []string) (string, bool) {
+	psegs := strings.Split(pattern, "/")
+	res := make([]string, 0, len(segs))
+	for i, pseg := range psegs {
+		if strings.HasPrefix(pseg, "*") {
+			if i >= len(segs) {
+				return "", false
+			}
+			res = append(res, segs[i:]...)
+			return strings.Join(res, "/"), true
+		}
+		if i >= len(segs) {
+			return "", false
+		}
+		switch {
+		case strings.HasPrefix(pseg, ":"):
+			if segs[i] == "" {
+				return "", false
+			}
+			res = append(res, segs[i])
+		case strings.EqualFold(pseg, segs[i]):
+			res = append(res, pseg)
+		default:
+			return "", false
+		}
+	}
+	if len(psegs) != len(segs) {
+		return "", false
+	}
+	return strings.Join(res, "/"), true
+}
+
+func toggleTrailingSlash(path string) string {
+	if len(path) > 1 && strings.HasSuffix(path, "/") {
+		return path[:len(path)-1]
+	}
+	return path + "/"
+}
@@ -0,0 +1,114 @@
+package restserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	rest "github.com/effective-security/porto/restserver"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RouterPathNormalization(t *testing.T) {
+	handle := func(w http.ResponseWriter, r *http.Request, p rest.Params) {
+		_, _ = w.Write([]byte(r.URL.Path + "|" + p.ByName("id") + p.ByName("rest")))
+	}
+	newRouter := func(opts ...rest.RouterOption) http.Handler {
+		router := rest.NewRouter(notFoundHandler, opts...)
+		router.GET("/v1/Items/:id", handle)
+		router.POST("/v1/items", handle)
+		router.GET("/v1/dir/", handle)
+		router.GET("/v1/files/*rest", handle)
+		return router.Handler()
+	}
+	call := func(h http.Handler, method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	t.Run("redirect", func(t *testing.T) {
+		h := newRouter()
+		tcases := []struct {
+			method, path, exp string
+			code              int
+		}{
+			{http.MethodGet, "/v1/Items/1/", "/v1/Items/1", http.StatusMovedPermanently},
+			{http.MethodPost, "/v1/items/", "/v1/items", http.StatusTemporaryRedirect},
+			{http.MethodGet, "/v1/dir", "/v1/dir/", http.StatusMovedPermanently},
+			{http.MethodGet, "/v1//Items/1", "/v1/Items/1", http.StatusMovedPermanently},
+			{http.MethodGet, "/v1/x/../Items/1", "/v1/Items/1", http.StatusMovedPermanently},
+			{http.MethodGet, "/V1/ITEMS/AbC", "/v1/Items/AbC", http.StatusMovedPermanently},
+			{http.MethodGet, "/V1/ITEMS/AbC/", "/v1/Items/AbC", http.StatusMovedPermanently},
+			{http.MethodGet, "/V1/Files/A/b", "/v1/files/A/b", http.StatusMovedPermanently},
+			{http.MethodGet, "/v1/Items/1?q=1", "", http.StatusOK},
+		}
+		for _, tc := range tcases {
+			w := call(h, tc.method, tc.path)
+			assert.Equal(t, tc.code, w.Code, tc.path)
+			if tc.exp != "" {
+				assert.Equal(t, tc.exp, w.Header().Get("Location"), tc.path)
+			}
+		}
+		assert.Equal(t, "/v1/Items/1?q=1", call(h, http.MethodGet, "/v1/Items//1?q=1").Header().Get("Location"))
+		assert.Equal(t, http.StatusNotFound, call(h, http.MethodGet, "/v1/other").Code)
+		assert.Equal(t, "/v1/files/", call(h, http.MethodGet, "/v1/files").Header().Get("Location"))
+	})
+
+	t.Run("rewrite", func(t *testing.T) {
+		h := newRouter(rest.WithTrailingSlash(rest.PathRewrite), rest.WithCleanPath(rest.PathRewrite), rest.WithCaseInsensitive(rest.PathRewrite))
+		tcases := []struct {
+			path, exp string
+		}{
+			{"/v1/Items/1/", "/v1/Items/1|1"},
+			{"/v1/dir", "/v1/dir/|"},
+			{"//v1//Items/1", "/v1/Items/1|1"},
+			{"/V1/ITEMS/AbC/", "/v1/Items/AbC|AbC"},
+			{"/V1/FILES/A/b", "/v1/files/A/b|/A/b"},
+		}
+		for _, tc := range tcases {
+			w := call(h, http.MethodGet, tc.path)
+			assert.Equal(t, http.StatusOK, w.Code, tc.path)
+			assert.Equal(t, tc.exp, w.Body.String(), tc.path)
+		}
+		// 405 after normalization
+		w := call(h, http.MethodDelete, "/v1/items/")
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Equal(t, "OPTIONS, POST", w.Header().Get("Allow"))
+	})
+
+	t.Run("mixed", func(t *testing.T) {
+		h := newRouter(rest.WithTrailingSlash(rest.PathRewrite), rest.WithCaseInsensitive(rest.PathRedirect))
+		assert.Equal(t, http.StatusOK, call(h, http.MethodGet, "/v1/Items/1/").Code)
+		w := call(h, http.MethodGet, "/v1/items/1/")
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+		assert.Equal(t, "/v1/Items/1", w.Header().Get("Location"))
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		h := newRouter(rest.WithTrailingSlash(rest.PathStrict), rest.WithCleanPath(rest.PathStrict), rest.WithCaseInsensitive(rest.PathStrict))
+		for _, path := range []string{"/v1/Items/1/", "/v1/dir", "/v1//Items/1", "/v1/items/1"} {
+			assert.Equal(t, http.StatusNotFound, call(h, http.MethodGet, path).Code, path)
+		}
+		assert.Equal(t, http.StatusOK, call(h, http.MethodGet, "/v1/Items/1").Code)
+	})
+}
+
+func Test_RouterRejectSuspiciousPath(t *testing.T) {
+	router := rest.NewRouter(notFoundHandler, rest.WithRejectSuspiciousPath(true))
+	router.GET("/v1/items/:id", func(w http.ResponseWriter, r *http.Request, p rest.Params) {})
+	h := router.Handler()
+
+	for path, code := range map[string]int{
+		"/v1/items/1":           http.StatusOK,
+		"/v1/items/a%20b":       http.StatusOK,
+		"/v1/items/%2e%2e":      http.StatusBadRequest,
+		"/v1/items/a%2Fb":       http.StatusBadRequest,
+		"/v1/x/../items/1":      http.StatusBadRequest,
+		"/v1/admin/%2e%2e/item": http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, code, w.Code, path)
+	}
+}
@@ -0,0 +1,134 @@
+package ready
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/porto/xhttp/marshal"
+)
+
+const (
+	// DefaultRetryAfter is the default delay reported to load balancers
+	// when the service is degraded
+	DefaultRetryAfter = 5 * time.Second
+	// DefaultSampleInterval is the default interval to sample the scheduler latency
+	DefaultSampleInterval = 100 * time.Millisecond
+)
+
+// CodeDegraded is returned when the service is overloaded
+const CodeDegraded = "degraded"
+
+// LoadThresholds specifies the thresholds, when the service reports degraded status
+type LoadThresholds struct {
+	// MaxInFlight is the maximum number of concurrent requests,
+	// 0 to disable the check
+	MaxInFlight int64
+	// MaxLatency is the maximum scheduler latency,
+	// 0 to disable the check
+	MaxLatency time.Duration
+	// RetryAfter is the delay reported in Retry-After header,
+	// if not specified, DefaultRetryAfter is used
+	RetryAfter time.Duration
+}
+
+// LoadMonitor tracks the number of requests in flight and the scheduler latency,
+// and reports degraded status when the thresholds are crossed
+type LoadMonitor struct {
+	thresholds LoadThresholds
+	inFlight   atomic.Int64
+	latency    atomic.Int64
+}
+
+// NewLoadMonitor returns LoadMonitor
+func NewLoadMonitor(thresholds LoadThresholds) *LoadMonitor {
+	if thresholds.RetryAfter <= 0 {
+		thresholds.RetryAfter = DefaultRetryAfter
+	}
+	return &LoadMonitor{
+		thresholds: thresholds,
+	}
+}
+
+// InFlight returns the number of requests in flight
+func (m *LoadMonitor) InFlight() int64 {
+	return m.inFlight.Load()
+}
+
+// Latency returns the last sampled scheduler latency
+func (m *LoadMonitor) Latency() time.Duration {
+	return time.Duration(m.latency.Load())
+}
+
+// Degraded returns true and the reason, if the thresholds are crossed
+func (m *LoadMonitor) Degraded() (bool, string) {
+	t := m.thresholds
+	if n := m.InFlight(); t.MaxInFlight > 0 && n > t.MaxInFlight {
+		return true, fmt.Sprintf("requests in flight %d exceed %d", n, t.MaxInFlight)
+	}
+	if l := m.Latency(); t.MaxLatency > 0 && l > t.MaxLatency {
+		return true, fmt.Sprintf("scheduler latency %v exceeds %v", l, t.MaxLatency)
+	}
+	return false, ""
+}
+
+// Handler returns http.Handler that tracks the requests in flight
+func (m *LoadMonitor) Handler(delegate http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.inFlight.Add(1)
+		defer m.inFlight.Add(-1)
+		delegate.ServeHTTP(w, r)
+	})
+}
+
+// Run samples the scheduler latency until the context is cancelled.
+// The latency is the delay of the timer firing after the interval,
+// that grows when the goroutines are starving for CPU.
+func (m *LoadMonitor) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultSampleInterval
+	}
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	expected := time.Now().Add(interval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-timer.C:
+			delay := now.Sub(expected)
+			if delay < 0 {
+				delay = 0
+			}
+			m.latency.Store(int64(delay))
+			expected = time.Now().Add(interval)
+			timer.Reset(interval)
+		}
+	}
+}
+
+// NewLoadStatusVerifier returns http.Handler that responds
+// with 429 and Retry-After header on the specified probe paths,
+// when the monitor reports degraded status, otherwise chains the delegate handler.
+// The load balancers should back off from the instance on such response.
+func NewLoadStatusVerifier(m *LoadMonitor, paths []string, delegate http.Handler) http.Handler {
+	probes := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		probes[p] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if probes[r.URL.Path] {
+			if degraded, reason := m.Degraded(); degraded {
+				marshal.WriteJSON(w, r, httperror.New(http.StatusTooManyRequests, CodeDegraded, "the service is degraded: %s", reason).
+					WithContext(r.Context()).
+					WithRetryAfter(m.thresholds.RetryAfter))
+				return
+			}
+		}
+		delegate.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,83 @@
+package ready
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_LoadStatusVerifier(t *testing.T) {
+	m := NewLoadMonitor(LoadThresholds{
+		MaxInFlight: 1,
+		MaxLatency:  time.Second,
+		RetryAfter:  3 * time.Second,
+	})
+
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	delegate := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started <- struct{}{}
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	h := m.Handler(NewLoadStatusVerifier(m, []string{"/readyz"}, delegate))
+
+	call := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, call("/readyz").Code)
+
+	for i := 0; i < 2; i++ {
+		go call("/slow")
+		<-started
+	}
+	assert.Equal(t, int64(2), m.InFlight())
+
+	w := call("/readyz")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "3", w.Header().Get(header.RetryAfter))
+	assert.Contains(t, w.Body.String(), `"code":"degraded"`)
+	assert.Contains(t, w.Body.String(), "requests in flight 3 exceed 1")
+	// other paths are served
+	assert.Equal(t, http.StatusOK, call("/v1/status").Code)
+
+	close(release)
+	require.Eventually(t, func() bool { return m.InFlight() == 0 }, time.Second, time.Millisecond)
+	assert.Equal(t, http.StatusOK, call("/readyz").Code)
+
+	m.latency.Store(int64(2 * time.Second))
+	degraded, reason := m.Degraded()
+	assert.True(t, degraded)
+	assert.Equal(t, "scheduler latency 2s exceeds 1s", reason)
+	assert.Equal(t, http.StatusTooManyRequests, call("/readyz").Code)
+}
+
+func Test_LoadMonitorRun(t *testing.T) {
+	m := NewLoadMonitor(LoadThresholds{})
+	assert.Equal(t, DefaultRetryAfter, m.thresholds.RetryAfter)
+
+	m.latency.Store(-1)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Run(ctx, time.Millisecond)
+	}()
+	require.Eventually(t, func() bool { return m.Latency() >= 0 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	degraded, _ := m.Degraded()
+	assert.False(t, degraded)
+}
@@ -0,0 +1,353 @@
+// Package respcache provides the middleware to cache successful GET responses
+// of expensive endpoints in cache.Provider, like Redis.
+//
+// The responses are cached per path, query, Accept header, and the caller's
+// tenant and subject. The cache status is reported in X-Cache-Status header:
+// HIT, MISS or BYPASS.
+package respcache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/effective-security/porto/pkg/cache"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/reqctx"
+	"github.com/effective-security/porto/xhttp/urlpath"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+var logger = xlog.NewPackageLogger("github.com/effective-security/porto/restserver", "respcache")
+
+// Cache status values of X-Cache-Status header
+const (
+	StatusHit    = "HIT"
+	StatusMiss   = "MISS"
+	StatusBypass = "BYPASS"
+)
+
+const (
+	// DefaultMaxBodySize is the default maximum size of the cached response body
+	DefaultMaxBodySize = 1024 * 1024
+	// DefaultLockTTL is the default TTL of the lock, held while the response is produced
+	DefaultLockTTL = 10 * time.Second
+	// DefaultLockWait is the default time to wait for the response
+	// produced by the lock holder
+	DefaultLockWait = 5 * time.Second
+
+	keyPrefix    = "respcache"
+	pollInterval = 50 * time.Millisecond
+)
+
+// headers that are not cached
+var skipHeaders = map[string]bool{
+	http.CanonicalHeaderKey(header.XCacheStatus):   true,
+	http.CanonicalHeaderKey(header.XCorrelationID): true,
+	header.Date:  true,
+	header.Age:   true,
+	"Connection": true,
+}
+
+// Route specifies the cached route
+type Route struct {
+	// Path of the route, or prefix ending with /*
+	Path string `json:"path" yaml:"path"`
+	// TTL of the cached response
+	TTL time.Duration `json:"ttl" yaml:"ttl"`
+}
+
+// Match returns true if the route matches the path
+func (r *Route) Match(p string) bool {
+	if prefix, ok := strings.CutSuffix(r.Path, "/*"); ok {
+		return p == prefix || strings.HasPrefix(p, prefix+"/")
+	}
+	return p == r.Path
+}
+
+// Config provides configuration of the response cache
+type Config struct {
+	// Routes specifies the cached routes
+	Routes []*Route `json:"routes" yaml:"routes"`
+	// MaxBodySize specifies the maximum size of the cached response body,
+	// default is DefaultMaxBodySize
+	MaxBodySize int `json:"max_body_size,omitempty" yaml:"max_body_size,omitempty"`
+	// LockTTL specifies TTL of the lock, default is DefaultLockTTL
+	LockTTL time.Duration `json:"lock_ttl,omitempty" yaml:"lock_ttl,omitempty"`
+	// LockWait specifies the time to wait for the response,
+	// produced by the concurrent request, default is DefaultLockWait
+	LockWait time.Duration `json:"lock_wait,omitempty" yaml:"lock_wait,omitempty"`
+}
+
+// entry is the cached response
+type entry struct {
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header"`
+	Body     []byte      `json:"body"`
+	StoredAt time.Time   `json:"stored_at"`
+}
+
+// Cache provides the response cache
+type Cache struct {
+	cfg    Config
+	prov   cache.Provider
+	locker cache.Locker
+}
+
+// New returns Cache, if the provider implements cache.Locker,
+// then the concurrent requests for the same response wait for the lock holder
+func New(prov cache.Provider, cfg Config) *Cache {
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = DefaultMaxBodySize
+	}
+	if cfg.LockTTL <= 0 {
+		cfg.LockTTL = DefaultLockTTL
+	}
+	if cfg.LockWait <= 0 {
+		cfg.LockWait = DefaultLockWait
+	}
+	c := &Cache{
+		cfg:  cfg,
+		prov: prov,
+	}
+	c.locker, _ = prov.(cache.Locker)
+	return c
+}
+
+// Invalidate removes the cached responses for the paths,
+// for all queries and callers
+func (c *Cache) Invalidate(ctx context.Context, paths ...string) error {
+	gen := strconv.FormatInt(time.Now().UnixNano(), 36)
+	for _, p := range paths {
+		if err := c.prov.Set(ctx, genKey(urlpath.Clean(p)), gen, cache.KeepTTL); err != nil {
+			return errors.WithMessagef(err, "failed to invalidate %s", p)
+		}
+	}
+	return nil
+}
+
+// Handler returns the handler that serves the cached responses
+func (c *Cache) Handler(delegate http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			delegate.ServeHTTP(w, r)
+			return
+		}
+		p := urlpath.Clean(r.URL.Path)
+		route := c.match(p)
+		if route == nil {
+			delegate.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		if noCache(r.Header.Get(header.CacheControl)) {
+			w.Header().Set(header.XCacheStatus, StatusBypass)
+			delegate.ServeHTTP(w, r)
+			return
+		}
+
+		key, err := c.key(ctx, r, p)
+		if err != nil {
+			logger.ContextKV(ctx, xlog.WARNING, "path", p, "err", err.Error())
+			w.Header().Set(header.XCacheStatus, StatusBypass)
+			delegate.ServeHTTP(w, r)
+			return
+		}
+
+		if c.serveCached(ctx, w, key) {
+			return
+		}
+
+		// stampede protection: only the lock holder produces the response,
+		// others wait for it to be cached
+		lockKey := key + ".lock"
+		locked := false
+		if c.locker != nil {
+			locked, err = c.locker.SetNX(ctx, lockKey, "1", c.cfg.LockTTL)
+			if err != nil {
+				logger.ContextKV(ctx, xlog.WARNING, "reason", "lock", "path", p, "err", err.Error())
+			} else if locked {
+				// release the lock, even if the handler panics
+				defer func() {
+					_ = c.prov.Delete(ctx, lockKey)
+				}()
+			} else if c.wait(ctx, w, key, lockKey) {
+				return
+			}
+		}
+
+		w.Header().Set(header.XCacheStatus, StatusMiss)
+		rec := &recorder{ResponseWriter: w, max: c.cfg.MaxBodySize}
+		delegate.ServeHTTP(rec, r)
+
+		if rec.cacheable() {
+			e := &entry{
+				Status:   rec.status,
+				Header:   rec.header,
+				Body:     rec.body.Bytes(),
+				StoredAt: time.Now().UTC(),
+			}
+			if err = c.prov.Set(ctx, key, e, route.TTL); err != nil {
+				logger.ContextKV(ctx, xlog.WARNING, "reason", "set", "path", p, "err", err.Error())
+			}
+		}
+	})
+}
+
+func (c *Cache) match(p string) *Route {
+	for _, r := range c.cfg.Routes {
+		if r.Match(p) {
+			return r
+		}
+	}
+	return nil
+}
+
+// key returns the cache key of the request
+func (c *Cache) key(ctx context.Context, r *http.Request, p string) (string, error) {
+	var gen string
+	err := c.prov.Get(ctx, genKey(p), &gen)
+	if err != nil && !cache.IsNotFoundError(err) {
+		return "", err
+	}
+
+	idn := reqctx.Identity(ctx)
+	h := sha256.New()
+	for _, v := range []string{
+		p,
+		r.URL.Query().Encode(),
+		r.Header.Get(header.Accept),
+		idn.Tenant(),
+		idn.Subject(),
+		gen,
+	} {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+	return path.Join(keyPrefix, "entry", hex.EncodeToString(h.Sum(nil))), nil
+}
+
+func genKey(p string) string {
+	return path.Join(keyPrefix, "gen", p)
+}
+
+// serveCached writes the cached response, and returns true if found
+func (c *Cache) serveCached(ctx context.Context, w http.ResponseWriter, key string) bool {
+	var e entry
+	if err := c.prov.Get(ctx, key, &e); err != nil {
+		if !cache.IsNotFoundError(err) {
+			logger.ContextKV(ctx, xlog.WARNING, "reason", "get", "err", err.Error())
+		}
+		return false
+	}
+
+	hdr := w.Header()
+	for k, v := range e.Header {
+		if _, exists := hdr[k]; !exists {
+			hdr[k] = v
+		}
+	}
+	hdr.Set(header.XCacheStatus, StatusHit)
+	hdr.Set(header.Age, strconv.Itoa(int(time.Since(e.StoredAt).Seconds())))
+	w.WriteHeader(e.Status)
+	_, _ = w.Write(e.Body)
+	return true
+}
+
+// wait waits for the response to be cached by the lock holder,
+// and returns true if the cached response was served.
+// It stops waiting when the lock is released without the response cached.
+func (c *Cache) wait(ctx context.Context, w http.ResponseWriter, key, lockKey string) bool {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.LockWait)
+	defer cancel()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+			if c.serveCached(ctx, w, key) {
+				return true
+			}
+			if !c.isLocked(ctx, lockKey) {
+				// the holder may have cached the response just before the release
+				return c.serveCached(ctx, w, key)
+			}
+		}
+	}
+}
+
+// isLocked returns true if the lock is held
+func (c *Cache) isLocked(ctx context.Context, lockKey string) bool {
+	var v string
+	err := c.prov.Get(ctx, lockKey, &v)
+	return err == nil || !cache.IsNotFoundError(err)
+}
+
+func noCache(cc string) bool {
+	cc = strings.ToLower(cc)
+	return strings.Contains(cc, "no-cache") || strings.Contains(cc, "no-store")
+}
+
+// recorder writes the response, and captures it for caching
+type recorder struct {
+	http.ResponseWriter
+	max      int
+	status   int
+	header   http.Header
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+		r.header = make(http.Header)
+		for k, v := range r.ResponseWriter.Header() {
+			if !skipHeaders[k] {
+				r.header[k] = append([]string(nil), v...)
+			}
+		}
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	if !r.overflow {
+		if r.body.Len()+len(b) > r.max {
+			r.overflow = true
+			r.body.Reset()
+		} else {
+			r.body.Write(b)
+		}
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush sends any buffered data to the client.
+func (r *recorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// cacheable returns true if the response can be cached
+func (r *recorder) cacheable() bool {
+	return r.status == http.StatusOK &&
+		!r.overflow &&
+		r.header.Get(header.SetCookie) == "" &&
+		!strings.Contains(strings.ToLower(r.header.Get(header.CacheControl)), "no-store")
+}
@@ -0,0 +1,188 @@
+package respcache_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/cache"
+	"github.com/effective-security/porto/restserver/respcache"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	var count int32
+	delegate := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&count, 1)
+		switch r.URL.Path {
+		case "/v1/cookie":
+			w.Header().Set(header.SetCookie, "a=b")
+		case "/v1/large":
+			_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+			return
+		case "/v1/error":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		case "/v1/slow":
+			time.Sleep(100 * time.Millisecond)
+		}
+		w.Header().Set(header.ContentType, header.ApplicationJSON)
+		w.Header().Set(header.XCorrelationID, "corr")
+		_, _ = w.Write([]byte(`{"n":` + string(rune('0'+n)) + `}`))
+	})
+
+	c := respcache.New(cache.NewMemoryProvider("test"), respcache.Config{
+		Routes: []*respcache.Route{
+			{Path: "/v1/items/*", TTL: time.Minute},
+			{Path: "/v1/cookie", TTL: time.Minute},
+			{Path: "/v1/large", TTL: time.Minute},
+			{Path: "/v1/error", TTL: time.Minute},
+			{Path: "/v1/slow", TTL: time.Minute},
+		},
+		MaxBodySize: 50,
+	})
+	h := c.Handler(delegate)
+
+	serve := func(method, path string, hdr map[string]string, id identity.Identity) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		for k, v := range hdr {
+			r.Header.Set(k, v)
+		}
+		if id != nil {
+			r = identity.WithTestIdentity(r, id)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	reset := func() { atomic.StoreInt32(&count, 0) }
+
+	w := serve(http.MethodGet, "/v1/items/1?b=2&a=1", nil, nil)
+	assert.Equal(t, respcache.StatusMiss, w.Header().Get(header.XCacheStatus))
+	assert.Equal(t, `{"n":1}`, w.Body.String())
+
+	// query order does not matter
+	w = serve(http.MethodGet, "/v1/items/1?a=1&b=2", nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, respcache.StatusHit, w.Header().Get(header.XCacheStatus))
+	assert.Equal(t, `{"n":1}`, w.Body.String())
+	assert.Equal(t, header.ApplicationJSON, w.Header().Get(header.ContentType))
+	assert.Empty(t, w.Header().Get(header.XCorrelationID))
+	assert.Equal(t, "0", w.Header().Get(header.Age))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+
+	// per identity
+	w = serve(http.MethodGet, "/v1/items/1?a=1&b=2", nil, identity.NewIdentity("user", "bob", "t1", nil, "", ""))
+	assert.Equal(t, respcache.StatusMiss, w.Header().Get(header.XCacheStatus))
+	w = serve(http.MethodGet, "/v1/items/1?a=1&b=2", nil, identity.NewIdentity("user", "bob", "t2", nil, "", ""))
+	assert.Equal(t, respcache.StatusMiss, w.Header().Get(header.XCacheStatus))
+	w = serve(http.MethodGet, "/v1/items/1?a=1&b=2", nil, identity.NewIdentity("user", "bob", "t1", nil, "", ""))
+	assert.Equal(t, respcache.StatusHit, w.Header().Get(header.XCacheStatus))
+
+	// bypass
+	w = serve(http.MethodGet, "/v1/items/1?a=1&b=2", map[string]string{header.CacheControl: "no-cache"}, nil)
+	assert.Equal(t, respcache.StatusBypass, w.Header().Get(header.XCacheStatus))
+	reset()
+	w = serve(http.MethodPost, "/v1/items/1", nil, nil)
+	assert.Empty(t, w.Header().Get(header.XCacheStatus))
+	w = serve(http.MethodGet, "/v1/other", nil, nil)
+	assert.Empty(t, w.Header().Get(header.XCacheStatus))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+
+	// invalidation
+	require.NoError(t, c.Invalidate(context.Background(), "/v1/items/1"))
+	w = serve(http.MethodGet, "/v1/items/1?a=1&b=2", nil, nil)
+	assert.Equal(t, respcache.StatusMiss, w.Header().Get(header.XCacheStatus))
+	w = serve(http.MethodGet, "/v1/items/1?a=1&b=2", nil, nil)
+	assert.Equal(t, respcache.StatusHit, w.Header().Get(header.XCacheStatus))
+
+	// not cacheable
+	for _, p := range []string{"/v1/cookie", "/v1/large", "/v1/error"} {
+		serve(http.MethodGet, p, nil, nil)
+		w = serve(http.MethodGet, p, nil, nil)
+		assert.Equal(t, respcache.StatusMiss, w.Header().Get(header.XCacheStatus), p)
+	}
+}
+
+func TestStampede(t *testing.T) {
+	var count int32
+	delegate := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		time.Sleep(100 * time.Millisecond)
+		_, _ = w.Write([]byte(`{}`))
+	})
+
+	c := respcache.New(cache.NewMemoryProvider("test"), respcache.Config{
+		Routes: []*respcache.Route{{Path: "/v1/slow", TTL: time.Minute}},
+	})
+	h := c.Handler(delegate)
+
+	var wg sync.WaitGroup
+	var hits int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/slow", nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+			if w.Header().Get(header.XCacheStatus) == respcache.StatusHit {
+				atomic.AddInt32(&hits, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+	assert.Equal(t, int32(9), atomic.LoadInt32(&hits))
+}
+
+func TestStampede_NotCacheable(t *testing.T) {
+	var count int32
+	delegate := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) == 1 && r.URL.Path == "/v1/panic" {
+			panic("test")
+		}
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	c := respcache.New(cache.NewMemoryProvider("test"), respcache.Config{
+		Routes:   []*respcache.Route{{Path: "/v1/error", TTL: time.Minute}, {Path: "/v1/panic", TTL: time.Minute}},
+		LockWait: 5 * time.Second,
+	})
+	h := c.Handler(delegate)
+
+	started := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/error", nil))
+			assert.Equal(t, http.StatusInternalServerError, w.Code)
+		}()
+	}
+	wg.Wait()
+	// waiters stop when the lock is released, without waiting for LockWait
+	assert.Less(t, time.Since(started), 2*time.Second)
+
+	// the lock is released when the handler panics
+	atomic.StoreInt32(&count, 0)
+	assert.Panics(t, func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/panic", nil))
+	})
+	started = time.Now()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/panic", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Less(t, time.Since(started), time.Second)
+}
@@ -2,7 +2,13 @@ package restserver
 
 import (
 	"net/http"
+	"strings"
+	"sync"
 
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/porto/xhttp/marshal"
+	"github.com/effective-security/porto/xhttp/reqctx"
 	"github.com/julienschmidt/httprouter"
 	"github.com/rs/cors"
 )
@@ -82,22 +88,138 @@ type Router interface {
 	CONNECT(path string, handle Handle)
 }
 
+// Route describes the registered route
+type Route struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
+// RouteLister provides the list of registered routes
+type RouteLister interface {
+	// Routes returns the registered routes, in the order of registration
+	Routes() []Route
+}
+
+// RouterOption configures the Router
+type RouterOption interface {
+	apply(*routerOptions)
+}
+
+type routerOptions struct {
+	autoHEAD         bool
+	autoOPTIONS      bool
+	noAutoHEAD       map[string]bool
+	noAutoOPTIONS    []string
+	methodOverride   map[string]bool
+	methodNotAllowed http.HandlerFunc
+	trailingSlash    PathMode
+	cleanPath        PathMode
+	caseInsensitive  PathMode
+	rejectSuspicious bool
+	suggestions      int
+}
+
+type routerFuncOption struct {
+	f func(*routerOptions)
+}
+
+func (fo *routerFuncOption) apply(o *routerOptions) {
+	fo.f(o)
+}
+
+func newRouterFuncOption(f func(*routerOptions)) *routerFuncOption {
+	return &routerFuncOption{
+		f: f,
+	}
+}
+
+// WithAutoHEAD specifies to derive HEAD handlers from GET handlers,
+// with suppressed response body. Enabled by default.
+func WithAutoHEAD(enable bool) RouterOption {
+	return newRouterFuncOption(func(o *routerOptions) {
+		o.autoHEAD = enable
+	})
+}
+
+// WithAutoOPTIONS specifies to answer OPTIONS requests
+// with Allow header of the registered methods. Enabled by default.
+func WithAutoOPTIONS(enable bool) RouterOption {
+	return newRouterFuncOption(func(o *routerOptions) {
+		o.autoOPTIONS = enable
+	})
+}
+
+// WithoutAutoHEAD disables HEAD handlers derivation for the specified routes
+func WithoutAutoHEAD(paths ...string) RouterOption {
+	return newRouterFuncOption(func(o *routerOptions) {
+		for _, path := range paths {
+			o.noAutoHEAD[path] = true
+		}
+	})
+}
+
+// WithoutAutoOPTIONS disables OPTIONS auto-handling for the specified routes
+func WithoutAutoOPTIONS(paths ...string) RouterOption {
+	return newRouterFuncOption(func(o *routerOptions) {
+		o.noAutoOPTIONS = append(o.noAutoOPTIONS, paths...)
+	})
+}
+
+// WithMethodOverride allows POST requests to override the method
+// with X-HTTP-Method-Override header, for constrained clients.
+// If methods are not specified, PUT, PATCH and DELETE are allowed.
+func WithMethodOverride(methods ...string) RouterOption {
+	return newRouterFuncOption(func(o *routerOptions) {
+		if len(methods) == 0 {
+			methods = []string{http.MethodPut, http.MethodPatch, http.MethodDelete}
+		}
+		o.methodOverride = map[string]bool{}
+		for _, m := range methods {
+			o.methodOverride[strings.ToUpper(m)] = true
+		}
+	})
+}
+
+// WithMethodNotAllowedHandler specifies the handler for requests,
+// when the path exists but the method does not.
+// The Allow header is set before the handler is called.
+func WithMethodNotAllowedHandler(handler http.HandlerFunc) RouterOption {
+	return newRouterFuncOption(func(o *routerOptions) {
+		o.methodNotAllowed = handler
+	})
+}
+
+// methods used to build Allow header
+var allowMethods = []string{
+	http.MethodConnect,
+	http.MethodDelete,
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodOptions,
+	http.MethodPatch,
+	http.MethodPost,
+	http.MethodPut,
+}
+
 type proxy struct {
 	router *httprouter.Router
 	cors   *cors.Cors
+	opts   routerOptions
+	// heads contains HEAD handlers derived from GET handlers
+	heads *httprouter.Router
+	// noOptions contains the routes excluded from OPTIONS auto-handling
+	noOptions *httprouter.Router
+	lock      sync.Mutex
+	routes    []Route
 }
 
 // NewRouter returns a new initialized Router.
-func NewRouter(notfoundhandler http.HandlerFunc) Router {
-	r := &proxy{
-		router: httprouter.New(),
-	}
-	r.router.NotFound = notfoundhandler
-	return r
+func NewRouter(notfoundhandler http.HandlerFunc, opts ...RouterOption) Router {
+	return newProxy(notfoundhandler, nil, opts)
 }
 
 // NewRouterWithCORS returns a new initialized Router with CORS enabled
-func NewRouterWithCORS(notfoundhandler http.HandlerFunc, opt *CORSOptions) Router {
+func NewRouterWithCORS(notfoundhandler http.HandlerFunc, opt *CORSOptions, opts ...RouterOption) Router {
 	var c *cors.Cors
 	if opt != nil {
 		c = cors.New(cors.Options{
@@ -116,63 +238,212 @@ func NewRouterWithCORS(notfoundhandler http.HandlerFunc, opt *CORSOptions) Route
 		c = cors.Default()
 	}
 
+	return newProxy(notfoundhandler, c, opts)
+}
+
+func newProxy(notfoundhandler http.HandlerFunc, c *cors.Cors, opts []RouterOption) *proxy {
+	dopts := routerOptions{
+		autoHEAD:    true,
+		autoOPTIONS: true,
+		noAutoHEAD:  map[string]bool{},
+	}
+	for _, opt := range opts {
+		opt.apply(&dopts)
+	}
+
 	r := &proxy{
-		router: httprouter.New(),
-		cors:   c,
+		router:    httprouter.New(),
+		cors:      c,
+		opts:      dopts,
+		heads:     httprouter.New(),
+		noOptions: httprouter.New(),
 	}
 	r.router.NotFound = notfoundhandler
+	// OPTIONS, 405 and path normalization are handled by the proxy
+	r.router.HandleOPTIONS = false
+	r.router.HandleMethodNotAllowed = false
+	r.router.RedirectTrailingSlash = false
+	r.router.RedirectFixedPath = false
+	for _, path := range dopts.noAutoOPTIONS {
+		r.noOptions.Handle(http.MethodOptions, path, func(http.ResponseWriter, *http.Request, httprouter.Params) {})
+	}
 	return r
 }
 
-func proxyHandle(handle Handle) httprouter.Handle {
+func proxyHandle(path string, handle Handle) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		r = r.WithContext(reqctx.RouteTemplate.WithValue(r.Context(), path))
 		handle(w, r, Params(p))
 	}
 }
 
+func (p *proxy) handle(method, path string, handle Handle) {
+	h := proxyHandle(path, handle)
+	p.router.Handle(method, path, h)
+	if method == http.MethodGet && p.opts.autoHEAD && !p.opts.noAutoHEAD[path] {
+		p.heads.Handle(http.MethodHead, path, func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			h(&headResponseWriter{ResponseWriter: w}, r, ps)
+		})
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.routes = append(p.routes, Route{Method: method, Path: path})
+}
+
+// Routes returns the registered routes, in the order of registration
+func (p *proxy) Routes() []Route {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]Route(nil), p.routes...)
+}
+
 func (p *proxy) Handler() http.Handler {
 	if p.cors != nil {
-		return p.cors.Handler(p.router)
+		return p.cors.Handler(p)
 	}
-	return p.router
+	return p
+}
+
+// ServeHTTP implements http.Handler
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.opts.methodOverride != nil && r.Method == http.MethodPost {
+		if m := r.Header.Get(header.XHTTPMethodOverride); m != "" {
+			m = strings.ToUpper(m)
+			if !p.opts.methodOverride[m] {
+				marshal.WriteJSON(w, r, httperror.InvalidRequest("method override is not allowed: %s", m))
+				return
+			}
+			r.Method = m
+			r.Header.Del(header.XHTTPMethodOverride)
+		}
+	}
+
+	if p.normalize(w, r) {
+		return
+	}
+	p.serve(w, r)
+}
+
+func (p *proxy) serve(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch r.Method {
+	case http.MethodHead:
+		if h, _, _ := p.router.Lookup(http.MethodHead, path); h == nil {
+			if h, ps, _ := p.heads.Lookup(http.MethodHead, path); h != nil {
+				h(w, r, ps)
+				return
+			}
+		}
+	case http.MethodOptions:
+		if h, _, _ := p.router.Lookup(http.MethodOptions, path); h == nil && p.opts.autoOPTIONS {
+			if skip, _, _ := p.noOptions.Lookup(http.MethodOptions, path); skip == nil {
+				if allow := p.allowed(path); allow != "" {
+					w.Header().Set(header.Allow, allow)
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+			}
+		}
+	}
+
+	if h, _, _ := p.router.Lookup(r.Method, path); h == nil {
+		if allow := p.allowed(path); allow != "" {
+			w.Header().Set(header.Allow, allow)
+			if p.opts.methodNotAllowed != nil {
+				p.opts.methodNotAllowed(w, r)
+			} else {
+				marshal.WriteJSON(w, r, httperror.MethodNotAllowed("method %s is not allowed", r.Method))
+			}
+			return
+		}
+		if p.opts.suggestions > 0 {
+			if list := p.suggest(path); len(list) > 0 {
+				marshal.WriteJSON(w, r, httperror.NotFound("%s", path).
+					WithErrorInfo("routes", map[string]string{
+						"suggestions": strings.Join(list, "; "),
+					}))
+				return
+			}
+		}
+	}
+	p.router.ServeHTTP(w, r)
+}
+
+// allowed returns the comma separated list of methods registered for the path
+func (p *proxy) allowed(path string) string {
+	found := false
+	for _, method := range allowMethods {
+		if method == http.MethodOptions {
+			continue
+		}
+		if h, _, _ := p.router.Lookup(method, path); h != nil {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return ""
+	}
+
+	var allowed []string
+	for _, method := range allowMethods {
+		h, _, _ := p.router.Lookup(method, path)
+		if h == nil && method == http.MethodHead {
+			h, _, _ = p.heads.Lookup(method, path)
+		}
+		if h != nil || method == http.MethodOptions {
+			allowed = append(allowed, method)
+		}
+	}
+	return strings.Join(allowed, ", ")
+}
+
+// headResponseWriter suppresses the response body
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w *headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
 }
 
 // GET is a shortcut for router.Handle("GET", path, handle)
 func (p *proxy) GET(path string, handle Handle) {
-	p.router.Handle("GET", path, proxyHandle(handle))
+	p.handle("GET", path, handle)
 }
 
 // HEAD is a shortcut for router.Handle("HEAD", path, handle)
 func (p *proxy) HEAD(path string, handle Handle) {
-	p.router.Handle("HEAD", path, proxyHandle(handle))
+	p.handle("HEAD", path, handle)
 }
 
 // OPTIONS is a shortcut for router.Handle("OPTIONS", path, handle)
 func (p *proxy) OPTIONS(path string, handle Handle) {
-	p.router.Handle("OPTIONS", path, proxyHandle(handle))
+	p.handle("OPTIONS", path, handle)
 }
 
 // POST is a shortcut for router.Handle("POST", path, handle)
 func (p *proxy) POST(path string, handle Handle) {
-	p.router.Handle("POST", path, proxyHandle(handle))
+	p.handle("POST", path, handle)
 }
 
 // PUT is a shortcut for router.Handle("PUT", path, handle)
 func (p *proxy) PUT(path string, handle Handle) {
-	p.router.Handle("PUT", path, proxyHandle(handle))
+	p.handle("PUT", path, handle)
 }
 
 // PATCH is a shortcut for router.Handle("PATCH", path, handle)
 func (p *proxy) PATCH(path string, handle Handle) {
-	p.router.Handle("PATCH", path, proxyHandle(handle))
+	p.handle("PATCH", path, handle)
 }
 
 // DELETE is a shortcut for router.Handle("DELETE", path, handle)
 func (p *proxy) DELETE(path string, handle Handle) {
-	p.router.Handle("DELETE", path, proxyHandle(handle))
+	p.handle("DELETE", path, handle)
 }
 
 // CONNECT is a shortcut for router.Handle("CONNECT", path, handle)
 func (p *proxy) CONNECT(path string, handle Handle) {
-	p.router.Handle("CONNECT", path, proxyHandle(handle))
+	p.handle("CONNECT", path, handle)
 }
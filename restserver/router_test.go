@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	rest "github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/xhttp/header"
 	"github.com/effective-security/porto/xhttp/httperror"
 	"github.com/effective-security/porto/xhttp/marshal"
 	"github.com/stretchr/testify/assert"
@@ -45,6 +46,11 @@ func Test_Router(t *testing.T) {
 	router.DELETE("/del", h.handle)
 	router.CONNECT("/", h.handle)
 
+	routes := router.(rest.RouteLister).Routes()
+	require.Len(t, routes, 9)
+	assert.Equal(t, rest.Route{Method: http.MethodGet, Path: "/get/:GET"}, routes[1])
+	assert.Equal(t, rest.Route{Method: http.MethodConnect, Path: "/"}, routes[8])
+
 	assert.Equal(t, 0, h.methods[http.MethodGet])
 	assert.Equal(t, 0, h.methods[http.MethodHead])
 	assert.Equal(t, 0, h.methods[http.MethodOptions])
@@ -98,3 +104,162 @@ func Test_Router(t *testing.T) {
 	assert.Equal(t, 0, h.parameters["DELETE"])
 	assert.Equal(t, 0, h.parameters["OTHER"])
 }
+
+func Test_RouterAutoHEADOPTIONS(t *testing.T) {
+	get := func(w http.ResponseWriter, r *http.Request, _ rest.Params) {
+		w.Header().Set("X-Method", r.Method)
+		_, _ = w.Write([]byte("body"))
+	}
+
+	call := func(rh http.Handler, method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		rh.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	router := rest.NewRouter(notFoundHandler, rest.WithoutAutoHEAD("/nohead"), rest.WithoutAutoOPTIONS("/nooptions/:id"))
+	router.GET("/items/:id", get)
+	router.PUT("/items/:id", get)
+	router.POST("/post", get)
+	router.GET("/nohead", get)
+	router.GET("/nooptions/:id", get)
+	router.GET("/explicit", get)
+	router.HEAD("/explicit", get)
+	router.OPTIONS("/explicit", get)
+	rh := router.Handler()
+
+	w := call(rh, http.MethodHead, "/items/1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.MethodHead, w.Header().Get("X-Method"))
+	assert.Empty(t, w.Body.String())
+
+	w = call(rh, http.MethodHead, "/nohead")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	w = call(rh, http.MethodHead, "/explicit")
+	assert.Equal(t, "body", w.Body.String(), "explicit HEAD handler is used")
+
+	w = call(rh, http.MethodOptions, "/items/1")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS, PUT", w.Header().Get("Allow"))
+
+	w = call(rh, http.MethodOptions, "/post")
+	assert.Equal(t, "OPTIONS, POST", w.Header().Get("Allow"))
+
+	w = call(rh, http.MethodOptions, "/nohead")
+	assert.Equal(t, "GET, OPTIONS", w.Header().Get("Allow"))
+
+	w = call(rh, http.MethodOptions, "/explicit")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "body", w.Body.String())
+
+	w = call(rh, http.MethodOptions, "/nooptions/1")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	w = call(rh, http.MethodOptions, "/unknown")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// disabled
+	router = rest.NewRouter(notFoundHandler, rest.WithAutoHEAD(false), rest.WithAutoOPTIONS(false))
+	router.GET("/items/:id", get)
+	rh = router.Handler()
+	assert.Equal(t, http.StatusMethodNotAllowed, call(rh, http.MethodHead, "/items/1").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, call(rh, http.MethodOptions, "/items/1").Code)
+}
+
+func Test_RouterMethodNotAllowed(t *testing.T) {
+	handle := func(w http.ResponseWriter, r *http.Request, _ rest.Params) {
+		_, _ = w.Write([]byte(r.Method))
+	}
+	call := func(rh http.Handler, method, path, override string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, nil)
+		if override != "" {
+			r.Header.Set(header.XHTTPMethodOverride, override)
+		}
+		rh.ServeHTTP(w, r)
+		return w
+	}
+
+	router := rest.NewRouter(notFoundHandler, rest.WithMethodOverride())
+	router.GET("/items/:id", handle)
+	router.PUT("/items/:id", handle)
+	router.DELETE("/items/:id", handle)
+	router.POST("/items", handle)
+	rh := router.Handler()
+
+	w := call(rh, http.MethodPost, "/items/1", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "DELETE, GET, HEAD, OPTIONS, PUT", w.Header().Get(header.Allow))
+	assert.Contains(t, w.Body.String(), httperror.CodeNotAllowed)
+
+	w = call(rh, http.MethodGet, "/unknown", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = call(rh, http.MethodPost, "/items/1", "delete")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.MethodDelete, w.Body.String())
+
+	w = call(rh, http.MethodPost, "/items/1", http.MethodPut)
+	assert.Equal(t, http.MethodPut, w.Body.String())
+
+	w = call(rh, http.MethodPost, "/items", http.MethodGet)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// override is only for POST
+	w = call(rh, http.MethodGet, "/items/1", http.MethodDelete)
+	assert.Equal(t, http.MethodGet, w.Body.String())
+
+	// override is disabled by default
+	router = rest.NewRouter(notFoundHandler, rest.WithMethodNotAllowedHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	router.GET("/items/:id", handle)
+	rh = router.Handler()
+	w = call(rh, http.MethodPost, "/items/1", http.MethodDelete)
+	assert.Equal(t, http.StatusTeapot, w.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS", w.Header().Get(header.Allow))
+}
+
+func Test_RouterRouteSuggestions(t *testing.T) {
+	handle := func(w http.ResponseWriter, r *http.Request, _ rest.Params) {}
+	call := func(rh http.Handler, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		rh.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	register := func(router rest.Router) http.Handler {
+		router.GET("/v1/users/:id", handle)
+		router.PUT("/v1/users/:id", handle)
+		router.POST("/v1/users", handle)
+		router.GET("/v1/status", handle)
+		router.GET("/v2/metrics/*path", handle)
+		return router.Handler()
+	}
+
+	rh := register(rest.NewRouter(notFoundHandler, rest.WithRouteSuggestions(3)))
+
+	w := call(rh, "/v1/user/123")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), `"suggestions":"GET,PUT /v1/users/:id; POST /v1/users"`)
+
+	w = call(rh, "/v2/metric/cpu/load")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), `"suggestions":"GET /v2/metrics/*path"`)
+
+	// not a near-miss
+	w = call(rh, "/unknown")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "URL: /unknown")
+	assert.NotContains(t, w.Body.String(), "suggestions")
+
+	rh = register(rest.NewRouter(notFoundHandler, rest.WithRouteSuggestions(1)))
+	w = call(rh, "/v1/user/123")
+	assert.Contains(t, w.Body.String(), `"suggestions":"GET,PUT /v1/users/:id"`)
+
+	// disabled by default
+	rh = register(rest.NewRouter(notFoundHandler))
+	w = call(rh, "/v1/user/123")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NotContains(t, w.Body.String(), "suggestions")
+}
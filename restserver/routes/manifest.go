@@ -0,0 +1,163 @@
+package routes
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/restserver/authz"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Manifest describes the endpoints of the service with the required permissions,
+// it can be exposed by the service or shipped to API catalogs
+type Manifest struct {
+	Service   string      `json:"service,omitempty"`
+	Endpoints []*Endpoint `json:"endpoints"`
+}
+
+// Endpoint describes the route or gRPC method
+type Endpoint struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
+	// Methods is the list of HTTP methods, or unary|stream for gRPC
+	Methods []string `json:"methods"`
+	// Authz is the effective access rule, nil if authz is not configured
+	Authz *authz.Requirement `json:"authz,omitempty"`
+	// Request is the name of the request type, if known
+	Request string `json:"request,omitempty"`
+	// Response is the name of the response type, if known
+	Response string `json:"response,omitempty"`
+}
+
+// Types provides the request and response types of the HTTP routes,
+// the types of gRPC methods are resolved from the registered proto files
+type Types struct {
+	lock  sync.RWMutex
+	types map[string]*typeNames
+}
+
+type typeNames struct {
+	request  string
+	response string
+}
+
+// NewTypes returns Types
+func NewTypes() *Types {
+	return &Types{
+		types: map[string]*typeNames{},
+	}
+}
+
+// Add registers the request and response types of the route,
+// the values can be nil, proto messages or Go values
+func (t *Types) Add(method, path string, request, response any) *Types {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.types[method+" "+path] = &typeNames{
+		request:  typeName(request),
+		response: typeName(response),
+	}
+	return t
+}
+
+func (t *Types) find(method, path string) *typeNames {
+	if t == nil {
+		return nil
+	}
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.types[method+" "+path]
+}
+
+func typeName(v any) string {
+	if v == nil {
+		return ""
+	}
+	if m, ok := v.(proto.Message); ok {
+		return string(m.ProtoReflect().Descriptor().FullName())
+	}
+	typ := reflect.TypeOf(v)
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	return typ.String()
+}
+
+// BuildManifest returns Manifest of the routes from the router,
+// and methods from the gRPC server, with authz requirements
+// if the provider is specified, and the types if known
+func BuildManifest(service string, router restserver.Router, grpcServer ServiceInfoProvider, az *authz.Provider, types *Types) *Manifest {
+	m := &Manifest{Service: service}
+	byKey := map[string]*Endpoint{}
+	for _, r := range List(router, grpcServer, az) {
+		key := r.Type + " " + r.Path
+		e := byKey[key]
+		if e == nil {
+			e = &Endpoint{
+				Type:  r.Type,
+				Path:  r.Path,
+				Authz: r.Authz,
+			}
+			if r.Type == TypeGRPC {
+				e.Request, e.Response = grpcTypes(r.Path)
+			}
+			byKey[key] = e
+			m.Endpoints = append(m.Endpoints, e)
+		}
+		e.Methods = append(e.Methods, r.Method)
+
+		if tn := types.find(r.Method, r.Path); tn != nil {
+			if e.Request == "" {
+				e.Request = tn.request
+			}
+			if e.Response == "" {
+				e.Response = tn.response
+			}
+		}
+	}
+
+	for _, e := range m.Endpoints {
+		sort.Strings(e.Methods)
+	}
+	return m
+}
+
+// grpcTypes returns the input and output types of the method
+// in `/package.Service/Method` format
+func grpcTypes(path string) (string, string) {
+	name := protoreflect.FullName(strings.Replace(strings.TrimPrefix(path, "/"), "/", ".", 1))
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(name)
+	if err != nil {
+		return "", ""
+	}
+	md, ok := d.(protoreflect.MethodDescriptor)
+	if !ok {
+		return "", ""
+	}
+	return string(md.Input().FullName()), string(md.Output().FullName())
+}
+
+// WriteJSON writes the manifest as JSON
+func (m *Manifest) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.WithStack(enc.Encode(m))
+}
+
+// Manifest returns Manifest of the routes and methods
+// registered with the service
+func (s *Service) Manifest(service string, types *Types) *Manifest {
+	s.lock.RLock()
+	router, grpcServer := s.router, s.grpcServer
+	s.lock.RUnlock()
+
+	return BuildManifest(service, router, grpcServer, s.authz, types)
+}
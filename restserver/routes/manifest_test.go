@@ -0,0 +1,88 @@
+package routes_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/restserver/authz"
+	"github.com/effective-security/porto/restserver/routes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type user struct {
+	ID string `json:"id"`
+}
+
+func TestManifest(t *testing.T) {
+	az, err := authz.New(&authz.Config{
+		Allow:    []string{"/v1/users:admin", "/grpc.health.v1.Health:monitor"},
+		AllowAny: []string{"/v1/status"},
+	})
+	require.NoError(t, err)
+
+	gs := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(gs, health.NewServer())
+
+	svc := routes.NewService("", az).WithGRPC(gs)
+	router := restserver.NewRouter(nil)
+	svc.RegisterRoute(router)
+	router.GET("/v1/users/:id", noop)
+	router.PUT("/v1/users/:id", noop)
+	router.POST("/v1/users", noop)
+
+	types := routes.NewTypes().
+		Add(http.MethodGet, "/v1/users/:id", nil, &user{}).
+		Add(http.MethodPost, "/v1/users", &user{}, &errdetails.ErrorInfo{})
+
+	m := svc.Manifest("test", types)
+	assert.Equal(t, "test", m.Service)
+
+	byPath := map[string]*routes.Endpoint{}
+	for _, e := range m.Endpoints {
+		byPath[e.Path] = e
+	}
+
+	e := byPath["/v1/users/:id"]
+	require.NotNil(t, e)
+	assert.Equal(t, routes.TypeHTTP, e.Type)
+	assert.Equal(t, []string{http.MethodGet, http.MethodPut}, e.Methods)
+	assert.Equal(t, []string{"admin"}, e.Authz.Roles)
+	assert.Empty(t, e.Request)
+	assert.Equal(t, "routes_test.user", e.Response)
+
+	e = byPath["/v1/users"]
+	require.NotNil(t, e)
+	assert.Equal(t, "routes_test.user", e.Request)
+	assert.Equal(t, "google.rpc.ErrorInfo", e.Response)
+
+	e = byPath["/grpc.health.v1.Health/Check"]
+	require.NotNil(t, e)
+	assert.Equal(t, routes.TypeGRPC, e.Type)
+	assert.Equal(t, []string{"unary"}, e.Methods)
+	assert.Equal(t, []string{"monitor"}, e.Authz.Roles)
+	assert.Equal(t, "grpc.health.v1.HealthCheckRequest", e.Request)
+	assert.Equal(t, "grpc.health.v1.HealthCheckResponse", e.Response)
+
+	e = byPath["/grpc.health.v1.Health/Watch"]
+	require.NotNil(t, e)
+	assert.Equal(t, []string{"stream"}, e.Methods)
+
+	var buf bytes.Buffer
+	require.NoError(t, m.WriteJSON(&buf))
+
+	var decoded routes.Manifest
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Len(t, decoded.Endpoints, len(m.Endpoints))
+
+	// without authz and router
+	m = routes.BuildManifest("empty", nil, nil, nil, nil)
+	assert.Empty(t, m.Endpoints)
+}
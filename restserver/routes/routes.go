@@ -0,0 +1,128 @@
+// Package routes provides a self-describing endpoint, that lists
+// registered REST routes and gRPC methods with their effective authz requirements.
+package routes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/restserver/authz"
+	"google.golang.org/grpc"
+)
+
+// Route types
+const (
+	TypeHTTP = "http"
+	TypeGRPC = "grpc"
+)
+
+// ServiceInfoProvider provides the information about gRPC services,
+// it is implemented by grpc.Server
+type ServiceInfoProvider interface {
+	GetServiceInfo() map[string]grpc.ServiceInfo
+}
+
+// Route describes the registered route or gRPC method
+type Route struct {
+	Type   string `json:"type"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Authz is the effective access rule, nil if authz is not configured
+	Authz *authz.Requirement `json:"authz,omitempty"`
+}
+
+// RoutesResponse is returned by the endpoint
+type RoutesResponse struct {
+	Routes []*Route `json:"routes"`
+}
+
+// List returns the routes from the router, and methods from the gRPC server,
+// with authz requirements if the provider is specified
+func List(router restserver.Router, grpcServer ServiceInfoProvider, az *authz.Provider) []*Route {
+	var list []*Route
+	if lister, ok := router.(restserver.RouteLister); ok {
+		for _, r := range lister.Routes() {
+			list = append(list, &Route{
+				Type:   TypeHTTP,
+				Method: r.Method,
+				Path:   r.Path,
+			})
+		}
+	}
+
+	if grpcServer != nil {
+		for svc, info := range grpcServer.GetServiceInfo() {
+			for _, m := range info.Methods {
+				method := "unary"
+				if m.IsClientStream || m.IsServerStream {
+					method = "stream"
+				}
+				list = append(list, &Route{
+					Type:   TypeGRPC,
+					Method: method,
+					Path:   "/" + svc + "/" + m.Name,
+				})
+			}
+		}
+	}
+
+	if az != nil {
+		for _, r := range list {
+			r.Authz = az.Requirement(r.Path)
+		}
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Type != list[j].Type {
+			return list[i].Type > list[j].Type
+		}
+		if list[i].Path != list[j].Path {
+			return list[i].Path < list[j].Path
+		}
+		return list[i].Method < list[j].Method
+	})
+	return list
+}
+
+// Fetch returns the routes from the remote endpoint
+func Fetch(ctx context.Context, client retriable.GetRequester, path string) ([]*Route, error) {
+	if path == "" {
+		path = DefaultPath
+	}
+	var res RoutesResponse
+	_, _, err := client.Get(ctx, path, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res.Routes, nil
+}
+
+// Print writes the routes as a table
+func Print(w io.Writer, list []*Route) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tMETHOD\tPATH\tAUTHZ")
+	for _, r := range list {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Type, r.Method, r.Path, formatAuthz(r.Authz))
+	}
+	_ = tw.Flush()
+}
+
+func formatAuthz(req *authz.Requirement) string {
+	switch {
+	case req == nil:
+		return "-"
+	case req.AllowAny:
+		return "[Any] " + req.Node
+	case req.AllowAnyRole:
+		return "[Any Role] " + req.Node
+	case len(req.Roles) > 0:
+		return "[" + strings.Join(req.Roles, ",") + "] " + req.Node
+	}
+	return "[Denied] " + req.Node
+}
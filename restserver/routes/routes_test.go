@@ -0,0 +1,105 @@
+package routes_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/effective-security/porto/pkg/retriable"
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/restserver/authz"
+	"github.com/effective-security/porto/restserver/routes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func noop(w http.ResponseWriter, r *http.Request, _ restserver.Params) {}
+
+func TestRoutes(t *testing.T) {
+	az, err := authz.New(&authz.Config{
+		Allow:        []string{"/v1/users:admin,user", "/grpc.health.v1.Health:monitor"},
+		AllowAny:     []string{"/v1/routes", "/v1/status"},
+		AllowAnyRole: []string{"/v1/profile"},
+	})
+	require.NoError(t, err)
+
+	gs := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(gs, health.NewServer())
+
+	svc := routes.NewService("", az)
+	assert.Equal(t, routes.ServiceName, svc.Name())
+	assert.True(t, svc.IsReady())
+	defer svc.Close()
+	svc.RegisterGRPC(gs)
+
+	router := restserver.NewRouter(nil)
+	svc.RegisterRoute(router)
+	router.GET("/v1/users/:id", noop)
+	router.POST("/v1/users", noop)
+	router.GET("/v1/profile", noop)
+	router.GET("/v2/other", noop)
+
+	server := httptest.NewServer(router.Handler())
+	defer server.Close()
+
+	client, err := retriable.New(retriable.ClientConfig{Host: server.URL})
+	require.NoError(t, err)
+
+	list, err := routes.Fetch(context.Background(), client, "")
+	require.NoError(t, err)
+
+	byPath := map[string]*routes.Route{}
+	for _, r := range list {
+		byPath[r.Method+" "+r.Path] = r
+	}
+
+	r := byPath["GET /v1/users/:id"]
+	require.NotNil(t, r)
+	assert.Equal(t, routes.TypeHTTP, r.Type)
+	assert.Equal(t, &authz.Requirement{Node: "/v1/users", Roles: []string{"admin", "user"}}, r.Authz)
+
+	r = byPath["GET /v1/routes"]
+	require.NotNil(t, r)
+	assert.True(t, r.Authz.AllowAny)
+
+	r = byPath["GET /v1/profile"]
+	require.NotNil(t, r)
+	assert.True(t, r.Authz.AllowAnyRole)
+
+	r = byPath["GET /v2/other"]
+	require.NotNil(t, r)
+	assert.Equal(t, "/", r.Authz.Node)
+	assert.Empty(t, r.Authz.Roles)
+
+	r = byPath["unary /grpc.health.v1.Health/Check"]
+	require.NotNil(t, r)
+	assert.Equal(t, routes.TypeGRPC, r.Type)
+	assert.Equal(t, []string{"monitor"}, r.Authz.Roles)
+	assert.NotNil(t, byPath["stream /grpc.health.v1.Health/Watch"])
+
+	// http routes first
+	assert.Equal(t, routes.TypeHTTP, list[0].Type)
+	assert.Equal(t, routes.TypeGRPC, list[len(list)-1].Type)
+
+	w := bytes.NewBuffer(nil)
+	routes.Print(w, list)
+	out := w.String()
+	assert.Contains(t, out, "TYPE  METHOD  PATH")
+	assert.Contains(t, out, "[admin,user] /v1/users")
+	assert.Contains(t, out, "[Any] /v1/routes")
+	assert.Contains(t, out, "[Any Role] /v1/profile")
+	assert.Contains(t, out, "[Denied] /")
+
+	// without authz
+	list = routes.List(router, nil, nil)
+	assert.Len(t, list, 5)
+	assert.Nil(t, list[0].Authz)
+	w.Reset()
+	routes.Print(w, list)
+	assert.Contains(t, w.String(), "-")
+}
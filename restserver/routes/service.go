@@ -0,0 +1,90 @@
+package routes
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/restserver/authz"
+	"github.com/effective-security/porto/xhttp/marshal"
+	"google.golang.org/grpc"
+)
+
+// ServiceName provides the default service name
+const ServiceName = "routes"
+
+// DefaultPath is the default path of the endpoint
+const DefaultPath = "/v1/routes"
+
+// Service provides restserver.Service, that lists the routes of the router
+// it is registered with, and the methods of the gRPC server
+type Service struct {
+	path  string
+	authz *authz.Provider
+
+	lock       sync.RWMutex
+	router     restserver.Router
+	grpcServer ServiceInfoProvider
+}
+
+// NewService returns Service, the authz provider is optional
+func NewService(path string, az *authz.Provider) *Service {
+	if path == "" {
+		path = DefaultPath
+	}
+	return &Service{
+		path:  path,
+		authz: az,
+	}
+}
+
+// Name returns the service name
+func (s *Service) Name() string {
+	return ServiceName
+}
+
+// IsReady indicates that the service is ready to serve its end-points
+func (s *Service) IsReady() bool {
+	return true
+}
+
+// Close the subservices and it's resources
+func (s *Service) Close() {
+}
+
+// Register adds the endpoint to the router
+func (s *Service) Register(r restserver.Router) {
+	s.lock.Lock()
+	s.router = r
+	s.lock.Unlock()
+
+	r.GET(s.path, s.list)
+}
+
+// RegisterRoute adds the endpoint to the router
+func (s *Service) RegisterRoute(r restserver.Router) {
+	s.Register(r)
+}
+
+// RegisterGRPC keeps the gRPC server to list its methods
+func (s *Service) RegisterGRPC(server *grpc.Server) {
+	s.WithGRPC(server)
+}
+
+// WithGRPC specifies the gRPC server to list its methods
+func (s *Service) WithGRPC(server ServiceInfoProvider) *Service {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.grpcServer = server
+	return s
+}
+
+func (s *Service) list(w http.ResponseWriter, r *http.Request, _ restserver.Params) {
+	s.lock.RLock()
+	router, grpcServer := s.router, s.grpcServer
+	s.lock.RUnlock()
+
+	marshal.WriteJSON(w, r, &RoutesResponse{
+		Routes: List(router, grpcServer, s.authz),
+	})
+}
@@ -295,9 +295,12 @@ func (server *HTTPServer) StartHTTP() error {
 	}
 
 	server.httpServer = &http.Server{
-		IdleTimeout: time.Hour, // TODO: via config
+		IdleTimeout: DefaultIdleTimeout,
 		ErrorLog:    xlog.Stderr,
 	}
+	if limits, ok := server.httpConfig.(HTTPLimitsConfig); ok {
+		ApplyLimits(server.httpServer, limits)
+	}
 
 	var httpsListener net.Listener
 
@@ -7,6 +7,7 @@ import (
 	"crypto/x509/pkix"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -272,6 +273,49 @@ func Test_NewServerWithCustomHandler(t *testing.T) {
 	server.StopHTTP()
 }
 
+type limitsConfig struct {
+	serverConfig
+	readHeaderTimeout time.Duration
+}
+
+func (c *limitsConfig) GetReadTimeout() time.Duration       { return 0 }
+func (c *limitsConfig) GetReadHeaderTimeout() time.Duration { return c.readHeaderTimeout }
+func (c *limitsConfig) GetWriteTimeout() time.Duration      { return 0 }
+func (c *limitsConfig) GetIdleTimeout() time.Duration       { return 0 }
+func (c *limitsConfig) GetMaxHeaderBytes() int              { return 0 }
+
+func Test_ServerLimits(t *testing.T) {
+	cfg := &limitsConfig{
+		serverConfig: serverConfig{
+			BindAddr: testutils.CreateBindAddr("127.0.0.1"),
+		},
+		readHeaderTimeout: 100 * time.Millisecond,
+	}
+
+	server, err := rest.New("v1.0.123", "", cfg, nil)
+	require.NoError(t, err)
+	err = server.StartHTTP()
+	require.NoError(t, err)
+	defer server.StopHTTP()
+
+	for i := 0; i < 30 && !server.IsReady(); i++ {
+		time.Sleep(1 * time.Second)
+	}
+	require.True(t, server.IsReady())
+
+	// the slow client is disconnected after ReadHeader timeout
+	conn, err := net.Dial("tcp", "127.0.0.1:"+server.Port())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /v1/test HTTP/1.1\r\n"))
+	require.NoError(t, err)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = conn.Read(make([]byte, 1))
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, os.ErrDeadlineExceeded), "connection must be closed by the server")
+}
+
 func Test_TLSConfig(t *testing.T) {
 	cfg := &serverConfig{
 		BindAddr: ":8081",
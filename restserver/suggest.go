@@ -0,0 +1,103 @@
+package restserver
+
+import (
+	"sort"
+	"strings"
+)
+
+// WithRouteSuggestions specifies to include up to max closest registered routes,
+// with the allowed methods, in the error details of 404 responses,
+// to assist API consumers during integration.
+// It discloses the registered routes, and should not be enabled in production.
+func WithRouteSuggestions(max int) RouterOption {
+	return newRouterFuncOption(func(o *routerOptions) {
+		o.suggestions = max
+	})
+}
+
+type routeSuggestion struct {
+	path     string
+	methods  []string
+	distance int
+}
+
+// suggest returns the closest registered routes by edit distance,
+// in `GET,POST /v1/users/:id` format
+func (p *proxy) suggest(path string) []string {
+	// the distance above the limit is not a near-miss
+	limit := len(path) / 3
+	if limit < 3 {
+		limit = 3
+	}
+
+	var list []*routeSuggestion
+	byPath := map[string]*routeSuggestion{}
+	for _, r := range p.Routes() {
+		if s := byPath[r.Path]; s != nil {
+			s.methods = append(s.methods, r.Method)
+			continue
+		}
+		d := editDistance(path, routeCandidate(r.Path, path))
+		if d > limit {
+			continue
+		}
+		s := &routeSuggestion{path: r.Path, methods: []string{r.Method}, distance: d}
+		byPath[r.Path] = s
+		list = append(list, s)
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].distance < list[j].distance
+	})
+	if len(list) > p.opts.suggestions {
+		list = list[:p.opts.suggestions]
+	}
+
+	res := make([]string, len(list))
+	for i, s := range list {
+		res[i] = strings.Join(s.methods, ",") + " " + s.path
+	}
+	return res
+}
+
+// routeCandidate returns the route path with the parameters
+// replaced by the corresponding segments of the request path,
+// so only the static segments contribute to the distance
+func routeCandidate(route, path string) string {
+	rs := strings.Split(route, "/")
+	ps := strings.Split(path, "/")
+	for i, seg := range rs {
+		if i >= len(ps) {
+			break
+		}
+		switch {
+		case strings.HasPrefix(seg, ":"):
+			rs[i] = ps[i]
+		case strings.HasPrefix(seg, "*"):
+			rs[i] = strings.Join(ps[i:], "/")
+			return strings.Join(rs[:i+1], "/")
+		}
+	}
+	return strings.Join(rs, "/")
+}
+
+// editDistance returns Levenshtein distance between the strings
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
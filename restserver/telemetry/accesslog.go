@@ -0,0 +1,92 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AccessLogEntry describes the served request
+type AccessLogEntry struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	Status int       `json:"status"`
+	// Latency is the time to handle the request, in nanoseconds
+	Latency       time.Duration `json:"latency_ns"`
+	Bytes         uint64        `json:"bytes"`
+	Remote        string        `json:"remote,omitempty"`
+	Agent         string        `json:"agent,omitempty"`
+	Role          string        `json:"role,omitempty"`
+	Subject       string        `json:"subject,omitempty"`
+	Tenant        string        `json:"tenant,omitempty"`
+	CorrelationID string        `json:"correlation_id,omitempty"`
+}
+
+// AccessLogSink persists the access log entries
+type AccessLogSink interface {
+	WriteAccessLog(ctx context.Context, e *AccessLogEntry) error
+}
+
+// WithAccessLogSink is an Option to write the access log entries to the sink,
+// instead of the logger
+func WithAccessLogSink(sink AccessLogSink) Option {
+	return func(c *configuration) {
+		c.sink = sink
+	}
+}
+
+// JSONAccessLogSink writes the entries as JSON objects, one per line
+type JSONAccessLogSink struct {
+	lock sync.Mutex
+	enc  *json.Encoder
+	c    io.Closer
+}
+
+// NewJSONAccessLogSink returns JSONAccessLogSink to the writer
+func NewJSONAccessLogSink(w io.Writer) *JSONAccessLogSink {
+	return &JSONAccessLogSink{
+		enc: json.NewEncoder(w),
+	}
+}
+
+// OpenJSONAccessLog returns JSONAccessLogSink to the file,
+// `stdout` and `stderr` specify the standard streams
+func OpenJSONAccessLog(file string) (*JSONAccessLogSink, error) {
+	switch file {
+	case "stdout":
+		return NewJSONAccessLogSink(os.Stdout), nil
+	case "stderr":
+		return NewJSONAccessLogSink(os.Stderr), nil
+	}
+
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "unable to open access log")
+	}
+	s := NewJSONAccessLogSink(f)
+	s.c = f
+	return s, nil
+}
+
+// WriteAccessLog implements AccessLogSink
+func (s *JSONAccessLogSink) WriteAccessLog(_ context.Context, e *AccessLogEntry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return errors.WithStack(s.enc.Encode(e))
+}
+
+// Close closes the file
+func (s *JSONAccessLogSink) Close() error {
+	if s.c == nil {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return errors.WithStack(s.c.Close())
+}
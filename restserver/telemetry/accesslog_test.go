@@ -0,0 +1,55 @@
+package telemetry
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/xhttp/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLogSink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	handler := &testHandler{t, http.StatusCreated, []byte(`Hello World`)}
+	// the logger is not required with the sink
+	rl := NewRequestLogger(handler, time.Millisecond, nil,
+		WithAccessLogSink(NewJSONAccessLogSink(buf)))
+
+	r := httptest.NewRequest(http.MethodPost, "/foo", nil)
+	r.Header.Set("User-Agent", "test")
+	r = identity.WithTestIdentity(r, identity.NewIdentity("admin", "bob", "t1", nil, "", ""))
+	rl.ServeHTTP(httptest.NewRecorder(), r)
+
+	var e AccessLogEntry
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &e))
+	assert.Equal(t, http.MethodPost, e.Method)
+	assert.Equal(t, "/foo", e.Path)
+	assert.Equal(t, http.StatusCreated, e.Status)
+	assert.Equal(t, uint64(11), e.Bytes)
+	assert.Equal(t, "test", e.Agent)
+	assert.Equal(t, "admin", e.Role)
+	assert.Equal(t, "bob", e.Subject)
+	assert.Equal(t, "t1", e.Tenant)
+	assert.False(t, e.Time.IsZero())
+
+	file := filepath.Join(t.TempDir(), "access.log")
+	sink, err := OpenJSONAccessLog(file)
+	require.NoError(t, err)
+	require.NoError(t, sink.WriteAccessLog(r.Context(), &e))
+	require.NoError(t, sink.WriteAccessLog(r.Context(), &e))
+	require.NoError(t, sink.Close())
+
+	b, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, 2, bytes.Count(b, []byte("\n")))
+
+	_, err = OpenJSONAccessLog(filepath.Join(file, "invalid"))
+	assert.Error(t, err)
+}
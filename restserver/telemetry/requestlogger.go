@@ -5,7 +5,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/effective-security/porto/xhttp/correlation"
 	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/identity"
 	"github.com/effective-security/xlog"
 )
 
@@ -35,6 +37,7 @@ type configuration struct {
 	skippaths   []LoggerSkipPath
 	granularity int64
 	logger      xlog.KeyValueLogger
+	sink        AccessLogSink
 }
 
 // WithLoggerSkipPaths is an Option allows to skip logs on path/agent match
@@ -63,10 +66,6 @@ func NewRequestLogger(
 		panic("RequestLogger was supplied a nil handler to delegate to")
 	}
 
-	if logger == nil {
-		return handler
-	}
-
 	cfg := configuration{
 		granularity: int64(granularity),
 		logger:      logger,
@@ -76,6 +75,10 @@ func NewRequestLogger(
 		option(opt)(&cfg)
 	}
 
+	if cfg.logger == nil && cfg.sink == nil {
+		return handler
+	}
+
 	return &RequestLogger{
 		handler: handler,
 		cfg:     cfg,
@@ -100,6 +103,11 @@ func (l *RequestLogger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	dur := time.Since(start)
 
+	if l.cfg.sink != nil {
+		l.writeAccessLog(r, rw, start, dur, agent)
+		return
+	}
+
 	l.cfg.logger.ContextKV(r.Context(), xlog.INFO,
 		"method", r.Method,
 		"path", r.URL.Path,
@@ -113,3 +121,27 @@ func (l *RequestLogger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		//"user", idn.Subject(),
 	)
 }
+
+func (l *RequestLogger) writeAccessLog(r *http.Request, rw *ResponseCapture, start time.Time, dur time.Duration, agent string) {
+	ctx := r.Context()
+	idn := identity.FromContext(ctx).Identity()
+	e := &AccessLogEntry{
+		Time:          start,
+		Method:        r.Method,
+		Path:          r.URL.Path,
+		Status:        rw.statusCode,
+		Latency:       dur,
+		Bytes:         rw.bodySize,
+		Remote:        r.RemoteAddr,
+		Agent:         agent,
+		Role:          idn.Role(),
+		Subject:       idn.Subject(),
+		Tenant:        idn.Tenant(),
+		CorrelationID: correlation.ID(ctx),
+	}
+	if err := l.cfg.sink.WriteAccessLog(ctx, e); err != nil && l.cfg.logger != nil {
+		l.cfg.logger.ContextKV(ctx, xlog.ERROR,
+			"reason", "access_log",
+			"err", err.Error())
+	}
+}
@@ -0,0 +1,348 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/effective-security/porto/metricskey"
+	"github.com/effective-security/xlog"
+)
+
+var sloLogger = xlog.NewPackageLogger("github.com/effective-security/porto/restserver", "telemetry")
+
+// SLO defines the service level objective for routes
+type SLO struct {
+	// Name of the SLO, reported in metrics and alerts.
+	// If not provided, the Route is used
+	Name string
+	// Route is the URL path prefix, the longest matching prefix is used.
+	// Empty value matches all routes
+	Route string
+	// Target is the expected fraction of successful requests, for example 0.999
+	Target float64
+}
+
+// BurnRateWindow defines the multi-window burn rate alert condition:
+// the alert is firing when the burn rate over both Long and Short windows
+// exceeds the Threshold
+type BurnRateWindow struct {
+	Long  time.Duration
+	Short time.Duration
+	// Threshold is the burn rate, where 1 means the error budget
+	// is consumed exactly over the SLO period
+	Threshold float64
+}
+
+// DefaultBurnRateWindows provides the recommended fast and slow burn alerts
+var DefaultBurnRateWindows = []BurnRateWindow{
+	{Long: time.Hour, Short: 5 * time.Minute, Threshold: 14.4},
+	{Long: 6 * time.Hour, Short: 30 * time.Minute, Threshold: 6},
+}
+
+// BurnRateAlert is provided to the alert callback,
+// when the alert state changes
+type BurnRateAlert struct {
+	SLO    string
+	Target float64
+	Window BurnRateWindow
+	// LongBurnRate is the burn rate over the Long window
+	LongBurnRate float64
+	// ShortBurnRate is the burn rate over the Short window
+	ShortBurnRate float64
+	// Firing is true when the alert started, and false when resolved
+	Firing bool
+}
+
+// AlertFunc is called when the alert state changes
+type AlertFunc func(alert BurnRateAlert)
+
+// SLOTracker tracks success and error ratios per route against SLO targets,
+// and computes burn rates over multiple windows
+type SLOTracker struct {
+	slos    []*sloState
+	windows []BurnRateWindow
+	opts    sloOptions
+
+	lock sync.Mutex
+}
+
+type sloState struct {
+	SLO
+	buckets []sloBucket
+	firing  map[int]bool
+}
+
+type sloBucket struct {
+	slot   int64
+	total  uint64
+	errors uint64
+}
+
+// NewSLOTracker returns new SLOTracker
+func NewSLOTracker(slos []SLO, opts ...SLOOption) *SLOTracker {
+	t := &SLOTracker{
+		opts: sloOptions{
+			windows:    DefaultBurnRateWindows,
+			resolution: time.Minute,
+			isError: func(statusCode int) bool {
+				return statusCode >= http.StatusInternalServerError
+			},
+			now: time.Now,
+		},
+	}
+	for _, opt := range opts {
+		opt.apply(&t.opts)
+	}
+	t.windows = t.opts.windows
+
+	var maxWindow time.Duration
+	for _, w := range t.windows {
+		maxWindow = max(maxWindow, w.Long, w.Short)
+	}
+	size := int(maxWindow/t.opts.resolution) + 1
+
+	for _, slo := range slos {
+		if slo.Name == "" {
+			slo.Name = slo.Route
+		}
+		t.slos = append(t.slos, &sloState{
+			SLO:     slo,
+			buckets: make([]sloBucket, size),
+			firing:  map[int]bool{},
+		})
+	}
+	// the longest prefix must match first
+	sort.SliceStable(t.slos, func(i, j int) bool {
+		return len(t.slos[i].Route) > len(t.slos[j].Route)
+	})
+	return t
+}
+
+// Handler returns http.Handler that records the response status of each request
+func (t *SLOTracker) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := NewResponseCapture(w)
+		h.ServeHTTP(rc, r)
+		t.Record(r.URL.Path, rc.StatusCode())
+	})
+}
+
+// Record records the request result for the matching SLO
+func (t *SLOTracker) Record(path string, statusCode int) {
+	s := t.find(path)
+	if s == nil {
+		return
+	}
+	isErr := t.opts.isError(statusCode)
+	slot := t.opts.now().UnixNano() / int64(t.opts.resolution)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	b := &s.buckets[slot%int64(len(s.buckets))]
+	if b.slot != slot {
+		*b = sloBucket{slot: slot}
+	}
+	b.total++
+	if isErr {
+		b.errors++
+	}
+}
+
+// BurnRate returns the burn rate of the SLO over the window
+func (t *SLOTracker) BurnRate(name string, window time.Duration) float64 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, s := range t.slos {
+		if s.Name == name {
+			return t.burnRate(s, window)
+		}
+	}
+	return 0
+}
+
+// Evaluate publishes the burn rate and error budget metrics,
+// and calls the alert callback when the alert state changes
+func (t *SLOTracker) Evaluate() {
+	var alerts []BurnRateAlert
+
+	t.lock.Lock()
+	for _, s := range t.slos {
+		var longest time.Duration
+		for idx, w := range t.windows {
+			long := t.burnRate(s, w.Long)
+			short := long
+			if w.Short > 0 {
+				short = t.burnRate(s, w.Short)
+			}
+			metricskey.SLOBurnRate.SetGauge(long, s.Name, formatWindow(w.Long))
+			if w.Short > 0 {
+				metricskey.SLOBurnRate.SetGauge(short, s.Name, formatWindow(w.Short))
+			}
+
+			firing := long >= w.Threshold && short >= w.Threshold
+			if firing != s.firing[idx] {
+				s.firing[idx] = firing
+				alerts = append(alerts, BurnRateAlert{
+					SLO:           s.Name,
+					Target:        s.Target,
+					Window:        w,
+					LongBurnRate:  long,
+					ShortBurnRate: short,
+					Firing:        firing,
+				})
+			}
+			longest = max(longest, w.Long)
+		}
+		metricskey.SLOErrorBudget.SetGauge(1-t.burnRate(s, longest), s.Name)
+	}
+	t.lock.Unlock()
+
+	for _, alert := range alerts {
+		sloLogger.KV(xlog.WARNING,
+			"slo", alert.SLO,
+			"window", formatWindow(alert.Window.Long),
+			"burn_rate", alert.LongBurnRate,
+			"firing", alert.Firing)
+		if t.opts.alertFunc != nil {
+			t.opts.alertFunc(alert)
+		}
+	}
+}
+
+// Start evaluates the SLOs periodically, until the context is cancelled
+func (t *SLOTracker) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				t.Evaluate()
+			}
+		}
+	}()
+}
+
+func (t *SLOTracker) find(path string) *sloState {
+	for _, s := range t.slos {
+		if strings.HasPrefix(path, s.Route) {
+			return s
+		}
+	}
+	return nil
+}
+
+// burnRate must be called under lock
+func (t *SLOTracker) burnRate(s *sloState, window time.Duration) float64 {
+	if window <= 0 {
+		return 0
+	}
+	now := t.opts.now().UnixNano() / int64(t.opts.resolution)
+	count := int64(window / t.opts.resolution)
+	if count < 1 {
+		count = 1
+	}
+
+	var total, errs uint64
+	for _, b := range s.buckets {
+		if b.total > 0 && b.slot > now-count && b.slot <= now {
+			total += b.total
+			errs += b.errors
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	budget := 1 - s.Target
+	if budget <= 0 {
+		if errs > 0 {
+			return float64(errs)
+		}
+		return 0
+	}
+	return float64(errs) / float64(total) / budget
+}
+
+func formatWindow(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
+
+// SLOOption configures the SLOTracker
+type SLOOption interface {
+	apply(*sloOptions)
+}
+
+type sloOptions struct {
+	windows    []BurnRateWindow
+	resolution time.Duration
+	isError    func(statusCode int) bool
+	alertFunc  AlertFunc
+	now        func() time.Time
+}
+
+type sloFuncOption struct {
+	f func(*sloOptions)
+}
+
+func (fo *sloFuncOption) apply(o *sloOptions) {
+	fo.f(o)
+}
+
+func newSLOFuncOption(f func(*sloOptions)) *sloFuncOption {
+	return &sloFuncOption{
+		f: f,
+	}
+}
+
+// WithBurnRateWindows specifies the burn rate alert windows
+func WithBurnRateWindows(windows ...BurnRateWindow) SLOOption {
+	return newSLOFuncOption(func(o *sloOptions) {
+		o.windows = windows
+	})
+}
+
+// WithResolution specifies the size of time buckets, default is 1 minute
+func WithResolution(resolution time.Duration) SLOOption {
+	return newSLOFuncOption(func(o *sloOptions) {
+		if resolution > 0 {
+			o.resolution = resolution
+		}
+	})
+}
+
+// WithErrorClassifier specifies the function to classify status code as an error,
+// by default 5xx responses are errors
+func WithErrorClassifier(isError func(statusCode int) bool) SLOOption {
+	return newSLOFuncOption(func(o *sloOptions) {
+		o.isError = isError
+	})
+}
+
+// WithAlertFunc specifies the callback for burn rate alerts
+func WithAlertFunc(f AlertFunc) SLOOption {
+	return newSLOFuncOption(func(o *sloOptions) {
+		o.alertFunc = f
+	})
+}
+
+// WithTimeNow specifies the clock, for tests
+func WithTimeNow(now func() time.Time) SLOOption {
+	return newSLOFuncOption(func(o *sloOptions) {
+		o.now = now
+	})
+}
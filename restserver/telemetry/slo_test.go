@@ -0,0 +1,97 @@
+package telemetry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSLOTracker(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	var alerts []BurnRateAlert
+	tr := NewSLOTracker([]SLO{
+		{Route: "", Name: "all", Target: 0.9},
+		{Route: "/v1/users", Target: 0.99},
+	},
+		WithTimeNow(clock),
+		WithBurnRateWindows(BurnRateWindow{Long: time.Hour, Short: 5 * time.Minute, Threshold: 5}),
+		WithAlertFunc(func(a BurnRateAlert) {
+			alerts = append(alerts, a)
+		}),
+	)
+
+	// 10% errors on users: burn rate 10 for 99% target
+	for i := 0; i < 90; i++ {
+		tr.Record("/v1/users/123", http.StatusOK)
+	}
+	for i := 0; i < 10; i++ {
+		tr.Record("/v1/users", http.StatusInternalServerError)
+	}
+	// 4xx is not an error by default
+	tr.Record("/v1/status", http.StatusNotFound)
+	tr.Record("/v1/status", http.StatusOK)
+
+	assert.InDelta(t, 10, tr.BurnRate("/v1/users", time.Hour), 0.001)
+	assert.InDelta(t, 10, tr.BurnRate("/v1/users", 5*time.Minute), 0.001)
+	assert.Equal(t, float64(0), tr.BurnRate("all", time.Hour))
+	assert.Equal(t, float64(0), tr.BurnRate("unknown", time.Hour))
+
+	tr.Evaluate()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "/v1/users", alerts[0].SLO)
+	assert.True(t, alerts[0].Firing)
+	assert.InDelta(t, 10, alerts[0].LongBurnRate, 0.001)
+
+	// no state change
+	tr.Evaluate()
+	assert.Len(t, alerts, 1)
+
+	// short window recovers
+	now = now.Add(10 * time.Minute)
+	for i := 0; i < 10; i++ {
+		tr.Record("/v1/users", http.StatusOK)
+	}
+	assert.InDelta(t, 9.09, tr.BurnRate("/v1/users", time.Hour), 0.01)
+	assert.Equal(t, float64(0), tr.BurnRate("/v1/users", 5*time.Minute))
+
+	tr.Evaluate()
+	require.Len(t, alerts, 2)
+	assert.False(t, alerts[1].Firing)
+
+	// old buckets expire
+	now = now.Add(2 * time.Hour)
+	assert.Equal(t, float64(0), tr.BurnRate("/v1/users", time.Hour))
+}
+
+func TestSLOTracker_Handler(t *testing.T) {
+	tr := NewSLOTracker([]SLO{{Route: "/", Target: 0.5}},
+		WithResolution(time.Second),
+		WithErrorClassifier(func(statusCode int) bool {
+			return statusCode >= http.StatusBadRequest
+		}),
+	)
+
+	status := http.StatusOK
+	h := tr.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/a", nil))
+	status = http.StatusBadRequest
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/b", nil))
+
+	assert.InDelta(t, 1, tr.BurnRate("/", time.Minute), 0.001)
+}
+
+func TestFormatWindow(t *testing.T) {
+	assert.Equal(t, "5m", formatWindow(5*time.Minute))
+	assert.Equal(t, "1h", formatWindow(time.Hour))
+	assert.Equal(t, "1h30m", formatWindow(90*time.Minute))
+	assert.Equal(t, "30s", formatWindow(30*time.Second))
+}
@@ -0,0 +1,40 @@
+package testutils
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a controllable clock for tests,
+// it implements clock.Clock interface
+type Clock struct {
+	lock sync.RWMutex
+	now  time.Time
+}
+
+// NewClock returns Clock set to the given time
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the current time of the clock
+func (c *Clock) Now() time.Time {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.now
+}
+
+// Set sets the current time of the clock
+func (c *Clock) Set(now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = now
+}
+
+// Advance moves the clock forward, and returns the new time
+func (c *Clock) Advance(d time.Duration) time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+	return c.now
+}
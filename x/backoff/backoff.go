@@ -0,0 +1,223 @@
+// Package backoff provides exponential backoff with jitter,
+// per-attempt callbacks, context cancellation and max elapsed time,
+// to retry the operations consistently across the packages.
+package backoff
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/effective-security/porto/x/clock"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultInitialInterval is the default delay before the first retry
+	DefaultInitialInterval = 100 * time.Millisecond
+	// DefaultMaxInterval is the default limit of the delay
+	DefaultMaxInterval = 30 * time.Second
+	// DefaultMultiplier is the default factor of the delay growth
+	DefaultMultiplier = 2.0
+	// DefaultJitter is the default randomization factor of the delay
+	DefaultJitter = 0.5
+)
+
+// maxDuration is returned on overflow
+const maxDuration = time.Duration(math.MaxInt64)
+
+// Config provides configuration of the exponential backoff
+type Config struct {
+	// InitialInterval is the delay before the first retry,
+	// default is DefaultInitialInterval
+	InitialInterval time.Duration `json:"initial_interval,omitempty" yaml:"initial_interval,omitempty"`
+	// MaxInterval limits the delay, default is DefaultMaxInterval
+	MaxInterval time.Duration `json:"max_interval,omitempty" yaml:"max_interval,omitempty"`
+	// Multiplier is the factor of the delay growth, default is DefaultMultiplier
+	Multiplier float64 `json:"multiplier,omitempty" yaml:"multiplier,omitempty"`
+	// Jitter is the randomization factor from 0 to 1,
+	// the delay is randomized in [d*(1-Jitter), d) range,
+	// default is DefaultJitter, negative value disables the jitter
+	Jitter float64 `json:"jitter,omitempty" yaml:"jitter,omitempty"`
+	// MaxElapsedTime limits the total time of the retries, zero value means no limit
+	MaxElapsedTime time.Duration `json:"max_elapsed_time,omitempty" yaml:"max_elapsed_time,omitempty"`
+	// MaxAttempts limits the number of attempts, zero value means no limit
+	MaxAttempts int `json:"max_attempts,omitempty" yaml:"max_attempts,omitempty"`
+}
+
+func (c Config) withDefaults() Config {
+	if c.InitialInterval <= 0 {
+		c.InitialInterval = DefaultInitialInterval
+	}
+	if c.MaxInterval <= 0 {
+		c.MaxInterval = DefaultMaxInterval
+	}
+	if c.Multiplier < 1 {
+		c.Multiplier = DefaultMultiplier
+	}
+	if c.Jitter == 0 {
+		c.Jitter = DefaultJitter
+	}
+	return c
+}
+
+// Delay returns the delay before the next attempt,
+// where retries is the number of already made retries
+func (c Config) Delay(retries int) time.Duration {
+	c = c.withDefaults()
+	d := Exponential(c.InitialInterval, c.Multiplier, retries)
+	if d > c.MaxInterval {
+		d = c.MaxInterval
+	}
+	return Jitter(d, c.Jitter)
+}
+
+// Exponential returns base*multiplier^retries,
+// or the max duration on overflow
+func Exponential(base time.Duration, multiplier float64, retries int) time.Duration {
+	if retries <= 0 || base <= 0 {
+		return base
+	}
+	d := float64(base) * math.Pow(multiplier, float64(retries))
+	if d >= float64(maxDuration) {
+		return maxDuration
+	}
+	return time.Duration(d)
+}
+
+// Jitter returns a random duration in [d*(1-factor), d) range,
+// the factor is limited to [0, 1], zero or negative factor returns d
+func Jitter(d time.Duration, factor float64) time.Duration {
+	if factor <= 0 || d <= 0 {
+		return d
+	}
+	if factor > 1 {
+		factor = 1
+	}
+	span := time.Duration(float64(d) * factor)
+	if span <= 0 {
+		return d
+	}
+	return d - span + rand.N(span)
+}
+
+// Operation is retried until it succeeds,
+// or returns the error wrapped with Permanent
+type Operation func(ctx context.Context) error
+
+// Notify is called after the failed attempt, before the delay,
+// attempt is 1-based
+type Notify func(attempt int, err error, delay time.Duration)
+
+// PermanentError stops the retries
+type PermanentError struct {
+	Err error
+}
+
+// Error returns the error message
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent wraps the error to stop the retries
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// Option configures Retry
+type Option interface {
+	apply(*options)
+}
+
+type options struct {
+	notify Notify
+	clock  clock.Clock
+}
+
+type funcOption struct {
+	f func(*options)
+}
+
+func (fo *funcOption) apply(o *options) {
+	fo.f(o)
+}
+
+func newFuncOption(f func(*options)) *funcOption {
+	return &funcOption{
+		f: f,
+	}
+}
+
+// WithNotify specifies the callback for the failed attempts
+func WithNotify(fn Notify) Option {
+	return newFuncOption(func(o *options) {
+		o.notify = fn
+	})
+}
+
+// WithClock specifies the time source of the elapsed time
+func WithClock(c clock.Clock) Option {
+	return newFuncOption(func(o *options) {
+		o.clock = clock.OrSystem(c)
+	})
+}
+
+// Retry calls the operation until it succeeds, returns a permanent error,
+// the context is cancelled, or the attempts or the elapsed time are exhausted.
+// The error of the last attempt is returned, the permanent error is unwrapped.
+func Retry(ctx context.Context, cfg Config, op Operation, ops ...Option) error {
+	o := options{clock: clock.System}
+	for _, opt := range ops {
+		opt.apply(&o)
+	}
+
+	started := o.clock.Now()
+	for retries := 0; ; retries++ {
+		err := op(ctx)
+		if err == nil {
+			return nil
+		}
+		var perm *PermanentError
+		if errors.As(err, &perm) {
+			return perm.Err
+		}
+		if cfg.MaxAttempts > 0 && retries+1 >= cfg.MaxAttempts {
+			return err
+		}
+
+		delay := cfg.Delay(retries)
+		if cfg.MaxElapsedTime > 0 && clock.Since(o.clock, started)+delay > cfg.MaxElapsedTime {
+			return err
+		}
+		if o.notify != nil {
+			o.notify(retries+1, err, delay)
+		}
+		if werr := Wait(ctx, delay); werr != nil {
+			return errors.WithMessagef(werr, "retry cancelled: %s", err.Error())
+		}
+	}
+}
+
+// Wait waits for the duration, or returns the error when the context is done
+func Wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,109 @@
+package backoff_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/tests/testutils"
+	"github.com/effective-security/porto/x/backoff"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelay(t *testing.T) {
+	base := 100 * time.Millisecond
+	assert.Equal(t, base, backoff.Exponential(base, 2, 0))
+	assert.Equal(t, 8*base, backoff.Exponential(base, 2, 3))
+	assert.Equal(t, time.Duration(1<<63-1), backoff.Exponential(time.Hour, 2, 100))
+	assert.Equal(t, time.Duration(0), backoff.Exponential(0, 2, 3))
+
+	assert.Equal(t, base, backoff.Jitter(base, 0))
+	assert.Equal(t, time.Duration(1), backoff.Jitter(1, 0.5))
+	for i := 0; i < 100; i++ {
+		d := backoff.Jitter(base, 0.5)
+		assert.GreaterOrEqual(t, d, base/2)
+		assert.Less(t, d, base)
+		assert.Less(t, backoff.Jitter(base, 2), base)
+	}
+
+	cfg := backoff.Config{
+		InitialInterval: base,
+		MaxInterval:     time.Second,
+		Jitter:          -1,
+	}
+	assert.Equal(t, base, cfg.Delay(0))
+	assert.Equal(t, 4*base, cfg.Delay(2))
+	assert.Equal(t, time.Second, cfg.Delay(10))
+
+	d := backoff.Config{}.Delay(0)
+	assert.GreaterOrEqual(t, d, backoff.DefaultInitialInterval/2)
+	assert.Less(t, d, backoff.DefaultInitialInterval)
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	cfg := backoff.Config{
+		InitialInterval: time.Millisecond,
+		MaxAttempts:     3,
+	}
+
+	var notified []int
+	calls := 0
+	err := backoff.Retry(ctx, cfg, func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errors.New("failed")
+		}
+		return nil
+	}, backoff.WithNotify(func(attempt int, err error, delay time.Duration) {
+		assert.EqualError(t, err, "failed")
+		assert.Greater(t, delay, time.Duration(0))
+		notified = append(notified, attempt)
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []int{1, 2}, notified)
+
+	// attempts exhausted
+	calls = 0
+	err = backoff.Retry(ctx, cfg, func(context.Context) error {
+		calls++
+		return errors.Errorf("failed %d", calls)
+	})
+	assert.EqualError(t, err, "failed 3")
+
+	// permanent error
+	calls = 0
+	perm := errors.New("permanent")
+	err = backoff.Retry(ctx, cfg, func(context.Context) error {
+		calls++
+		return backoff.Permanent(perm)
+	})
+	assert.Equal(t, perm, err)
+	assert.Equal(t, 1, calls)
+	assert.Nil(t, backoff.Permanent(nil))
+
+	// max elapsed time
+	clk := testutils.NewClock(time.Now())
+	calls = 0
+	err = backoff.Retry(ctx, backoff.Config{InitialInterval: time.Millisecond, MaxElapsedTime: time.Minute},
+		func(context.Context) error {
+			calls++
+			clk.Advance(40 * time.Second)
+			return errors.New("slow")
+		}, backoff.WithClock(clk))
+	assert.EqualError(t, err, "slow")
+	assert.Equal(t, 2, calls)
+
+	// cancelled
+	cctx, cancel := context.WithCancel(ctx)
+	err = backoff.Retry(cctx, backoff.Config{InitialInterval: time.Hour}, func(context.Context) error {
+		cancel()
+		return errors.New("failed")
+	})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Contains(t, err.Error(), "retry cancelled: failed")
+}
@@ -0,0 +1,35 @@
+// Package clock provides the time source, that can be injected
+// into the packages to test the expiry and backoff logic deterministically.
+package clock
+
+import "time"
+
+// Clock provides the current time
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+}
+
+// Func is an adapter to use a function as Clock
+type Func func() time.Time
+
+// Now returns the current time
+func (f Func) Now() time.Time {
+	return f()
+}
+
+// System is the clock of the operating system
+var System Clock = Func(time.Now)
+
+// Since returns the time elapsed since t by the clock
+func Since(c Clock, t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// OrSystem returns c, or System if c is nil
+func OrSystem(c Clock) Clock {
+	if c == nil {
+		return System
+	}
+	return c
+}
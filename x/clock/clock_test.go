@@ -0,0 +1,29 @@
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/tests/testutils"
+	"github.com/effective-security/porto/x/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClock(t *testing.T) {
+	now := time.Now()
+	assert.False(t, clock.System.Now().Before(now))
+	assert.WithinDuration(t, time.Now(), clock.OrSystem(nil).Now(), time.Second)
+
+	fixed := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := clock.Func(func() time.Time { return fixed })
+	assert.Equal(t, fixed, c.Now())
+	assert.Equal(t, time.Hour, clock.Since(c, fixed.Add(-time.Hour)))
+
+	tc := testutils.NewClock(fixed)
+	assert.Equal(t, tc, clock.OrSystem(tc))
+	assert.Equal(t, fixed, tc.Now())
+	assert.Equal(t, fixed.Add(time.Minute), tc.Advance(time.Minute))
+	assert.Equal(t, time.Minute, clock.Since(tc, fixed))
+	tc.Set(fixed)
+	assert.Equal(t, fixed, tc.Now())
+}
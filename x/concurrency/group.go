@@ -0,0 +1,208 @@
+// Package concurrency provides helpers for running goroutines
+// with context propagation, panic recovery, bounded parallelism
+// and consistent logging.
+package concurrency
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/effective-security/porto/x/safecall"
+	"github.com/effective-security/xlog"
+)
+
+var logger = xlog.NewPackageLogger("github.com/effective-security/porto/x", "concurrency")
+
+// Func defines a function to be executed by the Group
+type Func func(ctx context.Context) error
+
+// Group is a collection of goroutines working on subtasks
+// that are part of the same overall task.
+// Similar to errgroup.Group, it cancels the context on the first error,
+// recovers panics into httperror.Error, and optionally limits
+// the number of active goroutines.
+// A Group must be created with NewGroup.
+type Group struct {
+	name   string
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	sem    chan struct{}
+	wg     sync.WaitGroup
+
+	errOnce sync.Once
+	err     error
+}
+
+// NewGroup returns a new Group and an associated Context derived from ctx.
+// The derived Context is canceled the first time a function passed to Go
+// returns a non-nil error, or the first time Wait returns,
+// or when the parent ctx is done, for example on server shutdown.
+func NewGroup(ctx context.Context, opts ...Option) (*Group, context.Context) {
+	dops := options{
+		name: "group",
+	}
+	for _, opt := range opts {
+		opt.apply(&dops)
+	}
+
+	gctx, cancel := context.WithCancelCause(ctx)
+	g := &Group{
+		name:   dops.name,
+		ctx:    gctx,
+		cancel: cancel,
+	}
+	if dops.limit > 0 {
+		g.sem = make(chan struct{}, dops.limit)
+	}
+	return g, gctx
+}
+
+// Name returns the name of the group
+func (g *Group) Name() string {
+	return g.name
+}
+
+// Go calls the given function in a new goroutine.
+// It blocks until the new goroutine can be added without the number of
+// active goroutines in the group exceeding the configured limit.
+// If the group's context is canceled while waiting, the task is not started
+// and the context's error is recorded.
+//
+// The first call to return a non-nil error cancels the group's context;
+// its error will be returned by Wait.
+func (g *Group) Go(name string, f Func) {
+	if g.sem != nil {
+		select {
+		case g.sem <- struct{}{}:
+		case <-g.ctx.Done():
+			g.setError(name, context.Cause(g.ctx))
+			return
+		}
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer g.done()
+		g.run(name, f)
+	}()
+}
+
+// TryGo calls the given function in a new goroutine only if the number of
+// active goroutines in the group is currently below the configured limit.
+// The return value reports whether the goroutine was started.
+func (g *Group) TryGo(name string, f Func) bool {
+	if g.sem != nil {
+		select {
+		case g.sem <- struct{}{}:
+		default:
+			return false
+		}
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer g.done()
+		g.run(name, f)
+	}()
+	return true
+}
+
+// Wait blocks until all function calls from the Go method have returned,
+// then returns the first non-nil error (if any) from them.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel(g.err)
+	return g.err
+}
+
+func (g *Group) done() {
+	if g.sem != nil {
+		<-g.sem
+	}
+	g.wg.Done()
+}
+
+func (g *Group) run(name string, f Func) {
+	started := time.Now()
+	err := Safe(g.ctx, name, f)
+	if err != nil {
+		g.setError(name, err)
+		return
+	}
+	logger.KV(xlog.DEBUG,
+		"group", g.name,
+		"task", name,
+		"elapsed", time.Since(started).String())
+}
+
+func (g *Group) setError(name string, err error) {
+	g.errOnce.Do(func() {
+		logger.KV(xlog.ERROR,
+			"group", g.name,
+			"task", name,
+			"err", err)
+		g.err = err
+		g.cancel(err)
+	})
+}
+
+// Safe executes the function and recovers a panic into httperror.Error
+func Safe(ctx context.Context, name string, f Func) error {
+	return safecall.Call(ctx, name, safecall.Func(f))
+}
+
+// Go starts a named goroutine with panic recovery,
+// the error returned by the function is logged.
+// The returned channel is closed when the function completes.
+func Go(ctx context.Context, name string, f Func) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := Safe(ctx, name, f); err != nil {
+			logger.KV(xlog.ERROR,
+				"task", name,
+				"err", err)
+		}
+	}()
+	return done
+}
+
+// Option configures a Group
+type Option interface {
+	apply(*options)
+}
+
+type options struct {
+	name  string
+	limit int
+}
+
+type funcOption struct {
+	f func(*options)
+}
+
+func (fo *funcOption) apply(o *options) {
+	fo.f(o)
+}
+
+func newFuncOption(f func(*options)) *funcOption {
+	return &funcOption{
+		f: f,
+	}
+}
+
+// WithName specifies the name of the group for logging
+func WithName(name string) Option {
+	return newFuncOption(func(o *options) {
+		o.name = name
+	})
+}
+
+// WithLimit limits the number of active goroutines in the group to at most n.
+// A zero or negative value indicates no limit.
+func WithLimit(n int) Option {
+	return newFuncOption(func(o *options) {
+		o.limit = n
+	})
+}
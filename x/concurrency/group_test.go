@@ -0,0 +1,133 @@
+package concurrency
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroup(t *testing.T) {
+	g, ctx := NewGroup(context.Background(), WithName("test"))
+	assert.Equal(t, "test", g.Name())
+
+	var count int32
+	for i := 0; i < 10; i++ {
+		g.Go("inc", func(context.Context) error {
+			atomic.AddInt32(&count, 1)
+			return nil
+		})
+	}
+	require.NoError(t, g.Wait())
+	assert.Equal(t, int32(10), count)
+	// context is canceled after Wait
+	<-ctx.Done()
+}
+
+func TestGroupError(t *testing.T) {
+	g, ctx := NewGroup(context.Background())
+
+	g.Go("failing", func(context.Context) error {
+		return errors.New("failed")
+	})
+	g.Go("waiting", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	err := g.Wait()
+	require.Error(t, err)
+	assert.Equal(t, "failed", err.Error())
+	assert.Equal(t, err, context.Cause(ctx))
+}
+
+func TestGroupPanic(t *testing.T) {
+	g, _ := NewGroup(context.Background())
+	g.Go("panic", func(context.Context) error {
+		panic("boom")
+	})
+	err := g.Wait()
+	require.Error(t, err)
+
+	var herr *httperror.Error
+	require.True(t, errors.As(err, &herr))
+	assert.Equal(t, httperror.CodeUnexpected, herr.Code)
+	assert.Equal(t, "panic in panic: boom", herr.Message)
+}
+
+func TestGroupLimit(t *testing.T) {
+	g, _ := NewGroup(context.Background(), WithLimit(2))
+
+	var active, maxActive int32
+	for i := 0; i < 10; i++ {
+		g.Go("limited", func(context.Context) error {
+			n := atomic.AddInt32(&active, 1)
+			for {
+				m := atomic.LoadInt32(&maxActive)
+				if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&active, -1)
+			return nil
+		})
+	}
+	require.NoError(t, g.Wait())
+	assert.LessOrEqual(t, maxActive, int32(2))
+}
+
+func TestGroupTryGo(t *testing.T) {
+	g, _ := NewGroup(context.Background(), WithLimit(1))
+
+	block := make(chan struct{})
+	assert.True(t, g.TryGo("first", func(context.Context) error {
+		<-block
+		return nil
+	}))
+	assert.False(t, g.TryGo("second", func(context.Context) error {
+		return nil
+	}))
+	close(block)
+	require.NoError(t, g.Wait())
+}
+
+func TestGroupShutdown(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	g, _ := NewGroup(parent, WithLimit(1))
+
+	release := make(chan struct{})
+	g.Go("blocked", func(context.Context) error {
+		<-release
+		return nil
+	})
+	cancel()
+	// the limit is reached, and the parent is canceled
+	g.Go("not started", func(context.Context) error {
+		t.Error("should not start")
+		return nil
+	})
+	close(release)
+	err := g.Wait()
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestGo(t *testing.T) {
+	done := Go(context.Background(), "panic", func(context.Context) error {
+		panic("boom")
+	})
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	err := Safe(context.Background(), "err", func(context.Context) error {
+		return errors.New("failed")
+	})
+	assert.EqualError(t, err, "failed")
+}
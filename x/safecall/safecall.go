@@ -0,0 +1,67 @@
+// Package safecall provides helpers to call functions,
+// recovering panics into errors with the stack capture,
+// metrics and correlation-aware logging.
+package safecall
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/effective-security/porto/metricskey"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/xlog"
+)
+
+var logger = xlog.NewPackageLogger("github.com/effective-security/porto/x", "safecall")
+
+// Func defines a function to be called
+type Func func(ctx context.Context) error
+
+// PanicError is the cause of the error returned on panic
+type PanicError struct {
+	// Name of the call
+	Name string
+	// Value is returned by recover()
+	Value any
+	// Stack is the stack trace of the panic
+	Stack []byte
+}
+
+// Error implements the error interface
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in %s: %v", e.Name, e.Value)
+}
+
+// Call executes the function, and recovers a panic into httperror.Unexpected,
+// with PanicError as the cause
+func Call(ctx context.Context, name string, fn Func) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = Recovered(ctx, name, r)
+		}
+	}()
+	return fn(ctx)
+}
+
+// Recovered returns the error for the value returned by recover(),
+// to be used in the deferred functions that can not be wrapped by Call.
+// The panic is logged with the stack, and counted in metrics.
+func Recovered(ctx context.Context, name string, r any) error {
+	pe := &PanicError{
+		Name:  name,
+		Value: r,
+		Stack: debug.Stack(),
+	}
+
+	logger.ContextKV(ctx, xlog.ERROR,
+		"reason", "panic",
+		"name", name,
+		"err", r,
+		"stack", string(pe.Stack))
+	metricskey.PanicsRecovered.IncrCounter(1, name)
+
+	return httperror.Unexpected("%s", pe.Error()).
+		WithContext(ctx).
+		WithCause(pe)
+}
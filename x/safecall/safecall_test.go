@@ -0,0 +1,44 @@
+package safecall_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/effective-security/porto/x/safecall"
+	"github.com/effective-security/porto/xhttp/correlation"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCall(t *testing.T) {
+	ctx := correlation.WithID(context.Background())
+
+	err := safecall.Call(ctx, "ok", func(context.Context) error {
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = safecall.Call(ctx, "err", func(context.Context) error {
+		return errors.New("failed")
+	})
+	assert.EqualError(t, err, "failed")
+
+	err = safecall.Call(ctx, "boom", func(context.Context) error {
+		panic("oops")
+	})
+	require.Error(t, err)
+
+	var herr *httperror.Error
+	require.True(t, errors.As(err, &herr))
+	assert.Equal(t, httperror.CodeUnexpected, herr.Code)
+	assert.Equal(t, "panic in boom: oops", herr.Message)
+	assert.Equal(t, correlation.ID(ctx), herr.RequestID)
+
+	var pe *safecall.PanicError
+	require.True(t, errors.As(err, &pe))
+	assert.Equal(t, "boom", pe.Name)
+	assert.Equal(t, "oops", pe.Value)
+	assert.Contains(t, string(pe.Stack), "safecall_test.go")
+}
@@ -0,0 +1,263 @@
+// Package bulk provides helpers for bulk endpoints with partial success semantics.
+//
+// The request contains the list of operations, executed with bounded concurrency.
+// The response contains the status of each operation in the request order,
+// and is returned with 200 OK if all operations succeeded,
+// or 207 Multi-Status otherwise.
+// The errors of operations follow httperror.ManyError conventions.
+package bulk
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/effective-security/porto/x/concurrency"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/porto/xhttp/marshal"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+var logger = xlog.NewPackageLogger("github.com/effective-security/porto/xhttp", "bulk")
+
+const (
+	// DefaultMaxOperations is the default limit of operations in the request
+	DefaultMaxOperations = 1000
+	// DefaultConcurrency is the default number of operations executed concurrently
+	DefaultConcurrency = 10
+)
+
+// Operation is a single operation of the bulk request
+type Operation struct {
+	// ID identifies the operation in the response,
+	// if not provided, then the index of the operation is used
+	ID string `json:"id,omitempty"`
+	// Action is optional, for endpoints that support many kinds of operations
+	Action string `json:"action,omitempty"`
+	// Body is the payload of the operation
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// Decode decodes the body of the operation
+func (o *Operation) Decode(v any) error {
+	if len(o.Body) == 0 {
+		return httperror.InvalidRequest("missing body")
+	}
+	if err := json.Unmarshal(o.Body, v); err != nil {
+		return httperror.New(http.StatusBadRequest, httperror.CodeInvalidJSON, "failed to decode '%T': %s", v, err.Error())
+	}
+	return nil
+}
+
+// Request is the bulk request
+type Request struct {
+	Operations []*Operation `json:"operations"`
+}
+
+// Result is the result of a single operation
+type Result struct {
+	ID     string           `json:"id"`
+	Status int              `json:"status"`
+	Body   json.RawMessage  `json:"body,omitempty"`
+	Error  *httperror.Error `json:"error,omitempty"`
+}
+
+// Decode decodes the body of the result
+func (r *Result) Decode(v any) error {
+	if len(r.Body) == 0 {
+		return errors.Errorf("bulk: no body for %s", r.ID)
+	}
+	return errors.WithStack(json.Unmarshal(r.Body, v))
+}
+
+// Response is the bulk response
+type Response struct {
+	Results   []*Result `json:"results"`
+	Succeeded int       `json:"succeeded"`
+	Failed    int       `json:"failed"`
+}
+
+// Status returns 200 OK if all operations succeeded, or 207 Multi-Status otherwise
+func (r *Response) Status() int {
+	if r.Failed > 0 {
+		return http.StatusMultiStatus
+	}
+	return http.StatusOK
+}
+
+// Result returns the result of the operation by ID, or nil if not found
+func (r *Response) Result(id string) *Result {
+	for _, res := range r.Results {
+		if res.ID == id {
+			return res
+		}
+	}
+	return nil
+}
+
+// Err returns httperror.ManyError with the errors of failed operations
+// keyed by the operation ID, or nil if all operations succeeded
+func (r *Response) Err() error {
+	if r.Failed == 0 {
+		return nil
+	}
+	m := httperror.NewMany(http.StatusMultiStatus, httperror.CodeRequestFailed,
+		"%d of %d operations failed", r.Failed, len(r.Results))
+	for _, res := range r.Results {
+		if res.Error != nil {
+			if res.Error.HTTPStatus == 0 {
+				// decoded by the client
+				res.Error.HTTPStatus = res.Status
+			}
+			m.Add(res.ID, res.Error)
+		}
+	}
+	return m
+}
+
+// Executor executes a single operation, and returns the body of the result
+type Executor func(ctx context.Context, op *Operation) (any, error)
+
+// Config provides configuration of the bulk processor
+type Config struct {
+	// MaxOperations is the limit of operations in the request, default is DefaultMaxOperations
+	MaxOperations int `json:"max_operations,omitempty" yaml:"max_operations,omitempty"`
+	// Concurrency is the number of operations executed concurrently, default is DefaultConcurrency
+	Concurrency int `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
+}
+
+// Processor executes bulk requests
+type Processor struct {
+	cfg Config
+}
+
+// New returns Processor
+func New(cfg Config) *Processor {
+	if cfg.MaxOperations <= 0 {
+		cfg.MaxOperations = DefaultMaxOperations
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = DefaultConcurrency
+	}
+	return &Processor{cfg: cfg}
+}
+
+// Validate validates the request, and assigns the missing operation IDs
+func (p *Processor) Validate(req *Request) error {
+	if len(req.Operations) == 0 {
+		return httperror.InvalidRequest("no operations")
+	}
+	if len(req.Operations) > p.cfg.MaxOperations {
+		return httperror.RequestTooLarge("number of operations exceeds %d", p.cfg.MaxOperations)
+	}
+	ids := make(map[string]bool, len(req.Operations))
+	for i, op := range req.Operations {
+		if op == nil {
+			return httperror.InvalidRequest("operation %d is null", i)
+		}
+		if op.ID == "" {
+			op.ID = strconv.Itoa(i)
+		}
+		if ids[op.ID] {
+			return httperror.InvalidRequest("duplicate operation ID: %s", op.ID)
+		}
+		ids[op.ID] = true
+	}
+	return nil
+}
+
+// Execute executes the operations with bounded concurrency,
+// a failed operation does not cancel others
+func (p *Processor) Execute(ctx context.Context, ops []*Operation, exec Executor) *Response {
+	res := &Response{
+		Results: make([]*Result, len(ops)),
+	}
+
+	sem := make(chan struct{}, p.cfg.Concurrency)
+	var wg sync.WaitGroup
+	for i, op := range ops {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			e := httperror.Timeout("operation was not started: %s", ctx.Err().Error())
+			res.Results[i] = &Result{ID: op.ID, Status: e.HTTPStatus, Error: e}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, op *Operation) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			res.Results[i] = execute(ctx, op, exec)
+		}(i, op)
+	}
+	wg.Wait()
+
+	for _, r := range res.Results {
+		if r.Error != nil {
+			res.Failed++
+		} else {
+			res.Succeeded++
+		}
+	}
+	return res
+}
+
+func execute(ctx context.Context, op *Operation, exec Executor) *Result {
+	var body any
+	err := concurrency.Safe(ctx, "bulk_"+op.ID, func(ctx context.Context) error {
+		var err error
+		body, err = exec(ctx, op)
+		return err
+	})
+	if err == nil && body != nil {
+		var b []byte
+		if b, err = json.Marshal(body); err == nil {
+			return &Result{ID: op.ID, Status: http.StatusOK, Body: b}
+		}
+		err = httperror.Unexpected("failed to encode result: %s", err.Error())
+	}
+	if err == nil {
+		return &Result{ID: op.ID, Status: http.StatusOK}
+	}
+
+	// same as httperror.ManyError.Add
+	var e *httperror.Error
+	if !errors.As(err, &e) {
+		e = httperror.Unexpected("%s", err.Error()).WithCause(err)
+	}
+	logger.ContextKV(ctx, xlog.DEBUG,
+		"id", op.ID,
+		"status", e.HTTPStatus,
+		"err", e.Error())
+	return &Result{ID: op.ID, Status: e.HTTPStatus, Error: e}
+}
+
+// NewHandler returns http.Handler for the bulk endpoint
+func (p *Processor) NewHandler(exec Executor) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := new(Request)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			marshal.WriteJSON(w, r, httperror.New(http.StatusBadRequest, httperror.CodeInvalidJSON,
+				"failed to decode '%T': %s", req, err.Error()).WithCause(err))
+			return
+		}
+		if err := p.Validate(req); err != nil {
+			marshal.WriteJSON(w, r, err)
+			return
+		}
+
+		res := p.Execute(r.Context(), req.Operations, exec)
+
+		w.Header().Set(header.ContentType, header.ApplicationJSON)
+		w.WriteHeader(res.Status())
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			logger.ContextKV(r.Context(), xlog.WARNING, "reason", "encode", "err", err.Error())
+		}
+	})
+}
@@ -0,0 +1,160 @@
+package bulk_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/xhttp/bulk"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type item struct {
+	Name string `json:"name"`
+}
+
+func exec(_ context.Context, op *bulk.Operation) (any, error) {
+	var it item
+	if err := op.Decode(&it); err != nil {
+		return nil, err
+	}
+	switch it.Name {
+	case "conflict":
+		return nil, httperror.Conflict("already exists")
+	case "fail":
+		return nil, errors.New("database error")
+	case "panic":
+		panic("boom")
+	case "empty":
+		return nil, nil
+	}
+	return &item{Name: strings.ToUpper(it.Name)}, nil
+}
+
+func TestValidate(t *testing.T) {
+	p := bulk.New(bulk.Config{MaxOperations: 2})
+
+	assert.EqualError(t, p.Validate(&bulk.Request{}), "invalid_request: no operations")
+	assert.EqualError(t, p.Validate(&bulk.Request{Operations: []*bulk.Operation{{}, {}, {}}}),
+		"request_too_large: number of operations exceeds 2")
+	assert.EqualError(t, p.Validate(&bulk.Request{Operations: []*bulk.Operation{{ID: "1"}, {ID: "1"}}}),
+		"invalid_request: duplicate operation ID: 1")
+	assert.EqualError(t, p.Validate(&bulk.Request{Operations: []*bulk.Operation{{}, nil}}),
+		"invalid_request: operation 1 is null")
+
+	req := &bulk.Request{Operations: []*bulk.Operation{{}, {ID: "b"}}}
+	require.NoError(t, p.Validate(req))
+	assert.Equal(t, "0", req.Operations[0].ID)
+	assert.Equal(t, "b", req.Operations[1].ID)
+}
+
+func TestExecute(t *testing.T) {
+	p := bulk.New(bulk.Config{Concurrency: 2})
+
+	var active, peak int32
+	res := p.Execute(context.Background(), ops("a", "b", "c", "d", "e"), func(ctx context.Context, op *bulk.Operation) (any, error) {
+		n := atomic.AddInt32(&active, 1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&active, -1)
+		return exec(ctx, op)
+	})
+	assert.LessOrEqual(t, peak, int32(2))
+	assert.Equal(t, 5, res.Succeeded)
+	assert.Equal(t, http.StatusOK, res.Status())
+	assert.NoError(t, res.Err())
+	for i, id := range []string{"a", "b", "c", "d", "e"} {
+		assert.Equal(t, id, res.Results[i].ID)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res = bulk.New(bulk.Config{Concurrency: 1}).Execute(ctx, ops("a", "b", "c"), func(ctx context.Context, op *bulk.Operation) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	assert.Equal(t, 3, res.Failed)
+}
+
+func ops(names ...string) []*bulk.Operation {
+	var list []*bulk.Operation
+	for _, n := range names {
+		b, _ := json.Marshal(&item{Name: n})
+		list = append(list, &bulk.Operation{ID: n, Body: b})
+	}
+	return list
+}
+
+func TestHandler(t *testing.T) {
+	h := bulk.New(bulk.Config{}).NewHandler(exec)
+
+	serve := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/items:bulk", strings.NewReader(body)))
+		return w
+	}
+
+	w := serve(`{"operations":[
+		{"id":"1","body":{"name":"alice"}},
+		{"id":"2","body":{"name":"conflict"}},
+		{"id":"3","body":{"name":"fail"}},
+		{"id":"4","body":{"name":"panic"}},
+		{"id":"5","body":{"name":"empty"}},
+		{"id":"6"}
+	]}`)
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
+
+	var res bulk.Response
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+	assert.Equal(t, 2, res.Succeeded)
+	assert.Equal(t, 4, res.Failed)
+
+	r := res.Result("1")
+	require.NotNil(t, r)
+	assert.Equal(t, http.StatusOK, r.Status)
+	var it item
+	require.NoError(t, r.Decode(&it))
+	assert.Equal(t, "ALICE", it.Name)
+
+	r = res.Result("2")
+	assert.Equal(t, http.StatusConflict, r.Status)
+	assert.Equal(t, httperror.CodeConflict, r.Error.Code)
+	assert.Equal(t, http.StatusInternalServerError, res.Result("3").Status)
+	assert.Equal(t, "database error", res.Result("3").Error.Message)
+	assert.Contains(t, res.Result("4").Error.Message, "panic in bulk_4: boom")
+	assert.Equal(t, http.StatusOK, res.Result("5").Status)
+	assert.EqualError(t, res.Result("5").Decode(&it), "bulk: no body for 5")
+	assert.Equal(t, http.StatusBadRequest, res.Result("6").Status)
+	assert.Nil(t, res.Result("7"))
+
+	err := res.Err()
+	var many *httperror.ManyError
+	require.True(t, errors.As(err, &many))
+	assert.Equal(t, "request_failed: 4 of 6 operations failed", many.Error())
+	assert.Len(t, many.Errors, 4)
+	assert.Equal(t, http.StatusConflict, many.Errors["2"].HTTPStatus)
+
+	w = serve(`{"operations":[{"body":{"name":"bob"}}]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"id":"0"`)
+
+	w = serve(`{`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_json")
+
+	w = serve(`{"operations":[]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
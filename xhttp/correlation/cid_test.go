@@ -45,6 +45,21 @@ func TestCorrelationID(t *testing.T) {
 	assert.Equal(t, cid, md[CorrelationIDgRPCHeaderName][0])
 }
 
+func TestWithIDValue(t *testing.T) {
+	ctx := WithIDValue(context.Background(), "4bf92f3577b34da6a3ce929d0e0e4736")
+	assert.Equal(t, "4bf92f3577b3", ID(ctx))
+
+	// the existing ID is preserved
+	assert.Equal(t, "4bf92f3577b3", ID(WithIDValue(ctx, "other")))
+
+	// the interceptor uses the existing ID
+	_, err := NewAuthUnaryInterceptor()(ctx, nil, nil, func(ctx context.Context, _ any) (any, error) {
+		assert.Equal(t, "4bf92f3577b3", ID(ctx))
+		return nil, nil
+	})
+	require.NoError(t, err)
+}
+
 func Test_grpcFromContext(t *testing.T) {
 	t.Run("default", func(t *testing.T) {
 		unary := NewAuthUnaryInterceptor()
@@ -75,6 +75,8 @@ func NewAuthUnaryInterceptor() grpc.UnaryServerInterceptor {
 				ID: correlationIDFromGRPC(ctx),
 			}
 			ctx = context.WithValue(ctx, keyContext, rctx)
+		} else {
+			rctx = v.(*RequestContext)
 		}
 
 		// add correlationID to logs as "ctx"
@@ -177,6 +179,21 @@ func WithID(ctx context.Context) context.Context {
 	return ctx
 }
 
+// WithIDValue returns context with the provided Correlation ID,
+// if the context alread has Correlation ID,
+// the original is returned
+func WithIDValue(ctx context.Context, id string) context.Context {
+	v := ctx.Value(keyContext)
+	if v == nil {
+		rctx := &RequestContext{
+			ID: slices.StringUpto(id, IDSize),
+		}
+		ctx = context.WithValue(ctx, keyContext, rctx)
+		ctx = xlog.ContextWithKV(ctx, "ctx", rctx.ID)
+	}
+	return ctx
+}
+
 // WithMetaFromContext returns context with Correlation ID
 // for the outgoing gRPC call
 func WithMetaFromContext(ctx context.Context) context.Context {
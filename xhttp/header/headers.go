@@ -5,55 +5,161 @@ const (
 	Accept = "Accept"
 	// AcceptEncoding is HTTP header for "Accept-Encoding"
 	AcceptEncoding = "Accept-Encoding"
+	// AccessControlAllowCredentials is HTTP header for "Access-Control-Allow-Credentials"
+	AccessControlAllowCredentials = "Access-Control-Allow-Credentials"
+	// AccessControlAllowHeaders is HTTP header for "Access-Control-Allow-Headers"
+	AccessControlAllowHeaders = "Access-Control-Allow-Headers"
+	// AccessControlAllowMethods is HTTP header for "Access-Control-Allow-Methods"
+	AccessControlAllowMethods = "Access-Control-Allow-Methods"
+	// AccessControlAllowOrigin is HTTP header for "Access-Control-Allow-Origin"
+	AccessControlAllowOrigin = "Access-Control-Allow-Origin"
+	// AccessControlExposeHeaders is HTTP header for "Access-Control-Expose-Headers"
+	AccessControlExposeHeaders = "Access-Control-Expose-Headers"
+	// AccessControlMaxAge is HTTP header for "Access-Control-Max-Age"
+	AccessControlMaxAge = "Access-Control-Max-Age"
+	// AccessControlRequestHeaders is HTTP header for "Access-Control-Request-Headers"
+	AccessControlRequestHeaders = "Access-Control-Request-Headers"
+	// AccessControlRequestMethod is HTTP header for "Access-Control-Request-Method"
+	AccessControlRequestMethod = "Access-Control-Request-Method"
+	// Age is HTTP header for "Age"
+	Age = "Age"
+	// Allow is HTTP header for "Allow"
+	Allow = "Allow"
+	// AltSvc is HTTP header for "Alt-Svc"
+	AltSvc = "Alt-Svc"
 	// ApplicationJSON is HTTP header value for "application/json"
 	ApplicationJSON = "application/json"
 	// ApplicationJoseJSON is HTTP header value for "application/jose+json"
 	ApplicationJoseJSON = "application/jose+json"
+	// ApplicationFormURLEncoded is HTTP header value for "application/x-www-form-urlencoded"
+	ApplicationFormURLEncoded = "application/x-www-form-urlencoded"
 	// ApplicationGRPC is HTTP header value for "application/grpc"
 	ApplicationGRPC = "application/grpc"
 	// ApplicationGRPCWebProto is HTTP header value for "application/grpc-web+proto"
 	ApplicationGRPCWebProto = "application/grpc-web+proto"
+	// ApplicationGRPCWebText is HTTP header value for "application/grpc-web-text"
+	ApplicationGRPCWebText = "application/grpc-web-text"
 	// ApplicationTimestampQuery is HTTP header value for RFC3161 Timestamp request
 	ApplicationTimestampQuery = "application/timestamp-query"
 	// ApplicationTimestampReply is HTTP header value for RFC3161 Timestamp response
 	ApplicationTimestampReply = "application/timestamp-reply"
+	// ApplicationSOAPXML is HTTP header value for "application/soap+xml"
+	ApplicationSOAPXML = "application/soap+xml"
+	// ApplicationXML is HTTP header value for "application/xml"
+	ApplicationXML = "application/xml"
+	// ApplicationNDJSON is HTTP header value for "application/x-ndjson"
+	ApplicationNDJSON = "application/x-ndjson"
+	// ApplicationMsgpack is HTTP header value for "application/msgpack"
+	ApplicationMsgpack = "application/msgpack"
 	// Authorization is HTTP header for "Authorization"
 	Authorization = "Authorization"
 	// Bearer is token type for "Authorization" header
 	Bearer = "Bearer"
+	// Deprecation is HTTP header for "Deprecation"
+	Deprecation = "Deprecation"
+	// Date is HTTP header for "Date"
+	Date = "Date"
 	// DPoP is token type for "Authorization" header,
 	// and header name for DPoP
 	DPoP = "DPoP"
 	// CacheControl is HTTP header for "Cache-Control"
 	CacheControl = "Cache-Control"
+	// Connection is HTTP header for "Connection"
+	Connection = "Connection"
 	// ContentDisposition is HTTP header for "Content-Disposition"
 	ContentDisposition = "Content-Disposition"
 	// ContentEncoding is HTTP header for "Content-Encoding"
 	ContentEncoding = "Content-Encoding"
 	// ContentLength is HTTP header for "Content-Length"
 	ContentLength = "Content-Length"
+	// ContentMD5 is HTTP header for "Content-MD5"
+	ContentMD5 = "Content-MD5"
+	// ContentRange is HTTP header for "Content-Range"
+	ContentRange = "Content-Range"
 	// ContentType is HTTP header for "Content-Type"
 	ContentType = "Content-Type"
+	// ETag is HTTP header for "ETag"
+	ETag = "ETag"
 	// Gzip content type for "gzip"
 	Gzip = "gzip"
+	// IdempotencyKey is HTTP header for "Idempotency-Key"
+	IdempotencyKey = "Idempotency-Key"
+	// IdempotentReplayed is HTTP header for "Idempotent-Replayed"
+	IdempotentReplayed = "Idempotent-Replayed"
 	// IfMatch is HTTP header for "If-Match"
 	IfMatch = "If-Match"
+	// IfModifiedSince is HTTP header for "If-Modified-Since"
+	IfModifiedSince = "If-Modified-Since"
+	// IfNoneMatch is HTTP header for "If-None-Match"
+	IfNoneMatch = "If-None-Match"
+	// IfRange is HTTP header for "If-Range"
+	IfRange = "If-Range"
+	// LastEventID is HTTP header for "Last-Event-ID"
+	LastEventID = "Last-Event-ID"
+	// LastModified is HTTP header for "Last-Modified"
+	LastModified = "Last-Modified"
 	// Link is HTTP header for "Link"
 	Link = "Link"
 	// Location is HTTP header for "Location"
 	Location = "Location"
+	// Origin is HTTP header for "Origin"
+	Origin = "Origin"
+	// Range is HTTP header for "Range"
+	Range = "Range"
 	// ReplayNonce is HTTP header for "Replay-Nonce"
 	ReplayNonce = "Replay-Nonce"
+	// RetryAfter is HTTP header for "Retry-After"
+	RetryAfter = "Retry-After"
+	// SecWebSocketAccept is HTTP header for "Sec-WebSocket-Accept"
+	SecWebSocketAccept = "Sec-WebSocket-Accept"
+	// SecWebSocketKey is HTTP header for "Sec-WebSocket-Key"
+	SecWebSocketKey = "Sec-WebSocket-Key"
+	// SecWebSocketProtocol is HTTP header for "Sec-WebSocket-Protocol"
+	SecWebSocketProtocol = "Sec-WebSocket-Protocol"
+	// SecWebSocketVersion is HTTP header for "Sec-WebSocket-Version"
+	SecWebSocketVersion = "Sec-WebSocket-Version"
+	// SetCookie is HTTP header for "Set-Cookie"
+	SetCookie = "Set-Cookie"
+	// Sunset is HTTP header for "Sunset"
+	Sunset = "Sunset"
+	// SOAPAction is HTTP header for "SOAPAction"
+	SOAPAction = "SOAPAction"
+	// TextEventStream is HTTP header value for "text/event-stream"
+	TextEventStream = "text/event-stream"
 	// TextPlain is HTTP header value for "application/json"
 	TextPlain = "text/plain"
+	// TextXML is HTTP header value for "text/xml"
+	TextXML = "text/xml"
+	// Upgrade is HTTP header for "Upgrade"
+	Upgrade = "Upgrade"
+	// Vary is HTTP header for "Vary"
+	Vary = "Vary"
 	// UserAgent is HTTP header value for "User-Agent"
 	UserAgent = "User-Agent"
+	// XHTTPMethodOverride is HTTP header for "X-HTTP-Method-Override"
+	XHTTPMethodOverride = "X-HTTP-Method-Override"
 	// XHostname contains the name of the HTTP header to indicate which host requested the signature
 	XHostname = "X-HostName"
+	// XAPIVersion is HTTP header for "X-API-Version"
+	XAPIVersion = "X-API-Version"
+	// XCacheStatus is HTTP header for "X-Cache-Status"
+	XCacheStatus = "X-Cache-Status"
 	// XCorrelationID is HTTP header for "X-Correlation-ID"
 	XCorrelationID = "X-Correlation-ID"
+	// XRequestID is HTTP header for "X-Request-ID"
+	XRequestID = "X-Request-ID"
 	// XDeviceID is HTTP header for "X-Device-ID"
 	XDeviceID = "X-Device-ID"
+	// XProcessingHint is HTTP header for "X-Processing-Hint",
+	// the estimated processing time in seconds
+	XProcessingHint = "X-Processing-Hint"
+	// XRateLimitLimit is HTTP header for "X-RateLimit-Limit"
+	XRateLimitLimit = "X-RateLimit-Limit"
+	// XRateLimitRemaining is HTTP header for "X-RateLimit-Remaining"
+	XRateLimitRemaining = "X-RateLimit-Remaining"
+	// XRateLimitReset is HTTP header for "X-RateLimit-Reset",
+	// the number of seconds until the limit is reset
+	XRateLimitReset = "X-RateLimit-Reset"
 	// XFilename contains the name of the artifact to sign
 	XFilename = "X-Filename"
 	// XForwardedProto contains the protocol
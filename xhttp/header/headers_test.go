@@ -9,23 +9,67 @@ import (
 
 func Test_Headers(t *testing.T) {
 	assert.Equal(t, "Accept", header.Accept)
+	assert.Equal(t, "Access-Control-Allow-Credentials", header.AccessControlAllowCredentials)
+	assert.Equal(t, "Access-Control-Allow-Headers", header.AccessControlAllowHeaders)
+	assert.Equal(t, "Access-Control-Allow-Methods", header.AccessControlAllowMethods)
+	assert.Equal(t, "Access-Control-Allow-Origin", header.AccessControlAllowOrigin)
+	assert.Equal(t, "Access-Control-Expose-Headers", header.AccessControlExposeHeaders)
+	assert.Equal(t, "Access-Control-Max-Age", header.AccessControlMaxAge)
+	assert.Equal(t, "Access-Control-Request-Headers", header.AccessControlRequestHeaders)
+	assert.Equal(t, "Access-Control-Request-Method", header.AccessControlRequestMethod)
+	assert.Equal(t, "Age", header.Age)
+	assert.Equal(t, "Allow", header.Allow)
+	assert.Equal(t, "Alt-Svc", header.AltSvc)
 	assert.Equal(t, "application/json", header.ApplicationJSON)
 	assert.Equal(t, "application/jose+json", header.ApplicationJoseJSON)
+	assert.Equal(t, "application/x-www-form-urlencoded", header.ApplicationFormURLEncoded)
 	assert.Equal(t, "application/grpc", header.ApplicationGRPC)
+	assert.Equal(t, "application/grpc-web-text", header.ApplicationGRPCWebText)
 	assert.Equal(t, "application/timestamp-query", header.ApplicationTimestampQuery)
 	assert.Equal(t, "application/timestamp-reply", header.ApplicationTimestampReply)
+	assert.Equal(t, "application/soap+xml", header.ApplicationSOAPXML)
+	assert.Equal(t, "application/xml", header.ApplicationXML)
+	assert.Equal(t, "application/x-ndjson", header.ApplicationNDJSON)
+	assert.Equal(t, "application/msgpack", header.ApplicationMsgpack)
 	assert.Equal(t, "Authorization", header.Authorization)
 	assert.Equal(t, "Bearer", header.Bearer)
 	assert.Equal(t, "Cache-Control", header.CacheControl)
 	assert.Equal(t, "Content-Type", header.ContentType)
 	assert.Equal(t, "Content-Disposition", header.ContentDisposition)
+	assert.Equal(t, "Connection", header.Connection)
+	assert.Equal(t, "Content-MD5", header.ContentMD5)
+	assert.Equal(t, "Content-Range", header.ContentRange)
+	assert.Equal(t, "ETag", header.ETag)
+	assert.Equal(t, "If-Modified-Since", header.IfModifiedSince)
+	assert.Equal(t, "If-None-Match", header.IfNoneMatch)
+	assert.Equal(t, "If-Range", header.IfRange)
+	assert.Equal(t, "Last-Modified", header.LastModified)
+	assert.Equal(t, "Origin", header.Origin)
+	assert.Equal(t, "Range", header.Range)
+	assert.Equal(t, "Date", header.Date)
+	assert.Equal(t, "Deprecation", header.Deprecation)
+	assert.Equal(t, "Idempotency-Key", header.IdempotencyKey)
+	assert.Equal(t, "Idempotent-Replayed", header.IdempotentReplayed)
 	assert.Equal(t, "If-Match", header.IfMatch)
 	assert.Equal(t, "Replay-Nonce", header.ReplayNonce)
+	assert.Equal(t, "Set-Cookie", header.SetCookie)
+	assert.Equal(t, "Sunset", header.Sunset)
+	assert.Equal(t, "SOAPAction", header.SOAPAction)
 	assert.Equal(t, "text/plain", header.TextPlain)
+	assert.Equal(t, "text/xml", header.TextXML)
+	assert.Equal(t, "Vary", header.Vary)
 	assert.Equal(t, "User-Agent", header.UserAgent)
 	assert.Equal(t, "X-HostName", header.XHostname)
+	assert.Equal(t, "X-HTTP-Method-Override", header.XHTTPMethodOverride)
+	assert.Equal(t, "X-API-Version", header.XAPIVersion)
+	assert.Equal(t, "X-Cache-Status", header.XCacheStatus)
 	assert.Equal(t, "X-Correlation-ID", header.XCorrelationID)
+	assert.Equal(t, "X-Request-ID", header.XRequestID)
 	assert.Equal(t, "X-Device-ID", header.XDeviceID)
 	assert.Equal(t, "X-Filename", header.XFilename)
+	assert.Equal(t, "X-Processing-Hint", header.XProcessingHint)
+	assert.Equal(t, "X-RateLimit-Limit", header.XRateLimitLimit)
+	assert.Equal(t, "X-RateLimit-Remaining", header.XRateLimitRemaining)
+	assert.Equal(t, "X-RateLimit-Reset", header.XRateLimitReset)
 	assert.Equal(t, "X-Forwarded-Proto", header.XForwardedProto)
 }
@@ -31,6 +31,8 @@ const (
 	CodeInvalidRequest = "invalid_request"
 	// CodeMalformed is returned when the request was malformed.
 	CodeMalformed = "malformed"
+	// CodeNotAllowed is returned when the method is not allowed for the requested URL.
+	CodeNotAllowed = "not_allowed"
 	// CodeNotFound is returned when the requested URL doesn't exist.
 	CodeNotFound = "not_found"
 	// CodeNotReady is returned when the service is not ready to serve
@@ -49,6 +51,8 @@ const (
 	CodeUnauthorized = "unauthorized"
 	// CodeUnexpected is returned when something went wrong.
 	CodeUnexpected = "unexpected"
+	// CodeUnsupportedVersion is returned when the requested API version is not supported.
+	CodeUnsupportedVersion = "unsupported_version"
 )
 
 var httpCode = map[int]string{
@@ -266,6 +270,18 @@ func HTTPStatusFromRPC(c codes.Code) int {
 	return codeStatus[c]
 }
 
+// RPCStatusFromCode returns gRPC code for the error code,
+// or for HTTP status if the error code is not known
+func RPCStatusFromCode(code string, httpStatus int) codes.Code {
+	if c, ok := statusCode[code]; ok {
+		return c
+	}
+	if c, ok := statusCode[httpCode[httpStatus]]; ok {
+		return c
+	}
+	return codes.Unknown
+}
+
 var statusCode = map[string]codes.Code{
 	CodeAccountNotFound:         codes.NotFound,
 	CodeBadNonce:                codes.InvalidArgument,
@@ -287,6 +303,7 @@ var statusCode = map[string]codes.Code{
 	CodeTooEarly:                codes.ResourceExhausted,
 	CodeUnauthorized:            codes.PermissionDenied,
 	CodeUnexpected:              codes.Internal,
+	CodeUnsupportedVersion:      codes.InvalidArgument,
 
 	"bad_request": codes.InvalidArgument,
 	//"unauthorized":           codes.PermissionDenied,
@@ -20,12 +20,14 @@ func Test_ErrorCodes(t *testing.T) {
 	assert.Equal(t, "invalid_parameter", httperror.CodeInvalidParam)
 	assert.Equal(t, "invalid_request", httperror.CodeInvalidRequest)
 	assert.Equal(t, "malformed", httperror.CodeMalformed)
+	assert.Equal(t, "not_allowed", httperror.CodeNotAllowed)
 	assert.Equal(t, "not_found", httperror.CodeNotFound)
 	assert.Equal(t, "not_ready", httperror.CodeNotReady)
 	assert.Equal(t, "rate_limit_exceeded", httperror.CodeRateLimitExceeded)
 	assert.Equal(t, "request_body", httperror.CodeFailedToReadRequestBody)
 	assert.Equal(t, "request_too_large", httperror.CodeRequestTooLarge)
 	assert.Equal(t, "unauthorized", httperror.CodeUnauthorized)
+	assert.Equal(t, "unsupported_version", httperror.CodeUnsupportedVersion)
 	assert.Equal(t, "unexpected", httperror.CodeUnexpected)
 }
 
@@ -43,6 +45,7 @@ func Test_StatusCodes(t *testing.T) {
 		{httperror.InvalidContentType("1"), http.StatusBadRequest, "invalid_content_type: 1"},
 		{httperror.ContentLengthRequired(), http.StatusBadRequest, "content_length_required: Content-Length header not provided"},
 		{httperror.NotFound("1"), http.StatusNotFound, "not_found: 1"},
+		{httperror.MethodNotAllowed("1"), http.StatusMethodNotAllowed, "not_allowed: 1"},
 		{httperror.RequestTooLarge("1"), http.StatusBadRequest, "request_too_large: 1"},
 		{httperror.FailedToReadRequestBody("1"), http.StatusInternalServerError, "request_body: 1"},
 		{httperror.RateLimitExceeded("1"), http.StatusTooManyRequests, "rate_limit_exceeded: 1"},
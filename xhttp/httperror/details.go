@@ -0,0 +1,236 @@
+package httperror
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/effective-security/porto/xhttp/header"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Details provides additional information about the error,
+// compatible with google.rpc error details
+type Details struct {
+	// Domain is the logical grouping of the error code, as in google.rpc.ErrorInfo
+	Domain string `json:"domain,omitempty"`
+	// Metadata provides additional structured information, as in google.rpc.ErrorInfo
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// RetryAfter specifies the delay before the client should retry,
+	// sent as google.rpc.RetryInfo or Retry-After header
+	RetryAfter time.Duration `json:"-"`
+	// ProcessingHint specifies the estimated processing time of the request,
+	// sent as ErrorInfo metadata or X-Processing-Hint header
+	ProcessingHint time.Duration `json:"-"`
+	// Violations describes invalid fields in the request, as in google.rpc.BadRequest
+	Violations []*FieldViolation `json:"violations,omitempty"`
+}
+
+// FieldViolation describes a single invalid field in the request
+type FieldViolation struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+func (e *Error) details() *Details {
+	if e.Details == nil {
+		e.Details = &Details{}
+	}
+	return e.Details
+}
+
+// WithErrorInfo adds the domain and metadata of the error
+func (e *Error) WithErrorInfo(domain string, metadata map[string]string) *Error {
+	d := e.details()
+	d.Domain = domain
+	d.Metadata = metadata
+	return e
+}
+
+// WithRetryAfter adds the delay before the client should retry
+func (e *Error) WithRetryAfter(delay time.Duration) *Error {
+	e.details().RetryAfter = delay
+	return e
+}
+
+// WithProcessingHint adds the estimated processing time of the request,
+// the client should not retry before the hint elapses
+func (e *Error) WithProcessingHint(d time.Duration) *Error {
+	e.details().ProcessingHint = d
+	return e
+}
+
+// WithFieldViolation adds the description of invalid field
+func (e *Error) WithFieldViolation(field, description string) *Error {
+	d := e.details()
+	d.Violations = append(d.Violations, &FieldViolation{
+		Field:       field,
+		Description: description,
+	})
+	return e
+}
+
+// RetryAfter returns the delay before the client should retry,
+// or zero if not specified
+func (e *Error) RetryAfter() time.Duration {
+	if e.Details == nil {
+		return 0
+	}
+	return e.Details.RetryAfter
+}
+
+// ProcessingHint returns the estimated processing time of the request,
+// or zero if not specified
+func (e *Error) ProcessingHint() time.Duration {
+	if e.Details == nil {
+		return 0
+	}
+	return e.Details.ProcessingHint
+}
+
+// processingHintKey is the ErrorInfo metadata key for the processing hint
+const processingHintKey = "porto.processing_hint"
+
+// withDetails returns status with ErrorInfo, RetryInfo and BadRequest details
+func withDetails(st *status.Status, code string, d *Details) *status.Status {
+	info := &errdetails.ErrorInfo{
+		Reason: code,
+	}
+	if d != nil {
+		info.Domain = d.Domain
+		info.Metadata = d.Metadata
+		if d.ProcessingHint > 0 {
+			info.Metadata = make(map[string]string, len(d.Metadata)+1)
+			for k, v := range d.Metadata {
+				info.Metadata[k] = v
+			}
+			info.Metadata[processingHintKey] = d.ProcessingHint.String()
+		}
+	}
+
+	dst, err := st.WithDetails(info)
+	if err != nil {
+		return st
+	}
+	if d == nil {
+		return dst
+	}
+
+	if d.RetryAfter > 0 {
+		if s, err := dst.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(d.RetryAfter)}); err == nil {
+			dst = s
+		}
+	}
+	if len(d.Violations) > 0 {
+		br := &errdetails.BadRequest{}
+		for _, v := range d.Violations {
+			br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       v.Field,
+				Description: v.Description,
+			})
+		}
+		if s, err := dst.WithDetails(br); err == nil {
+			dst = s
+		}
+	}
+	return dst
+}
+
+// fromDetails populates the error from ErrorInfo, RetryInfo and BadRequest details
+func (e *Error) fromDetails(st *status.Status) {
+	for _, detail := range st.Details() {
+		switch val := detail.(type) {
+		case *errdetails.ErrorInfo:
+			if val.Reason != "" {
+				e.Code = val.Reason
+			}
+			md := val.Metadata
+			if v, ok := md[processingHintKey]; ok {
+				if d, err := time.ParseDuration(v); err == nil && d > 0 {
+					e.WithProcessingHint(d)
+				}
+				md = make(map[string]string, len(val.Metadata))
+				for k, v := range val.Metadata {
+					if k != processingHintKey {
+						md[k] = v
+					}
+				}
+				if len(md) == 0 {
+					md = nil
+				}
+			}
+			if val.Domain != "" || len(md) > 0 {
+				e.WithErrorInfo(val.Domain, md)
+			}
+		case *errdetails.RetryInfo:
+			if d := val.GetRetryDelay().AsDuration(); d > 0 {
+				e.WithRetryAfter(d)
+			}
+		case *errdetails.BadRequest:
+			for _, v := range val.FieldViolations {
+				e.WithFieldViolation(v.Field, v.Description)
+			}
+		}
+	}
+}
+
+// manyDetails returns Details with violations for each error
+func (m *ManyError) manyDetails() *Details {
+	if len(m.Errors) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m.Errors))
+	for k := range m.Errors {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	d := &Details{}
+	for _, k := range keys {
+		d.Violations = append(d.Violations, &FieldViolation{
+			Field:       k,
+			Description: m.Errors[k].Message,
+		})
+	}
+	return d
+}
+
+// setRetryAfter sets Retry-After and X-Processing-Hint headers, in seconds rounded up
+func setRetryAfter(w http.ResponseWriter, d *Details) {
+	if d == nil {
+		return
+	}
+	if d.RetryAfter > 0 {
+		w.Header().Set(header.RetryAfter, formatSeconds(d.RetryAfter))
+	}
+	if d.ProcessingHint > 0 {
+		w.Header().Set(header.XProcessingHint, formatSeconds(d.ProcessingHint))
+	}
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64((d+time.Second-1)/time.Second), 10)
+}
+
+// ParseRetryAfter returns the delay from Retry-After header value,
+// in seconds or HTTP date format
+func ParseRetryAfter(val string) time.Duration {
+	if val == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseInt(val, 10, 64); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(val); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,151 @@
+package httperror_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/xhttp/correlation"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDetails_GRPC(t *testing.T) {
+	ctx := correlation.WithID(context.Background())
+	err := httperror.NewFromCtx(ctx, http.StatusBadRequest, httperror.CodeBadNonce, "bad nonce").
+		WithErrorInfo("porto", map[string]string{"nonce": "123"}).
+		WithRetryAfter(2*time.Second).
+		WithFieldViolation("nonce", "expired")
+
+	st := err.GRPCStatus()
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+
+	var info *errdetails.ErrorInfo
+	var retry *errdetails.RetryInfo
+	var br *errdetails.BadRequest
+	for _, d := range st.Details() {
+		switch val := d.(type) {
+		case *errdetails.ErrorInfo:
+			info = val
+		case *errdetails.RetryInfo:
+			retry = val
+		case *errdetails.BadRequest:
+			br = val
+		}
+	}
+	require.NotNil(t, info)
+	assert.Equal(t, httperror.CodeBadNonce, info.Reason)
+	assert.Equal(t, "porto", info.Domain)
+	require.NotNil(t, retry)
+	assert.Equal(t, 2*time.Second, retry.RetryDelay.AsDuration())
+	require.NotNil(t, br)
+	require.Len(t, br.FieldViolations, 1)
+	assert.Equal(t, "nonce", br.FieldViolations[0].Field)
+
+	// round trip through the status error
+	e2 := httperror.NewFromPb(st.Err())
+	assert.Equal(t, http.StatusBadRequest, e2.HTTPStatus)
+	assert.Equal(t, httperror.CodeBadNonce, e2.Code)
+	assert.Equal(t, "bad nonce", e2.Message)
+	assert.Equal(t, err.RequestID, e2.RequestID)
+	assert.Equal(t, err.Details, e2.Details)
+	assert.Equal(t, 2*time.Second, e2.RetryAfter())
+
+	// without details, the code is still preserved
+	e3 := httperror.NewFromPb(httperror.RateLimitExceeded("slow down").GRPCStatus().Err())
+	assert.Equal(t, httperror.CodeRateLimitExceeded, e3.Code)
+	assert.Nil(t, e3.Details)
+	assert.Equal(t, time.Duration(0), e3.RetryAfter())
+}
+
+func TestDetails_ProcessingHint(t *testing.T) {
+	err := httperror.New(http.StatusServiceUnavailable, httperror.CodeNotReady, "busy").
+		WithProcessingHint(1200 * time.Millisecond)
+	assert.Equal(t, 1200*time.Millisecond, err.ProcessingHint())
+
+	w := httptest.NewRecorder()
+	err.WriteHTTPResponse(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, "2", w.Header().Get("X-Processing-Hint"))
+	assert.Empty(t, w.Header().Get("Retry-After"))
+
+	e2 := httperror.NewFromPb(err.GRPCStatus().Err())
+	assert.Equal(t, 1200*time.Millisecond, e2.ProcessingHint())
+	assert.Nil(t, e2.Details.Metadata)
+
+	err.WithErrorInfo("porto", map[string]string{"queue": "jobs"})
+	e3 := httperror.NewFromPb(err.GRPCStatus().Err())
+	assert.Equal(t, 1200*time.Millisecond, e3.ProcessingHint())
+	assert.Equal(t, map[string]string{"queue": "jobs"}, e3.Details.Metadata)
+	assert.Equal(t, map[string]string{"queue": "jobs"}, err.Details.Metadata, "source metadata is not modified")
+
+	assert.Equal(t, time.Duration(0), httperror.NotFound("missing").ProcessingHint())
+}
+
+func TestDetails_ManyError(t *testing.T) {
+	m := httperror.NewMany(http.StatusBadRequest, httperror.CodeInvalidRequest, "invalid request").
+		Add("name", httperror.InvalidParam("name is required")).
+		Add("age", httperror.InvalidParam("age must be positive"))
+
+	e := httperror.NewFromPb(m.GRPCStatus().Err())
+	assert.Equal(t, httperror.CodeInvalidRequest, e.Code)
+	require.NotNil(t, e.Details)
+	assert.Equal(t, []*httperror.FieldViolation{
+		{Field: "age", Description: "age must be positive"},
+		{Field: "name", Description: "name is required"},
+	}, e.Details.Violations)
+}
+
+func TestDetails_WriteHTTPResponse(t *testing.T) {
+	err := httperror.RateLimitExceeded("slow down").
+		WithRetryAfter(1500*time.Millisecond).
+		WithFieldViolation("count", "too many")
+
+	w := httptest.NewRecorder()
+	err.WriteHTTPResponse(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), `"details":{"violations":[{"field":"count","description":"too many"}]}`)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, time.Duration(0), httperror.ParseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), httperror.ParseRetryAfter("-1"))
+	assert.Equal(t, time.Duration(0), httperror.ParseRetryAfter("soon"))
+	assert.Equal(t, 3*time.Second, httperror.ParseRetryAfter("3"))
+	d := httperror.ParseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.True(t, d > 50*time.Second && d <= time.Minute, d)
+}
+
+func TestRPCStatusFromCode(t *testing.T) {
+	assert.Equal(t, codes.InvalidArgument, httperror.RPCStatusFromCode(httperror.CodeBadNonce, http.StatusBadRequest))
+	assert.Equal(t, codes.Unavailable, httperror.RPCStatusFromCode("custom", http.StatusServiceUnavailable))
+	assert.Equal(t, codes.Unknown, httperror.RPCStatusFromCode("custom", 599))
+}
+
+func TestNewUnaryClientInterceptor(t *testing.T) {
+	ic := httperror.NewUnaryClientInterceptor()
+	invoke := func(err error) error {
+		return ic(context.Background(), "/svc/method", nil, nil, nil,
+			func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+				return err
+			})
+	}
+
+	assert.NoError(t, invoke(nil))
+	assert.Equal(t, context.Canceled, invoke(context.Canceled))
+
+	src := httperror.NotFound("user not found").WithErrorInfo("users", nil)
+	err := invoke(status.ErrorProto(src.GRPCStatus().Proto()))
+	e, ok := err.(*httperror.Error)
+	require.True(t, ok)
+	assert.Equal(t, httperror.CodeNotFound, e.Code)
+	assert.Equal(t, http.StatusNotFound, e.HTTPStatus)
+	assert.Equal(t, "users", e.Details.Domain)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -32,6 +32,13 @@ type Error struct {
 	// Message is an textual description of the error
 	Message string `json:"message"`
 
+	// Details provides additional information about the error
+	Details *Details `json:"details,omitempty"`
+
+	// Extensions provides RFC 9457 extension members,
+	// serialized as the top level members of the error object
+	Extensions map[string]any `json:"-"`
+
 	// Cause is the original error
 	cause error `json:"-"`
 
@@ -158,6 +165,11 @@ func ContentLengthRequired() *Error {
 	return New(http.StatusBadRequest, CodeContentLengthRequired, "Content-Length header not provided")
 }
 
+// MethodNotAllowed returns Error instance with NotAllowed code
+func MethodNotAllowed(msgFormat string, vals ...interface{}) *Error {
+	return New(http.StatusMethodNotAllowed, CodeNotAllowed, msgFormat, vals...)
+}
+
 // NotFound returns Error instance with NotFound code
 func NotFound(msgFormat string, vals ...interface{}) *Error {
 	return New(http.StatusNotFound, CodeNotFound, msgFormat, vals...)
@@ -330,9 +342,14 @@ func Status(err error) int {
 func (e *Error) WriteHTTPResponse(w http.ResponseWriter, r *http.Request) {
 	// TODO: check r.Accept
 	w.Header().Set(header.ContentType, header.ApplicationJSON)
+	setRetryAfter(w, e.Details)
 	w.WriteHeader(e.HTTPStatus)
 	if e.RequestID == "" {
 		e.RequestID = correlation.ID(r.Context())
 	}
-	_ = codec.NewEncoder(w, encoderHandle(shouldPrettyPrint(r))).Encode(e)
+	var body any = e
+	if len(e.Extensions) > 0 {
+		body = e.members()
+	}
+	_ = codec.NewEncoder(w, encoderHandle(shouldPrettyPrint(r))).Encode(body)
 }
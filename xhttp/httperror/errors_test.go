@@ -357,3 +357,41 @@ var (
 	ErrGRPCPermissionDenied = status.New(codes.PermissionDenied, "permission denied").Err()
 	ErrGRPCInvalidArgument  = status.New(codes.InvalidArgument, "invalid argument").Err()
 )
+
+func TestError_Extensions(t *testing.T) {
+	e := httperror.InvalidRequest("insufficient funds").
+		WithExtension("balance", 30).
+		WithExtension("accounts", []string{"/account/12345"}).
+		WithExtension("code", "ignored")
+	e.RequestID = "123"
+	assert.Len(t, e.Extensions, 2)
+
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest(http.MethodGet, "/", nil)
+	require.NoError(t, err)
+	e.WriteHTTPResponse(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{
+		"accounts": ["/account/12345"],
+		"balance": 30,
+		"code": "invalid_request",
+		"message": "insufficient funds",
+		"request_id": "123"
+	}`, w.Body.String())
+
+	var decoded httperror.Error
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &decoded))
+	assert.Equal(t, "invalid_request", decoded.Code)
+	assert.Equal(t, "insufficient funds", decoded.Message)
+	assert.Equal(t, "123", decoded.RequestID)
+	assert.Equal(t, map[string]any{
+		"balance":  float64(30),
+		"accounts": []any{"/account/12345"},
+	}, decoded.Extensions)
+
+	// no extensions
+	var plain httperror.Error
+	require.NoError(t, json.Unmarshal([]byte(`{"code":"not_found","message":"missing"}`), &plain))
+	assert.Equal(t, "not_found", plain.Code)
+	assert.Nil(t, plain.Extensions)
+}
@@ -0,0 +1,75 @@
+package httperror
+
+import (
+	"encoding/json"
+)
+
+// reservedMembers are the members of the error object,
+// that can not be overridden by the extension members
+var reservedMembers = map[string]bool{
+	"code":       true,
+	"request_id": true,
+	"message":    true,
+	"details":    true,
+}
+
+// WithExtension adds RFC 9457 extension member,
+// serialized as a top level member of the error object.
+// The reserved names: code, request_id, message and details are ignored.
+func (e *Error) WithExtension(name string, value any) *Error {
+	if reservedMembers[name] {
+		return e
+	}
+	if e.Extensions == nil {
+		e.Extensions = map[string]any{}
+	}
+	e.Extensions[name] = value
+	return e
+}
+
+// members returns the error object with the extension members
+func (e *Error) members() map[string]any {
+	m := make(map[string]any, len(e.Extensions)+4)
+	for k, v := range e.Extensions {
+		if !reservedMembers[k] {
+			m[k] = v
+		}
+	}
+	m["code"] = e.Code
+	m["message"] = e.Message
+	if e.RequestID != "" {
+		m["request_id"] = e.RequestID
+	}
+	if e.Details != nil {
+		m["details"] = e.Details
+	}
+	return m
+}
+
+// UnmarshalJSON implements json.Unmarshaler,
+// the unknown members are decoded as the extension members
+func (e *Error) UnmarshalJSON(data []byte) error {
+	type plain Error
+	if err := json.Unmarshal(data, (*plain)(e)); err != nil {
+		return err
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	for name, raw := range members {
+		if reservedMembers[name] {
+			continue
+		}
+		var val any
+		if err := json.Unmarshal(raw, &val); err != nil {
+			return err
+		}
+		if e.Extensions == nil {
+			e.Extensions = map[string]any{}
+		}
+		e.Extensions[name] = val
+	}
+	return nil
+}
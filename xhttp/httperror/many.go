@@ -39,7 +39,8 @@ type ManyError struct {
 
 // GRPCStatus returns gRPC status
 func (m *ManyError) GRPCStatus() *status.Status {
-	return status.New(statusCode[m.Code], m.Message)
+	st := withCorrelation(status.New(statusCode[m.Code], m.Message), m.RequestID)
+	return withDetails(st, m.Code, m.manyDetails())
 }
 
 func (m *ManyError) Error() string {
@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/effective-security/porto/xhttp/correlation"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	anypb "google.golang.org/protobuf/types/known/anypb"
@@ -49,13 +50,15 @@ func NewFromPb(err error) *Error {
 	if st, ok := status.FromError(err); ok {
 		code := st.Code()
 		hs := HTTPStatusFromRPC(code)
-		return &Error{
+		e := &Error{
 			HTTPStatus: hs,
 			RPCStatus:  code,
 			Code:       httpCode[hs],
 			Message:    st.Message(),
 			RequestID:  CorrelationID(err),
 		}
+		e.fromDetails(st)
+		return e
 	}
 
 	return New(http.StatusInternalServerError, CodeUnexpected, "%s", err.Error()).WithCause(err)
@@ -63,12 +66,16 @@ func NewFromPb(err error) *Error {
 
 // GRPCStatus returns gRPC status
 func (e *Error) GRPCStatus() *status.Status {
-	st := status.New(e.RPCStatus, e.Message)
-	if e.RequestID != "" {
+	st := withCorrelation(status.New(e.RPCStatus, e.Message), e.RequestID)
+	return withDetails(st, e.Code, e.Details)
+}
+
+func withCorrelation(st *status.Status, requestID string) *status.Status {
+	if requestID != "" {
 		cid := correlationInfo{
 			anypb.Any{
 				TypeUrl: "@correlation.id",
-				Value:   []byte(e.RequestID),
+				Value:   []byte(requestID),
 			},
 		}
 
@@ -77,6 +84,21 @@ func (e *Error) GRPCStatus() *status.Status {
 	return st
 }
 
+// NewUnaryClientInterceptor returns grpc.UnaryClientInterceptor that
+// converts gRPC status errors to Error, including the status details
+func NewUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err == nil {
+			return nil
+		}
+		if _, ok := status.FromError(err); !ok {
+			return err
+		}
+		return NewFromPb(err)
+	}
+}
+
 // CorrelationID returns correlation ID from GRPC error
 func CorrelationID(err error) string {
 	if tse, ok := err.(*Error); ok {
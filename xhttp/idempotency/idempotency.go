@@ -0,0 +1,384 @@
+// Package idempotency provides HTTP middleware, that rejects duplicate
+// mutating requests carrying the same Idempotency-Key, or other configured header,
+// within a window, and replays the original response when available.
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/effective-security/porto/pkg/cache"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/porto/xhttp/identity"
+	"github.com/effective-security/porto/xhttp/marshal"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+var logger = xlog.NewPackageLogger("github.com/effective-security/porto/xhttp", "idempotency")
+
+// DefaultWindow specifies the default duration to keep the responses
+var DefaultWindow = 24 * time.Hour
+
+// DefaultLockTTL specifies the default duration of in-flight marker,
+// it should be greater than the request timeout
+var DefaultLockTTL = time.Minute
+
+// DefaultMaxBodySize specifies the default max size of the response body to store
+var DefaultMaxBodySize = 1 << 20
+
+// DefaultMethods specifies the default mutating methods to protect
+var DefaultMethods = []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// DefaultMaxRequestSize specifies the default max size of the request body to read
+var DefaultMaxRequestSize int64 = 1 << 20
+
+// DefaultHeaders specifies the default headers to read the key from, in the order of precedence.
+// X-Correlation-ID is not included by default, as it is a tracing ID,
+// that is shared by the calls made while serving one inbound request
+var DefaultHeaders = []string{header.IdempotencyKey}
+
+// Response is the stored response
+type Response struct {
+	// InProgress is set while the original request is being processed
+	InProgress bool `json:"in_progress,omitempty"`
+	// Fingerprint is the hash of the request method, path and body
+	Fingerprint string      `json:"fingerprint"`
+	StatusCode  int         `json:"status_code,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+	// BodyNotCached is set when the response body exceeded the max size,
+	// the duplicates are rejected, as the response can not be replayed
+	BodyNotCached bool `json:"body_not_cached,omitempty"`
+}
+
+// Option configures the handler
+type Option interface {
+	apply(*options)
+}
+
+type options struct {
+	window         time.Duration
+	lockTTL        time.Duration
+	maxBodySize    int
+	maxRequestSize int64
+	methods        map[string]bool
+	headers        []string
+	prefix         string
+}
+
+type funcOption struct {
+	f func(*options)
+}
+
+func (fo *funcOption) apply(o *options) {
+	fo.f(o)
+}
+
+func newFuncOption(f func(*options)) *funcOption {
+	return &funcOption{
+		f: f,
+	}
+}
+
+// WithWindow specifies the duration to keep the responses
+func WithWindow(window time.Duration) Option {
+	return newFuncOption(func(o *options) {
+		o.window = window
+	})
+}
+
+// WithLockTTL specifies the duration of in-flight marker
+func WithLockTTL(ttl time.Duration) Option {
+	return newFuncOption(func(o *options) {
+		o.lockTTL = ttl
+	})
+}
+
+// WithMaxBodySize specifies the max size of the response body to store,
+// the duplicates of larger responses are rejected with 409 Conflict
+func WithMaxBodySize(size int) Option {
+	return newFuncOption(func(o *options) {
+		o.maxBodySize = size
+	})
+}
+
+// WithMaxRequestSize specifies the max size of the request body,
+// larger requests are rejected with 413 Request Entity Too Large
+func WithMaxRequestSize(size int64) Option {
+	return newFuncOption(func(o *options) {
+		o.maxRequestSize = size
+	})
+}
+
+// WithMethods specifies the methods to protect
+func WithMethods(methods ...string) Option {
+	return newFuncOption(func(o *options) {
+		o.methods = toMap(methods)
+	})
+}
+
+// WithHeaders specifies the headers to read the key from, in the order of precedence
+func WithHeaders(headers ...string) Option {
+	return newFuncOption(func(o *options) {
+		o.headers = headers
+	})
+}
+
+// WithKeyPrefix specifies the prefix for the cache keys
+func WithKeyPrefix(prefix string) Option {
+	return newFuncOption(func(o *options) {
+		o.prefix = prefix
+	})
+}
+
+// NewHandler returns a handler that protects mutating requests from replay.
+// The key is scoped by the caller identity, method and path.
+// While the original request is in progress, duplicates are rejected with 409 Conflict.
+// When the original request completed, its response is replayed with
+// Idempotent-Replayed header, unless the request body differs,
+// in which case the duplicate is rejected with 422 Unprocessable Entity.
+// Responses with 5xx status are not stored, to allow the client to retry.
+// Responses larger than the max body size are not replayed,
+// their duplicates are rejected with 409 Conflict.
+//
+// The in-flight marker is set atomically, if the store implements cache.Locker.
+// Otherwise concurrent duplicates arriving at the same time may both be processed.
+func NewHandler(delegate http.Handler, store cache.KeyValue, opts ...Option) http.Handler {
+	dopts := options{
+		window:         DefaultWindow,
+		lockTTL:        DefaultLockTTL,
+		maxBodySize:    DefaultMaxBodySize,
+		maxRequestSize: DefaultMaxRequestSize,
+		methods:        toMap(DefaultMethods),
+		headers:        DefaultHeaders,
+		prefix:         "idempotency",
+	}
+	for _, opt := range opts {
+		opt.apply(&dopts)
+	}
+	locker, _ := store.(cache.Locker)
+
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if !dopts.methods[r.Method] {
+			delegate.ServeHTTP(w, r)
+			return
+		}
+		id := requestKey(r, dopts.headers)
+		if id == "" {
+			delegate.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, dopts.maxRequestSize))
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				marshal.WriteJSON(w, r, httperror.New(http.StatusRequestEntityTooLarge, httperror.CodeRequestTooLarge,
+					"request body exceeds %d bytes", maxErr.Limit).WithContext(ctx))
+				return
+			}
+			marshal.WriteJSON(w, r, httperror.InvalidRequest("unable to read request").WithContext(ctx).WithCause(err))
+			return
+		}
+		_ = r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		subject := identity.FromRequest(r).Identity().Subject()
+		key := dopts.prefix + "/" + hash(subject, r.Method, r.URL.Path, id)
+		fingerprint := hash(r.Method, r.URL.Path, string(body))
+
+		var stored Response
+		err = store.Get(ctx, key, &stored)
+		if err == nil {
+			serveStored(w, r, &stored, fingerprint)
+			return
+		}
+		if !cache.IsNotFoundError(err) {
+			logger.ContextKV(ctx, xlog.ERROR,
+				"reason", "get",
+				"err", err.Error())
+			delegate.ServeHTTP(w, r)
+			return
+		}
+
+		marker := &Response{InProgress: true, Fingerprint: fingerprint}
+		if locker != nil {
+			var set bool
+			set, err = locker.SetNX(ctx, key, marker, dopts.lockTTL)
+			if err == nil && !set {
+				// the concurrent duplicate took the marker first
+				if err = store.Get(ctx, key, &stored); err == nil {
+					serveStored(w, r, &stored, fingerprint)
+					return
+				}
+				if cache.IsNotFoundError(err) {
+					// the marker was released or expired in between
+					marshal.WriteJSON(w, r, httperror.Conflict("request with the same idempotency key is in progress").WithContext(ctx))
+					return
+				}
+			}
+		} else {
+			err = store.Set(ctx, key, marker, dopts.lockTTL)
+		}
+		if err != nil {
+			logger.ContextKV(ctx, xlog.ERROR,
+				"reason", "lock",
+				"err", err.Error())
+			delegate.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &recorder{
+			ResponseWriter: w,
+			maxBodySize:    dopts.maxBodySize,
+		}
+		completed := false
+		defer func() {
+			if !completed {
+				// the handler panicked, allow the client to retry
+				_ = store.Delete(ctx, key)
+			}
+		}()
+		delegate.ServeHTTP(rec, r)
+		completed = true
+
+		status := rec.status()
+		if status >= 500 {
+			if err = store.Delete(ctx, key); err != nil {
+				logger.ContextKV(ctx, xlog.ERROR,
+					"reason", "delete",
+					"err", err.Error())
+			}
+			return
+		}
+
+		res := &Response{
+			Fingerprint: fingerprint,
+			StatusCode:  status,
+		}
+		if rec.overflow {
+			// the request is completed, the duplicates must not be processed again
+			res.BodyNotCached = true
+		} else {
+			res.Header = rec.Header().Clone()
+			res.Body = rec.body.Bytes()
+		}
+		err = store.Set(ctx, key, res, dopts.window)
+		if err != nil {
+			logger.ContextKV(ctx, xlog.ERROR,
+				"reason", "store",
+				"err", err.Error())
+		}
+	}
+	return http.HandlerFunc(h)
+}
+
+// serveStored writes the response for the duplicate request
+func serveStored(w http.ResponseWriter, r *http.Request, stored *Response, fingerprint string) {
+	ctx := r.Context()
+	switch {
+	case stored.Fingerprint != fingerprint:
+		marshal.WriteJSON(w, r, httperror.New(http.StatusUnprocessableEntity, httperror.CodeInvalidRequest,
+			"idempotency key is already used with a different request").WithContext(ctx))
+	case stored.InProgress:
+		marshal.WriteJSON(w, r, httperror.Conflict("request with the same idempotency key is in progress").WithContext(ctx))
+	case stored.BodyNotCached:
+		marshal.WriteJSON(w, r, httperror.Conflict("request with the same idempotency key is completed with status %d, the response is not available",
+			stored.StatusCode).WithContext(ctx))
+	default:
+		logger.ContextKV(ctx, xlog.DEBUG,
+			"reason", "replayed",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", stored.StatusCode)
+		replay(w, stored)
+	}
+}
+
+func replay(w http.ResponseWriter, stored *Response) {
+	hdr := w.Header()
+	for k, vals := range stored.Header {
+		hdr[k] = vals
+	}
+	hdr.Set(header.IdempotentReplayed, "true")
+	w.WriteHeader(stored.StatusCode)
+	_, _ = w.Write(stored.Body)
+}
+
+func requestKey(r *http.Request, headers []string) string {
+	for _, h := range headers {
+		if v := r.Header.Get(h); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func hash(vals ...string) string {
+	h := sha256.New()
+	for _, v := range vals {
+		_, _ = h.Write([]byte(v))
+		_, _ = h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func toMap(list []string) map[string]bool {
+	m := make(map[string]bool, len(list))
+	for _, v := range list {
+		m[v] = true
+	}
+	return m
+}
+
+// recorder captures the response, while writing it to the client
+type recorder struct {
+	http.ResponseWriter
+	statusCode  int
+	body        bytes.Buffer
+	maxBodySize int
+	overflow    bool
+}
+
+func (r *recorder) WriteHeader(code int) {
+	if r.statusCode == 0 {
+		r.statusCode = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.statusCode == 0 {
+		r.statusCode = http.StatusOK
+	}
+	if !r.overflow {
+		if r.body.Len()+len(b) > r.maxBodySize {
+			r.overflow = true
+			r.body.Reset()
+		} else {
+			r.body.Write(b)
+		}
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher
+func (r *recorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *recorder) status() int {
+	if r.statusCode == 0 {
+		return http.StatusOK
+	}
+	return r.statusCode
+}
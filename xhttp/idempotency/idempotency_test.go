@@ -0,0 +1,214 @@
+package idempotency_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/cache"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/idempotency"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	var calls int32
+	delegate := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		body, _ := io.ReadAll(r.Body)
+		switch string(body) {
+		case "fail":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		case "large":
+			_, _ = w.Write([]byte(strings.Repeat("x", 20)))
+			_, _ = w.Write([]byte(strings.Repeat("x", 20)))
+			return
+		}
+		w.Header().Set(header.ContentType, header.TextPlain)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("created " + string(body) + " " + string(rune('0'+n))))
+	})
+
+	store := cache.NewMemoryProvider("test")
+	defer store.Close()
+	h := idempotency.NewHandler(delegate, store,
+		idempotency.WithWindow(time.Minute),
+		idempotency.WithLockTTL(time.Second),
+		idempotency.WithMaxBodySize(32),
+		idempotency.WithMethods(http.MethodPost),
+		idempotency.WithHeaders(header.IdempotencyKey, header.XCorrelationID),
+		idempotency.WithKeyPrefix("idm"),
+	)
+
+	call := func(method, key, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/v1/items", strings.NewReader(body))
+		if key != "" {
+			r.Header.Set(header.IdempotencyKey, key)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := call(http.MethodPost, "k1", "a")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "created a 1", w.Body.String())
+	assert.Empty(t, w.Header().Get(header.IdempotentReplayed))
+
+	// replayed
+	w = call(http.MethodPost, "k1", "a")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "created a 1", w.Body.String())
+	assert.Equal(t, header.TextPlain, w.Header().Get(header.ContentType))
+	assert.Equal(t, "true", w.Header().Get(header.IdempotentReplayed))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// different body
+	w = call(http.MethodPost, "k1", "b")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// correlation ID is used as a key
+	r := httptest.NewRequest(http.MethodPost, "/v1/items", strings.NewReader("c"))
+	r.Header.Set(header.XCorrelationID, "cid1")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, "created c 2", w.Body.String())
+	r = httptest.NewRequest(http.MethodPost, "/v1/items", strings.NewReader("c"))
+	r.Header.Set(header.XCorrelationID, "cid1")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, "created c 2", w.Body.String())
+
+	// without key or not protected method
+	call(http.MethodPost, "", "d")
+	call(http.MethodPut, "k1", "a")
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+
+	// server errors are not stored
+	w = call(http.MethodPost, "k2", "fail")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	call(http.MethodPost, "k2", "fail")
+	assert.Equal(t, int32(6), atomic.LoadInt32(&calls))
+
+	// large responses are not replayed, and not processed again
+	w = call(http.MethodPost, "k3", "large")
+	assert.Equal(t, 40, w.Body.Len())
+	w = call(http.MethodPost, "k3", "large")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "completed with status 200")
+	assert.Empty(t, w.Header().Get(header.IdempotentReplayed))
+	assert.Equal(t, int32(7), atomic.LoadInt32(&calls))
+}
+
+func TestHandler_InProgress(t *testing.T) {
+	store := cache.NewMemoryProvider("test")
+	defer store.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	delegate := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+	h := idempotency.NewHandler(delegate, store)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r := httptest.NewRequest(http.MethodPost, "/v1/items", nil)
+		r.Header.Set(header.IdempotencyKey, "k1")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}()
+	<-started
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/items", nil)
+	r.Header.Set(header.IdempotencyKey, "k1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	close(release)
+	<-done
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get(header.IdempotentReplayed))
+}
+
+func TestHandler_Scope(t *testing.T) {
+	store := cache.NewMemoryProvider("test")
+	defer store.Close()
+
+	var calls int32
+	delegate := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		_, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	})
+	h := idempotency.NewHandler(delegate, store, idempotency.WithMaxRequestSize(8))
+
+	// the same key is scoped by method and path
+	for _, p := range []string{"/v1/items", "/v1/orders"} {
+		for _, m := range []string{http.MethodPost, http.MethodPut} {
+			r := httptest.NewRequest(m, p, strings.NewReader("a"))
+			r.Header.Set(header.IdempotencyKey, "k1")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Empty(t, w.Header().Get(header.IdempotentReplayed))
+		}
+	}
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+
+	// correlation ID is not used by default
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest(http.MethodPost, "/v1/items", strings.NewReader("b"))
+		r.Header.Set(header.XCorrelationID, "cid1")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	assert.Equal(t, int32(6), atomic.LoadInt32(&calls))
+
+	// too large
+	r := httptest.NewRequest(http.MethodPost, "/v1/items", strings.NewReader("123456789"))
+	r.Header.Set(header.IdempotencyKey, "k2")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, int32(6), atomic.LoadInt32(&calls))
+}
+
+func TestHandler_Concurrent(t *testing.T) {
+	store := cache.NewMemoryProvider("test")
+	defer store.Close()
+
+	var calls int32
+	delegate := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})
+	h := idempotency.NewHandler(delegate, store)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest(http.MethodPost, "/v1/items", nil)
+			r.Header.Set(header.IdempotencyKey, "k1")
+			h.ServeHTTP(httptest.NewRecorder(), r)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
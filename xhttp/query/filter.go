@@ -0,0 +1,338 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/effective-security/porto/xhttp/httperror"
+)
+
+// Operator defines a comparison operator
+type Operator string
+
+// Comparison operators
+const (
+	OpEqual              Operator = "eq"
+	OpNotEqual           Operator = "ne"
+	OpGreaterThan        Operator = "gt"
+	OpGreaterThanOrEqual Operator = "ge"
+	OpLessThan           Operator = "lt"
+	OpLessThanOrEqual    Operator = "le"
+	OpContains           Operator = "co"
+	OpStartsWith         Operator = "sw"
+	OpEndsWith           Operator = "ew"
+	OpPresent            Operator = "pr"
+)
+
+// LogicalOperator defines a logical operator
+type LogicalOperator string
+
+// Logical operators
+const (
+	And LogicalOperator = "and"
+	Or  LogicalOperator = "or"
+)
+
+var operators = map[string]Operator{
+	"eq": OpEqual,
+	"ne": OpNotEqual,
+	"gt": OpGreaterThan,
+	"ge": OpGreaterThanOrEqual,
+	"lt": OpLessThan,
+	"le": OpLessThanOrEqual,
+	"co": OpContains,
+	"sw": OpStartsWith,
+	"ew": OpEndsWith,
+	"pr": OpPresent,
+	// aliases
+	"contains": OpContains,
+}
+
+// Expr defines a filter expression node
+type Expr interface {
+	String() string
+}
+
+// Compare is an expression comparing a field with a value
+type Compare struct {
+	Field string
+	Op    Operator
+	// Value is typed according to the field type:
+	// string, int64, float64, bool, time.Time, or nil for `pr` and `null`
+	Value any
+}
+
+// Logical is an expression combining two expressions
+type Logical struct {
+	Op    LogicalOperator
+	Left  Expr
+	Right Expr
+}
+
+// Not is a negation of an expression
+type Not struct {
+	Expr Expr
+}
+
+// String returns the expression in the filter format
+func (c *Compare) String() string {
+	if c.Op == OpPresent {
+		return c.Field + " pr"
+	}
+	return fmt.Sprintf("%s %s %s", c.Field, c.Op, formatValue(c.Value))
+}
+
+// String returns the expression in the filter format
+func (l *Logical) String() string {
+	return fmt.Sprintf("(%s %s %s)", l.Left.String(), l.Op, l.Right.String())
+}
+
+// String returns the expression in the filter format
+func (n *Not) String() string {
+	return fmt.Sprintf("not (%s)", n.Expr.String())
+}
+
+func formatValue(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(val)
+	case time.Time:
+		return strconv.Quote(val.Format(time.RFC3339Nano))
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// Walk traverses the expression tree in depth-first order,
+// and calls fn for every node, stopping if fn returns an error
+func Walk(e Expr, fn func(Expr) error) error {
+	if e == nil {
+		return nil
+	}
+	if err := fn(e); err != nil {
+		return err
+	}
+	switch n := e.(type) {
+	case *Logical:
+		if err := Walk(n.Left, fn); err != nil {
+			return err
+		}
+		return Walk(n.Right, fn)
+	case *Not:
+		return Walk(n.Expr, fn)
+	}
+	return nil
+}
+
+// ParseFilter parses the filter expression, and validates it against the fields
+func ParseFilter(filter string, fields Fields) (Expr, error) {
+	p := &parser{
+		fields: fields,
+	}
+	if err := p.tokenize(filter); err != nil {
+		return nil, err
+	}
+	if len(p.tokens) == 0 {
+		return nil, nil
+	}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, httperror.InvalidParam("filter: unexpected %q at position %d", p.tokens[p.pos].val, p.tokens[p.pos].at)
+	}
+	return e, nil
+}
+
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota
+	tokString
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	val  string
+	at   int
+}
+
+type parser struct {
+	fields Fields
+	tokens []token
+	pos    int
+}
+
+func (p *parser) tokenize(s string) error {
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			p.tokens = append(p.tokens, token{kind: tokLParen, val: "(", at: i})
+			i++
+		case r == ')':
+			p.tokens = append(p.tokens, token{kind: tokRParen, val: ")", at: i})
+			i++
+		case r == '"':
+			start := i
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					sb.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				if runes[i] == '"' {
+					closed = true
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return httperror.InvalidParam("filter: unterminated string at position %d", start)
+			}
+			p.tokens = append(p.tokens, token{kind: tokString, val: sb.String(), at: start})
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' && runes[i] != '"' {
+				i++
+			}
+			p.tokens = append(p.tokens, token{kind: tokIdent, val: string(runes[start:i]), at: start})
+		}
+	}
+	return nil
+}
+
+func (p *parser) peek() *token {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *parser) next() *token {
+	t := p.peek()
+	if t != nil {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isKeyword(kw string) bool {
+	t := p.peek()
+	return t != nil && t.kind == tokIdent && strings.EqualFold(t.val, kw)
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword(string(Or)) {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Logical{Op: Or, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword(string(And)) {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &Logical{Op: And, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if p.isKeyword("not") {
+		p.next()
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Expr: e}, nil
+	}
+
+	t := p.peek()
+	if t == nil {
+		return nil, httperror.InvalidParam("filter: unexpected end of expression")
+	}
+	if t.kind == tokLParen {
+		p.next()
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t == nil || t.kind != tokRParen {
+			return nil, httperror.InvalidParam("filter: missing closing parenthesis")
+		}
+		return e, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (Expr, error) {
+	ft := p.next()
+	if ft.kind != tokIdent {
+		return nil, httperror.InvalidParam("filter: expected field at position %d", ft.at)
+	}
+	field, ok := p.fields.find(ft.val)
+	if !ok {
+		return nil, httperror.InvalidParam("filter: unsupported field %q", ft.val)
+	}
+
+	ot := p.next()
+	if ot == nil || ot.kind != tokIdent {
+		return nil, httperror.InvalidParam("filter: expected operator after %q", ft.val)
+	}
+	op, ok := operators[strings.ToLower(ot.val)]
+	if !ok {
+		return nil, httperror.InvalidParam("filter: unsupported operator %q", ot.val)
+	}
+	if !field.Type.supports(op) {
+		return nil, httperror.InvalidParam("filter: operator %q is not supported for field %q", ot.val, field.Name)
+	}
+	if op == OpPresent {
+		return &Compare{Field: field.Name, Op: op}, nil
+	}
+
+	vt := p.next()
+	if vt == nil || (vt.kind != tokIdent && vt.kind != tokString) {
+		return nil, httperror.InvalidParam("filter: expected value for %q", ft.val)
+	}
+	val, err := field.Type.parse(vt)
+	if err != nil {
+		return nil, httperror.InvalidParam("filter: invalid value %q for field %q", vt.val, field.Name)
+	}
+	if val == nil && op != OpEqual && op != OpNotEqual {
+		return nil, httperror.InvalidParam("filter: null is supported only with eq and ne for field %q", field.Name)
+	}
+	return &Compare{Field: field.Name, Op: op, Value: val}, nil
+}
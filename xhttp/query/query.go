@@ -0,0 +1,210 @@
+// Package query provides a parser for the standard list-endpoint query parameters:
+// SCIM-style filter expressions, sort specs, and field selection.
+//
+//	GET /v1/users?filter=name co "john" and age ge 21&sort=-created,name&fields=id,name
+package query
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/effective-security/porto/xhttp/httperror"
+)
+
+// Query parameter names
+const (
+	ParamFilter     = "filter"
+	ParamSort       = "sort"
+	ParamSortBy     = "sortBy"
+	ParamSortOrder  = "sortOrder"
+	ParamFields     = "fields"
+	ParamAttributes = "attributes"
+)
+
+// FieldType defines the type of the field
+type FieldType int
+
+// Field types
+const (
+	String FieldType = iota
+	Number
+	Bool
+	Time
+)
+
+// Field declares a field that can be used in filter, sort, or selection
+type Field struct {
+	Name string
+	Type FieldType
+	// Sortable specifies if the field can be used in sort
+	Sortable bool
+}
+
+// Fields defines the list of declared fields
+type Fields []Field
+
+// SortSpec defines the sort by field
+type SortSpec struct {
+	Field      string
+	Descending bool
+}
+
+// Query is the parsed list query
+type Query struct {
+	// Filter is the root of the filter AST, nil if not provided
+	Filter Expr
+	// Sort is the list of sort specs, in the order of priority
+	Sort []SortSpec
+	// Fields is the list of selected fields, empty if not provided
+	Fields []string
+}
+
+// Parse parses the query parameters of the request
+func Parse(r *http.Request, fields Fields) (*Query, error) {
+	return ParseValues(r.URL.Query(), fields)
+}
+
+// ParseValues parses the query parameters
+func ParseValues(vals url.Values, fields Fields) (*Query, error) {
+	q := &Query{}
+
+	var err error
+	if filter := vals.Get(ParamFilter); filter != "" {
+		q.Filter, err = ParseFilter(filter, fields)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if sort := vals.Get(ParamSort); sort != "" {
+		q.Sort, err = ParseSort(sort, fields)
+		if err != nil {
+			return nil, err
+		}
+	} else if sortBy := vals.Get(ParamSortBy); sortBy != "" {
+		q.Sort, err = ParseSort(sortBy, fields)
+		if err != nil {
+			return nil, err
+		}
+		switch strings.ToLower(vals.Get(ParamSortOrder)) {
+		case "", "ascending", "asc":
+		case "descending", "desc":
+			for i := range q.Sort {
+				q.Sort[i].Descending = true
+			}
+		default:
+			return nil, httperror.InvalidParam("invalid %s: %q", ParamSortOrder, vals.Get(ParamSortOrder))
+		}
+	}
+
+	sel := vals.Get(ParamFields)
+	if sel == "" {
+		sel = vals.Get(ParamAttributes)
+	}
+	if sel != "" {
+		q.Fields, err = ParseFields(sel, fields)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// ParseSort parses comma separated list of sort specs,
+// where `-` prefix specifies the descending order
+func ParseSort(sort string, fields Fields) ([]SortSpec, error) {
+	var specs []SortSpec
+	for _, s := range strings.Split(sort, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		spec := SortSpec{}
+		if strings.HasPrefix(s, "-") {
+			spec.Descending = true
+			s = s[1:]
+		} else {
+			s = strings.TrimPrefix(s, "+")
+		}
+		f, ok := fields.find(s)
+		if !ok || !f.Sortable {
+			return nil, httperror.InvalidParam("unsupported sort field %q", s)
+		}
+		spec.Field = f.Name
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// ParseFields parses comma separated list of selected fields
+func ParseFields(sel string, fields Fields) ([]string, error) {
+	var list []string
+	seen := map[string]bool{}
+	for _, s := range strings.Split(sel, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		f, ok := fields.find(s)
+		if !ok {
+			return nil, httperror.InvalidParam("unsupported field %q", s)
+		}
+		if !seen[f.Name] {
+			seen[f.Name] = true
+			list = append(list, f.Name)
+		}
+	}
+	return list, nil
+}
+
+// find returns the field by case-insensitive name, as per SCIM
+func (fs Fields) find(name string) (Field, bool) {
+	for _, f := range fs {
+		if strings.EqualFold(f.Name, name) {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+func (t FieldType) supports(op Operator) bool {
+	switch op {
+	case OpContains, OpStartsWith, OpEndsWith:
+		return t == String
+	case OpGreaterThan, OpGreaterThanOrEqual, OpLessThan, OpLessThanOrEqual:
+		return t != Bool
+	}
+	return true
+}
+
+func (t FieldType) parse(tok *token) (any, error) {
+	if tok.kind == tokIdent && tok.val == "null" {
+		return nil, nil
+	}
+	switch t {
+	case String:
+		if tok.kind != tokString {
+			return nil, httperror.InvalidParam("string value must be quoted")
+		}
+		return tok.val, nil
+	case Number:
+		if tok.kind != tokIdent {
+			return nil, httperror.InvalidParam("number value must not be quoted")
+		}
+		if i, err := strconv.ParseInt(tok.val, 10, 64); err == nil {
+			return i, nil
+		}
+		return strconv.ParseFloat(tok.val, 64)
+	case Bool:
+		if tok.kind != tokIdent {
+			return nil, httperror.InvalidParam("bool value must not be quoted")
+		}
+		return strconv.ParseBool(tok.val)
+	case Time:
+		return time.Parse(time.RFC3339, tok.val)
+	}
+	return nil, httperror.InvalidParam("unsupported type")
+}
@@ -0,0 +1,133 @@
+package query_test
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/porto/xhttp/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testFields = query.Fields{
+	{Name: "name", Type: query.String, Sortable: true},
+	{Name: "age", Type: query.Number, Sortable: true},
+	{Name: "active", Type: query.Bool},
+	{Name: "created", Type: query.Time, Sortable: true},
+}
+
+func TestParseFilter(t *testing.T) {
+	tcases := []struct {
+		filter string
+		exp    string
+	}{
+		{``, ``},
+		{`name eq "john"`, `name eq "john"`},
+		{`Name CO "jo\"hn"`, `name co "jo\"hn"`},
+		{`age ge 21 and active eq true`, `(age ge 21 and active eq true)`},
+		{`age gt 1.5`, `age gt 1.5`},
+		{`name sw "a" or name ew "b" and age lt 10`, `(name sw "a" or (name ew "b" and age lt 10))`},
+		{`(name sw "a" or name ew "b") and age lt 10`, `((name sw "a" or name ew "b") and age lt 10)`},
+		{`not (name pr)`, `not (name pr)`},
+		{`name eq null`, `name eq null`},
+		{`created gt "2024-01-02T03:04:05Z"`, `created gt "2024-01-02T03:04:05Z"`},
+		{`name contains "x"`, `name co "x"`},
+	}
+	for _, tc := range tcases {
+		t.Run(tc.filter, func(t *testing.T) {
+			e, err := query.ParseFilter(tc.filter, testFields)
+			require.NoError(t, err)
+			if tc.exp == "" {
+				assert.Nil(t, e)
+				return
+			}
+			require.NotNil(t, e)
+			assert.Equal(t, tc.exp, e.String())
+		})
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	tcases := []struct {
+		filter string
+		err    string
+	}{
+		{`unknown eq "a"`, `filter: unsupported field "unknown"`},
+		{`name xx "a"`, `filter: unsupported operator "xx"`},
+		{`name eq john`, `filter: invalid value "john" for field "name"`},
+		{`age eq "21"`, `filter: invalid value "21" for field "age"`},
+		{`age co 21`, `filter: operator "co" is not supported for field "age"`},
+		{`active gt true`, `filter: operator "gt" is not supported for field "active"`},
+		{`age gt null`, `filter: null is supported only with eq and ne for field "age"`},
+		{`name eq "a`, `filter: unterminated string at position 8`},
+		{`(name eq "a"`, `filter: missing closing parenthesis`},
+		{`name eq "a" and`, `filter: unexpected end of expression`},
+		{`name eq "a" name`, `filter: unexpected "name" at position 12`},
+		{`name`, `filter: expected operator after "name"`},
+		{`name eq`, `filter: expected value for "name"`},
+		{`created gt "yesterday"`, `filter: invalid value "yesterday" for field "created"`},
+	}
+	for _, tc := range tcases {
+		t.Run(tc.filter, func(t *testing.T) {
+			_, err := query.ParseFilter(tc.filter, testFields)
+			require.Error(t, err)
+			herr, ok := err.(*httperror.Error)
+			require.True(t, ok)
+			assert.Equal(t, httperror.CodeInvalidParam, herr.Code)
+			assert.Equal(t, tc.err, herr.Message)
+		})
+	}
+}
+
+func TestFilterValues(t *testing.T) {
+	e, err := query.ParseFilter(`age eq 21 and created lt "2024-01-02T03:04:05Z"`, testFields)
+	require.NoError(t, err)
+
+	var compares []*query.Compare
+	err = query.Walk(e, func(n query.Expr) error {
+		if c, ok := n.(*query.Compare); ok {
+			compares = append(compares, c)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, compares, 2)
+	assert.Equal(t, int64(21), compares[0].Value)
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), compares[1].Value)
+}
+
+func TestParse(t *testing.T) {
+	r := httptest.NewRequest("GET", "/v1/users?"+url.Values{
+		"filter": {`name co "john"`},
+		"sort":   {"-created, name"},
+		"fields": {"name,AGE,name"},
+	}.Encode(), nil)
+
+	q, err := query.Parse(r, testFields)
+	require.NoError(t, err)
+	assert.Equal(t, `name co "john"`, q.Filter.String())
+	assert.Equal(t, []query.SortSpec{{Field: "created", Descending: true}, {Field: "name"}}, q.Sort)
+	assert.Equal(t, []string{"name", "age"}, q.Fields)
+
+	q, err = query.ParseValues(url.Values{
+		"sortBy":     {"age"},
+		"sortOrder":  {"descending"},
+		"attributes": {"active"},
+	}, testFields)
+	require.NoError(t, err)
+	assert.Nil(t, q.Filter)
+	assert.Equal(t, []query.SortSpec{{Field: "age", Descending: true}}, q.Sort)
+	assert.Equal(t, []string{"active"}, q.Fields)
+
+	_, err = query.ParseValues(url.Values{"sort": {"active"}}, testFields)
+	assert.EqualError(t, err, `invalid_parameter: unsupported sort field "active"`)
+	_, err = query.ParseValues(url.Values{"sortBy": {"age"}, "sortOrder": {"up"}}, testFields)
+	assert.EqualError(t, err, `invalid_parameter: invalid sortOrder: "up"`)
+	_, err = query.ParseValues(url.Values{"fields": {"password"}}, testFields)
+	assert.EqualError(t, err, `invalid_parameter: unsupported field "password"`)
+	_, err = query.ParseValues(url.Values{"filter": {"name"}}, testFields)
+	assert.Error(t, err)
+}
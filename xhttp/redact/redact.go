@@ -0,0 +1,189 @@
+// Package redact provides redaction of secrets, like tokens and passwords,
+// in headers, URLs and HTTP dumps written to debug logs.
+package redact
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Mask replaces the redacted value
+const Mask = "****"
+
+// minLenToPreserve is the minimum length of the value,
+// to preserve the last 4 chars
+const minLenToPreserve = 12
+
+var (
+	// DefaultHeaders is the list of headers redacted by default
+	DefaultHeaders = []string{
+		"Authorization",
+		"Proxy-Authorization",
+		"Cookie",
+		"Set-Cookie",
+		"DPoP",
+		"X-Api-Key",
+		"X-Auth-Token",
+	}
+	// DefaultFields is the list of case-insensitive patterns of JSON fields
+	// and query parameters redacted by default
+	DefaultFields = []string{
+		"token",
+		"password",
+		"secret",
+		"api_?key",
+		"authorization",
+		"credential",
+	}
+)
+
+// Default is the default Redactor
+var Default = MustNew(DefaultHeaders, DefaultFields)
+
+var (
+	jsonField  = regexp.MustCompile(`"([^"\\]+)"(\s*:\s*)"((?:[^"\\]|\\.)*)"`)
+	queryParam = regexp.MustCompile(`(^|[?&])([^=&\s]+)=([^&\s]*)`)
+)
+
+// Redactor redacts the values of the sensitive headers, JSON fields and query parameters
+type Redactor struct {
+	headers map[string]bool
+	fields  *regexp.Regexp
+}
+
+// New returns Redactor for the headers, and fields patterns
+func New(headers []string, fields []string) (*Redactor, error) {
+	r := &Redactor{
+		headers: make(map[string]bool, len(headers)),
+	}
+	for _, h := range headers {
+		r.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	if len(fields) > 0 {
+		var err error
+		r.fields, err = regexp.Compile("(?i)(?:" + strings.Join(fields, "|") + ")")
+		if err != nil {
+			return nil, errors.WithMessage(err, "invalid field pattern")
+		}
+	}
+	return r, nil
+}
+
+// MustNew returns Redactor, or panics if the field patterns are not valid
+func MustNew(headers []string, fields []string) *Redactor {
+	r, err := New(headers, fields)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// Value returns the masked value, preserving the last 4 chars of long values
+func Value(v string) string {
+	if len(v) < minLenToPreserve {
+		return Mask
+	}
+	return Mask + v[len(v)-4:]
+}
+
+// IsHeader returns true if the header must be redacted
+func (r *Redactor) IsHeader(name string) bool {
+	return r != nil && r.headers[http.CanonicalHeaderKey(name)]
+}
+
+// IsField returns true if the JSON field or query parameter must be redacted
+func (r *Redactor) IsField(name string) bool {
+	return r != nil && r.fields != nil && r.fields.MatchString(name)
+}
+
+// Header returns a copy of the headers with redacted values
+func (r *Redactor) Header(h http.Header) http.Header {
+	if r == nil {
+		return h
+	}
+	res := h.Clone()
+	for name, vals := range res {
+		if r.IsHeader(name) {
+			for i, v := range vals {
+				vals[i] = Value(v)
+			}
+		}
+	}
+	return res
+}
+
+// URL returns the URL string with redacted query parameters
+func (r *Redactor) URL(u *url.URL) string {
+	s := u.String()
+	if r == nil || u.RawQuery == "" {
+		return s
+	}
+	return r.Query(s)
+}
+
+// Query returns the string with redacted query parameters
+func (r *Redactor) Query(s string) string {
+	if r == nil || r.fields == nil {
+		return s
+	}
+	return queryParam.ReplaceAllStringFunc(s, func(m string) string {
+		sub := queryParam.FindStringSubmatch(m)
+		if !r.IsField(sub[2]) {
+			return m
+		}
+		return sub[1] + sub[2] + "=" + Value(sub[3])
+	})
+}
+
+// JSON returns the text with redacted JSON string fields
+func (r *Redactor) JSON(s string) string {
+	if r == nil || r.fields == nil {
+		return s
+	}
+	return jsonField.ReplaceAllStringFunc(s, func(m string) string {
+		sub := jsonField.FindStringSubmatch(m)
+		if !r.IsField(sub[1]) {
+			return m
+		}
+		return `"` + sub[1] + `"` + sub[2] + `"` + Value(sub[3]) + `"`
+	})
+}
+
+// Dump returns the HTTP request or response dump,
+// as produced by httputil.DumpRequest or DumpResponse, with redacted
+// query parameters in the request line, headers, and JSON or form body
+func (r *Redactor) Dump(dump []byte) []byte {
+	if r == nil {
+		return dump
+	}
+
+	head, body, hasBody := bytes.Cut(dump, []byte("\r\n\r\n"))
+	lines := strings.Split(string(head), "\r\n")
+	for i, line := range lines {
+		if i == 0 {
+			lines[i] = r.Query(line)
+			continue
+		}
+		if name, val, ok := strings.Cut(line, ":"); ok && r.IsHeader(name) {
+			lines[i] = name + ": " + Value(strings.TrimSpace(val))
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(strings.Join(lines, "\r\n"))
+	if hasBody {
+		buf.WriteString("\r\n\r\n")
+		b := r.JSON(string(body))
+		if !strings.ContainsAny(b, "{[\n") {
+			// form encoded
+			b = r.Query(b)
+		}
+		buf.WriteString(b)
+	}
+	return buf.Bytes()
+}
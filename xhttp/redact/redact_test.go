@@ -0,0 +1,87 @@
+package redact_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/effective-security/porto/xhttp/redact"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValue(t *testing.T) {
+	assert.Equal(t, "****", redact.Value(""))
+	assert.Equal(t, "****", redact.Value("secret"))
+	assert.Equal(t, "****cdef", redact.Value("0123456789abcdef"))
+}
+
+func TestRedactor(t *testing.T) {
+	r := redact.Default
+
+	assert.True(t, r.IsHeader("authorization"))
+	assert.False(t, r.IsHeader("Accept"))
+	assert.True(t, r.IsField("access_token"))
+	assert.True(t, r.IsField("ApiKey"))
+	assert.True(t, r.IsField("api_key"))
+	assert.False(t, r.IsField("name"))
+
+	h := http.Header{}
+	h.Set("Authorization", "Bearer 0123456789abcdef")
+	h.Set("Accept", "*/*")
+	rh := r.Header(h)
+	assert.Equal(t, "****cdef", rh.Get("Authorization"))
+	assert.Equal(t, "*/*", rh.Get("Accept"))
+	// original is not modified
+	assert.Equal(t, "Bearer 0123456789abcdef", h.Get("Authorization"))
+
+	u, err := url.Parse("https://h/v1/cb?code=1&access_token=0123456789abcdef&x=1")
+	require.NoError(t, err)
+	assert.Equal(t, "https://h/v1/cb?code=1&access_token=****cdef&x=1", r.URL(u))
+
+	assert.Equal(t, `{"name":"bob", "password" : "****", "nested":{"id_token":"****cdef"},"n":1}`,
+		r.JSON(`{"name":"bob", "password" : "pwd", "nested":{"id_token":"0123456789abcdef"},"n":1}`))
+
+	var nilr *redact.Redactor
+	assert.Equal(t, h, nilr.Header(h))
+	assert.Equal(t, "a=b", nilr.Query("a=b"))
+	assert.Equal(t, `{"token":"x"}`, nilr.JSON(`{"token":"x"}`))
+
+	_, err = redact.New(nil, []string{"["})
+	assert.Error(t, err)
+	assert.Panics(t, func() { redact.MustNew(nil, []string{"["}) })
+
+	custom := redact.MustNew([]string{"X-Custom"}, nil)
+	assert.True(t, custom.IsHeader("x-custom"))
+	assert.False(t, custom.IsField("token"))
+	assert.Equal(t, `{"token":"x"}`, custom.JSON(`{"token":"x"}`))
+}
+
+func TestDump(t *testing.T) {
+	r := redact.Default
+
+	req := httptest.NewRequest(http.MethodPost, "https://h/v1/token?api_key=0123456789abcdef",
+		strings.NewReader(`{"user":"bob","password":"pwd"}`))
+	req.Header.Set("Authorization", "DPoP 0123456789abcdef")
+	req.Header.Set("Cookie", "session=0123456789abcdef")
+	req.Header.Set("Content-Type", "application/json")
+	dump, err := httputil.DumpRequest(req, true)
+	require.NoError(t, err)
+
+	res := string(r.Dump(dump))
+	assert.Contains(t, res, "POST https://h/v1/token?api_key=****cdef HTTP/1.1\r\n")
+	assert.Contains(t, res, "\r\nAuthorization: ****cdef\r\n")
+	assert.Contains(t, res, "\r\nCookie: ****cdef\r\n")
+	assert.Contains(t, res, "\r\nContent-Type: application/json\r\n")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\n"+`{"user":"bob","password":"****"}`), res)
+	assert.NotContains(t, res, "0123456789ab")
+
+	form := "POST /token HTTP/1.1\r\nHost: h\r\n\r\ngrant_type=client_credentials&client_secret=0123456789abcdef"
+	assert.Equal(t, "POST /token HTTP/1.1\r\nHost: h\r\n\r\ngrant_type=client_credentials&client_secret=****cdef", string(r.Dump([]byte(form))))
+
+	head := "HTTP/1.1 200 OK\r\nSet-Cookie: a=0123456789abcdef"
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nSet-Cookie: ****cdef", string(r.Dump([]byte(head))))
+}
@@ -0,0 +1,80 @@
+// Package reqctx provides typed accessors for the request values
+// stored in context by porto, and Key to define new values
+// without declaring private context key types.
+//
+//	var TraceLevel = reqctx.NewKey[int]("trace_level")
+//
+//	ctx = TraceLevel.WithValue(ctx, 2)
+//	level := TraceLevel.Get(ctx)
+package reqctx
+
+import (
+	"context"
+
+	"github.com/effective-security/porto/xhttp/correlation"
+	"github.com/effective-security/porto/xhttp/identity"
+)
+
+// Key is a typed key of the context value,
+// each Key created with NewKey is unique, even if the names are the same
+type Key[T any] struct {
+	name string
+}
+
+// NewKey returns a new Key, the name is used for diagnostics only
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+// String returns the name of the key
+func (k *Key[T]) String() string {
+	return k.name
+}
+
+// WithValue returns the context with the value
+func (k *Key[T]) WithValue(ctx context.Context, v T) context.Context {
+	return context.WithValue(ctx, k, v)
+}
+
+// Value returns the value, and true if it was set
+func (k *Key[T]) Value(ctx context.Context) (T, bool) {
+	v, ok := ctx.Value(k).(T)
+	return v, ok
+}
+
+// Get returns the value, or zero value if it was not set
+func (k *Key[T]) Get(ctx context.Context) T {
+	v, _ := k.Value(ctx)
+	return v
+}
+
+// RouteTemplate is the key of the registered route path,
+// like /v1/users/:id, set by restserver.Router
+var RouteTemplate = NewKey[string]("route_template")
+
+// CorrelationID returns the correlation ID of the request
+func CorrelationID(ctx context.Context) string {
+	return correlation.ID(ctx)
+}
+
+// Identity returns the identity of the caller,
+// or guest identity if not set
+func Identity(ctx context.Context) identity.Identity {
+	return identity.FromContext(ctx).Identity()
+}
+
+// Tenant returns the tenant of the caller
+func Tenant(ctx context.Context) string {
+	return Identity(ctx).Tenant()
+}
+
+// ClientIP returns IP address of the caller
+func ClientIP(ctx context.Context) string {
+	return identity.FromContext(ctx).ClientIP()
+}
+
+// Route returns the registered route path of the request,
+// or empty string if the request was not served by restserver.Router
+func Route(ctx context.Context) string {
+	return RouteTemplate.Get(ctx)
+}
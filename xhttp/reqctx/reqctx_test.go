@@ -0,0 +1,66 @@
+package reqctx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/effective-security/porto/restserver"
+	"github.com/effective-security/porto/xhttp/correlation"
+	"github.com/effective-security/porto/xhttp/header"
+	"github.com/effective-security/porto/xhttp/identity"
+	"github.com/effective-security/porto/xhttp/reqctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKey(t *testing.T) {
+	k1 := reqctx.NewKey[int]("level")
+	k2 := reqctx.NewKey[int]("level")
+	assert.Equal(t, "level", k1.String())
+
+	ctx := context.Background()
+	_, ok := k1.Value(ctx)
+	assert.False(t, ok)
+	assert.Equal(t, 0, k1.Get(ctx))
+
+	ctx = k1.WithValue(ctx, 2)
+	v, ok := k1.Value(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, 2, v)
+	// keys with the same name do not collide
+	_, ok = k2.Value(ctx)
+	assert.False(t, ok)
+}
+
+func TestAccessors(t *testing.T) {
+	ctx := context.Background()
+	assert.Empty(t, reqctx.CorrelationID(ctx))
+	assert.Equal(t, identity.GuestRoleName, reqctx.Identity(ctx).Role())
+	assert.Empty(t, reqctx.Tenant(ctx))
+	assert.Empty(t, reqctx.ClientIP(ctx))
+	assert.Empty(t, reqctx.Route(ctx))
+
+	router := restserver.NewRouter(nil)
+	router.GET("/v1/users/:id", func(w http.ResponseWriter, r *http.Request, _ restserver.Params) {
+		ctx := r.Context()
+		assert.NotEmpty(t, reqctx.CorrelationID(ctx))
+		assert.Equal(t, "bob", reqctx.Identity(ctx).Subject())
+		assert.Equal(t, "t1", reqctx.Tenant(ctx))
+		assert.Equal(t, "10.0.0.1", reqctx.ClientIP(ctx))
+		assert.Equal(t, "/v1/users/:id", reqctx.Route(ctx))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mapper := func(*http.Request) (identity.Identity, error) {
+		return identity.NewIdentity("user", "bob", "t1", nil, "", ""), nil
+	}
+	h := correlation.NewHandler(identity.NewContextHandler(router.Handler(), mapper))
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/users/123", nil)
+	r.Header.Set("X-Real-IP", "10.0.0.1")
+	r.Header.Set(header.XCorrelationID, "corr1234")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
@@ -0,0 +1,207 @@
+// Package signedurl provides helpers to mint and verify HMAC-signed, expiring URLs,
+// to grant temporary access to downloads and uploads without tokens.
+//
+// The signature covers the allowed methods, the path, the query parameters,
+// the expiration time and, optionally, the client IP and the caller's subject.
+// The signing parameters are added to the query string, see Param* constants.
+package signedurl
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/effective-security/porto/x/clock"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/porto/xhttp/identity"
+	"github.com/effective-security/porto/xhttp/marshal"
+	"github.com/effective-security/porto/xhttp/reqctx"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+var logger = xlog.NewPackageLogger("github.com/effective-security/porto/xhttp", "signedurl")
+
+// Query parameters added to the signed URL
+const (
+	// ParamExpires is the Unix time in seconds when the URL expires
+	ParamExpires = "x-expires"
+	// ParamMethods is the comma separated list of allowed methods
+	ParamMethods = "x-methods"
+	// ParamBind is the comma separated list of bindings: ip, subject
+	ParamBind = "x-bind"
+	// ParamSignature is the hex encoded signature
+	ParamSignature = "x-signature"
+)
+
+// Bindings of the signed URL
+const (
+	// BindIP binds the URL to the client IP
+	BindIP = "ip"
+	// BindSubject binds the URL to the caller's subject
+	BindSubject = "subject"
+)
+
+// Errors returned by the Signer
+var (
+	ErrMissingSignature = errors.New("signedurl: missing signature")
+	ErrInvalidExpires   = errors.New("signedurl: invalid expiration")
+	ErrExpired          = errors.New("signedurl: expired")
+	ErrMethodNotAllowed = errors.New("signedurl: method not allowed")
+	ErrInvalidSignature = errors.New("signedurl: invalid signature")
+)
+
+// defaultMethods are allowed if Params.Methods is not specified
+var defaultMethods = []string{http.MethodGet, http.MethodHead}
+
+// Params specifies the parameters of the signed URL
+type Params struct {
+	// Methods specifies the allowed methods, default is GET and HEAD
+	Methods []string
+	// TTL specifies the validity period of the URL
+	TTL time.Duration
+	// ClientIP binds the URL to the client IP, if specified
+	ClientIP string
+	// Subject binds the URL to the caller's subject, if specified
+	Subject string
+}
+
+// Signer signs and verifies URLs
+type Signer struct {
+	secrets [][]byte
+	clock   clock.Clock
+}
+
+// New returns Signer, the first secret is used to sign,
+// and all secrets are used to verify, to support the rotation
+func New(secrets ...[]byte) (*Signer, error) {
+	if len(secrets) == 0 {
+		return nil, errors.New("signedurl: secret is required")
+	}
+	for _, s := range secrets {
+		if len(s) == 0 {
+			return nil, errors.New("signedurl: empty secret")
+		}
+	}
+	return &Signer{secrets: secrets, clock: clock.System}, nil
+}
+
+// WithClock specifies the time source of the expiration
+func (s *Signer) WithClock(c clock.Clock) *Signer {
+	s.clock = clock.OrSystem(c)
+	return s
+}
+
+// Sign returns the signed URL
+func (s *Signer) Sign(rawURL string, p Params) (string, error) {
+	if p.TTL <= 0 {
+		return "", errors.New("signedurl: TTL is required")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	methods := p.Methods
+	if len(methods) == 0 {
+		methods = defaultMethods
+	}
+	var bind []string
+	if p.ClientIP != "" {
+		bind = append(bind, BindIP)
+	}
+	if p.Subject != "" {
+		bind = append(bind, BindSubject)
+	}
+
+	q := u.Query()
+	for _, k := range []string{ParamExpires, ParamMethods, ParamBind, ParamSignature} {
+		q.Del(k)
+	}
+	q.Set(ParamExpires, strconv.FormatInt(s.clock.Now().Add(p.TTL).Unix(), 10))
+	q.Set(ParamMethods, strings.ToUpper(strings.Join(methods, ",")))
+	if len(bind) > 0 {
+		q.Set(ParamBind, strings.Join(bind, ","))
+	}
+
+	sig := hmacSHA256(s.secrets[0], signedContent(u.EscapedPath(), q, p.ClientIP, p.Subject))
+	q.Set(ParamSignature, hex.EncodeToString(sig))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Verify verifies the signed URL of the request
+func (s *Signer) Verify(r *http.Request) error {
+	q := r.URL.Query()
+	sig, err := hex.DecodeString(q.Get(ParamSignature))
+	if err != nil || len(sig) == 0 {
+		return ErrMissingSignature
+	}
+	q.Del(ParamSignature)
+
+	exp, err := strconv.ParseInt(q.Get(ParamExpires), 10, 64)
+	if err != nil {
+		return ErrInvalidExpires
+	}
+	if s.clock.Now().Unix() > exp {
+		return ErrExpired
+	}
+
+	if !slices.Contains(strings.Split(q.Get(ParamMethods), ","), r.Method) {
+		return ErrMethodNotAllowed
+	}
+
+	var clientIP, subject string
+	for _, b := range strings.Split(q.Get(ParamBind), ",") {
+		switch b {
+		case BindIP:
+			clientIP = reqctx.ClientIP(r.Context())
+			if clientIP == "" {
+				clientIP = identity.ClientIPFromRequest(r)
+			}
+		case BindSubject:
+			subject = reqctx.Identity(r.Context()).Subject()
+		}
+	}
+
+	content := signedContent(r.URL.EscapedPath(), q, clientIP, subject)
+	for _, secret := range s.secrets {
+		if hmac.Equal(sig, hmacSHA256(secret, content)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// NewHandler returns http.Handler that verifies the signed URL
+// before calling the delegate, and returns 401 if the verification failed
+func NewHandler(delegate http.Handler, s *Signer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := s.Verify(r); err != nil {
+			logger.ContextKV(r.Context(), xlog.DEBUG,
+				"path", r.URL.Path,
+				"err", err.Error())
+			marshal.WriteJSON(w, r, httperror.Unauthorized("%s", err.Error()))
+			return
+		}
+		delegate.ServeHTTP(w, r)
+	})
+}
+
+func hmacSHA256(secret, content []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write(content)
+	return mac.Sum(nil)
+}
+
+// signedContent returns the canonical content to sign,
+// url.Values.Encode sorts the parameters by key
+func signedContent(path string, q url.Values, clientIP, subject string) []byte {
+	return []byte(strings.Join([]string{path, q.Encode(), clientIP, subject}, "\n"))
+}
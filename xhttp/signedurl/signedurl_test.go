@@ -0,0 +1,121 @@
+package signedurl_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/tests/testutils"
+	"github.com/effective-security/porto/xhttp/identity"
+	"github.com/effective-security/porto/xhttp/signedurl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func request(method, rawURL string) *http.Request {
+	r := httptest.NewRequest(method, rawURL, nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	return r
+}
+
+func TestNew(t *testing.T) {
+	_, err := signedurl.New()
+	assert.EqualError(t, err, "signedurl: secret is required")
+	_, err = signedurl.New([]byte{})
+	assert.EqualError(t, err, "signedurl: empty secret")
+}
+
+func TestSignVerify(t *testing.T) {
+	s, err := signedurl.New([]byte("secret"))
+	require.NoError(t, err)
+
+	_, err = s.Sign("/v1/files/1", signedurl.Params{})
+	assert.EqualError(t, err, "signedurl: TTL is required")
+
+	signed, err := s.Sign("https://api.local/v1/files/1?name=a+b", signedurl.Params{TTL: time.Minute})
+	require.NoError(t, err)
+	u, err := url.Parse(signed)
+	require.NoError(t, err)
+	assert.Equal(t, "a b", u.Query().Get("name"))
+	assert.Equal(t, "GET,HEAD", u.Query().Get(signedurl.ParamMethods))
+
+	require.NoError(t, s.Verify(request(http.MethodGet, signed)))
+	require.NoError(t, s.Verify(request(http.MethodHead, signed)))
+	assert.Equal(t, signedurl.ErrMethodNotAllowed, s.Verify(request(http.MethodPut, signed)))
+
+	// tampered
+	q := u.Query()
+	q.Set("name", "other")
+	tampered := *u
+	tampered.RawQuery = q.Encode()
+	assert.Equal(t, signedurl.ErrInvalidSignature, s.Verify(request(http.MethodGet, tampered.String())))
+	tampered = *u
+	tampered.Path = "/v1/files/2"
+	assert.Equal(t, signedurl.ErrInvalidSignature, s.Verify(request(http.MethodGet, tampered.String())))
+
+	assert.Equal(t, signedurl.ErrMissingSignature, s.Verify(request(http.MethodGet, "/v1/files/1")))
+	assert.Equal(t, signedurl.ErrInvalidExpires, s.Verify(request(http.MethodGet, "/v1/files/1?x-signature=abcd")))
+
+	// rotation
+	s2, err := signedurl.New([]byte("new"), []byte("secret"))
+	require.NoError(t, err)
+	require.NoError(t, s2.Verify(request(http.MethodGet, signed)))
+	s3, err := signedurl.New([]byte("new"))
+	require.NoError(t, err)
+	assert.Equal(t, signedurl.ErrInvalidSignature, s3.Verify(request(http.MethodGet, signed)))
+
+	// expired
+	s.WithClock(testutils.NewClock(time.Now().Add(2 * time.Minute)))
+	assert.Equal(t, signedurl.ErrExpired, s.Verify(request(http.MethodGet, signed)))
+}
+
+func TestBind(t *testing.T) {
+	s, err := signedurl.New([]byte("secret"))
+	require.NoError(t, err)
+
+	signed, err := s.Sign("/v1/uploads/1", signedurl.Params{
+		TTL:      time.Minute,
+		Methods:  []string{http.MethodPut},
+		ClientIP: "10.0.0.1",
+		Subject:  "alice",
+	})
+	require.NoError(t, err)
+
+	alice := identity.NewIdentity("user", "alice", "", nil, "", "")
+	bob := identity.NewIdentity("user", "bob", "", nil, "", "")
+
+	withIdentity := func(r *http.Request, idn identity.Identity) *http.Request {
+		rc := identity.NewRequestContext(idn)
+		return r.WithContext(identity.AddToContext(r.Context(), rc))
+	}
+
+	require.NoError(t, s.Verify(withIdentity(request(http.MethodPut, signed), alice)))
+	assert.Equal(t, signedurl.ErrInvalidSignature, s.Verify(withIdentity(request(http.MethodPut, signed), bob)))
+
+	r := withIdentity(request(http.MethodPut, signed), alice)
+	r.RemoteAddr = "10.0.0.2:1234"
+	assert.Equal(t, signedurl.ErrInvalidSignature, s.Verify(r))
+}
+
+func TestHandler(t *testing.T) {
+	s, err := signedurl.New([]byte("secret"))
+	require.NoError(t, err)
+
+	h := signedurl.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}), s)
+
+	signed, err := s.Sign("/v1/files/1", signedurl.Params{TTL: time.Minute})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, request(http.MethodGet, signed))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, request(http.MethodGet, "/v1/files/1"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "signedurl: missing signature")
+}
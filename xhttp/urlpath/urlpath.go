@@ -0,0 +1,69 @@
+// Package urlpath provides normalization of URL paths,
+// shared by the router and authz, so that policies can't be bypassed
+// with path tricks like /admin/%2e%2e/ or /public//admin.
+package urlpath
+
+import (
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Clean returns the canonical path: with leading slash, without empty segments,
+// and with resolved dot segments. The trailing slash is preserved.
+func Clean(p string) string {
+	if p == "" {
+		return "/"
+	}
+	if p == "/" {
+		return p
+	}
+	cleaned := path.Clean("/" + p)
+	if cleaned != "/" && (strings.HasSuffix(p, "/") || strings.HasSuffix(p, "/.") || strings.HasSuffix(p, "/..")) {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// Segments returns the segments of the canonical path
+func Segments(p string) []string {
+	p = strings.Trim(Clean(p), "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// suspicious encodings in the escaped path
+var suspiciousEncodings = []struct {
+	value  string
+	reason string
+}{
+	{"%2f", "encoded slash"},
+	{"%5c", "encoded backslash"},
+	{"%2e", "encoded dot"},
+	{"%00", "encoded NUL"},
+	{"%25", "double encoding"},
+}
+
+// CheckSuspicious returns error if the escaped path,
+// as returned by url.URL.EscapedPath, contains encoded slashes,
+// backslashes or dots, double encoding, or dot segments
+func CheckSuspicious(escapedPath string) error {
+	lower := strings.ToLower(escapedPath)
+	for _, s := range suspiciousEncodings {
+		if strings.Contains(lower, s.value) {
+			return errors.Errorf("%s in path", s.reason)
+		}
+	}
+	if strings.ContainsAny(escapedPath, "\\\x00") {
+		return errors.New("invalid character in path")
+	}
+	for _, seg := range strings.Split(escapedPath, "/") {
+		if seg == "." || seg == ".." {
+			return errors.New("dot segment in path")
+		}
+	}
+	return nil
+}
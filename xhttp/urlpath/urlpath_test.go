@@ -0,0 +1,62 @@
+package urlpath_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/effective-security/porto/xhttp/urlpath"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClean(t *testing.T) {
+	tcases := map[string]string{
+		"":                 "/",
+		"/":                "/",
+		"//":               "/",
+		"/a":               "/a",
+		"a/b":              "/a/b",
+		"/a/":              "/a/",
+		"//a///b//":        "/a/b/",
+		"/a/./b":           "/a/b",
+		"/a/b/..":          "/a/",
+		"/a/b/.":           "/a/b/",
+		"/admin/../public": "/public",
+		"/../../etc":       "/etc",
+		"/..":              "/",
+	}
+	for p, exp := range tcases {
+		assert.Equal(t, exp, urlpath.Clean(p), p)
+	}
+
+	assert.Equal(t, []string{"a", "b"}, urlpath.Segments("//a/./c/../b/"))
+	assert.Empty(t, urlpath.Segments("/.."))
+}
+
+func TestCheckSuspicious(t *testing.T) {
+	tcases := map[string]string{
+		"/v1/users/123":           "",
+		"/v1/users/a%20b":         "",
+		"/admin/%2e%2e/public":    "encoded dot in path",
+		"/admin%2Fusers":          "encoded slash in path",
+		"/admin%5cusers":          "encoded backslash in path",
+		"/admin%00":               "encoded NUL in path",
+		"/admin%252e%252e/public": "double encoding in path",
+		"/admin/../public":        "dot segment in path",
+		"/admin/./public":         "dot segment in path",
+		"/admin\\users":           "invalid character in path",
+	}
+	for p, exp := range tcases {
+		err := urlpath.CheckSuspicious(p)
+		if exp == "" {
+			assert.NoError(t, err, p)
+		} else {
+			assert.EqualError(t, err, exp, p)
+		}
+	}
+
+	u, err := url.Parse("http://localhost/admin/%2e%2e/public")
+	require.NoError(t, err)
+	assert.Equal(t, "/admin/../public", u.Path)
+	assert.Error(t, urlpath.CheckSuspicious(u.EscapedPath()))
+}
@@ -0,0 +1,356 @@
+// Package webhook provides helpers to sign and verify webhook requests.
+//
+// The signed content is `{timestamp}.{body}`, where timestamp is the Unix time
+// in seconds sent in the timestamp header.
+// The signature header contains one or more signatures in `v1={signature}` format,
+// separated by comma, to support the key rotation.
+// HMAC-SHA256 signatures are hex encoded, and Ed25519 signatures are base64 encoded.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/effective-security/porto/pkg/cache"
+	"github.com/effective-security/porto/x/clock"
+	"github.com/effective-security/porto/xhttp/httperror"
+	"github.com/effective-security/porto/xhttp/marshal"
+	"github.com/effective-security/xlog"
+	"github.com/pkg/errors"
+)
+
+var logger = xlog.NewPackageLogger("github.com/effective-security/porto/xhttp", "webhook")
+
+const (
+	// HeaderSignature is the default header name for the signature
+	HeaderSignature = "X-Webhook-Signature"
+	// HeaderTimestamp is the default header name for the timestamp
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	// HeaderID is the default header name for the unique delivery ID,
+	// it is not signed, and used only for logging
+	HeaderID = "X-Webhook-ID"
+
+	// SignatureVersion is the prefix of the signature in the header
+	SignatureVersion = "v1"
+
+	// DefaultTolerance is the default tolerance for the timestamp
+	DefaultTolerance = 5 * time.Minute
+
+	// DefaultMaxBodySize is the default limit of the body size
+	DefaultMaxBodySize = 1024 * 1024
+)
+
+// Errors returned by the Verifier
+var (
+	ErrMissingSignature = errors.New("webhook: missing signature")
+	ErrMissingTimestamp = errors.New("webhook: missing timestamp")
+	ErrInvalidTimestamp = errors.New("webhook: invalid timestamp")
+	ErrTimestampExpired = errors.New("webhook: timestamp outside of tolerance")
+	ErrInvalidSignature = errors.New("webhook: invalid signature")
+	ErrReplayed         = errors.New("webhook: replayed delivery")
+)
+
+// Scheme defines signature scheme
+type Scheme string
+
+const (
+	// HMACSHA256 scheme
+	HMACSHA256 Scheme = "hmac-sha256"
+	// Ed25519 scheme
+	Ed25519 Scheme = "ed25519"
+)
+
+// Verifier verifies webhook signatures
+type Verifier struct {
+	scheme  Scheme
+	secrets [][]byte
+	keys    []ed25519.PublicKey
+	opts    options
+}
+
+// NewHMACVerifier returns Verifier for HMAC-SHA256 signatures,
+// multiple secrets can be provided to support the rotation
+func NewHMACVerifier(secrets [][]byte, opts ...Option) *Verifier {
+	return newVerifier(&Verifier{
+		scheme:  HMACSHA256,
+		secrets: secrets,
+	}, opts)
+}
+
+// NewEd25519Verifier returns Verifier for Ed25519 signatures,
+// multiple keys can be provided to support the rotation
+func NewEd25519Verifier(keys []ed25519.PublicKey, opts ...Option) *Verifier {
+	return newVerifier(&Verifier{
+		scheme: Ed25519,
+		keys:   keys,
+	}, opts)
+}
+
+func newVerifier(v *Verifier, opts []Option) *Verifier {
+	v.opts = options{
+		tolerance:       DefaultTolerance,
+		signatureHeader: HeaderSignature,
+		timestampHeader: HeaderTimestamp,
+		idHeader:        HeaderID,
+		maxBodySize:     DefaultMaxBodySize,
+		clock:           clock.System,
+	}
+	for _, opt := range opts {
+		opt.apply(&v.opts)
+	}
+	return v
+}
+
+// Scheme returns the signature scheme
+func (v *Verifier) Scheme() Scheme {
+	return v.scheme
+}
+
+// Verify verifies the signature of the body
+func (v *Verifier) Verify(ctx context.Context, hdr http.Header, body []byte) error {
+	sigs := parseSignatures(hdr.Get(v.opts.signatureHeader))
+	if len(sigs) == 0 {
+		return ErrMissingSignature
+	}
+
+	tsHeader := hdr.Get(v.opts.timestampHeader)
+	if tsHeader == "" {
+		return ErrMissingTimestamp
+	}
+	ts, err := strconv.ParseInt(tsHeader, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+
+	diff := v.opts.clock.Now().Sub(time.Unix(ts, 0))
+	if diff < 0 {
+		diff = -diff
+	}
+	if v.opts.tolerance > 0 && diff > v.opts.tolerance {
+		return ErrTimestampExpired
+	}
+
+	content := signedContent(tsHeader, body)
+	sig := v.verifyContent(content, sigs)
+	if sig == nil {
+		return ErrInvalidSignature
+	}
+
+	if v.opts.replayCache != nil {
+		if err = v.checkReplay(ctx, sig, hdr.Get(v.opts.idHeader)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VerifyRequest reads the body and verifies the signature of the request,
+// the body of the request is restored and can be read again
+func (v *Verifier) VerifyRequest(r *http.Request) ([]byte, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, v.opts.maxBodySize+1))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		r.Body.Close()
+		if int64(len(body)) > v.opts.maxBodySize {
+			return nil, httperror.RequestTooLarge("webhook body exceeds %d bytes", v.opts.maxBodySize)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return body, v.Verify(r.Context(), r.Header, body)
+}
+
+// verifyContent returns the decoded signature, that matched the content,
+// or nil if none matched
+func (v *Verifier) verifyContent(content []byte, sigs []string) []byte {
+	for _, sig := range sigs {
+		switch v.scheme {
+		case HMACSHA256:
+			expected, err := hex.DecodeString(sig)
+			if err != nil {
+				continue
+			}
+			for _, secret := range v.secrets {
+				if hmac.Equal(expected, hmacSHA256(secret, content)) {
+					return expected
+				}
+			}
+		case Ed25519:
+			raw, err := base64.StdEncoding.DecodeString(sig)
+			if err != nil || len(raw) != ed25519.SignatureSize {
+				continue
+			}
+			for _, key := range v.keys {
+				if ed25519.Verify(key, content, raw) {
+					return raw
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkReplay stores the verified signature, as the signed content
+// can not be changed without the signature,
+// while the delivery ID header is not signed
+func (v *Verifier) checkReplay(ctx context.Context, sig []byte, id string) error {
+	// the decoded signature, as the encoding may vary, e.g. hex case
+	key := "webhook:" + string(v.scheme) + ":" + hex.EncodeToString(sig)
+
+	// keep the signature for the tolerance window on both sides of the timestamp
+	ttl := 2 * v.opts.tolerance
+	if ttl <= 0 {
+		ttl = 2 * DefaultTolerance
+	}
+	set, err := v.opts.replayCache.SetNX(ctx, key, v.opts.clock.Now().Unix(), ttl)
+	if err != nil {
+		return errors.WithMessage(err, "webhook: unable to update replay cache")
+	}
+	if !set {
+		logger.ContextKV(ctx, xlog.WARNING,
+			"reason", "replayed",
+			"id", id)
+		return ErrReplayed
+	}
+	return nil
+}
+
+// NewHandler returns http.Handler that verifies the webhook signature
+// before calling the delegate, and returns 401 if the verification failed
+func NewHandler(delegate http.Handler, v *Verifier) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := v.VerifyRequest(r)
+		if err != nil {
+			logger.ContextKV(r.Context(), xlog.DEBUG,
+				"path", r.URL.Path,
+				"err", err.Error())
+
+			var herr *httperror.Error
+			if errors.As(err, &herr) {
+				marshal.WriteJSON(w, r, herr)
+				return
+			}
+			marshal.WriteJSON(w, r, httperror.Unauthorized("%s", err.Error()))
+			return
+		}
+		delegate.ServeHTTP(w, r)
+	})
+}
+
+// SignHMAC returns the signature header value for HMAC-SHA256 scheme
+func SignHMAC(secret []byte, timestamp int64, body []byte) string {
+	content := signedContent(strconv.FormatInt(timestamp, 10), body)
+	return SignatureVersion + "=" + hex.EncodeToString(hmacSHA256(secret, content))
+}
+
+// SignEd25519 returns the signature header value for Ed25519 scheme
+func SignEd25519(key ed25519.PrivateKey, timestamp int64, body []byte) string {
+	content := signedContent(strconv.FormatInt(timestamp, 10), body)
+	return SignatureVersion + "=" + base64.StdEncoding.EncodeToString(ed25519.Sign(key, content))
+}
+
+func hmacSHA256(secret, content []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write(content)
+	return mac.Sum(nil)
+}
+
+func signedContent(timestamp string, body []byte) []byte {
+	content := make([]byte, 0, len(timestamp)+1+len(body))
+	content = append(content, timestamp...)
+	content = append(content, '.')
+	return append(content, body...)
+}
+
+func parseSignatures(val string) []string {
+	var sigs []string
+	for _, part := range strings.Split(val, ",") {
+		part = strings.TrimSpace(part)
+		if sig, ok := strings.CutPrefix(part, SignatureVersion+"="); ok && sig != "" {
+			sigs = append(sigs, sig)
+		}
+	}
+	return sigs
+}
+
+// Option configures the Verifier
+type Option interface {
+	apply(*options)
+}
+
+type options struct {
+	tolerance       time.Duration
+	signatureHeader string
+	timestampHeader string
+	idHeader        string
+	maxBodySize     int64
+	replayCache     cache.Locker
+	clock           clock.Clock
+}
+
+type funcOption struct {
+	f func(*options)
+}
+
+func (fo *funcOption) apply(o *options) {
+	fo.f(o)
+}
+
+func newFuncOption(f func(*options)) *funcOption {
+	return &funcOption{
+		f: f,
+	}
+}
+
+// WithTolerance specifies the allowed difference between the timestamp and the current time,
+// zero value disables the check
+func WithTolerance(tolerance time.Duration) Option {
+	return newFuncOption(func(o *options) {
+		o.tolerance = tolerance
+	})
+}
+
+// WithHeaders specifies the names of signature, timestamp and ID headers
+func WithHeaders(signature, timestamp, id string) Option {
+	return newFuncOption(func(o *options) {
+		o.signatureHeader = signature
+		o.timestampHeader = timestamp
+		o.idHeader = id
+	})
+}
+
+// WithMaxBodySize specifies the limit of the body size
+func WithMaxBodySize(size int64) Option {
+	return newFuncOption(func(o *options) {
+		o.maxBodySize = size
+	})
+}
+
+// WithReplayCache enables the replay protection,
+// the verified signature is stored in the cache for the tolerance window
+// with SetNX, so the concurrent replays are rejected
+func WithReplayCache(c cache.Locker) Option {
+	return newFuncOption(func(o *options) {
+		o.replayCache = c
+	})
+}
+
+// WithClock specifies the time source to validate the timestamp
+func WithClock(c clock.Clock) Option {
+	return newFuncOption(func(o *options) {
+		o.clock = clock.OrSystem(c)
+	})
+}
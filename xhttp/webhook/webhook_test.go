@@ -0,0 +1,177 @@
+package webhook_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/effective-security/porto/pkg/cache"
+	"github.com/effective-security/porto/tests/testutils"
+	"github.com/effective-security/porto/xhttp/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func headers(sig string, ts int64, id string) http.Header {
+	hdr := http.Header{}
+	if sig != "" {
+		hdr.Set(webhook.HeaderSignature, sig)
+	}
+	if ts != 0 {
+		hdr.Set(webhook.HeaderTimestamp, strconv.FormatInt(ts, 10))
+	}
+	if id != "" {
+		hdr.Set(webhook.HeaderID, id)
+	}
+	return hdr
+}
+
+func TestHMAC(t *testing.T) {
+	ctx := context.Background()
+	body := []byte(`{"event":"created"}`)
+	now := time.Now().Unix()
+
+	secret := []byte("secret")
+	v := webhook.NewHMACVerifier([][]byte{[]byte("new"), secret})
+	assert.Equal(t, webhook.HMACSHA256, v.Scheme())
+
+	sig := webhook.SignHMAC(secret, now, body)
+	assert.True(t, strings.HasPrefix(sig, "v1="))
+	require.NoError(t, v.Verify(ctx, headers(sig, now, ""), body))
+	// multiple signatures
+	require.NoError(t, v.Verify(ctx, headers("v1=bad,"+sig, now, ""), body))
+
+	assert.Equal(t, webhook.ErrMissingSignature, v.Verify(ctx, headers("", now, ""), body))
+	assert.Equal(t, webhook.ErrMissingSignature, v.Verify(ctx, headers("v0=abc", now, ""), body))
+	assert.Equal(t, webhook.ErrMissingTimestamp, v.Verify(ctx, headers(sig, 0, ""), body))
+	assert.Equal(t, webhook.ErrInvalidSignature, v.Verify(ctx, headers(sig, now, ""), []byte(`{}`)))
+	assert.Equal(t, webhook.ErrInvalidSignature, v.Verify(ctx, headers(sig, now+1, ""), body))
+	assert.Equal(t, webhook.ErrInvalidSignature, v.Verify(ctx, headers(webhook.SignHMAC([]byte("wrong"), now, body), now, ""), body))
+
+	old := now - 600
+	assert.Equal(t, webhook.ErrTimestampExpired, v.Verify(ctx, headers(webhook.SignHMAC(secret, old, body), old, ""), body))
+
+	hdr := headers(sig, 0, "")
+	hdr.Set(webhook.HeaderTimestamp, "invalid")
+	assert.Equal(t, webhook.ErrInvalidTimestamp, v.Verify(ctx, hdr, body))
+
+	v = webhook.NewHMACVerifier([][]byte{secret}, webhook.WithTolerance(0))
+	require.NoError(t, v.Verify(ctx, headers(webhook.SignHMAC(secret, old, body), old, ""), body))
+
+	clk := testutils.NewClock(time.Unix(old, 0))
+	v = webhook.NewHMACVerifier([][]byte{secret}, webhook.WithClock(clk))
+	require.NoError(t, v.Verify(ctx, headers(webhook.SignHMAC(secret, old, body), old, ""), body))
+	clk.Advance(10 * time.Minute)
+	assert.Equal(t, webhook.ErrTimestampExpired, v.Verify(ctx, headers(webhook.SignHMAC(secret, old, body), old, ""), body))
+}
+
+func TestEd25519(t *testing.T) {
+	ctx := context.Background()
+	body := []byte(`{"event":"created"}`)
+	now := time.Now().Unix()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	pub2, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	v := webhook.NewEd25519Verifier([]ed25519.PublicKey{pub2, pub})
+	assert.Equal(t, webhook.Ed25519, v.Scheme())
+
+	sig := webhook.SignEd25519(priv, now, body)
+	require.NoError(t, v.Verify(ctx, headers(sig, now, ""), body))
+	assert.Equal(t, webhook.ErrInvalidSignature, v.Verify(ctx, headers(sig, now, ""), []byte(`{}`)))
+	assert.Equal(t, webhook.ErrInvalidSignature, v.Verify(ctx, headers("v1=invalid", now, ""), body))
+}
+
+func TestReplay(t *testing.T) {
+	ctx := context.Background()
+	body := []byte(`{"event":"created"}`)
+	now := time.Now().Unix()
+	secret := []byte("secret")
+
+	v := webhook.NewHMACVerifier([][]byte{secret},
+		webhook.WithReplayCache(cache.NewMemoryProvider("test").(cache.Locker)),
+		webhook.WithHeaders("X-Sig", "X-Ts", "X-Id"),
+	)
+
+	sig := webhook.SignHMAC(secret, now, body)
+	hdr := http.Header{}
+	hdr.Set("X-Sig", sig)
+	hdr.Set("X-Ts", strconv.FormatInt(now, 10))
+	hdr.Set("X-Id", "delivery1")
+
+	require.NoError(t, v.Verify(ctx, hdr, body))
+	assert.Equal(t, webhook.ErrReplayed, v.Verify(ctx, hdr, body))
+
+	// the ID is not signed
+	hdr.Set("X-Id", "delivery2")
+	assert.Equal(t, webhook.ErrReplayed, v.Verify(ctx, hdr, body))
+	hdr.Del("X-Id")
+	assert.Equal(t, webhook.ErrReplayed, v.Verify(ctx, hdr, body))
+
+	// the encoding of the signature
+	hdr.Set("X-Sig", "v1=invalid, v1="+strings.ToUpper(strings.TrimPrefix(sig, "v1=")))
+	assert.Equal(t, webhook.ErrReplayed, v.Verify(ctx, hdr, body))
+
+	// concurrent replays
+	hdr.Set("X-Sig", webhook.SignHMAC(secret, now, []byte(`{"event":"deleted"}`)))
+	var wg sync.WaitGroup
+	var accepted atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v.Verify(ctx, hdr, []byte(`{"event":"deleted"}`)) == nil {
+				accepted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), accepted.Load())
+}
+
+func TestHandler(t *testing.T) {
+	secret := []byte("secret")
+	v := webhook.NewHMACVerifier([][]byte{secret}, webhook.WithMaxBodySize(64))
+
+	called := 0
+	h := webhook.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called++
+		w.WriteHeader(http.StatusNoContent)
+	}), v)
+
+	body := `{"event":"created"}`
+	now := time.Now().Unix()
+
+	r := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(body))
+	r.Header = headers(webhook.SignHMAC(secret, now, []byte(body)), now, "")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, 1, called)
+
+	r = httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(body))
+	r.Header = headers(webhook.SignHMAC([]byte("wrong"), now, []byte(body)), now, "")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid signature")
+
+	large := strings.Repeat("a", 100)
+	r = httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(large))
+	r.Header = headers(webhook.SignHMAC(secret, now, []byte(large)), now, "")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "request_too_large")
+	assert.Equal(t, 1, called)
+}